@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
@@ -81,14 +84,61 @@ type anim struct {
 	ellipsis        spinner.Model    // 省略号旋转器模型
 	ellipsisStarted bool             // 省略号是否已启动
 	styles          styles           // 样式配置
+	received        int              // 已接收的数据块数，每块大约是一个 token
+	gap             string           // 循环字符和标签之间的空格
+	status          statusText       // 状态文本，是模板时随时间刷新
+}
+
+// statusText 是 --status-text 的内容。文本可以是模板，使用 {{.model}}、{{.api}} 和 {{.elapsed}}
+type statusText struct {
+	text  string             // --status-text 的原文
+	tmpl  *template.Template // 解析后的模板，不是模板或者解析失败时为 nil
+	model string             // 模型名称
+	api   string             // API 名称
+}
+
+// newStatusText 解析 --status-text
+// text: 状态文本
+// model: 模型名称
+// api: API 名称
+func newStatusText(text, model, api string) statusText {
+	s := statusText{text: text, model: model, api: api}
+	if strings.Contains(text, "{{") {
+		if tmpl, err := template.New("status-text").Funcs(templateFuncs()).Parse(text); err == nil {
+			s.tmpl = tmpl
+		}
+	}
+	return s
+}
+
+// render 返回经过 elapsed 时间后的状态文本，模板渲染失败时返回原文
+func (s statusText) render(elapsed time.Duration) string {
+	if s.tmpl == nil {
+		return s.text
+	}
+	var sb strings.Builder
+	if err := s.tmpl.Execute(&sb, map[string]string{
+		"model":   s.model,
+		"api":     s.api,
+		"elapsed": elapsed.Truncate(time.Second).String(),
+	}); err != nil {
+		return s.text
+	}
+	return sb.String()
+}
+
+// newStatusAnim 按 --status-text 和当前的模型创建动画
+func (m *Mods) newStatusAnim() anim {
+	status := newStatusText(m.Config.StatusText, m.Config.Model, m.Config.API)
+	return newAnim(m.Config.Fanciness, status, m.renderer, m.Styles)
 }
 
 // newAnim 创建一个新的动画实例
 // cyclingCharsSize: 循环字符数量
-// label: 标签文本
+// status: 状态文本
 // r: lipgloss 渲染器
 // s: 样式配置
-func newAnim(cyclingCharsSize uint, label string, r *lipgloss.Renderer, s styles) anim {
+func newAnim(cyclingCharsSize uint, status statusText, r *lipgloss.Renderer, s styles) anim {
 	// #nosec G115
 	n := int(cyclingCharsSize)
 	if n > maxCyclingChars {
@@ -102,9 +152,11 @@ func newAnim(cyclingCharsSize uint, label string, r *lipgloss.Renderer, s styles
 
 	c := anim{
 		start:    time.Now(),
-		label:    []rune(gap + label),
+		label:    []rune(gap + status.render(0)),
 		ellipsis: spinner.New(spinner.WithSpinner(spinner.Ellipsis)),
 		styles:   s,
+		gap:      gap,
+		status:   status,
 	}
 
 	// 如果处于真彩色模式（并且有足够的循环字符）
@@ -195,6 +247,10 @@ func (a anim) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		var cmd tea.Cmd
 		a.ellipsis, cmd = a.ellipsis.Update(msg)
 		return a, cmd
+	case completionOutput:
+		// 思考内容被隐藏或工具调用时仍在等待，统计已接收的数据块以显示进展
+		a.received++
+		return a, nil
 	default:
 		return a, nil
 	}
@@ -226,11 +282,32 @@ func (a anim) View() string {
 		b.WriteRune(c.currentValue)
 	}
 
-	for _, c := range a.labelChars {
-		b.WriteRune(c.currentValue)
+	if a.ellipsisStarted && a.status.tmpl != nil {
+		// 标签的动画结束后，模板随时间刷新
+		b.WriteString(a.gap + a.status.render(time.Since(a.start)))
+	} else {
+		for _, c := range a.labelChars {
+			b.WriteRune(c.currentValue)
+		}
 	}
 
-	return b.String() + a.ellipsis.View()
+	b.WriteString(a.ellipsis.View())
+	if a.received > 0 {
+		b.WriteString(a.styles.Comment.Render(fmt.Sprintf(
+			" 已接收 %s tokens / %ds",
+			formatCount(a.received),
+			int(time.Since(a.start).Seconds()),
+		)))
+	}
+	return b.String()
+}
+
+// formatCount 以 1.2k 的形式缩写较大的数字
+func formatCount(n int) string {
+	if n < 1000 { //nolint:mnd
+		return strconv.Itoa(n)
+	}
+	return strconv.FormatFloat(float64(n)/1000, 'f', 1, 64) + "k" //nolint:mnd
 }
 
 // makeGradientRamp 创建渐变色彩条
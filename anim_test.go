@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnimReceived(t *testing.T) {
+	t.Run("格式化数量", func(t *testing.T) {
+		require.Equal(t, "999", formatCount(999))
+		require.Equal(t, "1.0k", formatCount(1000))
+		require.Equal(t, "1.2k", formatCount(1234))
+	})
+
+	t.Run("统计数据块", func(t *testing.T) {
+		r := lipgloss.DefaultRenderer()
+		var a tea.Model = newAnim(0, newStatusText("生成中", "", ""), r, makeStyles(r))
+		require.NotContains(t, a.View(), "已接收")
+		for range 3 {
+			a, _ = a.Update(completionOutput{})
+		}
+		require.Contains(t, a.View(), "已接收 3 tokens / 0s")
+	})
+}
+
+func TestStatusText(t *testing.T) {
+	t.Run("固定文本", func(t *testing.T) {
+		s := newStatusText("生成中", "gpt-4o", "openai")
+		require.Nil(t, s.tmpl)
+		require.Equal(t, "生成中", s.render(time.Minute))
+	})
+
+	t.Run("模板", func(t *testing.T) {
+		s := newStatusText("正在询问 {{.model}}（{{.api}}）…({{.elapsed}})", "gpt-4o", "openai")
+		require.Equal(t, "正在询问 gpt-4o（openai）…(0s)", s.render(0))
+		require.Equal(t, "正在询问 gpt-4o（openai）…(1m5s)", s.render(65*time.Second+300*time.Millisecond))
+	})
+
+	t.Run("无效的模板使用原文", func(t *testing.T) {
+		require.Equal(t, "{{.model", newStatusText("{{.model", "m", "a").render(0))
+	})
+
+	t.Run("标签动画结束后刷新", func(t *testing.T) {
+		r := lipgloss.DefaultRenderer()
+		a := newAnim(0, newStatusText("{{.model}} {{.elapsed}}", "m", "a"), r, makeStyles(r))
+		require.Equal(t, "m 0s", string(a.label))
+		a.start = a.start.Add(-3 * time.Second)
+		a.ellipsisStarted = true
+		require.Contains(t, a.View(), "m 3s")
+	})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	"github.com/charmbracelet/mods/internal/google"
+	"github.com/cohere-ai/cohere-go/v2/core"
+	ollamaapi "github.com/ollama/ollama/api"
+	"github.com/openai/openai-go"
+)
+
+// apiErrorKind 是归一化后的 API 错误类别，重试策略只依据类别决定
+type apiErrorKind int
+
+const (
+	apiErrorUnknown       apiErrorKind = iota // 无法归类，重试
+	apiErrorRateLimit                         // 速率限制或服务过载，按服务器要求的时间等待后重试
+	apiErrorAuth                              // 认证失败或没有权限，不重试
+	apiErrorContextLength                     // 超出上下文长度，裁剪提示词后重试
+	apiErrorNotFound                          // 模型不存在，有回退模型时换用回退模型
+	apiErrorBadRequest                        // 其它请求错误，不重试
+	apiErrorServer                            // 服务器错误，重试
+)
+
+// apiError 是各个 API 返回的错误归一化后的结果
+type apiError struct {
+	err     error         // 原始错误
+	kind    apiErrorKind  // 类别
+	status  int           // HTTP 状态码，未知时为 0
+	message string        // 错误消息，用于裁剪提示词
+	wait    time.Duration // 服务器通过响应头要求的等待时间
+}
+
+// contextLengthMessages 是各个 API 超出上下文长度时错误消息中的片段
+var contextLengthMessages = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"prompt is too long",                     // anthropic
+	"too many tokens",                        // cohere
+	"exceeds the maximum number of tokens",   // google
+	"input is too long",                      // bedrock
+	"input length and `max_tokens` exceed",   // anthropic
+	"reduce the length of the messages",      // OpenAI 兼容的 API
+	"maximum allowed number of input tokens", // google
+	"exceeds the context length",             // ollama
+	"exceeds maximum context length",         // ollama
+}
+
+// isContextLengthMessage 判断错误消息是否表示超出了上下文长度
+func isContextLengthMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, s := range contextLengthMessages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeAPIError 把 openai（以及 OpenAI 兼容的 API）、anthropic、google、cohere、
+// ollama 和 bedrock 返回的错误归一化。不是 API 返回的错误（例如网络错误）时返回 false
+func normalizeAPIError(err error) (apiError, bool) {
+	var (
+		oe *openai.Error
+		ae *anthropic.Error
+		ge *google.APIError
+		ce *core.APIError
+		se ollamaapi.StatusError
+		ue ollamaapi.AuthorizationError
+		re *awshttp.ResponseError
+	)
+	switch {
+	case errors.As(err, &oe):
+		e := apiError{err: err, status: oe.StatusCode, message: oe.Message}
+		e.kind = kindFromStatus(e.status, e.message)
+		if oe.Code == "context_length_exceeded" {
+			e.kind = apiErrorContextLength
+		}
+		e.wait = rateLimitWait(oe.Response)
+		return e, true
+	case errors.As(err, &ae):
+		return anthropicError(err, ae), true
+	case errors.As(err, &ge):
+		return googleError(err, ge), true
+	case errors.As(err, &ce):
+		e := apiError{err: err, status: ce.StatusCode, message: err.Error()}
+		e.kind = kindFromStatus(e.status, e.message)
+		e.wait = rateLimitWait(&http.Response{Header: ce.Header})
+		return e, true
+	case errors.As(err, &ue):
+		return apiError{err: err, kind: apiErrorAuth, status: ue.StatusCode, message: ue.Status}, true
+	case errors.As(err, &se):
+		e := apiError{err: err, status: se.StatusCode, message: se.ErrorMessage}
+		e.kind = kindFromStatus(e.status, e.message)
+		return e, true
+	case errors.As(err, &re):
+		return bedrockError(err, re), true
+	}
+	return apiError{}, false
+}
+
+// kindFromStatus 根据 HTTP 状态码和错误消息归类
+func kindFromStatus(status int, msg string) apiErrorKind {
+	switch {
+	case isContextLengthMessage(msg) && status < http.StatusInternalServerError:
+		return apiErrorContextLength
+	case status == http.StatusTooManyRequests, status == 529: //nolint:mnd // anthropic 的 overloaded
+		return apiErrorRateLimit
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return apiErrorAuth
+	case status == http.StatusNotFound:
+		return apiErrorNotFound
+	case status == http.StatusRequestTimeout, status == http.StatusConflict:
+		return apiErrorUnknown
+	case status >= http.StatusInternalServerError:
+		return apiErrorServer
+	case status >= http.StatusBadRequest:
+		return apiErrorBadRequest
+	}
+	return apiErrorUnknown
+}
+
+// anthropicError 归一化 anthropic 的错误，错误类别来自响应体中的 error.type
+func anthropicError(err error, ae *anthropic.Error) apiError {
+	var body struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal([]byte(ae.RawJSON()), &body)
+	e := apiError{err: err, status: ae.StatusCode, message: body.Error.Message}
+	e.kind = kindFromStatus(e.status, e.message)
+	switch body.Error.Type {
+	case "rate_limit_error", "overloaded_error":
+		e.kind = apiErrorRateLimit
+	case "authentication_error", "permission_error":
+		e.kind = apiErrorAuth
+	case "not_found_error":
+		e.kind = apiErrorNotFound
+	}
+	e.wait = rateLimitWait(ae.Response)
+	return e
+}
+
+// googleError 归一化 google 的错误，错误类别来自响应体中的 status 和 ErrorInfo 的原因
+func googleError(err error, ge *google.APIError) apiError {
+	e := apiError{err: err, status: ge.StatusCode, message: ge.Message}
+	e.kind = kindFromStatus(e.status, e.message)
+	switch ge.Status {
+	case "RESOURCE_EXHAUSTED":
+		e.kind = apiErrorRateLimit
+	case "UNAUTHENTICATED", "PERMISSION_DENIED":
+		e.kind = apiErrorAuth
+	case "NOT_FOUND":
+		e.kind = apiErrorNotFound
+	case "UNAVAILABLE", "INTERNAL", "DEADLINE_EXCEEDED":
+		e.kind = apiErrorServer
+	}
+	// 无效的 API 密钥返回的是 400 INVALID_ARGUMENT
+	if strings.HasPrefix(ge.Reason, "API_KEY_") {
+		e.kind = apiErrorAuth
+	}
+	e.wait = ge.RetryDelay
+	if e.wait == 0 {
+		e.wait = rateLimitWait(&http.Response{Header: ge.Header})
+	}
+	return e
+}
+
+// bedrockError 归一化 bedrock 的错误，错误类别来自 AWS 的错误码
+func bedrockError(err error, re *awshttp.ResponseError) apiError {
+	e := apiError{err: err, status: re.HTTPStatusCode(), message: err.Error()}
+	e.kind = kindFromStatus(e.status, e.message)
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		e.message = ae.ErrorMessage()
+		switch ae.ErrorCode() {
+		case "ThrottlingException", "ServiceQuotaExceededException", "ServiceUnavailableException":
+			e.kind = apiErrorRateLimit
+		case "AccessDeniedException", "UnrecognizedClientException", "ExpiredTokenException":
+			e.kind = apiErrorAuth
+		case "ResourceNotFoundException":
+			e.kind = apiErrorNotFound
+		case "ValidationException":
+			e.kind = kindFromStatus(http.StatusBadRequest, e.message)
+		}
+	}
+	if re.Response != nil {
+		e.wait = rateLimitWait(re.Response.Response)
+	}
+	return e
+}
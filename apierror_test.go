@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/charmbracelet/mods/internal/google"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/cohere-ai/cohere-go/v2/core"
+	ollamaapi "github.com/ollama/ollama/api"
+	"github.com/openai/openai-go"
+	"github.com/stretchr/testify/require"
+)
+
+func anthropicErr(t *testing.T, status int, body string) error {
+	t.Helper()
+	ae := &anthropic.Error{StatusCode: status, Response: &http.Response{StatusCode: status, Header: http.Header{}}}
+	require.NoError(t, ae.UnmarshalJSON([]byte(body)))
+	return ae
+}
+
+func bedrockErr(status int, err error) error {
+	return fmt.Errorf("operation error Bedrock Runtime: ConverseStream: %w", &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status, Header: http.Header{}}},
+			Err:      err,
+		},
+	})
+}
+
+func TestNormalizeAPIError(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err  error
+		kind apiErrorKind
+		wait time.Duration
+	}{
+		"openai 超出上下文": {
+			err:  &openai.Error{StatusCode: http.StatusBadRequest, Code: "context_length_exceeded"},
+			kind: apiErrorContextLength,
+		},
+		"openai 限流": {
+			err: &openai.Error{
+				StatusCode: http.StatusTooManyRequests,
+				Response:   &http.Response{Header: http.Header{"Retry-After": {"3"}}},
+			},
+			kind: apiErrorRateLimit,
+			wait: 3 * time.Second,
+		},
+		"openai 服务器错误": {
+			err:  &openai.Error{StatusCode: http.StatusBadGateway},
+			kind: apiErrorServer,
+		},
+		"anthropic 过载": {
+			err:  anthropicErr(t, 529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`),
+			kind: apiErrorRateLimit,
+		},
+		"anthropic 密钥无效": {
+			err:  anthropicErr(t, http.StatusUnauthorized, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`),
+			kind: apiErrorAuth,
+		},
+		"anthropic 超出上下文": {
+			err:  anthropicErr(t, http.StatusBadRequest, `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`),
+			kind: apiErrorContextLength,
+		},
+		"google 限流": {
+			err: &google.APIError{
+				StatusCode: http.StatusTooManyRequests,
+				Status:     "RESOURCE_EXHAUSTED",
+				RetryDelay: 31 * time.Second,
+				Header:     http.Header{"Retry-After": {"5"}},
+			},
+			kind: apiErrorRateLimit,
+			wait: 31 * time.Second,
+		},
+		"google 服务不可用": {
+			err:  &google.APIError{StatusCode: http.StatusServiceUnavailable, Status: "UNAVAILABLE"},
+			kind: apiErrorServer,
+		},
+		"google 密钥无效": {
+			err:  &google.APIError{StatusCode: http.StatusBadRequest, Status: "INVALID_ARGUMENT", Reason: "API_KEY_INVALID"},
+			kind: apiErrorAuth,
+		},
+		"google 超出上下文": {
+			err: &google.APIError{
+				StatusCode: http.StatusBadRequest,
+				Status:     "INVALID_ARGUMENT",
+				Message:    "The input token count (1200000) exceeds the maximum number of tokens allowed (1048576).",
+			},
+			kind: apiErrorContextLength,
+		},
+		"cohere 限流": {
+			err:  fmt.Errorf("cohere: %w", core.NewAPIError(http.StatusTooManyRequests, http.Header{"Retry-After": {"2"}}, errors.New("slow down"))),
+			kind: apiErrorRateLimit,
+			wait: 2 * time.Second,
+		},
+		"cohere 超出上下文": {
+			err:  core.NewAPIError(http.StatusBadRequest, nil, errors.New("too many tokens: total number of tokens exceeds the limit")),
+			kind: apiErrorContextLength,
+		},
+		"ollama 缺少模型": {
+			err:  ollamaapi.StatusError{StatusCode: http.StatusNotFound, ErrorMessage: `model "x" not found`},
+			kind: apiErrorNotFound,
+		},
+		"ollama 超出上下文": {
+			err:  ollamaapi.StatusError{StatusCode: http.StatusBadRequest, ErrorMessage: "the input length exceeds the context length"},
+			kind: apiErrorContextLength,
+		},
+		"ollama 需要登录": {
+			err:  ollamaapi.AuthorizationError{StatusCode: http.StatusUnauthorized},
+			kind: apiErrorAuth,
+		},
+		"bedrock 限流": {
+			err:  bedrockErr(http.StatusTooManyRequests, &types.ThrottlingException{Message: aws.String("Too many requests")}),
+			kind: apiErrorRateLimit,
+		},
+		"bedrock 超出上下文": {
+			err:  bedrockErr(http.StatusBadRequest, &types.ValidationException{Message: aws.String("Input is too long for requested model.")}),
+			kind: apiErrorContextLength,
+		},
+		"bedrock 没有权限": {
+			err:  bedrockErr(http.StatusForbidden, &types.AccessDeniedException{Message: aws.String("no access")}),
+			kind: apiErrorAuth,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			e, ok := normalizeAPIError(tc.err)
+			require.True(t, ok)
+			require.Equal(t, tc.kind, e.kind)
+			require.Equal(t, tc.wait, e.wait)
+			require.Equal(t, tc.err, e.err)
+		})
+	}
+
+	t.Run("不是 API 错误", func(t *testing.T) {
+		_, ok := normalizeAPIError(errors.New("connection refused"))
+		require.False(t, ok)
+	})
+}
+
+func TestHandleAPIError(t *testing.T) {
+	mod := Model{API: "anthropic", Name: "claude"}
+
+	t.Run("认证失败不重试", func(t *testing.T) {
+		m := &Mods{Config: &Config{MaxRetries: 5}}
+		e, _ := normalizeAPIError(anthropicErr(t, http.StatusUnauthorized, `{"type":"error","error":{"type":"authentication_error","message":"bad key"}}`))
+		msg := m.handleAPIError(e, mod, "hi")
+		require.IsType(t, modsError{}, msg)
+		require.Zero(t, m.retries)
+	})
+
+	t.Run("超出上下文时裁剪后重试", func(t *testing.T) {
+		m := &Mods{Config: &Config{MaxRetries: 5}}
+		e, _ := normalizeAPIError(anthropicErr(t, http.StatusBadRequest, `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 10 tokens > 3 maximum"}}`))
+		msg := m.handleAPIError(e, mod, "this is a long prompt I have no idea if its really 10 tokens")
+		require.Equal(t, completionInput{"this is a long prompt "}, msg)
+		require.Equal(t, 1, m.retries)
+	})
+
+	t.Run("错误消息中没有令牌数时按估算缩短", func(t *testing.T) {
+		m := &Mods{Config: &Config{MaxRetries: 5}}
+		e, _ := normalizeAPIError(ollamaapi.StatusError{StatusCode: http.StatusBadRequest, ErrorMessage: "the input length exceeds the context length"})
+		msg := m.handleAPIError(e, Model{API: "ollama", Name: "llama3"}, "one two three four five six seven eight")
+		require.Equal(t, completionInput{"one two three four five six"}, msg)
+		require.Equal(t, 1, m.retries)
+	})
+}
+
+func TestFallbackAPIs(t *testing.T) {
+	mod := Model{API: "openai", Name: "gpt-4o"}
+	newMods := func() *Mods {
+		return &Mods{Config: &Config{
+			MaxRetries: 5,
+			Quiet:      true,
+			API:        "openai",
+			Model:      "gpt-4o",
+			APIs: APIs{
+				{Name: "openai", Models: map[string]Model{"gpt-4o": {}}},
+				{Name: "azure", Models: map[string]Model{"gpt-4o": {}}},
+				{Name: "anthropic", Models: map[string]Model{"claude": {}}},
+				{Name: "ollama", Models: map[string]Model{}},
+			},
+			FallbackAPIs: []FallbackAPI{
+				{API: "openai"},
+				{API: "anthropic"},
+				{API: "azure"},
+				{API: "ollama", Model: "llama3.2"},
+			},
+		}}
+	}
+
+	t.Run("限流时改用下一个 API", func(t *testing.T) {
+		m := newMods()
+		m.retries = 2
+		e, _ := normalizeAPIError(anthropicErr(t, http.StatusTooManyRequests, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`))
+		msg := m.handleAPIError(e, mod, "hi")
+		require.Equal(t, completionInput{"hi"}, msg)
+		require.Equal(t, "azure", m.Config.API)
+		require.Equal(t, "gpt-4o", m.Config.Model)
+		require.Zero(t, m.retries)
+
+		// 连接失败时继续改用链上的下一个
+		msg = m.handleRequestError(errors.New("connection refused"), Model{API: "azure", Name: "gpt-4o"}, "hi")
+		require.Equal(t, completionInput{"hi"}, msg)
+		require.Equal(t, "ollama", m.Config.API)
+		require.Equal(t, "llama3.2", m.Config.Model)
+
+		// 链用完后按原来的方式处理
+		msg = m.handleRequestError(errors.New("connection refused"), Model{API: "ollama", Name: "llama3.2"}, "hi")
+		require.IsType(t, modsError{}, msg)
+	})
+
+	t.Run("认证失败不改用其他 API", func(t *testing.T) {
+		m := newMods()
+		e, _ := normalizeAPIError(anthropicErr(t, http.StatusUnauthorized, `{"type":"error","error":{"type":"authentication_error","message":"bad key"}}`))
+		require.IsType(t, modsError{}, m.handleAPIError(e, mod, "hi"))
+		require.Equal(t, "openai", m.Config.API)
+	})
+
+	t.Run("取消时不改用其他 API", func(t *testing.T) {
+		m := newMods()
+		require.IsType(t, modsError{}, m.handleRequestError(context.Canceled, mod, "hi"))
+		require.Equal(t, "openai", m.Config.API)
+	})
+}
+
+func TestRequestTimeout(t *testing.T) {
+	mod := Model{API: "openai", Name: "gpt-4o"}
+
+	t.Run("超时后取消请求", func(t *testing.T) {
+		m := &Mods{ctx: context.Background(), cancelMu: &sync.Mutex{}, Config: &Config{RequestTimeout: timeoutDuration(time.Millisecond)}}
+		ctx := m.requestContext(&proto.Request{})
+		<-ctx.Done()
+		require.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+
+		m.Config.RequestTimeout = -1
+		require.Equal(t, m.ctx, m.requestContext(&proto.Request{}))
+	})
+
+	t.Run("每一轮单独计时", func(t *testing.T) {
+		timeout := 100 * time.Millisecond
+		m := &Mods{ctx: context.Background(), cancelMu: &sync.Mutex{}, Config: &Config{RequestTimeout: timeoutDuration(timeout)}}
+		request := proto.Request{ToolCaller: func(string, []byte) (string, error) {
+			// 模拟等待用户确认
+			time.Sleep(2 * timeout)
+			return "ok", nil
+		}}
+		ctx := m.requestContext(&request)
+		for range 2 {
+			time.Sleep(timeout / 2)
+			_, err := request.ToolCaller("tool", nil)
+			require.NoError(t, err)
+			require.NoError(t, ctx.Err(), "执行工具的时间不计入超时")
+		}
+		<-ctx.Done()
+		require.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+	})
+
+	t.Run("取消父上下文", func(t *testing.T) {
+		parent, cancel := context.WithCancel(context.Background())
+		m := &Mods{ctx: parent, cancelMu: &sync.Mutex{}, Config: &Config{RequestTimeout: timeoutDuration(time.Minute)}}
+		ctx := m.requestContext(&proto.Request{})
+		cancel()
+		<-ctx.Done()
+		require.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+
+	t.Run("超时的错误信息", func(t *testing.T) {
+		m := &Mods{ctx: context.Background(), Config: &Config{RequestTimeout: timeoutDuration(2 * time.Minute), Quiet: true, MaxRetries: 5}}
+		msg := m.handleRequestError(fmt.Errorf("Post: %w", context.DeadlineExceeded), mod, "hi")
+		require.IsType(t, modsError{}, msg)
+		require.Equal(t, "openai API 在 2m0s 内没有完成请求。", msg.(modsError).reason)
+		require.ErrorContains(t, msg.(modsError).err, "--timeout")
+	})
+
+	t.Run("超时后改用其他 API", func(t *testing.T) {
+		m := &Mods{ctx: context.Background(), Config: &Config{
+			RequestTimeout: timeoutDuration(time.Minute),
+			Quiet:          true,
+			APIs:           APIs{{Name: "azure", Models: map[string]Model{"gpt-4o": {}}}},
+			FallbackAPIs:   []FallbackAPI{{API: "azure"}},
+		}}
+		msg := m.handleRequestError(context.DeadlineExceeded, mod, "hi")
+		require.Equal(t, completionInput{"hi"}, msg)
+		require.Equal(t, "azure", m.Config.API)
+	})
+}
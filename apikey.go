@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/go-shellwords"
+	"github.com/charmbracelet/mods/internal/cache"
+)
+
+// apiKeyCacheID 返回 api-key-cmd 结果的缓存标识，使用命令的哈希，不在文件名中暴露命令
+func apiKeyCacheID(command string) string {
+	sum := sha256.Sum256([]byte(command))
+	return "api-key-" + hex.EncodeToString(sum[:8])
+}
+
+// runAPIKeyCmd 执行 api-key-cmd 并返回密钥。配置了 api-key-cache-ttl 时，
+// 在有效期内复用上一次的结果，不再每次都要求解锁密码管理器
+// command: api-key-cmd 命令
+// 返回：密钥和错误信息
+func runAPIKeyCmd(command string) (string, error) {
+	var keys *cache.ExpiringCache[string]
+	if config.APIKeyCacheTTL > 0 {
+		// 缓存不可用时照常执行命令
+		keys, _ = cache.NewExpiring[string](config.CachePath)
+	}
+	id := apiKeyCacheID(command)
+	if keys != nil {
+		var key string
+		err := keys.Read(id, func(r io.Reader) error {
+			bts, err := io.ReadAll(r)
+			key = string(bts)
+			return err //nolint:wrapcheck
+		})
+		if err == nil && key != "" {
+			return key, nil
+		}
+	}
+
+	args, err := shellwords.Parse(command)
+	if err != nil {
+		return "", modsError{err, "解析 api-key-cmd 失败"}
+	}
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput() //nolint:gosec
+	if err != nil {
+		return "", modsError{err, "无法执行 api-key-cmd"}
+	}
+	key := strings.TrimSpace(string(out))
+
+	if keys != nil && key != "" {
+		expiresAt := time.Now().Add(config.APIKeyCacheTTL).Unix()
+		_ = keys.Write(id, expiresAt, func(w io.Writer) error {
+			_, err := io.WriteString(w, key)
+			return err //nolint:wrapcheck
+		})
+	}
+	return key, nil
+}
+
+// flushKeys 清除所有已配置的 api-key-cmd 的缓存结果
+func flushKeys() error {
+	keys, err := cache.NewExpiring[string](config.CachePath)
+	if err != nil {
+		return modsError{err, "无法打开密钥缓存。"}
+	}
+	var n int
+	for _, api := range config.APIs {
+		if api.APIKeyCmd == "" {
+			continue
+		}
+		if err := keys.Delete(apiKeyCacheID(api.APIKeyCmd)); err != nil {
+			return modsError{err, "无法清除缓存的密钥。"}
+		}
+		n++
+	}
+	if !config.Quiet {
+		fmt.Fprintf(os.Stderr, "已清除 %d 个 api-key-cmd 的缓存。\n", n)
+	}
+	return nil
+}
+
+// readAPIKeyFile 从 api-key-file 读取密钥，例如 Docker secrets 挂载的 /run/secrets/* 文件。
+// 相对路径在 systemd 的 $CREDENTIALS_DIRECTORY 中查找
+// path: 密钥文件路径
+// 返回：密钥和错误信息
+func readAPIKeyFile(path string) (string, error) {
+	if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return "", modsError{err, "无法读取 api-key-file"}
+	}
+	return strings.TrimSpace(string(bts)), nil
+}
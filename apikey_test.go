@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunAPIKeyCmd(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config.CachePath = t.TempDir()
+	runs := filepath.Join(t.TempDir(), "runs")
+	command := `sh -c "echo run >> ` + runs + `; echo secret"`
+	config.APIs = APIs{{Name: "test", APIKeyCmd: command}}
+	countRuns := func() int {
+		bts, _ := os.ReadFile(runs)
+		return strings.Count(string(bts), "run")
+	}
+
+	t.Run("默认不缓存", func(t *testing.T) {
+		for range 2 {
+			key, err := runAPIKeyCmd(command)
+			require.NoError(t, err)
+			require.Equal(t, "secret", key)
+		}
+		require.Equal(t, 2, countRuns())
+	})
+
+	t.Run("有效期内复用", func(t *testing.T) {
+		config.APIKeyCacheTTL = time.Hour
+		for range 2 {
+			key, err := runAPIKeyCmd(command)
+			require.NoError(t, err)
+			require.Equal(t, "secret", key)
+		}
+		require.Equal(t, 3, countRuns())
+	})
+
+	t.Run("清除缓存", func(t *testing.T) {
+		config.Quiet = true
+		require.NoError(t, flushKeys())
+		_, err := runAPIKeyCmd(command)
+		require.NoError(t, err)
+		require.Equal(t, 4, countRuns())
+	})
+}
+
+func TestReadAPIKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "openai"), []byte("secret\n"), 0o600))
+
+	t.Run("绝对路径", func(t *testing.T) {
+		key, err := readAPIKeyFile(filepath.Join(dir, "openai"))
+		require.NoError(t, err)
+		require.Equal(t, "secret", key)
+	})
+
+	t.Run("systemd 凭据目录", func(t *testing.T) {
+		t.Setenv("CREDENTIALS_DIRECTORY", dir)
+		key, err := readAPIKeyFile("openai")
+		require.NoError(t, err)
+		require.Equal(t, "secret", key)
+	})
+
+	t.Run("文件不存在", func(t *testing.T) {
+		_, err := readAPIKeyFile(filepath.Join(dir, "missing"))
+		require.Error(t, err)
+	})
+}
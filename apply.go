@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aymanbagabas/go-udiff"
+)
+
+// applyInstructions 告诉模型如何回复对文件的修改
+const applyInstructions = "修改下面的文件 %s。用一个 ```diff 代码块回复统一 diff 格式的修改，" +
+	"或者用一个代码块回复修改后的完整文件内容；不要包含其它代码块。"
+
+// prepareApply 读取 --apply 指定的文件，并将文件内容附加到提示中
+// 返回：文件原来的内容和错误信息
+func prepareApply() (string, error) {
+	if strings.TrimSpace(config.Prefix) == "" {
+		return "", modsError{
+			newUserErrorf("请说明要如何修改，例如 %s", stderrStyles().InlineCode.Render(`mods --apply main.go "添加错误处理"`)),
+			"--apply 需要提示。",
+		}
+	}
+	bts, err := readUserFile(config.Apply)
+	if err != nil {
+		return "", modsError{err, fmt.Sprintf("无法读取 %s。", config.Apply)}
+	}
+	original := string(bts)
+	lang := strings.TrimPrefix(filepath.Ext(config.Apply), ".")
+	fence := "```"
+	for strings.Contains(original, fence) {
+		fence += "`"
+	}
+	config.Prefix = fmt.Sprintf(
+		"%s\n\n"+applyInstructions+"\n\n%s%s\n%s\n%s",
+		config.Prefix, filepath.Base(config.Apply), fence, lang, strings.TrimSuffix(original, "\n"), fence,
+	)
+	return original, nil
+}
+
+// applyEdit 从回答中取出修改，预览差异并在确认后写入文件
+// path: 要修改的文件
+// original: 文件原来的内容
+// answer: 模型的回答
+// 返回：错误信息
+func applyEdit(path, original, answer string) error {
+	updated, err := editFromAnswer(original, answer)
+	if err != nil {
+		return modsError{err, "无法应用模型的修改。"}
+	}
+	diff := udiff.Unified(path, path, original, updated)
+	if diff == "" {
+		if !config.Quiet {
+			fmt.Fprintln(os.Stderr, "文件没有变化。")
+		}
+		return nil
+	}
+
+	if !config.Quiet {
+		fmt.Fprintln(os.Stderr, colorizeDiff(diff))
+	}
+	if err := confirmAction(fmt.Sprintf("将修改写入 %s？", path), ""); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(path, []byte(updated)); err != nil {
+		return modsError{err, fmt.Sprintf("无法写入 %s。", path)}
+	}
+	if !config.Quiet {
+		printConfirmation("已写入", path)
+	}
+	return nil
+}
+
+// editFromAnswer 根据回答得到修改后的文件内容：
+// 优先应用 diff 代码块（或整个回答就是 diff），否则使用最长的代码块作为完整文件
+func editFromAnswer(original, answer string) (string, error) {
+	blocks := extractCodeBlocks(answer)
+	for _, block := range blocks {
+		if lang := strings.ToLower(block.Lang); lang == "diff" || lang == "patch" || isUnifiedDiff(block.Code) {
+			return applyUnifiedDiff(original, block.Code)
+		}
+	}
+	if len(blocks) == 0 {
+		if isUnifiedDiff(answer) {
+			return applyUnifiedDiff(original, answer)
+		}
+		return "", errors.New("回答中没有 diff 或代码块")
+	}
+	longest := blocks[0]
+	for _, block := range blocks[1:] {
+		if len(block.Code) > len(longest.Code) {
+			longest = block
+		}
+	}
+	updated := longest.Code
+	if !strings.HasSuffix(original, "\n") {
+		updated = strings.TrimSuffix(updated, "\n")
+	}
+	return updated, nil
+}
+
+// hunkHeader 匹配统一 diff 的块头，如 @@ -1,3 +1,4 @@
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// isUnifiedDiff 判断文本是否包含统一 diff 的块
+func isUnifiedDiff(s string) bool {
+	for line := range strings.Lines(s) {
+		if hunkHeader.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffHunk 是统一 diff 中的一个块
+type diffHunk struct {
+	start int      // 原文件中的起始行（从 1 开始）
+	old   []string // 块中的上下文与删除的行
+	new   []string // 块中的上下文与添加的行
+}
+
+// parseUnifiedDiff 解析统一 diff，忽略第一个块之前的文件头
+func parseUnifiedDiff(diff string) ([]diffHunk, error) {
+	var hunks []diffHunk
+	var current *diffHunk
+	for line := range strings.Lines(diff) {
+		line = strings.TrimRight(line, "\r\n")
+		if m := hunkHeader.FindStringSubmatch(line); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			hunks = append(hunks, diffHunk{start: start})
+			current = &hunks[len(hunks)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "\\"):
+			// \ No newline at end of file
+		case strings.HasPrefix(line, "-"):
+			current.old = append(current.old, line[1:])
+		case strings.HasPrefix(line, "+"):
+			current.new = append(current.new, line[1:])
+		case strings.HasPrefix(line, " "):
+			current.old = append(current.old, line[1:])
+			current.new = append(current.new, line[1:])
+		case line == "":
+			// 模型经常省略空白上下文行前的空格
+			current.old = append(current.old, "")
+			current.new = append(current.new, "")
+		default:
+			return nil, fmt.Errorf("无效的 diff 行: %q", line)
+		}
+	}
+	if len(hunks) == 0 {
+		return nil, errors.New("diff 中没有修改")
+	}
+	return hunks, nil
+}
+
+// applyUnifiedDiff 将统一 diff 应用到原文件。模型给出的行号经常不准确，
+// 因此按块的内容定位，只在块中没有上下文和删除行时使用行号
+func applyUnifiedDiff(original, diff string) (string, error) {
+	hunks, err := parseUnifiedDiff(diff)
+	if err != nil {
+		return "", err
+	}
+	trailingNewline := strings.HasSuffix(original, "\n")
+	lines := strings.Split(strings.TrimSuffix(original, "\n"), "\n")
+	if original == "" {
+		lines = nil
+	}
+
+	cursor := 0
+	for i, h := range hunks {
+		// 块末尾多余的空上下文行通常来自 diff 结尾的空行
+		for len(h.old) > 0 && len(h.new) > 0 && h.old[len(h.old)-1] == "" && h.new[len(h.new)-1] == "" &&
+			findLines(lines, h.old, cursor) < 0 {
+			h.old, h.new = h.old[:len(h.old)-1], h.new[:len(h.new)-1]
+		}
+		at := min(max(h.start-1, cursor), len(lines))
+		if len(h.old) > 0 {
+			at = findLines(lines, h.old, cursor)
+			if at < 0 {
+				return "", fmt.Errorf("第 %d 个修改块与文件内容不匹配", i+1)
+			}
+		}
+		lines = slices.Concat(lines[:at], h.new, lines[at+len(h.old):])
+		cursor = at + len(h.new)
+	}
+
+	result := strings.Join(lines, "\n")
+	if trailingNewline && result != "" {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// findLines 从 from 开始查找 want 在 lines 中的位置，比较时忽略行尾空白，找不到时返回 -1
+func findLines(lines, want []string, from int) int {
+	for i := from; i+len(want) <= len(lines); i++ {
+		match := true
+		for j, w := range want {
+			if strings.TrimRight(lines[i+j], " \t") != strings.TrimRight(w, " \t") {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// colorizeDiff 为统一 diff 的添加、删除和块头着色
+func colorizeDiff(diff string) string {
+	s := stderrStyles()
+	var sb strings.Builder
+	for line := range strings.Lines(diff) {
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			sb.WriteString(s.AppName.Render(line))
+		case strings.HasPrefix(line, "@@"):
+			sb.WriteString(s.Pipe.Render(line))
+		case strings.HasPrefix(line, "+"):
+			sb.WriteString(s.DiffAdded.Render(line))
+		case strings.HasPrefix(line, "-"):
+			sb.WriteString(s.DiffRemoved.Render(line))
+		default:
+			sb.WriteString(s.Comment.Render(line))
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// writeFileAtomic 先写入同一目录下的临时文件再重命名，保留原文件的权限
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err //nolint:wrapcheck
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		_ = tmp.Close()
+		return err //nolint:wrapcheck
+	}
+	if err := tmp.Close(); err != nil {
+		return err //nolint:wrapcheck
+	}
+	return os.Rename(tmp.Name(), path) //nolint:wrapcheck
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	original := "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"
+
+	t.Run("行号不准确", func(t *testing.T) {
+		diff := "--- a/main.go\n+++ b/main.go\n@@ -10,3 +10,4 @@\n func main() {\n-\tprintln(\"hi\")\n+\tprintln(\"hello\")\n+\tprintln(\"bye\")\n }\n"
+		got, err := applyUnifiedDiff(original, diff)
+		require.NoError(t, err)
+		require.Equal(t, "package main\n\nfunc main() {\n\tprintln(\"hello\")\n\tprintln(\"bye\")\n}\n", got)
+	})
+
+	t.Run("省略空白行前的空格", func(t *testing.T) {
+		diff := "@@ -1,3 +1,3 @@\n-package main\n+package app\n\n func main() {\n\n"
+		got, err := applyUnifiedDiff(original, diff)
+		require.NoError(t, err)
+		require.Equal(t, "package app\n\nfunc main() {\n\tprintln(\"hi\")\n}\n", got)
+	})
+
+	t.Run("多个块", func(t *testing.T) {
+		diff := "@@ -1 +1 @@\n-package main\n+package app\n@@ -5 +5,2 @@\n }\n+// end\n"
+		got, err := applyUnifiedDiff(original, diff)
+		require.NoError(t, err)
+		require.Equal(t, "package app\n\nfunc main() {\n\tprintln(\"hi\")\n}\n// end\n", got)
+	})
+
+	t.Run("内容不匹配", func(t *testing.T) {
+		_, err := applyUnifiedDiff(original, "@@ -1 +1 @@\n-package other\n+package app\n")
+		require.Error(t, err)
+	})
+}
+
+func TestEditFromAnswer(t *testing.T) {
+	original := "a\nb\n"
+
+	t.Run("diff 代码块", func(t *testing.T) {
+		got, err := editFromAnswer(original, "修改如下：\n\n```diff\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n```\n")
+		require.NoError(t, err)
+		require.Equal(t, "a\nc\n", got)
+	})
+
+	t.Run("完整文件", func(t *testing.T) {
+		got, err := editFromAnswer(original, "```\nx\n```\n\n完整文件：\n\n```txt\na\nb\nc\n```\n")
+		require.NoError(t, err)
+		require.Equal(t, "a\nb\nc\n", got)
+	})
+
+	t.Run("没有修改", func(t *testing.T) {
+		_, err := editFromAnswer(original, "我无法完成。")
+		require.Error(t, err)
+	})
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.sh")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0o750))
+	require.NoError(t, writeFileAtomic(path, []byte("new")))
+
+	bts, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(bts))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o750), info.Mode().Perm())
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestApplyEdit(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config.Quiet, config.NoInput = true, true
+
+	path := filepath.Join(t.TempDir(), "main.go")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0o600))
+	answer := "```go\nnew\n```"
+
+	t.Run("安静模式仍然需要确认", func(t *testing.T) {
+		config.Yes = false
+		require.ErrorContains(t, applyEdit(path, "old\n", answer), "--yes")
+		bts, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "old\n", string(bts))
+	})
+
+	t.Run("--yes 跳过确认", func(t *testing.T) {
+		config.Yes = true
+		require.NoError(t, applyEdit(path, "old\n", answer))
+		bts, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "new\n", string(bts))
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// chatCommands 聊天模式下可用的斜杠命令及其说明
+var chatCommands = [][2]string{
+	{"/model <名称>", "切换后续请求使用的模型"},
+	{"/save [标题]", "以给定标题保存当前对话"},
+	{"/help", "显示可用命令"},
+	{"/exit", "退出聊天"},
+}
+
+// newChatInput 创建聊天模式的多行输入框
+func newChatInput() textarea.Model {
+	ta := textarea.New()
+	ta.Placeholder = "输入后续提示（enter 发送，alt+enter 换行，/help 查看命令）"
+	ta.ShowLineNumbers = false
+	ta.Prompt = "┃ "
+	ta.CharLimit = 0
+	ta.SetHeight(3) //nolint:mnd
+	ta.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	return ta
+}
+
+// chatSubmitMsg 是用户在聊天模式下提交输入后发出的消息
+type chatSubmitMsg struct {
+	prompt string
+}
+
+// startChatInput 进入等待用户输入的聊天状态
+func (m *Mods) startChatInput() tea.Cmd {
+	m.state = chatInputState
+	m.chatInput.Reset()
+	m.chatInput.SetWidth(m.width)
+	return m.chatInput.Focus()
+}
+
+// updateChatInput 处理聊天输入状态下的按键
+func (m *Mods) updateChatInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "ctrl+d":
+		m.state = doneState
+		return m, m.quit
+	case "enter":
+		prompt := strings.TrimSpace(m.chatInput.Value())
+		if prompt == "" {
+			return m, nil
+		}
+		m.chatInput.Blur()
+		return m, func() tea.Msg { return chatSubmitMsg{prompt} }
+	}
+	var cmd tea.Cmd
+	m.chatInput, cmd = m.chatInput.Update(msg)
+	return m, cmd
+}
+
+// submitChat 处理用户提交的聊天输入：斜杠命令或新的提示
+func (m *Mods) submitChat(prompt string) tea.Cmd {
+	if strings.HasPrefix(prompt, "/") {
+		return m.chatCommand(prompt)
+	}
+
+	m.chatStatus = ""
+	m.retries = 0
+	m.argsRetried = false
+	m.toolGuard = toolGuard{}
+	m.Config.Prefix = ""
+	m.appendToOutput(fmt.Sprintf("\n\n---\n\n**你**: %s\n\n", prompt))
+	m.state = requestState
+
+	cmds := []tea.Cmd{m.startCompletionCmd(prompt)}
+	if m.showAnim() {
+		m.anim = m.newStatusAnim()
+		cmds = append(cmds, m.anim.Init())
+	}
+	return tea.Batch(cmds...)
+}
+
+// chatCommand 执行聊天模式的斜杠命令
+func (m *Mods) chatCommand(line string) tea.Cmd {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/exit", "/quit":
+		m.state = doneState
+		return m.quit
+	case "/model":
+		if arg == "" {
+			m.chatStatus = fmt.Sprintf("当前模型: %s/%s", m.Config.API, m.Config.Model)
+			break
+		}
+		m.Config.API = ""
+		m.Config.Model = arg
+		if _, mod, err := m.resolveModel(m.Config); err != nil {
+			m.chatStatus = fmt.Sprintf("未找到模型 %q", arg)
+		} else {
+			m.Config.API = mod.API
+			m.chatStatus = fmt.Sprintf("已切换到 %s/%s", mod.API, mod.Name)
+		}
+	case "/save":
+		if arg != "" {
+			m.Config.cacheWriteToTitle = arg
+		}
+		title, err := storeConversation(m)
+		if err != nil {
+			m.chatStatus = "保存失败: " + err.Error()
+			break
+		}
+		m.chatStatus = fmt.Sprintf("对话已保存: %s %s", shortID(m.Config.cacheWriteToID), title)
+	case "/help":
+		var sb strings.Builder
+		for _, c := range chatCommands {
+			fmt.Fprintf(&sb, "%s  %s\n", c[0], c[1])
+		}
+		m.chatStatus = strings.TrimSpace(sb.String())
+	default:
+		m.chatStatus = fmt.Sprintf("未知命令 %q，输入 /help 查看可用命令", name)
+	}
+	return m.startChatInput()
+}
+
+// chatView 渲染聊天模式的视图：对话记录、状态行与输入框
+func (m *Mods) chatView(footer string) string {
+	var sb strings.Builder
+	if m.viewportNeeded() {
+		sb.WriteString(m.glamViewport.View())
+	} else {
+		sb.WriteString(m.glamOutput)
+	}
+	sb.WriteString("\n")
+	if m.chatStatus != "" {
+		sb.WriteString(m.Styles.Comment.Render(m.chatStatus))
+		sb.WriteString("\n")
+	}
+	sb.WriteString(footer)
+	return sb.String()
+}
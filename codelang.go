@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// codeLangRule 是猜测代码语言的规则，每一行匹配一个模式得一分
+type codeLangRule struct {
+	Lang     string           // 写入围栏的语言，使用 glamour 能识别的名称
+	Patterns []*regexp.Regexp // 该语言中常见的行
+}
+
+// codeLangRules 是猜测代码语言的规则，得分相同时靠前的规则优先
+var codeLangRules = []codeLangRule{
+	{"go", compileAll(
+		`^package \w+$`,
+		`^func (\(\w+ \*?\w+\) )?\w+\(`,
+		`^import \($`,
+		`\w+ := `,
+		`\bfmt\.\w+\(`,
+		`^\s*if err != nil \{$`,
+	)},
+	{"rust", compileAll(
+		`^\s*(pub )?fn \w+(<.*>)?\(`,
+		`\blet mut \w+`,
+		`\b(println|format|vec)!\(`,
+		`^use \w+(::\w+)+`,
+		`^\s*impl\b`,
+	)},
+	{"python", compileAll(
+		`^\s*(async )?def \w+\(.*\)( -> .+)?:$`,
+		`^\s*class \w+(\(.*\))?:$`,
+		`^(from [\w.]+ )?import \w+( as \w+)?$`,
+		`^\s*(elif .+|else|try|except( \w+)?( as \w+)?|finally):$`,
+		`\bself\.\w+`,
+		`^if __name__ == ['"]__main__['"]:$`,
+		`^\s*print\(`,
+	)},
+	{"typescript", compileAll(
+		`^(export )?interface \w+`,
+		`^(export )?type \w+ = `,
+		`\b(const|let) \w+: \w+`,
+		`\(\w+: (string|number|boolean|any)\b`,
+	)},
+	{"javascript", compileAll(
+		`^\s*(const|let|var) \w+ = `,
+		`\bconsole\.log\(`,
+		`\brequire\(['"]`,
+		`^\s*(async )?function\b`,
+		`^(import .+ from|export (default|const|function)) `,
+		`\) => \{?$`,
+	)},
+	{"java", compileAll(
+		`^\s*(public|private|protected) (static )?(final )?(class|void|\w+) \w+`,
+		`\bSystem\.out\.print`,
+		`^import java\.`,
+	)},
+	{"cpp", compileAll(
+		`\bstd::\w+`,
+		`^#include <(iostream|vector|string|map)>$`,
+		`^using namespace \w+;$`,
+	)},
+	{"c", compileAll(
+		`^#include [<"][\w/]+\.h[>"]$`,
+		`^int main\(`,
+		`\bprintf\(`,
+	)},
+	{"sql", compileAll(
+		`(?i)^\s*(select .+|insert into|update \w+ set|delete from|create (table|index|view)|alter table|drop table)\b`,
+		`(?i)^\s*(from|where|join|group by|order by|limit)\b`,
+	)},
+	{"html", compileAll(
+		`(?i)^\s*<(!doctype|html|head|body|div|span|p|a|ul|li|script|style|link|meta)\b`,
+	)},
+	{"dockerfile", compileAll(
+		`^FROM \S+`,
+		`^(RUN|COPY|ADD|WORKDIR|ENTRYPOINT|CMD|EXPOSE|ENV|ARG) `,
+	)},
+	{"sh", compileAll(
+		`^\$ \S`,
+		`^(sudo |apt(-get)? |brew |npm |npx |yarn |pip3? |go (install|get|run|build|test|mod) |git |cd |ls|echo |export |curl |wget |docker |kubectl |mkdir |rm |cp |mv |cat |chmod |source |make\b)`,
+		`\| ?(grep|awk|sed|xargs|sort|head|tail|wc)\b`,
+	)},
+	{"yaml", compileAll(
+		`^[\w.-]+:( [^{;]*)?$`,
+		`^\s+[\w.-]+:( .*)?$`,
+		`^\s*- \S`,
+	)},
+}
+
+// compileAll 编译多个正则表达式
+func compileAll(patterns ...string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		res = append(res, regexp.MustCompile(p))
+	}
+	return res
+}
+
+// shebangRe 匹配 shell 脚本的 shebang
+var shebangRe = regexp.MustCompile(`^#!.*\b(ba|z|k)?sh\b`)
+
+// guessCodeLang 根据内容猜测代码的语言，无法判断时返回空字符串
+// code: 代码内容
+func guessCodeLang(code string) string {
+	trimmed := strings.TrimSpace(code)
+	switch {
+	case trimmed == "":
+		return ""
+	case shebangRe.MatchString(trimmed):
+		return "sh"
+	case strings.HasPrefix(trimmed, "#!") && strings.Contains(firstLine(trimmed), "python"):
+		return "python"
+	case (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)):
+		return "json"
+	case strings.HasPrefix(trimmed, "--- ") && strings.Contains(trimmed, "\n+++ ") && strings.Contains(trimmed, "\n@@ "):
+		return "diff"
+	}
+
+	var lines int
+	scores := make([]int, len(codeLangRules))
+	for line := range strings.Lines(trimmed) {
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines++
+		for i, rule := range codeLangRules {
+			for _, re := range rule.Patterns {
+				if re.MatchString(line) {
+					scores[i]++
+					break
+				}
+			}
+		}
+	}
+
+	best := -1
+	for i, score := range scores {
+		if score > 0 && (best < 0 || score > scores[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	// yaml 的模式很宽松，只有大部分行都像 yaml 时才认为是 yaml
+	if codeLangRules[best].Lang == "yaml" && scores[best]*2 < lines {
+		return ""
+	}
+	return codeLangRules[best].Lang
+}
+
+// labelCodeFences 为没有标注语言的围栏代码块补上猜测的语言，使 glamour 能够高亮。
+// 只处理已经闭合的代码块，避免流式输出时标注随内容变化；无法判断语言时保持原样
+// s: markdown 文本
+// 返回：补上语言后的文本
+func labelCodeFences(s string) string {
+	if !strings.Contains(s, "```") && !strings.Contains(s, "~~~") {
+		return s
+	}
+	var sb strings.Builder
+	var fence, opening string
+	var code strings.Builder
+	inBlock := false
+	for line := range strings.Lines(s) {
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) > 3 { //nolint:mnd
+			trimmed = ""
+		}
+		trimmed = strings.TrimRight(trimmed, "\r\n")
+
+		if !inBlock {
+			if f := codeFence(trimmed); f != "" {
+				inBlock, fence, opening = true, f, line
+				code.Reset()
+				continue
+			}
+			sb.WriteString(line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" ") == "" {
+			info := strings.TrimSpace(strings.TrimLeft(strings.TrimRight(opening, "\r\n"), " ")[len(fence):])
+			if info == "" {
+				if lang := guessCodeLang(code.String()); lang != "" {
+					i := strings.Index(opening, fence) + len(fence)
+					opening = opening[:i] + lang + opening[i:]
+				}
+			}
+			sb.WriteString(opening)
+			sb.WriteString(code.String())
+			sb.WriteString(line)
+			inBlock = false
+			continue
+		}
+		code.WriteString(line)
+	}
+	if inBlock {
+		sb.WriteString(opening)
+		sb.WriteString(code.String())
+	}
+	return sb.String()
+}
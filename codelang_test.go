@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuessCodeLang(t *testing.T) {
+	for lang, code := range map[string]string{
+		"go":         "package main\n\nfunc main() {\n\tx := 1\n\tfmt.Println(x)\n}\n",
+		"python":     "import os\n\ndef main():\n    print(os.getcwd())\n",
+		"rust":       "fn main() {\n    let mut x = 1;\n    println!(\"{}\", x);\n}\n",
+		"javascript": "const fs = require('fs');\nconsole.log(fs.readdirSync('.'));\n",
+		"typescript": "interface User {\n  name: string;\n}\nconst u: User = { name: 'a' };\n",
+		"java":       "public class Main {\n    public static void main(String[] args) {\n        System.out.println(1);\n    }\n}\n",
+		"c":          "#include <stdio.h>\n\nint main() {\n    printf(\"hi\\n\");\n}\n",
+		"cpp":        "#include <iostream>\n\nint main() {\n    std::cout << 1;\n}\n",
+		"sql":        "SELECT name\nFROM users\nWHERE id = 1;\n",
+		"html":       "<!DOCTYPE html>\n<html>\n</html>\n",
+		"dockerfile": "FROM golang:1.24\nWORKDIR /app\nRUN go build .\n",
+		"sh":         "brew install mods\nls -la | grep mods\n",
+		"json":       "{\"a\": [1, 2]}\n",
+		"diff":       "--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n",
+		"yaml":       "name: mods\nversion: 1\ntags:\n  - cli\n",
+	} {
+		require.Equal(t, lang, guessCodeLang(code), code)
+	}
+	require.Equal(t, "sh", guessCodeLang("#!/usr/bin/env bash\nset -e\n"))
+	require.Empty(t, guessCodeLang("hello world\nthis is not code\n"))
+	require.Empty(t, guessCodeLang("注意: 这是一段说明\n后面还有很多文字，不是 yaml\n也不是代码\n"))
+}
+
+func TestLabelCodeFences(t *testing.T) {
+	t.Run("补上语言", func(t *testing.T) {
+		in := "示例：\n\n```\npackage main\n\nfunc main() {}\n```\n\n```bash\nls\n```\n"
+		require.Equal(t, "示例：\n\n```go\npackage main\n\nfunc main() {}\n```\n\n```bash\nls\n```\n", labelCodeFences(in))
+	})
+
+	t.Run("波浪线和缩进的围栏", func(t *testing.T) {
+		in := "  ~~~~\n  {\"a\": 1}\n  ~~~~\n"
+		require.Equal(t, "  ~~~~json\n  {\"a\": 1}\n  ~~~~\n", labelCodeFences(in))
+	})
+
+	t.Run("无法判断", func(t *testing.T) {
+		in := "```\njust text\n```\n"
+		require.Equal(t, in, labelCodeFences(in))
+	})
+
+	t.Run("未闭合的代码块保持原样", func(t *testing.T) {
+		in := "```\npackage main\n"
+		require.Equal(t, in, labelCodeFences(in))
+	})
+}
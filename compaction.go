@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/stream"
+)
+
+// compactionPrompt 要求压缩模型总结较早的对话
+const compactionPrompt = "下面是一段对话中较早的部分。请用简洁的要点总结它，保留后续对话可能需要的事实、决定、" +
+	"代码片段和未解决的问题，省略寒暄和重复的内容。只回复摘要。"
+
+// summaryPrefix 是摘要系统消息的开头，用于在下一次压缩时识别已有的摘要
+const summaryPrefix = "以下是此前对话的摘要：\n\n"
+
+// compactMessages 在继续的对话超出输入上限时，用 compaction-model 把会被省略的最早轮次
+// 总结成一条系统消息，替换对话中的这些轮次。没有配置 compaction-model 或没有超出上限时不做任何事
+// ctx: 上下文
+// mod: 本次请求的模型配置
+// 返回：错误信息
+func (m *Mods) compactMessages(ctx context.Context, mod Model) error {
+	if m.Config.CompactionModel == "" || m.Config.NoLimit {
+		return nil
+	}
+	_, dropped, err := fitMessages(m.messages, mod)
+	if err != nil {
+		return modsError{err, "无法统计令牌数。"}
+	}
+	if dropped == 0 {
+		return nil
+	}
+
+	// 已有的摘要和新省略的轮次一起重新总结，对话中始终只有一条摘要
+	at := systemPrefix(m.messages)
+	if at > 0 && strings.HasPrefix(m.messages[at-1].Content, summaryPrefix) {
+		at--
+		dropped++
+	}
+	// 摘要最多占输入上限的一半，给本次提示和之后的轮次留出空间
+	summary, err := m.summarize(ctx, m.messages[at:at+dropped], inputTokenLimit(mod)/2)
+	if err != nil {
+		return err
+	}
+	m.messages = slices.Concat(
+		m.messages[:at],
+		[]proto.Message{{Role: proto.RoleSystem, Content: summaryPrefix + summary}},
+		m.messages[at+dropped:],
+	)
+	return nil
+}
+
+// summarize 使用 compaction-model 总结给定的消息
+// ctx: 上下文
+// messages: 要总结的消息
+// budget: 摘要的最大令牌数
+// 返回：摘要和错误信息
+func (m *Mods) summarize(ctx context.Context, messages []proto.Message, budget int64) (string, error) {
+	cfg := *m.Config
+	cfg.API, cfg.Model = "", cfg.CompactionModel
+	api, mod, err := m.resolveModel(&cfg)
+	if err != nil {
+		return "", err
+	}
+	if mod.MaxChars == 0 {
+		mod.MaxChars = cfg.MaxInputChars
+	}
+	client, err := m.newClient(&cfg, api, mod)
+	if err != nil {
+		return "", err
+	}
+
+	// 对话本身超出压缩模型的上限时只总结它能读下的部分
+	request, _, err := fitMessages([]proto.Message{
+		{Role: proto.RoleSystem, Content: compactionPrompt},
+		{Role: proto.RoleUser, Content: proto.Conversation(messages).String()},
+	}, mod)
+	if err != nil {
+		return "", modsError{err, "无法统计令牌数。"}
+	}
+
+	s := client.Request(ctx, proto.Request{
+		Messages:  request,
+		API:       mod.API,
+		Model:     mod.Name,
+		User:      cfg.User,
+		MaxTokens: &budget,
+	})
+	defer s.Close() //nolint:errcheck
+	var sb strings.Builder
+	for s.Next() {
+		chunk, err := s.Current()
+		if err != nil && !errors.Is(err, stream.ErrNoContent) {
+			return "", modsError{err, "无法压缩对话。"}
+		}
+		sb.WriteString(chunk.Content)
+	}
+	if err := s.Err(); err != nil {
+		return "", modsError{err, "无法压缩对话。"}
+	}
+	// 模型不遵守 max_tokens 时按主模型的词表估算截断
+	t, err := tokenizerFor(m.model)
+	if err != nil {
+		return "", modsError{err, "无法统计令牌数。"}
+	}
+	summary := strings.TrimSpace(t.truncate(sb.String(), budget))
+	if summary == "" {
+		return "", modsError{stream.ErrNoContent, "压缩模型没有返回摘要。"}
+	}
+	return summary, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactMessages(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"讨论了苹果\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := Config{
+		CompactionModel: "small",
+		APIs: APIs{{
+			Name:    "openai",
+			BaseURL: srv.URL,
+			APIKey:  "x",
+			Models:  map[string]Model{"small": {}},
+		}},
+	}
+	mod := Model{API: "openai", Name: "gpt-4o", MaxInputTokens: 40}
+	history := func() []proto.Message {
+		return []proto.Message{
+			{Role: proto.RoleSystem, Content: "你是助手"},
+			{Role: proto.RoleUser, Content: "第一个问题，关于苹果和橙子的很长的问题"},
+			{Role: proto.RoleAssistant, Content: "第一个回答，同样很长很长的回答"},
+			{Role: proto.RoleUser, Content: "新问题"},
+		}
+	}
+
+	t.Run("用摘要替换最早的轮次", func(t *testing.T) {
+		m := &Mods{Config: &cfg, ctx: context.Background(), model: mod, messages: history()}
+		require.NoError(t, m.compactMessages(context.Background(), mod))
+		require.Equal(t, []proto.Message{
+			{Role: proto.RoleSystem, Content: "你是助手"},
+			{Role: proto.RoleSystem, Content: summaryPrefix + "讨论了苹果"},
+			{Role: proto.RoleUser, Content: "新问题"},
+		}, m.messages)
+
+		// 再次压缩时已有的摘要会并入新的摘要
+		m.messages = append(m.messages, history()[1:]...)
+		require.NoError(t, m.compactMessages(context.Background(), mod))
+		require.Len(t, m.messages, 3)
+		require.Equal(t, summaryPrefix+"讨论了苹果", m.messages[1].Content)
+	})
+
+	t.Run("没有超出上限", func(t *testing.T) {
+		requests = 0
+		m := &Mods{Config: &cfg, ctx: context.Background(), model: mod, messages: history()[2:]}
+		require.NoError(t, m.compactMessages(context.Background(), mod))
+		require.Len(t, m.messages, 2)
+		require.Zero(t, requests)
+	})
+
+	t.Run("没有配置压缩模型", func(t *testing.T) {
+		noCompaction := cfg
+		noCompaction.CompactionModel = ""
+		m := &Mods{Config: &noCompaction, ctx: context.Background(), model: mod, messages: history()}
+		require.NoError(t, m.compactMessages(context.Background(), mod))
+		require.Equal(t, history(), m.messages)
+	})
+}
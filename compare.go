@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
+)
+
+// --compare 的布局
+const (
+	compareStacked = "stacked" // 按顺序依次输出每个模型的回答
+	compareSide    = "side"    // 在终端中并排输出
+)
+
+// compareColumnGap 是并排布局中各列之间的空格数
+const compareColumnGap = 2
+
+// compareResult 是一个模型的回答
+type compareResult struct {
+	model   string        // 模型名称
+	api     string        // 实际使用的 API
+	output  string        // 回答
+	usage   string        // 令牌用量和费用
+	elapsed time.Duration // 耗时
+	err     error         // 错误信息
+}
+
+// runCompare 把同一个提示同时发送给 --compare 中的每个模型，并按顺序或者并排输出回答
+// ctx: 上下文
+// 返回：错误信息
+func runCompare(ctx context.Context) error {
+	if config.CompareLayout != compareStacked && config.CompareLayout != compareSide {
+		return modsError{
+			err: newUserErrorf(
+				"可选的布局有：%s、%s",
+				stderrStyles().InlineCode.Render(compareStacked),
+				stderrStyles().InlineCode.Render(compareSide),
+			),
+			reason: fmt.Sprintf("不支持的 --compare-layout %q。", config.CompareLayout),
+		}
+	}
+	var models []string
+	for _, name := range config.Compare {
+		if name = strings.TrimSpace(name); name != "" {
+			models = append(models, name)
+		}
+	}
+	if len(models) < 2 { //nolint:mnd
+		return newUserErrorf("--compare 至少需要两个模型，例如 %s", stderrStyles().InlineCode.Render("--compare gpt-4o,claude-3.7-sonnet"))
+	}
+
+	var content string
+	if !isInputTTY() {
+		stdin, err := readStdin(os.Stdin, config.StdinHead, config.StdinTail)
+		if err != nil {
+			return modsError{err, "无法读取标准输入。"}
+		}
+		content = increaseIndent(stdin)
+	}
+	if strings.TrimSpace(content) == "" && strings.TrimSpace(config.Prefix) == "" {
+		return modsError{
+			err:    newUserErrorf("例如：%s", stderrStyles().InlineCode.Render("mods --compare gpt-4o,claude-3.7-sonnet '解释一下 CAP 定理'")),
+			reason: "没有要比较的提示。",
+		}
+	}
+
+	results := make([]chan compareResult, len(models))
+	for i, name := range models {
+		results[i] = make(chan compareResult, 1)
+		go func() {
+			results[i] <- compareOne(ctx, name, content)
+		}()
+	}
+
+	styled := isOutputTTY() && !config.Raw
+	var errs []error
+	if config.CompareLayout == compareSide && styled {
+		all := make([]compareResult, len(models))
+		for i, ch := range results {
+			all[i] = <-ch
+		}
+		fmt.Println(renderCompareSide(all, terminalWidth()))
+		for _, res := range all {
+			if res.err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", res.model, res.err))
+			}
+		}
+	} else {
+		// 按给出的顺序输出，前面的模型完成后立即输出
+		for i, ch := range results {
+			res := <-ch
+			if res.err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", res.model, res.err))
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+			if styled {
+				fmt.Println(renderCompareResult(res, config.WordWrap))
+			} else {
+				fmt.Print(compareMarkdown(res))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return modsError{errors.Join(errs...), fmt.Sprintf("%d 个模型的请求失败。", len(errs))}
+	}
+	return nil
+}
+
+// compareOne 用一个模型完成请求
+// ctx: 上下文
+// name: 模型名称或别名
+// content: 标准输入的内容
+// 返回：模型的回答
+func compareOne(ctx context.Context, name, content string) compareResult {
+	cfg := config
+	cfg.API, cfg.Model = "", name
+	cfg.NoCache = true
+	cfg.Chat = false
+	cfg.Samples = 1
+
+	m := newMods(ctx, stderrRenderer(), &cfg, nil, nil)
+	start := time.Now()
+	out, err := m.complete(content)
+	res := compareResult{
+		model:   name,
+		api:     m.model.API,
+		output:  strings.TrimSpace(out),
+		elapsed: time.Since(start).Round(100 * time.Millisecond), //nolint:mnd
+		err:     err,
+	}
+	if err == nil {
+		res.usage = m.usageSummary()
+	}
+	return res
+}
+
+// compareStats 返回回答的耗时和令牌用量
+func compareStats(res compareResult) string {
+	if res.usage == "" {
+		return res.elapsed.String()
+	}
+	return res.elapsed.String() + " · " + res.usage
+}
+
+// compareHeading 返回回答的标题：模型、API、耗时和令牌用量
+func compareHeading(res compareResult) string {
+	name := res.model
+	if res.api != "" {
+		name += " (" + res.api + ")"
+	}
+	return name + " · " + compareStats(res)
+}
+
+// compareMarkdown 返回不在终端中时输出的 markdown，每个模型的回答前面是一个二级标题
+func compareMarkdown(res compareResult) string {
+	body := res.output
+	if res.err != nil {
+		body = "错误: " + res.err.Error()
+	}
+	return "## " + compareHeading(res) + "\n\n" + body + "\n"
+}
+
+// renderCompareResult 在终端中渲染一个模型的标题和回答
+// res: 模型的回答
+// width: 折行宽度
+func renderCompareResult(res compareResult, width int) string {
+	styles := stdoutStyles()
+	heading := styles.Flag.Render(res.model)
+	if res.api != "" {
+		heading += styles.Comment.Render(" (" + res.api + ")")
+	}
+	heading += styles.Timeago.Render(" · " + compareStats(res))
+
+	var body string
+	if res.err != nil {
+		body = styles.DiffRemoved.Render("错误: " + res.err.Error())
+	} else {
+		gr, err := glamour.NewTermRenderer(glamourStyle(), glamour.WithWordWrap(width))
+		if err == nil {
+			body, err = gr.Render(res.output)
+		}
+		if err != nil {
+			body = res.output
+		}
+		body = strings.Trim(body, "\n")
+	}
+	return lipgloss.NewStyle().Width(width).Render(heading) + "\n" + body
+}
+
+// renderCompareSide 把所有回答并排渲染
+// results: 每个模型的回答
+// width: 终端宽度
+func renderCompareSide(results []compareResult, width int) string {
+	colWidth := (width - compareColumnGap*(len(results)-1)) / len(results)
+	cols := make([]string, 0, len(results)*2) //nolint:mnd
+	gap := strings.Repeat(" ", compareColumnGap)
+	for i, res := range results {
+		if i > 0 {
+			cols = append(cols, gap)
+		}
+		// glamour 的边距在折行宽度之外，渲染后再按列宽截断
+		col := renderCompareResult(res, max(colWidth-4, 10)) //nolint:mnd
+		cols = append(cols, lipgloss.NewStyle().Width(colWidth).MaxWidth(colWidth).Render(col))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, cols...)
+}
+
+// terminalWidth 返回标准输出终端的宽度，无法获取时使用 word-wrap 设置的两倍
+func terminalWidth() int {
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+	return config.WordWrap * 2 //nolint:mnd
+}
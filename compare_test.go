@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareMarkdown(t *testing.T) {
+	res := compareResult{
+		model:   "gpt-4o",
+		api:     "openai",
+		output:  "回答",
+		usage:   "令牌: 输入 3 · 输出 5",
+		elapsed: 1500 * time.Millisecond,
+	}
+	require.Equal(t, "## gpt-4o (openai) · 1.5s · 令牌: 输入 3 · 输出 5\n\n回答\n", compareMarkdown(res))
+
+	res = compareResult{model: "nope", err: errors.New("没有这个模型")}
+	require.Equal(t, "## nope · 0s\n\n错误: 没有这个模型\n", compareMarkdown(res))
+}
+
+func TestRenderCompareSide(t *testing.T) {
+	results := []compareResult{
+		{model: "a", api: "openai", output: strings.Repeat("很长的回答 ", 50)},
+		{model: "b", api: "anthropic", output: "短"},
+		{model: "c", err: errors.New("失败")},
+	}
+	out := renderCompareSide(results, 90)
+	for line := range strings.Lines(out) {
+		require.LessOrEqual(t, lipgloss.Width(strings.TrimRight(line, "\n")), 90)
+	}
+	require.Contains(t, out, "anthropic")
+	require.Contains(t, out, "失败")
+}
+
+func TestRunCompareValidation(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+
+	config.CompareLayout = "grid"
+	config.Compare = []string{"a", "b"}
+	require.ErrorContains(t, runCompare(context.Background()), "stacked")
+
+	config.CompareLayout = compareStacked
+	config.Compare = []string{"a", " "}
+	require.ErrorContains(t, runCompare(context.Background()), "至少需要两个模型")
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"text/template"
 	"time"
@@ -13,10 +14,8 @@ import (
 	"github.com/adrg/xdg"
 	"github.com/caarlos0/duration"
 	"github.com/caarlos0/env/v9"
+	"github.com/charmbracelet/mods/internal/cache"
 	"github.com/charmbracelet/x/exp/strings"
-	"github.com/muesli/termenv"
-	"github.com/spf13/cobra"
-	flag "github.com/spf13/pflag"
 	"gopkg.in/yaml.v3"
 )
 
@@ -32,6 +31,8 @@ var help = map[string]string{
 	"api":               "OpenAI 兼容的 REST API（openai、localai、anthropic 等）",
 	"apis":              "OpenAI 兼容 REST API 的别名和端点",
 	"http-proxy":        "用于 API 请求的 HTTP 代理",
+	"api-key-cache-ttl": "缓存 api-key-cmd 结果的时间（如 8h），0 表示每次都执行命令",
+	"flush-keys":        "清除缓存的 api-key-cmd 结果",
 	"model":             "默认模型（gpt-3.5-turbo、gpt-4、ggml-gpt4all-j...）",
 	"ask-model":         "通过交互式提示询问使用哪个模型",
 	"max-input-chars":   "模型输入的默认字符限制",
@@ -43,11 +44,32 @@ var help = map[string]string{
 	"prompt":            "在响应中包含来自参数和 stdin 的提示，将 stdin 截断为指定行数",
 	"prompt-args":       "在响应中包含来自参数的提示",
 	"raw":               "连接到 TTY 时将输出渲染为原始文本",
+	"no-guess-lang":     "不为没有标注语言的代码块猜测语言；默认会根据内容补上 go、python 等标注，使终端中的代码高亮",
+	"no-hyperlinks":     "不输出 OSC8 终端超链接；默认 --show 中的链接和 --list、--du 中的对话 ID 在终端中可以点击",
 	"quiet":             "安静模式（加载时隐藏旋转器，成功时隐藏 stderr 消息）",
+	"yes":               "跳过删除旧对话、写入文件、执行命令、下载模型和调用工具前的确认",
+	"no-input":          "不与用户交互：需要确认或者选择时直接失败，而不是等待输入，适合脚本和 CI",
 	"help":              "显示帮助并退出",
 	"version":           "显示版本并退出",
 	"max-retries":       "重试 API 调用的最大次数",
+	"retry-budget":      "所有重试（含等待）的总时间预算，超出后不再重试，0 表示不限制",
+	"retry-max-wait":    "两次重试之间的最长等待时间，默认为 10 秒",
+	"request-timeout":   "一轮模型请求（包括读取流式回答）的超时时间，默认为 10 分钟，-1 表示不限制；执行工具和等待确认的时间不计入，与 MCP 的超时无关",
+	"embed":             "为标准输入的每一行或参数中的每个文件获取向量（embeddings），输出 JSON",
+	"embed-model":       "--embed 使用的向量模型，默认按 API 选择：openai 为 text-embedding-3-small，ollama 为 nomic-embed-text，cohere 为 embed-v4.0",
+	"embed-format":      "--embed 的输出格式：ndjson 每行一条结果，json 输出一个数组",
+	"index":             "为参数中的文件和目录建立本地向量索引：--index <名称> <文件或目录...>，重复执行会更新已经索引的文件",
+	"rag":               "从本地向量索引中检索与问题最相关的片段，作为资料附在提示中，并在回答后列出来源",
+	"rag-top-k":         "--rag 检索的片段数，默认为 5",
+	"throttle":          "按固定的速率输出回答，例如 40tps 表示每秒 40 个令牌，0 表示收到就输出",
+	"max-request-size":  "请求体大小的上限（如 10MB），超出时在上传前拒绝请求，-1 表示不限制",
+	"allow-outside-cwd": "允许 --attach、--apply、--embed 和 --index 读取当前目录之外的文件，包括指向目录之外的符号链接",
 	"no-limit":          "关闭客户端对模型输入大小的限制",
+	"prompt-cache":      "在系统消息和历史对话末尾设置提示缓存断点，继续对话时复用已缓存的前缀（anthropic）",
+	"cache-roles":       "总是缓存系统消息的角色，适合很长的角色提示（anthropic）",
+	"stdin-head":        "只保留标准输入开头的 N 行，其余的行边读边丢弃",
+	"stdin-tail":        "只保留标准输入末尾的 N 行，其余的行边读边丢弃",
+	"compaction-model":  "继续的对话超出输入上限时，用于把最早的轮次总结成摘要的模型，为空时直接省略这些轮次",
 	"word-wrap":         "以特定宽度换行格式化输出（默认为 80）",
 	"max-tokens":        "响应中的最大令牌数",
 	"temp":              "结果的温度（随机性），从 0.0 到 2.0，-1.0 表示禁用",
@@ -55,26 +77,106 @@ var help = map[string]string{
 	"topp":              "TopP，温度的替代方案，用于缩小响应范围，从 0.0 到 1.0，-1.0 表示禁用",
 	"topk":              "TopK，仅从每个后续令牌的前 K 个选项中采样，-1 表示禁用",
 	"fanciness":         "您期望的花哨程度",
-	"status-text":       "生成时显示的文本",
+	"status-text":       "生成时显示的文本，可以使用模板变量 {{.model}}、{{.api}} 和 {{.elapsed}}，例如“正在询问 {{.model}}…({{.elapsed}})”",
+	"plain-progress":    "不显示动画，只在状态变化时输出一行文本，适合 CI 日志与终端录屏",
+	"tty-progress":      "标准输出和标准错误都被重定向时，把进度直接写到 /dev/tty",
+	"no-deprecation-warnings": "不提示已弃用的标志和配置字段（每一项默认只提示一次）",
+	"usage-digest":      "每天（daily）或每周（weekly）第一次运行时，在标准错误上显示上一个周期的请求数、令牌、预估费用和最常用的模型，数据只来自本地记录；off 表示关闭",
 	"settings":          "在 $EDITOR 中打开设置",
+	"tui":               "与 --settings 一起使用时，在分页的表单中编辑常用设置，而不是打开 $EDITOR",
 	"dirs":              "打印 mods 存储其数据的目录",
+	"du":                "统计缓存和数据库的磁盘占用、对话数和最大的 10 个对话",
 	"reset-settings":    "备份旧设置文件并将所有内容重置为默认值",
 	"continue":          "从上次响应或给定的保存标题继续",
 	"continue-last":     "从上次响应继续",
+	"chat":              "交互式聊天模式：回答完成后继续在同一进程中输入后续提示",
+	"map":               "逐行处理标准输入：每行独立请求并输出一行结果，提示中的 {{line}} 会被替换为当前行",
+	"map-delimiter":     "--map 拆分记录的分隔符，支持 \\n、\\t、\\0 等转义；使用自定义分隔符时结果保留换行，并用同样的分隔符分开",
+	"map-format":        "--map 的输出格式：plain 每条记录输出一条结果，ndjson 每条记录输出一行包含输入、结果和错误的 JSON",
+	"map-workers":       "--map 和 --csv 同时进行的请求数",
+	"time-format":       "列表和提示中时间的显示方式：relative（相对时间，默认）、absolute（本地时间）或 iso（RFC 3339）",
+	"compare":           "把同一个提示同时发送给多个模型（逗号分隔或重复使用），依次输出各自的回答、耗时和令牌用量",
+	"compare-layout":    "--compare 的布局：stacked 依次输出，side 在终端中并排输出",
+	"csv":               "按列处理标准输入中的 CSV/TSV 表格：列=提示模板，{{value}} 会被替换为单元格的值，结果追加为新列",
+	"ui":                "启动本地只读 Web 页面，浏览和搜索对话历史",
+	"ui-addr":           "--ui 监听的地址",
+	"search-domains":    "限制 Perplexity 在线模型搜索的域名，以 - 开头表示排除，可多次指定",
+	"search-recency":    "限制 Perplexity 在线模型搜索结果的新鲜度：hour、day、week 或 month",
+	"safe-prompt":       "让 Mistral 在系统提示前加入安全提示，约束不当内容",
+	"keep-alive":        "Ollama 在请求后把模型保留在内存中的时间，例如 10m，-1 表示一直保留，0 表示立即卸载",
+	"num-gpu":           "Ollama 放到 GPU 上的层数，0 表示使用 Ollama 的默认值",
+	"num-thread":        "Ollama 推理使用的线程数，0 表示使用 Ollama 的默认值",
+	"repeat-penalty":    "Ollama 对重复内容的惩罚，例如 1.1，0 表示使用 Ollama 的默认值",
+	"mirostat":          "Ollama 的 Mirostat 采样：1 或 2 启用对应版本，0 表示使用 Ollama 的默认值",
+	"import":            "从导出文件导入对话（ChatGPT 的 conversations.json、JSON 消息列表或 Markdown），之后可以继续",
+	"regenerate":        "删除对话中最后一次回答并用同样的提示重新请求，默认为上一次对话，可与 --continue 和 --temp 等参数一起使用",
+	"undo":              "从保存的对话中删除最近一轮问答（提示、回答与工具调用），默认为上一次对话",
+	"archive-to-notes":  "把对话渲染为带 frontmatter 的 markdown 写入 notes-dir，默认为上一次对话，再次归档时覆盖同一篇笔记",
+	"notes-dir":         "--archive-to-notes 写入笔记的目录，例如 Obsidian 库中的文件夹，支持 ~ 和环境变量",
+	"notes-tags":        "--archive-to-notes 写入笔记 frontmatter 的标签，对话使用的角色也会加为标签",
+	"show-tool-log":     "显示对话中调用过的工具、参数、结果和错误；每次工具调用都会追加到缓存目录中的 tool-log.jsonl",
+	"export-finetune":   "把对话转换为 OpenAI 微调格式的 JSONL 写入文件（- 表示标准输出），参数为要导出的对话，不指定时导出所有对话",
+	"finetune-tag":      "--export-finetune 只导出带有这些标签（对话使用的角色）之一的对话",
+	"fork":              "将对话复制为新的分支，原对话保持不变；使用 <ID>:N 只保留前 N 条消息，带提示时直接在分支上继续",
+	"hide-reasoning":    "不显示模型的思考内容（如 DeepSeek-R1 的 reasoning_content）",
+	"show-reasoning":    "以暗淡的样式在标准错误上实时输出模型的思考内容，与回答分开，输出到管道时也显示",
+	"save-request":      "将发送给 API 的最终请求保存到文件（密钥已脱敏），便于提交问题和比较不同版本的行为",
+	"replay-request":    "重新发送 --save-request 保存的请求，使用当前配置中的密钥，并将 API 的原始响应输出到标准输出",
+	"apply":             "将文件与提示一起发送，让模型回复 diff 或完整的新文件，预览差异并在确认后写回文件；使用 --quiet 时不显示差异，使用 --yes 时不确认",
+	"exec":              "让模型只回复一条 shell 命令，确认后执行并以命令的退出码退出；命令失败时可以把输出交给模型重新生成",
+	"critic":            "回答完成后让同一个模型自评是否回答了问题、是否遵循了格式，不合格时带着批评意见重新回答",
+	"critic-retries":    "--critic 自评不合格时最多重新回答的次数，默认为 1",
+	"samples":           "对同一个提示并发采样多次，从中选出最终的回答",
+	"pick":              "--samples 选择最终回答的方式：vote 按最后一行的答案投票，best 让评审模型选出最好的一个，all 输出所有回答，ask 在终端中由你选择（输出不是终端时输出 JSON 数组）",
+	"judge":             "--pick best 使用的评审模型，默认由回答问题的模型评审",
+	"n":                 "生成多个候选回答并由你选择（默认 --pick ask）：OpenAI、Azure 和设置了 supports-n 的 OpenAI 兼容 API 在一次请求中生成，其他 API 并发发送多个请求",
+	"keep-all":          "--samples 时把没有选中的回答也保存为对话",
+	"extract-code":      "只输出回答中的围栏代码块，可以指定语言（如 --extract-code=sh），便于直接通过管道交给 sh 或写入文件",
+	"export-format":     "以指定格式输出整个对话，而不是只输出回答。支持：html（自包含的带样式页面）",
+	"redact":            "与 --export-format 一起使用：导出前替换密钥、令牌、口令、邮箱、IP 地址和 redact-patterns 匹配的内容，并去掉附带的图片",
+	"encrypt":           "与 --export-format 一起使用：用口令（age）加密导出的内容，口令从 MODS_EXPORT_PASSPHRASE 读取或在终端中输入",
+	"redact-patterns":   "--redact 额外替换的正则表达式，例如内部域名或项目代号",
+	"dry-run":           "构建请求（角色、标准输入与对话历史）并统计输入令牌数和预估费用，但不调用 API",
+	"detach":            "在后台执行请求并立即返回任务 ID",
+	"jobs":              "列出后台任务",
+	"attach-job":        "跟随给定后台任务的输出直到其结束",
+	"attach":            "附带图片（本地路径或 URL），供支持视觉的模型使用，可重复使用",
 	"no-cache":          "禁用提示/响应的缓存",
 	"title":             "以给定标题保存当前对话",
 	"list":              "列出已保存的对话",
+	"cache-format":      "对话缓存的存储格式：gob（默认）或 json（带 schema 版本号，其它工具也可以读取）",
+	"id-format":         "新对话 ID 的格式：sha1（默认）或 uuidv7（可以按创建时间排序，短 ID 取结尾的随机部分）",
+	"pack":              "导出或导入角色共享包：--pack export <bundle.tar> [角色...] 打包角色及其引用的文件，--pack import <路径|URL> 将包中的角色添加到设置中",
+	"convert-cache":     "将所有已保存的对话转换为指定的缓存格式（gob 或 json），之后请在设置中使用相同的 cache-format",
+	"list-json":         "以 JSON 格式列出已保存的对话（id、title、api、model、updated_at），便于脚本处理",
 	"delete":            "删除具有给定标题或 ID 的一个或多个已保存对话",
 	"delete-older-than": "删除所有早于指定持续时间的已保存对话；有效值为 " + strings.EnglishJoin(duration.ValidUnits(), true),
 	"show":              "显示具有给定标题或 ID 的已保存对话",
 	"theme":             "在表单中使用的主题；有效选择为 charm、catppuccin、dracula 和 base16",
 	"show-last":         "显示上次保存的对话",
+	"meta":              "与 --show 一起使用时，同时显示生成该对话时使用的请求参数",
 	"editor":            "在 $EDITOR 中编辑提示；仅在没有其他参数且 STDIN 是 TTY 时才生效",
 	"mcp-servers":       "MCP 服务器配置",
 	"mcp-disable":       "禁用特定的 MCP 服务器",
 	"mcp-list":          "列出所有可用的 MCP 服务器",
 	"mcp-list-tools":    "列出已启用 MCP 服务器的所有可用工具",
-	"mcp-timeout":       "MCP 服务器调用的超时时间，默认为 15 秒",
+	"mcp-login":         "登录设置了 oauth 的 MCP 服务器，令牌保存在缓存中并自动刷新",
+	"mcp-list-resources": "列出已启用 MCP 服务器提供的资源",
+	"mcp-list-prompts":  "列出已启用 MCP 服务器提供的提示模板及其参数",
+	"mcp-resource":      "读取 MCP 资源（server:uri）并附在提示后面，可重复使用",
+	"mcp-prompt":        "使用 MCP 服务器的提示模板（server:name）作为对话的开头",
+	"mcp-prompt-arg":    "--mcp-prompt 的参数（key=value），可重复使用",
+	"mcp-timeout":       "MCP 服务器调用的超时时间，默认为 15 秒；可以在 mcp-servers 中用 timeout 为单个服务器覆盖",
+	"tools":             "本地工具：与 MCP 工具一起提供给模型，调用时用参数渲染 command 并直接执行",
+	"tool-approval":     "调用 MCP 和本地工具前是否需要批准：always 直接调用，never 全部拒绝，ask 显示工具名称和参数并询问；可以在 mcp-servers 和 tools 中单独设置",
+	"tool-output-only":  "模型调用工具后，直接输出最后一个工具结果，而不再让模型复述",
+	"max-tool-rounds":   "一次回答中最多执行的工具调用轮数，超出时停止并报错，0 表示不限制；相同的工具以相同参数调用 3 次时也会停止",
+	"max-tool-result":   "交给模型的工具结果大小的上限（如 100KB），超出时保留开头和结尾并标明省略的字节数，-1 表示不限制",
+	"fallback-apis":     "API 服务不可用、服务器出错或者限流时，依次改用的 API 和模型（model 为空时使用同名的模型）",
+	"outputs":           "回答完成后同时发送到的地方：追加到文件（file）、POST 到 webhook（webhook）或 Slack incoming webhook（slack），可以用 roles 只绑定到某些角色，用 template 定制发送的内容",
+	"no-outputs":        "这一次不发送到设置中的 outputs",
+	"rules":             "没有指定角色时，按输入自动选择角色的规则：--apply/--attach 文件的扩展名（ext）、标准输入的开头（stdin-prefix）或正则表达式（match），按顺序使用第一条符合的规则",
+	"no-rules":          "这一次不按 rules 自动选择角色",
 }
 
 // Model 表示 API 调用中使用的 LLM 模型。
@@ -82,9 +184,21 @@ type Model struct {
 	Name           string   // 模型名称
 	API            string   // API 名称
 	MaxChars       int64    `yaml:"max-input-chars"` // 最大输入字符数
+	MaxInputTokens int64    `yaml:"max-input-tokens,omitempty"` // 最大输入令牌数，未设置时由最大输入字符数换算
 	Aliases        []string `yaml:"aliases"`         // 别名列表
 	Fallback       string   `yaml:"fallback"`        // 回退模型
-	ThinkingBudget int      `yaml:"thinking-budget,omitempty"` // 思考预算
+	ThinkingBudget int      `yaml:"thinking-budget,omitempty"` // 思考预算（令牌数），用于 google、vertex 和 anthropic
+	ReasoningEffort string  `yaml:"reasoning-effort,omitempty"` // 推理强度（OpenAI o 系列）：low、medium、high
+	KeepAlive      string   `yaml:"keep-alive,omitempty"`      // 请求后模型保留在内存中的时间（ollama）
+	Options        map[string]any `yaml:"options,omitempty"` // 额外的推理选项（ollama），例如 num_gpu、mirostat
+	InputPrice     float64  `yaml:"input-price,omitempty"`     // 每百万输入令牌的价格（美元）
+	OutputPrice    float64  `yaml:"output-price,omitempty"`    // 每百万输出令牌的价格（美元）
+}
+
+// FallbackAPI 是 fallback-apis 中的一项：当前的 API 不可用或者限流时改用的 API 和模型。
+type FallbackAPI struct {
+	API   string `yaml:"api"`   // API 名称
+	Model string `yaml:"model"` // 模型名称或别名，为空时使用同名的模型
 }
 
 // API 表示 API 端点及其模型。
@@ -93,10 +207,27 @@ type API struct {
 	APIKey    string           `yaml:"api-key"`     // API 密钥
 	APIKeyEnv string           `yaml:"api-key-env"` // API 密钥环境变量
 	APIKeyCmd string           `yaml:"api-key-cmd"` // API 密钥命令
+	APIKeyFile string          `yaml:"api-key-file"` // API 密钥文件（Docker secrets、systemd 凭据）
 	Version   string           `yaml:"version"`     // 版本（XXX: 未在任何地方使用）
 	BaseURL   string           `yaml:"base-url"`    // 基础 URL
 	Models    map[string]Model `yaml:"models"`      // 模型映射
 	User      string           `yaml:"user"`        // 用户
+	Region    string           `yaml:"region"`      // 区域（bedrock、vertex）
+	Project   string           `yaml:"project"`     // GCP 项目 ID（vertex）
+
+	QueryParams map[string]string `yaml:"query-params"` // 附加到请求 URL 上的查询参数（OpenAI 兼容的 API）
+	SupportsN   bool              `yaml:"supports-n"`   // 端点支持用 n 参数一次生成多个回答（OpenAI 兼容的 API）
+	StreamUsage *bool             `yaml:"stream-usage"` // 请求在流末尾返回令牌用量，openai 和 azure 默认开启（OpenAI 兼容的 API）
+	Provider    *ProviderRouting  `yaml:"provider"`     // 供应商路由偏好（OpenRouter）
+
+	SignCmd string       `yaml:"sign-cmd"` // 为请求体签名的命令，输出的请求头会加到请求中
+	HMAC    *HMACSigning `yaml:"hmac"`     // 内置的 HMAC 请求体签名
+}
+
+// ProviderRouting 表示 OpenRouter 的供应商路由偏好，原样作为请求体中的 provider 字段发送。
+type ProviderRouting struct {
+	Order          []string `yaml:"order" json:"order,omitempty"`                     // 优先使用的供应商
+	AllowFallbacks *bool    `yaml:"allow-fallbacks" json:"allow_fallbacks,omitempty"` // 首选供应商不可用时是否允许使用其他供应商
 }
 
 // APIs 是类型别名，用于自定义 YAML 解码。
@@ -144,6 +275,8 @@ type Config struct {
 	FormatText          FormatText `yaml:"format-text"`                                   // 格式化文本
 	FormatAs            string     `yaml:"format-as" env:"FORMAT_AS"`                     // 格式化为
 	Raw                 bool       `yaml:"raw" env:"RAW"`                                 // 原始输出
+	NoGuessLang         bool       `yaml:"no-guess-lang" env:"NO_GUESS_LANG"`             // 不猜测代码块的语言
+	NoHyperlinks        bool       `yaml:"no-hyperlinks" env:"NO_HYPERLINKS"`             // 不输出终端超链接
 	Quiet               bool       `yaml:"quiet" env:"QUIET"`                             // 安静模式
 	MaxTokens           int64      `yaml:"max-tokens" env:"MAX_TOKENS"`                   // 最大令牌数
 	MaxCompletionTokens int64      `yaml:"max-completion-tokens" env:"MAX_COMPLETION_TOKENS"` // 最大完成令牌数
@@ -153,16 +286,57 @@ type Config struct {
 	TopP                float64    `yaml:"topp" env:"TOPP"`                               // TopP
 	TopK                int64      `yaml:"topk" env:"TOPK"`                               // TopK
 	NoLimit             bool       `yaml:"no-limit" env:"NO_LIMIT"`                       // 无限制
+	CompactionModel     string     `yaml:"compaction-model" env:"COMPACTION_MODEL"`       // 压缩对话使用的模型
+	PromptCache         bool       `yaml:"prompt-cache" env:"PROMPT_CACHE"`               // 提示缓存
+	CacheRoles          []string   `yaml:"cache-roles" env:"CACHE_ROLES"`                 // 总是缓存系统消息的角色
+	MaxRequestSize      byteSize   `yaml:"max-request-size" env:"MAX_REQUEST_SIZE"`       // 请求体大小上限
+	AllowOutsideCwd     bool       `yaml:"allow-outside-cwd" env:"ALLOW_OUTSIDE_CWD"`     // 允许读取当前目录之外的文件
+	Throttle            tokenRate  `yaml:"throttle" env:"THROTTLE"`                       // 输出速率
+	EmbedModel          string     `yaml:"embed-model" env:"EMBED_MODEL"`                 // 向量模型
+	EmbedFormat         string     `yaml:"embed-format" env:"EMBED_FORMAT"`               // 向量的输出格式
+	RAGTopK             int        `yaml:"rag-top-k" env:"RAG_TOP_K"`                     // --rag 检索的片段数
+	MapWorkers          int        `yaml:"map-workers" env:"MAP_WORKERS"`                 // --map 和 --csv 同时进行的请求数
+	TimeFormat          string     `yaml:"time-format" env:"TIME_FORMAT"`                 // 时间的显示方式
 	CachePath           string     `yaml:"cache-path" env:"CACHE_PATH"`                   // 缓存路径
+	CacheFormat         string     `yaml:"cache-format" env:"CACHE_FORMAT"`               // 对话缓存格式
+	IDFormat            string     `yaml:"id-format" env:"ID_FORMAT"`                     // 新对话 ID 的格式
+	NotesDir            string     `yaml:"notes-dir" env:"NOTES_DIR"`                     // 归档笔记的目录
+	UsageDigest         string     `yaml:"usage-digest" env:"USAGE_DIGEST"`               // 使用摘要的周期
+	NotesTags           []string   `yaml:"notes-tags" env:"NOTES_TAGS"`                   // 归档笔记的标签
 	NoCache             bool       `yaml:"no-cache" env:"NO_CACHE"`                       // 禁用缓存
 	IncludePromptArgs   bool       `yaml:"include-prompt-args" env:"INCLUDE_PROMPT_ARGS"` // 包含提示参数
 	IncludePrompt       int        `yaml:"include-prompt" env:"INCLUDE_PROMPT"`           // 包含提示
 	MaxRetries          int        `yaml:"max-retries" env:"MAX_RETRIES"`                 // 最大重试次数
+	Critic              bool       `yaml:"critic" env:"CRITIC"`                           // 回答后自评
+	CriticRetries       int        `yaml:"critic-retries" env:"CRITIC_RETRIES"`           // 自评不合格时最多重新回答的次数
+	Samples             int        `yaml:"samples" env:"SAMPLES"`                         // 采样次数
+	Pick                string     `yaml:"pick" env:"PICK"`                               // 选择最终回答的方式
+	Judge               string     `yaml:"judge" env:"JUDGE"`                             // 评审模型
+	KeepAll             bool       `yaml:"keep-all" env:"KEEP_ALL"`                       // 保存没有选中的回答
+	RetryBudget         time.Duration `yaml:"retry-budget" env:"RETRY_BUDGET"`          // 重试总预算
+	SearchDomains       []string   `yaml:"search-domains" env:"SEARCH_DOMAINS"`           // 搜索域过滤（perplexity）
+	SearchRecency       string     `yaml:"search-recency" env:"SEARCH_RECENCY"`           // 搜索结果新鲜度（perplexity）
+	SafePrompt          bool       `yaml:"safe-prompt" env:"SAFE_PROMPT"`                 // 安全提示（mistral）
+	KeepAlive           string     `yaml:"keep-alive" env:"KEEP_ALIVE"`                   // 模型保留在内存中的时间（ollama）
+	NumGPU              int        `yaml:"num-gpu" env:"NUM_GPU"`                         // 放到 GPU 上的层数（ollama）
+	NumThread           int        `yaml:"num-thread" env:"NUM_THREAD"`                   // 推理使用的线程数（ollama）
+	RepeatPenalty       float64    `yaml:"repeat-penalty" env:"REPEAT_PENALTY"`           // 重复惩罚（ollama）
+	Mirostat            int        `yaml:"mirostat" env:"MIROSTAT"`                       // Mirostat 采样（ollama）
+	RetryMaxWait        time.Duration `yaml:"retry-max-wait" env:"RETRY_MAX_WAIT"`      // 单次重试等待上限
+	RequestTimeout      timeoutDuration `yaml:"request-timeout" env:"REQUEST_TIMEOUT"`  // 模型请求的超时时间
 	WordWrap            int        `yaml:"word-wrap" env:"WORD_WRAP"`                     // 自动换行
 	Fanciness           uint       `yaml:"fanciness" env:"FANCINESS"`                     // 花哨程度
 	StatusText          string     `yaml:"status-text" env:"STATUS_TEXT"`                 // 状态文本
+	PlainProgress       bool       `yaml:"plain-progress" env:"PLAIN_PROGRESS"`           // 以纯文本行显示进度
+	TTYProgress         bool       `yaml:"tty-progress" env:"TTY_PROGRESS"`               // 把进度写到 /dev/tty
+	NoDeprecationWarnings bool     `yaml:"no-deprecation-warnings" env:"NO_DEPRECATION_WARNINGS"` // 不提示弃用
 	HTTPProxy           string     `yaml:"http-proxy" env:"HTTP_PROXY"`                   // HTTP 代理
+	APIKeyCacheTTL      time.Duration `yaml:"api-key-cache-ttl" env:"API_KEY_CACHE_TTL"` // api-key-cmd 结果的缓存时间
 	APIs                APIs       `yaml:"apis"`                                          // API 列表
+	FallbackAPIs        []FallbackAPI `yaml:"fallback-apis"`                              // 出错时依次改用的 API
+	Outputs             []Output   `yaml:"outputs"`                                       // 回答完成后额外发送到的地方
+	RedactPatterns      []string   `yaml:"redact-patterns"`                               // --redact 额外替换的正则表达式
+	Rules               []RoleRule `yaml:"rules"`                                         // 没有指定角色时按输入自动选择角色的规则
 	System              string     `yaml:"system"`                                        // 系统消息
 	Role                string     `yaml:"role" env:"ROLE"`                               // 角色
 	AskModel            bool                                                          // 询问模型
@@ -172,15 +346,20 @@ type Config struct {
 	Prefix              string                                                        // 前缀
 	Version             bool                                                          // 版本
 	Settings            bool                                                          // 设置
+	SettingsTUI         bool                                                          // 在表单中编辑设置
 	Dirs                bool                                                          // 目录
+	DU                  bool                                                          // 统计磁盘占用
 	Theme               string                                                        // 主题
 	SettingsPath        string                                                        // 设置路径
 	ContinueLast        bool                                                          // 继续上次
+	Chat                bool                                                          // 聊天模式
 	Continue            string                                                        // 继续
 	Title               string                                                        // 标题
 	ShowLast            bool                                                          // 显示上次
 	Show                string                                                        // 显示
+	ShowMeta            bool                                                          // 显示请求参数
 	List                bool                                                          // 列表
+	ListJSON            bool                                                          // 以 JSON 格式列出对话
 	ListRoles           bool                                                          // 列出角色
 	Delete              []string                                                      // 删除
 	DeleteOlderThan     time.Duration                                                 // 删除早于
@@ -189,10 +368,72 @@ type Config struct {
 	MCPServers   map[string]MCPServerConfig `yaml:"mcp-servers"` // MCP 服务器配置
 	MCPList      bool                                          // MCP 列表
 	MCPListTools bool                                          // MCP 工具列表
+	MCPListResources bool                                      // MCP 资源列表
+	MCPListPrompts   bool                                      // MCP 提示模板列表
+	MCPResources     []string                                  // 附在提示后面的 MCP 资源
+	MCPPrompt        string                                    // 作为对话开头的 MCP 提示模板
+	MCPPromptArgs    []string                                  // MCP 提示模板的参数
+	MCPLogin         string                                    // 要登录的 MCP 服务器
 	MCPDisable   []string                                      // MCP 禁用
 	MCPTimeout   time.Duration `yaml:"mcp-timeout" env:"MCP_TIMEOUT"` // MCP 超时
+	Tools        map[string]LocalTool `yaml:"tools"`                 // 本地工具
+	ToolApproval string        `yaml:"tool-approval" env:"TOOL_APPROVAL"` // 工具调用的批准方式
+
+	ToolOutputOnly bool `yaml:"tool-output-only" env:"TOOL_OUTPUT_ONLY"` // 仅输出工具结果
+	MaxToolRounds  int  `yaml:"max-tool-rounds" env:"MAX_TOOL_ROUNDS"`   // 一次回答中最多的工具调用轮数
+	MaxToolResult  byteSize `yaml:"max-tool-result" env:"MAX_TOOL_RESULT"` // 工具结果大小上限
+	HideReasoning  bool `yaml:"hide-reasoning" env:"HIDE_REASONING"`     // 隐藏模型的思考内容
+	ShowReasoning  bool `yaml:"show-reasoning" env:"SHOW_REASONING"`     // 在标准错误上输出思考内容
+
+	Images    []string // 附带的图片路径或 URL
+	StdinHead int      // 只保留标准输入开头的行数
+	StdinTail int      // 只保留标准输入末尾的行数
+	Map    bool     // 逐行处理标准输入
+	MapDelimiter string // --map 拆分记录的分隔符
+	MapFormat    string // --map 的输出格式
+	Compare       []string // 同时比较的模型
+	CompareLayout string   // --compare 的布局
+	CSV    string   // 按列处理输入表格
+	Embed  bool     // 为每段文本获取向量
+	Index  string   // 要建立的向量索引名称
+	RAG    string   // 检索资料的向量索引名称
+
+	ExportFormat string // 对话导出格式
+	ExtractCode  string // 只输出回答中该语言的代码块
+	Import       string // 导入对话的文件
+	Fork         string // 复制为新分支的对话
+	Regenerate   bool   // 重新生成上一次的回答
+	Undo         string // 撤销最近一轮问答的对话
+	ArchiveToNotes string // 归档到笔记目录的对话
+	ShowToolLog  string // 显示工具调用日志的对话
+	NoOutputs    bool   // 不发送到 outputs
+	NoRules      bool   // 不按 rules 选择角色
+	Redact       bool   // 导出前脱敏
+	Encrypt      bool   // 用口令加密导出的内容
+	ExportFinetune string   // 导出微调数据的文件
+	FinetuneTags   []string // 按标签筛选要导出的微调数据
+	ConvertCache string // 要转换成的对话缓存格式
+	Pack         string // 共享包操作：export 或 import
+	Apply        string // 要让模型修改的文件
+	Exec         bool   // 让模型给出命令并在确认后执行
+
+	SaveRequest   string // 保存发送给 API 的请求的文件
+	ReplayRequest string // 要重新发送的请求文件
+
+	UI     bool   // 启动浏览对话历史的 Web 页面
+	UIAddr string // Web 页面监听的地址
+
+	DryRun    bool   // 只统计令牌数，不调用 API
+	FlushKeys bool   // 清除缓存的 api-key-cmd 结果
+	Detach    bool   // 后台执行
+	Jobs      bool   // 列出后台任务
+	AttachJob string // 取回后台任务
+
+	Yes     bool // 跳过风险操作的确认
+	NoInput bool // 需要交互时直接失败
 
 	openEditor                                         bool   // 打开编辑器
+	jobID                                              string // 当前进程作为后台任务运行时的任务 ID
 	cacheReadFromID, cacheWriteToID, cacheWriteToTitle string // 缓存相关
 }
 
@@ -203,6 +444,60 @@ type MCPServerConfig struct {
 	Env     []string `yaml:"env"`     // 环境变量
 	Args    []string `yaml:"args"`    // 参数
 	URL     string   `yaml:"url"`     // URL
+
+	Image   string   `yaml:"image"`   // 容器镜像（docker）
+	Volumes []string `yaml:"volumes"` // 挂载的卷，格式同 docker run -v（docker）
+	Network string   `yaml:"network"` // 容器网络（docker）
+	Port    int      `yaml:"port"`    // 容器内 MCP 服务器监听的 HTTP 端口，未设置时通过 stdio 连接（docker）
+
+	Timeout      time.Duration `yaml:"timeout"`       // 超时，覆盖全局的 mcp-timeout
+	ToolApproval string        `yaml:"tool-approval"` // 工具调用的批准方式，覆盖全局的 tool-approval
+
+	AllowedTools []string `yaml:"allowed-tools"` // 只提供名称匹配这些模式的工具
+	BlockedTools []string `yaml:"blocked-tools"` // 不提供名称匹配这些模式的工具，优先于 allowed-tools
+
+	Headers     map[string]string `yaml:"headers"`      // 请求头，值支持 ${VAR}（sse、http）
+	BearerToken string            `yaml:"bearer-token"` // 以 Authorization: Bearer 发送的令牌，支持 ${VAR}（sse、http）
+	OAuth       *MCPOAuthConfig   `yaml:"oauth"`        // OAuth 登录，先用 --mcp-login 登录（sse、http）
+
+	Disabled bool `yaml:"disabled"` // 禁用该服务器，效果同 --mcp-disable
+}
+
+// timeout 返回该服务器的超时，未配置时使用全局的 mcp-timeout
+func (s MCPServerConfig) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return config.MCPTimeout
+}
+
+// toolAllowed 判断是否向模型提供该服务器的工具：不能匹配 blocked-tools，
+// 设置了 allowed-tools 时必须匹配其中之一。模式的语法同 path.Match，例如 get_*
+// name: 工具名称（不含服务器名称）
+// 返回：是否提供和模式无效时的错误信息
+func (s MCPServerConfig) toolAllowed(name string) (bool, error) {
+	blocked, err := matchAny(s.BlockedTools, name)
+	if err != nil || blocked {
+		return false, err
+	}
+	if len(s.AllowedTools) == 0 {
+		return true, nil
+	}
+	return matchAny(s.AllowedTools, name)
+}
+
+// matchAny 判断名称是否匹配任意一个模式
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		ok, err := path.Match(pattern, name)
+		if err != nil {
+			return false, fmt.Errorf("无效的工具名称模式 %q: %w", pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // ensureConfig 确保配置文件存在并返回配置
@@ -226,7 +521,14 @@ func ensureConfig() (Config, error) {
 	if err != nil {
 		return c, modsError{err, "无法读取设置文件。"}
 	}
-	if err := yaml.Unmarshal(content, &c); err != nil {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return c, modsError{err, "无法解析设置文件。"}
+	}
+	if err := interpolateNode(&doc); err != nil {
+		return c, modsError{err, "无法展开设置文件中的变量。"}
+	}
+	if err := doc.Decode(&c); err != nil {
 		return c, modsError{err, "无法解析设置文件。"}
 	}
 
@@ -238,6 +540,26 @@ func ensureConfig() (Config, error) {
 		c.CachePath = filepath.Join(xdg.DataHome, "mods")
 	}
 
+	if _, err := cache.ParseFormat(c.CacheFormat); err != nil {
+		return c, modsError{err, "无效的 cache-format 设置。"}
+	}
+
+	if err := validateUsageDigest(c.UsageDigest); err != nil {
+		return c, modsError{err, "无效的 usage-digest 设置。"}
+	}
+
+	if err := validateIDFormat(c.IDFormat); err != nil {
+		return c, modsError{err, "无效的 id-format 设置。"}
+	}
+
+	if err := validateTimeFormat(c.TimeFormat); err != nil {
+		return c, err
+	}
+
+	if err := validateRules(c.Rules); err != nil {
+		return c, modsError{err, "无效的 rules 设置。"}
+	}
+
 	if err := os.MkdirAll(
 		filepath.Join(c.CachePath, "conversations"),
 		0o700,
@@ -249,6 +571,14 @@ func ensureConfig() (Config, error) {
 		c.WordWrap = 80
 	}
 
+	if c.MaxRequestSize == 0 {
+		c.MaxRequestSize = defaultMaxRequestSize
+	}
+
+	if c.MaxToolResult == 0 {
+		c.MaxToolResult = defaultMaxToolResult
+	}
+
 	return c, nil
 }
 
@@ -264,7 +594,7 @@ func writeConfigFile(path string) error {
 
 // createConfigFile 创建配置文件
 func createConfigFile(path string) error {
-	tmpl := template.Must(template.New("config").Parse(configTemplate))
+	tmpl := template.Must(template.New("config").Funcs(templateFuncs()).Parse(configTemplate))
 
 	f, err := os.Create(path)
 	if err != nil {
@@ -293,59 +623,14 @@ func defaultConfig() Config {
 			"markdown": defaultMarkdownFormatText,
 			"json":     defaultJSONFormatText,
 		},
-		MCPTimeout: 15 * time.Second,
+		MCPTimeout:     15 * time.Second,
+		RetryMaxWait:   10 * time.Second,
+		RequestTimeout: timeoutDuration(10 * time.Minute),
+		CriticRetries:  1,
+		Pick:           "vote",
+		ToolApproval:   toolApprovalAlways,
+		RAGTopK:        5,
+		MaxToolRounds:  25,
+		MapWorkers:     defaultMapWorkers,
 	}
 }
-
-// useLine 返回使用行文本
-func useLine() string {
-	appName := filepath.Base(os.Args[0])
-
-	if stdoutRenderer().ColorProfile() == termenv.TrueColor {
-		appName = makeGradientText(stdoutStyles().AppName, appName)
-	}
-
-	return fmt.Sprintf(
-		"%s %s",
-		appName,
-		stdoutStyles().CliArgs.Render("[选项] [前缀 词项]"),
-	)
-}
-
-// usageFunc 返回使用函数
-func usageFunc(cmd *cobra.Command) error {
-	fmt.Printf(
-		"用法:\n  %s\n\n",
-		useLine(),
-	)
-	fmt.Println("选项:")
-	cmd.Flags().VisitAll(func(f *flag.Flag) {
-		if f.Hidden {
-			return
-		}
-		if f.Shorthand == "" {
-			fmt.Printf(
-				"  %-44s %s\n",
-				stdoutStyles().Flag.Render("--"+f.Name),
-				stdoutStyles().FlagDesc.Render(f.Usage),
-			)
-		} else {
-			fmt.Printf(
-				"  %s%s %-40s %s\n",
-				stdoutStyles().Flag.Render("-"+f.Shorthand),
-				stdoutStyles().FlagComma,
-				stdoutStyles().Flag.Render("--"+f.Name),
-				stdoutStyles().FlagDesc.Render(f.Usage),
-			)
-		}
-	})
-	if cmd.HasExample() {
-		fmt.Printf(
-			"\n示例:\n  %s\n  %s\n",
-			stdoutStyles().Comment.Render("# "+cmd.Example),
-			cheapHighlighting(stdoutStyles(), examples[cmd.Example]),
-		)
-	}
-
-	return nil
-}
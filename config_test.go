@@ -2,6 +2,7 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -26,4 +27,14 @@ func TestConfig(t *testing.T) {
 			"json":     "as json",
 		}), cfg.FormatText)
 	})
+	// 测试 MCP 服务器的超时
+	t.Run("MCP 服务器超时", func(t *testing.T) {
+		var cfg Config
+		require.NoError(t, yaml.Unmarshal([]byte("mcp-timeout: 15s\nmcp-servers:\n  slow:\n    command: npx\n    timeout: 5m\n  fast:\n    command: fast"), &cfg))
+		old := config.MCPTimeout
+		config.MCPTimeout = cfg.MCPTimeout
+		t.Cleanup(func() { config.MCPTimeout = old })
+		require.Equal(t, 5*time.Minute, cfg.MCPServers["slow"].timeout())
+		require.Equal(t, 15*time.Second, cfg.MCPServers["fast"].timeout())
+	})
 }
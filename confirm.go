@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/huh"
+)
+
+// canPrompt 判断是否可以询问用户：标准输入和标准输出都是终端，并且没有使用 --no-input
+func canPrompt() bool {
+	return !config.NoInput && isInputTTY() && isOutputTTY()
+}
+
+// noInputError 返回需要交互但无法交互时的错误
+// what: 需要交互的操作
+// hint: 不用交互也能完成操作的方法，可以为空
+func noInputError(what, hint string) error {
+	reason := fmt.Sprintf("%s需要在终端中交互。", what)
+	if config.NoInput {
+		reason = fmt.Sprintf("%s需要交互，但使用了 %s。", what, stderrStyles().InlineCode.Render("--no-input"))
+	}
+	if hint == "" {
+		return newUserErrorf("%s", reason)
+	}
+	return modsError{err: newUserErrorf("%s", hint), reason: reason}
+}
+
+// confirmAction 在执行有风险的操作前请用户确认。使用 --yes 时直接确认；
+// 使用 --no-input 或者不在终端中时返回错误，提示使用 --yes
+// title: 确认的问题
+// description: 补充说明，可以为空
+// 返回：错误信息，用户拒绝时返回“用户中止”
+func confirmAction(title, description string) error {
+	if config.Yes {
+		return nil
+	}
+	if !canPrompt() {
+		return noInputError(
+			fmt.Sprintf("确认“%s”", title),
+			fmt.Sprintf("使用 %s 跳过确认", stderrStyles().InlineCode.Render("--yes")),
+		)
+	}
+	var confirm bool
+	c := huh.NewConfirm().Title(title).Value(&confirm)
+	if description != "" {
+		c = c.Description(description)
+	}
+	if err := huh.Run(c); err != nil && !errors.Is(err, huh.ErrUserAborted) {
+		return modsError{err, "无法确认操作。"}
+	}
+	if !confirm {
+		return newUserErrorf("用户中止")
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmAction(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+
+	t.Run("--yes 跳过确认", func(t *testing.T) {
+		config.Yes, config.NoInput = true, true
+		require.NoError(t, confirmAction("删除？", ""))
+	})
+
+	t.Run("--no-input 时失败", func(t *testing.T) {
+		config.Yes, config.NoInput = false, true
+		require.False(t, canPrompt())
+		err := confirmAction("删除？", "")
+		var merr modsError
+		require.ErrorAs(t, err, &merr)
+		require.Contains(t, merr.reason, "删除？")
+		require.Contains(t, merr.reason, "--no-input")
+		require.ErrorContains(t, err, "--yes")
+	})
+
+	t.Run("不需要确认的交互", func(t *testing.T) {
+		config.NoInput = true
+		require.ErrorContains(t, noInputError("--ask-model", ""), "--ask-model")
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/mods/internal/cache"
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+// openConversations 打开对话缓存，以设置中的 cache-format 写入
+func openConversations() (*cache.Conversations, error) {
+	format, err := cache.ParseFormat(config.CacheFormat)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	return cache.NewConversationsWithFormat(config.CachePath, format) //nolint:wrapcheck
+}
+
+// convertCache 将所有已保存的对话转换为指定的缓存格式
+// to: 目标格式（gob 或 json）
+// 返回：错误信息
+func convertCache(to string) error {
+	format, err := cache.ParseFormat(to)
+	if err != nil {
+		return modsError{err, "无效的 --convert-cache 参数。"}
+	}
+	c, err := cache.NewConversationsWithFormat(config.CachePath, format)
+	if err != nil {
+		return modsError{err, "无法打开对话缓存。"}
+	}
+	conversations, err := db.List()
+	if err != nil {
+		return modsError{err, "无法列出保存的对话。"}
+	}
+
+	converted := 0
+	for _, convo := range conversations {
+		var messages []proto.Message
+		if err := c.Read(convo.ID, &messages); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return modsError{err, fmt.Sprintf("无法读取对话 %s。", shortID(convo.ID))}
+		}
+		if err := c.Write(convo.ID, &messages); err != nil {
+			return modsError{err, fmt.Sprintf("无法写入对话 %s。", shortID(convo.ID))}
+		}
+		converted++
+	}
+
+	if !config.Quiet {
+		fmt.Fprintf(os.Stderr, "已将 %d 个对话转换为 %s 格式。\n", converted, format)
+		if current, _ := cache.ParseFormat(config.CacheFormat); current != format {
+			fmt.Fprintf(
+				os.Stderr,
+				"请在设置中添加 %s，否则之后保存的对话仍使用 %s 格式。\n",
+				stderrStyles().InlineCode.Render("cache-format: "+string(format)),
+				current,
+			)
+		}
+	}
+	return nil
+}
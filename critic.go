@@ -0,0 +1,140 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+// criticPrompt 要求模型检查上一次的回答
+const criticPrompt = "你是严格的审阅者。检查下面对话中最后的回答是否直接回答了用户的问题，" +
+	"并且遵循了系统提示和问题要求的格式。合格时只回复“通过”；" +
+	"不合格时以“不通过：”开头，用一两句话指出需要修改的地方。"
+
+// criticRetryPrompt 是自评不通过时交给模型的提示
+const criticRetryPrompt = "你的回答没有通过检查：%s\n\n请修正这些问题，重新给出完整的回答，不要提及这次检查。"
+
+// criticMaxTokens 是自评回复的最大令牌数
+const criticMaxTokens int64 = 256
+
+// runCritic 让同一个模型检查回答，不合格时带着批评意见重新回答，最多重试 critic-retries 次。
+// 用完重试次数后保留最后一次回答
+// ctx: 上下文
+// mods: 已完成请求的模型
+// opts: 运行 Bubble Tea 程序的选项
+// 返回：错误信息
+func runCritic(ctx context.Context, mods *Mods, opts []tea.ProgramOption) error {
+	// 重新回答后最后的用户消息是批评意见，始终按最初的问题检查
+	rest, prompt, ok := splitLastExchange(mods.messages)
+	if !ok {
+		return nil
+	}
+	question := append(rest[:systemPrefix(rest):systemPrefix(rest)], prompt)
+	for range mods.Config.CriticRetries {
+		feedback, err := mods.critique(ctx, question)
+		if err != nil {
+			return err
+		}
+		if feedback == "" {
+			return nil
+		}
+		if !mods.Config.Quiet {
+			fmt.Fprintln(os.Stderr, stderrStyles().Comment.Render("自评未通过："+feedback+" 正在重新回答…"))
+		}
+		if err := sendFollowUp(mods, opts, fmt.Sprintf(criticRetryPrompt, feedback)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// critique 用同一个模型检查对话中最后的回答
+// ctx: 上下文
+// question: 系统提示和问题，不需要更早的历史
+// 返回：不合格时的批评意见，合格时为空；以及错误信息
+func (m *Mods) critique(ctx context.Context, question []proto.Message) (string, error) {
+	exchange := append(slices.Clip(question), proto.Message{
+		Role:    proto.RoleAssistant,
+		Content: lastAnswer(m.messages),
+	})
+
+	reply, err := m.ask(ctx, criticPrompt, proto.Conversation(exchange).String(), criticMaxTokens)
+	if err != nil {
+		return "", modsError{err, "无法自评回答。"}
+	}
+	return criticFeedback(reply), nil
+}
+
+// ask 用同一个模型发送一次不在界面中显示的请求
+// ctx: 上下文
+// system: 系统提示
+// prompt: 用户消息
+// maxTokens: 回复的最大令牌数
+// 返回：回复和错误信息
+func (m *Mods) ask(ctx context.Context, system, prompt string, maxTokens int64) (string, error) {
+	cfg := *m.Config
+	return m.askWith(ctx, &cfg, system, prompt, maxTokens)
+}
+
+// askWith 用 cfg 中的模型发送一次不在界面中显示的请求，用量计入本次回答
+// ctx: 上下文
+// cfg: 选择模型使用的配置
+// system: 系统提示
+// prompt: 用户消息
+// maxTokens: 回复的最大令牌数
+// 返回：回复和错误信息
+func (m *Mods) askWith(ctx context.Context, cfg *Config, system, prompt string, maxTokens int64) (string, error) {
+	api, mod, err := m.resolveModel(cfg)
+	if err != nil {
+		return "", err
+	}
+	client, err := m.newClient(cfg, api, mod)
+	if err != nil {
+		return "", err
+	}
+	s := client.Request(ctx, proto.Request{
+		Messages: []proto.Message{
+			{Role: proto.RoleSystem, Content: system},
+			{Role: proto.RoleUser, Content: prompt},
+		},
+		API:       mod.API,
+		Model:     mod.Name,
+		User:      cfg.User,
+		MaxTokens: &maxTokens,
+	})
+	defer s.Close() //nolint:errcheck
+	reply, err := readStream(s)
+	if err != nil {
+		return "", err
+	}
+	m.addUsage(s.Usage())
+	return reply, nil
+}
+
+// criticFeedback 解析自评的回复，合格时返回空字符串。
+// 无法识别的回复视为合格，避免因为格式问题无休止地重试
+func criticFeedback(reply string) string {
+	reply = strings.TrimSpace(reply)
+	for _, prefix := range []string{"不通过：", "不通过:", "不通过"} {
+		if feedback, ok := strings.CutPrefix(reply, prefix); ok {
+			return cmp.Or(strings.TrimSpace(feedback), "回答不符合要求。")
+		}
+	}
+	return ""
+}
+
+// lastAnswer 返回对话中最后一条助手消息的内容
+func lastAnswer(messages []proto.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == proto.RoleAssistant && messages[i].Content != "" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCriticFeedback(t *testing.T) {
+	require.Empty(t, criticFeedback("通过"))
+	require.Empty(t, criticFeedback("看起来不错"))
+	require.Equal(t, "没有给出示例。", criticFeedback(" 不通过：没有给出示例。\n"))
+	require.Equal(t, "格式错误", criticFeedback("不通过: 格式错误"))
+	require.Equal(t, "回答不符合要求。", criticFeedback("不通过"))
+}
+
+func TestCritique(t *testing.T) {
+	var body struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"不通过：没有用 JSON。\"}}]}\n\n"+
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":20,\"completion_tokens\":5}}\n\ndata: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	m := &Mods{
+		ctx: context.Background(),
+		Config: &Config{
+			API:   "local",
+			Model: "fake",
+			APIs: APIs{{
+				Name:    "local",
+				APIKey:  "x",
+				BaseURL: srv.URL,
+				Models:  map[string]Model{"fake": {}},
+			}},
+		},
+		messages: []proto.Message{
+			{Role: proto.RoleSystem, Content: "用 JSON 回答"},
+			{Role: proto.RoleUser, Content: "列出三种颜色"},
+			{Role: proto.RoleAssistant, Content: "红、绿、蓝"},
+		},
+	}
+	feedback, err := m.critique(context.Background(), m.messages[:2])
+	require.NoError(t, err)
+	require.Equal(t, "没有用 JSON。", feedback)
+	require.Equal(t, int64(20), m.usage.InputTokens)
+
+	// 审阅者看到系统提示、问题和回答
+	require.Len(t, body.Messages, 2)
+	require.Equal(t, criticPrompt, body.Messages[0].Content)
+	require.Contains(t, body.Messages[1].Content, "用 JSON 回答")
+	require.Contains(t, body.Messages[1].Content, "列出三种颜色")
+	require.Contains(t, body.Messages[1].Content, "红、绿、蓝")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const csvPlaceholder = "{{value}}" // --csv 提示模板中代表单元格值的占位符
+
+// parseCSVSpec 解析 --csv 的参数
+// spec: 形如 "列=提示模板" 的字符串
+// 返回：列名（或从 1 开始的列号）、提示模板与错误信息
+func parseCSVSpec(spec string) (string, string, error) {
+	col, prompt, ok := strings.Cut(spec, "=")
+	col = strings.TrimSpace(col)
+	prompt = strings.TrimSpace(prompt)
+	if !ok || col == "" || prompt == "" {
+		return "", "", fmt.Errorf("无效的 --csv 参数 %q，应为 列=提示模板", spec)
+	}
+	return col, prompt, nil
+}
+
+// csvColumn 在表头中查找列
+// header: 表头
+// col: 列名或从 1 开始的列号
+// 返回：从 0 开始的列索引与错误信息
+func csvColumn(header []string, col string) (int, error) {
+	if i := slices.Index(header, col); i >= 0 {
+		return i, nil
+	}
+	if n, err := strconv.Atoi(col); err == nil && n >= 1 && n <= len(header) {
+		return n - 1, nil
+	}
+	return 0, fmt.Errorf("找不到列 %q，可用的列有：%s", col, strings.Join(header, ", "))
+}
+
+// runCSV 按列解析标准输入中的 CSV/TSV 表格，对指定列的每个单元格执行请求，
+// 并把结果作为新列追加到表格末尾输出
+// ctx: 上下文
+// spec: --csv 的参数
+// 返回：错误信息
+func runCSV(ctx context.Context, spec string) error {
+	if isInputTTY() {
+		return modsError{
+			err:    newUserErrorf("例如：%s", stderrStyles().InlineCode.Render("mods --csv 'comment=判断情感：{{value}}' < reviews.csv")),
+			reason: "--csv 需要从标准输入读取表格。",
+		}
+	}
+
+	col, prompt, err := parseCSVSpec(spec)
+	if err != nil {
+		return modsError{err, "无法解析 --csv 参数。"}
+	}
+
+	// 表头含有制表符时按 TSV 处理
+	in := bufio.NewReader(os.Stdin)
+	first, err := in.Peek(in.Size())
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return modsError{err, "无法读取标准输入。"}
+	}
+	comma := ','
+	if line, _, _ := strings.Cut(string(first), "\n"); strings.Contains(line, "\t") {
+		comma = '\t'
+	}
+
+	r := csv.NewReader(in)
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return modsError{err, "无法解析输入表格。"}
+	}
+	if len(rows) == 0 {
+		return modsError{errors.New("输入为空"), "无法解析输入表格。"}
+	}
+
+	header, rows := rows[0], rows[1:]
+	idx, err := csvColumn(header, col)
+	if err != nil {
+		return modsError{err, "无法解析 --csv 参数。"}
+	}
+
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		if idx < len(row) {
+			values[i] = row[idx]
+		}
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Comma = comma
+	_ = w.Write(append(header, header[idx]+"_mods"))
+
+	// 按输入顺序输出，某一行失败时结果列留空并在最后汇总错误
+	var errs []error
+	for i, ch := range mapAll(ctx, prompt, csvPlaceholder, values) {
+		res := <-ch
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("第 %d 行: %w", i+2, res.err)) //nolint:mnd
+		}
+		_ = w.Write(append(rows[i], oneLine(res.output)))
+		w.Flush()
+	}
+	if err := w.Error(); err != nil {
+		return modsError{err, "无法写入输出表格。"}
+	}
+
+	if len(errs) > 0 {
+		return modsError{errors.Join(errs...), fmt.Sprintf("%d 行处理失败。", len(errs))}
+	}
+	return nil
+}
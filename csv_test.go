@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestCSVSpec 测试 --csv 参数解析
+func TestCSVSpec(t *testing.T) {
+	t.Run("有效参数", func(t *testing.T) {
+		col, prompt, err := parseCSVSpec("comment=判断情感：{{value}}")
+		require.NoError(t, err)
+		require.Equal(t, "comment", col)
+		require.Equal(t, "判断情感：{{value}}", prompt)
+	})
+
+	t.Run("缺少提示", func(t *testing.T) {
+		_, _, err := parseCSVSpec("comment")
+		require.Error(t, err)
+	})
+}
+
+// TestCSVColumn 测试按列名或列号查找列
+func TestCSVColumn(t *testing.T) {
+	header := []string{"id", "comment"}
+
+	t.Run("列名", func(t *testing.T) {
+		idx, err := csvColumn(header, "comment")
+		require.NoError(t, err)
+		require.Equal(t, 1, idx)
+	})
+
+	t.Run("列号", func(t *testing.T) {
+		idx, err := csvColumn(header, "1")
+		require.NoError(t, err)
+		require.Equal(t, 0, idx)
+	})
+
+	t.Run("不存在", func(t *testing.T) {
+		_, err := csvColumn(header, "3")
+		require.Error(t, err)
+	})
+}
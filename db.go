@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/charmbracelet/mods/internal/proto"
 	"github.com/jmoiron/sqlx"
 	"modernc.org/sqlite"
 )
@@ -86,6 +87,44 @@ func openDB(ds string) (*convoDB, error) {
 			return nil, fmt.Errorf("无法迁移数据库: %w", err)
 		}
 	}
+	// 检查并添加 meta 列
+	if !hasColumn(db, "meta") {
+		if _, err := db.Exec(`
+			ALTER TABLE conversations ADD COLUMN meta string
+		`); err != nil {
+			return nil, fmt.Errorf("无法迁移数据库: %w", err)
+		}
+	}
+	// 检查并添加令牌用量列
+	for _, col := range []string{"input_tokens", "output_tokens"} {
+		if !hasColumn(db, col) {
+			if _, err := db.Exec(`
+				ALTER TABLE conversations ADD COLUMN ` + col + ` integer NOT NULL DEFAULT 0
+			`); err != nil {
+				return nil, fmt.Errorf("无法迁移数据库: %w", err)
+			}
+		}
+	}
+
+	// 创建用量记录表，每次完成的请求一行，用于使用摘要
+	if _, err := db.Exec(`
+		CREATE TABLE
+		  IF NOT EXISTS usage_log (
+		    created_at integer NOT NULL,
+		    api string NOT NULL DEFAULT '',
+		    model string NOT NULL DEFAULT '',
+		    input_tokens integer NOT NULL DEFAULT 0,
+		    output_tokens integer NOT NULL DEFAULT 0,
+		    cost real NOT NULL DEFAULT 0
+		  )
+	`); err != nil {
+		return nil, fmt.Errorf("无法迁移数据库: %w", err)
+	}
+	if _, err := db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_usage_created_at ON usage_log (created_at)
+	`); err != nil {
+		return nil, fmt.Errorf("无法迁移数据库: %w", err)
+	}
 
 	return &convoDB{db: db}, nil
 }
@@ -118,6 +157,10 @@ type Conversation struct {
 	UpdatedAt time.Time `db:"updated_at"` // 更新时间
 	API       *string   `db:"api"`        // API 名称
 	Model     *string   `db:"model"`      // 模型名称
+	Meta      *string   `db:"meta"`       // 请求参数（JSON）
+
+	InputTokens  int64 `db:"input_tokens"`  // 累计输入令牌数
+	OutputTokens int64 `db:"output_tokens"` // 累计输出令牌数
 }
 
 // Close 关闭数据库连接
@@ -168,6 +211,58 @@ func (c *convoDB) Save(id, title, api, model string) error {
 	return nil
 }
 
+// AddUsage 将令牌用量累加到对话上
+// id: 对话 ID
+// usage: 新增的令牌用量
+// 返回：错误信息
+func (c *convoDB) AddUsage(id string, usage proto.Usage) error {
+	if _, err := c.db.Exec(c.db.Rebind(`
+		UPDATE conversations
+		SET
+		  input_tokens = input_tokens + ?,
+		  output_tokens = output_tokens + ?
+		WHERE
+		  id = ?
+	`), usage.InputTokens, usage.OutputTokens, id); err != nil {
+		return fmt.Errorf("保存令牌用量失败: %w", err)
+	}
+	return nil
+}
+
+// SaveMeta 保存对话的请求参数
+// id: 对话 ID
+// meta: JSON 格式的请求参数
+// 返回：错误信息
+func (c *convoDB) SaveMeta(id, meta string) error {
+	if _, err := c.db.Exec(c.db.Rebind(`
+		UPDATE conversations
+		SET
+		  meta = ?
+		WHERE
+		  id = ?
+	`), meta, id); err != nil {
+		return fmt.Errorf("保存参数失败: %w", err)
+	}
+	return nil
+}
+
+// SetUpdatedAt 设置对话的更新时间，用于导入的对话保留原来的时间
+// id: 对话 ID
+// t: 更新时间
+// 返回：错误信息
+func (c *convoDB) SetUpdatedAt(id string, t time.Time) error {
+	if _, err := c.db.Exec(c.db.Rebind(`
+		UPDATE conversations
+		SET
+		  updated_at = ?
+		WHERE
+		  id = ?
+	`), t.UTC().Format("2006-01-02 15:04:05.000"), id); err != nil {
+		return fmt.Errorf("保存更新时间失败: %w", err)
+	}
+	return nil
+}
+
 // Delete 删除对话记录
 // id: 对话 ID
 // 返回：错误信息
@@ -237,7 +332,8 @@ func (c *convoDB) findByExactTitle(result *[]Conversation, in string) error {
 	return nil
 }
 
-// findByIDOrTitle 按 ID 或标题查找对话
+// findByIDOrTitle 按 ID 或标题查找对话。UUID 格式的 ID 还可以用短 ID
+// （结尾的随机部分）的前缀或者 ID 的结尾查找
 // result: 结果列表
 // in: ID 或标题
 // 返回：错误信息
@@ -249,14 +345,21 @@ func (c *convoDB) findByIDOrTitle(result *[]Conversation, in string) error {
 		  conversations
 		WHERE
 		  id glob ?
+		  OR (
+		    id glob '*-*'
+		    AND (
+		      substr (id, - ?) glob ?
+		      OR id glob ?
+		    )
+		  )
 		  OR title = ?
-	`), in+"*", in); err != nil {
+	`), in+"*", sha1short, in+"*", "*"+in, in); err != nil {
 		return fmt.Errorf("按 ID 或标题查找失败: %w", err)
 	}
 	return nil
 }
 
-// Completions 获取自动补全列表
+// Completions 获取自动补全列表，UUID 格式的 ID 按短 ID（结尾的随机部分）补全
 // in: 输入字符串
 // 返回：补全列表和错误信息
 func (c *convoDB) Completions(in string) ([]string, error) {
@@ -276,14 +379,45 @@ func (c *convoDB) Completions(in string) ([]string, error) {
 		  conversations
 		WHERE
 		  id glob ?
+		  AND id NOT glob '*-*'
+		UNION
+		SELECT
+		  printf ("%s%c%s", substr (id, - ?), char(9), title)
+		FROM
+		  conversations
+		WHERE
+		  id glob '*-*'
+		  AND substr (id, - ?) glob ?
+		UNION
+		SELECT
+		  printf ("%s%c%s", id, char(9), title)
+		FROM
+		  conversations
+		WHERE
+		  id glob '*-*'
+		  AND id glob ?
+		  AND substr (id, - ?) NOT glob ?
 		UNION
 		SELECT
-		  printf ("%s%c%s", title, char(9), substr (id, 1, ?))
+		  printf (
+		    "%s%c%s",
+		    title,
+		    char(9),
+		    CASE
+		      WHEN id glob '*-*' THEN substr (id, - ?)
+		      ELSE substr (id, 1, ?)
+		    END
+		  )
 		FROM
 		  conversations
 		WHERE
 		  title glob ?
-	`), in, sha1short, sha1short, in+"*", sha1short, in+"*"); err != nil {
+	`),
+		in, sha1short, sha1short, in+"*",
+		sha1short, sha1short, in+"*",
+		in+"*", sha1short, in+"*",
+		sha1short, sha1short, in+"*",
+	); err != nil {
 		return result, fmt.Errorf("获取补全列表失败: %w", err)
 	}
 	return result, nil
@@ -330,3 +464,82 @@ func (c *convoDB) List() ([]Conversation, error) {
 	}
 	return convos, nil
 }
+
+// LogUsage 记录一次完成的请求的令牌用量和预估费用
+// at: 完成时间
+// api: API 名称
+// model: 模型名称
+// usage: 令牌用量
+// cost: 预估费用（美元），模型没有配置价格时为 0
+// 返回：错误信息
+func (c *convoDB) LogUsage(at time.Time, api, model string, usage proto.Usage, cost float64) error {
+	if _, err := c.db.Exec(c.db.Rebind(`
+		INSERT INTO
+		  usage_log (created_at, api, model, input_tokens, output_tokens, cost)
+		VALUES
+		  (?, ?, ?, ?, ?, ?)
+	`), at.Unix(), api, model, usage.InputTokens, usage.OutputTokens, cost); err != nil {
+		return fmt.Errorf("记录用量失败: %w", err)
+	}
+	return nil
+}
+
+// UsageStats 是一段时间内的用量统计
+type UsageStats struct {
+	Requests     int64   `db:"requests"`      // 请求数
+	InputTokens  int64   `db:"input_tokens"`  // 输入令牌数
+	OutputTokens int64   `db:"output_tokens"` // 输出令牌数
+	Cost         float64 `db:"cost"`          // 预估费用（美元）
+	TopModel     string  // 请求数最多的模型
+	TopRequests  int64   // 最常用模型的请求数
+}
+
+// UsageBetween 统计 [from, to) 之间的用量
+// from: 开始时间
+// to: 结束时间
+// 返回：用量统计和错误信息
+func (c *convoDB) UsageBetween(from, to time.Time) (UsageStats, error) {
+	var stats UsageStats
+	if err := c.db.Get(&stats, c.db.Rebind(`
+		SELECT
+		  count(*) AS requests,
+		  coalesce(sum(input_tokens), 0) AS input_tokens,
+		  coalesce(sum(output_tokens), 0) AS output_tokens,
+		  coalesce(sum(cost), 0) AS cost
+		FROM
+		  usage_log
+		WHERE
+		  created_at >= ?
+		  AND created_at < ?
+	`), from.Unix(), to.Unix()); err != nil {
+		return stats, fmt.Errorf("统计用量失败: %w", err)
+	}
+	if stats.Requests == 0 {
+		return stats, nil
+	}
+	var top struct {
+		Model    string `db:"model"`
+		Requests int64  `db:"requests"`
+	}
+	if err := c.db.Get(&top, c.db.Rebind(`
+		SELECT
+		  model,
+		  count(*) AS requests
+		FROM
+		  usage_log
+		WHERE
+		  created_at >= ?
+		  AND created_at < ?
+		GROUP BY
+		  model
+		ORDER BY
+		  requests DESC,
+		  model
+		LIMIT
+		  1
+	`), from.Unix(), to.Unix()); err != nil {
+		return stats, fmt.Errorf("统计用量失败: %w", err)
+	}
+	stats.TopModel, stats.TopRequests = top.Model, top.Requests
+	return stats, nil
+}
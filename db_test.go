@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/charmbracelet/mods/internal/proto"
 	"github.com/stretchr/testify/require"
 )
 
@@ -46,6 +47,49 @@ func TestConvoDB(t *testing.T) {
 		require.Len(t, list, 1)
 	})
 
+	// 测试保存请求参数
+	t.Run("保存请求参数", func(t *testing.T) {
+		db := testDB(t)
+
+		require.NoError(t, db.Save(testid, "消息 1", "openai", "gpt-4o"))
+		require.NoError(t, db.SaveMeta(testid, `{"temperature":0.5}`))
+
+		convo, err := db.Find("df31")
+		require.NoError(t, err)
+		require.NotNil(t, convo.Meta)
+
+		meta, err := decodeRequestMeta(*convo.Meta)
+		require.NoError(t, err)
+		require.Equal(t, 0.5, *meta.Temperature)
+	})
+
+	// 测试累加令牌用量
+	t.Run("累加令牌用量", func(t *testing.T) {
+		db := testDB(t)
+
+		require.NoError(t, db.Save(testid, "消息 1", "openai", "gpt-4o"))
+		require.NoError(t, db.AddUsage(testid, proto.Usage{InputTokens: 10, OutputTokens: 5}))
+		require.NoError(t, db.AddUsage(testid, proto.Usage{InputTokens: 3, OutputTokens: 2}))
+
+		convo, err := db.Find("df31")
+		require.NoError(t, err)
+		require.Equal(t, int64(13), convo.InputTokens)
+		require.Equal(t, int64(7), convo.OutputTokens)
+	})
+
+	// 测试设置更新时间
+	t.Run("设置更新时间", func(t *testing.T) {
+		db := testDB(t)
+
+		at := time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+		require.NoError(t, db.Save(testid, "消息 1", "openai", "gpt-4o"))
+		require.NoError(t, db.SetUpdatedAt(testid, at))
+
+		convo, err := db.Find("df31")
+		require.NoError(t, err)
+		require.True(t, at.Equal(convo.UpdatedAt))
+	})
+
 	// 测试保存无 ID
 	t.Run("保存无 ID", func(t *testing.T) {
 		db := testDB(t)
@@ -183,3 +227,41 @@ func TestConvoDB(t *testing.T) {
 		}, results)
 	})
 }
+
+// TestConvoDBUUID 测试 UUIDv7 格式的对话 ID
+func TestConvoDBUUID(t *testing.T) {
+	const uuid1 = "0190b3a1-7c2e-7a10-8f3e-2b4c6d8e9f01"
+	const uuid2 = "0190b3a1-7d00-7b22-9a11-77aa88bb99cc"
+	db := testDB(t)
+	require.NoError(t, db.Save(uuid1, "第一个", "openai", "gpt-4o"))
+	require.NoError(t, db.Save(uuid2, "第二个", "openai", "gpt-4o"))
+
+	t.Run("按短 ID 查找", func(t *testing.T) {
+		convo, err := db.Find(shortID(uuid1)[:4])
+		require.NoError(t, err)
+		require.Equal(t, uuid1, convo.ID)
+
+		convo, err = db.Find("8f3e-2b4c6d8e9f01")
+		require.NoError(t, err)
+		require.Equal(t, uuid1, convo.ID)
+	})
+
+	t.Run("按前缀查找", func(t *testing.T) {
+		_, err := db.Find("0190b3a1")
+		require.ErrorIs(t, err, errManyMatches)
+
+		convo, err := db.Find("0190b3a1-7d")
+		require.NoError(t, err)
+		require.Equal(t, uuid2, convo.ID)
+	})
+
+	t.Run("自动补全", func(t *testing.T) {
+		results, err := db.Completions("8bb")
+		require.NoError(t, err)
+		require.Equal(t, []string{"8bb99cc\t第二个"}, results)
+
+		results, err = db.Completions("0190b3a1-7c")
+		require.NoError(t, err)
+		require.Equal(t, []string{uuid1 + "\t第一个"}, results)
+	})
+}
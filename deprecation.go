@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// deprecation 描述一个将被移除或更名的标志或配置字段
+type deprecation struct {
+	Flag        string // 标志名称（不含 --），与 Key 二选一
+	Key         string // 设置文件中的字段路径，以 . 分隔，* 匹配任意键，如 apis.*.version
+	Replacement string // 替代的标志或字段，为空表示直接移除
+	RemovedIn   string // 计划移除的版本
+	Note        string // 补充说明
+}
+
+// deprecations 是所有已弃用的标志与配置字段。更名的标志应保留旧名称并指向
+// 同一个变量，它会从帮助中隐藏，使用时提示一次
+var deprecations = []deprecation{
+	{
+		Key:       "apis.*.version",
+		RemovedIn: "v2",
+		Note:      "该字段从未被使用，可以直接删除",
+	},
+}
+
+// deprecationsFile 记录已经提示过的弃用项，每一项只提示一次
+const deprecationsFile = "deprecations.json"
+
+// id 返回弃用项的唯一标识
+func (d deprecation) id() string {
+	if d.Flag != "" {
+		return "--" + d.Flag
+	}
+	return d.Key
+}
+
+// message 返回弃用提示
+func (d deprecation) message() string {
+	code := stderrStyles().InlineCode
+	return d.describe(func(s string) string { return code.Render(s) })
+}
+
+// describe 返回弃用说明，手册页中使用不带样式的版本
+// code: 渲染标志和字段名称
+func (d deprecation) describe(code func(string) string) string {
+	kind := "配置字段"
+	if d.Flag != "" {
+		kind = "标志"
+	}
+	msg := fmt.Sprintf("%s %s 已弃用", kind, code(d.id()))
+	if d.RemovedIn != "" {
+		msg += fmt.Sprintf("，将在 %s 中移除", d.RemovedIn)
+	}
+	if d.Replacement != "" {
+		msg += fmt.Sprintf("，请改用 %s", code(d.Replacement))
+	}
+	if d.Note != "" {
+		msg += "：" + d.Note
+	}
+	return msg + "。"
+}
+
+// hideDeprecatedFlags 从帮助中隐藏已弃用的标志
+func hideDeprecatedFlags(flags *flag.FlagSet) {
+	for _, d := range deprecations {
+		if d.Flag != "" && flags.Lookup(d.Flag) != nil {
+			_ = flags.MarkHidden(d.Flag)
+		}
+	}
+}
+
+// warnDeprecations 对本次使用的已弃用标志和设置文件中的已弃用字段各提示一次。
+// 安静模式下不提示，也不记录，留到下一次正常运行
+func warnDeprecations(cmd *cobra.Command) {
+	if config.NoDeprecationWarnings || config.Quiet {
+		return
+	}
+	used := usedDeprecations(cmd.Flags(), config.SettingsPath)
+	if len(used) == 0 {
+		return
+	}
+
+	path := filepath.Join(config.CachePath, deprecationsFile)
+	warned := map[string]time.Time{}
+	if err := readJSONFile(path, &warned); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		// 文件损坏时重新记录
+		warned = map[string]time.Time{}
+	}
+
+	s := stderrStyles()
+	var shown bool
+	for _, d := range used {
+		if _, ok := warned[d.id()]; ok {
+			continue
+		}
+		fmt.Fprintln(os.Stderr, s.Comment.Render("警告：")+d.message())
+		warned[d.id()] = time.Now()
+		shown = true
+	}
+	if !shown {
+		return
+	}
+	fmt.Fprintln(os.Stderr, s.Comment.Render(fmt.Sprintf(
+		"每一项只提示一次，使用 %s 关闭此类提示。", "--no-deprecation-warnings",
+	)))
+	_ = writeJSONFile(path, warned)
+}
+
+// usedDeprecations 返回本次使用的已弃用标志和设置文件中出现的已弃用字段
+func usedDeprecations(flags *flag.FlagSet, settingsPath string) []deprecation {
+	var settings any
+	if bts, err := os.ReadFile(settingsPath); err == nil {
+		_ = yaml.Unmarshal(bts, &settings)
+	}
+
+	var used []deprecation
+	for _, d := range deprecations {
+		switch {
+		case d.Flag != "":
+			if flags.Changed(d.Flag) {
+				used = append(used, d)
+			}
+		case d.Key != "":
+			if hasConfigKey(settings, strings.Split(d.Key, ".")) {
+				used = append(used, d)
+			}
+		}
+	}
+	return used
+}
+
+// hasConfigKey 判断解析后的 YAML 中是否存在给定路径的字段，* 匹配任意键
+func hasConfigKey(node any, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+	m, ok := node.(map[string]any)
+	if !ok {
+		return false
+	}
+	if path[0] == "*" {
+		for _, v := range m {
+			if hasConfigKey(v, path[1:]) {
+				return true
+			}
+		}
+		return false
+	}
+	v, ok := m[path[0]]
+	return ok && hasConfigKey(v, path[1:])
+}
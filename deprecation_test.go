@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsedDeprecations(t *testing.T) {
+	oldDeprecations := deprecations
+	t.Cleanup(func() { deprecations = oldDeprecations })
+	deprecations = []deprecation{
+		{Flag: "old-flag", Replacement: "--new-flag"},
+		{Key: "apis.*.version"},
+		{Key: "old-key"},
+	}
+
+	settings := filepath.Join(t.TempDir(), "mods.yml")
+	require.NoError(t, os.WriteFile(settings, []byte("apis:\n  openai:\n    version: v1\n  other:\n    base-url: x\n"), 0o600))
+
+	t.Run("设置文件中的字段", func(t *testing.T) {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Bool("old-flag", false, "")
+		used := usedDeprecations(flags, settings)
+		require.Len(t, used, 1)
+		require.Equal(t, "apis.*.version", used[0].id())
+	})
+
+	t.Run("使用的标志", func(t *testing.T) {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Bool("old-flag", false, "")
+		require.NoError(t, flags.Parse([]string{"--old-flag"}))
+		used := usedDeprecations(flags, filepath.Join(t.TempDir(), "missing.yml"))
+		require.Len(t, used, 1)
+		require.Equal(t, "--old-flag", used[0].id())
+	})
+
+	t.Run("隐藏标志", func(t *testing.T) {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Bool("old-flag", false, "")
+		hideDeprecatedFlags(flags)
+		require.True(t, flags.Lookup("old-flag").Hidden)
+	})
+}
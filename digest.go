@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	usageDigestDaily  = "daily"  // 每天第一次运行时显示昨天的用量
+	usageDigestWeekly = "weekly" // 每周第一次运行时显示上周的用量
+)
+
+// usageDigestFile 记录最近一次显示使用摘要的周期，保存在缓存目录中
+const usageDigestFile = "usage-digest"
+
+// validateUsageDigest 检查 usage-digest 的取值
+func validateUsageDigest(s string) error {
+	switch s {
+	case "", "off", usageDigestDaily, usageDigestWeekly:
+		return nil
+	}
+	return newUserErrorf("usage-digest 应为 %s、%s 或 off，而不是 %q", usageDigestDaily, usageDigestWeekly, s)
+}
+
+// digestPeriod 返回摘要统计的时间段和周期的标识，标识相同说明本周期已经显示过
+// mode: usage-digest 设置
+// now: 当前时间
+// 返回：开始时间、结束时间和周期标识
+func digestPeriod(mode string, now time.Time) (time.Time, time.Time, string) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if mode == usageDigestWeekly {
+		// 以周一为一周的开始
+		monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7) //nolint:mnd
+		return monday.AddDate(0, 0, -7), monday, "week " + monday.Format(time.DateOnly)
+	}
+	return today.AddDate(0, 0, -1), today, "day " + today.Format(time.DateOnly)
+}
+
+// printUsageDigest 在每天或每周第一次运行时，在标准错误上输出上一个周期的使用摘要。
+// 数据只来自本地的用量记录。安静模式、后台任务和标准错误不是终端时不输出，也不记录，留到下一次运行
+func printUsageDigest() {
+	mode := config.UsageDigest
+	if mode == "" || mode == "off" || config.Quiet || config.jobID != "" || db == nil ||
+		!isatty.IsTerminal(os.Stderr.Fd()) {
+		return
+	}
+	_ = showUsageDigest(os.Stderr, mode, time.Now())
+}
+
+// showUsageDigest 在本周期还没有显示过时输出上一个周期的使用摘要，没有请求时只记录不输出
+// w: 输出目标
+// mode: usage-digest 设置
+// now: 当前时间
+// 返回：错误信息
+func showUsageDigest(w io.Writer, mode string, now time.Time) error {
+	from, to, period := digestPeriod(mode, now)
+	path := filepath.Join(config.CachePath, usageDigestFile)
+	last, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err //nolint:wrapcheck
+	}
+	if strings.TrimSpace(string(last)) == period {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(period+"\n"), 0o600); err != nil { //nolint:mnd
+		return err //nolint:wrapcheck
+	}
+
+	stats, err := db.UsageBetween(from, to)
+	if err != nil || stats.Requests == 0 {
+		return err
+	}
+	label := "昨天"
+	if mode == usageDigestWeekly {
+		label = "上周"
+	}
+	fmt.Fprintln(w, stderrStyles().Comment.Render(label+"的使用摘要: "+formatUsageStats(stats)))
+	return nil
+}
+
+// formatUsageStats 将用量统计格式化为一行
+func formatUsageStats(stats UsageStats) string {
+	parts := []string{
+		fmt.Sprintf("%d 次请求", stats.Requests),
+		fmt.Sprintf("令牌: 输入 %d · 输出 %d", stats.InputTokens, stats.OutputTokens),
+	}
+	if stats.Cost > 0 {
+		parts = append(parts, fmt.Sprintf("预估费用 $%.4f", stats.Cost))
+	}
+	if stats.TopModel != "" {
+		parts = append(parts, fmt.Sprintf("最常用的模型 %s（%d 次）", stats.TopModel, stats.TopRequests))
+	}
+	return strings.Join(parts, " · ")
+}
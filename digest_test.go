@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestPeriod(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 30, 0, 0, time.Local) // 周日
+
+	from, to, period := digestPeriod(usageDigestDaily, now)
+	require.Equal(t, time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local), from)
+	require.Equal(t, time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local), to)
+	require.Equal(t, "day 2026-10-18", period)
+
+	from, to, period = digestPeriod(usageDigestWeekly, now)
+	require.Equal(t, time.Date(2026, 10, 5, 0, 0, 0, 0, time.Local), from)
+	require.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, time.Local), to)
+	require.Equal(t, "week 2026-10-12", period)
+
+	_, _, period = digestPeriod(usageDigestWeekly, to)
+	require.Equal(t, "week 2026-10-12", period)
+}
+
+func TestShowUsageDigest(t *testing.T) {
+	oldDB, oldConfig := db, config
+	t.Cleanup(func() { db, config = oldDB, oldConfig })
+	db = testDB(t)
+	config.CachePath = t.TempDir()
+
+	now := time.Date(2026, 10, 18, 9, 30, 0, 0, time.Local)
+	yesterday := now.AddDate(0, 0, -1)
+	require.NoError(t, db.LogUsage(yesterday, "openai", "gpt-4o", proto.Usage{InputTokens: 100, OutputTokens: 10}, 0.01))
+	require.NoError(t, db.LogUsage(yesterday, "openai", "gpt-4o", proto.Usage{InputTokens: 50, OutputTokens: 5}, 0.005))
+	require.NoError(t, db.LogUsage(yesterday, "anthropic", "claude", proto.Usage{InputTokens: 1}, 0))
+	require.NoError(t, db.LogUsage(now, "openai", "gpt-4o", proto.Usage{InputTokens: 1000}, 1))
+
+	var buf bytes.Buffer
+	require.NoError(t, showUsageDigest(&buf, usageDigestDaily, now))
+	require.Contains(t, buf.String(), "昨天的使用摘要: 3 次请求 · 令牌: 输入 151 · 输出 15 · 预估费用 $0.0150 · 最常用的模型 gpt-4o（2 次）")
+
+	t.Run("每天只显示一次", func(t *testing.T) {
+		buf.Reset()
+		require.NoError(t, showUsageDigest(&buf, usageDigestDaily, now.Add(time.Hour)))
+		require.Empty(t, buf.String())
+	})
+
+	t.Run("没有请求时不显示", func(t *testing.T) {
+		buf.Reset()
+		require.NoError(t, showUsageDigest(&buf, usageDigestDaily, now.AddDate(0, 0, 5)))
+		require.Empty(t, buf.String())
+	})
+
+	t.Run("每周", func(t *testing.T) {
+		buf.Reset()
+		require.NoError(t, showUsageDigest(&buf, usageDigestWeekly, now.AddDate(0, 0, 1)))
+		require.Contains(t, buf.String(), "上周的使用摘要: 4 次请求")
+	})
+}
+
+func TestValidateUsageDigest(t *testing.T) {
+	for _, s := range []string{"", "off", "daily", "weekly"} {
+		require.NoError(t, validateUsageDigest(s))
+	}
+	require.Error(t, validateUsageDigest("hourly"))
+}
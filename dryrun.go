@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// tokenCount 是 --dry-run 统计的令牌数
+type tokenCount struct {
+	Tokens   int64  // 输入令牌数
+	Encoding string // 使用的词表
+	Approx   bool   // 是否为估算值：非 OpenAI 模型、图片或工具定义
+}
+
+// dryRun 像正常请求一样解析模型并构建消息（角色、标准输入、缓存的历史），
+// 统计输入令牌数和预估费用，但不调用 API
+// ctx: 上下文
+// 返回：错误信息
+func dryRun(ctx context.Context) error {
+	cache, err := openConversations()
+	if err != nil {
+		return modsError{err, "无法打开对话缓存。"}
+	}
+	m := newMods(ctx, stderrRenderer(), &config, db, cache)
+
+	switch msg := m.findCacheOpsDetails()().(type) {
+	case cacheDetailsMsg:
+		m.Config.cacheReadFromID = msg.ReadID
+		m.Config.API = msg.API
+		m.Config.Model = msg.Model
+	case modsError:
+		return msg
+	}
+	var input string
+	switch msg := m.readStdinCmd().(type) {
+	case completionInput:
+		input = msg.content
+	case modsError:
+		return msg
+	}
+	if removeWhitespace(input) == "" && config.Prefix == "" && !config.Regenerate && config.MCPPrompt == "" {
+		return modsError{
+			reason: "您没有提供任何提示输入。",
+			err:    newUserErrorf("--dry-run 统计给定提示的令牌数，例如 %s", stderrStyles().InlineCode.Render(`mods --dry-run "你好"`)),
+		}
+	}
+
+	api, mod, err := m.resolveModel(m.Config)
+	if err != nil {
+		return err
+	}
+	if api.Name == "" {
+		return modsError{
+			err:    newUserErrorf("请检查设置中的 apis"),
+			reason: fmt.Sprintf("API 端点 %s 未配置。", stderrStyles().InlineCode.Render(m.Config.API)),
+		}
+	}
+	if mod.MaxChars == 0 {
+		mod.MaxChars = config.MaxInputChars
+	}
+	if err := m.loadMCPContext(ctx); err != nil {
+		return err
+	}
+	if err := m.setupStreamContext(input, mod); err != nil {
+		return err
+	}
+	if err := m.addRAGContext(ctx); err != nil {
+		return err
+	}
+	tools, err := mcpTools(ctx)
+	if err != nil {
+		return err
+	}
+
+	messages, dropped := m.messages, 0
+	if !config.NoLimit {
+		messages, dropped, err = fitMessages(m.messages, mod)
+		if err != nil {
+			return modsError{err, "无法统计令牌数。"}
+		}
+	}
+	count, err := countTokens(mod, messages, tools)
+	if err != nil {
+		return modsError{err, "无法统计令牌数。"}
+	}
+	printDryRun(mod, len(messages), dropped, count)
+	return nil
+}
+
+// countTokens 按模型的词表统计请求的输入令牌数
+// mod: 模型配置
+// messages: 请求中的消息
+// tools: 请求中的工具定义
+// 返回：令牌数和错误信息
+func countTokens(mod Model, messages []proto.Message, tools map[string][]mcp.Tool) (tokenCount, error) {
+	t, err := tokenizerFor(mod)
+	if err != nil {
+		return tokenCount{}, err
+	}
+	count := tokenCount{Tokens: tokensPerReply, Encoding: t.encoding, Approx: t.approx}
+	for _, msg := range messages {
+		count.Tokens += t.messageTokens(msg)
+		if len(msg.Images) > 0 {
+			count.Approx = true
+		}
+	}
+
+	// 工具定义的编码方式因 API 而异，按 JSON 估算
+	if bts, err := json.Marshal(tools); err == nil && len(tools) > 0 {
+		count.Tokens += t.count(string(bts))
+		count.Approx = true
+	}
+	return count, nil
+}
+
+// printDryRun 输出 --dry-run 的统计结果
+func printDryRun(mod Model, messages, dropped int, count tokenCount) {
+	s := stdoutStyles()
+	tokens := fmt.Sprintf("%d", count.Tokens)
+	if count.Approx {
+		tokens = "约 " + tokens
+	}
+	lines := []string{
+		fmt.Sprintf("%s %s/%s", s.Comment.Render("模型:"), mod.API, mod.Name),
+		fmt.Sprintf("%s %d", s.Comment.Render("消息:"), messages),
+		fmt.Sprintf("%s %s %s", s.Comment.Render("输入令牌:"), tokens, s.Comment.Render("（"+count.Encoding+"）")),
+	}
+	if dropped > 0 {
+		lines = append(lines, fmt.Sprintf("%s %d", s.Comment.Render("超出输入上限而省略的历史消息:"), dropped))
+	}
+	if cost, ok := estimateCost(mod, proto.Usage{InputTokens: count.Tokens}); ok {
+		lines = append(lines, fmt.Sprintf("%s $%.4f %s", s.Comment.Render("预估费用:"), cost, s.Comment.Render("（仅输入）")))
+	}
+	fmt.Println(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountTokens(t *testing.T) {
+	messages := []proto.Message{{Role: proto.RoleUser, Content: "hello world"}}
+
+	t.Run("OpenAI 模型使用对应的词表", func(t *testing.T) {
+		count, err := countTokens(Model{API: "openai", Name: "gpt-4o"}, messages, nil)
+		require.NoError(t, err)
+		require.Equal(t, "o200k_base", count.Encoding)
+		require.False(t, count.Approx)
+		// 每条消息 3 + user 1 + hello world 2 + 回答开头 3
+		require.Equal(t, int64(9), count.Tokens)
+	})
+
+	t.Run("旧模型", func(t *testing.T) {
+		count, err := countTokens(Model{API: "openai", Name: "gpt-4-turbo"}, messages, nil)
+		require.NoError(t, err)
+		require.Equal(t, "cl100k_base", count.Encoding)
+	})
+
+	t.Run("其它模型为估算值", func(t *testing.T) {
+		count, err := countTokens(Model{API: "anthropic", Name: "claude-sonnet-4"}, messages, nil)
+		require.NoError(t, err)
+		require.True(t, count.Approx)
+		require.Equal(t, approxEncoding, count.Encoding)
+	})
+
+	t.Run("图片为估算值", func(t *testing.T) {
+		withImage := []proto.Message{{Role: proto.RoleUser, Content: "hello world", Images: []proto.Image{{}}}}
+		count, err := countTokens(Model{API: "openai", Name: "gpt-4o"}, withImage, nil)
+		require.NoError(t, err)
+		require.True(t, count.Approx)
+		require.Equal(t, int64(9+tokensPerImage), count.Tokens)
+	})
+}
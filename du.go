@@ -0,0 +1,161 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/mods/internal/cache"
+)
+
+// duTop 是 --du 列出的最大对话数
+const duTop = 10
+
+// diskUsage 是缓存目录的磁盘占用统计
+type diskUsage struct {
+	Database      int64        // 数据库文件，包括 WAL 等辅助文件
+	Conversations int64        // 对话缓存文件
+	Files         int          // 对话缓存文件数
+	Other         int64        // 缓存目录中的其它文件
+	Count         int          // 数据库中的对话数
+	Missing       int          // 缓存文件已经不存在的对话数
+	Orphans       int          // 数据库中没有记录的对话缓存文件数
+	OrphanSize    int64        // 没有记录的对话缓存文件的大小
+	Largest       []convoUsage // 最大的对话，从大到小排列
+}
+
+// convoUsage 是一个对话的缓存文件大小
+type convoUsage struct {
+	Conversation
+	Size int64
+}
+
+// total 返回缓存目录的总占用
+func (u diskUsage) total() int64 {
+	return u.Database + u.Conversations + u.Other
+}
+
+// collectDiskUsage 统计缓存目录的磁盘占用，并与数据库中的对话对照
+// dir: 缓存目录
+// conversations: 数据库中的对话
+// 返回：统计结果和错误信息
+func collectDiskUsage(dir string, conversations []Conversation) (diskUsage, error) {
+	var u diskUsage
+	convoDir := filepath.Join(dir, string(cache.ConversationCache))
+	sizes := map[string]int64{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		name := d.Name()
+		switch ext := filepath.Ext(name); {
+		case filepath.Dir(path) != convoDir:
+			u.Other += info.Size()
+		case strings.HasPrefix(name, "mods.db"):
+			u.Database += info.Size()
+		case ext == ".gob" || ext == ".json":
+			u.Conversations += info.Size()
+			u.Files++
+			sizes[strings.TrimSuffix(name, ext)] += info.Size()
+		default:
+			u.Other += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return u, fmt.Errorf("统计磁盘占用: %w", err)
+	}
+
+	u.Count = len(conversations)
+	for _, c := range conversations {
+		size, ok := sizes[c.ID]
+		if !ok {
+			u.Missing++
+			continue
+		}
+		delete(sizes, c.ID)
+		u.Largest = append(u.Largest, convoUsage{c, size})
+	}
+	for _, size := range sizes {
+		u.Orphans++
+		u.OrphanSize += size
+	}
+	slices.SortStableFunc(u.Largest, func(a, b convoUsage) int {
+		return cmp.Compare(b.Size, a.Size)
+	})
+	if len(u.Largest) > duTop {
+		u.Largest = u.Largest[:duTop]
+	}
+	return u, nil
+}
+
+// printDiskUsage 输出缓存和数据库的磁盘占用、对话数和最大的对话，作为清理的依据
+// 返回：错误信息
+func printDiskUsage() error {
+	conversations, err := db.List()
+	if err != nil {
+		return modsError{err, "无法列出保存的对话。"}
+	}
+	u, err := collectDiskUsage(config.CachePath, conversations)
+	if err != nil {
+		return modsError{err, "无法统计缓存目录。"}
+	}
+
+	styles := stdoutStyles()
+	row := func(name, size, note string) {
+		// 按显示宽度对齐中文名称
+		fmt.Printf("%s%10s  %s\n", lipgloss.NewStyle().Width(10).Render(name), size, styles.Comment.Render(note)) //nolint:mnd
+	}
+	row("数据库", formatBytes(u.Database), filepath.Join(config.CachePath, string(cache.ConversationCache), "mods.db"))
+	row("对话缓存", formatBytes(u.Conversations), fmt.Sprintf("%d 个文件", u.Files))
+	row("其它缓存", formatBytes(u.Other), "")
+	row("合计", formatBytes(u.total()), config.CachePath)
+	fmt.Println()
+	fmt.Printf("对话：%d 个", u.Count)
+	if u.Missing > 0 {
+		fmt.Printf("，其中 %d 个没有缓存文件", u.Missing)
+	}
+	fmt.Println()
+	if u.Orphans > 0 {
+		fmt.Printf("没有记录的缓存文件：%d 个（%s）\n", u.Orphans, formatBytes(u.OrphanSize))
+	}
+
+	if len(u.Largest) == 0 {
+		return nil
+	}
+	fmt.Printf("\n最大的 %d 个对话：\n", len(u.Largest))
+	for _, c := range u.Largest {
+		fmt.Printf(
+			"%s\t%s\t%s\t%s\n",
+			linkConversationID(styles.SHA1.Render(shortID(c.ID)), c.ID),
+			formatBytes(c.Size),
+			c.Title,
+			styles.Timeago.Render(formatTime(c.UpdatedAt)),
+		)
+	}
+	if !config.Quiet {
+		fmt.Fprintf(
+			os.Stderr,
+			"\n用 %s 删除对话，或用 %s 清理旧对话。\n",
+			stderrStyles().InlineCode.Render("--delete <id>"),
+			stderrStyles().InlineCode.Render("--delete-older-than <时长>"),
+		)
+	}
+	return nil
+}
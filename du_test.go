@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectDiskUsage(t *testing.T) {
+	dir := t.TempDir()
+	convoDir := filepath.Join(dir, "conversations")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "temp"), 0o700))
+	require.NoError(t, os.MkdirAll(convoDir, 0o700))
+	write := func(path string, size int) {
+		require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o600))
+	}
+	write(filepath.Join(convoDir, "mods.db"), 100)
+	write(filepath.Join(convoDir, "mods.db-wal"), 20)
+	write(filepath.Join(dir, "temp", "x.gob"), 5)
+
+	var conversations []Conversation
+	for i := range 12 {
+		id := fmt.Sprintf("%040d", i)
+		conversations = append(conversations, Conversation{ID: id, Title: fmt.Sprint(i)})
+		write(filepath.Join(convoDir, id+".gob"), 10+i)
+	}
+	write(filepath.Join(convoDir, fmt.Sprintf("%040d", 3)+".json"), 50)
+	write(filepath.Join(convoDir, "orphan.gob"), 7)
+	conversations = append(conversations, Conversation{ID: "missing"})
+
+	u, err := collectDiskUsage(dir, conversations)
+	require.NoError(t, err)
+
+	t.Run("按类型统计", func(t *testing.T) {
+		require.Equal(t, int64(120), u.Database)
+		require.Equal(t, 14, u.Files)
+		require.Equal(t, int64(5), u.Other)
+		require.Equal(t, u.Database+u.Conversations+u.Other, u.total())
+	})
+
+	t.Run("对照数据库", func(t *testing.T) {
+		require.Equal(t, 13, u.Count)
+		require.Equal(t, 1, u.Missing)
+		require.Equal(t, 1, u.Orphans)
+		require.Equal(t, int64(7), u.OrphanSize)
+	})
+
+	t.Run("最大的对话", func(t *testing.T) {
+		require.Len(t, u.Largest, duTop)
+		require.Equal(t, "3", u.Largest[0].Title)
+		require.Equal(t, int64(63), u.Largest[0].Size)
+		require.Equal(t, "11", u.Largest[1].Title)
+	})
+
+	t.Run("缓存目录不存在", func(t *testing.T) {
+		u, err := collectDiskUsage(filepath.Join(dir, "nope"), nil)
+		require.NoError(t, err)
+		require.Zero(t, u.total())
+	})
+}
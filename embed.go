@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/mods/internal/embeddings"
+)
+
+// 向量的输出格式
+const (
+	embedNDJSON = "ndjson"
+	embedJSON   = "json"
+)
+
+// defaultEmbedModels 是各提供方默认的向量模型
+var defaultEmbedModels = map[string]string{
+	"openai": "text-embedding-3-small",
+	"ollama": "nomic-embed-text",
+	"cohere": "embed-v4.0",
+}
+
+// embedding 是 --embed 输出的一条结果
+type embedding struct {
+	Source    string    `json:"source"`    // 文件路径，或标准输入中的行号
+	Text      string    `json:"text"`      // 原文
+	Embedding []float64 `json:"embedding"` // 向量
+}
+
+// runEmbed 为每个文件或标准输入的每一行请求向量，按 --embed-format 输出
+// ctx: 上下文
+// files: 文件列表，为空时从标准输入读取
+// 返回：错误信息
+func runEmbed(ctx context.Context, files []string) error {
+	format := cmp.Or(config.EmbedFormat, embedNDJSON)
+	if format != embedNDJSON && format != embedJSON {
+		return modsError{
+			err:    newUserErrorf("支持的格式：%s、%s", embedNDJSON, embedJSON),
+			reason: fmt.Sprintf("不支持的向量输出格式 %q。", format),
+		}
+	}
+
+	inputs, err := embedInputs(files)
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return modsError{
+			err:    newUserErrorf("例如：%s", stderrStyles().InlineCode.Render("cat docs.txt | mods --embed")),
+			reason: "没有需要向量的文本。",
+		}
+	}
+
+	client, model, err := embedClient(config.API, config.EmbedModel)
+	if err != nil {
+		return err
+	}
+	texts := make([]string, len(inputs))
+	for i, in := range inputs {
+		texts[i] = in.Text
+	}
+	vectors, err := client.Embed(ctx, model, texts)
+	if err != nil {
+		return modsError{err, fmt.Sprintf("无法通过 %s 获取向量。", config.API)}
+	}
+	for i := range inputs {
+		inputs[i].Embedding = vectors[i]
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	if format == embedJSON {
+		return enc.Encode(inputs) //nolint:wrapcheck
+	}
+	for _, in := range inputs {
+		if err := enc.Encode(in); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+	return nil
+}
+
+// embedInputs 读取需要向量的文本：每个文件是一段，标准输入的每个非空行是一段
+// files: 文件列表
+// 返回：文本列表和错误信息
+func embedInputs(files []string) ([]embedding, error) {
+	var inputs []embedding
+	for _, path := range files {
+		bts, err := readUserFile(path)
+		if err != nil {
+			return nil, modsError{err, fmt.Sprintf("无法读取 %s。", path)}
+		}
+		if text := strings.TrimSpace(string(bts)); text != "" {
+			inputs = append(inputs, embedding{Source: path, Text: text})
+		}
+	}
+	if len(files) > 0 || isInputTTY() {
+		return inputs, nil
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) //nolint:mnd
+	for n := 1; scanner.Scan(); n++ {
+		if text := strings.TrimSpace(scanner.Text()); text != "" {
+			inputs = append(inputs, embedding{Source: fmt.Sprintf("stdin:%d", n), Text: text})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, modsError{err, "无法读取标准输入。"}
+	}
+	return inputs, nil
+}
+
+// embedClient 创建向量客户端。openai、ollama 和 cohere 使用各自的 API，
+// 其它设置了 base-url 的 API 按 OpenAI 兼容处理
+// name: API 名称
+// model: 向量模型，为空时使用 API 默认的模型
+// 返回：客户端、向量模型和错误信息
+func embedClient(name, model string) (embeddings.Client, string, error) {
+	api, ok := findAPI(name)
+	if !ok {
+		return nil, "", modsError{
+			err:    newUserErrorf("使用 %s 选择 API", stderrStyles().InlineCode.Render("--api")),
+			reason: fmt.Sprintf("API 端点 %s 未配置。", stderrStyles().InlineCode.Render(name)),
+		}
+	}
+	if !embedSupported(api) {
+		return nil, "", modsError{
+			err:    newUserErrorf("支持 openai、ollama、cohere 和设置了 base-url 的 OpenAI 兼容 API"),
+			reason: fmt.Sprintf("%s 不支持向量。", api.Name),
+		}
+	}
+	model = cmp.Or(model, defaultEmbedModels[api.Name])
+	if model == "" {
+		return nil, "", modsError{
+			err:    newUserErrorf("使用 %s 指定向量模型", stderrStyles().InlineCode.Render("--embed-model")),
+			reason: fmt.Sprintf("%s 没有默认的向量模型。", api.Name),
+		}
+	}
+
+	cfg := embeddings.Config{BaseURL: api.BaseURL}
+	if config.HTTPProxy != "" {
+		proxyURL, err := url.Parse(config.HTTPProxy)
+		if err != nil {
+			return nil, "", modsError{err, "解析代理 URL 时出错。"}
+		}
+		cfg.HTTPClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	}
+	if api.SignCmd != "" || api.HMAC != nil {
+		signed, err := signRequests(cfg.HTTPClient, api)
+		if err != nil {
+			return nil, "", err
+		}
+		cfg.HTTPClient = signed
+	}
+
+	switch api.Name {
+	case "ollama":
+		client, err := embeddings.NewOllama(cfg)
+		if err != nil {
+			return nil, "", modsError{err, "无法创建 Ollama 客户端。"}
+		}
+		return client, model, nil
+	case "cohere":
+		src := apiKeySources["cohere"]
+		key, err := Mods{Styles: stderrStyles()}.ensureKey(api, src.env, src.docs)
+		if err != nil {
+			return nil, "", err
+		}
+		cfg.APIKey = key
+		return embeddings.NewCohere(cfg), model, nil
+	}
+	src := apiKeySources["openai"]
+	key, err := Mods{Styles: stderrStyles()}.ensureKey(api, src.env, src.docs)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg.APIKey = key
+	return embeddings.NewOpenAI(cfg), model, nil
+}
+
+// embedSupported 判断 API 是否支持向量：有专门客户端的 API，以及设置了 base-url 的 OpenAI 兼容 API
+func embedSupported(api API) bool {
+	switch api.Name {
+	case "openai", "ollama", "cohere":
+		return true
+	case "anthropic", "google", "vertex", "bedrock", "azure", "azure-ad":
+		return false
+	}
+	return api.BaseURL != ""
+}
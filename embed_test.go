@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbed(t *testing.T) {
+	t.Run("每个文件是一段", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Chdir(dir)
+		a := filepath.Join(dir, "a.md")
+		empty := filepath.Join(dir, "empty.md")
+		require.NoError(t, os.WriteFile(a, []byte("# 标题\n\n正文\n"), 0o600))
+		require.NoError(t, os.WriteFile(empty, []byte("\n"), 0o600))
+
+		inputs, err := embedInputs([]string{a, empty})
+		require.NoError(t, err)
+		require.Equal(t, []embedding{{Source: a, Text: "# 标题\n\n正文"}}, inputs)
+	})
+
+	t.Run("选择客户端", func(t *testing.T) {
+		oldConfig := config
+		t.Cleanup(func() { config = oldConfig })
+		config.APIs = APIs{
+			{Name: "ollama"},
+			{Name: "anthropic", BaseURL: "https://api.anthropic.com"},
+			{Name: "mygateway"},
+		}
+
+		_, model, err := embedClient("ollama", "")
+		require.NoError(t, err)
+		require.Equal(t, "nomic-embed-text", model)
+
+		_, _, err = embedClient("anthropic", "")
+		require.ErrorContains(t, err, "base-url")
+
+		_, _, err = embedClient("mygateway", "bge-m3")
+		require.ErrorContains(t, err, "base-url")
+	})
+}
@@ -5,21 +5,22 @@ import (
 	"regexp"
 )
 
-// examples 示例命令映射
-var examples = map[string]string{
-	"为 README 编写新章节": `cat README.md | mods "为此 README 编写一个新章节，记录 PDF 分享功能"`,
-	"编辑视频文件":         `ls ~/vids | mods -f "总结这些标题，按年代分组" | glow`,
-	"让 GPT 选择观看内容":   `ls ~/vids | mods "从此列表中挑选 5 部 80 年代的动作片" | gum choose | xargs vlc`,
+// helpExample 是帮助中的一个示例命令
+type helpExample struct {
+	Desc string // 示例说明
+	Cmd  string // 示例命令
+}
+
+// examples 是用法和手册页中的示例命令
+var examples = []helpExample{
+	{"为 README 编写新章节", `cat README.md | mods "为此 README 编写一个新章节，记录 PDF 分享功能"`},
+	{"编辑视频文件", `ls ~/vids | mods -f "总结这些标题，按年代分组" | glow`},
+	{"让 GPT 选择观看内容", `ls ~/vids | mods "从此列表中挑选 5 部 80 年代的动作片" | gum choose | xargs vlc`},
 }
 
 // randomExample 返回随机示例
-func randomExample() string {
-	keys := make([]string, 0, len(examples))
-	for k := range examples {
-		keys = append(keys, k)
-	}
-	desc := keys[rand.Intn(len(keys))] //nolint:gosec
-	return desc
+func randomExample() helpExample {
+	return examples[rand.Intn(len(examples))] //nolint:gosec
 }
 
 // cheapHighlighting 简单的语法高亮
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+)
+
+// execInstructions 要求模型只回复一条命令
+const execInstructions = "只回复一条可以在 %s（%s）中直接执行的命令，放在一个 ```sh 代码块中，不要解释。" +
+	"需要多个步骤时用 && 连接。"
+
+// execRetryPrompt 是命令失败后交给模型的提示
+const execRetryPrompt = "命令执行失败，退出码 %d，输出如下：\n\n```\n%s\n```\n\n请给出修正后的命令，同样只回复一条命令。"
+
+const (
+	maxExecRetries  = 3    // 命令失败后最多让模型重新生成的次数
+	execOutputLimit = 4096 // 交给模型的命令输出的最大字节数
+)
+
+// exitCodeError 表示命令以非零退出码结束，mods 以同样的退出码退出
+type exitCodeError struct {
+	code int
+}
+
+// Error 返回错误消息
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("命令以退出码 %d 结束", e.code)
+}
+
+// execShell 返回执行命令使用的 shell 及其参数
+func execShell() (string, []string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", []string{"/C"}
+	}
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return sh, []string{"-c"}
+	}
+	return "/bin/sh", []string{"-c"}
+}
+
+// prepareExec 检查 --exec 的参数，并要求模型只回复一条命令
+func prepareExec() error {
+	if strings.TrimSpace(config.Prefix) == "" {
+		return modsError{
+			newUserErrorf("请说明要做什么，例如 %s", stderrStyles().InlineCode.Render(`mods --exec "列出最大的 5 个文件"`)),
+			"--exec 需要提示。",
+		}
+	}
+	sh, _ := execShell()
+	config.Prefix = fmt.Sprintf("%s\n\n"+execInstructions, config.Prefix, filepath.Base(sh), runtime.GOOS)
+	return nil
+}
+
+// runExec 展示模型给出的命令，确认后执行；命令失败时可以把输出交给模型重试
+// ctx: 上下文
+// mods: 已完成请求的模型
+// opts: 重试时运行 Bubble Tea 程序的选项
+// 返回：错误信息，命令失败时为 exitCodeError
+func runExec(ctx context.Context, mods *Mods, opts []tea.ProgramOption) error {
+	for attempt := 0; ; attempt++ {
+		command, err := commandFromAnswer(mods.Output)
+		if err != nil {
+			return modsError{err, "无法执行模型的回答。"}
+		}
+		if err := confirmExec(command); err != nil {
+			return err
+		}
+
+		code, output, err := runCommand(ctx, command)
+		if err != nil {
+			return modsError{err, "无法执行命令。"}
+		}
+		if code == 0 {
+			return nil
+		}
+		if attempt >= maxExecRetries || !askExecRetry(code) {
+			return exitCodeError{code}
+		}
+
+		// 重试的提示不适合作为标题，沿用原来的标题
+		if mods.Config.cacheWriteToTitle == "" {
+			mods.Config.cacheWriteToTitle = firstLine(lastPrompt(mods.messages))
+		}
+		if err := sendFollowUp(mods, opts, fmt.Sprintf(execRetryPrompt, code, output)); err != nil {
+			return err
+		}
+		if mods.Config.cacheWriteToID != "" {
+			if err := saveConversation(mods); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// commandFromAnswer 从回答中取出命令：第一个代码块，或者去掉反引号后的整个回答
+func commandFromAnswer(answer string) (string, error) {
+	command := strings.TrimSpace(strings.Trim(strings.TrimSpace(answer), "`"))
+	if blocks := extractCodeBlocks(answer); len(blocks) > 0 {
+		command = strings.TrimSpace(blocks[0].Code)
+	}
+	command = strings.TrimPrefix(command, "$ ")
+	if command == "" {
+		return "", errors.New("回答中没有命令")
+	}
+	return command, nil
+}
+
+// confirmExec 在标准错误上展示命令并请用户确认
+func confirmExec(command string) error {
+	s := stderrStyles()
+	fmt.Fprintln(os.Stderr, "\n"+s.Pipe.Render("$ ")+s.AppName.Render(command)+"\n")
+	return confirmAction("执行这条命令？", "")
+}
+
+// askExecRetry 询问是否把失败的输出交给模型重新生成命令
+func askExecRetry(code int) bool {
+	if !canPrompt() {
+		return false
+	}
+	var retry bool
+	err := huh.Run(
+		huh.NewConfirm().
+			Title(fmt.Sprintf("命令以退出码 %d 结束，把输出交给模型重新生成命令？", code)).
+			Value(&retry),
+	)
+	return err == nil && retry
+}
+
+// runCommand 使用 shell 执行命令，标准输入输出连接到终端，同时保留输出的末尾
+// 返回：退出码、输出的末尾和错误信息（命令无法启动时）
+func runCommand(ctx context.Context, command string) (int, string, error) {
+	sh, args := execShell()
+	tail := &tailBuffer{limit: execOutputLimit}
+	cmd := exec.CommandContext(ctx, sh, append(args, command)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, tail)
+	cmd.Stderr = io.MultiWriter(os.Stderr, tail)
+	err := cmd.Run()
+	var eerr *exec.ExitError
+	if errors.As(err, &eerr) {
+		return eerr.ExitCode(), tail.String(), nil
+	}
+	if err != nil {
+		return 0, "", err //nolint:wrapcheck
+	}
+	return 0, tail.String(), nil
+}
+
+// tailBuffer 只保留最后 limit 字节的写入内容
+type tailBuffer struct {
+	limit int
+	buf   []byte
+}
+
+// Write 实现 io.Writer 接口
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.limit {
+		t.buf = t.buf[len(t.buf)-t.limit:]
+	}
+	return len(p), nil
+}
+
+// String 返回保留的内容
+func (t *tailBuffer) String() string {
+	return strings.ToValidUTF8(string(t.buf), "")
+}
+
+// followUpModel 在已有对话上发送一条新的提示
+type followUpModel struct {
+	*Mods
+	prompt string
+}
+
+// Init 实现 tea.Model 接口
+func (f followUpModel) Init() tea.Cmd {
+	return f.followUp(f.prompt)
+}
+
+// followUp 清空上一次的回答，在已有对话上发送新的提示
+func (m *Mods) followUp(prompt string) tea.Cmd {
+	m.followingUp = true
+	m.retries = 0
+	m.argsRetried = false
+	m.toolGuard = toolGuard{}
+	m.Config.Prefix = ""
+	m.Output, m.glamOutput = "", ""
+	m.state = requestState
+
+	cmds := []tea.Cmd{m.startCompletionCmd(prompt), m.requestProgress()}
+	if m.showAnim() {
+		m.anim = m.newStatusAnim()
+		cmds = append(cmds, m.anim.Init())
+	}
+	return tea.Batch(cmds...)
+}
+
+// sendFollowUp 在同一个对话中发送新的提示并等待回答
+// mods: 已完成请求的模型
+// opts: 运行 Bubble Tea 程序的选项
+// prompt: 新的提示
+// 返回：错误信息
+func sendFollowUp(mods *Mods, opts []tea.ProgramOption, prompt string) error {
+	if _, err := tea.NewProgram(followUpModel{mods, prompt}, opts...).Run(); err != nil {
+		return modsError{err, "无法启动 Bubble Tea 程序。"}
+	}
+	if mods.Error != nil {
+		return *mods.Error
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandFromAnswer(t *testing.T) {
+	t.Run("代码块", func(t *testing.T) {
+		cmd, err := commandFromAnswer("可以这样：\n\n```sh\nls -la | head\n```\n")
+		require.NoError(t, err)
+		require.Equal(t, "ls -la | head", cmd)
+	})
+
+	t.Run("行内代码", func(t *testing.T) {
+		cmd, err := commandFromAnswer("`du -sh .`")
+		require.NoError(t, err)
+		require.Equal(t, "du -sh .", cmd)
+	})
+
+	t.Run("去掉提示符", func(t *testing.T) {
+		cmd, err := commandFromAnswer("$ echo hi\n")
+		require.NoError(t, err)
+		require.Equal(t, "echo hi", cmd)
+	})
+
+	t.Run("没有命令", func(t *testing.T) {
+		_, err := commandFromAnswer("  \n")
+		require.Error(t, err)
+	})
+}
+
+func TestRunCommand(t *testing.T) {
+	if _, args := execShell(); args[0] != "-c" {
+		t.Skip("需要 POSIX shell")
+	}
+	t.Setenv("SHELL", "/bin/sh")
+
+	t.Run("退出码与输出", func(t *testing.T) {
+		code, output, err := runCommand(t.Context(), "echo oops >&2; exit 3")
+		require.NoError(t, err)
+		require.Equal(t, 3, code)
+		require.Equal(t, "oops\n", output)
+	})
+
+	t.Run("只保留输出的末尾", func(t *testing.T) {
+		tail := &tailBuffer{limit: 4}
+		_, _ = tail.Write([]byte(strings.Repeat("a", 10)))
+		_, _ = tail.Write([]byte("bc"))
+		require.Equal(t, "aabc", tail.String())
+	})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+const exportHTML = "html" // --export-format 支持的 HTML 格式
+
+// exportMessage 是导出页面中的一条消息
+type exportMessage struct {
+	Role    string        // 消息角色，用作 CSS 类名
+	Label   string        // 显示的角色名称
+	Content template.HTML // 渲染后的消息内容
+}
+
+// exportPage 是导出页面的数据
+type exportPage struct {
+	Title    string          // 页面标题
+	Date     string          // 对话时间
+	Back     string          // 返回链接，为空时不显示（导出文件中不需要）
+	Messages []exportMessage // 对话消息
+}
+
+// pageTemplates 包含自包含的 HTML 页面模板，样式全部内联，便于直接发送邮件或存档
+var pageTemplates = template.Must(template.New("style").Parse(`<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="generator" content="mods">
+<style>
+body { margin: 0; padding: 2rem 1rem; background: #f6f5fb; color: #2b2b38; font: 16px/1.6 -apple-system, BlinkMacSystemFont, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; }
+main { max-width: 52rem; margin: 0 auto; }
+header { margin-bottom: 1.5rem; }
+header h1 { margin: 0; font-size: 1.5rem; }
+header p { margin: .25rem 0 0; color: #8a8799; font-size: .875rem; }
+nav { margin-bottom: 1rem; font-size: .875rem; }
+a { color: #7d56f4; text-decoration: none; }
+a:hover { text-decoration: underline; }
+article { margin-bottom: 1rem; padding: 1rem 1.25rem; border-radius: .5rem; background: #fff; border-left: 4px solid #ccc; box-shadow: 0 1px 2px rgba(0,0,0,.06); }
+article.user { border-color: #00a67d; }
+article.assistant { border-color: #7d56f4; }
+article.system { border-color: #f7c948; background: #fffdf3; }
+article.tool { border-color: #8a8799; background: #fafafa; font-size: .9rem; }
+.role { margin-bottom: .5rem; font-size: .75rem; font-weight: 600; letter-spacing: .05em; text-transform: uppercase; color: #8a8799; }
+pre { overflow-x: auto; padding: .75rem 1rem; border-radius: .375rem; background: #1f1d2e; color: #e0def4; font-size: .875rem; }
+code { font-family: "SFMono-Regular", Menlo, Consolas, monospace; }
+:not(pre) > code { padding: .1em .3em; border-radius: .25rem; background: #eeecf7; color: #c0306b; }
+blockquote { margin: 0; padding-left: 1rem; border-left: 3px solid #ddd; color: #6b6880; }
+table { border-collapse: collapse; }
+th, td { padding: .35rem .75rem; border: 1px solid #ddd; }
+img { max-width: 100%; }
+</style>
+`))
+
+// exportTemplate 是单个对话的 HTML 页面
+var exportTemplate = template.Must(template.Must(pageTemplates.Clone()).New("export").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+{{template "style"}}<title>{{.Title}}</title>
+</head>
+<body>
+<main>
+{{if .Back}}<nav><a href="{{.Back}}">← 全部对话</a></nav>
+{{end}}<header>
+<h1>{{.Title}}</h1>
+<p>{{.Date}}</p>
+</header>
+{{range .Messages}}<article class="{{.Role}}">
+<div class="role">{{.Label}}</div>
+{{.Content}}</article>
+{{end}}</main>
+</body>
+</html>
+`))
+
+// validateExportFormat 检查 --export-format 的取值
+// format: 导出格式
+// 返回：错误信息
+func validateExportFormat(format string) error {
+	switch format {
+	case "", exportHTML:
+		return nil
+	default:
+		return modsError{
+			err:    newUserErrorf("支持的格式：%s", exportHTML),
+			reason: fmt.Sprintf("不支持的导出格式 %q。", format),
+		}
+	}
+}
+
+// exportTitle 返回导出页面使用的标题，与保存对话时的标题规则一致
+func (m *Mods) exportTitle() string {
+	if m.Config.Show != "" || m.Config.ShowLast {
+		if convo, err := m.db.Find(m.Config.cacheReadFromID); err == nil {
+			return convo.Title
+		}
+	}
+	title := strings.TrimSpace(m.Config.cacheWriteToTitle)
+	if sha1reg.MatchString(title) || title == "" {
+		title = firstLine(lastPrompt(m.messages))
+	}
+	return title
+}
+
+// exportConversation 将对话以指定格式写出
+// w: 输出目标
+// format: 导出格式
+// title: 对话标题
+// messages: 对话消息
+// 返回：错误信息
+func exportConversation(w io.Writer, format, title string, messages []proto.Message) error {
+	if format != exportHTML {
+		return fmt.Errorf("不支持的导出格式 %q", format)
+	}
+	if len(messages) == 0 {
+		return errors.New("没有可导出的对话")
+	}
+	out, err := renderHTML(title, time.Now(), messages)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, out)
+	return err //nolint:wrapcheck
+}
+
+// renderHTML 将对话渲染为自包含的 HTML 页面
+// title: 页面标题
+// date: 导出时间
+// messages: 对话消息
+// 返回：HTML 文本与错误信息
+func renderHTML(title string, date time.Time, messages []proto.Message) (string, error) {
+	return renderPage(title, date, "", messages)
+}
+
+// renderPage 将对话渲染为 HTML 页面，消息内容按 Markdown 渲染
+// title: 页面标题
+// date: 页面上显示的时间
+// back: 返回链接，为空时不显示
+// messages: 对话消息
+// 返回：HTML 文本与错误信息
+func renderPage(title string, date time.Time, back string, messages []proto.Message) (string, error) {
+	// goldmark 默认不输出原始 HTML，模型回答中的标签会被过滤
+	md := goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+	var items []exportMessage
+	for _, msg := range messages {
+		content := msg.Content
+		label := msg.Role
+		switch msg.Role {
+		case proto.RoleSystem:
+			label = "系统"
+		case proto.RoleUser:
+			label = "用户"
+		case proto.RoleAssistant:
+			label = "助手"
+		case proto.RoleTool:
+			label = "工具"
+			content = ""
+			for _, tool := range msg.ToolCalls {
+				s := proto.ToolCallStatus{Name: tool.Function.Name}
+				if tool.IsError {
+					s.Err = errors.New(msg.Content)
+				}
+				content += s.String()
+			}
+		}
+		if content == "" {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := md.Convert([]byte(content), &buf); err != nil {
+			return "", fmt.Errorf("无法渲染消息: %w", err)
+		}
+		items = append(items, exportMessage{
+			Role:    msg.Role,
+			Label:   label,
+			Content: template.HTML(buf.String()), //nolint:gosec
+		})
+	}
+
+	if title == "" {
+		title = "mods 对话"
+	}
+
+	var sb bytes.Buffer
+	if err := exportTemplate.Execute(&sb, exportPage{
+		Title:    title,
+		Date:     date.Format(time.DateTime),
+		Back:     back,
+		Messages: items,
+	}); err != nil {
+		return "", fmt.Errorf("无法生成 HTML: %w", err)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderHTML 测试将对话导出为 HTML
+func TestRenderHTML(t *testing.T) {
+	date := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	messages := []proto.Message{
+		{Role: proto.RoleSystem, Content: "你是助手"},
+		{Role: proto.RoleUser, Content: "列出 <b>文件</b>"},
+		{Role: proto.RoleAssistant, Content: "```sh\nls\n```"},
+		{Role: proto.RoleTool, Content: "权限不足", ToolCalls: []proto.ToolCall{
+			{Function: proto.Function{Name: "fs_list"}, IsError: true},
+		}},
+	}
+
+	t.Run("渲染消息", func(t *testing.T) {
+		out, err := renderHTML("标题 <x>", date, messages)
+		require.NoError(t, err)
+		require.Contains(t, out, "<title>标题 &lt;x&gt;</title>")
+		require.Contains(t, out, "2025-01-02 03:04:05")
+		require.Contains(t, out, `<article class="user">`)
+		require.Contains(t, out, `<code class="language-sh">ls`)
+		require.Contains(t, out, "<code>fs_list</code>")
+		require.NotContains(t, out, "<b>文件</b>")
+	})
+
+	t.Run("默认标题", func(t *testing.T) {
+		out, err := renderHTML("", date, messages)
+		require.NoError(t, err)
+		require.Contains(t, out, "<title>mods 对话</title>")
+	})
+}
+
+// TestValidateExportFormat 测试导出格式校验
+func TestValidateExportFormat(t *testing.T) {
+	require.NoError(t, validateExportFormat(""))
+	require.NoError(t, validateExportFormat("html"))
+	require.Error(t, validateExportFormat("pdf"))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+)
+
+// extractAll 是 --extract-code 不带语言时的取值，表示输出所有代码块
+const extractAll = "*"
+
+// codeLangAliases 将常见的语言别名映射到同一名称，
+// 这样 --extract-code sh 也能匹配 ```bash 代码块
+var codeLangAliases = map[string]string{
+	"bash":       "sh",
+	"shell":      "sh",
+	"zsh":        "sh",
+	"py":         "python",
+	"python3":    "python",
+	"js":         "javascript",
+	"ts":         "typescript",
+	"yml":        "yaml",
+	"golang":     "go",
+	"dockerfile": "docker",
+}
+
+// normalizeCodeLang 返回语言的规范名称，用于比较
+func normalizeCodeLang(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if alias, ok := codeLangAliases[lang]; ok {
+		return alias
+	}
+	return lang
+}
+
+// codeBlock 是 markdown 中的围栏代码块
+type codeBlock struct {
+	Lang string // 信息字符串中的语言
+	Code string // 代码内容，以换行结尾
+}
+
+// extractCodeBlocks 提取 markdown 文本中的围栏代码块（``` 或 ~~~），
+// 引用块中的代码块（如思考内容）不会被提取，未闭合的代码块保留到文本末尾
+// s: markdown 文本
+// 返回：代码块列表
+func extractCodeBlocks(s string) []codeBlock {
+	var blocks []codeBlock
+	var fence string
+	var current *codeBlock
+	for line := range strings.Lines(s) {
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) > 3 { //nolint:mnd
+			trimmed = ""
+		}
+		trimmed = strings.TrimRight(trimmed, "\r\n")
+
+		if current == nil {
+			if f := codeFence(trimmed); f != "" {
+				fence = f
+				lang, _, _ := strings.Cut(strings.TrimSpace(trimmed[len(f):]), " ")
+				current = &codeBlock{Lang: lang}
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" ") == "" {
+			blocks = append(blocks, *current)
+			current = nil
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		current.Code += line
+	}
+	if current != nil && current.Code != "" {
+		blocks = append(blocks, *current)
+	}
+	return blocks
+}
+
+// codeFence 返回行首的代码围栏，不是围栏时返回空字符串
+func codeFence(line string) string {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return ""
+	}
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+	if n < 3 { //nolint:mnd
+		return ""
+	}
+	// 反引号围栏的信息字符串中不能包含反引号
+	if line[0] == '`' && strings.Contains(line[n:], "`") {
+		return ""
+	}
+	return line[:n]
+}
+
+// extractCode 返回回答中的代码块，多个代码块之间以空行分隔
+// s: 回答内容
+// lang: 要保留的语言，为 extractAll 时保留所有代码块
+// 返回：代码块内容，没有匹配的代码块时为空字符串
+func extractCode(s, lang string) string {
+	want := normalizeCodeLang(lang)
+	var parts []string
+	for _, block := range extractCodeBlocks(s) {
+		if lang != extractAll && normalizeCodeLang(block.Lang) != want {
+			continue
+		}
+		parts = append(parts, block.Code)
+	}
+	return strings.Join(parts, "\n")
+}
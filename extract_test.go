@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractCode(t *testing.T) {
+	answer := "运行下面的命令：\n\n```bash\necho hi\n```\n\n然后：\n\n~~~python\nprint(1)\n~~~\n\n> 思考内容\n> ```sh\n> rm -rf /\n> ```\n"
+
+	t.Run("所有代码块", func(t *testing.T) {
+		require.Equal(t, "echo hi\n\nprint(1)\n", extractCode(answer, extractAll))
+	})
+
+	t.Run("按语言过滤", func(t *testing.T) {
+		require.Equal(t, "echo hi\n", extractCode(answer, "sh"))
+		require.Equal(t, "print(1)\n", extractCode(answer, "PY"))
+		require.Empty(t, extractCode(answer, "go"))
+	})
+
+	t.Run("没有代码块", func(t *testing.T) {
+		require.Empty(t, extractCode("只有文字", extractAll))
+	})
+
+	t.Run("嵌套围栏", func(t *testing.T) {
+		md := "````markdown\n```go\nfunc main() {}\n```\n````\n"
+		require.Equal(t, "```go\nfunc main() {}\n```\n", extractCode(md, "markdown"))
+	})
+
+	t.Run("未闭合的代码块", func(t *testing.T) {
+		require.Equal(t, "ls\n", extractCode("```sh\nls", extractAll))
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+// finetuneMessage 是 OpenAI 微调数据中的一条消息
+type finetuneMessage struct {
+	Role    string `json:"role"`    // system、user 或 assistant
+	Content string `json:"content"` // 消息内容
+}
+
+// finetuneExample 是 OpenAI 微调数据中的一行
+type finetuneExample struct {
+	Messages []finetuneMessage `json:"messages"` // 一个对话中的消息
+}
+
+// exportFinetune 把对话转换为 OpenAI 微调格式的 JSONL，每个对话一行
+// out: 输出文件，为 - 时写到标准输出
+// args: 要导出的对话 ID 或标题，为空时导出所有对话
+// 返回：错误信息
+func exportFinetune(out string, args []string) error {
+	convos, err := finetuneConversations(args, config.FinetuneTags)
+	if err != nil {
+		return err
+	}
+	if len(convos) == 0 {
+		return newUserErrorf("没有符合条件的对话。")
+	}
+
+	c, err := openConversations()
+	if err != nil {
+		return modsError{err, "无法打开对话缓存。"}
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "-" {
+		f, err := os.Create(out)
+		if err != nil {
+			return modsError{err, "无法创建导出文件。"}
+		}
+		defer f.Close() //nolint:errcheck
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+
+	var exported, skipped int
+	for _, convo := range convos {
+		var messages []proto.Message
+		if err := c.Read(convo.ID, &messages); err != nil {
+			return modsError{err, fmt.Sprintf("无法读取对话 %s。", shortID(convo.ID))}
+		}
+		example, ok := toFinetuneExample(messages)
+		if !ok {
+			skipped++
+			continue
+		}
+		line, err := json.Marshal(example)
+		if err != nil {
+			return modsError{err, "无法导出对话。"}
+		}
+		_, _ = bw.Write(append(line, '\n'))
+		exported++
+	}
+	if err := bw.Flush(); err != nil {
+		return modsError{err, "无法写入导出文件。"}
+	}
+
+	if !config.Quiet {
+		msg := fmt.Sprintf("已导出 %d 个对话", exported)
+		if skipped > 0 {
+			msg += fmt.Sprintf("，跳过了 %d 个没有完整问答的对话", skipped)
+		}
+		if out != "-" {
+			msg += "到 " + out
+		}
+		fmt.Fprintln(os.Stderr, msg+"。")
+	}
+	return nil
+}
+
+// finetuneConversations 返回要导出的对话：args 指定的对话，或者所有对话，再按标签筛选
+// args: 对话 ID 或标题
+// tags: 标签，对话有其中任意一个标签时导出，为空时不筛选
+// 返回：对话列表和错误信息
+func finetuneConversations(args, tags []string) ([]Conversation, error) {
+	var convos []Conversation
+	if len(args) == 0 {
+		all, err := db.List()
+		if err != nil {
+			return nil, modsError{err, "无法列出保存的对话。"}
+		}
+		convos = all
+	}
+	for _, in := range args {
+		convo, err := db.Find(in)
+		if err != nil {
+			return nil, modsError{err, "无法找到对话。"}
+		}
+		convos = append(convos, *convo)
+	}
+	if len(tags) == 0 {
+		return convos, nil
+	}
+	return slices.DeleteFunc(convos, func(convo Conversation) bool {
+		return !slices.ContainsFunc(conversationTags(convo), func(tag string) bool {
+			return slices.Contains(tags, tag)
+		})
+	}), nil
+}
+
+// toFinetuneExample 把对话消息转换为微调数据。工具调用和工具结果不会导出，
+// 结尾没有回答的提示也会去掉
+// messages: 对话消息
+// 返回：微调数据，没有完整的问答时返回 false
+func toFinetuneExample(messages []proto.Message) (finetuneExample, bool) {
+	var example finetuneExample
+	for _, msg := range messages {
+		content := strings.TrimSpace(msg.Content)
+		if content == "" {
+			continue
+		}
+		if msg.Role != proto.RoleSystem && msg.Role != proto.RoleUser && msg.Role != proto.RoleAssistant {
+			continue
+		}
+		example.Messages = append(example.Messages, finetuneMessage{msg.Role, content})
+	}
+	for len(example.Messages) > 0 && example.Messages[len(example.Messages)-1].Role != proto.RoleAssistant {
+		example.Messages = example.Messages[:len(example.Messages)-1]
+	}
+	hasUser := slices.ContainsFunc(example.Messages, func(msg finetuneMessage) bool {
+		return msg.Role == proto.RoleUser
+	})
+	return example, hasUser
+}
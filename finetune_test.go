@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/cache"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToFinetuneExample(t *testing.T) {
+	t.Run("去掉工具调用和没有回答的提示", func(t *testing.T) {
+		example, ok := toFinetuneExample([]proto.Message{
+			{Role: proto.RoleSystem, Content: "简短回答。"},
+			{Role: proto.RoleUser, Content: "天气怎么样？"},
+			{Role: proto.RoleAssistant, ToolCalls: []proto.ToolCall{{ID: "1"}}},
+			{Role: proto.RoleTool, Content: "晴"},
+			{Role: proto.RoleAssistant, Content: "晴天。\n"},
+			{Role: proto.RoleUser, Content: "明天呢？"},
+		})
+		require.True(t, ok)
+		require.Equal(t, []finetuneMessage{
+			{"system", "简短回答。"},
+			{"user", "天气怎么样？"},
+			{"assistant", "晴天。"},
+		}, example.Messages)
+	})
+
+	t.Run("没有完整的问答", func(t *testing.T) {
+		_, ok := toFinetuneExample([]proto.Message{{Role: proto.RoleUser, Content: "你好"}})
+		require.False(t, ok)
+		_, ok = toFinetuneExample([]proto.Message{
+			{Role: proto.RoleSystem, Content: "系统"},
+			{Role: proto.RoleAssistant, Content: "你好"},
+		})
+		require.False(t, ok)
+	})
+}
+
+func TestExportFinetune(t *testing.T) {
+	oldDB, oldConfig := db, config
+	t.Cleanup(func() { db, config = oldDB, oldConfig })
+	db = testDB(t)
+	config.CachePath = t.TempDir()
+	config.Quiet = true
+
+	c, err := cache.NewConversations(config.CachePath)
+	require.NoError(t, err)
+	save := func(title, role string, messages []proto.Message) string {
+		id := newConversationID()
+		require.NoError(t, c.Write(id, &messages))
+		require.NoError(t, db.Save(id, title, "openai", "gpt-4o"))
+		if role != "" {
+			require.NoError(t, db.SaveMeta(id, `{"role":"`+role+`"}`))
+		}
+		return id
+	}
+	shell := save("命令", "shell", []proto.Message{
+		{Role: proto.RoleUser, Content: "列出文件"},
+		{Role: proto.RoleAssistant, Content: "ls"},
+	})
+	save("闲聊", "", []proto.Message{
+		{Role: proto.RoleUser, Content: "你好"},
+		{Role: proto.RoleAssistant, Content: "你好！"},
+	})
+	save("失败", "", []proto.Message{{Role: proto.RoleUser, Content: "？"}})
+
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	read := func() []string {
+		bts, err := os.ReadFile(out)
+		require.NoError(t, err)
+		return strings.Split(strings.TrimSpace(string(bts)), "\n")
+	}
+
+	t.Run("所有对话", func(t *testing.T) {
+		require.NoError(t, exportFinetune(out, nil))
+		require.Len(t, read(), 2)
+	})
+
+	t.Run("指定的对话", func(t *testing.T) {
+		require.NoError(t, exportFinetune(out, []string{shortID(shell)}))
+		require.Equal(t, []string{`{"messages":[{"role":"user","content":"列出文件"},{"role":"assistant","content":"ls"}]}`}, read())
+	})
+
+	t.Run("按标签筛选", func(t *testing.T) {
+		config.FinetuneTags = []string{"shell"}
+		require.NoError(t, exportFinetune(out, nil))
+		require.Len(t, read(), 1)
+
+		config.FinetuneTags = []string{"translate"}
+		require.Error(t, exportFinetune(out, nil))
+	})
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -104,3 +106,149 @@ func (d *durationFlag) String() string {
 func (*durationFlag) Type() string {
 	return "duration"
 }
+
+// 大小单位
+const (
+	kilobyte byteSize = 1 << (10 * (iota + 1))
+	megabyte
+	gigabyte
+)
+
+// byteSizeUnits 是大小的单位，按从大到小排列
+var byteSizeUnits = []struct {
+	name string
+	size byteSize
+}{
+	{"GB", gigabyte},
+	{"MB", megabyte},
+	{"KB", kilobyte},
+	{"B", 1},
+}
+
+// byteSize 是以字节为单位的大小，可以写成 10MB、512KB 等，-1 表示不限制
+type byteSize int64
+
+// Set 设置标志值
+// s: 字符串值，如 10MB
+// 返回：错误信息
+func (b *byteSize) Set(s string) error {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for _, unit := range byteSizeUnits {
+		num, ok := strings.CutSuffix(s, unit.name)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+		if err != nil {
+			return fmt.Errorf("无效的大小 %q", s)
+		}
+		*b = byteSize(v * float64(unit.size))
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("无效的大小 %q，请使用 B、KB、MB 或 GB 作为单位", s)
+	}
+	*b = byteSize(v)
+	return nil
+}
+
+// String 返回字符串表示
+func (b byteSize) String() string {
+	for _, unit := range byteSizeUnits {
+		if b < unit.size {
+			continue
+		}
+		if b%unit.size == 0 {
+			return strconv.FormatInt(int64(b/unit.size), 10) + unit.name
+		}
+		return strconv.FormatFloat(float64(b)/float64(unit.size), 'f', 1, 64) + unit.name
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
+
+// Type 返回类型名称
+func (*byteSize) Type() string {
+	return "size"
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler 接口，用于设置文件和环境变量
+func (b *byteSize) UnmarshalText(text []byte) error {
+	return b.Set(string(text))
+}
+
+// timeoutDuration 是超时时间，可以写成 10m、90s 等，-1 表示不限制
+type timeoutDuration time.Duration
+
+// Set 设置标志值
+// s: 字符串值，如 10m 或 -1
+// 返回：错误信息
+func (d *timeoutDuration) Set(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "-1" {
+		*d = -1
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("无效的时间 %q，请写成 10m、90s 等，-1 表示不限制", s)
+	}
+	*d = timeoutDuration(v)
+	return nil
+}
+
+// String 返回字符串表示
+func (d timeoutDuration) String() string {
+	if d < 0 {
+		return "-1"
+	}
+	return time.Duration(d).String()
+}
+
+// Type 返回类型名称
+func (*timeoutDuration) Type() string {
+	return "duration"
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler 接口，用于设置文件和环境变量
+func (d *timeoutDuration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+// tokenRate 是每秒的令牌数，可以写成 40tps 或 40，0 表示不限制
+type tokenRate float64
+
+// Set 设置标志值
+// s: 字符串值，如 40tps
+// 返回：错误信息
+func (r *tokenRate) Set(s string) error {
+	num := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "tps")
+	if num == "" {
+		*r = 0
+		return nil
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("无效的速率 %q，请写成每秒的令牌数，例如 40tps", s)
+	}
+	*r = tokenRate(v)
+	return nil
+}
+
+// String 返回字符串表示
+func (r tokenRate) String() string {
+	if r == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(r), 'f', -1, 64) + "tps"
+}
+
+// Type 返回类型名称
+func (*tokenRate) Type() string {
+	return "rate"
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler 接口，用于设置文件和环境变量
+func (r *tokenRate) UnmarshalText(text []byte) error {
+	return r.Set(string(text))
+}
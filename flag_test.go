@@ -3,8 +3,10 @@ package main
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 // flagParseErrorTests 标志解析错误测试用例
@@ -56,3 +58,104 @@ func TestFlagParseError(t *testing.T) {
 		})
 	}
 }
+
+// TestByteSize 测试大小标志的解析与显示
+func TestByteSize(t *testing.T) {
+	for in, expected := range map[string]byteSize{
+		"10MB":   10 * megabyte,
+		"512kb":  512 * kilobyte,
+		"1.5 GB": gigabyte + gigabyte/2,
+		"100B":   100,
+		"2048":   2 * kilobyte,
+		"-1":     -1,
+	} {
+		t.Run(in, func(t *testing.T) {
+			var b byteSize
+			require.NoError(t, b.Set(in))
+			require.Equal(t, expected, b)
+		})
+	}
+
+	t.Run("无效的单位", func(t *testing.T) {
+		var b byteSize
+		require.Error(t, b.Set("10XB"))
+	})
+
+	t.Run("显示", func(t *testing.T) {
+		require.Equal(t, "10MB", (10 * megabyte).String())
+		require.Equal(t, "2.5KB", byteSize(2560).String())
+		require.Equal(t, "100B", byteSize(100).String())
+		require.Equal(t, "-1", byteSize(-1).String())
+	})
+
+	t.Run("设置文件", func(t *testing.T) {
+		var c struct {
+			Size byteSize `yaml:"size"`
+		}
+		require.NoError(t, yaml.Unmarshal([]byte("size: 2MB"), &c))
+		require.Equal(t, 2*megabyte, c.Size)
+	})
+}
+
+// TestTimeoutDuration 测试超时标志的解析与显示
+func TestTimeoutDuration(t *testing.T) {
+	for in, expected := range map[string]timeoutDuration{
+		"10m":  timeoutDuration(10 * time.Minute),
+		"90s":  timeoutDuration(90 * time.Second),
+		"-1":   -1,
+		" -1 ": -1,
+	} {
+		t.Run(in, func(t *testing.T) {
+			var d timeoutDuration
+			require.NoError(t, d.Set(in))
+			require.Equal(t, expected, d)
+		})
+	}
+
+	t.Run("无效的时间", func(t *testing.T) {
+		var d timeoutDuration
+		require.Error(t, d.Set("10"))
+	})
+
+	t.Run("显示", func(t *testing.T) {
+		require.Equal(t, "10m0s", timeoutDuration(10*time.Minute).String())
+		require.Equal(t, "-1", timeoutDuration(-1).String())
+	})
+
+	t.Run("设置文件", func(t *testing.T) {
+		var c struct {
+			Timeout timeoutDuration `yaml:"timeout"`
+		}
+		require.NoError(t, yaml.Unmarshal([]byte("timeout: -1"), &c))
+		require.Equal(t, timeoutDuration(-1), c.Timeout)
+		require.NoError(t, yaml.Unmarshal([]byte("timeout: 2m"), &c))
+		require.Equal(t, timeoutDuration(2*time.Minute), c.Timeout)
+	})
+}
+
+// TestTokenRate 测试速率标志的解析与显示
+func TestTokenRate(t *testing.T) {
+	for in, expected := range map[string]tokenRate{
+		"40tps": 40,
+		"12.5":  12.5,
+		"0":     0,
+		"":      0,
+	} {
+		t.Run(in, func(t *testing.T) {
+			var r tokenRate
+			require.NoError(t, r.Set(in))
+			require.Equal(t, expected, r)
+		})
+	}
+
+	t.Run("无效的速率", func(t *testing.T) {
+		var r tokenRate
+		require.Error(t, r.Set("fast"))
+		require.Error(t, r.Set("-5tps"))
+	})
+
+	t.Run("显示", func(t *testing.T) {
+		require.Equal(t, "40tps", tokenRate(40).String())
+		require.Empty(t, tokenRate(0).String())
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+// forkConversation 将对话复制到新的 ID，原对话保持不变
+// spec: 对话 ID 或标题，可以用 :N 只保留前 N 条消息（不含系统消息）
+// 返回：新对话的 ID、标题和错误信息
+func forkConversation(spec string) (string, string, error) {
+	in, keep, err := parseForkSpec(spec)
+	if err != nil {
+		return "", "", modsError{err, "无效的 --fork 参数。"}
+	}
+	convo, err := db.Find(in)
+	if err != nil {
+		return "", "", modsError{err, "无法找到对话。"}
+	}
+
+	c, err := openConversations()
+	if err != nil {
+		return "", "", modsError{err, "无法打开对话缓存。"}
+	}
+	var messages []proto.Message
+	if err := c.Read(convo.ID, &messages); err != nil {
+		return "", "", modsError{err, "无法读取对话。"}
+	}
+	if keep > 0 {
+		messages, err = truncateMessages(messages, keep)
+		if err != nil {
+			return "", "", modsError{err, "无效的 --fork 参数。"}
+		}
+	}
+
+	id := newConversationID()
+	title := strings.TrimSpace(config.Title)
+	if title == "" {
+		title = convo.Title + " (分支)"
+	}
+	var api, model string
+	if convo.API != nil && convo.Model != nil {
+		api, model = *convo.API, *convo.Model
+	}
+	if err := c.Write(id, &messages); err != nil {
+		return "", "", modsError{err, "无法写入对话缓存。"}
+	}
+	if err := db.Save(id, title, api, model); err != nil {
+		_ = c.Delete(id)
+		return "", "", modsError{err, "无法保存对话。"}
+	}
+	if convo.Meta != nil {
+		if err := db.SaveMeta(id, *convo.Meta); err != nil {
+			return "", "", modsError{err, "无法保存对话。"}
+		}
+	}
+	return id, title, nil
+}
+
+// parseForkSpec 解析 --fork 参数
+// spec: 形如 <id>、<标题> 或 <id>:N
+// 返回：对话 ID 或标题、要保留的消息数（0 表示全部保留）和错误信息
+func parseForkSpec(spec string) (string, int, error) {
+	i := strings.LastIndex(spec, ":")
+	if i < 0 {
+		return spec, 0, nil
+	}
+	n, err := strconv.Atoi(spec[i+1:])
+	if err != nil {
+		// 标题中可能包含冒号
+		return spec, 0, nil //nolint:nilerr
+	}
+	if n < 1 {
+		return "", 0, fmt.Errorf("消息数必须大于 0: %d", n)
+	}
+	return spec[:i], n, nil
+}
+
+// truncateMessages 只保留前 n 条消息，系统消息不计入且总是保留
+// 截断后末尾的工具调用没有结果时一并删除，避免 API 拒绝请求
+// messages: 消息列表
+// n: 要保留的消息数
+// 返回：截断后的消息列表和错误信息
+func truncateMessages(messages []proto.Message, n int) ([]proto.Message, error) {
+	var result []proto.Message
+	count := 0
+	for _, msg := range messages {
+		if msg.Role != proto.RoleSystem {
+			if count == n {
+				break
+			}
+			count++
+		}
+		result = append(result, msg)
+	}
+	if count < n {
+		return nil, fmt.Errorf("对话只有 %d 条消息", count)
+	}
+	for len(result) > 0 {
+		last := result[len(result)-1]
+		if last.Role != proto.RoleAssistant || len(last.ToolCalls) == 0 {
+			break
+		}
+		result = result[:len(result)-1]
+	}
+	if len(result) == 0 {
+		return nil, errors.New("截断后没有剩余消息")
+	}
+	return result, nil
+}
+
+// printFork 输出新建的分支，之后可以用 --continue 继续
+func printFork(id, title string) {
+	fmt.Printf("%s\t%s\n", stdoutStyles().SHA1.Render(shortID(id)), title)
+	if !config.Quiet {
+		fmt.Fprintf(
+			os.Stderr,
+			"\n已创建分支。使用 %s 继续。\n",
+			stderrStyles().InlineCode.Render("mods --continue "+shortID(id)),
+		)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForkSpec(t *testing.T) {
+	for spec, want := range map[string]struct {
+		in   string
+		keep int
+	}{
+		"abc123":       {"abc123", 0},
+		"abc123:4":     {"abc123", 4},
+		"标题: 副标题":      {"标题: 副标题", 0},
+		"标题: 副标题:2":    {"标题: 副标题", 2},
+		"abc123:":      {"abc123:", 0},
+		"abc123:other": {"abc123:other", 0},
+	} {
+		t.Run(spec, func(t *testing.T) {
+			in, keep, err := parseForkSpec(spec)
+			require.NoError(t, err)
+			require.Equal(t, want.in, in)
+			require.Equal(t, want.keep, keep)
+		})
+	}
+
+	t.Run("无效的消息数", func(t *testing.T) {
+		_, _, err := parseForkSpec("abc123:0")
+		require.Error(t, err)
+	})
+}
+
+func TestTruncateMessages(t *testing.T) {
+	messages := []proto.Message{
+		{Role: proto.RoleSystem, Content: "system"},
+		{Role: proto.RoleUser, Content: "first"},
+		{Role: proto.RoleAssistant, ToolCalls: []proto.ToolCall{{ID: "1"}}},
+		{Role: proto.RoleTool, Content: "result", ToolCalls: []proto.ToolCall{{ID: "1"}}},
+		{Role: proto.RoleAssistant, Content: "answer"},
+		{Role: proto.RoleUser, Content: "second"},
+	}
+
+	t.Run("保留系统消息", func(t *testing.T) {
+		got, err := truncateMessages(messages, 1)
+		require.NoError(t, err)
+		require.Equal(t, messages[:2], got)
+	})
+
+	t.Run("删除没有结果的工具调用", func(t *testing.T) {
+		got, err := truncateMessages(messages, 2)
+		require.NoError(t, err)
+		require.Equal(t, messages[:2], got)
+	})
+
+	t.Run("全部", func(t *testing.T) {
+		got, err := truncateMessages(messages, 5)
+		require.NoError(t, err)
+		require.Equal(t, messages, got)
+	})
+
+	t.Run("超出消息数", func(t *testing.T) {
+		_, err := truncateMessages(messages, 6)
+		require.Error(t, err)
+	})
+}
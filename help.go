@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/muesli/roff"
+	"github.com/muesli/termenv"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// helpGroup 是帮助中的一组标志
+type helpGroup struct {
+	Title string   // 分组标题
+	Flags []string // 组内的标志名称，按显示顺序排列
+}
+
+// helpGroups 决定标志在用法和手册页中的分组与顺序。没有归入任何分组的标志
+// 显示在最后的“其他”分组中
+var helpGroups = []helpGroup{
+	{"模型与 API", []string{
+		"model", "ask-model", "api", "http-proxy", "role", "list-roles", "attach",
+		"max-tokens", "temp", "stop", "topp", "topk", "search-domains", "search-recency",
+		"safe-prompt", "keep-alive", "num-gpu", "num-thread", "repeat-penalty", "mirostat",
+		"prompt-cache",
+	}},
+	{"输入", []string{
+		"prompt", "prompt-args", "stdin-head", "stdin-tail", "editor", "no-rules",
+	}},
+	{"输出与格式", []string{
+		"format", "format-as", "raw", "quiet", "no-guess-lang", "no-hyperlinks", "word-wrap",
+		"theme", "fanciness", "status-text", "plain-progress", "tty-progress",
+		"show-reasoning", "hide-reasoning", "extract-code", "apply", "exec", "csv", "no-outputs",
+	}},
+	{"对话", []string{
+		"continue", "continue-last", "chat", "title", "list", "list-json", "show", "show-last",
+		"meta", "delete", "delete-older-than", "fork", "regenerate", "undo", "archive-to-notes",
+		"export-format", "redact", "encrypt", "import", "export-finetune", "finetune-tag",
+		"convert-cache", "no-cache", "time-format",
+	}},
+	{"批量与比较", []string{
+		"map", "map-delimiter", "map-format", "map-workers", "compare", "compare-layout",
+		"samples", "n", "pick", "judge", "keep-all", "critic", "critic-retries",
+	}},
+	{"请求与重试", []string{
+		"max-retries", "retry-budget", "retry-max-wait", "timeout", "no-limit",
+		"compaction-model", "max-request-size", "throttle", "dry-run", "save-request",
+		"replay-request", "flush-keys",
+	}},
+	{"工具与 MCP", []string{
+		"tool-approval", "allow-outside-cwd", "tool-output-only", "max-tool-rounds",
+		"max-tool-result", "show-tool-log", "pack", "mcp-list", "mcp-list-tools",
+		"mcp-list-resources", "mcp-list-prompts", "mcp-resource", "mcp-prompt",
+		"mcp-prompt-arg", "mcp-login", "mcp-disable",
+	}},
+	{"嵌入与检索", []string{
+		"embed", "embed-model", "embed-format", "index", "rag", "rag-top-k",
+	}},
+	{"后台任务与网页界面", []string{
+		"detach", "jobs", "attach-job", "ui", "ui-addr",
+	}},
+	{"设置", []string{
+		"settings", "tui", "reset-settings", "dirs", "du", "no-deprecation-warnings",
+		"yes", "no-input", "help", "version",
+	}},
+}
+
+// otherHelpGroup 是没有归入分组的标志所在的分组标题
+const otherHelpGroup = "其他"
+
+// helpFlag 是帮助中的一个标志
+type helpFlag struct {
+	Name      string // 标志名称（不含 --）
+	Shorthand string // 短名称，可以为空
+	Desc      string // 说明，不带样式
+}
+
+// helpSection 是帮助中一个分组的标志
+type helpSection struct {
+	Title string
+	Flags []helpFlag
+}
+
+// helpPage 汇总了用法、手册页和补全说明共用的帮助信息
+type helpPage struct {
+	Sections     []helpSection // 按分组排列的可见标志
+	Deprecations []deprecation // 已弃用的标志与配置字段
+	Examples     []helpExample // 示例命令
+}
+
+// newHelpPage 按 helpGroups 整理标志。隐藏的标志不会出现，
+// 已弃用的标志只出现在弃用信息中
+// flags: 命令的标志
+func newHelpPage(flags *flag.FlagSet) helpPage {
+	page := helpPage{
+		Deprecations: deprecations,
+		Examples:     examples,
+	}
+	grouped := map[string]bool{}
+	for _, g := range helpGroups {
+		section := helpSection{Title: g.Title}
+		for _, name := range g.Flags {
+			grouped[name] = true
+			if f := flags.Lookup(name); f != nil && !f.Hidden {
+				section.Flags = append(section.Flags, newHelpFlag(f))
+			}
+		}
+		if len(section.Flags) > 0 {
+			page.Sections = append(page.Sections, section)
+		}
+	}
+
+	other := helpSection{Title: otherHelpGroup}
+	flags.VisitAll(func(f *flag.Flag) {
+		if !f.Hidden && !grouped[f.Name] {
+			other.Flags = append(other.Flags, newHelpFlag(f))
+		}
+	})
+	if len(other.Flags) > 0 {
+		page.Sections = append(page.Sections, other)
+	}
+	return page
+}
+
+// newHelpFlag 从标志生成帮助信息，标志的说明也是补全时显示的描述
+func newHelpFlag(f *flag.Flag) helpFlag {
+	return helpFlag{
+		Name:      f.Name,
+		Shorthand: f.Shorthand,
+		Desc:      f.Usage,
+	}
+}
+
+// useLine 返回使用行文本
+func useLine() string {
+	appName := filepath.Base(os.Args[0])
+
+	if stdoutRenderer().ColorProfile() == termenv.TrueColor {
+		appName = makeGradientText(stdoutStyles().AppName, appName)
+	}
+
+	return fmt.Sprintf(
+		"%s %s",
+		appName,
+		stdoutStyles().CliArgs.Render("[选项] [前缀 词项]"),
+	)
+}
+
+// usageFunc 按分组输出用法和一个随机示例
+func usageFunc(cmd *cobra.Command) error {
+	page := newHelpPage(cmd.Flags())
+	fmt.Printf(
+		"用法:\n  %s\n",
+		useLine(),
+	)
+	for _, section := range page.Sections {
+		fmt.Printf("\n%s:\n", section.Title)
+		for _, f := range section.Flags {
+			if f.Shorthand == "" {
+				fmt.Printf(
+					"  %-44s %s\n",
+					stdoutStyles().Flag.Render("--"+f.Name),
+					stdoutStyles().FlagDesc.Render(f.Desc),
+				)
+			} else {
+				fmt.Printf(
+					"  %s%s %-40s %s\n",
+					stdoutStyles().Flag.Render("-"+f.Shorthand),
+					stdoutStyles().FlagComma,
+					stdoutStyles().Flag.Render("--"+f.Name),
+					stdoutStyles().FlagDesc.Render(f.Desc),
+				)
+			}
+		}
+	}
+	if len(page.Examples) > 0 {
+		example := randomExample()
+		fmt.Printf(
+			"\n示例:\n  %s\n  %s\n",
+			stdoutStyles().Comment.Render("# "+example.Desc),
+			cheapHighlighting(stdoutStyles(), example.Cmd),
+		)
+	}
+
+	return nil
+}
+
+// buildManPage 生成手册页，内容与用法一致，另外列出所有示例和弃用信息
+// cmd: 根命令
+// 返回：roff 格式的手册页
+func buildManPage(cmd *cobra.Command) string {
+	page := newHelpPage(cmd.Flags())
+	w := roff.NewDocument()
+	w.Heading(1, cmd.Name(), cmd.Short, time.Now())
+
+	w.Section("Name")
+	w.Text(cmd.Name() + " - " + cmd.Short)
+
+	w.Section("Synopsis")
+	w.TextBold(cmd.Name())
+	w.Text(" [")
+	w.TextItalic("选项")
+	w.Text("] [")
+	w.TextItalic("前缀 词项")
+	w.Text("]")
+
+	w.Section("Options")
+	for _, section := range page.Sections {
+		w.Paragraph()
+		w.TextBold(section.Title)
+		for _, f := range section.Flags {
+			w.TaggedParagraph(-1)
+			if f.Shorthand == "" {
+				w.TextBold("--" + f.Name)
+			} else {
+				w.TextBold("-" + f.Shorthand + ", --" + f.Name)
+			}
+			w.EndSection()
+			w.Text(strings.ReplaceAll(f.Desc, "\n", " "))
+		}
+	}
+
+	if len(page.Deprecations) > 0 {
+		w.Section("Deprecated")
+		for _, d := range page.Deprecations {
+			w.TaggedParagraph(-1)
+			w.TextBold(d.id())
+			w.EndSection()
+			w.Text(d.describe(func(s string) string { return s }))
+		}
+	}
+
+	if len(page.Examples) > 0 {
+		w.Section("Examples")
+		for i, example := range page.Examples {
+			if i > 0 {
+				w.Paragraph()
+			}
+			w.Text(example.Desc + "：")
+			w.Indent(4)
+			w.TextBold(example.Cmd)
+			w.EndSection()
+			w.IndentEnd()
+		}
+	}
+	return w.String()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelpGroups(t *testing.T) {
+	seen := map[string]string{}
+	for _, g := range helpGroups {
+		for _, name := range g.Flags {
+			require.Empty(t, seen[name], "标志 %s 同时属于 %s 和 %s", name, seen[name], g.Title)
+			seen[name] = g.Title
+		}
+	}
+}
+
+func TestHelpPage(t *testing.T) {
+	oldGroups, oldDeprecations := helpGroups, deprecations
+	t.Cleanup(func() { helpGroups, deprecations = oldGroups, oldDeprecations })
+	helpGroups = []helpGroup{
+		{"模型", []string{"model", "missing"}},
+		{"空分组", []string{"missing"}},
+	}
+	deprecations = []deprecation{{Flag: "old", Replacement: "--model", RemovedIn: "v2"}}
+
+	cmd := &cobra.Command{Use: "mods", Short: "命令行上的 GPT。"}
+	flags := cmd.Flags()
+	flags.StringP("model", "m", "", "默认模型")
+	flags.Bool("extra", false, "没有分组的标志")
+	flags.Bool("old", false, "旧的标志")
+	flags.Bool("secret", false, "隐藏的标志")
+	_ = flags.MarkHidden("secret")
+	hideDeprecatedFlags(flags)
+
+	t.Run("分组", func(t *testing.T) {
+		page := newHelpPage(flags)
+		require.Equal(t, []helpSection{
+			{Title: "模型", Flags: []helpFlag{{Name: "model", Shorthand: "m", Desc: "默认模型"}}},
+			{Title: otherHelpGroup, Flags: []helpFlag{{Name: "extra", Desc: "没有分组的标志"}}},
+		}, page.Sections)
+		require.Equal(t, examples, page.Examples)
+	})
+
+	t.Run("手册页", func(t *testing.T) {
+		man := buildManPage(cmd)
+		require.NotContains(t, man, "\x1b")
+		require.Contains(t, man, `\fB模型\fP`)
+		require.Contains(t, man, `\fB-m, --model\fP`)
+		require.Contains(t, man, "没有分组的标志")
+		require.NotContains(t, man, "隐藏的标志")
+		require.NotContains(t, man, "旧的标志")
+		require.Contains(t, man, "标志 --old 已弃用，将在 v2 中移除，请改用 --model。")
+		for _, example := range examples {
+			require.Contains(t, man, example.Desc)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/muesli/termenv"
+)
+
+// conversationLinkPrefix 是对话 ID 超链接的前缀，支持自定义 URL 处理程序的终端可以把它交给 mods -s <id>
+const conversationLinkPrefix = "mods://show/"
+
+// urlRe 匹配消息中的裸链接，与 glamour 的自动链接一样只包含 ASCII 字符
+var urlRe = regexp.MustCompile("https?://[^\\s<>()\\[\\]{}\"'`[:^ascii:]]+")
+
+// urlTrailingPunct 是 URL 末尾不算作链接的标点
+const urlTrailingPunct = ".,;:!?*_~"
+
+// hyperlinksEnabled 判断是否输出 OSC8 终端超链接。只在标准输出是终端时输出，避免转义序列混入管道
+func hyperlinksEnabled() bool {
+	return !config.NoHyperlinks && isOutputTTY()
+}
+
+// linkConversationID 把对话 ID 渲染为指向 mods://show/<id> 的终端超链接，鼠标悬停时可以看到完整的 ID
+// text: 显示的文本，通常是渲染后的短 ID
+// id: 完整的对话 ID
+func linkConversationID(text, id string) string {
+	if !hyperlinksEnabled() {
+		return text
+	}
+	return termenv.Hyperlink(conversationLinkPrefix+id, text)
+}
+
+// findURLs 返回 markdown 中出现的 URL，去掉末尾的标点，较长的排在前面
+func findURLs(s string) []string {
+	var urls []string
+	for _, u := range urlRe.FindAllString(s, -1) {
+		u = strings.TrimRight(u, urlTrailingPunct)
+		if len(u) > len("https://") && !slices.Contains(urls, u) {
+			urls = append(urls, u)
+		}
+	}
+	slices.SortStableFunc(urls, func(a, b string) int { return len(b) - len(a) })
+	return urls
+}
+
+// linkURLs 把 glamour 渲染结果中出现的 URL 包装为 OSC8 终端超链接。
+// URL 被自动换行拆到多行时，每一段分别链接到完整的 URL
+// rendered: glamour 渲染后的文本
+// urls: 渲染前的 markdown 中的 URL
+// 返回：带超链接的文本
+func linkURLs(rendered string, urls []string) string {
+	if len(urls) == 0 {
+		return rendered
+	}
+
+	// 去掉转义序列，记录每个可见字节在渲染结果中的位置
+	visible := make([]byte, 0, len(rendered))
+	pos := make([]int, 0, len(rendered))
+	for i := 0; i < len(rendered); {
+		if rendered[i] == '\x1b' {
+			i = skipEscape(rendered, i)
+			continue
+		}
+		visible = append(visible, rendered[i])
+		pos = append(pos, i)
+		i++
+	}
+
+	type link struct {
+		start, end int    // 在渲染结果中的位置
+		url        string // 链接目标
+	}
+	var links []link
+	taken := make([]bool, len(visible))
+	for _, u := range urls {
+		for from := 0; ; {
+			i := strings.Index(string(visible[from:]), u[:len("http")])
+			if i < 0 {
+				break
+			}
+			start := from + i
+			from = start + 1
+			segments, ok := matchWrapped(visible, start, u)
+			if !ok || slices.ContainsFunc(segments, func(s [2]int) bool { return slices.Contains(taken[s[0]:s[1]], true) }) {
+				continue
+			}
+			for _, s := range segments {
+				for j := s[0]; j < s[1]; j++ {
+					taken[j] = true
+				}
+				links = append(links, link{pos[s[0]], pos[s[1]-1] + 1, u})
+			}
+			from = segments[len(segments)-1][1]
+		}
+	}
+	if len(links) == 0 {
+		return rendered
+	}
+
+	slices.SortFunc(links, func(a, b link) int { return a.start - b.start })
+	var sb strings.Builder
+	last := 0
+	for _, l := range links {
+		sb.WriteString(rendered[last:l.start])
+		sb.WriteString(termenv.Hyperlink(l.url, rendered[l.start:l.end]))
+		last = l.end
+	}
+	sb.WriteString(rendered[last:])
+	return sb.String()
+}
+
+// matchWrapped 检查可见文本从 start 开始是否是 url，允许 url 中间有自动换行（行尾空格、换行和缩进）
+// 返回：url 在每一行中的区间和是否匹配
+func matchWrapped(visible []byte, start int, url string) ([][2]int, bool) {
+	if start > 0 && isURLByte(visible[start-1]) {
+		return nil, false
+	}
+	var segments [][2]int
+	segStart, j := start, start
+	for k := 0; k < len(url); {
+		if j < len(visible) && visible[j] == url[k] {
+			j++
+			k++
+			continue
+		}
+		// 跳过自动换行产生的行尾空格、换行和下一行的缩进
+		next := j
+		for next < len(visible) && visible[next] == ' ' {
+			next++
+		}
+		if k == 0 || j == segStart || next >= len(visible) || visible[next] != '\n' {
+			return nil, false
+		}
+		next++
+		for next < len(visible) && visible[next] == ' ' {
+			next++
+		}
+		segments = append(segments, [2]int{segStart, j})
+		segStart, j = next, next
+	}
+	if j < len(visible) && isURLByte(visible[j]) && !strings.ContainsRune(urlTrailingPunct, rune(visible[j])) {
+		return nil, false
+	}
+	return append(segments, [2]int{segStart, j}), true
+}
+
+// isURLByte 判断字节是否可能是 URL 的一部分
+func isURLByte(b byte) bool {
+	return b > ' ' && b < 0x7f && !strings.ContainsRune("<>()[]{}\"'`", rune(b))
+}
+
+// skipEscape 跳过从 i 开始的转义序列（CSI 或 OSC）
+// 返回：转义序列之后的位置
+func skipEscape(s string, i int) int {
+	if i+1 >= len(s) {
+		return len(s)
+	}
+	switch s[i+1] {
+	case '[':
+		for j := i + 2; j < len(s); j++ {
+			if s[j] >= 0x40 && s[j] <= 0x7e {
+				return j + 1
+			}
+		}
+		return len(s)
+	case ']':
+		for j := i + 2; j < len(s); j++ {
+			if s[j] == '\a' {
+				return j + 1
+			}
+			if s[j] == '\x1b' && j+1 < len(s) && s[j+1] == '\\' {
+				return j + 2
+			}
+		}
+		return len(s)
+	}
+	return i + 2
+}
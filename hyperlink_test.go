@@ -0,0 +1,46 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/muesli/termenv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindURLs(t *testing.T) {
+	require.Equal(t, []string{
+		"https://example.com/a?b=1",
+		"https://pkg.go.dev",
+		"http://go.dev",
+	}, findURLs("见 http://go.dev。还有 https://example.com/a?b=1, [文档](https://pkg.go.dev) 和 <https://pkg.go.dev>."))
+	require.Empty(t, findURLs("没有链接 https://"))
+}
+
+func TestLinkURLs(t *testing.T) {
+	const long = "https://example.com/a/very/long/path/that/wraps?x=1&y=2"
+	md := "看看 " + long + " 和 https://go.dev。\n\n其它文字 https://go.dev/doc\n"
+	r, err := glamour.NewTermRenderer(glamour.WithStandardStyle("dark"), glamour.WithWordWrap(40))
+	require.NoError(t, err)
+	rendered, err := r.Render(md)
+	require.NoError(t, err)
+
+	out := linkURLs(rendered, findURLs(md))
+	require.Equal(t, rendered, regexp.MustCompile("\x1b]8;;[^\x1b]*\x1b\\\\").ReplaceAllString(out, ""))
+
+	t.Run("换行的链接每一段都指向完整的 URL", func(t *testing.T) {
+		require.Equal(t, 2, strings.Count(out, "\x1b]8;;"+long+"\x1b\\"), out)
+	})
+
+	t.Run("标点不算作链接", func(t *testing.T) {
+		require.Contains(t, out, termenv.Hyperlink("https://go.dev", "https://go.dev"))
+		require.Contains(t, out, "\x1b]8;;https://go.dev/doc\x1b\\")
+	})
+
+	t.Run("没有链接时保持原样", func(t *testing.T) {
+		require.Equal(t, rendered, linkURLs(rendered, nil))
+		require.Equal(t, rendered, linkURLs(rendered, []string{"https://other.example"}))
+	})
+}
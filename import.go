@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+// importedConversation 是从导出文件中解析出的一个对话
+type importedConversation struct {
+	Title     string          // 对话标题，为空时使用最后一条提示的第一行
+	UpdatedAt time.Time       // 最后更新时间，为零值时使用导入时间
+	Messages  []proto.Message // 对话消息
+}
+
+// markdownRoles 是 Markdown 导出中代表各角色的行首标记
+var markdownRoles = map[string]string{
+	"**系统**: ":        proto.RoleSystem,
+	"**用户**: ":        proto.RoleUser,
+	"**助手**: ":        proto.RoleAssistant,
+	"**System**: ":    proto.RoleSystem,
+	"**User**: ":      proto.RoleUser,
+	"**Assistant**: ": proto.RoleAssistant,
+}
+
+// importConversations 从导出文件导入对话，写入数据库与对话缓存，之后可以用 --continue 继续
+// path: 导出文件路径
+// 返回：错误信息
+func importConversations(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return modsError{err, fmt.Sprintf("无法读取 %s。", path)}
+	}
+	convos, err := parseImport(filepath.Ext(path), data)
+	if err != nil {
+		return modsError{err, fmt.Sprintf("无法解析 %s。", path)}
+	}
+	if len(convos) == 0 {
+		return modsError{errors.New("文件中没有对话"), fmt.Sprintf("无法导入 %s。", path)}
+	}
+
+	c, err := openConversations()
+	if err != nil {
+		return modsError{err, "无法打开对话缓存。"}
+	}
+	for _, convo := range convos {
+		id := newConversationID()
+		title := strings.TrimSpace(convo.Title)
+		if title == "" {
+			title = firstLine(lastPrompt(convo.Messages))
+		}
+		if err := c.Write(id, &convo.Messages); err != nil {
+			return modsError{err, "无法写入对话缓存。"}
+		}
+		// 导入的对话使用当前的默认 API 与模型继续
+		if err := db.Save(id, title, config.API, config.Model); err != nil {
+			_ = c.Delete(id)
+			return modsError{err, "无法保存对话。"}
+		}
+		if !convo.UpdatedAt.IsZero() {
+			if err := db.SetUpdatedAt(id, convo.UpdatedAt); err != nil {
+				return modsError{err, "无法保存对话。"}
+			}
+		}
+		fmt.Printf("%s\t%s\n", stdoutStyles().SHA1.Render(shortID(id)), title)
+	}
+
+	if !config.Quiet {
+		fmt.Fprintf(
+			os.Stderr,
+			"\n已导入 %d 个对话。使用 %s 继续。\n",
+			len(convos),
+			stderrStyles().InlineCode.Render("mods --continue <ID>"),
+		)
+	}
+	return nil
+}
+
+// parseImport 解析导出文件
+// 支持 ChatGPT 的 conversations.json、消息列表 JSON、{title, messages} JSON 以及 mods 的 Markdown 导出
+// ext: 文件扩展名，用于识别 Markdown
+// data: 文件内容
+// 返回：对话列表与错误信息
+func parseImport(ext string, data []byte) ([]importedConversation, error) {
+	trimmed := bytes.TrimSpace(data)
+	if ext == ".md" || ext == ".markdown" || len(trimmed) == 0 || (trimmed[0] != '[' && trimmed[0] != '{') {
+		convo := parseMarkdownImport(string(data))
+		if len(convo.Messages) == 0 {
+			return nil, nil
+		}
+		return []importedConversation{convo}, nil
+	}
+
+	// JSON：先按数组解析，再按单个对象解析
+	var items []json.RawMessage
+	if trimmed[0] == '{' {
+		items = []json.RawMessage{trimmed}
+	} else if err := json.Unmarshal(trimmed, &items); err != nil {
+		return nil, fmt.Errorf("无效的 JSON: %w", err)
+	}
+
+	var probe struct {
+		Mapping  json.RawMessage `json:"mapping"`
+		Messages json.RawMessage `json:"messages"`
+		Role     string          `json:"role"`
+	}
+	if len(items) > 0 {
+		if err := json.Unmarshal(items[0], &probe); err != nil {
+			return nil, fmt.Errorf("无效的 JSON: %w", err)
+		}
+	}
+
+	switch {
+	case probe.Mapping != nil:
+		var convos []importedConversation
+		for _, item := range items {
+			convo, err := parseChatGPTConversation(item)
+			if err != nil {
+				return nil, err
+			}
+			if len(convo.Messages) > 0 {
+				convos = append(convos, convo)
+			}
+		}
+		return convos, nil
+	case probe.Messages != nil:
+		var convos []importedConversation
+		for _, item := range items {
+			var obj struct {
+				Title    string          `json:"title"`
+				Messages []importMessage `json:"messages"`
+			}
+			if err := json.Unmarshal(item, &obj); err != nil {
+				return nil, fmt.Errorf("无效的对话: %w", err)
+			}
+			convos = append(convos, importedConversation{
+				Title:    obj.Title,
+				Messages: toProtoMessages(obj.Messages),
+			})
+		}
+		return convos, nil
+	case probe.Role != "":
+		var msgs []importMessage
+		if err := json.Unmarshal(trimmed, &msgs); err != nil {
+			return nil, fmt.Errorf("无效的消息列表: %w", err)
+		}
+		return []importedConversation{{Messages: toProtoMessages(msgs)}}, nil
+	default:
+		return nil, errors.New("无法识别的 JSON 格式")
+	}
+}
+
+// importMessage 是 OpenAI 风格的消息，内容可以是字符串或文本片段列表
+type importMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text 返回消息的文本内容，忽略非文本片段
+func (m importMessage) text() string {
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// toProtoMessages 将导入的消息转换为协议消息，跳过空消息与不支持的角色
+func toProtoMessages(in []importMessage) []proto.Message {
+	var out []proto.Message
+	for _, m := range in {
+		role := strings.ToLower(m.Role)
+		switch role {
+		case proto.RoleSystem, proto.RoleUser, proto.RoleAssistant:
+		default:
+			continue
+		}
+		if content := strings.TrimSpace(m.text()); content != "" {
+			out = append(out, proto.Message{Role: role, Content: content})
+		}
+	}
+	return out
+}
+
+// chatGPTNode 是 ChatGPT 导出中对话树的一个节点
+type chatGPTNode struct {
+	Parent  string `json:"parent"`
+	Message *struct {
+		Author struct {
+			Role string `json:"role"`
+		} `json:"author"`
+		Content struct {
+			Parts []json.RawMessage `json:"parts"`
+		} `json:"content"`
+	} `json:"message"`
+}
+
+// parseChatGPTConversation 解析 ChatGPT conversations.json 中的一个对话
+// 对话以树的形式保存（编辑与重新生成会产生分支），从 current_node 回溯到根节点得到当前分支
+func parseChatGPTConversation(data []byte) (importedConversation, error) {
+	var raw struct {
+		Title       string                 `json:"title"`
+		UpdateTime  float64                `json:"update_time"`
+		CurrentNode string                 `json:"current_node"`
+		Mapping     map[string]chatGPTNode `json:"mapping"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return importedConversation{}, fmt.Errorf("无效的 ChatGPT 对话: %w", err)
+	}
+
+	var msgs []importMessage
+	seen := map[string]bool{}
+	for id := raw.CurrentNode; id != "" && !seen[id]; id = raw.Mapping[id].Parent {
+		seen[id] = true
+		node := raw.Mapping[id]
+		if node.Message == nil {
+			continue
+		}
+		// 只保留文本片段，图片等其它片段是对象
+		var texts []string
+		for _, part := range node.Message.Content.Parts {
+			var s string
+			if err := json.Unmarshal(part, &s); err == nil && s != "" {
+				texts = append(texts, s)
+			}
+		}
+		content, _ := json.Marshal(strings.Join(texts, "\n"))
+		msgs = append(msgs, importMessage{
+			Role:    node.Message.Author.Role,
+			Content: content,
+		})
+	}
+	slices.Reverse(msgs)
+
+	convo := importedConversation{
+		Title:    raw.Title,
+		Messages: toProtoMessages(msgs),
+	}
+	if raw.UpdateTime > 0 {
+		convo.UpdatedAt = time.Unix(0, int64(raw.UpdateTime*float64(time.Second)))
+	}
+	return convo, nil
+}
+
+// parseMarkdownImport 解析 mods 的 Markdown 导出（--show 的输出），以行首的角色标记分隔消息
+func parseMarkdownImport(s string) importedConversation {
+	var (
+		convo   importedConversation
+		role    string
+		content strings.Builder
+	)
+	flush := func() {
+		if text := strings.TrimSpace(content.String()); role != "" && text != "" {
+			convo.Messages = append(convo.Messages, proto.Message{Role: role, Content: text})
+		}
+		content.Reset()
+	}
+	for line := range strings.SplitSeq(s, "\n") {
+		found := false
+		for prefix, r := range markdownRoles {
+			if rest, ok := strings.CutPrefix(line, prefix); ok {
+				flush()
+				role = r
+				content.WriteString(rest + "\n")
+				found = true
+				break
+			}
+		}
+		if !found {
+			content.WriteString(line + "\n")
+		}
+	}
+	flush()
+	return convo
+}
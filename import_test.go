@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseImport 测试解析各种导出格式
+func TestParseImport(t *testing.T) {
+	t.Run("ChatGPT", func(t *testing.T) {
+		// 对话树中 b 是被重新生成替换掉的分支，当前分支为 root -> u -> a2
+		data := `[{
+			"title": "打招呼",
+			"update_time": 1700000000.5,
+			"current_node": "a2",
+			"mapping": {
+				"root": {"parent": null, "message": null},
+				"u": {"parent": "root", "message": {"author": {"role": "user"}, "content": {"parts": ["你好"]}}},
+				"b": {"parent": "u", "message": {"author": {"role": "assistant"}, "content": {"parts": ["旧回答"]}}},
+				"a2": {"parent": "u", "message": {"author": {"role": "assistant"}, "content": {"parts": ["新回答", {"asset_pointer": "x"}]}}}
+			}
+		}]`
+		convos, err := parseImport(".json", []byte(data))
+		require.NoError(t, err)
+		require.Len(t, convos, 1)
+		require.Equal(t, "打招呼", convos[0].Title)
+		require.Equal(t, time.Unix(1700000000, 5e8), convos[0].UpdatedAt)
+		require.Equal(t, []proto.Message{
+			{Role: proto.RoleUser, Content: "你好"},
+			{Role: proto.RoleAssistant, Content: "新回答"},
+		}, convos[0].Messages)
+	})
+
+	t.Run("消息列表", func(t *testing.T) {
+		data := `[
+			{"role": "system", "content": "简洁"},
+			{"role": "user", "content": [{"type": "text", "text": "你好"}]},
+			{"role": "tool", "content": "忽略"},
+			{"role": "assistant", "content": "嗨"}
+		]`
+		convos, err := parseImport(".json", []byte(data))
+		require.NoError(t, err)
+		require.Len(t, convos, 1)
+		require.Empty(t, convos[0].Title)
+		require.Equal(t, []proto.Message{
+			{Role: proto.RoleSystem, Content: "简洁"},
+			{Role: proto.RoleUser, Content: "你好"},
+			{Role: proto.RoleAssistant, Content: "嗨"},
+		}, convos[0].Messages)
+	})
+
+	t.Run("带标题的对话", func(t *testing.T) {
+		data := `{"title": "问候", "messages": [{"role": "user", "content": "你好"}]}`
+		convos, err := parseImport(".json", []byte(data))
+		require.NoError(t, err)
+		require.Len(t, convos, 1)
+		require.Equal(t, "问候", convos[0].Title)
+		require.Len(t, convos[0].Messages, 1)
+	})
+
+	t.Run("Markdown", func(t *testing.T) {
+		messages := []proto.Message{
+			{Role: proto.RoleUser, Content: "写一个函数"},
+			{Role: proto.RoleAssistant, Content: "```go\nfunc f() {}\n```\n\n完成"},
+		}
+		convos, err := parseImport(".md", []byte(proto.Conversation(messages).String()))
+		require.NoError(t, err)
+		require.Len(t, convos, 1)
+		require.Equal(t, messages, convos[0].Messages)
+	})
+
+	t.Run("无法识别", func(t *testing.T) {
+		_, err := parseImport(".json", []byte(`{"foo": 1}`))
+		require.Error(t, err)
+	})
+}
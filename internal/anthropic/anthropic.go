@@ -8,6 +8,7 @@ import (
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/anthropics/anthropic-sdk-go/packages/param"
 	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
 	"github.com/charmbracelet/mods/internal/proto"
 	"github.com/charmbracelet/mods/internal/stream"
@@ -56,6 +57,16 @@ func (c *Client) Request(ctx context.Context, request proto.Request) stream.Stre
 		body.TopP = anthropic.Float(*request.TopP)
 	}
 
+	// 启用扩展思考：max_tokens 必须大于思考预算，且不支持调整温度和 Top-P
+	if budget := int64(request.ThinkingBudget); budget > 0 {
+		body.Thinking = anthropic.ThinkingConfigParamOfEnabled(budget)
+		if body.MaxTokens <= budget {
+			body.MaxTokens = budget + 4096
+		}
+		body.Temperature = param.Opt[float64]{}
+		body.TopP = param.Opt[float64]{}
+	}
+
 	// 创建流式响应对象
 	s := &Stream{
 		stream:   c.Messages.NewStreaming(ctx, body),
@@ -119,55 +130,67 @@ func New(config Config) *Client {
 // Stream 表示用于聊天补全的流式响应结构。
 type Stream struct {
 	done     bool                                                        // 流式传输是否完成的标志
+	closed   bool                                                        // 流是否已经关闭
 	stream   *ssestream.Stream[anthropic.MessageStreamEventUnion]       // SSE 事件流
 	request  anthropic.MessageNewParams                                  // 请求参数
 	factory  func() *ssestream.Stream[anthropic.MessageStreamEventUnion] // 流工厂函数，用于重新创建流
 	message  anthropic.Message                                           // 当前累积的消息
 	toolCall func(name string, data []byte) (string, error)             // 工具调用处理函数
 	messages []proto.Message                                             // 消息历史记录
+	usage    proto.Usage                                                 // 累计令牌用量
 }
 
+// Usage 实现 stream.Stream 接口，返回所有轮次累计的令牌用量。
+func (s *Stream) Usage() proto.Usage { return s.usage }
+
 // CallTools 实现 stream.Stream 接口，执行工具调用并返回调用状态。
 // 遍历消息内容中的工具使用块，调用相应工具并构建响应消息。
 // 返回：
 //   - []proto.ToolCallStatus: 工具调用状态列表
 func (s *Stream) CallTools() []proto.ToolCallStatus {
-	var statuses []proto.ToolCallStatus
+	var calls []stream.Call
 	
-	// 遍历消息内容中的所有块
+	// 收集消息内容中的所有工具使用块
 	for _, block := range s.message.Content {
 		switch call := block.AsAny().(type) {
 		case anthropic.ToolUseBlock:
-			// 调用工具并获取结果
-			msg, status := stream.CallTool(
-				call.ID,
-				call.Name,
-				[]byte(call.JSON.Input.Raw()),
-				s.toolCall,
-			)
-			
-			// 构建工具结果消息块
-			resp := anthropic.NewUserMessage(
-				newToolResultBlock(
-					call.ID,
-					msg.Content,
-					status.Err != nil,
-				),
-			)
-			
-			// 将工具结果添加到请求消息和消息历史中
-			s.request.Messages = append(s.request.Messages, resp)
-			s.messages = append(s.messages, msg)
-			statuses = append(statuses, status)
+			calls = append(calls, stream.Call{
+				ID:        call.ID,
+				Name:      call.Name,
+				Arguments: []byte(call.JSON.Input.Raw()),
+			})
 		}
 	}
+
+	// 并发调用工具，按原来的顺序写回结果
+	msgs, statuses := stream.CallTools(calls, s.toolCall)
+	for i, msg := range msgs {
+		// 构建工具结果消息块
+		resp := anthropic.NewUserMessage(
+			newToolResultBlock(
+				calls[i].ID,
+				msg.Content,
+				statuses[i].Err != nil,
+			),
+		)
+		
+		// 将工具结果添加到请求消息和消息历史中
+		s.request.Messages = append(s.request.Messages, resp)
+		s.messages = append(s.messages, msg)
+	}
 	return statuses
 }
 
-// Close 实现 stream.Stream 接口，关闭流式连接。
+// Close 实现 stream.Stream 接口，关闭流式连接，可以重复调用。
 // 返回：
 //   - error: 关闭过程中可能发生的错误
-func (s *Stream) Close() error { return s.stream.Close() } //nolint:wrapcheck
+func (s *Stream) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.stream.Close() //nolint:wrapcheck
+}
 
 // Current 实现 stream.Stream 接口，获取当前流事件的内容块。
 // 处理内容块增量事件，提取文本内容并返回。
@@ -193,6 +216,11 @@ func (s *Stream) Current() (proto.Chunk, error) {
 			return proto.Chunk{
 				Content: deltaVariant.Text,
 			}, nil
+		case anthropic.ThinkingDelta:
+			// 返回扩展思考的增量内容
+			return proto.Chunk{
+				Reasoning: deltaVariant.Thinking,
+			}, nil
 		}
 	}
 	
@@ -215,6 +243,10 @@ func (s *Stream) Messages() []proto.Message { return s.messages }
 // 返回：
 //   - bool: 是否还有下一个事件
 func (s *Stream) Next() bool {
+	// 流已关闭时不再发起新一轮请求
+	if s.closed {
+		return false
+	}
 	// 如果流已完成，重置状态并重新创建流
 	if s.done {
 		s.done = false
@@ -229,6 +261,14 @@ func (s *Stream) Next() bool {
 
 	// 流已结束，标记为完成并保存消息
 	s.done = true
+	// input_tokens 不包括读取和写入缓存的部分
+	u := s.message.Usage
+	s.usage.Add(proto.Usage{
+		InputTokens:      u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens,
+		OutputTokens:     u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	})
 	s.request.Messages = append(s.request.Messages, s.message.ToParam())
 	s.messages = append(s.messages, toProtoMessage(s.message.ToParam()))
 
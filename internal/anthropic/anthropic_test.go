@@ -0,0 +1,27 @@
+package anthropic
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/stream"
+	"github.com/charmbracelet/mods/internal/stream/streamtest"
+)
+
+func TestStream(t *testing.T) {
+	streamtest.Run(t, "text/event-stream",
+		"event: message_start\n"+
+			`data: {"type":"message_start","message":{"id":"1","type":"message","role":"assistant","model":"m","content":[],"usage":{"input_tokens":1,"output_tokens":0}}}`+"\n\n"+
+			"event: content_block_start\n"+
+			`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`+"\n\n"+
+			"event: content_block_delta\n"+
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"你好"}}`+"\n\n",
+		"你好",
+		func(ctx context.Context, baseURL string, client *http.Client) stream.Stream {
+			return New(Config{AuthToken: "x", BaseURL: baseURL, HTTPClient: client}).
+				Request(ctx, proto.Request{Model: "m"})
+		},
+	)
+}
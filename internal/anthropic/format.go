@@ -1,6 +1,7 @@
 package anthropic
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 
@@ -35,6 +36,18 @@ func fromMCPTools(mcps map[string][]mcp.Tool) []anthropic.ToolUnionParam {
 	return tools
 }
 
+// maxCacheBreakpoints 是一次请求中 cache_control 断点的数量上限
+const maxCacheBreakpoints = 4
+
+// setCacheControl 在内容块上设置临时的提示缓存断点。
+// 参数：
+//   - block: 内容块
+func setCacheControl(block anthropic.ContentBlockParamUnion) {
+	if cc := block.GetCacheControl(); cc != nil {
+		*cc = anthropic.NewCacheControlEphemeralParam()
+	}
+}
+
 // fromProtoMessages 将协议消息列表转换为 Anthropic 格式的系统消息和用户消息。
 // 参数：
 //   - input: 协议格式的消息列表
@@ -42,23 +55,46 @@ func fromMCPTools(mcps map[string][]mcp.Tool) []anthropic.ToolUnionParam {
 //   - system: 系统消息块列表（Anthropic 中系统消息不作为角色存在，需单独设置）
 //   - messages: Anthropic 格式的消息参数列表
 func fromProtoMessages(input []proto.Message) (system []anthropic.TextBlockParam, messages []anthropic.MessageParam) {
+	var breakpoints int
 	for _, msg := range input {
+		// 带缓存提示的消息在最后一个内容块上设置 cache_control 断点
+		cache := msg.Cache && breakpoints < maxCacheBreakpoints
+		if cache {
+			breakpoints++
+		}
 		switch msg.Role {
 		case proto.RoleSystem:
 			// 在 Anthropic API 中，系统消息不作为角色存在，必须设置为请求的系统部分
-			system = append(system, *anthropic.NewTextBlock(msg.Content).OfText)
+			block := *anthropic.NewTextBlock(msg.Content).OfText
+			if cache {
+				block.CacheControl = anthropic.NewCacheControlEphemeralParam()
+			}
+			system = append(system, block)
 		case proto.RoleTool:
 			// 处理工具响应消息
 			for _, call := range msg.ToolCalls {
 				block := newToolResultBlock(call.ID, msg.Content, call.IsError)
+				if cache {
+					setCacheControl(block)
+				}
 				// 在 Anthropic API 中，工具消息不作为角色存在，必须作为用户消息
 				messages = append(messages, anthropic.NewUserMessage(block))
 				break
 			}
 		case proto.RoleUser:
-			// 用户消息：创建文本块并添加到消息列表
-			block := anthropic.NewTextBlock(msg.Content)
-			messages = append(messages, anthropic.NewUserMessage(block))
+			// 用户消息：图片块在前，文本块在后
+			blocks := make([]anthropic.ContentBlockParamUnion, 0, len(msg.Images)+1)
+			for _, img := range msg.Images {
+				blocks = append(blocks, anthropic.NewImageBlockBase64(
+					img.MediaType,
+					base64.StdEncoding.EncodeToString(img.Data),
+				))
+			}
+			blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
+			if cache {
+				setCacheControl(blocks[len(blocks)-1])
+			}
+			messages = append(messages, anthropic.NewUserMessage(blocks...))
 		case proto.RoleAssistant:
 			// 助手消息：创建文本块和工具使用块
 			blocks := []anthropic.ContentBlockParamUnion{
@@ -76,6 +112,9 @@ func fromProtoMessages(input []proto.Message) (system []anthropic.TextBlockParam
 				}
 				blocks = append(blocks, block)
 			}
+			if cache {
+				setCacheControl(blocks[len(blocks)-1])
+			}
 			messages = append(messages, anthropic.NewAssistantMessage(blocks...))
 		}
 	}
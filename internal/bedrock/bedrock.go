@@ -0,0 +1,366 @@
+// Package bedrock 为 AWS Bedrock 的 Converse API 实现 [stream.Stream] 接口。
+//
+// Converse API 为 Bedrock 上的各类模型（Claude、Llama、Titan 等）提供统一的
+// 消息格式，请求由 AWS SDK 使用 SigV4 签名。
+package bedrock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/stream"
+)
+
+var _ stream.Client = &Client{}
+
+// Config 表示 Bedrock 客户端的配置信息。
+type Config struct {
+	Region     string       // AWS 区域，为空时使用 AWS 默认配置链中的区域
+	BaseURL    string       // 自定义端点地址，为空时使用区域默认端点
+	HTTPClient *http.Client // HTTP 客户端，为空时使用 AWS SDK 的默认客户端
+
+	// RequestHooks 在请求签名之后、发送之前依次调用，返回错误时不发送请求
+	RequestHooks []func(*http.Request) error
+}
+
+// DefaultConfig 返回 Bedrock 客户端的默认配置。
+// 参数：
+//   - region: AWS 区域
+//
+// 返回：
+//   - Config: 包含默认设置的配置对象
+func DefaultConfig(region string) Config {
+	return Config{
+		Region: region,
+	}
+}
+
+// Client 是 Bedrock Runtime 的客户端结构体。
+type Client struct {
+	*bedrockruntime.Client
+}
+
+// New 使用给定的配置创建新的 Bedrock 客户端。
+// 凭证按 AWS SDK 的默认链解析：环境变量、共享配置文件、SSO、实例角色等。
+// 参数：
+//   - config: 客户端配置对象
+//
+// 返回：
+//   - *Client: 初始化后的客户端实例
+//   - error: 加载 AWS 配置失败时返回的错误
+func New(config Config) (*Client, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if config.HTTPClient != nil {
+		// 只沿用代理设置：AWS SDK 需要可构建的客户端才能应用 AWS_CA_BUNDLE 等选项
+		var proxy func(*http.Request) (*url.URL, error)
+		if t, ok := config.HTTPClient.Transport.(*http.Transport); ok {
+			proxy = t.Proxy
+		}
+		opts = append(opts, awsconfig.WithHTTPClient(
+			awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+				t.Proxy = proxy
+			}),
+		))
+	}
+	if config.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(config.Region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("bedrock: 无法加载 AWS 配置: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("bedrock: 未配置 AWS 区域")
+	}
+
+	if len(config.RequestHooks) > 0 {
+		if cfg.HTTPClient == nil {
+			cfg.HTTPClient = awshttp.NewBuildableClient()
+		}
+		// 在加载配置之后包装，AWS_CA_BUNDLE 等选项已经应用到原来的客户端
+		cfg.HTTPClient = hookedClient{next: cfg.HTTPClient, hooks: config.RequestHooks}
+	}
+
+	client := bedrockruntime.NewFromConfig(cfg, func(o *bedrockruntime.Options) {
+		if config.BaseURL != "" {
+			o.BaseEndpoint = aws.String(config.BaseURL)
+		}
+	})
+	return &Client{Client: client}, nil
+}
+
+// hookedClient 在发送每个请求前调用 hooks 的 HTTP 客户端
+type hookedClient struct {
+	next  aws.HTTPClient              // 实际发送请求的客户端
+	hooks []func(*http.Request) error // 发送前调用的函数
+}
+
+// Do 实现 aws.HTTPClient 接口
+func (c hookedClient) Do(req *http.Request) (*http.Response, error) {
+	for _, hook := range c.hooks {
+		if err := hook(req); err != nil {
+			return nil, hookError{err}
+		}
+	}
+	return c.next.Do(req) //nolint:wrapcheck
+}
+
+// hookError 是 RequestHooks 返回的错误，AWS SDK 不会重试
+type hookError struct{ err error }
+
+// Error 返回错误消息
+func (e hookError) Error() string { return e.err.Error() }
+
+// Unwrap 返回原来的错误
+func (e hookError) Unwrap() error { return e.err }
+
+// RetryableError 告诉 AWS SDK 不要重试
+func (hookError) RetryableError() bool { return false }
+
+// Request 实现 stream.Client 接口，创建并返回一个流式请求。
+// 参数：
+//   - ctx: 上下文，用于控制请求的生命周期
+//   - request: 协议请求对象，包含消息、模型配置等信息
+//
+// 返回：
+//   - stream.Stream: 流式响应对象
+func (c *Client) Request(ctx context.Context, request proto.Request) stream.Stream {
+	system, messages := fromProtoMessages(request.Messages)
+
+	body := &bedrockruntime.ConverseStreamInput{
+		ModelId:  aws.String(request.Model),
+		Messages: messages,
+		System:   system,
+		InferenceConfig: &types.InferenceConfiguration{
+			StopSequences: request.Stop,
+		},
+	}
+
+	// 设置最大令牌数、温度与 Top-P
+	if request.MaxTokens != nil {
+		body.InferenceConfig.MaxTokens = aws.Int32(int32(*request.MaxTokens)) //nolint:gosec
+	}
+	if request.Temperature != nil {
+		body.InferenceConfig.Temperature = aws.Float32(float32(*request.Temperature))
+	}
+	if request.TopP != nil {
+		body.InferenceConfig.TopP = aws.Float32(float32(*request.TopP))
+	}
+
+	// 仅在有工具时设置工具配置，不支持工具的模型会拒绝该字段
+	if tools := fromMCPTools(request.Tools); len(tools) > 0 {
+		body.ToolConfig = &types.ToolConfiguration{Tools: tools}
+	}
+
+	s := &Stream{
+		ctx:      ctx,
+		client:   c.Client,
+		request:  body,
+		toolCall: request.ToolCaller,
+		messages: request.Messages,
+	}
+	s.start()
+	return s
+}
+
+// Stream 表示 Bedrock 的流式响应，实现了 stream.Stream 接口。
+type Stream struct {
+	ctx      context.Context                                // 请求上下文
+	client   *bedrockruntime.Client                         // Bedrock Runtime 客户端
+	request  *bedrockruntime.ConverseStreamInput            // 请求参数，随工具调用轮次追加消息
+	events   *bedrockruntime.ConverseStreamEventStream      // 当前轮次的事件流
+	current  types.ConverseStreamOutput                     // 当前事件
+	done     bool                                           // 当前轮次是否完成
+	closed   bool                                           // 流是否已经关闭
+	err      error                                          // 流处理过程中的错误
+	text     string                                         // 当前轮次累积的文本
+	toolUses map[int32]*toolUse                             // 当前轮次累积的工具调用，按内容块索引
+	toolCall func(name string, data []byte) (string, error) // 工具调用处理函数
+	messages []proto.Message                                // 消息历史记录
+	usage    proto.Usage                                    // 累计令牌用量
+}
+
+// toolUse 是流式过程中累积的工具调用。
+type toolUse struct {
+	id    string // 工具调用 ID
+	name  string // 工具名称
+	input string // JSON 格式的参数，分多个增量到达
+}
+
+// start 发起一轮新的请求并重置当前轮次的状态
+func (s *Stream) start() {
+	if s.events != nil {
+		// 释放上一轮的事件流
+		_ = s.events.Close()
+		s.events = nil
+	}
+	s.done = false
+	s.text = ""
+	s.toolUses = map[int32]*toolUse{}
+	out, err := s.client.ConverseStream(s.ctx, s.request)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.events = out.GetStream()
+}
+
+// Next 实现 stream.Stream 接口，推进到下一个流事件。
+// 如果上一轮已完成（例如在工具调用之后），则发起新一轮请求。
+// 返回：
+//   - bool: 是否还有下一个事件
+func (s *Stream) Next() bool {
+	if s.err != nil || s.closed {
+		return false
+	}
+	if s.done {
+		s.start()
+		if s.err != nil {
+			return false
+		}
+	}
+
+	event, ok := <-s.events.Events()
+	if ok {
+		s.current = event
+		return true
+	}
+
+	// 事件流已结束，保存本轮的助手消息
+	s.done = true
+	if err := s.events.Err(); err != nil {
+		s.err = err
+		return false
+	}
+	msg := s.assistantMessage()
+	s.request.Messages = append(s.request.Messages, msg)
+	s.messages = append(s.messages, toProtoMessage(msg))
+	return false
+}
+
+// Current 实现 stream.Stream 接口，处理当前事件并返回其中的文本内容。
+// 返回：
+//   - proto.Chunk: 内容块，包含文本内容
+//   - error: 没有文本内容时返回 stream.ErrNoContent
+func (s *Stream) Current() (proto.Chunk, error) {
+	switch event := s.current.(type) {
+	case *types.ConverseStreamOutputMemberContentBlockStart:
+		// 工具调用以内容块开始事件声明名称与 ID
+		if start, ok := event.Value.Start.(*types.ContentBlockStartMemberToolUse); ok {
+			s.toolUses[aws.ToInt32(event.Value.ContentBlockIndex)] = &toolUse{
+				id:   aws.ToString(start.Value.ToolUseId),
+				name: aws.ToString(start.Value.Name),
+			}
+		}
+	case *types.ConverseStreamOutputMemberContentBlockDelta:
+		switch delta := event.Value.Delta.(type) {
+		case *types.ContentBlockDeltaMemberText:
+			s.text += delta.Value
+			return proto.Chunk{Content: delta.Value}, nil
+		case *types.ContentBlockDeltaMemberToolUse:
+			if call, ok := s.toolUses[aws.ToInt32(event.Value.ContentBlockIndex)]; ok {
+				call.input += aws.ToString(delta.Value.Input)
+			}
+		}
+	case *types.ConverseStreamOutputMemberMetadata:
+		// 元数据事件带有本轮的令牌用量
+		if u := event.Value.Usage; u != nil {
+			s.usage.Add(proto.Usage{
+				InputTokens:  int64(aws.ToInt32(u.InputTokens)),
+				OutputTokens: int64(aws.ToInt32(u.OutputTokens)),
+			})
+		}
+	}
+	return proto.Chunk{}, stream.ErrNoContent
+}
+
+// CallTools 实现 stream.Stream 接口，执行本轮的所有工具调用。
+// 所有工具结果放在同一条用户消息中发回，这是 Converse API 的要求。
+// 返回：
+//   - []proto.ToolCallStatus: 工具调用状态列表
+func (s *Stream) CallTools() []proto.ToolCallStatus {
+	calls := s.orderedToolUses()
+	if len(calls) == 0 {
+		return nil
+	}
+
+	pending := make([]stream.Call, 0, len(calls))
+	for _, call := range calls {
+		pending = append(pending, stream.Call{ID: call.id, Name: call.name, Arguments: []byte(call.input)})
+	}
+	// 并发执行工具调用，按原来的顺序写回
+	msgs, statuses := stream.CallTools(pending, s.toolCall)
+	results := make([]types.ContentBlock, 0, len(calls))
+	for i, msg := range msgs {
+		results = append(results, newToolResultBlock(calls[i].id, msg.Content, statuses[i].Err != nil))
+		s.messages = append(s.messages, msg)
+	}
+	s.request.Messages = append(s.request.Messages, types.Message{
+		Role:    types.ConversationRoleUser,
+		Content: results,
+	})
+	return statuses
+}
+
+// Close 实现 stream.Stream 接口，关闭事件流，可以重复调用。
+// 返回：
+//   - error: 总是为 nil，读取事件流的错误由 Err 返回
+func (s *Stream) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.events != nil {
+		// 事件流关闭时返回的是读取过程中的错误，已经由 Err 返回
+		_ = s.events.Close()
+	}
+	return nil
+}
+
+// Err 实现 stream.Stream 接口，返回流处理过程中的错误。
+// 返回：
+//   - error: 流处理错误
+func (s *Stream) Err() error { return s.err }
+
+// Messages 实现 stream.Stream 接口，返回消息历史记录。
+// 返回：
+//   - []proto.Message: 消息列表
+func (s *Stream) Messages() []proto.Message { return s.messages }
+
+// Usage 实现 stream.Stream 接口，返回所有轮次累计的令牌用量。
+func (s *Stream) Usage() proto.Usage { return s.usage }
+
+// orderedToolUses 按内容块顺序返回本轮的工具调用
+func (s *Stream) orderedToolUses() []*toolUse {
+	calls := make([]*toolUse, 0, len(s.toolUses))
+	for _, i := range slices.Sorted(maps.Keys(s.toolUses)) {
+		calls = append(calls, s.toolUses[i])
+	}
+	return calls
+}
+
+// assistantMessage 将本轮累积的文本与工具调用组装为助手消息
+func (s *Stream) assistantMessage() types.Message {
+	var content []types.ContentBlock
+	if s.text != "" {
+		content = append(content, &types.ContentBlockMemberText{Value: s.text})
+	}
+	for _, call := range s.orderedToolUses() {
+		content = append(content, newToolUseBlock(call.id, call.name, []byte(call.input)))
+	}
+	return types.Message{
+		Role:    types.ConversationRoleAssistant,
+		Content: content,
+	}
+}
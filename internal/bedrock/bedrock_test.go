@@ -0,0 +1,108 @@
+package bedrock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/stream"
+	"github.com/charmbracelet/mods/internal/stream/streamtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	// ConverseStream 的响应是 AWS 的二进制事件流
+	var body bytes.Buffer
+	msg := eventstream.Message{Payload: []byte(`{"contentBlockIndex":0,"delta":{"text":"你好"}}`)}
+	msg.Headers.Set(":message-type", eventstream.StringValue("event"))
+	msg.Headers.Set(":event-type", eventstream.StringValue("contentBlockDelta"))
+	msg.Headers.Set(":content-type", eventstream.StringValue("application/json"))
+	require.NoError(t, eventstream.NewEncoder().Encode(&body, msg))
+
+	streamtest.Run(t, "application/vnd.amazon.eventstream", body.String(), "你好",
+		func(ctx context.Context, baseURL string, client *http.Client) stream.Stream {
+			// 直接使用测试的 HTTP 客户端，New 会改用 AWS SDK 自己的客户端
+			c := &Client{Client: bedrockruntime.New(bedrockruntime.Options{
+				Region:       "us-east-1",
+				BaseEndpoint: aws.String(baseURL),
+				HTTPClient:   client,
+				Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+					return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+				}),
+			})}
+			return c.Request(ctx, proto.Request{Model: "m"})
+		},
+	)
+}
+
+// setCredentials 使用固定的 AWS 凭证，不读取本机的配置
+func setCredentials(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+func TestRequestHooks(t *testing.T) {
+	setCredentials(t)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Run("签名后调用", func(t *testing.T) {
+		requests.Store(0)
+		var header http.Header
+		client, err := New(Config{
+			Region:  "us-east-1",
+			BaseURL: srv.URL,
+			RequestHooks: []func(*http.Request) error{func(req *http.Request) error {
+				header = req.Header.Clone()
+				return nil
+			}},
+		})
+		require.NoError(t, err)
+		s := client.Request(context.Background(), proto.Request{Model: "m"})
+		require.False(t, s.Next())
+		require.Error(t, s.Err())
+		require.Contains(t, header.Get("Authorization"), "AWS4-HMAC-SHA256")
+		require.Positive(t, requests.Load())
+	})
+
+	t.Run("返回错误时不发送", func(t *testing.T) {
+		requests.Store(0)
+		calls := 0
+		errTooLarge := errors.New("too large")
+		client, err := New(Config{
+			Region:  "us-east-1",
+			BaseURL: srv.URL,
+			RequestHooks: []func(*http.Request) error{func(*http.Request) error {
+				calls++
+				return errTooLarge
+			}},
+		})
+		require.NoError(t, err)
+		s := client.Request(context.Background(), proto.Request{Model: "m"})
+		require.False(t, s.Next())
+		require.ErrorIs(t, s.Err(), errTooLarge)
+		require.Equal(t, 1, calls, "不重试")
+		require.Zero(t, requests.Load())
+		require.NoError(t, s.Close())
+	})
+}
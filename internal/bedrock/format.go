@@ -0,0 +1,187 @@
+package bedrock
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// fromMCPTools 将 MCP 工具映射转换为 Converse API 的工具列表。
+// 参数：
+//   - mcps: MCP 工具映射，键为服务器名称，值为该服务器提供的工具列表
+//
+// 返回：
+//   - []types.Tool: Converse API 格式的工具列表
+func fromMCPTools(mcps map[string][]mcp.Tool) []types.Tool {
+	var tools []types.Tool
+	for name, serverTools := range mcps {
+		for _, tool := range serverTools {
+			schema := map[string]any{
+				"type":       "object",
+				"properties": tool.InputSchema.Properties,
+			}
+			if len(tool.InputSchema.Required) > 0 {
+				schema["required"] = tool.InputSchema.Required
+			}
+			// 工具名称格式为 "服务器名_工具名"
+			tools = append(tools, &types.ToolMemberToolSpec{
+				Value: types.ToolSpecification{
+					Name:        aws.String(fmt.Sprintf("%s_%s", name, tool.Name)),
+					Description: aws.String(tool.Description),
+					InputSchema: &types.ToolInputSchemaMemberJson{
+						Value: document.NewLazyDocument(schema),
+					},
+				},
+			})
+		}
+	}
+	return tools
+}
+
+// fromProtoMessages 将协议消息列表转换为 Converse API 的系统提示与消息列表。
+// 参数：
+//   - input: 协议格式的消息列表
+//
+// 返回：
+//   - system: 系统提示块列表（Converse API 中系统消息需单独设置）
+//   - messages: Converse API 格式的消息列表
+func fromProtoMessages(input []proto.Message) (system []types.SystemContentBlock, messages []types.Message) {
+	for _, msg := range input {
+		switch msg.Role {
+		case proto.RoleSystem:
+			system = append(system, &types.SystemContentBlockMemberText{Value: msg.Content})
+		case proto.RoleTool:
+			// 工具结果作为用户消息发送，连续的工具结果合并到同一条消息中
+			for _, call := range msg.ToolCalls {
+				block := newToolResultBlock(call.ID, msg.Content, call.IsError)
+				if n := len(messages); n > 0 && messages[n-1].Role == types.ConversationRoleUser && isToolResults(messages[n-1]) {
+					messages[n-1].Content = append(messages[n-1].Content, block)
+				} else {
+					messages = append(messages, types.Message{
+						Role:    types.ConversationRoleUser,
+						Content: []types.ContentBlock{block},
+					})
+				}
+				break
+			}
+		case proto.RoleUser:
+			content := []types.ContentBlock{
+				&types.ContentBlockMemberText{Value: msg.Content},
+			}
+			for _, img := range msg.Images {
+				content = append(content, &types.ContentBlockMemberImage{
+					Value: types.ImageBlock{
+						Format: types.ImageFormat(strings.TrimPrefix(img.MediaType, "image/")),
+						Source: &types.ImageSourceMemberBytes{Value: img.Data},
+					},
+				})
+			}
+			messages = append(messages, types.Message{
+				Role:    types.ConversationRoleUser,
+				Content: content,
+			})
+		case proto.RoleAssistant:
+			var content []types.ContentBlock
+			if msg.Content != "" {
+				content = append(content, &types.ContentBlockMemberText{Value: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				content = append(content, newToolUseBlock(call.ID, call.Function.Name, call.Function.Arguments))
+			}
+			messages = append(messages, types.Message{
+				Role:    types.ConversationRoleAssistant,
+				Content: content,
+			})
+		}
+	}
+	return system, messages
+}
+
+// toProtoMessage 将 Converse API 的助手消息转换为协议消息。
+// 参数：
+//   - in: Converse API 格式的消息
+//
+// 返回：
+//   - proto.Message: 协议格式的消息对象
+func toProtoMessage(in types.Message) proto.Message {
+	msg := proto.Message{
+		Role: string(in.Role),
+	}
+	for _, block := range in.Content {
+		switch block := block.(type) {
+		case *types.ContentBlockMemberText:
+			msg.Content += block.Value
+		case *types.ContentBlockMemberToolUse:
+			args, _ := block.Value.Input.MarshalSmithyDocument()
+			msg.ToolCalls = append(msg.ToolCalls, proto.ToolCall{
+				ID: aws.ToString(block.Value.ToolUseId),
+				Function: proto.Function{
+					Name:      aws.ToString(block.Value.Name),
+					Arguments: args,
+				},
+			})
+		}
+	}
+	return msg
+}
+
+// newToolUseBlock 创建工具调用内容块。
+// 参数：
+//   - id: 工具调用 ID
+//   - name: 工具名称
+//   - args: JSON 格式的参数
+//
+// 返回：
+//   - types.ContentBlock: 工具调用内容块
+func newToolUseBlock(id, name string, args []byte) types.ContentBlock {
+	// 没有参数的工具调用也必须提供一个 JSON 对象
+	input := map[string]any{}
+	_ = json.Unmarshal(args, &input)
+	return &types.ContentBlockMemberToolUse{
+		Value: types.ToolUseBlock{
+			ToolUseId: aws.String(id),
+			Name:      aws.String(name),
+			Input:     document.NewLazyDocument(input),
+		},
+	}
+}
+
+// newToolResultBlock 创建工具结果内容块。
+// 参数：
+//   - id: 工具调用 ID，用于关联工具调用和结果
+//   - content: 工具执行结果内容
+//   - isError: 是否为错误结果
+//
+// 返回：
+//   - types.ContentBlock: 工具结果内容块
+func newToolResultBlock(id, content string, isError bool) types.ContentBlock {
+	status := types.ToolResultStatusSuccess
+	if isError {
+		status = types.ToolResultStatusError
+	}
+	return &types.ContentBlockMemberToolResult{
+		Value: types.ToolResultBlock{
+			ToolUseId: aws.String(id),
+			Content: []types.ToolResultContentBlock{
+				&types.ToolResultContentBlockMemberText{Value: content},
+			},
+			Status: status,
+		},
+	}
+}
+
+// isToolResults 判断消息是否只包含工具结果
+func isToolResults(msg types.Message) bool {
+	for _, block := range msg.Content {
+		if _, ok := block.(*types.ContentBlockMemberToolResult); !ok {
+			return false
+		}
+	}
+	return len(msg.Content) > 0
+}
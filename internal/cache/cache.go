@@ -18,7 +18,11 @@ const (
 	TemporaryCache    Type = "temp"          // 临时缓存
 )
 
-const cacheExt = ".gob" // 缓存文件扩展名
+const (
+	cacheExt = ".gob"  // 缓存文件扩展名
+	lockExt  = ".lock" // 锁文件扩展名
+	tmpExt   = ".tmp"  // 写入中的临时文件扩展名
+)
 
 var errInvalidID = errors.New("无效的标识符")
 
@@ -26,6 +30,7 @@ var errInvalidID = errors.New("无效的标识符")
 type Cache[T any] struct {
 	baseDir string // 基础目录
 	cType   Type   // 缓存类型
+	ext     string // 缓存文件扩展名
 }
 
 // New 创建一个新的缓存实例，使用指定的基础目录和缓存类型。
@@ -37,20 +42,33 @@ func New[T any](baseDir string, cacheType Type) (*Cache[T], error) {
 	return &Cache[T]{
 		baseDir: baseDir,
 		cType:   cacheType,
+		ext:     cacheExt,
 	}, nil
 }
 
+// withExt 返回使用相同目录、不同文件扩展名的缓存。
+func (c *Cache[T]) withExt(ext string) *Cache[T] {
+	cc := *c
+	cc.ext = ext
+	return &cc
+}
+
 // dir 返回缓存目录的完整路径。
 func (c *Cache[T]) dir() string {
 	return filepath.Join(c.baseDir, string(c.cType))
 }
 
+// path 返回标识符对应的缓存文件路径。
+func (c *Cache[T]) path(id string) string {
+	return filepath.Join(c.dir(), id+c.ext)
+}
+
 // Read 通过指定的标识符读取缓存数据，使用 readFn 函数处理读取的数据流。
 func (c *Cache[T]) Read(id string, readFn func(io.Reader) error) error {
 	if id == "" {
 		return fmt.Errorf("读取: %w", errInvalidID)
 	}
-	file, err := os.Open(filepath.Join(c.dir(), id+cacheExt))
+	file, err := os.Open(c.path(id))
 	if err != nil {
 		return fmt.Errorf("读取: %w", err)
 	}
@@ -63,21 +81,35 @@ func (c *Cache[T]) Read(id string, readFn func(io.Reader) error) error {
 }
 
 // Write 通过指定的标识符写入缓存数据，使用 writeFn 函数处理写入的数据流。
+// 数据先写入临时文件再原子地重命名，并对同一标识符加文件锁，
+// 多个进程同时写入同一条目时不会损坏缓存。
 func (c *Cache[T]) Write(id string, writeFn func(io.Writer) error) error {
 	if id == "" {
 		return fmt.Errorf("写入: %w", errInvalidID)
 	}
 
-	file, err := os.Create(filepath.Join(c.dir(), id+cacheExt))
+	unlock, err := lockFile(filepath.Join(c.dir(), id+lockExt))
+	if err != nil {
+		return fmt.Errorf("写入: 加锁: %w", err)
+	}
+	defer unlock()
+
+	file, err := os.CreateTemp(c.dir(), id+".*"+tmpExt)
 	if err != nil {
 		return fmt.Errorf("写入: %w", err)
 	}
-	defer file.Close() //nolint:errcheck
+	defer os.Remove(file.Name()) //nolint:errcheck
 
 	if err := writeFn(file); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("写入: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("写入: %w", err)
+	}
+	if err := os.Rename(file.Name(), c.path(id)); err != nil {
 		return fmt.Errorf("写入: %w", err)
 	}
-
 	return nil
 }
 
@@ -86,8 +118,9 @@ func (c *Cache[T]) Delete(id string) error {
 	if id == "" {
 		return fmt.Errorf("删除: %w", errInvalidID)
 	}
-	if err := os.Remove(filepath.Join(c.dir(), id+cacheExt)); err != nil {
+	if err := os.Remove(c.path(id)); err != nil {
 		return fmt.Errorf("删除: %w", err)
 	}
+	_ = os.Remove(filepath.Join(c.dir(), id+lockExt))
 	return nil
 }
@@ -3,6 +3,10 @@ package cache
 import (
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -51,6 +55,51 @@ func TestCache(t *testing.T) {
 		require.ErrorIs(t, cache.Read("fake", nil), os.ErrNotExist)
 	})
 
+	// 测试并发写入同一条目
+	t.Run("并发写入", func(t *testing.T) {
+		dir := t.TempDir()
+		cache, err := NewConversations(dir)
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				messages := []proto.Message{{
+					Role:    proto.RoleUser,
+					Content: strings.Repeat(strconv.Itoa(i), 10000),
+				}}
+				require.NoError(t, cache.Write("fake", &messages))
+			}()
+		}
+		wg.Wait()
+
+		result := []proto.Message{}
+		require.NoError(t, cache.Read("fake", &result))
+		require.Len(t, result, 1)
+
+		tmps, err := filepath.Glob(filepath.Join(dir, string(ConversationCache), "*"+tmpExt))
+		require.NoError(t, err)
+		require.Empty(t, tmps)
+	})
+
+	// 测试写入失败时保留原有内容
+	t.Run("写入失败", func(t *testing.T) {
+		cache, err := NewConversations(t.TempDir())
+		require.NoError(t, err)
+		messages := []proto.Message{{Role: proto.RoleUser, Content: "原有内容"}}
+		require.NoError(t, cache.Write("fake", &messages))
+		require.Error(t, cache.cache.Write("fake", func(w io.Writer) error {
+			_, _ = w.Write([]byte("不完整"))
+			return io.ErrUnexpectedEOF
+		}))
+
+		result := []proto.Message{}
+		require.NoError(t, cache.Read("fake", &result))
+		require.Equal(t, messages, result)
+	})
+
 	// 测试无效标识符
 	t.Run("无效标识符", func(t *testing.T) {
 		// 测试写入时使用无效标识符
@@ -163,3 +212,82 @@ func TestExpiringCache(t *testing.T) {
 		require.Equal(t, data2, result)
 	})
 }
+
+// TestConversationFormats 测试对话缓存的 gob 与 JSON 格式
+func TestConversationFormats(t *testing.T) {
+	messages := []proto.Message{
+		{Role: proto.RoleSystem, Content: "系统提示"},
+		{
+			Role:    proto.RoleUser,
+			Content: "这是什么？",
+			Images:  []proto.Image{{MediaType: "image/png", Data: []byte{1, 2, 3}}},
+		},
+		{
+			Role: proto.RoleAssistant,
+			ToolCalls: []proto.ToolCall{{
+				ID:       "call_1",
+				Function: proto.Function{Name: "read", Arguments: []byte(`{"path":"a.txt"}`)},
+			}},
+		},
+		{
+			Role:    proto.RoleTool,
+			Content: "失败",
+			ToolCalls: []proto.ToolCall{{
+				ID:       "call_1",
+				Function: proto.Function{Name: "read"},
+				IsError:  true,
+			}},
+		},
+		{Role: proto.RoleAssistant, Content: "一张图片"},
+	}
+
+	t.Run("JSON 读写", func(t *testing.T) {
+		dir := t.TempDir()
+		cache, err := NewConversationsWithFormat(dir, FormatJSON)
+		require.NoError(t, err)
+		require.NoError(t, cache.Write("fake", &messages))
+		require.FileExists(t, filepath.Join(dir, string(ConversationCache), "fake"+jsonExt))
+
+		var result []proto.Message
+		require.NoError(t, cache.Read("fake", &result))
+		require.Equal(t, messages, result)
+	})
+
+	t.Run("转换格式", func(t *testing.T) {
+		dir := t.TempDir()
+		gobCache, err := NewConversations(dir)
+		require.NoError(t, err)
+		require.NoError(t, gobCache.Write("fake", &messages))
+
+		jsonCache, err := NewConversationsWithFormat(dir, FormatJSON)
+		require.NoError(t, err)
+		var result []proto.Message
+		require.NoError(t, jsonCache.Read("fake", &result))
+		require.Equal(t, messages, result)
+
+		require.NoError(t, jsonCache.Write("fake", &result))
+		require.NoFileExists(t, filepath.Join(dir, string(ConversationCache), "fake"+cacheExt))
+
+		result = nil
+		require.NoError(t, gobCache.Read("fake", &result))
+		require.Equal(t, messages, result)
+
+		require.NoError(t, gobCache.Delete("fake"))
+		require.ErrorIs(t, jsonCache.Read("fake", &result), os.ErrNotExist)
+		require.ErrorIs(t, jsonCache.Delete("fake"), os.ErrNotExist)
+	})
+
+	t.Run("不支持的 schema 版本", func(t *testing.T) {
+		dir := t.TempDir()
+		cache, err := NewConversationsWithFormat(dir, FormatJSON)
+		require.NoError(t, err)
+		path := filepath.Join(dir, string(ConversationCache), "fake"+jsonExt)
+		require.NoError(t, os.WriteFile(path, []byte(`{"version":99,"messages":[]}`), 0o600))
+		require.Error(t, cache.Read("fake", &[]proto.Message{}))
+	})
+
+	t.Run("无效格式", func(t *testing.T) {
+		_, err := NewConversationsWithFormat(t.TempDir(), "xml")
+		require.Error(t, err)
+	})
+}
@@ -6,43 +6,132 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/charmbracelet/mods/internal/proto"
 )
 
+// Format 表示对话缓存的存储格式。
+type Format string
+
+// 支持的对话缓存格式。
+const (
+	FormatGob  Format = "gob"  // Go 的 gob 编码，默认格式
+	FormatJSON Format = "json" // 带 schema 版本号的 JSON，其它语言的工具也可以读取
+)
+
+// ParseFormat 解析对话缓存格式，空字符串表示默认的 gob 格式。
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return FormatGob, nil
+	case FormatGob, FormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("不支持的缓存格式 %q，可选值：gob、json", s)
+	}
+}
+
 // Conversations 是对话缓存结构。
+// 读取时两种格式都支持，写入时使用配置的格式并删除另一种格式的旧文件。
 type Conversations struct {
-	cache *Cache[[]proto.Message] // 底层缓存实例
+	cache  *Cache[[]proto.Message] // gob 格式的底层缓存实例
+	json   *Cache[[]proto.Message] // JSON 格式的底层缓存实例
+	format Format                  // 写入时使用的格式
 }
 
-// NewConversations 创建一个新的对话缓存实例。
+// NewConversations 创建一个新的对话缓存实例，以 gob 格式写入。
 func NewConversations(dir string) (*Conversations, error) {
+	return NewConversationsWithFormat(dir, FormatGob)
+}
+
+// NewConversationsWithFormat 创建一个以指定格式写入的对话缓存实例。
+func NewConversationsWithFormat(dir string, format Format) (*Conversations, error) {
+	if _, err := ParseFormat(string(format)); err != nil {
+		return nil, err
+	}
 	cache, err := New[[]proto.Message](dir, ConversationCache)
 	if err != nil {
 		return nil, err
 	}
+	if format == "" {
+		format = FormatGob
+	}
 	return &Conversations{
-		cache: cache,
+		cache:  cache,
+		json:   cache.withExt(jsonExt),
+		format: format,
 	}, nil
 }
 
+// caches 返回按读取顺序排列的底层缓存，配置的格式优先。
+func (c *Conversations) caches() []*Cache[[]proto.Message] {
+	if c.format == FormatJSON {
+		return []*Cache[[]proto.Message]{c.json, c.cache}
+	}
+	return []*Cache[[]proto.Message]{c.cache, c.json}
+}
+
 // Read 通过指定的标识符读取对话消息列表。
 func (c *Conversations) Read(id string, messages *[]proto.Message) error {
-	return c.cache.Read(id, func(r io.Reader) error {
-		return decode(r, messages)
-	})
+	var first error
+	for _, cc := range c.caches() {
+		err := cc.Read(id, func(r io.Reader) error {
+			if cc.ext == jsonExt {
+				return decodeJSON(r, messages)
+			}
+			return decode(r, messages)
+		})
+		if err == nil || !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
 }
 
 // Write 通过指定的标识符写入对话消息列表。
 func (c *Conversations) Write(id string, messages *[]proto.Message) error {
-	return c.cache.Write(id, func(w io.Writer) error {
+	caches := c.caches()
+	err := caches[0].Write(id, func(w io.Writer) error {
+		if c.format == FormatJSON {
+			return encodeJSON(w, messages)
+		}
 		return encode(w, messages)
 	})
+	if err != nil {
+		return err
+	}
+	// 删除另一种格式的旧文件，避免读到过期的内容
+	if err := os.Remove(caches[1].path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("写入: %w", err)
+	}
+	return nil
 }
 
 // Delete 删除指定标识符的对话缓存。
 func (c *Conversations) Delete(id string) error {
-	return c.cache.Delete(id)
+	var first error
+	deleted := false
+	for _, cc := range c.caches() {
+		err := cc.Delete(id)
+		if err == nil {
+			deleted = true
+			continue
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	if deleted {
+		return nil
+	}
+	return first
 }
 
 func init() {
@@ -90,7 +90,8 @@ func (c *ExpiringCache[T]) Write(id string, expiresAt int64, writeFn func(io.Wri
 	}
 
 	filename := c.getCacheFilename(id, expiresAt)
-	file, err := os.Create(filepath.Join(c.cache.dir(), filename))
+	// 缓存的内容可能是密钥，只允许当前用户读写
+	file, err := os.OpenFile(filepath.Join(c.cache.dir(), filename), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
 	if err != nil {
 		return fmt.Errorf("创建过期缓存文件失败: %w", err)
 	}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+const (
+	jsonExt           = ".json" // JSON 格式的缓存文件扩展名
+	jsonSchemaVersion = 1       // JSON 格式的 schema 版本号，格式不兼容地变化时递增
+)
+
+// jsonConversation 是 JSON 格式的对话缓存文件。
+type jsonConversation struct {
+	Version  int           `json:"version"`  // schema 版本号
+	Messages []jsonMessage `json:"messages"` // 消息列表
+}
+
+// jsonMessage 是 JSON 格式的消息。
+type jsonMessage struct {
+	Role      string         `json:"role"`                 // 消息角色
+	Content   string         `json:"content"`              // 消息内容
+	Images    []jsonImage    `json:"images,omitempty"`     // 附带的图片
+	ToolCalls []jsonToolCall `json:"tool_calls,omitempty"` // 工具调用列表
+}
+
+// jsonImage 是 JSON 格式的图片，数据以 base64 编码。
+type jsonImage struct {
+	MediaType string `json:"media_type"` // 媒体类型
+	Data      []byte `json:"data"`       // 图片数据
+}
+
+// jsonToolCall 是 JSON 格式的工具调用，参数保存为字符串以保留模型生成的原文。
+type jsonToolCall struct {
+	ID        string `json:"id"`                 // 工具调用 ID
+	Name      string `json:"name"`               // 函数名称
+	Arguments string `json:"arguments"`          // 函数参数
+	IsError   bool   `json:"is_error,omitempty"` // 工具调用是否失败
+}
+
+// encodeJSON 将消息列表以 JSON 格式编码到写入器中。
+func encodeJSON(w io.Writer, messages *[]proto.Message) error {
+	convo := jsonConversation{
+		Version:  jsonSchemaVersion,
+		Messages: make([]jsonMessage, 0, len(*messages)),
+	}
+	for _, msg := range *messages {
+		m := jsonMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+		for _, img := range msg.Images {
+			m.Images = append(m.Images, jsonImage{MediaType: img.MediaType, Data: img.Data})
+		}
+		for _, call := range msg.ToolCalls {
+			m.ToolCalls = append(m.ToolCalls, jsonToolCall{
+				ID:        call.ID,
+				Name:      call.Function.Name,
+				Arguments: string(call.Function.Arguments),
+				IsError:   call.IsError,
+			})
+		}
+		convo.Messages = append(convo.Messages, m)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(convo); err != nil {
+		return fmt.Errorf("编码: %w", err)
+	}
+	return nil
+}
+
+// decodeJSON 从读取器中解码 JSON 格式的消息列表。
+func decodeJSON(r io.Reader, messages *[]proto.Message) error {
+	var convo jsonConversation
+	if err := json.NewDecoder(r).Decode(&convo); err != nil {
+		return fmt.Errorf("解码: %w", err)
+	}
+	if convo.Version < 1 || convo.Version > jsonSchemaVersion {
+		return fmt.Errorf("解码: 不支持的 schema 版本 %d，请升级 mods", convo.Version)
+	}
+	for _, m := range convo.Messages {
+		msg := proto.Message{
+			Role:    m.Role,
+			Content: m.Content,
+		}
+		for _, img := range m.Images {
+			msg.Images = append(msg.Images, proto.Image{MediaType: img.MediaType, Data: img.Data})
+		}
+		for _, call := range m.ToolCalls {
+			tc := proto.ToolCall{
+				ID:       call.ID,
+				Function: proto.Function{Name: call.Name},
+				IsError:  call.IsError,
+			}
+			if call.Arguments != "" {
+				tc.Function.Arguments = []byte(call.Arguments)
+			}
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		*messages = append(*messages, msg)
+	}
+	return nil
+}
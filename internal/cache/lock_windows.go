@@ -0,0 +1,28 @@
+//go:build windows
+
+package cache
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile 打开并独占锁定 path，其它进程对同一文件加锁时会等待，
+// 返回的函数用于解锁
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600) //nolint:mnd
+	if err != nil {
+		return nil, fmt.Errorf("打开锁文件: %w", err)
+	}
+	h := windows.Handle(f.Fd())
+	if err := windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{}); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("锁定 %s: %w", path, err)
+	}
+	return func() {
+		_ = windows.UnlockFileEx(h, 0, 1, 0, &windows.Overlapped{})
+		_ = f.Close()
+	}, nil
+}
@@ -98,17 +98,27 @@ type Stream struct {
 	request *cohere.ChatStreamRequest                 // 原始请求
 	err     error                                     // 错误信息
 	done    bool                                      // 流是否完成
+	closed  bool                                      // 流是否已经关闭
 	message *cohere.Message                           // 累积的消息内容
+	usage   proto.Usage                               // 令牌用量
 }
 
+// Usage 实现 stream.Stream 接口。
+// 返回 stream-end 事件中计费的令牌用量。
+func (s *Stream) Usage() proto.Usage { return s.usage }
+
 // CallTools 实现 stream.Stream 接口。
 // 当前不支持工具调用功能。
 func (s *Stream) CallTools() []proto.ToolCallStatus { return nil }
 
 // Close 实现 stream.Stream 接口。
-// 关闭流并标记为已完成。
+// 关闭流并标记为已完成，可以重复调用，请求失败时没有需要关闭的流。
 func (s *Stream) Close() error {
 	s.done = true
+	if s.closed || s.stream == nil {
+		return nil
+	}
+	s.closed = true
 	return s.stream.Close() //nolint:wrapcheck
 }
 
@@ -119,10 +129,13 @@ func (s *Stream) Current() (proto.Chunk, error) {
 	resp, err := s.stream.Recv()
 	if errors.Is(err, io.EOF) {
 		// 流已结束，返回无内容错误
+		s.done = true
 		return proto.Chunk{}, stream.ErrNoContent
 	}
 	if err != nil {
-		return proto.Chunk{}, fmt.Errorf("cohere: %w", err)
+		// 包括上下文被取消，记录下来让 Next 停止迭代
+		s.err = fmt.Errorf("cohere: %w", err)
+		return proto.Chunk{}, s.err
 	}
 
 	// 根据事件类型处理响应
@@ -133,6 +146,18 @@ func (s *Stream) Current() (proto.Chunk, error) {
 		return proto.Chunk{
 			Content: resp.TextGeneration.Text,
 		}, nil
+	case "stream-end":
+		// 结束事件中带有计费的令牌用量
+		if end := resp.StreamEnd; end != nil && end.Response != nil && end.Response.Meta != nil {
+			if units := end.Response.Meta.BilledUnits; units != nil {
+				if n := units.InputTokens; n != nil {
+					s.usage.InputTokens = int64(*n)
+				}
+				if n := units.OutputTokens; n != nil {
+					s.usage.OutputTokens = int64(*n)
+				}
+			}
+		}
 	}
 	// 其他事件类型返回无内容错误
 	return proto.Chunk{}, stream.ErrNoContent
@@ -0,0 +1,50 @@
+package cohere
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/stream"
+	"github.com/charmbracelet/mods/internal/stream/streamtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	streamtest.Run(t, "application/stream+json",
+		`{"event_type":"text-generation","text":"你好"}`+"\n",
+		"你好",
+		func(ctx context.Context, baseURL string, client *http.Client) stream.Stream {
+			return New(Config{AuthToken: "x", BaseURL: baseURL, HTTPClient: client}).
+				Request(ctx, proto.Request{Model: "m", Messages: []proto.Message{{Role: proto.RoleUser, Content: "hi"}}})
+		},
+	)
+
+	t.Run("请求失败后关闭", func(t *testing.T) {
+		c := New(Config{AuthToken: "x", BaseURL: "http://127.0.0.1:0", HTTPClient: &http.Client{}})
+		s := c.Request(context.Background(), proto.Request{Model: "m"})
+		require.Error(t, s.Err())
+		require.False(t, s.Next())
+		require.NoError(t, s.Close())
+	})
+
+	t.Run("消息角色", func(t *testing.T) {
+		history, message := fromProtoMessages([]proto.Message{
+			{Role: proto.RoleSystem, Content: "系统"},
+			{Role: proto.RoleUser, Content: "问题"},
+			{Role: proto.RoleAssistant, Content: "回答"},
+			{Role: proto.RoleUser, Content: "追问"},
+		})
+		require.Equal(t, "追问", message)
+		require.Equal(t, []proto.Message{
+			{Role: proto.RoleSystem, Content: "系统"},
+			{Role: proto.RoleUser, Content: "问题"},
+			{Role: proto.RoleAssistant, Content: "回答"},
+		}, toProtoMessages(history))
+
+		history, message = fromProtoMessages(nil)
+		require.Empty(t, history)
+		require.Empty(t, message)
+	})
+}
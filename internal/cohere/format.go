@@ -8,22 +8,29 @@ import (
 // fromProtoMessages 将协议消息转换为 Cohere 格式的消息历史和当前消息。
 // 返回历史记录和当前用户消息。
 func fromProtoMessages(input []proto.Message) (history []*cohere.Message, message string) {
+	if len(input) == 0 {
+		return nil, ""
+	}
 	var messages []*cohere.Message //nolint:prealloc
-	// 遍历所有输入消息并转换为 Cohere 格式
+	// 遍历所有输入消息并转换为 Cohere 格式，消息内容放在与角色对应的字段中
 	for _, msg := range input {
-		messages = append(messages, &cohere.Message{
-			Role: fromProtoRole(msg.Role),
-			Chatbot: &cohere.ChatMessage{
-				Message: msg.Content,
-			},
-		})
-	}
-	// 如果有多条消息，则除最后一条外的所有消息作为历史记录
-	if len(messages) > 1 {
-		history = messages[:len(messages)-1]
+		chat := &cohere.ChatMessage{
+			Message: msg.Content,
+		}
+		m := &cohere.Message{Role: fromProtoRole(msg.Role)}
+		switch m.Role {
+		case "SYSTEM":
+			m.System = chat
+		case "CHATBOT":
+			m.Chatbot = chat
+		default:
+			m.User = chat
+		}
+		messages = append(messages, m)
 	}
-	// 最后一条消息作为当前用户消息
-	message = messages[len(messages)-1].User.Message
+	// 除最后一条外的所有消息作为历史记录，最后一条消息作为当前用户消息
+	history = messages[:len(messages)-1]
+	message = input[len(input)-1].Content
 	return history, message
 }
 
@@ -0,0 +1,56 @@
+package embeddings
+
+import (
+	"context"
+	"errors"
+
+	cohere "github.com/cohere-ai/cohere-go/v2"
+	"github.com/cohere-ai/cohere-go/v2/client"
+	"github.com/cohere-ai/cohere-go/v2/option"
+)
+
+// cohereBatchSize 是 Cohere 单次请求最多的文本数量
+const cohereBatchSize = 96
+
+// 确保 Cohere 实现了 Client 接口
+var _ Client = &Cohere{}
+
+// Cohere 通过 Cohere 的 /embed 端点请求向量，文本按检索用的文档处理。
+type Cohere struct {
+	client *client.Client
+}
+
+// NewCohere 使用给定的 [Config] 创建一个新的 [Cohere] 客户端。
+func NewCohere(config Config) *Cohere {
+	opts := []option.RequestOption{
+		client.WithToken(config.APIKey),
+		client.WithHTTPClient(config.httpClient()),
+	}
+	if config.BaseURL != "" {
+		opts = append(opts, client.WithBaseURL(config.BaseURL))
+	}
+	return &Cohere{client: client.NewClient(opts...)}
+}
+
+// Embed 实现 Client 接口。
+func (c *Cohere) Embed(ctx context.Context, model string, inputs []string) ([][]float64, error) {
+	return batched(inputs, cohereBatchSize, func(batch []string) ([][]float64, error) {
+		resp, err := c.client.Embed(ctx, &cohere.EmbedRequest{
+			Texts:          batch,
+			Model:          &model,
+			InputType:      cohere.EmbedInputTypeSearchDocument.Ptr(),
+			EmbeddingTypes: []cohere.EmbeddingType{cohere.EmbeddingTypeFloat},
+		})
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		switch {
+		case resp.EmbeddingsByType != nil && resp.EmbeddingsByType.Embeddings != nil:
+			return resp.EmbeddingsByType.Embeddings.Float, nil
+		case resp.EmbeddingsFloats != nil:
+			return resp.EmbeddingsFloats.Embeddings, nil
+		default:
+			return nil, errors.New("Cohere 没有返回向量")
+		}
+	})
+}
@@ -0,0 +1,65 @@
+// Package embeddings 为不同的提供方实现文本向量（embeddings）请求。
+// 每个提供方实现 [Client] 接口，调用方不需要关心各家 API 的差异。
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Client 为一批文本请求向量。
+type Client interface {
+	// Embed 返回与 inputs 一一对应的向量。
+	// 参数:
+	//   - ctx: 上下文，用于控制请求的生命周期
+	//   - model: 向量模型名称
+	//   - inputs: 需要向量的文本
+	// 返回:
+	//   - [][]float64: 每段文本的向量，顺序与 inputs 相同
+	//   - error: 请求失败时返回的错误
+	Embed(ctx context.Context, model string, inputs []string) ([][]float64, error)
+}
+
+// Config 表示向量客户端的配置信息。
+type Config struct {
+	// BaseURL 服务的基础 URL 地址，为空时使用提供方的默认地址
+	BaseURL string
+	// APIKey 认证使用的密钥，Ollama 不需要
+	APIKey string
+	// HTTPClient 自定义 HTTP 客户端，用于设置代理等
+	HTTPClient *http.Client
+}
+
+// httpClient 返回配置的 HTTP 客户端，没有配置时返回默认客户端。
+func (c Config) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{}
+}
+
+// batched 把 inputs 按 size 分批调用 fn，按顺序拼接结果。
+// 参数:
+//   - inputs: 所有文本
+//   - size: 每批最多的文本数量，提供方对单次请求的数量有限制
+//   - fn: 请求一批文本的函数
+//
+// 返回:
+//   - [][]float64: 所有文本的向量
+//   - error: 任意一批失败时返回的错误
+func batched(inputs []string, size int, fn func([]string) ([][]float64, error)) ([][]float64, error) {
+	vectors := make([][]float64, 0, len(inputs))
+	for start := 0; start < len(inputs); start += size {
+		batch := inputs[start:min(start+size, len(inputs))]
+		got, err := fn(batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(got) != len(batch) {
+			return nil, fmt.Errorf("请求了 %d 个向量，但收到 %d 个", len(batch), len(got))
+		}
+		vectors = append(vectors, got...)
+	}
+	return vectors, nil
+}
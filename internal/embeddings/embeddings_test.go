@@ -0,0 +1,104 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// vectorFor 返回测试用的向量，第一个值是文本的长度
+func vectorFor(text string) []float64 {
+	return []float64{float64(len(text)), 0.5}
+}
+
+func TestOpenAI(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/embeddings", r.URL.Path)
+		require.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		var req struct {
+			Input []string `json:"input"`
+			Model string   `json:"model"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "text-embedding-3-small", req.Model)
+		requests++
+		// 倒序返回，客户端按 index 排列
+		var data []map[string]any
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			data = append(data, map[string]any{"object": "embedding", "index": i, "embedding": vectorFor(req.Input[i])})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data})
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewOpenAI(Config{BaseURL: srv.URL, APIKey: "key"})
+	vectors, err := client.Embed(context.Background(), "text-embedding-3-small", []string{"a", "bb", "ccc"})
+	require.NoError(t, err)
+	require.Equal(t, [][]float64{vectorFor("a"), vectorFor("bb"), vectorFor("ccc")}, vectors)
+	require.Equal(t, 1, requests)
+}
+
+func TestOllama(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/embed", r.URL.Path)
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		embeddings := make([][]float64, len(req.Input))
+		for i, in := range req.Input {
+			embeddings[i] = vectorFor(in)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"model": req.Model, "embeddings": embeddings})
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewOllama(Config{BaseURL: srv.URL})
+	require.NoError(t, err)
+	vectors, err := client.Embed(context.Background(), "nomic-embed-text", []string{"hello", "hi"})
+	require.NoError(t, err)
+	require.Equal(t, [][]float64{vectorFor("hello"), vectorFor("hi")}, vectors)
+}
+
+func TestCohere(t *testing.T) {
+	var batches []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Texts     []string `json:"texts"`
+			InputType string   `json:"input_type"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "search_document", req.InputType)
+		batches = append(batches, len(req.Texts))
+		floats := make([][]float64, len(req.Texts))
+		for i, text := range req.Texts {
+			floats[i] = vectorFor(text)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"response_type": "embeddings_by_type",
+			"id":            "1",
+			"embeddings":    map[string]any{"float": floats},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	inputs := make([]string, cohereBatchSize+4)
+	for i := range inputs {
+		inputs[i] = fmt.Sprintf("text %d", i)
+	}
+	client := NewCohere(Config{BaseURL: srv.URL, APIKey: "key"})
+	vectors, err := client.Embed(context.Background(), "embed-v4.0", inputs)
+	require.NoError(t, err)
+	require.Len(t, vectors, len(inputs))
+	require.Equal(t, vectorFor(inputs[len(inputs)-1]), vectors[len(vectors)-1])
+	require.Equal(t, []int{cohereBatchSize, 4}, batches)
+}
@@ -0,0 +1,59 @@
+package embeddings
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ollamaBaseURL 是 Ollama 的默认地址
+const ollamaBaseURL = "http://localhost:11434/"
+
+// ollamaBatchSize 是 Ollama 单次请求的文本数量，避免一次占用过多内存
+const ollamaBatchSize = 256
+
+// 确保 Ollama 实现了 Client 接口
+var _ Client = &Ollama{}
+
+// Ollama 通过 Ollama 的 /api/embed 端点请求向量。
+type Ollama struct {
+	client *api.Client
+}
+
+// NewOllama 使用给定的 [Config] 创建一个新的 [Ollama] 客户端。
+// 返回:
+//   - *Ollama: 新创建的客户端
+//   - error: 解析 URL 失败时返回的错误
+func NewOllama(config Config) (*Ollama, error) {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = ollamaBaseURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	return &Ollama{client: api.NewClient(u, config.httpClient())}, nil
+}
+
+// Embed 实现 Client 接口。
+func (c *Ollama) Embed(ctx context.Context, model string, inputs []string) ([][]float64, error) {
+	return batched(inputs, ollamaBatchSize, func(batch []string) ([][]float64, error) {
+		resp, err := c.client.Embed(ctx, &api.EmbedRequest{
+			Model: model,
+			Input: batch,
+		})
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		vectors := make([][]float64, len(resp.Embeddings))
+		for i, embedding := range resp.Embeddings {
+			vectors[i] = make([]float64, len(embedding))
+			for j, v := range embedding {
+				vectors[i][j] = float64(v)
+			}
+		}
+		return vectors, nil
+	})
+}
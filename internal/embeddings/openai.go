@@ -0,0 +1,54 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// openAIBatchSize 是 OpenAI 单次请求最多的文本数量
+const openAIBatchSize = 2048
+
+// 确保 OpenAI 实现了 Client 接口
+var _ Client = &OpenAI{}
+
+// OpenAI 通过 OpenAI 及兼容 API 的 /embeddings 端点请求向量。
+type OpenAI struct {
+	client openai.Client
+}
+
+// NewOpenAI 使用给定的 [Config] 创建一个新的 [OpenAI] 客户端。
+func NewOpenAI(config Config) *OpenAI {
+	opts := []option.RequestOption{
+		option.WithAPIKey(config.APIKey),
+		option.WithHTTPClient(config.httpClient()),
+	}
+	if config.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(config.BaseURL))
+	}
+	return &OpenAI{client: openai.NewClient(opts...)}
+}
+
+// Embed 实现 Client 接口。
+func (c *OpenAI) Embed(ctx context.Context, model string, inputs []string) ([][]float64, error) {
+	return batched(inputs, openAIBatchSize, func(batch []string) ([][]float64, error) {
+		resp, err := c.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+			Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: batch},
+			Model: model,
+		})
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		// 按 index 排列，不依赖返回的顺序
+		vectors := make([][]float64, len(batch))
+		for _, data := range resp.Data {
+			if data.Index < 0 || int(data.Index) >= len(vectors) {
+				return nil, fmt.Errorf("无效的向量序号 %d", data.Index)
+			}
+			vectors[data.Index] = data.Embedding
+		}
+		return vectors, nil
+	})
+}
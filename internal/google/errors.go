@@ -0,0 +1,125 @@
+package google
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxErrorBodySize 是读取错误响应体的最大字节数
+const maxErrorBodySize = 64 * 1024
+
+// APIError 表示 Google API 返回的错误。
+// 对应响应体中的 error 对象，例如：
+//
+//	{"error": {"code": 429, "message": "...", "status": "RESOURCE_EXHAUSTED", "details": [...]}}
+type APIError struct {
+	// StatusCode 是 HTTP 状态码
+	StatusCode int
+	// Code 是响应体中的错误码，通常与 HTTP 状态码相同
+	Code int
+	// Message 是错误消息
+	Message string
+	// Status 是 google.rpc.Code 的名称，例如 RESOURCE_EXHAUSTED、INVALID_ARGUMENT
+	Status string
+	// Reason 是 google.rpc.ErrorInfo 中的原因，例如 API_KEY_INVALID
+	Reason string
+	// RetryDelay 是 google.rpc.RetryInfo 中建议的重试等待时间
+	RetryDelay time.Duration
+	// Header 是响应头
+	Header http.Header
+}
+
+// Error 实现 error 接口。
+func (e *APIError) Error() string {
+	if e.Status != "" {
+		return fmt.Sprintf("google: %d %s: %s", e.StatusCode, e.Status, e.Message)
+	}
+	return fmt.Sprintf("google: %d: %s", e.StatusCode, e.Message)
+}
+
+// errorBody 是错误响应体的结构。
+type errorBody struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			Type       string `json:"@type"`
+			Reason     string `json:"reason"`
+			RetryDelay string `json:"retryDelay"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// handleErrorResp 处理错误响应。
+// 该方法读取并关闭响应体，解析为 *APIError。
+// 参数：
+//   - resp: HTTP 响应对象
+//
+// 返回：
+//   - error: 解析后的 *APIError
+func (c *Client) handleErrorResp(resp *http.Response) error {
+	defer resp.Body.Close() //nolint:errcheck
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    err.Error(),
+			Header:     resp.Header,
+		}
+	}
+	return newAPIError(resp.StatusCode, resp.Header, data)
+}
+
+// newAPIError 解析错误响应体。
+// 不带 alt=sse 的流式接口把错误包在数组中返回，两种格式都能解析；
+// 响应体不是 JSON 时，原样作为错误消息。
+// 参数：
+//   - statusCode: HTTP 状态码，流中的错误事件为 0，此时使用响应体中的错误码
+//   - header: 响应头，可以为 nil
+//   - data: 响应体
+//
+// 返回：
+//   - *APIError: 解析后的错误
+func newAPIError(statusCode int, header http.Header, data []byte) *APIError {
+	e := &APIError{
+		StatusCode: statusCode,
+		Header:     header,
+	}
+	var body errorBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		var bodies []errorBody
+		if json.Unmarshal(data, &bodies) == nil && len(bodies) > 0 {
+			body = bodies[0]
+		}
+	}
+	if body.Error.Message == "" && body.Error.Status == "" {
+		e.Message = strings.TrimSpace(string(data))
+		if e.Message == "" {
+			e.Message = http.StatusText(statusCode)
+		}
+		return e
+	}
+
+	e.Code = body.Error.Code
+	e.Message = body.Error.Message
+	e.Status = body.Error.Status
+	if e.StatusCode == 0 {
+		e.StatusCode = e.Code
+	}
+	for _, d := range body.Error.Details {
+		switch {
+		case strings.HasSuffix(d.Type, "google.rpc.ErrorInfo"):
+			e.Reason = d.Reason
+		case strings.HasSuffix(d.Type, "google.rpc.RetryInfo"):
+			if delay, err := time.ParseDuration(d.RetryDelay); err == nil && delay > 0 {
+				e.RetryDelay = delay
+			}
+		}
+	}
+	return e
+}
@@ -0,0 +1,71 @@
+package google
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAPIError(t *testing.T) {
+	t.Run("限流和建议的等待时间", func(t *testing.T) {
+		e := newAPIError(http.StatusTooManyRequests, nil, []byte(`{"error": {
+			"code": 429,
+			"message": "Resource has been exhausted",
+			"status": "RESOURCE_EXHAUSTED",
+			"details": [{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "31s"}]
+		}}`))
+		require.Equal(t, "RESOURCE_EXHAUSTED", e.Status)
+		require.Equal(t, "Resource has been exhausted", e.Message)
+		require.Equal(t, 31*time.Second, e.RetryDelay)
+	})
+
+	t.Run("数组中的错误", func(t *testing.T) {
+		e := newAPIError(http.StatusBadRequest, nil, []byte(`[{"error": {
+			"code": 400,
+			"message": "API key not valid.",
+			"status": "INVALID_ARGUMENT",
+			"details": [{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "API_KEY_INVALID"}]
+		}}]`))
+		require.Equal(t, "INVALID_ARGUMENT", e.Status)
+		require.Equal(t, "API_KEY_INVALID", e.Reason)
+	})
+
+	t.Run("流中的错误事件使用响应体中的错误码", func(t *testing.T) {
+		e := newAPIError(0, nil, []byte(`{"error": {"code": 503, "message": "overloaded", "status": "UNAVAILABLE"}}`))
+		require.Equal(t, http.StatusServiceUnavailable, e.StatusCode)
+	})
+
+	t.Run("不是 JSON", func(t *testing.T) {
+		e := newAPIError(http.StatusBadGateway, nil, []byte("<html>bad gateway</html>\n"))
+		require.Equal(t, "<html>bad gateway</html>", e.Message)
+		require.Equal(t, "google: 502: <html>bad gateway</html>", e.Error())
+
+		e = newAPIError(http.StatusBadGateway, nil, nil)
+		require.Equal(t, "Bad Gateway", e.Message)
+	})
+}
+
+func TestRequestError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error": {"code": 429, "message": "quota", "status": "RESOURCE_EXHAUSTED"}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := New(Config{BaseURL: srv.URL, HTTPClient: srv.Client()})
+	s := client.Request(context.Background(), proto.Request{
+		Messages: []proto.Message{{Role: proto.RoleUser, Content: "hi"}},
+	})
+	require.False(t, s.Next())
+	var e *APIError
+	require.ErrorAs(t, s.Err(), &e)
+	require.Equal(t, http.StatusTooManyRequests, e.StatusCode)
+	require.Equal(t, "quota", e.Message)
+	require.Equal(t, "5", e.Header.Get("Retry-After"))
+}
@@ -1,6 +1,49 @@
 package google
 
-import "github.com/charmbracelet/mods/internal/proto"
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// roleModel 是 Google API 中助手消息的角色名称
+const roleModel = "model"
+
+// fromMCPTools 将 MCP 工具映射转换为 Google API 的工具列表。
+// 参数：
+//   - mcps: MCP 工具映射，键为服务器名称，值为该服务器提供的工具列表
+// 返回：
+//   - []Tool: Google API 格式的工具列表，没有工具时为 nil
+func fromMCPTools(mcps map[string][]mcp.Tool) []Tool {
+	var decls []FunctionDeclaration
+	for name, serverTools := range mcps {
+		for _, tool := range serverTools {
+			properties := tool.InputSchema.Properties
+			if properties == nil {
+				properties = map[string]any{}
+			}
+			schema := map[string]any{
+				"type":       "object",
+				"properties": properties,
+			}
+			if len(tool.InputSchema.Required) > 0 {
+				schema["required"] = tool.InputSchema.Required
+			}
+			// 工具名称格式为 "服务器名_工具名"
+			decls = append(decls, FunctionDeclaration{
+				Name:                 fmt.Sprintf("%s_%s", name, tool.Name),
+				Description:          tool.Description,
+				ParametersJSONSchema: schema,
+			})
+		}
+	}
+	if len(decls) == 0 {
+		return nil
+	}
+	return []Tool{{FunctionDeclarations: decls}}
+}
 
 // fromProtoMessages 将协议层的消息列表转换为 Google API 的 Content 格式。
 // 该函数处理系统消息和用户消息，将它们统一转换为用户角色的内容。
@@ -17,11 +60,139 @@ func fromProtoMessages(input []proto.Message) []Content {
 		switch in.Role {
 		case proto.RoleSystem, proto.RoleUser:
 			// 将系统消息和用户消息都转换为用户角色的内容
+			parts := []Part{{Text: in.Content}}
+			// 附带的图片以内联数据的形式发送
+			for _, img := range in.Images {
+				parts = append(parts, Part{InlineData: &Blob{
+					MimeType: img.MediaType,
+					Data:     img.Data,
+				}})
+			}
 			result = append(result, Content{
 				Role:  proto.RoleUser,
-				Parts: []Part{{Text: in.Content}},
+				Parts: parts,
 			})
+		case proto.RoleAssistant:
+			var parts []Part
+			if in.Content != "" {
+				parts = append(parts, Part{Text: in.Content})
+			}
+			for _, call := range in.ToolCalls {
+				parts = append(parts, Part{FunctionCall: newFunctionCall(call.ID, call.Function.Name, call.Function.Arguments)})
+			}
+			if len(parts) == 0 {
+				continue
+			}
+			result = append(result, Content{
+				Role:  roleModel,
+				Parts: parts,
+			})
+		case proto.RoleTool:
+			// 工具结果作为用户消息发送，连续的工具结果合并到同一条消息中
+			for _, call := range in.ToolCalls {
+				part := Part{FunctionResponse: newFunctionResponse(call.ID, call.Function.Name, in.Content, call.IsError)}
+				if n := len(result); n > 0 && isFunctionResponses(result[n-1]) {
+					result[n-1].Parts = append(result[n-1].Parts, part)
+				} else {
+					result = append(result, Content{
+						Role:  proto.RoleUser,
+						Parts: []Part{part},
+					})
+				}
+				break
+			}
 		}
 	}
 	return result
 }
+
+// toProtoMessage 将模型返回的内容转换为协议层的助手消息。
+// 参数：
+//   - in: Google API 格式的内容
+// 返回：
+//   - proto.Message: 协议层的消息对象
+func toProtoMessage(in Content) proto.Message {
+	msg := proto.Message{
+		Role: proto.RoleAssistant,
+	}
+	for _, part := range in.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			args, _ := json.Marshal(part.FunctionCall.Args)
+			msg.ToolCalls = append(msg.ToolCalls, proto.ToolCall{
+				ID: functionCallID(part.FunctionCall),
+				Function: proto.Function{
+					Name:      part.FunctionCall.Name,
+					Arguments: args,
+				},
+			})
+		case !part.Thought:
+			msg.Content += part.Text
+		}
+	}
+	return msg
+}
+
+// newFunctionCall 创建函数调用。
+// 参数：
+//   - id: 工具调用 ID
+//   - name: 工具名称
+//   - args: JSON 格式的参数
+// 返回：
+//   - *FunctionCall: 函数调用对象
+func newFunctionCall(id, name string, args []byte) *FunctionCall {
+	// 参数必须是 JSON 对象，没有参数时发送空对象
+	input := map[string]any{}
+	_ = json.Unmarshal(args, &input)
+	call := &FunctionCall{
+		Name: name,
+		Args: input,
+	}
+	// 没有 ID 的调用在转换时以名称作为 ID，发回时不再附带
+	if id != name {
+		call.ID = id
+	}
+	return call
+}
+
+// newFunctionResponse 创建函数调用结果。
+// 参数：
+//   - id: 工具调用 ID
+//   - name: 工具名称
+//   - content: 工具执行结果内容
+//   - isError: 是否为错误结果
+// 返回：
+//   - *FunctionResponse: 函数调用结果对象
+func newFunctionResponse(id, name, content string, isError bool) *FunctionResponse {
+	key := "output"
+	if isError {
+		key = "error"
+	}
+	resp := &FunctionResponse{
+		Name:     name,
+		Response: map[string]any{key: content},
+	}
+	if id != name {
+		resp.ID = id
+	}
+	return resp
+}
+
+// functionCallID 返回函数调用的 ID。
+// Generative Language API 通常不返回 ID，此时以函数名称代替。
+func functionCallID(call *FunctionCall) string {
+	if call.ID != "" {
+		return call.ID
+	}
+	return call.Name
+}
+
+// isFunctionResponses 判断内容是否只包含函数调用结果
+func isFunctionResponses(c Content) bool {
+	for _, part := range c.Parts {
+		if part.FunctionResponse == nil {
+			return false
+		}
+	}
+	return c.Role == proto.RoleUser && len(c.Parts) > 0
+}
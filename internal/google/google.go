@@ -15,7 +15,7 @@ import (
 
 	"github.com/charmbracelet/mods/internal/proto"
 	"github.com/charmbracelet/mods/internal/stream"
-	"github.com/openai/openai-go"
+	"golang.org/x/oauth2"
 )
 
 // 确保 Client 实现了 stream.Client 接口
@@ -38,9 +38,9 @@ type Config struct {
 	BaseURL string
 	// HTTPClient 是用于发送 HTTP 请求的客户端实例
 	HTTPClient *http.Client
-	// ThinkingBudget 设置模型的思考预算（thinking budget），
-	// 用于控制模型在生成响应时的思考深度
-	ThinkingBudget int
+	// TokenSource 提供 OAuth2 访问令牌，用于 Vertex AI；
+	// 为空时认证信息包含在 BaseURL 的 key 参数中
+	TokenSource oauth2.TokenSource
 }
 
 // DefaultConfig 返回 Google API 客户端的默认配置。
@@ -61,6 +61,62 @@ func DefaultConfig(model, authToken string) Config {
 type Part struct {
 	// Text 包含文本内容
 	Text string `json:"text,omitempty"`
+	// InlineData 包含内联的媒体数据（如图片）
+	InlineData *Blob `json:"inlineData,omitempty"`
+	// FunctionCall 包含模型发起的函数调用
+	FunctionCall *FunctionCall `json:"functionCall,omitempty"`
+	// FunctionResponse 包含函数调用的执行结果
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+	// Thought 标记该部分是否为模型的思考内容
+	Thought bool `json:"thought,omitempty"`
+	// ThoughtSignature 是模型思考过程的签名，
+	// 后续轮次中需要原样发回以保持上下文
+	ThoughtSignature string `json:"thoughtSignature,omitempty"`
+}
+
+// FunctionCall 表示模型请求调用的函数。
+type FunctionCall struct {
+	// ID 是函数调用的唯一标识，可能为空
+	ID string `json:"id,omitempty"`
+	// Name 是要调用的函数名称
+	Name string `json:"name"`
+	// Args 是 JSON 对象形式的函数参数
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// FunctionResponse 表示函数调用的执行结果。
+type FunctionResponse struct {
+	// ID 对应函数调用的 ID
+	ID string `json:"id,omitempty"`
+	// Name 是被调用的函数名称
+	Name string `json:"name"`
+	// Response 是 JSON 对象形式的执行结果
+	Response map[string]any `json:"response"`
+}
+
+// Tool 表示模型可以使用的一组工具。
+type Tool struct {
+	// FunctionDeclarations 包含可调用函数的声明列表
+	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations,omitempty"`
+}
+
+// FunctionDeclaration 描述一个可供模型调用的函数。
+type FunctionDeclaration struct {
+	// Name 是函数名称
+	Name string `json:"name"`
+	// Description 是函数的用途说明
+	Description string `json:"description,omitempty"`
+	// ParametersJSONSchema 是以 JSON Schema 描述的函数参数
+	ParametersJSONSchema any `json:"parametersJsonSchema,omitempty"`
+}
+
+// Blob 是内联的原始媒体数据。
+// Data 在 JSON 中会被编码为 base64 字符串。
+type Blob struct {
+	// MimeType 表示数据的 MIME 类型
+	MimeType string `json:"mimeType"`
+	// Data 包含原始字节数据
+	Data []byte `json:"data"`
 }
 
 // Content 是包含多部分消息内容的基础结构化数据类型。
@@ -77,6 +133,8 @@ type Content struct {
 type ThinkingConfig struct {
 	// ThinkingBudget 设置思考预算值
 	ThinkingBudget int `json:"thinkingBudget,omitempty"`
+	// IncludeThoughts 要求在回复中返回思考内容的摘要
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
 }
 
 // GenerationConfig 包含模型生成和输出的配置选项。
@@ -105,6 +163,8 @@ type GenerationConfig struct {
 type MessageCompletionRequest struct {
 	// Contents 包含对话历史消息列表
 	Contents []Content `json:"contents,omitempty"`
+	// Tools 包含模型可以调用的工具列表
+	Tools []Tool `json:"tools,omitempty"`
 	// GenerationConfig 包含生成配置选项
 	GenerationConfig GenerationConfig `json:"generationConfig,omitempty"`
 }
@@ -151,11 +211,10 @@ type Client struct {
 // 返回：
 //   - stream.Stream: 流式响应对象
 func (c *Client) Request(ctx context.Context, request proto.Request) stream.Stream {
-	// 创建新的流对象
-	stream := new(Stream)
 	// 构建请求体
 	body := MessageCompletionRequest{
 		Contents: fromProtoMessages(request.Messages),
+		Tools:    fromMCPTools(request.Tools),
 		GenerationConfig: GenerationConfig{
 			ResponseMimeType: "",
 			CandidateCount:   1,
@@ -183,25 +242,24 @@ func (c *Client) Request(ctx context.Context, request proto.Request) stream.Stre
 	}
 
 	// 设置思考预算配置（如果提供）
-	if c.config.ThinkingBudget != 0 {
+	if request.ThinkingBudget != 0 {
 		body.GenerationConfig.ThinkingConfig = &ThinkingConfig{
-			ThinkingBudget: c.config.ThinkingBudget,
+			ThinkingBudget:  request.ThinkingBudget,
+			IncludeThoughts: true,
 		}
 	}
 
-	// 构建新的 HTTP 请求
-	req, err := c.newRequest(ctx, http.MethodPost, c.config.BaseURL, withBody(body))
-	if err != nil {
-		stream.err = err
-		return stream
-	}
-
-	// 发送流式请求
-	stream, err = googleSendRequestStream(c, req)
-	if err != nil {
-		stream.err = err
+	// 创建新的流对象并发送第一轮请求
+	s := &Stream{
+		ctx:         ctx,
+		client:      c,
+		request:     body,
+		toolCall:    request.ToolCaller,
+		messages:    request.Messages,
+		unmarshaler: &JSONUnmarshaler{},
 	}
-	return stream
+	s.start()
+	return s
 }
 
 // New 使用给定的配置创建一个新的 Client 实例。
@@ -244,25 +302,6 @@ func (c *Client) newRequest(ctx context.Context, method, url string, setters ...
 	return req, nil
 }
 
-// handleErrorResp 处理错误响应。
-// 该方法解析 HTTP 错误响应并返回相应的错误对象。
-// 参数：
-//   - resp: HTTP 响应对象
-// 返回：
-//   - error: 解析后的错误对象
-func (c *Client) handleErrorResp(resp *http.Response) error {
-	// 解析响应体中的错误信息
-	var errRes openai.Error
-	if err := json.NewDecoder(resp.Body).Decode(&errRes); err != nil {
-		return &openai.Error{
-			StatusCode: resp.StatusCode,
-			Message:    err.Error(),
-		}
-	}
-	errRes.StatusCode = resp.StatusCode
-	return &errRes
-}
-
 // Candidate 表示模型生成的响应候选。
 // 每个候选包含生成的内容和相关的元数据。
 type Candidate struct {
@@ -281,13 +320,37 @@ type Candidate struct {
 type CompletionMessageResponse struct {
 	// Candidates 包含生成的候选响应列表
 	Candidates []Candidate `json:"candidates,omitempty"`
+	// UsageMetadata 包含截至当前数据块的令牌用量
+	UsageMetadata *UsageMetadata `json:"usageMetadata,omitempty"`
+}
+
+// UsageMetadata 表示请求的令牌用量。
+// 流式响应中每个数据块都带有截至当时的累计值。
+type UsageMetadata struct {
+	// PromptTokenCount 表示提示的令牌数量
+	PromptTokenCount int64 `json:"promptTokenCount,omitempty"`
+	// CandidatesTokenCount 表示生成内容的令牌数量
+	CandidatesTokenCount int64 `json:"candidatesTokenCount,omitempty"`
+	// ThoughtsTokenCount 表示思考过程的令牌数量
+	ThoughtsTokenCount int64 `json:"thoughtsTokenCount,omitempty"`
 }
 
 // Stream 表示来自 Google API 的消息流。
 // 该结构体实现了流式读取 API 响应的功能。
+// 模型发起函数调用后，执行工具并将结果追加到请求中，再发起新一轮请求。
 type Stream struct {
-	// isFinished 标记流是否已结束
+	// ctx 是请求上下文
+	ctx context.Context
+	// client 用于发起后续轮次的请求
+	client *Client
+	// request 是请求体，随工具调用轮次追加消息
+	request MessageCompletionRequest
+	// isFinished 标记当前轮次的响应是否已读取完毕
 	isFinished bool
+	// done 标记当前轮次是否已完成并保存了消息
+	done bool
+	// closed 标记流是否已经关闭，关闭后不再发起新一轮请求
+	closed bool
 	// reader 用于读取流数据的缓冲读取器
 	reader *bufio.Reader
 	// response HTTP 响应对象
@@ -297,18 +360,98 @@ type Stream struct {
 	// unmarshaler 用于反序列化 JSON 数据
 	unmarshaler Unmarshaler
 
+	// message 当前轮次累积的模型回复
+	message Content
+	// toolCall 工具调用处理函数
+	toolCall func(name string, data []byte) (string, error)
+	// messages 消息历史记录
+	messages []proto.Message
+
+	// usage 已完成轮次的累计令牌用量
+	usage proto.Usage
+	// roundUsage 当前轮次最近一个数据块中的令牌用量
+	roundUsage proto.Usage
+
 	// httpHeader 嵌入的 HTTP 头部
 	httpHeader
 }
 
+// start 发起一轮新的请求并重置当前轮次的状态
+func (s *Stream) start() {
+	s.isFinished = false
+	s.message = Content{Role: roleModel}
+	s.roundUsage = proto.Usage{}
+
+	// 构建新的 HTTP 请求
+	opts := []requestOption{withBody(s.request)}
+	if ts := s.client.config.TokenSource; ts != nil {
+		token, err := ts.Token()
+		if err != nil {
+			s.err = fmt.Errorf("无法获取访问令牌: %w", err)
+			return
+		}
+		opts = append(opts, withHeader("Authorization", "Bearer "+token.AccessToken))
+	}
+	req, err := s.client.newRequest(s.ctx, http.MethodPost, s.client.config.BaseURL, opts...)
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	// 发送流式请求
+	resp, err := googleSendRequestStream(s.client, req)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.response = resp
+	s.reader = bufio.NewReader(resp.Body)
+	s.httpHeader = httpHeader(resp.Header)
+}
+
+// Usage 实现 stream.Stream 接口。
+// 返回所有轮次累计的令牌用量。
+// 返回：
+//   - proto.Usage: 令牌用量
+func (s *Stream) Usage() proto.Usage {
+	u := s.usage
+	u.Add(s.roundUsage)
+	return u
+}
+
 // CallTools 实现 stream.Stream 接口。
-// 返回工具调用状态列表。
-// 注意：Gemini/Google API 目前尚不支持工具调用。
+// 执行本轮模型发起的所有函数调用，并将结果放在同一条消息中发回。
 // 返回：
-//   - []proto.ToolCallStatus: 工具调用状态列表（当前为 nil）
+//   - []proto.ToolCallStatus: 工具调用状态列表
 func (s *Stream) CallTools() []proto.ToolCallStatus {
-	// Gemini/Google API 目前尚不支持工具调用
-	return nil
+	var pending []stream.Call
+	for _, part := range s.message.Parts {
+		call := part.FunctionCall
+		if call == nil {
+			continue
+		}
+		args, _ := json.Marshal(call.Args)
+		pending = append(pending, stream.Call{
+			ID:        functionCallID(call),
+			Name:      call.Name,
+			Arguments: args,
+		})
+	}
+	// 并发执行函数调用，按原来的顺序写回
+	msgs, statuses := stream.CallTools(pending, s.toolCall)
+	parts := make([]Part, 0, len(msgs))
+	for i, msg := range msgs {
+		resp := newFunctionResponse(pending[i].ID, pending[i].Name, msg.Content, statuses[i].Err != nil)
+		parts = append(parts, Part{FunctionResponse: resp})
+		s.messages = append(s.messages, msg)
+	}
+	if len(parts) > 0 {
+		s.request.Contents = append(s.request.Contents, Content{
+			Role:  proto.RoleUser,
+			Parts: parts,
+		})
+	}
+	return statuses
 }
 
 // Err 实现 stream.Stream 接口。
@@ -318,33 +461,60 @@ func (s *Stream) CallTools() []proto.ToolCallStatus {
 func (s *Stream) Err() error { return s.err }
 
 // Messages 实现 stream.Stream 接口。
-// 返回流式消息列表。
-// 注意：Gemini 不支持在事后返回流式消息。
+// 返回消息历史记录。
 // 返回：
-//   - []proto.Message: 消息列表（当前为 nil）
-func (s *Stream) Messages() []proto.Message {
-	// Gemini 不支持在事后返回流式消息
-	return nil
-}
+//   - []proto.Message: 消息列表
+func (s *Stream) Messages() []proto.Message { return s.messages }
 
 // Next 实现 stream.Stream 接口。
 // 检查流是否还有更多数据可读。
+// 如果上一轮已完成（例如在工具调用之后），则发起新一轮请求。
 // 返回：
 //   - bool: 如果流未结束返回 true，否则返回 false
 func (s *Stream) Next() bool {
-	return !s.isFinished
+	if s.err != nil || s.closed {
+		return false
+	}
+	if s.done {
+		s.done = false
+		if s.response != nil {
+			_ = s.response.Body.Close()
+		}
+		s.start()
+		if s.err != nil {
+			return false
+		}
+	}
+	if !s.isFinished {
+		return true
+	}
+
+	// 本轮响应已读取完毕，保存模型回复
+	s.done = true
+	s.usage.Add(s.roundUsage)
+	s.roundUsage = proto.Usage{}
+	s.request.Contents = append(s.request.Contents, s.message)
+	s.messages = append(s.messages, toProtoMessage(s.message))
+	return false
 }
 
-// Close 关闭流并释放相关资源。
+// Close 关闭流并释放相关资源，可以重复调用。
 // 返回：
 //   - error: 关闭过程中发生的错误
 func (s *Stream) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.response == nil {
+		return nil
+	}
 	return s.response.Body.Close() //nolint:wrapcheck
 }
 
 // Current 实现 stream.Stream 接口。
 // 读取并返回流中的当前数据块。
-// 该方法处理流式响应的解析和错误处理。
+// 该方法处理流式响应的解析和错误处理，并将数据块累积到当前轮次的回复中。
 // 返回：
 //   - proto.Chunk: 数据块
 //   - error: 错误信息
@@ -364,7 +534,9 @@ func (s *Stream) Current() (proto.Chunk, error) {
 				s.isFinished = true
 				return proto.Chunk{}, stream.ErrNoContent // 表示流结束，不是真正的错误
 			}
-			return proto.Chunk{}, fmt.Errorf("googleStreamReader.processLines: %w", readErr)
+			// 包括上下文被取消，记录下来让 Next 停止迭代
+			s.err = fmt.Errorf("googleStreamReader.processLines: %w", readErr)
+			return proto.Chunk{}, s.err
 		}
 
 		// 去除首尾空白字符
@@ -381,7 +553,7 @@ func (s *Stream) Current() (proto.Chunk, error) {
 		if !bytes.HasPrefix(noSpaceLine, googleHeaderData) || hasError {
 			if hasError {
 				noSpaceLine = bytes.TrimPrefix(noSpaceLine, googleHeaderData)
-				return proto.Chunk{}, fmt.Errorf("googleStreamReader.processLines: %s", noSpaceLine)
+				return proto.Chunk{}, newAPIError(0, nil, noSpaceLine)
 			}
 			emptyMessagesCount++
 			if emptyMessagesCount > emptyMessagesLimit {
@@ -399,49 +571,79 @@ func (s *Stream) Current() (proto.Chunk, error) {
 		if unmarshalErr != nil {
 			return proto.Chunk{}, fmt.Errorf("googleStreamReader.processLines: %w", unmarshalErr)
 		}
+		// 记录令牌用量，思考过程的令牌按输出计费
+		if u := chunk.UsageMetadata; u != nil {
+			s.roundUsage = proto.Usage{
+				InputTokens:  u.PromptTokenCount,
+				OutputTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+			}
+		}
 		// 检查是否有候选响应
 		if len(chunk.Candidates) == 0 {
 			return proto.Chunk{}, stream.ErrNoContent
 		}
-		// 检查候选响应是否有内容部分
-		parts := chunk.Candidates[0].Content.Parts
-		if len(parts) == 0 {
+
+		// 累积第一个候选的所有部分，返回其中的文本和思考内容
+		var text, thought string
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			s.accumulate(part)
+			switch {
+			case part.FunctionCall != nil:
+			case part.Thought:
+				thought += part.Text
+			default:
+				text += part.Text
+			}
+		}
+		if text == "" && thought == "" {
 			return proto.Chunk{}, stream.ErrNoContent
 		}
-
-		// 返回第一个候选的第一个部分的文本内容
 		return proto.Chunk{
-			Content: chunk.Candidates[0].Content.Parts[0].Text,
+			Content:   text,
+			Reasoning: thought,
 		}, nil
 	}
 }
 
+// accumulate 将数据块中的一个部分累积到当前轮次的回复中。
+// 连续的文本片段合并为一个部分，其余部分（函数调用、思考签名等）原样保留。
+func (s *Stream) accumulate(part Part) {
+	if n := len(s.message.Parts); n > 0 && isPlainText(part) && isPlainText(s.message.Parts[n-1]) {
+		s.message.Parts[n-1].Text += part.Text
+		return
+	}
+	s.message.Parts = append(s.message.Parts, part)
+}
+
+// isPlainText 判断部分是否为普通文本
+func isPlainText(part Part) bool {
+	return part.FunctionCall == nil &&
+		part.FunctionResponse == nil &&
+		part.InlineData == nil &&
+		!part.Thought &&
+		part.ThoughtSignature == ""
+}
+
 // googleSendRequestStream 发送流式请求到 Google API。
-// 该方法设置请求头并发送 HTTP 请求，返回流式响应对象。
+// 该方法设置请求头并发送 HTTP 请求，返回流式响应。
 // 参数：
 //   - client: Google API 客户端
 //   - req: HTTP 请求对象
 // 返回：
-//   - *Stream: 流式响应对象
+//   - *http.Response: 流式响应，响应体在 Stream.Close() 中关闭
 //   - error: 错误信息
-func googleSendRequestStream(client *Client, req *http.Request) (*Stream, error) {
+func googleSendRequestStream(client *Client, req *http.Request) (*http.Response, error) {
 	// 设置请求内容类型为 JSON
 	req.Header.Set("content-type", "application/json")
 
 	// 发送 HTTP 请求
 	resp, err := client.config.HTTPClient.Do(req) //nolint:bodyclose // body 在 stream.Close() 中关闭
 	if err != nil {
-		return new(Stream), err
+		return nil, err
 	}
 	// 检查响应状态码
 	if isFailureStatusCode(resp) {
-		return new(Stream), client.handleErrorResp(resp)
+		return nil, client.handleErrorResp(resp)
 	}
-	// 返回流对象
-	return &Stream{
-		reader:      bufio.NewReader(resp.Body),
-		response:    resp,
-		unmarshaler: &JSONUnmarshaler{},
-		httpHeader:  httpHeader(resp.Header),
-	}, nil
+	return resp, nil
 }
@@ -0,0 +1,22 @@
+package google
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/stream"
+	"github.com/charmbracelet/mods/internal/stream/streamtest"
+)
+
+func TestStream(t *testing.T) {
+	streamtest.Run(t, "text/event-stream",
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"你好"}]}}]}`+"\n\n",
+		"你好",
+		func(ctx context.Context, baseURL string, client *http.Client) stream.Stream {
+			return New(Config{BaseURL: baseURL, HTTPClient: client}).
+				Request(ctx, proto.Request{Model: "m"})
+		},
+	)
+}
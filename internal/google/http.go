@@ -122,6 +122,18 @@ func withBody(body MessageCompletionRequest) requestOption {
 	}
 }
 
+// withHeader 返回一个设置请求头的选项函数。
+// 参数：
+//   - key: 请求头名称
+//   - value: 请求头的值
+// 返回：
+//   - requestOption: 选项函数
+func withHeader(key, value string) requestOption {
+	return func(args *requestOptions) {
+		args.header.Set(key, value)
+	}
+}
+
 // ErrorAccumulator 是累积错误的接口。
 // 该接口用于收集和处理错误信息。
 type ErrorAccumulator interface {
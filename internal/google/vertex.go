@@ -0,0 +1,59 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	googleauth "golang.org/x/oauth2/google"
+)
+
+// vertexScope 是访问 Vertex AI 所需的 OAuth2 权限范围
+const vertexScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// vertexDefaultRegion 是未配置区域时使用的 Vertex AI 区域
+const vertexDefaultRegion = "us-central1"
+
+// VertexConfig 返回通过 Vertex AI 访问 Gemini 的客户端配置。
+// 凭证通过应用默认凭据（ADC）获取：GOOGLE_APPLICATION_CREDENTIALS 指向的服务账号文件、
+// gcloud auth application-default login 的用户凭据或 GCE/GKE 元数据服务。
+// 参数：
+//   - ctx: 上下文，用于查找凭据
+//   - model: 要使用的模型名称
+//   - project: GCP 项目 ID，为空时使用凭据中的项目
+//   - region: Vertex AI 区域，为空时使用 us-central1，"global" 表示全局端点
+//
+// 返回：
+//   - Config: 包含 Vertex AI 端点与令牌来源的配置对象
+//   - error: 查找凭据失败或缺少项目 ID 时返回的错误
+func VertexConfig(ctx context.Context, model, project, region string) (Config, error) {
+	creds, err := googleauth.FindDefaultCredentials(ctx, vertexScope)
+	if err != nil {
+		return Config{}, fmt.Errorf("vertex: 无法获取应用默认凭据: %w", err)
+	}
+	if project == "" {
+		project = creds.ProjectID
+	}
+	if project == "" {
+		return Config{}, errors.New("vertex: 未配置 GCP 项目")
+	}
+	if region == "" {
+		region = vertexDefaultRegion
+	}
+
+	// 全局端点没有区域前缀
+	host := region + "-aiplatform.googleapis.com"
+	if region == "global" {
+		host = "aiplatform.googleapis.com"
+	}
+
+	return Config{
+		BaseURL: fmt.Sprintf(
+			"https://%s/v1/projects/%s/locations/%s/publishers/google/models/%s:streamGenerateContent?alt=sse",
+			host, project, region, model,
+		),
+		HTTPClient:  &http.Client{},
+		TokenSource: creds.TokenSource,
+	}, nil
+}
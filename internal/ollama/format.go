@@ -65,6 +65,11 @@ func fromProtoMessage(input proto.Message) api.Message {
 		Role:    input.Role,    // 消息角色（user/assistant/system）
 	}
 
+	// 转换附带的图片
+	for _, img := range input.Images {
+		m.Images = append(m.Images, api.ImageData(img.Data))
+	}
+
 	// 转换工具调用信息
 	for _, call := range input.ToolCalls {
 		var args api.ToolCallFunctionArguments
@@ -83,6 +83,16 @@ func (c *Client) Request(ctx context.Context, request proto.Request) stream.Stre
 		Options:  map[string]any{},                // 初始化选项映射
 	}
 
+	// 先放入额外的推理选项，下面的通用参数优先
+	for k, v := range request.Options {
+		body.Options[k] = v
+	}
+
+	// 设置模型在内存中保留的时间
+	if request.KeepAlive != nil {
+		body.KeepAlive = &api.Duration{Duration: *request.KeepAlive}
+	}
+
 	// 设置停止标记（Stop Sequence）
 	if len(request.Stop) > 0 {
 		body.Options["stop"] = request.Stop[0]
@@ -106,16 +116,35 @@ func (c *Client) Request(ctx context.Context, request proto.Request) stream.Stre
 	s.request = body
 	s.messages = request.Messages
 
-	// 初始化流式响应处理工厂函数
+	// 初始化流式响应处理工厂函数，每一轮使用单独的通道和可以取消的上下文
 	s.factory = func() {
 		s.done = false
-		s.err = nil
-		s.respCh = make(chan api.ChatResponse)
-		// 启动 goroutine 异步处理聊天响应
+		if s.cancel != nil {
+			// 结束上一轮可能还在收尾的请求
+			s.cancel()
+		}
+		roundCtx, cancel := context.WithCancel(ctx)
+		respCh := make(chan api.ChatResponse)
+		errCh := make(chan error, 1)
+		s.cancel, s.respCh, s.errCh = cancel, respCh, errCh
+		request := s.request
+		// 启动 goroutine 异步处理聊天响应，请求结束后关闭响应通道
 		go func() {
-			if err := c.Chat(ctx, &s.request, s.fn); err != nil {
-				s.err = err
+			defer close(respCh)
+			err := c.Chat(roundCtx, &request, func(resp api.ChatResponse) error {
+				// 调用者不再读取时不阻塞发送
+				select {
+				case respCh <- resp:
+					return nil
+				case <-roundCtx.Done():
+					return roundCtx.Err() //nolint:wrapcheck
+				}
+			})
+			if err == nil {
+				// 取消时读取中断，Ollama 的客户端不返回错误
+				err = roundCtx.Err()
 			}
+			errCh <- err
 		}()
 	}
 
@@ -129,84 +158,99 @@ type Stream struct {
 	request  api.ChatRequest                              // 聊天请求对象
 	err      error                                        // 存储可能发生的错误
 	done     bool                                         // 标记响应是否完成
+	ended    bool                                         // 本轮的回答是否已经保存
+	closed   bool                                         // 流是否已经关闭
 	factory  func()                                       // 重置并重新启动流的工厂函数
-	respCh   chan api.ChatResponse                        // 响应通道，用于接收流式响应
+	cancel   context.CancelFunc                           // 取消本轮的请求
+	respCh   chan api.ChatResponse                        // 响应通道，用于接收流式响应，请求结束后关闭
+	errCh    chan error                                   // 本轮请求结束时的错误
 	message  api.Message                                  // 累积的消息内容
 	toolCall func(name string, data []byte) (string, error) // 工具调用处理函数
 	messages []proto.Message                              // 消息历史记录
+	usage    proto.Usage                                  // 累计令牌用量
 }
 
-// fn 是响应回调函数，将响应发送到通道中。
-// 参数:
-//   - resp: Ollama API 返回的聊天响应
-// 返回:
-//   - error: 总是返回 nil
-func (s *Stream) fn(resp api.ChatResponse) error {
-	s.respCh <- resp
-	return nil
-}
+// Usage 实现 stream.Stream 接口，返回所有轮次累计的令牌用量。
+func (s *Stream) Usage() proto.Usage { return s.usage }
 
 // CallTools 实现 stream.Stream 接口，执行消息中的所有工具调用。
 // 该方法遍历消息中的工具调用，执行每个工具并更新请求和消息历史。
 // 返回:
 //   - []proto.ToolCallStatus: 工具调用的执行状态列表
 func (s *Stream) CallTools() []proto.ToolCallStatus {
-	statuses := make([]proto.ToolCallStatus, 0, len(s.message.ToolCalls))
-
-	// 遍历所有工具调用并执行
+	calls := make([]stream.Call, 0, len(s.message.ToolCalls))
 	for _, call := range s.message.ToolCalls {
-		// 调用工具并获取结果和状态
-		msg, status := stream.CallTool(
-			strconv.Itoa(call.Function.Index),        // 工具调用索引
-			call.Function.Name,                       // 工具名称
-			[]byte(call.Function.Arguments.String()), // 工具参数
-			s.toolCall,                               // 工具调用处理函数
-		)
-
-		// 将工具响应添加到请求消息中
+		calls = append(calls, stream.Call{
+			ID:        strconv.Itoa(call.Function.Index),        // 工具调用索引
+			Name:      call.Function.Name,                       // 工具名称
+			Arguments: []byte(call.Function.Arguments.String()), // 工具参数
+		})
+	}
+
+	// 并发执行所有工具调用，按原来的顺序将工具响应添加到请求消息中
+	msgs, statuses := stream.CallTools(calls, s.toolCall)
+	for _, msg := range msgs {
 		s.request.Messages = append(s.request.Messages, fromProtoMessage(msg))
 		s.messages = append(s.messages, msg)
-		statuses = append(statuses, status)
 	}
 	return statuses
 }
 
 // Close 实现 stream.Stream 接口，关闭流式响应。
-// 该方法关闭响应通道并标记流已完成。
+// 该方法取消进行中的请求，并等待后台的 goroutine 退出，可以重复调用。
 // 返回:
 //   - error: 总是返回 nil
 func (s *Stream) Close() error {
-	close(s.respCh)
+	if s.closed {
+		return nil
+	}
+	s.closed = true
 	s.done = true
+	s.cancel()
+	// 丢弃取消前已经发出的响应，直到请求结束
+	for range s.respCh {
+	}
 	return nil
 }
 
 // Current 实现 stream.Stream 接口，获取当前的响应块。
-// 该方法从响应通道中读取最新的响应内容，并累积到消息中。
+// 该方法等待下一个响应，并累积到消息中。
 // 返回:
 //   - proto.Chunk: 当前响应的内容块
 //   - error: 没有内容时返回 stream.ErrNoContent
 func (s *Stream) Current() (proto.Chunk, error) {
-	select {
-	case resp := <-s.respCh:
-		// 构建响应块
-		chunk := proto.Chunk{
-			Content: resp.Message.Content,
-		}
-		// 累积消息内容
-		s.message.Content += resp.Message.Content
-		// 累积工具调用
-		s.message.ToolCalls = append(s.message.ToolCalls, resp.Message.ToolCalls...)
-
-		// 检查响应是否完成
-		if resp.Done {
-			s.done = true
+	resp, ok := <-s.respCh
+	if !ok {
+		// 请求在完成前结束，例如出错或被取消
+		select {
+		case err := <-s.errCh:
+			if err != nil && s.err == nil {
+				s.err = err
+			}
+		default:
 		}
-		return chunk, nil
-	default:
-		// 没有可用内容时返回错误
+		s.done = true
 		return proto.Chunk{}, stream.ErrNoContent
 	}
+
+	// 构建响应块
+	chunk := proto.Chunk{
+		Content: resp.Message.Content,
+	}
+	// 累积消息内容
+	s.message.Content += resp.Message.Content
+	// 累积工具调用
+	s.message.ToolCalls = append(s.message.ToolCalls, resp.Message.ToolCalls...)
+
+	// 检查响应是否完成，最后一个响应带有本轮的令牌统计
+	if resp.Done {
+		s.done = true
+		s.usage.Add(proto.Usage{
+			InputTokens:  int64(resp.PromptEvalCount),
+			OutputTokens: int64(resp.EvalCount),
+		})
+	}
+	return chunk, nil
 }
 
 // Err 实现 stream.Stream 接口，返回流处理过程中发生的错误。
@@ -224,20 +268,24 @@ func (s *Stream) Messages() []proto.Message { return s.messages }
 // 返回:
 //   - bool: 是否可以继续迭代
 func (s *Stream) Next() bool {
-	// 如果有错误，停止迭代
-	if s.err != nil {
+	// 如果有错误或流已关闭，停止迭代
+	if s.err != nil || s.closed {
 		return false
 	}
 
-	// 如果流已完成，重置状态并准备新一轮对话
 	if s.done {
-		s.done = false
-		s.factory()
-		// 将累积的消息添加到历史记录中
-		s.messages = append(s.messages, toProtoMessage(s.message))
-		s.request.Messages = append(s.request.Messages, s.message)
-		// 重置消息对象
+		// 本轮结束，将累积的消息添加到历史记录中，调用工具后再次调用 Next 时才发起新一轮
+		if !s.ended {
+			s.ended = true
+			s.message.Role = proto.RoleAssistant
+			s.messages = append(s.messages, toProtoMessage(s.message))
+			s.request.Messages = append(s.request.Messages, s.message)
+			return false
+		}
+		// 重置状态并准备新一轮对话
+		s.done, s.ended = false, false
 		s.message = api.Message{}
+		s.factory()
 	}
 	return true
 }
@@ -0,0 +1,24 @@
+package ollama
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/stream"
+	"github.com/charmbracelet/mods/internal/stream/streamtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	streamtest.Run(t, "application/x-ndjson",
+		`{"model":"m","message":{"role":"assistant","content":"你好"},"done":false}`+"\n",
+		"你好",
+		func(ctx context.Context, baseURL string, client *http.Client) stream.Stream {
+			c, err := New(Config{BaseURL: baseURL, HTTPClient: client})
+			require.NoError(t, err)
+			return c.Request(ctx, proto.Request{Model: "m"})
+		},
+	)
+}
@@ -57,8 +57,20 @@ func fromProtoMessages(input []proto.Message) []openai.ChatCompletionMessagePara
 				break
 			}
 		case proto.RoleUser:
-			// 用户消息
-			messages = append(messages, openai.UserMessage(msg.Content))
+			// 用户消息，附带图片时使用多部分内容
+			if len(msg.Images) == 0 {
+				messages = append(messages, openai.UserMessage(msg.Content))
+				break
+			}
+			parts := []openai.ChatCompletionContentPartUnionParam{
+				openai.TextContentPart(msg.Content),
+			}
+			for _, img := range msg.Images {
+				parts = append(parts, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+					URL: img.DataURL(), // base64 data URL
+				}))
+			}
+			messages = append(messages, openai.UserMessage(parts))
 		case proto.RoleAssistant:
 			// 助手消息，可能包含工具调用
 			m := openai.AssistantMessage(msg.Content)
@@ -3,6 +3,7 @@ package openai
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"strings"
 
@@ -11,15 +12,20 @@ import (
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/azure"
 	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/param"
 	"github.com/openai/openai-go/packages/ssestream"
 	"github.com/openai/openai-go/shared"
 )
 
-var _ stream.Client = &Client{}
+var (
+	_ stream.Client       = &Client{}
+	_ stream.Alternatives = &Stream{}
+)
 
 // Client 是 OpenAI 客户端。
 type Client struct {
 	*openai.Client
+	streamUsage bool // 请求在流末尾附带 usage 块
 }
 
 // Config 表示 OpenAI API 客户端的配置。
@@ -29,7 +35,10 @@ type Config struct {
 	HTTPClient interface {
 		Do(*http.Request) (*http.Response, error)
 	} // HTTP 客户端接口
-	APIType string // API 类型
+	APIType     string            // API 类型
+	QueryParams map[string]string // 附加到每个请求 URL 上的查询参数
+	ExtraBody   map[string]any    // 合并到每个请求体中的额外字段
+	StreamUsage bool              // 发送 stream_options.include_usage，有些兼容的 API 会拒绝该字段
 }
 
 // DefaultConfig 返回 OpenAI API 客户端的默认配置。
@@ -62,9 +71,18 @@ func New(config Config) *Client {
 			opts = append(opts, option.WithBaseURL(config.BaseURL))
 		}
 	}
+	// 某些网关要求在 URL 上附加 api-version 等查询参数
+	for key, value := range config.QueryParams {
+		opts = append(opts, option.WithQuery(key, value))
+	}
+	// OpenRouter 等 API 在请求体中接受 OpenAI 未定义的字段
+	for key, value := range config.ExtraBody {
+		opts = append(opts, option.WithJSONSet(key, value))
+	}
 	client := openai.NewClient(opts...)
 	return &Client{
-		Client: &client,
+		Client:      &client,
+		streamUsage: config.StreamUsage,
 	}
 }
 
@@ -77,6 +95,12 @@ func (c *Client) Request(ctx context.Context, request proto.Request) stream.Stre
 		Messages: fromProtoMessages(request.Messages), // 消息列表
 		Tools:    fromMCPTools(request.Tools),         // 工具列表
 	}
+	// 请求在流末尾附带 usage 块，以便得到精确的令牌统计
+	if c.streamUsage {
+		body.StreamOptions = openai.ChatCompletionStreamOptionsParam{
+			IncludeUsage: openai.Bool(true),
+		}
+	}
 
 	// 对于非 Perplexity 在线模型，设置额外的参数
 	if request.API != "perplexity" || !strings.Contains(request.Model, "online") {
@@ -96,14 +120,44 @@ func (c *Client) Request(ctx context.Context, request proto.Request) stream.Stre
 		if request.MaxTokens != nil {
 			body.MaxTokens = openai.Int(*request.MaxTokens)
 		}
-		// 为 OpenAI API 设置 JSON 响应格式
-		if request.API == "openai" && request.ResponseFormat != nil && *request.ResponseFormat == "json" {
+		// 一次请求生成多个回答，只流式输出第一个
+		if request.N > 1 {
+			body.N = openai.Int(request.N)
+		}
+		// 设置 o 系列模型的推理强度
+		if request.ReasoningEffort != "" {
+			body.ReasoningEffort = shared.ReasoningEffort(request.ReasoningEffort)
+		}
+		// 为 OpenAI 和 Mistral API 设置 JSON 响应格式
+		if (request.API == "openai" || request.API == "mistral") && request.ResponseFormat != nil && *request.ResponseFormat == "json" {
 			body.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
 				OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
 			}
 		}
 	}
 
+	// Perplexity 的搜索控制参数不在 OpenAI 的请求结构中，作为额外字段发送
+	if request.API == "perplexity" {
+		extra := map[string]any{}
+		if len(request.SearchDomains) > 0 {
+			extra["search_domain_filter"] = request.SearchDomains
+		}
+		if request.SearchRecency != "" {
+			extra["search_recency_filter"] = request.SearchRecency
+		}
+		if len(extra) > 0 {
+			body.SetExtraFields(extra)
+		}
+	}
+
+	// Mistral 拒绝请求体中未定义的字段，usage 总是在最后一个数据块中返回
+	if request.API == "mistral" {
+		body.User = param.Opt[string]{}
+		if request.SafePrompt {
+			body.SetExtraFields(map[string]any{"safe_prompt": true})
+		}
+	}
+
 	// 创建流对象
 	s := &Stream{
 		stream:   c.Chat.Completions.NewStreaming(ctx, body),
@@ -121,57 +175,106 @@ func (c *Client) Request(ctx context.Context, request proto.Request) stream.Stre
 // Stream OpenAI 流结构体。
 type Stream struct {
 	done     bool                                                 // 流是否完成的标志
+	closed   bool                                                 // 流是否已经关闭
 	request  openai.ChatCompletionNewParams                       // 请求参数
 	stream   *ssestream.Stream[openai.ChatCompletionChunk]        // 底层流
 	factory  func() *ssestream.Stream[openai.ChatCompletionChunk] // 流工厂函数
 	message  openai.ChatCompletionAccumulator                     // 消息累加器
 	messages []proto.Message                                      // 消息列表
 	toolCall func(name string, data []byte) (string, error)       // 工具调用函数
+	usage    proto.Usage                                          // 累计令牌用量
 }
 
+// Usage 返回所有轮次累计的令牌用量。
+func (s *Stream) Usage() proto.Usage { return s.usage }
+
 // CallTools 实现 stream.Stream 接口。
 // 调用工具并返回工具调用状态列表。
 func (s *Stream) CallTools() []proto.ToolCallStatus {
 	calls := s.message.Choices[0].Message.ToolCalls
-	statuses := make([]proto.ToolCallStatus, 0, len(calls))
+	pending := make([]stream.Call, 0, len(calls))
 	for _, call := range calls {
-		// 执行工具调用
-		msg, status := stream.CallTool(
-			call.ID,
-			call.Function.Name,
-			[]byte(call.Function.Arguments),
-			s.toolCall,
-		)
+		pending = append(pending, stream.Call{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: []byte(call.Function.Arguments),
+		})
+	}
+	// 并发执行工具调用，按原来的顺序写回
+	msgs, statuses := stream.CallTools(pending, s.toolCall)
+	for i, msg := range msgs {
 		// 创建工具响应消息
 		resp := openai.ToolMessage(
 			msg.Content,
-			call.ID,
+			calls[i].ID,
 		)
 		// 将工具响应添加到请求消息列表
 		s.request.Messages = append(s.request.Messages, resp)
 		s.messages = append(s.messages, msg)
-		statuses = append(statuses, status)
 	}
 	return statuses
 }
 
 // Close 实现 stream.Stream 接口。
-// 关闭流并释放资源。
-func (s *Stream) Close() error { return s.stream.Close() } //nolint:wrapcheck
+// 关闭流并释放资源，可以重复调用。
+func (s *Stream) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.stream.Close() //nolint:wrapcheck
+}
 
 // Current 实现 stream.Stream 接口。
 // 返回当前数据块。
 func (s *Stream) Current() (proto.Chunk, error) {
 	event := s.stream.Current()
 	s.message.AddChunk(event)
-	if len(event.Choices) > 0 {
-		return proto.Chunk{
-			Content: event.Choices[0].Delta.Content,
-		}, nil
+	// 请求多个回答时，数据块可能属于其他回答，只输出第一个
+	for _, choice := range event.Choices {
+		if choice.Index == 0 {
+			return proto.Chunk{
+				Content:   choice.Delta.Content,
+				Reasoning: reasoningContent(choice.Delta),
+			}, nil
+		}
 	}
 	return proto.Chunk{}, stream.ErrNoContent
 }
 
+// Alternatives 实现 stream.Alternatives 接口。
+// 返回使用 n 参数时除第一个以外的其他回答。
+func (s *Stream) Alternatives() []string {
+	if len(s.message.Choices) < 2 { //nolint:mnd
+		return nil
+	}
+	alts := make([]string, 0, len(s.message.Choices)-1)
+	for _, choice := range s.message.Choices[1:] {
+		alts = append(alts, choice.Message.Content)
+	}
+	return alts
+}
+
+// reasoningFields 是 OpenAI 兼容服务返回思考内容的字段：
+// DeepSeek 和 xAI 使用 reasoning_content，OpenRouter、vLLM 等使用 reasoning
+var reasoningFields = []string{"reasoning_content", "reasoning"}
+
+// reasoningContent 从增量的扩展字段中读取思考内容。
+// 这些字段不在 OpenAI 的响应结构中，也不会随消息历史发回。
+func reasoningContent(delta openai.ChatCompletionChunkChoiceDelta) string {
+	for _, name := range reasoningFields {
+		field, ok := delta.JSON.ExtraFields[name]
+		if !ok {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal([]byte(field.Raw()), &s); err == nil && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
 // Err 实现 stream.Stream 接口。
 // 返回流中的错误。
 func (s *Stream) Err() error { return s.stream.Err() } //nolint:wrapcheck
@@ -183,6 +286,10 @@ func (s *Stream) Messages() []proto.Message { return s.messages }
 // Next 实现 stream.Stream 接口。
 // 推进到下一个数据块，返回是否还有更多数据。
 func (s *Stream) Next() bool {
+	// 流已关闭时不再发起新一轮请求
+	if s.closed {
+		return false
+	}
 	// 如果流已完成，重置并创建新流
 	if s.done {
 		s.done = false
@@ -196,6 +303,11 @@ func (s *Stream) Next() bool {
 
 	// 流结束，保存最终消息
 	s.done = true
+	s.usage.Add(proto.Usage{
+		InputTokens:     s.message.Usage.PromptTokens,
+		OutputTokens:    s.message.Usage.CompletionTokens,
+		CacheReadTokens: s.message.Usage.PromptTokensDetails.CachedTokens,
+	})
 	if len(s.message.Choices) > 0 {
 		msg := s.message.Choices[0].Message.ToParam()
 		s.request.Messages = append(s.request.Messages, msg)
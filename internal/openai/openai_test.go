@@ -0,0 +1,55 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/stream"
+	"github.com/charmbracelet/mods/internal/stream/streamtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	streamtest.Run(t, "text/event-stream",
+		`data: {"id":"1","object":"chat.completion.chunk","created":1,"model":"m","choices":[{"index":0,"delta":{"role":"assistant","content":"你好"}}]}`+"\n\n",
+		"你好",
+		func(ctx context.Context, baseURL string, client *http.Client) stream.Stream {
+			return New(Config{AuthToken: "x", BaseURL: baseURL, HTTPClient: client}).
+				Request(ctx, proto.Request{Model: "m"})
+		},
+	)
+}
+
+func TestStreamUsage(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	for name, tc := range map[string]struct {
+		streamUsage bool
+		expected    any
+	}{
+		"开启": {true, map[string]any{"include_usage": true}},
+		"关闭": {false, nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := New(Config{AuthToken: "x", BaseURL: srv.URL, StreamUsage: tc.streamUsage}).
+				Request(context.Background(), proto.Request{Model: "m"})
+			for s.Next() {
+			}
+			require.NoError(t, s.Err())
+			require.NoError(t, s.Close())
+			require.Equal(t, tc.expected, body["stream_options"])
+		})
+	}
+}
@@ -3,9 +3,11 @@
 package proto
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 )
@@ -22,7 +24,25 @@ const (
 // Chunk 表示流式文本的数据块。
 // 用于在流式传输过程中逐步传递文本内容。
 type Chunk struct {
-	Content string // 文本块的内容
+	Content   string // 文本块的内容
+	Reasoning string // 模型的思考内容（如 DeepSeek 的 reasoning_content），不属于回答
+}
+
+// Usage 表示请求消耗的令牌数量。
+// 多轮工具调用时为所有轮次的累计值。
+type Usage struct {
+	InputTokens      int64 // 输入（提示）令牌数，包括从缓存读取和写入缓存的令牌
+	OutputTokens     int64 // 输出（补全）令牌数
+	CacheReadTokens  int64 // 从提示缓存读取的输入令牌数
+	CacheWriteTokens int64 // 写入提示缓存的输入令牌数
+}
+
+// Add 将另一次用量累加到当前用量上。
+func (u *Usage) Add(o Usage) {
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.CacheReadTokens += o.CacheReadTokens
+	u.CacheWriteTokens += o.CacheWriteTokens
 }
 
 // ToolCallStatus 表示工具调用的状态信息。
@@ -53,7 +73,21 @@ func (c ToolCallStatus) String() string {
 type Message struct {
 	Role      string    // 消息角色（system/user/assistant/tool）
 	Content   string    // 消息内容
+	Images    []Image   // 附带的图片（仅在角色为user时使用）
 	ToolCalls []ToolCall // 工具调用列表（仅在角色为tool时使用）
+	Cache     bool       // 提示缓存断点：支持的 API 缓存到这条消息为止的前缀
+}
+
+// Image 表示消息中附带的图片。
+// 图片以原始字节保存，由各客户端按需编码为其 API 所需的格式。
+type Image struct {
+	MediaType string // 媒体类型，如 image/png
+	Data      []byte // 图片的原始数据
+}
+
+// DataURL 返回图片的 base64 data URL 形式。
+func (i Image) DataURL() string {
+	return "data:" + i.MediaType + ";base64," + base64.StdEncoding.EncodeToString(i.Data)
 }
 
 // ToolCall 表示消息中的工具调用。
@@ -84,7 +118,15 @@ type Request struct {
 	TopK           *int64                      // Top-K采样参数
 	Stop           []string                    // 停止词列表
 	MaxTokens      *int64                      // 最大生成令牌数
+	N              int64                       // 一次请求生成的回答数（OpenAI 的 n 参数），0 或 1 表示一个
 	ResponseFormat *string                     // 响应格式（如json、text等）
+	ThinkingBudget int                         // 思考预算（令牌数），0 表示使用模型的默认行为
+	ReasoningEffort string                     // 推理强度（OpenAI o 系列）：low、medium、high
+	SearchDomains  []string                    // 搜索域过滤（Perplexity），以 - 开头表示排除
+	SearchRecency  string                      // 搜索结果新鲜度（Perplexity）：hour、day、week、month
+	SafePrompt     bool                        // 在系统提示前加入安全提示（Mistral）
+	KeepAlive      *time.Duration              // 请求后模型保留在内存中的时间，负数表示一直保留（Ollama）
+	Options        map[string]any              // 额外的推理选项，例如 num_gpu、mirostat（Ollama）
 	ToolCaller     func(name string, data []byte) (string, error) // 工具调用函数
 }
 
@@ -0,0 +1,225 @@
+// Package rag 提供本地的向量索引：把文本切成片段，连同向量保存在 SQLite 中，
+// 检索时按余弦相似度返回最相关的片段。
+package rag
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	_ "modernc.org/sqlite" // 注册 sqlite 驱动
+)
+
+// Chunk 是文件中的一段文本。
+type Chunk struct {
+	Source string // 来源文件
+	Start  int    // 起始行号，从 1 开始
+	End    int    // 结束行号，包含在内
+	Text   string // 文本内容
+}
+
+// Result 是一条检索结果。
+type Result struct {
+	Chunk
+	Score float64 // 与查询的余弦相似度
+}
+
+// Split 按行把文本切成不超过 size 个字符的片段，超长的单行单独成为一个片段。
+func Split(source, text string, size int) []Chunk {
+	var chunks []Chunk
+	var sb strings.Builder
+	// first 和 last 是当前片段中第一个和最后一个非空行的行号
+	first, last := 0, 0
+	flush := func() {
+		if first > 0 {
+			chunks = append(chunks, Chunk{Source: source, Start: first, End: last, Text: strings.TrimSpace(sb.String())})
+		}
+		sb.Reset()
+		first, last = 0, 0
+	}
+	for i, line := range strings.Split(text, "\n") {
+		if sb.Len() > 0 && sb.Len()+len(line)+1 > size {
+			flush()
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(line)
+		if strings.TrimSpace(line) != "" {
+			if first == 0 {
+				first = i + 1
+			}
+			last = i + 1
+		}
+	}
+	flush()
+	return chunks
+}
+
+// Index 是保存在 SQLite 文件中的向量索引。
+type Index struct {
+	db *sql.DB
+}
+
+// Open 打开索引文件，文件不存在时创建。
+func Open(path string) (*Index, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("打开索引: %w", err)
+	}
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS meta (
+		  key string NOT NULL PRIMARY KEY,
+		  value string NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS chunks (
+		  id integer PRIMARY KEY,
+		  source string NOT NULL,
+		  start_line integer NOT NULL,
+		  end_line integer NOT NULL,
+		  text string NOT NULL,
+		  embedding blob NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_chunks_source ON chunks (source);
+	`); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("初始化索引: %w", err)
+	}
+	return &Index{db: db}, nil
+}
+
+// Close 关闭索引。
+func (ix *Index) Close() error {
+	return ix.db.Close() //nolint:wrapcheck
+}
+
+// Meta 返回索引的元数据，不存在时返回空字符串。
+func (ix *Index) Meta(key string) (string, error) {
+	var value string
+	err := ix.db.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("读取索引元数据: %w", err)
+	}
+	return value, nil
+}
+
+// SetMeta 设置索引的元数据。
+func (ix *Index) SetMeta(key, value string) error {
+	if _, err := ix.db.Exec(
+		`INSERT INTO meta (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`,
+		key, value,
+	); err != nil {
+		return fmt.Errorf("写入索引元数据: %w", err)
+	}
+	return nil
+}
+
+// Replace 用新的片段和向量替换来源文件之前的所有片段。
+func (ix *Index) Replace(source string, chunks []Chunk, vectors [][]float64) error {
+	if len(chunks) != len(vectors) {
+		return fmt.Errorf("写入索引: %d 个片段但有 %d 个向量", len(chunks), len(vectors))
+	}
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return fmt.Errorf("写入索引: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if _, err := tx.Exec(`DELETE FROM chunks WHERE source = ?`, source); err != nil {
+		return fmt.Errorf("写入索引: %w", err)
+	}
+	for i, c := range chunks {
+		if _, err := tx.Exec(
+			`INSERT INTO chunks (source, start_line, end_line, text, embedding) VALUES (?, ?, ?, ?, ?)`,
+			source, c.Start, c.End, c.Text, encodeVector(vectors[i]),
+		); err != nil {
+			return fmt.Errorf("写入索引: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("写入索引: %w", err)
+	}
+	return nil
+}
+
+// Stats 返回索引中的文件数和片段数。
+func (ix *Index) Stats() (sources, chunks int, err error) {
+	if err := ix.db.QueryRow(
+		`SELECT COUNT(DISTINCT source), COUNT(*) FROM chunks`,
+	).Scan(&sources, &chunks); err != nil {
+		return 0, 0, fmt.Errorf("统计索引: %w", err)
+	}
+	return sources, chunks, nil
+}
+
+// Search 返回与查询向量最相似的 k 个片段，按相似度从高到低排列。
+func (ix *Index) Search(query []float64, k int) ([]Result, error) {
+	rows, err := ix.db.Query(`SELECT source, start_line, end_line, text, embedding FROM chunks`)
+	if err != nil {
+		return nil, fmt.Errorf("检索索引: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var results []Result
+	for rows.Next() {
+		var r Result
+		var blob []byte
+		if err := rows.Scan(&r.Source, &r.Start, &r.End, &r.Text, &blob); err != nil {
+			return nil, fmt.Errorf("检索索引: %w", err)
+		}
+		r.Score = cosine(query, decodeVector(blob))
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("检索索引: %w", err)
+	}
+	slices.SortStableFunc(results, func(a, b Result) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// encodeVector 把向量编码为小端序的 float32 数组，节省一半空间。
+func encodeVector(v []float64) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(f)))
+	}
+	return buf
+}
+
+// decodeVector 解码 encodeVector 编码的向量。
+func decodeVector(buf []byte) []float64 {
+	v := make([]float64, len(buf)/4)
+	for i := range v {
+		v[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:])))
+	}
+	return v
+}
+
+// cosine 返回两个向量的余弦相似度，长度不同或为零向量时返回 0。
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
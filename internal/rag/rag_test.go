@@ -0,0 +1,82 @@
+package rag
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	t.Run("按行切分", func(t *testing.T) {
+		text := "aaaa\nbbbb\n\ncccc\ndddd"
+		require.Equal(t, []Chunk{
+			{Source: "a.md", Start: 1, End: 2, Text: "aaaa\nbbbb"},
+			{Source: "a.md", Start: 4, End: 5, Text: "cccc\ndddd"},
+		}, Split("a.md", text, 10))
+	})
+
+	t.Run("超长的行单独成段", func(t *testing.T) {
+		long := strings.Repeat("x", 30)
+		chunks := Split("a.md", "a\n"+long+"\nb", 10)
+		require.Len(t, chunks, 3)
+		require.Equal(t, long, chunks[1].Text)
+		require.Equal(t, 2, chunks[1].Start)
+	})
+
+	t.Run("空文本", func(t *testing.T) {
+		require.Empty(t, Split("a.md", "\n\n", 10))
+	})
+}
+
+func TestIndex(t *testing.T) {
+	ix, err := Open(filepath.Join(t.TempDir(), "docs.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, ix.Close()) })
+
+	require.NoError(t, ix.Replace("a.md", []Chunk{
+		{Source: "a.md", Start: 1, End: 2, Text: "猫"},
+		{Source: "a.md", Start: 3, End: 4, Text: "狗"},
+	}, [][]float64{{1, 0}, {0, 1}}))
+	require.NoError(t, ix.Replace("b.md", []Chunk{
+		{Source: "b.md", Start: 1, End: 1, Text: "猫狗"},
+	}, [][]float64{{1, 1}}))
+
+	t.Run("按相似度排序", func(t *testing.T) {
+		results, err := ix.Search([]float64{1, 0.1}, 2)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.Equal(t, "猫", results[0].Text)
+		require.Equal(t, "猫狗", results[1].Text)
+		require.InDelta(t, 0.995, results[0].Score, 0.001)
+	})
+
+	t.Run("重新索引替换旧片段", func(t *testing.T) {
+		require.NoError(t, ix.Replace("a.md", []Chunk{
+			{Source: "a.md", Start: 1, End: 1, Text: "鱼"},
+		}, [][]float64{{0, 1}}))
+		sources, chunks, err := ix.Stats()
+		require.NoError(t, err)
+		require.Equal(t, 2, sources)
+		require.Equal(t, 2, chunks)
+	})
+
+	t.Run("元数据", func(t *testing.T) {
+		model, err := ix.Meta("model")
+		require.NoError(t, err)
+		require.Empty(t, model)
+		require.NoError(t, ix.SetMeta("model", "a"))
+		require.NoError(t, ix.SetMeta("model", "b"))
+		model, err = ix.Meta("model")
+		require.NoError(t, err)
+		require.Equal(t, "b", model)
+	})
+}
+
+func TestCosine(t *testing.T) {
+	require.InDelta(t, 1, cosine([]float64{1, 2}, []float64{2, 4}), 1e-9)
+	require.Zero(t, cosine([]float64{1}, []float64{1, 2}))
+	require.Zero(t, cosine([]float64{0, 0}, []float64{1, 2}))
+	require.Equal(t, []float64{0.5, -2}, decodeVector(encodeVector([]float64{0.5, -2})))
+}
@@ -0,0 +1,86 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidArguments 当模型生成的工具参数不是有效的 JSON 且无法修复时返回。
+var ErrInvalidArguments = errors.New("工具参数不是有效的 JSON")
+
+// RepairJSON 校验工具调用参数，无效时尝试宽松修复。
+// 可以修复对象和数组末尾多余的逗号，以及使用单引号的字符串。
+// 参数：
+//   - data: 模型生成的参数
+//
+// 返回：
+//   - []byte: 有效的 JSON，参数为空时原样返回
+//   - error: 无法修复时返回包装了 [ErrInvalidArguments] 的错误
+func RepairJSON(data []byte) ([]byte, error) {
+	if len(strings.TrimSpace(string(data))) == 0 || json.Valid(data) {
+		return data, nil
+	}
+	var v any
+	err := json.Unmarshal(data, &v)
+
+	repaired := []byte(repairJSON(string(data)))
+	if json.Valid(repaired) {
+		return repaired, nil
+	}
+	return nil, fmt.Errorf("%w: %w", ErrInvalidArguments, err)
+}
+
+// repairJSON 将单引号字符串转换为双引号字符串，并删除右括号前多余的逗号。
+func repairJSON(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\'':
+			i = copyString(&sb, s, i, c)
+		case ',':
+			// 逗号之后只有空白和右括号时丢弃
+			j := i + 1
+			for j < len(s) && strings.IndexByte(" \t\r\n", s[j]) >= 0 {
+				j++
+			}
+			if j < len(s) && (s[j] == '}' || s[j] == ']') {
+				continue
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// copyString 将从 start 开始、以 quote 包围的字符串以双引号形式写入 sb，
+// 返回字符串结束引号的位置。
+func copyString(sb *strings.Builder, s string, start int, quote byte) int {
+	sb.WriteByte('"')
+	for i := start + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			if s[i] == '\'' {
+				// JSON 中单引号无需转义
+				sb.WriteByte('\'')
+			} else {
+				sb.WriteByte(c)
+				sb.WriteByte(s[i])
+			}
+		case c == quote:
+			sb.WriteByte('"')
+			return i
+		case c == '"':
+			// 单引号字符串中的双引号需要转义
+			sb.WriteString(`\"`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairJSON(t *testing.T) {
+	for name, tt := range map[string]struct {
+		in, want string
+	}{
+		"有效":      {`{"a": 1}`, `{"a": 1}`},
+		"空":       {``, ``},
+		"尾逗号":     {`{"a": [1, 2,], "b": 2, }`, `{"a": [1, 2], "b": 2 }`},
+		"单引号":     {`{'path': 'a.txt'}`, `{"path": "a.txt"}`},
+		"单引号中的引号": {`{'q': 'say "hi"', 'n': 'it\'s'}`, `{"q": "say \"hi\"", "n": "it's"}`},
+		"字符串中的逗号": {`{"a": "x,}", 'b': 1,}`, `{"a": "x,}", "b": 1}`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := RepairJSON([]byte(tt.in))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(got))
+		})
+	}
+
+	t.Run("无法修复", func(t *testing.T) {
+		_, err := RepairJSON([]byte(`{"a": `))
+		require.ErrorIs(t, err, ErrInvalidArguments)
+	})
+}
+
+func TestCallToolInvalidArguments(t *testing.T) {
+	called := false
+	caller := func(string, []byte) (string, error) {
+		called = true
+		return "ok", nil
+	}
+
+	t.Run("修复后调用", func(t *testing.T) {
+		msg, status := CallTool("1", "fs_read", []byte(`{'path': 'a',}`), caller)
+		require.True(t, called)
+		require.NoError(t, status.Err)
+		require.Equal(t, "ok", msg.Content)
+		require.JSONEq(t, `{"path": "a"}`, string(msg.ToolCalls[0].Function.Arguments))
+	})
+
+	t.Run("错误回传给模型", func(t *testing.T) {
+		called = false
+		msg, status := CallTool("1", "fs_read", []byte(`{"path": `), caller)
+		require.False(t, called)
+		require.True(t, errors.Is(status.Err, ErrInvalidArguments))
+		require.True(t, msg.ToolCalls[0].IsError)
+		require.Contains(t, msg.Content, "重新调用")
+	})
+}
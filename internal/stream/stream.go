@@ -6,6 +6,7 @@ import (
 	"errors"
 
 	"github.com/charmbracelet/mods/internal/proto"
+	"golang.org/x/sync/errgroup"
 )
 
 // ErrNoContent 当客户端返回无内容时发生的错误。
@@ -17,6 +18,13 @@ type Client interface {
 }
 
 // Stream 是一个进行中的流接口。
+//
+// 所有实现遵循相同的取消与关闭语义：
+//   - 请求的 context 取消后，正在进行的读取会尽快返回，Next 返回 false，
+//     Err 或 Current 返回取消的原因
+//   - Close 可以多次调用，也可以在请求失败后调用；关闭后 Next 返回 false，
+//     不会再发起新一轮请求
+//   - Close 返回后，实现启动的 goroutine 都已退出或不会再阻塞
 type Stream interface {
 	// 当没有更多消息时返回 false，调用者应该在此时执行 [Stream.CallTools()]，
 	// 然后再次检查此方法
@@ -26,7 +34,7 @@ type Stream interface {
 	// 实现应该将数据块累积成一条消息，并保持其内部对话状态
 	Current() (proto.Chunk, error)
 
-	// 关闭底层流
+	// 关闭底层流，可以重复调用
 	Close() error
 
 	// 返回流式处理过程中的错误
@@ -37,16 +45,34 @@ type Stream interface {
 
 	// 处理所有待执行的工具调用
 	CallTools() []proto.ToolCallStatus
+
+	// 返回目前为止所有轮次累计的令牌用量，API 未返回用量时为零值
+	Usage() proto.Usage
+}
+
+// Alternatives 是一次请求可以返回多个回答的流（例如 OpenAI 的 n 参数）。
+// [Stream.Messages] 只包含第一个回答，其余的回答由 Alternatives 返回
+type Alternatives interface {
+	// 返回流结束后除第一个回答以外的其他回答
+	Alternatives() []string
 }
 
 // CallTool 使用提供的数据和调用器调用工具，并返回结果 [proto.Message] 和 [proto.ToolCallStatus]。
+// 参数不是有效的 JSON 时先尝试修复，无法修复时不调用工具，而是将错误作为结果返回给模型，让其重新生成参数。
 func CallTool(
 	id, name string,
 	data []byte,
 	caller func(name string, data []byte) (string, error),
 ) (proto.Message, proto.ToolCallStatus) {
-	// 调用工具并获取内容和错误
-	content, err := caller(name, data)
+	var content string
+	repaired, err := RepairJSON(data)
+	if err != nil {
+		content = err.Error() + "\n请使用有效的 JSON 参数重新调用该工具。"
+	} else {
+		// 调用工具并获取内容和错误
+		data = repaired
+		content, err = caller(name, data)
+	}
 	// 如果内容为空且存在错误，则将错误信息作为内容
 	if content == "" && err != nil {
 		content = err.Error()
@@ -71,3 +97,29 @@ func CallTool(
 			Err:  err,
 		}
 }
+
+// Call 是模型在一次回答中请求的一个工具调用。
+type Call struct {
+	ID        string // 工具调用的唯一标识符
+	Name      string // 工具名称
+	Arguments []byte // 工具参数 JSON
+}
+
+// CallTools 并发执行一次回答中的所有工具调用，每个调用使用调用器自己的超时。
+// 返回的消息和状态与 calls 的顺序一致，便于按原来的顺序写回对话。
+func CallTools(
+	calls []Call,
+	caller func(name string, data []byte) (string, error),
+) ([]proto.Message, []proto.ToolCallStatus) {
+	msgs := make([]proto.Message, len(calls))
+	statuses := make([]proto.ToolCallStatus, len(calls))
+	var g errgroup.Group
+	for i, call := range calls {
+		g.Go(func() error {
+			msgs[i], statuses[i] = CallTool(call.ID, call.Name, call.Arguments, caller)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return msgs, statuses
+}
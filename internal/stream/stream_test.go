@@ -0,0 +1,51 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallTools(t *testing.T) {
+	calls := []Call{
+		{ID: "1", Name: "slow", Arguments: []byte(`{}`)},
+		{ID: "2", Name: "fast", Arguments: []byte(`{}`)},
+		{ID: "3", Name: "fail", Arguments: []byte(`{}`)},
+	}
+	// 所有调用都开始后才返回，顺序执行时会超时
+	var started sync.WaitGroup
+	started.Add(len(calls))
+	caller := func(name string, _ []byte) (string, error) {
+		started.Done()
+		done := make(chan struct{})
+		go func() { started.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			return "", errors.New("没有并发执行")
+		}
+		if name == "fail" {
+			return "", errors.New("boom")
+		}
+		return name + " ok", nil
+	}
+
+	msgs, statuses := CallTools(calls, caller)
+	require.Len(t, msgs, 3)
+	require.Equal(t, "slow ok", msgs[0].Content)
+	require.Equal(t, "2", msgs[1].ToolCalls[0].ID)
+	require.Equal(t, "fast ok", msgs[1].Content)
+	require.True(t, msgs[2].ToolCalls[0].IsError)
+	require.NoError(t, statuses[0].Err)
+	require.EqualError(t, statuses[2].Err, "boom")
+	require.Equal(t, "fail", statuses[2].Name)
+
+	t.Run("没有调用", func(t *testing.T) {
+		msgs, statuses := CallTools(nil, caller)
+		require.Empty(t, msgs)
+		require.Empty(t, statuses)
+	})
+}
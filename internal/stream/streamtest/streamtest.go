@@ -0,0 +1,164 @@
+// Package streamtest 检查 [stream.Stream] 实现的取消与关闭语义，供各个客户端的测试使用。
+package streamtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/stream"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// timeout 是等待流结束的最长时间，超过时认为流被阻塞
+const timeout = 5 * time.Second
+
+// RequestFunc 使用给定的上下文和 HTTP 客户端向测试服务器发起请求
+type RequestFunc func(ctx context.Context, baseURL string, client *http.Client) stream.Stream
+
+// Server 是返回固定响应的测试服务器
+type Server struct {
+	*httptest.Server
+	requests atomic.Int32  // 收到的请求数
+	stop     chan struct{} // 关闭后让挂起的请求返回
+}
+
+// NewServer 启动测试服务器，每个请求都返回 body。
+// hang 为 true 时写出 body 后保持连接，直到客户端取消请求或服务器关闭
+func NewServer(contentType, body string, hang bool) *Server {
+	s := &Server{stop: make(chan struct{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", contentType)
+		_, _ = io.WriteString(w, body)
+		w.(http.Flusher).Flush()
+		if !hang {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-s.stop:
+		}
+	}))
+	return s
+}
+
+// Requests 返回收到的请求数
+func (s *Server) Requests() int { return int(s.requests.Load()) }
+
+// Close 让挂起的请求返回并关闭服务器
+func (s *Server) Close() {
+	close(s.stop)
+	s.Server.Close()
+}
+
+// Run 检查 stream.Stream 的实现：正常结束时 Next 会返回 false，
+// 取消上下文后流会结束，Close 可以重复调用，关闭后不再发起请求，
+// 并且不会留下 goroutine
+// contentType: 响应的类型
+// body: 包含一个文本为 content 的数据块，没有结束标记的响应
+// content: body 中的文本
+// request: 发起请求
+func Run(t *testing.T, contentType, body, content string, request RequestFunc) {
+	t.Helper()
+
+	t.Run("正常结束", func(t *testing.T) {
+		client, srv := setup(t, contentType, body, false)
+		s := request(context.Background(), srv.URL, client)
+		got, err := drain(t, s)
+		require.NoError(t, err)
+		require.Equal(t, content, got)
+		require.NoError(t, s.Close())
+	})
+
+	t.Run("关闭后不再请求", func(t *testing.T) {
+		client, srv := setup(t, contentType, body, true)
+		s := request(context.Background(), srv.URL, client)
+		require.NoError(t, s.Close())
+		require.NoError(t, s.Close())
+		require.False(t, s.Next())
+		require.False(t, s.Next())
+		require.LessOrEqual(t, srv.Requests(), 1)
+	})
+
+	t.Run("读取后关闭", func(t *testing.T) {
+		client, srv := setup(t, contentType, body, true)
+		s := request(context.Background(), srv.URL, client)
+		got := ""
+		for got == "" {
+			require.True(t, s.Next())
+			chunk, err := s.Current()
+			if !errors.Is(err, stream.ErrNoContent) {
+				require.NoError(t, err)
+			}
+			got += chunk.Content
+		}
+		require.Equal(t, content, got)
+		require.NoError(t, s.Close())
+		require.False(t, s.Next())
+		require.Equal(t, 1, srv.Requests())
+	})
+
+	t.Run("取消上下文", func(t *testing.T) {
+		client, srv := setup(t, contentType, body, true)
+		ctx, cancel := context.WithCancel(context.Background())
+		s := request(ctx, srv.URL, client)
+		time.AfterFunc(100*time.Millisecond, cancel)
+		got, err := drain(t, s)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, content, got)
+		require.False(t, s.Next())
+		require.NoError(t, s.Close())
+	})
+}
+
+// setup 启动测试服务器，并在测试结束时关闭服务器、检查 goroutine 是否泄漏
+func setup(t *testing.T, contentType, body string, hang bool) (*http.Client, *Server) {
+	t.Helper()
+	ignore := goleak.IgnoreCurrent()
+	client := &http.Client{Transport: &http.Transport{}}
+	srv := NewServer(contentType, body, hang)
+	t.Cleanup(func() {
+		client.CloseIdleConnections()
+		srv.Close()
+		goleak.VerifyNone(t, ignore)
+	})
+	return client, srv
+}
+
+// drain 读完一轮回答，返回其中的文本和流的错误。流在超时内没有结束时测试失败
+func drain(t *testing.T, s stream.Stream) (string, error) {
+	t.Helper()
+	type result struct {
+		content string
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var sb strings.Builder
+		for s.Next() {
+			chunk, err := s.Current()
+			if err != nil && !errors.Is(err, stream.ErrNoContent) {
+				done <- result{sb.String(), err}
+				return
+			}
+			sb.WriteString(chunk.Content)
+		}
+		done <- result{sb.String(), s.Err()}
+	}()
+	select {
+	case r := <-done:
+		return r.content, r.err
+	case <-time.After(timeout):
+		t.Fatal("流没有结束")
+		return "", nil
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/caarlos0/go-shellwords"
+	"gopkg.in/yaml.v3"
+)
+
+// envNameRe 匹配 ${VAR} 中的环境变量名称
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// interpolateNode 展开设置文件中所有字符串值里的 ${VAR}，键和注释保持不变。
+// $(command) 只在 api-key、base-url 和 headers 下的值中执行，角色等其他内容中保持原样。
+// 值在解析后才展开，命令的输出不会破坏 YAML 结构
+// node: 解析后的设置文件
+// 返回：错误信息
+func interpolateNode(node *yaml.Node) error {
+	return interpolateValue(node, "", "")
+}
+
+// interpolateValue 展开 node 中的值
+// node: 要展开的节点
+// key: node 对应的键
+// parent: 上一层的键
+// 返回：错误信息
+func interpolateValue(node *yaml.Node, key, parent string) error {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, n := range node.Content {
+			if err := interpolateValue(n, "", ""); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := interpolateValue(node.Content[i], node.Content[i-1].Value, key); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return nil
+		}
+		commands := key == "api-key" || key == "base-url" || parent == "headers"
+		value, err := interpolate(node.Value, commands)
+		if err != nil {
+			return fmt.Errorf("第 %d 行: %w", node.Line, err)
+		}
+		if value != node.Value && node.Style == 0 {
+			// 没有引号的值按展开后的内容重新判断类型，例如端口号
+			node.Tag = ""
+		}
+		node.Value = value
+	}
+	return nil
+}
+
+// interpolate 展开字符串中的 ${VAR}、${VAR:-默认值} 和 $(command)。
+// 没有设置且没有默认值的环境变量保持原样，$${ 和 $$( 表示字面的 ${ 和 $(
+// s: 设置中的值
+// commands: 是否执行 $(command)，为 false 时保持原样
+// 返回：展开后的值和错误信息
+func interpolate(s string, commands bool) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		switch next := s[i+1]; {
+		case next == '$' && i+2 < len(s) && (s[i+2] == '{' || s[i+2] == '('):
+			sb.WriteString(s[i+1 : i+3])
+			i += 2
+		case next == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				sb.WriteByte(s[i])
+				continue
+			}
+			ref := s[i : i+2+end+1]
+			sb.WriteString(expandEnvRef(ref))
+			i += len(ref) - 1
+		case next == '(' && commands:
+			end := matchingParen(s, i+1)
+			if end < 0 {
+				sb.WriteByte(s[i])
+				continue
+			}
+			out, err := runInterpolateCmd(s[i+2 : end])
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(out)
+			i = end
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// expandEnvRef 展开一个 ${VAR} 或 ${VAR:-默认值}，不是有效的引用时保持原样
+func expandEnvRef(ref string) string {
+	name, fallback, hasFallback := strings.Cut(ref[2:len(ref)-1], ":-")
+	if !envNameRe.MatchString(name) {
+		return ref
+	}
+	if value, ok := os.LookupEnv(name); ok && (value != "" || !hasFallback) {
+		return value
+	}
+	if hasFallback {
+		return fallback
+	}
+	return ref
+}
+
+// matchingParen 返回与 open 处的左括号配对的右括号的位置，没有时返回 -1
+func matchingParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// runInterpolateCmd 执行 $(command) 中的命令，返回去掉首尾空白的标准输出。
+// 与 api-key-cmd 一样按 shell 的规则拆分参数，但不经过 shell
+func runInterpolateCmd(command string) (string, error) {
+	args, err := shellwords.Parse(command)
+	if err != nil {
+		return "", fmt.Errorf("无法解析命令 %q: %w", command, err)
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("命令 %q 为空", command)
+	}
+	out, err := exec.Command(args[0], args[1:]...).Output() //nolint:gosec
+	if err != nil {
+		var eerr *exec.ExitError
+		if errors.As(err, &eerr) && len(eerr.Stderr) > 0 {
+			return "", fmt.Errorf("命令 %q 执行失败: %w: %s", command, err, strings.TrimSpace(string(eerr.Stderr)))
+		}
+		return "", fmt.Errorf("命令 %q 执行失败: %w", command, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("MODS_TEST_HOST", "gw.example.com")
+	t.Setenv("MODS_TEST_EMPTY", "")
+
+	for in, expected := range map[string]string{
+		"https://${MODS_TEST_HOST}/v1":         "https://gw.example.com/v1",
+		"${MODS_TEST_MISSING:-localhost}":      "localhost",
+		"${MODS_TEST_EMPTY:-localhost}":        "localhost",
+		"${MODS_TEST_EMPTY}":                   "",
+		"https://api.runpod.ai/v2/${ENDPOINT}": "https://api.runpod.ai/v2/${ENDPOINT}",
+		"$${MODS_TEST_HOST} 和 $$(date)":        "${MODS_TEST_HOST} 和 $(date)",
+		"$HOME 不展开":                            "$HOME 不展开",
+		"${not a var}":                         "${not a var}",
+		"未结束的 ${MODS_TEST_HOST":                "未结束的 ${MODS_TEST_HOST",
+		"价格是 5$":                               "价格是 5$",
+	} {
+		t.Run(in, func(t *testing.T) {
+			out, err := interpolate(in, true)
+			require.NoError(t, err)
+			require.Equal(t, expected, out)
+		})
+	}
+
+	t.Run("命令", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("需要 echo 命令")
+		}
+		out, err := interpolate("Bearer $(echo 'a (b) c')", true)
+		require.NoError(t, err)
+		require.Equal(t, "Bearer a (b) c", out)
+
+		_, err = interpolate("$(false)", true)
+		require.ErrorContains(t, err, `命令 "false" 执行失败`)
+
+		out, err = interpolate("$(false) 和 $$(date)", false)
+		require.NoError(t, err)
+		require.Equal(t, "$(false) 和 $(date)", out)
+	})
+}
+
+func TestInterpolateNode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("需要 echo 命令")
+	}
+	t.Setenv("MODS_TEST_PORT", "8080")
+	t.Setenv("MODS_TEST_TOKEN", "12345")
+	t.Setenv("MODS_TEST_PROMPT", "第一行\nkey: value")
+
+	var doc yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(`
+${MODS_TEST_PORT}: key
+port: ${MODS_TEST_PORT}
+token: ${MODS_TEST_TOKEN}
+apis:
+  test:
+    base-url: $(echo https://gw.example.com)
+    headers:
+      X-Team: $(echo team)
+quoted: "${MODS_TEST_PORT}"
+roles:
+  test:
+    - ${MODS_TEST_PROMPT}
+    - $(echo 不执行)
+`), &doc))
+	require.NoError(t, interpolateNode(&doc))
+
+	var out struct {
+		Key    string `yaml:"${MODS_TEST_PORT}"`
+		Port   int    `yaml:"port"`
+		Token  string `yaml:"token"`
+		Quoted string `yaml:"quoted"`
+		APIs   map[string]struct {
+			BaseURL string            `yaml:"base-url"`
+			Headers map[string]string `yaml:"headers"`
+		} `yaml:"apis"`
+		Roles map[string][]string `yaml:"roles"`
+	}
+	require.NoError(t, doc.Decode(&out))
+	require.Equal(t, "key", out.Key)
+	require.Equal(t, 8080, out.Port)
+	require.Equal(t, "12345", out.Token)
+	require.Equal(t, "8080", out.Quoted)
+	require.Equal(t, "https://gw.example.com", out.APIs["test"].BaseURL)
+	require.Equal(t, map[string]string{"X-Team": "team"}, out.APIs["test"].Headers)
+	require.Equal(t, []string{"第一行\nkey: value", "$(echo 不执行)"}, out.Roles["test"])
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+// interruptedExitCode 是回答被 ctrl+c 中断时的退出码，与 shell 中被 SIGINT 终止的进程一致
+const interruptedExitCode = 130
+
+// finishInterrupted 在回答中途按下 ctrl+c 后输出已经收到的部分回答，
+// 并把它标记为截断后保存到对话中
+// mods: 被中断的请求
+// 返回：带有退出码的错误
+func finishInterrupted(mods *Mods) error {
+	switch {
+	case mods.bufferOutput():
+		// 缓冲的输出还没有写出
+		if mods.Output != "" {
+			fmt.Println(mods.Output)
+		}
+	case isOutputTTY() && !config.Raw:
+		switch {
+		case mods.glamOutput != "":
+			fmt.Print(mods.glamOutput)
+		case mods.Output != "":
+			fmt.Print(mods.Output)
+		}
+	default:
+		// 原始模式和管道中补上还没有输出的内容
+		mods.contentMutex.Lock()
+		for _, c := range mods.content {
+			fmt.Print(c)
+		}
+		mods.content = nil
+		mods.contentMutex.Unlock()
+		if mods.Output != "" {
+			fmt.Println()
+		}
+	}
+
+	if strings.TrimSpace(mods.Output) == "" {
+		return exitCodeError{interruptedExitCode}
+	}
+	if !config.Quiet {
+		fmt.Fprintln(os.Stderr, "\n"+stderrStyles().Comment.Render("已中断，回答不完整。"))
+	}
+	if config.cacheWriteToID != "" {
+		mods.messages = appendPartialAnswer(mods.messages, mods.Output)
+		if err := saveConversation(mods); err != nil {
+			return err
+		}
+	}
+	return exitCodeError{interruptedExitCode}
+}
+
+// appendPartialAnswer 把中断时已经收到的回答作为最后一条助手消息加入对话
+// messages: 对话消息
+// output: 已经收到的回答
+func appendPartialAnswer(messages []proto.Message, output string) []proto.Message {
+	if n := len(messages); n > 0 && messages[n-1].Role == proto.RoleAssistant {
+		return messages
+	}
+	return append(messages, proto.Message{
+		Role:    proto.RoleAssistant,
+		Content: strings.TrimSpace(output),
+	})
+}
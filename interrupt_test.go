@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterrupt(t *testing.T) {
+	t.Run("接收回答时按下 ctrl+c", func(t *testing.T) {
+		for st, interrupted := range map[state]bool{
+			requestState:      true,
+			responseState:     true,
+			configLoadedState: false,
+		} {
+			m := &Mods{state: st, cancelMu: &sync.Mutex{}, Config: &Config{}}
+			_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+			require.NotNil(t, cmd)
+			require.Equal(t, interrupted, m.interrupted)
+			require.Equal(t, doneState, m.state)
+		}
+	})
+
+	t.Run("保存部分回答", func(t *testing.T) {
+		messages := []proto.Message{{Role: proto.RoleUser, Content: "你好"}}
+		out := appendPartialAnswer(messages, "你好，我是\n")
+		require.Equal(t, []proto.Message{
+			{Role: proto.RoleUser, Content: "你好"},
+			{Role: proto.RoleAssistant, Content: "你好，我是"},
+		}, out)
+
+		// 已经有回答时不再追加
+		require.Equal(t, out, appendPartialAnswer(out, "其他"))
+	})
+
+	t.Run("标记为截断", func(t *testing.T) {
+		meta, err := encodeRequestMeta(requestMeta{Truncated: true})
+		require.NoError(t, err)
+		decoded, err := decodeRequestMeta(meta)
+		require.NoError(t, err)
+		require.True(t, decoded.Truncated)
+		require.Contains(t, decoded.String(), "truncated")
+		require.NotContains(t, requestMeta{}.String(), "truncated")
+	})
+}
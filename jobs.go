@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	jobMetaFile   = "job.json"      // 任务元数据文件
+	jobStdinFile  = "stdin"         // 任务标准输入文件
+	jobOutputFile = "output"        // 任务标准输出文件
+	jobErrorFile  = "error"         // 任务标准错误文件
+	jobExitFile   = "exit.json"     // 任务退出状态文件
+	jobPollEvery  = time.Second / 5 // 轮询任务输出的间隔
+)
+
+// job 表示一个在后台运行的 mods 请求。
+type job struct {
+	ID        string    `json:"id"`         // 任务 ID
+	Args      []string  `json:"args"`       // 启动参数
+	PID       int       `json:"pid"`        // 子进程 ID
+	StartedAt time.Time `json:"started_at"` // 启动时间
+}
+
+// jobExit 表示后台任务的退出状态。
+type jobExit struct {
+	Code       int       `json:"code"`        // 退出码
+	Error      string    `json:"error"`       // 错误信息
+	FinishedAt time.Time `json:"finished_at"` // 结束时间
+	Lost       bool      `json:"-"`           // 子进程没有记录退出状态就结束了，例如被杀死
+}
+
+// errJobLost 表示后台任务的子进程已经不存在，但没有记录退出状态
+var errJobLost = errors.New("后台任务的进程已经退出，但没有记录退出状态")
+
+// jobsDir 返回存放后台任务的目录
+func jobsDir() string {
+	return filepath.Join(config.CachePath, "jobs")
+}
+
+// detachJob 将当前请求放到后台子进程中执行，并立即返回任务 ID
+// 返回：错误信息
+func detachJob() error {
+	id := shortID(newConversationID())
+	dir := filepath.Join(jobsDir(), id)
+	if err := os.MkdirAll(dir, 0o700); err != nil { //nolint:mnd
+		return modsError{err, "无法创建后台任务目录。"}
+	}
+
+	// 先把 stdin 完整写入文件，子进程从文件读取
+	stdinPath := os.DevNull
+	if !isInputTTY() {
+		stdinPath = filepath.Join(dir, jobStdinFile)
+		f, err := os.Create(stdinPath)
+		if err != nil {
+			return modsError{err, "无法保存标准输入。"}
+		}
+		_, err = io.Copy(f, os.Stdin)
+		_ = f.Close()
+		if err != nil {
+			return modsError{err, "无法保存标准输入。"}
+		}
+	}
+
+	stdin, err := os.Open(stdinPath)
+	if err != nil {
+		return modsError{err, "无法启动后台任务。"}
+	}
+	defer stdin.Close() //nolint:errcheck
+	stdout, err := os.Create(filepath.Join(dir, jobOutputFile))
+	if err != nil {
+		return modsError{err, "无法启动后台任务。"}
+	}
+	defer stdout.Close() //nolint:errcheck
+	stderr, err := os.Create(filepath.Join(dir, jobErrorFile))
+	if err != nil {
+		return modsError{err, "无法启动后台任务。"}
+	}
+	defer stderr.Close() //nolint:errcheck
+
+	exe, err := os.Executable()
+	if err != nil {
+		return modsError{err, "无法启动后台任务。"}
+	}
+	// --job 放在最前面，参数中有 -- 时也会被当作选项解析
+	args := os.Args[1:]
+	cmd := exec.Command(exe, append([]string{"--job", id}, args...)...) //nolint:gosec
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return modsError{err, "无法启动后台任务。"}
+	}
+
+	j := job{
+		ID:        id,
+		Args:      withoutDetach(args),
+		PID:       cmd.Process.Pid,
+		StartedAt: time.Now(),
+	}
+	if err := writeJSONFile(filepath.Join(dir, jobMetaFile), j); err != nil {
+		return modsError{err, "无法保存后台任务信息。"}
+	}
+	_ = cmd.Process.Release()
+
+	fmt.Println(id)
+	if !config.Quiet {
+		fmt.Fprintf(
+			os.Stderr,
+			"\n任务已在后台运行。使用 %s 取回结果。\n",
+			stderrStyles().InlineCode.Render("mods --attach-job "+id),
+		)
+	}
+	return nil
+}
+
+// withoutDetach 去掉参数中的 --detach 和 --detach=<值>，-- 之后的参数保持不变
+// args: 命令行参数
+// 返回：用于显示的参数
+func withoutDetach(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			return append(out, args[i:]...)
+		}
+		if arg == "--detach" || strings.HasPrefix(arg, "--detach=") {
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+// writeJobExit 在后台任务子进程结束时记录退出状态
+// err: 执行结果
+func writeJobExit(err error) {
+	if config.jobID == "" {
+		return
+	}
+	exit := jobExit{FinishedAt: time.Now()}
+	if err != nil {
+		exit.Code = 1
+		exit.Error = err.Error()
+	}
+	_ = writeJSONFile(filepath.Join(jobsDir(), config.jobID, jobExitFile), exit)
+}
+
+// readJob 读取后台任务的元数据与退出状态。没有退出状态且子进程已经不存在时，
+// 返回 Lost 为 true 的退出状态
+// id: 任务 ID
+// 返回：任务、退出状态（仍在运行时为 nil）与错误信息
+func readJob(id string) (job, *jobExit, error) {
+	var j job
+	dir := filepath.Join(jobsDir(), id)
+	if err := readJSONFile(filepath.Join(dir, jobMetaFile), &j); err != nil {
+		return j, nil, err
+	}
+	exit, err := readJobExit(dir)
+	if exit != nil || err != nil || processAlive(j.PID) {
+		return j, exit, err
+	}
+	// 进程可能在两次检查之间写完退出状态后退出，再读取一次
+	if exit, err = readJobExit(dir); exit != nil || err != nil {
+		return j, exit, err
+	}
+	return j, &jobExit{Code: 1, Error: errJobLost.Error(), Lost: true}, nil
+}
+
+// readJobExit 读取任务目录中的退出状态，任务还没有结束时返回 nil
+func readJobExit(dir string) (*jobExit, error) {
+	var exit jobExit
+	if err := readJSONFile(filepath.Join(dir, jobExitFile), &exit); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &exit, nil
+}
+
+// listJobs 列出所有后台任务
+func listJobs() error {
+	entries, err := os.ReadDir(jobsDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return modsError{err, "无法列出后台任务。"}
+	}
+
+	var jobs []job
+	exits := map[string]*jobExit{}
+	for _, e := range entries {
+		j, exit, err := readJob(e.Name())
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, j)
+		exits[j.ID] = exit
+	}
+	if len(jobs) == 0 {
+		fmt.Fprintln(os.Stderr, "未找到后台任务。")
+		return nil
+	}
+
+	slices.SortFunc(jobs, func(a, b job) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+	for _, j := range jobs {
+		status := "运行中"
+		if exit := exits[j.ID]; exit != nil {
+			switch {
+			case exit.Lost:
+				status = "已丢失"
+			case exit.Code != 0:
+				status = "失败"
+			default:
+				status = "已完成"
+			}
+		}
+		fmt.Printf(
+			"%s\t%s\t%s\t%s\n",
+			stdoutStyles().SHA1.Render(j.ID),
+			status,
+			strings.Join(j.Args, " "),
+			stdoutStyles().Timeago.Render(formatTime(j.StartedAt)),
+		)
+	}
+	return nil
+}
+
+// attachJob 跟随后台任务的输出，直到任务结束
+// ctx: 上下文
+// id: 任务 ID
+// 返回：错误信息
+func attachJob(ctx context.Context, id string) error {
+	dir := filepath.Join(jobsDir(), id)
+	if _, _, err := readJob(id); err != nil {
+		return modsError{err, fmt.Sprintf("无法找到后台任务 %s。", id)}
+	}
+
+	out, err := os.Open(filepath.Join(dir, jobOutputFile))
+	if err != nil {
+		return modsError{err, "无法读取后台任务输出。"}
+	}
+	defer out.Close() //nolint:errcheck
+
+	for {
+		if _, err := io.Copy(os.Stdout, out); err != nil {
+			return modsError{err, "无法读取后台任务输出。"}
+		}
+		_, exit, err := readJob(id)
+		if err != nil {
+			return modsError{err, "无法读取后台任务状态。"}
+		}
+		if exit != nil {
+			// 任务结束后再读取一次，确保没有遗漏的输出
+			if _, err := io.Copy(os.Stdout, out); err != nil {
+				return modsError{err, "无法读取后台任务输出。"}
+			}
+			if exit.Lost {
+				return modsError{errJobLost, "后台任务意外退出。"}
+			}
+			if exit.Code != 0 {
+				return modsError{errors.New(exit.Error), "后台任务失败。"}
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(jobPollEvery):
+		}
+	}
+}
+
+// writeJSONFile 将值以 JSON 格式写入文件
+func writeJSONFile(path string, v any) error {
+	bts, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("无法编码 %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, bts, 0o600); err != nil { //nolint:mnd
+		return fmt.Errorf("无法写入 %s: %w", path, err)
+	}
+	return nil
+}
+
+// readJSONFile 从 JSON 文件读取值
+func readJSONFile(path string, v any) error {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("无法读取 %s: %w", path, err)
+	}
+	if err := json.Unmarshal(bts, v); err != nil {
+		return fmt.Errorf("无法解码 %s: %w", path, err)
+	}
+	return nil
+}
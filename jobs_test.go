@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// captureStdout 返回 fn 执行期间写到标准输出的内容
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	require.NoError(t, err)
+	old := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = old }()
+	fn()
+	require.NoError(t, f.Close())
+	bts, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+	return string(bts)
+}
+
+// exitedPID 返回一个已经结束的进程的 ID
+func exitedPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$") //nolint:gosec
+	require.NoError(t, cmd.Run())
+	return cmd.Process.Pid
+}
+
+// writeTestJob 在任务目录中写入元数据、输出和可选的退出状态
+func writeTestJob(t *testing.T, j job, output string, exit *jobExit) {
+	t.Helper()
+	dir := filepath.Join(jobsDir(), j.ID)
+	require.NoError(t, os.MkdirAll(dir, 0o700))
+	require.NoError(t, writeJSONFile(filepath.Join(dir, jobMetaFile), j))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, jobOutputFile), []byte(output), 0o600))
+	if exit != nil {
+		require.NoError(t, writeJSONFile(filepath.Join(dir, jobExitFile), exit))
+	}
+}
+
+func TestJobs(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config.CachePath = t.TempDir()
+
+	started := time.Now().Add(-time.Minute).Truncate(time.Second).UTC()
+	dead := exitedPID(t)
+	writeTestJob(t, job{ID: "running", Args: []string{"正在运行"}, PID: os.Getpid(), StartedAt: started}, "一半", nil)
+	writeTestJob(t, job{ID: "done", Args: []string{"已完成"}, PID: dead, StartedAt: started}, "回答\n", &jobExit{FinishedAt: started})
+	writeTestJob(t, job{ID: "failed", Args: []string{"失败"}, PID: dead, StartedAt: started}, "", &jobExit{Code: 1, Error: "出错了"})
+	writeTestJob(t, job{ID: "lost", Args: []string{"被杀死"}, PID: dead, StartedAt: started}, "", nil)
+
+	t.Run("读取任务", func(t *testing.T) {
+		j, exit, err := readJob("running")
+		require.NoError(t, err)
+		require.Equal(t, job{ID: "running", Args: []string{"正在运行"}, PID: os.Getpid(), StartedAt: started}, j)
+		require.Nil(t, exit)
+
+		_, exit, err = readJob("done")
+		require.NoError(t, err)
+		require.Equal(t, &jobExit{FinishedAt: started}, exit)
+
+		_, exit, err = readJob("lost")
+		require.NoError(t, err)
+		require.True(t, exit.Lost)
+		require.Equal(t, 1, exit.Code)
+
+		_, _, err = readJob("missing")
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("记录退出状态", func(t *testing.T) {
+		config.jobID = "lost"
+		t.Cleanup(func() { config.jobID = "" })
+		writeJobExit(nil)
+		_, exit, err := readJob("lost")
+		require.NoError(t, err)
+		require.False(t, exit.Lost)
+		require.Zero(t, exit.Code)
+		require.NoError(t, os.Remove(filepath.Join(jobsDir(), "lost", jobExitFile)))
+	})
+
+	t.Run("列出任务", func(t *testing.T) {
+		out := captureStdout(t, func() { require.NoError(t, listJobs()) })
+		require.Regexp(t, `running\s+运行中\s+正在运行`, out)
+		require.Regexp(t, `done\s+已完成\s+已完成`, out)
+		require.Regexp(t, `failed\s+失败\s+失败`, out)
+		require.Regexp(t, `lost\s+已丢失\s+被杀死`, out)
+	})
+
+	t.Run("取回已完成的任务", func(t *testing.T) {
+		var err error
+		out := captureStdout(t, func() { err = attachJob(context.Background(), "done") })
+		require.NoError(t, err)
+		require.Equal(t, "回答\n", out)
+	})
+
+	t.Run("取回失败的任务", func(t *testing.T) {
+		err := attachJob(context.Background(), "failed")
+		require.ErrorContains(t, err, "出错了")
+	})
+
+	t.Run("取回已丢失的任务", func(t *testing.T) {
+		err := attachJob(context.Background(), "lost")
+		var merr modsError
+		require.ErrorAs(t, err, &merr)
+		require.Equal(t, "后台任务意外退出。", merr.reason)
+	})
+}
+
+func TestWithoutDetach(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args     []string
+		expected []string
+	}{
+		"--detach":      {[]string{"--detach", "-q", "你好"}, []string{"-q", "你好"}},
+		"--detach=true": {[]string{"-q", "--detach=true", "你好"}, []string{"-q", "你好"}},
+		"-- 之后保持不变":     {[]string{"--detach", "--", "--detach"}, []string{"--", "--detach"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, withoutDetach(tc.args))
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strings"
+
+	"github.com/charmbracelet/mods/internal/proto"
 )
 
 // loadMsg 加载消息内容
@@ -37,3 +40,54 @@ func loadMsg(msg string) (string, error) {
 	// 返回原始消息
 	return msg, nil
 }
+
+// loadRoleMsg 加载角色消息，并将其作为模板渲染
+// 远程 URL 的内容不作为模板渲染，避免其通过 env 等函数读取本地信息
+// msg: 角色消息，可以是普通文本、URL 或文件路径
+// role: 角色名称
+// mod: 当前使用的模型
+// 返回：消息内容和错误信息
+func loadRoleMsg(msg, role string, mod Model) (string, error) {
+	content, err := loadMsg(msg)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(msg, "https://") || strings.HasPrefix(msg, "http://") || !strings.Contains(content, "{{") {
+		return content, nil
+	}
+	return executeTemplate(role, content, struct {
+		Role, Model, API string
+	}{role, mod.Name, mod.API})
+}
+
+// loadImage 加载图片
+// src: 本地文件路径或 HTTP/HTTPS URL
+// 返回：图片和错误信息
+func loadImage(src string) (proto.Image, error) {
+	var bts []byte
+	var err error
+	if strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "http://") {
+		var resp *http.Response
+		resp, err = http.Get(src) //nolint:gosec,noctx
+		if err != nil {
+			return proto.Image{}, err //nolint:wrapcheck
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return proto.Image{}, fmt.Errorf("下载 %s 失败: %s", src, resp.Status)
+		}
+		bts, err = io.ReadAll(resp.Body)
+	} else {
+		bts, err = readUserFile(strings.TrimPrefix(src, "file://"))
+	}
+	if err != nil {
+		return proto.Image{}, err //nolint:wrapcheck
+	}
+
+	// 根据内容而非扩展名判断类型
+	mediaType := http.DetectContentType(bts)
+	if !strings.HasPrefix(mediaType, "image/") {
+		return proto.Image{}, fmt.Errorf("%s 不是图片（%s）", src, mediaType)
+	}
+	return proto.Image{MediaType: mediaType, Data: bts}, nil
+}
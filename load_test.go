@@ -42,3 +42,29 @@ func TestLoad(t *testing.T) {
 		require.Contains(t, msg, "MIT License")
 	})
 }
+
+// TestLoadImage 测试加载图片
+func TestLoadImage(t *testing.T) {
+	// 最小的 PNG 文件头
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	t.Run("图片文件", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Chdir(dir)
+		path := filepath.Join(dir, "foo.png")
+		require.NoError(t, os.WriteFile(path, png, 0o644))
+
+		img, err := loadImage(path)
+		require.NoError(t, err)
+		require.Equal(t, "image/png", img.MediaType)
+		require.Equal(t, png, img.Data)
+	})
+
+	t.Run("非图片文件", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "foo.txt")
+		require.NoError(t, os.WriteFile(path, []byte("just text"), 0o644))
+
+		_, err := loadImage(path)
+		require.Error(t, err)
+	})
+}
@@ -3,25 +3,25 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"runtime/debug"
 	"runtime/pprof"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/atotto/clipboard"
-	timeago "github.com/caarlos0/timea.go"
 	tea "github.com/charmbracelet/bubbletea"
 	glamour "github.com/charmbracelet/glamour/styles"
 	"github.com/charmbracelet/huh"
-	"github.com/charmbracelet/mods/internal/cache"
+	"github.com/charmbracelet/mods/internal/proto"
 	"github.com/charmbracelet/x/editor"
-	mcobra "github.com/muesli/mango-cobra"
-	"github.com/muesli/roff"
 	"github.com/muesli/termenv"
 	"github.com/spf13/cobra"
 )
@@ -77,13 +77,134 @@ var (
 		Short:         "命令行上的 GPT。专为管道构建。",
 		SilenceUsage:  true,
 		SilenceErrors: true,
-		Example:       randomExample(),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			config.Prefix = removeWhitespace(strings.Join(args, " "))
 
+			if err := validateExportFormat(config.ExportFormat); err != nil {
+				return err
+			}
+			if (config.Redact || config.Encrypt) && config.ExportFormat == "" {
+				return newUserErrorf("%s 和 %s 需要与 %s 一起使用", stderrStyles().InlineCode.Render("--redact"), stderrStyles().InlineCode.Render("--encrypt"), stderrStyles().InlineCode.Render("--export-format"))
+			}
+			if err := validateTimeFormat(config.TimeFormat); err != nil {
+				return err
+			}
+			warnDeprecations(cmd)
+			printUsageDigest()
+
+			switch {
+			case config.FlushKeys:
+				return flushKeys()
+			case config.Jobs:
+				return listJobs()
+			case config.AttachJob != "":
+				return attachJob(cmd.Context(), config.AttachJob)
+			case config.UI:
+				return runUI(cmd.Context(), config.UIAddr)
+			case config.Import != "":
+				return importConversations(config.Import)
+			case config.Undo != "":
+				return undoConversation(config.Undo, args)
+			case config.ArchiveToNotes != "":
+				return archiveToNotes(config.ArchiveToNotes, args)
+			case config.ShowToolLog != "":
+				return showToolLog(config.ShowToolLog)
+			case config.ExportFinetune != "":
+				return exportFinetune(config.ExportFinetune, args)
+			case config.ReplayRequest != "":
+				return replayRequest(cmd.Context(), config.ReplayRequest)
+			case config.ConvertCache != "":
+				return convertCache(config.ConvertCache)
+			case config.Pack != "":
+				return runPack(config.Pack, args)
+			case config.Detach && config.jobID == "":
+				// 后台任务的子进程沿用原来的参数，其中的 --detach 不再生效
+				return detachJob()
+			case config.Embed:
+				return runEmbed(cmd.Context(), args)
+			case config.Index != "":
+				return runIndex(cmd.Context(), config.Index, args)
+			case config.Map:
+				return runMap(cmd.Context())
+			case config.CSV != "":
+				return runCSV(cmd.Context(), config.CSV)
+			case len(config.Compare) > 0:
+				return runCompare(cmd.Context())
+			}
+
+			if config.Fork != "" {
+				id, title, err := forkConversation(config.Fork)
+				if err != nil {
+					return err
+				}
+				// 没有新的提示时只创建分支，否则在分支上继续
+				if config.Prefix == "" && isInputTTY() && !config.Chat {
+					printFork(id, title)
+					return nil
+				}
+				config.Continue = id
+			}
+
+			if config.Regenerate {
+				if err := prepareRegenerate(); err != nil {
+					return err
+				}
+			}
+
+			var applyOriginal string
+			if config.Apply != "" {
+				original, err := prepareApply()
+				if err != nil {
+					return err
+				}
+				applyOriginal = original
+			}
+
+			if config.Exec {
+				if err := prepareExec(); err != nil {
+					return err
+				}
+			}
+
+			// --n 默认由用户选择候选回答
+			if cmd.Flags().Changed("n") && !cmd.Flags().Changed("pick") {
+				config.Pick = "ask"
+			}
+			if config.Samples > 1 && !slices.Contains([]string{"vote", "best", "all", "ask"}, config.Pick) {
+				return modsError{
+					err: newUserErrorf(
+						"可选的方式有：%s、%s、%s、%s",
+						stderrStyles().InlineCode.Render("vote"),
+						stderrStyles().InlineCode.Render("best"),
+						stderrStyles().InlineCode.Render("all"),
+						stderrStyles().InlineCode.Render("ask"),
+					),
+					reason: fmt.Sprintf("不支持的选择方式 %q。", config.Pick),
+				}
+			}
+
+			if err := validToolApproval(); err != nil {
+				return err
+			}
+
+			if config.DryRun {
+				return dryRun(cmd.Context())
+			}
+
 			opts := []tea.ProgramOption{}
 
-			if !isInputTTY() || config.Raw {
+			if config.Chat && (!isOutputTTY() || config.Raw) {
+				return modsError{
+					err:    newUserErrorf("请在终端中运行，且不要同时使用 %s", stderrStyles().InlineCode.Render("--raw")),
+					reason: "聊天模式需要终端。",
+				}
+			}
+
+			switch {
+			case config.Chat:
+				// 聊天模式下即使 stdin 是管道，也从终端读取后续输入
+				opts = append(opts, tea.WithInputTTY())
+			case !isInputTTY() || config.Raw:
 				opts = append(opts, tea.WithInput(nil))
 			}
 			if isOutputTTY() && !config.Raw {
@@ -96,6 +217,9 @@ var (
 			}
 
 			if isNoArgs() && isInputTTY() && config.openEditor {
+				if config.NoInput {
+					return noInputError("用 --editor 编写提示", "")
+				}
 				prompt, err := prefixFromEditor()
 				if err != nil {
 					return err
@@ -103,7 +227,10 @@ var (
 				config.Prefix = prompt
 			}
 
-			if (isNoArgs() || config.AskModel) && isInputTTY() {
+			if config.AskModel && config.NoInput {
+				return noInputError("--ask-model", "")
+			}
+			if (isNoArgs() || config.AskModel) && isInputTTY() && !config.NoInput {
 				if err := askInfo(); err != nil && err == huh.ErrUserAborted {
 					return modsError{
 						err:    err,
@@ -117,18 +244,36 @@ var (
 				}
 			}
 
-			cache, err := cache.NewConversations(config.CachePath)
+			if err := ensureOllamaModel(cmd.Context()); err != nil {
+				return err
+			}
+
+			cache, err := openConversations()
 			if err != nil {
 				return modsError{err, "无法启动 Bubble Tea 程序。"}
 			}
 			mods := newMods(cmd.Context(), stderrRenderer(), &config, db, cache)
+			mods.ttyProgress = openTTYProgress(&config)
 			p := tea.NewProgram(mods, opts...)
+			mods.program = p
 			m, err := p.Run()
-			if err != nil {
+			mods.ttyProgress.Close()
+			if errors.Is(err, tea.ErrInterrupted) {
+				// 标准输入不是终端时，ctrl+c 以 SIGINT 的形式到达
+				mods.cancelRequests()
+				if !mods.answering() {
+					return exitCodeError{interruptedExitCode}
+				}
+				mods.interrupted = true
+			} else if err != nil {
 				return modsError{err, "无法启动 Bubble Tea 程序。"}
+			} else {
+				mods = m.(*Mods)
 			}
 
-			mods = m.(*Mods)
+			if mods.interrupted {
+				return finishInterrupted(mods)
+			}
 			if mods.Error != nil {
 				return *mods.Error
 			}
@@ -150,6 +295,14 @@ var (
 				return nil
 			}
 
+			if config.DU {
+				return printDiskUsage()
+			}
+
+			if config.Settings && config.SettingsTUI {
+				return editSettingsTUI(config.SettingsPath)
+			}
+
 			if config.Settings {
 				c, err := editor.Cmd("mods", config.SettingsPath)
 				if err != nil {
@@ -196,7 +349,7 @@ var (
 				listRoles()
 				return nil
 			}
-			if config.List {
+			if config.List || config.ListJSON {
 				return listConversations(config.Raw)
 			}
 
@@ -206,9 +359,19 @@ var (
 			}
 
 			if config.MCPListTools {
-				ctx, cancel := context.WithTimeout(cmd.Context(), config.MCPTimeout)
-				defer cancel()
-				return mcpListTools(ctx)
+				return mcpListTools(cmd.Context())
+			}
+
+			if config.MCPListResources {
+				return mcpListResources(cmd.Context())
+			}
+
+			if config.MCPListPrompts {
+				return mcpListPrompts(cmd.Context())
+			}
+
+			if config.MCPLogin != "" {
+				return mcpLogin(cmd.Context(), config.MCPLogin)
 			}
 
 			if len(config.Delete) > 0 {
@@ -219,8 +382,38 @@ var (
 				return deleteConversationOlderThan()
 			}
 
-			// 原始模式已经打印输出，无需再次打印
-			if isOutputTTY() && !config.Raw {
+			if config.Samples > 1 && config.Show == "" && !config.ShowLast {
+				if err := pickSample(cmd.Context(), mods); err != nil {
+					return err
+				}
+			}
+
+			if config.Critic && config.Show == "" && !config.ShowLast {
+				if err := runCritic(cmd.Context(), mods, opts); err != nil {
+					return err
+				}
+			}
+
+			switch {
+			case config.ExportFormat != "":
+				if err := shareConversation(os.Stdout, mods.exportTitle(), mods.messages); err != nil {
+					return modsError{err, "无法导出对话。"}
+				}
+			case config.ExtractCode != "":
+				code := extractCode(mods.Output, config.ExtractCode)
+				if code == "" {
+					fmt.Fprintln(os.Stderr, "回答中没有找到代码块。")
+				}
+				fmt.Print(code)
+			case config.Apply != "":
+				// 保存对话后再预览并应用修改
+			case config.Exec:
+				// 保存对话后再展示并执行命令
+			case (config.Critic || config.Samples > 1) && (!isOutputTTY() || config.Raw):
+				// 自评或选出回答后才输出最终的回答
+				fmt.Println(mods.Output)
+			case isOutputTTY() && !config.Raw:
+				// 原始模式已经打印输出，无需再次打印
 				switch {
 				case mods.glamOutput != "":
 					fmt.Print(mods.glamOutput)
@@ -233,10 +426,30 @@ var (
 				return nil
 			}
 
+			if len(mods.ragSources) > 0 && config.ExportFormat == "" && config.ExtractCode == "" && config.Apply == "" && !config.Exec {
+				fmt.Print("\n" + ragSources(mods.ragSources))
+			}
+
+			if !config.Quiet && mods.usage != (proto.Usage{}) {
+				fmt.Fprintln(os.Stderr, "\n"+stderrStyles().Comment.Render(mods.usageSummary()))
+			}
+
 			if config.cacheWriteToID != "" {
-				return saveConversation(mods)
+				if err := saveConversation(mods); err != nil {
+					return err
+				}
+				if err := saveSamples(mods); err != nil {
+					return err
+				}
 			}
+			dispatchOutputs(cmd.Context(), mods)
 
+			if config.Apply != "" {
+				return applyEdit(config.Apply, applyOriginal, mods.Output)
+			}
+			if config.Exec {
+				return runExec(cmd.Context(), mods, opts)
+			}
 			return nil
 		},
 	}
@@ -246,54 +459,151 @@ var memprofile bool // 内存分析标志
 
 func initFlags() {
 	flags := rootCmd.Flags()
-	flags.StringVarP(&config.Model, "model", "m", config.Model, stdoutStyles().FlagDesc.Render(help["model"]))
-	flags.BoolVarP(&config.AskModel, "ask-model", "M", config.AskModel, stdoutStyles().FlagDesc.Render(help["ask-model"]))
-	flags.StringVarP(&config.API, "api", "a", config.API, stdoutStyles().FlagDesc.Render(help["api"]))
-	flags.StringVarP(&config.HTTPProxy, "http-proxy", "x", config.HTTPProxy, stdoutStyles().FlagDesc.Render(help["http-proxy"]))
-	flags.BoolVarP(&config.Format, "format", "f", config.Format, stdoutStyles().FlagDesc.Render(help["format"]))
-	flags.StringVar(&config.FormatAs, "format-as", config.FormatAs, stdoutStyles().FlagDesc.Render(help["format-as"]))
-	flags.BoolVarP(&config.Raw, "raw", "r", config.Raw, stdoutStyles().FlagDesc.Render(help["raw"]))
-	flags.IntVarP(&config.IncludePrompt, "prompt", "P", config.IncludePrompt, stdoutStyles().FlagDesc.Render(help["prompt"]))
-	flags.BoolVarP(&config.IncludePromptArgs, "prompt-args", "p", config.IncludePromptArgs, stdoutStyles().FlagDesc.Render(help["prompt-args"]))
-	flags.StringVarP(&config.Continue, "continue", "c", "", stdoutStyles().FlagDesc.Render(help["continue"]))
-	flags.BoolVarP(&config.ContinueLast, "continue-last", "C", false, stdoutStyles().FlagDesc.Render(help["continue-last"]))
-	flags.BoolVarP(&config.List, "list", "l", config.List, stdoutStyles().FlagDesc.Render(help["list"]))
-	flags.StringVarP(&config.Title, "title", "t", config.Title, stdoutStyles().FlagDesc.Render(help["title"]))
-	flags.StringArrayVarP(&config.Delete, "delete", "d", config.Delete, stdoutStyles().FlagDesc.Render(help["delete"]))
-	flags.Var(newDurationFlag(config.DeleteOlderThan, &config.DeleteOlderThan), "delete-older-than", stdoutStyles().FlagDesc.Render(help["delete-older-than"]))
-	flags.StringVarP(&config.Show, "show", "s", config.Show, stdoutStyles().FlagDesc.Render(help["show"]))
-	flags.BoolVarP(&config.ShowLast, "show-last", "S", false, stdoutStyles().FlagDesc.Render(help["show-last"]))
-	flags.BoolVarP(&config.Quiet, "quiet", "q", config.Quiet, stdoutStyles().FlagDesc.Render(help["quiet"]))
-	flags.BoolVarP(&config.ShowHelp, "help", "h", false, stdoutStyles().FlagDesc.Render(help["help"]))
-	flags.BoolVarP(&config.Version, "version", "v", false, stdoutStyles().FlagDesc.Render(help["version"]))
-	flags.IntVar(&config.MaxRetries, "max-retries", config.MaxRetries, stdoutStyles().FlagDesc.Render(help["max-retries"]))
-	flags.BoolVar(&config.NoLimit, "no-limit", config.NoLimit, stdoutStyles().FlagDesc.Render(help["no-limit"]))
-	flags.Int64Var(&config.MaxTokens, "max-tokens", config.MaxTokens, stdoutStyles().FlagDesc.Render(help["max-tokens"]))
-	flags.IntVar(&config.WordWrap, "word-wrap", config.WordWrap, stdoutStyles().FlagDesc.Render(help["word-wrap"]))
-	flags.Float64Var(&config.Temperature, "temp", config.Temperature, stdoutStyles().FlagDesc.Render(help["temp"]))
-	flags.StringArrayVar(&config.Stop, "stop", config.Stop, stdoutStyles().FlagDesc.Render(help["stop"]))
-	flags.Float64Var(&config.TopP, "topp", config.TopP, stdoutStyles().FlagDesc.Render(help["topp"]))
-	flags.Int64Var(&config.TopK, "topk", config.TopK, stdoutStyles().FlagDesc.Render(help["topk"]))
-	flags.UintVar(&config.Fanciness, "fanciness", config.Fanciness, stdoutStyles().FlagDesc.Render(help["fanciness"]))
-	flags.StringVar(&config.StatusText, "status-text", config.StatusText, stdoutStyles().FlagDesc.Render(help["status-text"]))
-	flags.BoolVar(&config.NoCache, "no-cache", config.NoCache, stdoutStyles().FlagDesc.Render(help["no-cache"]))
-	flags.BoolVar(&config.ResetSettings, "reset-settings", config.ResetSettings, stdoutStyles().FlagDesc.Render(help["reset-settings"]))
-	flags.BoolVar(&config.Settings, "settings", false, stdoutStyles().FlagDesc.Render(help["settings"]))
-	flags.BoolVar(&config.Dirs, "dirs", false, stdoutStyles().FlagDesc.Render(help["dirs"]))
-	flags.StringVarP(&config.Role, "role", "R", config.Role, stdoutStyles().FlagDesc.Render(help["role"]))
-	flags.BoolVar(&config.ListRoles, "list-roles", config.ListRoles, stdoutStyles().FlagDesc.Render(help["list-roles"]))
-	flags.StringVar(&config.Theme, "theme", "charm", stdoutStyles().FlagDesc.Render(help["theme"]))
-	flags.BoolVarP(&config.openEditor, "editor", "e", false, stdoutStyles().FlagDesc.Render(help["editor"]))
-	flags.BoolVar(&config.MCPList, "mcp-list", false, stdoutStyles().FlagDesc.Render(help["mcp-list"]))
-	flags.BoolVar(&config.MCPListTools, "mcp-list-tools", false, stdoutStyles().FlagDesc.Render(help["mcp-list-tools"]))
-	flags.StringArrayVar(&config.MCPDisable, "mcp-disable", nil, stdoutStyles().FlagDesc.Render(help["mcp-disable"]))
+	flags.StringVarP(&config.Model, "model", "m", config.Model, help["model"])
+	flags.BoolVarP(&config.AskModel, "ask-model", "M", config.AskModel, help["ask-model"])
+	flags.StringVarP(&config.API, "api", "a", config.API, help["api"])
+	flags.StringVarP(&config.HTTPProxy, "http-proxy", "x", config.HTTPProxy, help["http-proxy"])
+	flags.BoolVarP(&config.Format, "format", "f", config.Format, help["format"])
+	flags.StringVar(&config.FormatAs, "format-as", config.FormatAs, help["format-as"])
+	flags.BoolVarP(&config.Raw, "raw", "r", config.Raw, help["raw"])
+	flags.BoolVar(&config.NoGuessLang, "no-guess-lang", config.NoGuessLang, help["no-guess-lang"])
+	flags.BoolVar(&config.NoHyperlinks, "no-hyperlinks", config.NoHyperlinks, help["no-hyperlinks"])
+	flags.IntVarP(&config.IncludePrompt, "prompt", "P", config.IncludePrompt, help["prompt"])
+	flags.IntVar(&config.StdinHead, "stdin-head", 0, help["stdin-head"])
+	flags.IntVar(&config.StdinTail, "stdin-tail", 0, help["stdin-tail"])
+	flags.BoolVarP(&config.IncludePromptArgs, "prompt-args", "p", config.IncludePromptArgs, help["prompt-args"])
+	flags.StringVarP(&config.Continue, "continue", "c", "", help["continue"])
+	flags.BoolVarP(&config.ContinueLast, "continue-last", "C", false, help["continue-last"])
+	flags.BoolVar(&config.Chat, "chat", false, help["chat"])
+	flags.BoolVar(&config.Map, "map", false, help["map"])
+	flags.StringVar(&config.MapDelimiter, "map-delimiter", "", help["map-delimiter"])
+	flags.StringVar(&config.MapFormat, "map-format", mapFormatPlain, help["map-format"])
+	flags.IntVar(&config.MapWorkers, "map-workers", config.MapWorkers, help["map-workers"])
+	flags.StringSliceVar(&config.Compare, "compare", nil, help["compare"])
+	flags.StringVar(&config.CompareLayout, "compare-layout", compareStacked, help["compare-layout"])
+	flags.StringVar(&config.CSV, "csv", "", help["csv"])
+	flags.StringVar(&config.Apply, "apply", "", help["apply"])
+	flags.BoolVar(&config.Exec, "exec", false, help["exec"])
+	flags.StringVar(&config.ExtractCode, "extract-code", "", help["extract-code"])
+	flags.StringVar(&config.ExportFormat, "export-format", "", help["export-format"])
+	flags.BoolVar(&config.Redact, "redact", false, help["redact"])
+	flags.BoolVar(&config.Encrypt, "encrypt", false, help["encrypt"])
+	flags.StringVar(&config.Import, "import", "", help["import"])
+	flags.StringVar(&config.Fork, "fork", "", help["fork"])
+	flags.BoolVar(&config.Regenerate, "regenerate", false, help["regenerate"])
+	flags.StringVar(&config.Undo, "undo", "", help["undo"])
+	flags.StringVar(&config.ArchiveToNotes, "archive-to-notes", "", help["archive-to-notes"])
+	flags.StringVar(&config.ShowToolLog, "show-tool-log", "", help["show-tool-log"])
+	flags.StringVar(&config.Pack, "pack", "", help["pack"])
+	flags.BoolVar(&config.NoRules, "no-rules", false, help["no-rules"])
+	flags.BoolVar(&config.NoOutputs, "no-outputs", false, help["no-outputs"])
+	flags.StringVar(&config.ExportFinetune, "export-finetune", "", help["export-finetune"])
+	flags.StringSliceVar(&config.FinetuneTags, "finetune-tag", nil, help["finetune-tag"])
+	flags.StringVar(&config.ConvertCache, "convert-cache", "", help["convert-cache"])
+	flags.StringVar(&config.SaveRequest, "save-request", "", help["save-request"])
+	flags.StringVar(&config.ReplayRequest, "replay-request", "", help["replay-request"])
+	flags.BoolVar(&config.FlushKeys, "flush-keys", false, help["flush-keys"])
+	flags.BoolVar(&config.DryRun, "dry-run", false, help["dry-run"])
+	flags.BoolVar(&config.Detach, "detach", false, help["detach"])
+	flags.BoolVar(&config.Jobs, "jobs", false, help["jobs"])
+	flags.StringVar(&config.AttachJob, "attach-job", "", help["attach-job"])
+	flags.BoolVar(&config.UI, "ui", false, help["ui"])
+	flags.StringVar(&config.UIAddr, "ui-addr", uiDefaultAddr, help["ui-addr"])
+	flags.BoolVarP(&config.List, "list", "l", config.List, help["list"])
+	flags.BoolVar(&config.ListJSON, "list-json", false, help["list-json"])
+	flags.StringVarP(&config.Title, "title", "t", config.Title, help["title"])
+	flags.StringArrayVarP(&config.Delete, "delete", "d", config.Delete, help["delete"])
+	flags.Var(newDurationFlag(config.DeleteOlderThan, &config.DeleteOlderThan), "delete-older-than", help["delete-older-than"])
+	flags.StringVarP(&config.Show, "show", "s", config.Show, help["show"])
+	flags.BoolVarP(&config.ShowLast, "show-last", "S", false, help["show-last"])
+	flags.BoolVar(&config.ShowMeta, "meta", false, help["meta"])
+	flags.BoolVarP(&config.Quiet, "quiet", "q", config.Quiet, help["quiet"])
+	flags.BoolVarP(&config.Yes, "yes", "y", false, help["yes"])
+	flags.BoolVar(&config.NoInput, "no-input", false, help["no-input"])
+	flags.BoolVarP(&config.ShowHelp, "help", "h", false, help["help"])
+	flags.BoolVarP(&config.Version, "version", "v", false, help["version"])
+	flags.IntVar(&config.MaxRetries, "max-retries", config.MaxRetries, help["max-retries"])
+	flags.BoolVar(&config.Critic, "critic", config.Critic, help["critic"])
+	flags.IntVar(&config.CriticRetries, "critic-retries", config.CriticRetries, help["critic-retries"])
+	flags.IntVar(&config.Samples, "samples", config.Samples, help["samples"])
+	flags.IntVar(&config.Samples, "n", config.Samples, help["n"])
+	flags.StringVar(&config.Pick, "pick", config.Pick, help["pick"])
+	flags.StringVar(&config.Judge, "judge", config.Judge, help["judge"])
+	flags.BoolVar(&config.KeepAll, "keep-all", config.KeepAll, help["keep-all"])
+	flags.DurationVar(&config.RetryBudget, "retry-budget", config.RetryBudget, help["retry-budget"])
+	flags.DurationVar(&config.RetryMaxWait, "retry-max-wait", config.RetryMaxWait, help["retry-max-wait"])
+	flags.Var(&config.RequestTimeout, "timeout", help["request-timeout"])
+	flags.BoolVar(&config.NoLimit, "no-limit", config.NoLimit, help["no-limit"])
+	flags.BoolVar(&config.PromptCache, "prompt-cache", config.PromptCache, help["prompt-cache"])
+	flags.StringVar(&config.CompactionModel, "compaction-model", config.CompactionModel, help["compaction-model"])
+	flags.Var(&config.MaxRequestSize, "max-request-size", help["max-request-size"])
+	flags.StringVar(&config.ToolApproval, "tool-approval", config.ToolApproval, help["tool-approval"])
+	flags.BoolVar(&config.AllowOutsideCwd, "allow-outside-cwd", config.AllowOutsideCwd, help["allow-outside-cwd"])
+	flags.Var(&config.Throttle, "throttle", help["throttle"])
+	flags.BoolVar(&config.Embed, "embed", false, help["embed"])
+	flags.StringVar(&config.EmbedModel, "embed-model", config.EmbedModel, help["embed-model"])
+	flags.StringVar(&config.EmbedFormat, "embed-format", config.EmbedFormat, help["embed-format"])
+	flags.StringVar(&config.Index, "index", "", help["index"])
+	flags.StringVar(&config.RAG, "rag", "", help["rag"])
+	flags.IntVar(&config.RAGTopK, "rag-top-k", config.RAGTopK, help["rag-top-k"])
+	flags.Int64Var(&config.MaxTokens, "max-tokens", config.MaxTokens, help["max-tokens"])
+	flags.IntVar(&config.WordWrap, "word-wrap", config.WordWrap, help["word-wrap"])
+	flags.StringVar(&config.TimeFormat, "time-format", config.TimeFormat, help["time-format"])
+	flags.Float64Var(&config.Temperature, "temp", config.Temperature, help["temp"])
+	flags.StringArrayVar(&config.Stop, "stop", config.Stop, help["stop"])
+	flags.Float64Var(&config.TopP, "topp", config.TopP, help["topp"])
+	flags.Int64Var(&config.TopK, "topk", config.TopK, help["topk"])
+	flags.StringArrayVar(&config.SearchDomains, "search-domains", config.SearchDomains, help["search-domains"])
+	flags.StringVar(&config.SearchRecency, "search-recency", config.SearchRecency, help["search-recency"])
+	flags.BoolVar(&config.SafePrompt, "safe-prompt", config.SafePrompt, help["safe-prompt"])
+	flags.StringVar(&config.KeepAlive, "keep-alive", config.KeepAlive, help["keep-alive"])
+	flags.IntVar(&config.NumGPU, "num-gpu", config.NumGPU, help["num-gpu"])
+	flags.IntVar(&config.NumThread, "num-thread", config.NumThread, help["num-thread"])
+	flags.Float64Var(&config.RepeatPenalty, "repeat-penalty", config.RepeatPenalty, help["repeat-penalty"])
+	flags.IntVar(&config.Mirostat, "mirostat", config.Mirostat, help["mirostat"])
+	flags.UintVar(&config.Fanciness, "fanciness", config.Fanciness, help["fanciness"])
+	flags.StringVar(&config.StatusText, "status-text", config.StatusText, help["status-text"])
+	flags.BoolVar(&config.PlainProgress, "plain-progress", config.PlainProgress, help["plain-progress"])
+	flags.BoolVar(&config.TTYProgress, "tty-progress", config.TTYProgress, help["tty-progress"])
+	flags.BoolVar(&config.NoDeprecationWarnings, "no-deprecation-warnings", config.NoDeprecationWarnings, help["no-deprecation-warnings"])
+	flags.BoolVar(&config.NoCache, "no-cache", config.NoCache, help["no-cache"])
+	flags.BoolVar(&config.ResetSettings, "reset-settings", config.ResetSettings, help["reset-settings"])
+	flags.BoolVar(&config.Settings, "settings", false, help["settings"])
+	flags.BoolVar(&config.SettingsTUI, "tui", false, help["tui"])
+	flags.BoolVar(&config.Dirs, "dirs", false, help["dirs"])
+	flags.BoolVar(&config.DU, "du", false, help["du"])
+	flags.StringVarP(&config.Role, "role", "R", config.Role, help["role"])
+	flags.StringArrayVarP(&config.Images, "attach", "A", nil, help["attach"])
+	flags.BoolVar(&config.ListRoles, "list-roles", config.ListRoles, help["list-roles"])
+	flags.StringVar(&config.Theme, "theme", "charm", help["theme"])
+	flags.BoolVarP(&config.openEditor, "editor", "e", false, help["editor"])
+	flags.BoolVar(&config.MCPList, "mcp-list", false, help["mcp-list"])
+	flags.BoolVar(&config.MCPListTools, "mcp-list-tools", false, help["mcp-list-tools"])
+	flags.BoolVar(&config.MCPListResources, "mcp-list-resources", false, help["mcp-list-resources"])
+	flags.BoolVar(&config.MCPListPrompts, "mcp-list-prompts", false, help["mcp-list-prompts"])
+	flags.StringArrayVar(&config.MCPResources, "mcp-resource", nil, help["mcp-resource"])
+	flags.StringVar(&config.MCPPrompt, "mcp-prompt", "", help["mcp-prompt"])
+	flags.StringArrayVar(&config.MCPPromptArgs, "mcp-prompt-arg", nil, help["mcp-prompt-arg"])
+	flags.StringVar(&config.MCPLogin, "mcp-login", "", help["mcp-login"])
+	flags.StringArrayVar(&config.MCPDisable, "mcp-disable", nil, help["mcp-disable"])
+	flags.BoolVar(&config.ToolOutputOnly, "tool-output-only", config.ToolOutputOnly, help["tool-output-only"])
+	flags.IntVar(&config.MaxToolRounds, "max-tool-rounds", config.MaxToolRounds, help["max-tool-rounds"])
+	flags.Var(&config.MaxToolResult, "max-tool-result", help["max-tool-result"])
+	flags.BoolVar(&config.ShowReasoning, "show-reasoning", config.ShowReasoning, help["show-reasoning"])
+	flags.BoolVar(&config.HideReasoning, "hide-reasoning", config.HideReasoning, help["hide-reasoning"])
 	flags.Lookup("prompt").NoOptDefVal = "-1"
+	flags.Lookup("undo").NoOptDefVal = undoLast
+	flags.Lookup("archive-to-notes").NoOptDefVal = archiveLast
+	flags.Lookup("extract-code").NoOptDefVal = extractAll
 	flags.SortFlags = false
 
 	flags.BoolVar(&memprofile, "memprofile", false, "Write memory profiles to CWD")
 	_ = flags.MarkHidden("memprofile")
+	flags.StringVar(&config.jobID, "job", "", "Run as the given background job")
+	_ = flags.MarkHidden("job")
+	hideDeprecatedFlags(flags)
 
-	for _, name := range []string{"show", "delete", "continue"} {
+	for _, name := range []string{"show", "delete", "continue", "fork", "undo", "archive-to-notes", "show-tool-log"} {
 		_ = rootCmd.RegisterFlagCompletionFunc(name, func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 			results, _ := db.Completions(toComplete)
 			return results, cobra.ShellCompDirectiveDefault
@@ -319,6 +629,30 @@ func initFlags() {
 		config.MCPTimeout = defaultConfig().MCPTimeout
 	}
 
+	if config.RetryMaxWait == 0 {
+		config.RetryMaxWait = defaultConfig().RetryMaxWait
+	}
+
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = defaultConfig().RequestTimeout
+	}
+
+	if config.CriticRetries == 0 {
+		config.CriticRetries = defaultConfig().CriticRetries
+	}
+
+	if config.Pick == "" {
+		config.Pick = defaultConfig().Pick
+	}
+
+	if config.ToolApproval == "" {
+		config.ToolApproval = defaultConfig().ToolApproval
+	}
+
+	if config.RAGTopK == 0 {
+		config.RAGTopK = defaultConfig().RAGTopK
+	}
+
 	rootCmd.MarkFlagsMutuallyExclusive(
 		"settings",
 		"show",
@@ -326,12 +660,48 @@ func initFlags() {
 		"delete",
 		"delete-older-than",
 		"list",
+		"list-json",
 		"continue",
 		"continue-last",
 		"reset-settings",
 		"mcp-list",
 		"mcp-list-tools",
+		"mcp-list-resources",
+		"mcp-list-prompts",
+		"mcp-login",
+		"jobs",
+		"attach-job",
+		"ui",
+		"import",
+		"fork",
+		"undo",
+		"archive-to-notes",
+		"show-tool-log",
+		"export-finetune",
+		"replay-request",
+		"convert-cache",
+		"pack",
+		"du",
 	)
+	rootCmd.MarkFlagsMutuallyExclusive("detach", "chat")
+	rootCmd.MarkFlagsMutuallyExclusive("no-input", "chat")
+	rootCmd.MarkFlagsMutuallyExclusive("plain-progress", "chat")
+	rootCmd.MarkFlagsMutuallyExclusive("critic", "chat")
+	rootCmd.MarkFlagsMutuallyExclusive("samples", "n", "map", "csv", "chat")
+	// --compare 自己选择模型、只发送一次请求
+	for _, flag := range []string{"model", "samples", "n", "map", "csv", "chat", "detach"} {
+		rootCmd.MarkFlagsMutuallyExclusive("compare", flag)
+	}
+	rootCmd.MarkFlagsMutuallyExclusive("show-reasoning", "hide-reasoning")
+	rootCmd.MarkFlagsMutuallyExclusive("map", "csv", "chat")
+	rootCmd.MarkFlagsMutuallyExclusive("embed", "map", "csv", "chat")
+	rootCmd.MarkFlagsMutuallyExclusive("index", "rag", "embed", "map", "csv")
+	rootCmd.MarkFlagsMutuallyExclusive("regenerate", "map", "csv", "chat")
+	rootCmd.MarkFlagsMutuallyExclusive("export-format", "map", "csv", "chat")
+	rootCmd.MarkFlagsMutuallyExclusive("extract-code", "export-format", "map", "csv", "chat")
+	rootCmd.MarkFlagsMutuallyExclusive("apply", "extract-code", "export-format", "map", "csv", "chat", "regenerate")
+	rootCmd.MarkFlagsMutuallyExclusive("dry-run", "detach", "map", "csv", "chat")
+	rootCmd.MarkFlagsMutuallyExclusive("exec", "apply", "extract-code", "export-format", "map", "csv", "chat", "detach")
 }
 
 func main() {
@@ -378,19 +748,25 @@ func main() {
 			Hidden:                true,
 			Args:                  cobra.NoArgs,
 			RunE: func(*cobra.Command, []string) error {
-				manPage, err := mcobra.NewManPage(1, rootCmd)
-				if err != nil {
-					//nolint:wrapcheck
-					return err
-				}
-				_, err = fmt.Fprint(os.Stdout, manPage.Build(roff.NewDocument()))
+				_, err := fmt.Fprint(os.Stdout, buildManPage(rootCmd))
 				//nolint:wrapcheck
 				return err
 			},
 		})
 	}
 
-	if err := rootCmd.Execute(); err != nil {
+	err = rootCmd.Execute()
+	// 退出前关闭 MCP 服务器的连接，并终止仍在运行的服务器，例如工具调用中途按下 ctrl+c
+	mcpConns.closeAll()
+	mcpProcesses.terminateAll()
+	writeJobExit(err)
+	var cerr exitCodeError
+	if errors.As(err, &cerr) {
+		// 命令已经输出了自己的错误
+		_ = db.Close()
+		os.Exit(cerr.code)
+	}
+	if err != nil {
 		handleError(err)
 		_ = db.Close()
 		os.Exit(1)
@@ -537,31 +913,18 @@ func deleteConversationOlderThan() error {
 		return nil
 	}
 
+	// 安静模式只是不列出对话，仍然需要确认，使用 --yes 跳过
 	if !config.Quiet {
 		printList(conversations)
-
-		if !isOutputTTY() || !isInputTTY() {
-			fmt.Fprintln(os.Stderr)
-			return newUserErrorf(
-				"要删除上述对话，请运行: %s",
-				strings.Join(append(os.Args, "--quiet"), " "),
-			)
-		}
-		var confirm bool
-		if err := huh.Run(
-			huh.NewConfirm().
-				Title(fmt.Sprintf("删除早于 %s 的对话？", config.DeleteOlderThan)).
-				Description(fmt.Sprintf("这将删除上面列出的所有 %d 个对话。", len(conversations))).
-				Value(&confirm),
-		); err != nil {
-			return modsError{err, "无法删除旧对话。"}
-		}
-		if !confirm {
-			return newUserErrorf("用户中止")
-		}
+	}
+	if err := confirmAction(
+		fmt.Sprintf("删除早于 %s 的对话？", olderThanLabel(config.DeleteOlderThan)),
+		fmt.Sprintf("这将删除 %d 个对话。", len(conversations)),
+	); err != nil {
+		return err
 	}
 
-	cache, err := cache.NewConversations(config.CachePath)
+	cache, err := openConversations()
 	if err != nil {
 		return modsError{err, "无法删除对话。"}
 	}
@@ -575,7 +938,7 @@ func deleteConversationOlderThan() error {
 		}
 
 		if !config.Quiet {
-			fmt.Fprintln(os.Stderr, "对话已删除:", c.ID[:sha1minLen])
+			fmt.Fprintln(os.Stderr, "对话已删除:", shortID(c.ID))
 		}
 	}
 
@@ -602,7 +965,7 @@ func deleteConversation(convo *Conversation) error {
 		return modsError{err, "无法删除对话。"}
 	}
 
-	cache, err := cache.NewConversations(config.CachePath)
+	cache, err := openConversations()
 	if err != nil {
 		return modsError{err, "无法删除对话。"}
 	}
@@ -611,7 +974,7 @@ func deleteConversation(convo *Conversation) error {
 	}
 
 	if !config.Quiet {
-		fmt.Fprintln(os.Stderr, "对话已删除:", convo.ID[:sha1minLen])
+		fmt.Fprintln(os.Stderr, "对话已删除:", shortID(convo.ID))
 	}
 	return nil
 }
@@ -623,12 +986,16 @@ func listConversations(raw bool) error {
 		return modsError{err, "无法列出保存的对话。"}
 	}
 
+	if config.ListJSON {
+		return printListJSON(conversations)
+	}
+
 	if len(conversations) == 0 {
 		fmt.Fprintln(os.Stderr, "未找到对话。")
 		return nil
 	}
 
-	if isInputTTY() && isOutputTTY() && !raw {
+	if canPrompt() && !raw {
 		selectFromList(conversations)
 		return nil
 	}
@@ -668,8 +1035,8 @@ func listRoles() {
 func makeOptions(conversations []Conversation) []huh.Option[string] {
 	opts := make([]huh.Option[string], 0, len(conversations))
 	for _, c := range conversations {
-		timea := stdoutStyles().Timeago.Render(timeago.Of(c.UpdatedAt))
-		left := stdoutStyles().SHA1.Render(c.ID[:sha1short])
+		timea := stdoutStyles().Timeago.Render(formatTime(c.UpdatedAt))
+		left := stdoutStyles().SHA1.Render(shortID(c.ID))
 		right := stdoutStyles().ConversationList.Render(c.Title, timea)
 		if c.Model != nil {
 			right += stdoutStyles().Comment.Render(*c.Model)
@@ -724,13 +1091,47 @@ func printList(conversations []Conversation) {
 		_, _ = fmt.Fprintf(
 			os.Stdout,
 			"%s\t%s\t%s\n",
-			stdoutStyles().SHA1.Render(conversation.ID[:sha1short]),
+			linkConversationID(stdoutStyles().SHA1.Render(shortID(conversation.ID)), conversation.ID),
 			conversation.Title,
-			stdoutStyles().Timeago.Render(timeago.Of(conversation.UpdatedAt)),
+			stdoutStyles().Timeago.Render(formatTime(conversation.UpdatedAt)),
 		)
 	}
 }
 
+// listedConversation 是 --list-json 输出的对话
+type listedConversation struct {
+	ID        string    `json:"id"`         // 对话 ID
+	Title     string    `json:"title"`      // 对话标题
+	API       string    `json:"api"`        // API 名称
+	Model     string    `json:"model"`      // 模型名称
+	UpdatedAt time.Time `json:"updated_at"` // 更新时间
+}
+
+// printListJSON 以 JSON 数组输出对话列表，没有对话时输出空数组
+func printListJSON(conversations []Conversation) error {
+	list := make([]listedConversation, 0, len(conversations))
+	for _, c := range conversations {
+		item := listedConversation{
+			ID:        c.ID,
+			Title:     c.Title,
+			UpdatedAt: c.UpdatedAt,
+		}
+		if c.API != nil {
+			item.API = *c.API
+		}
+		if c.Model != nil {
+			item.Model = *c.Model
+		}
+		list = append(list, item)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(list); err != nil {
+		return modsError{err, "无法输出对话列表。"}
+	}
+	return nil
+}
+
 // saveConversation 保存对话
 // mods: Mods 实例
 // 返回：错误信息
@@ -747,43 +1148,63 @@ func saveConversation(mods *Mods) error {
 		return nil
 	}
 
-	// 如果消息是 sha1，则使用最后的提示代替。
-	id := config.cacheWriteToID
-	title := strings.TrimSpace(config.cacheWriteToTitle)
-
-	if sha1reg.MatchString(title) || title == "" {
-		title = firstLine(lastPrompt(mods.messages))
-	}
-
-	errReason := fmt.Sprintf(
-		"将 %s 写入缓存时出现问题。使用 %s / %s 禁用它。",
-		config.cacheWriteToID,
-		stderrStyles().InlineCode.Render("--no-cache"),
-		stderrStyles().InlineCode.Render("NO_CACHE"),
-	)
-	cache, err := cache.NewConversations(config.CachePath)
+	title, err := storeConversation(mods)
 	if err != nil {
-		return modsError{err, errReason}
-	}
-	if err := cache.Write(id, &mods.messages); err != nil {
-		return modsError{err, errReason}
-	}
-	if err := db.Save(id, title, config.API, config.Model); err != nil {
-		_ = cache.Delete(id) // 删除残留数据
-		return modsError{err, errReason}
+		return modsError{err, fmt.Sprintf(
+			"将 %s 写入缓存时出现问题。使用 %s / %s 禁用它。",
+			config.cacheWriteToID,
+			stderrStyles().InlineCode.Render("--no-cache"),
+			stderrStyles().InlineCode.Render("NO_CACHE"),
+		)}
 	}
 
 	if !config.Quiet {
 		fmt.Fprintln(
 			os.Stderr,
 			"\n对话已保存:",
-			stderrStyles().InlineCode.Render(config.cacheWriteToID[:sha1short]),
+			stderrStyles().InlineCode.Render(shortID(config.cacheWriteToID)),
 			stderrStyles().Comment.Render(title),
 		)
 	}
 	return nil
 }
 
+// storeConversation 将对话写入缓存与数据库
+// mods: Mods 实例
+// 返回：保存时使用的标题和错误信息
+func storeConversation(mods *Mods) (string, error) {
+	cfg := mods.Config
+	// 如果消息是 sha1，则使用最后的提示代替。
+	id := cfg.cacheWriteToID
+	title := strings.TrimSpace(cfg.cacheWriteToTitle)
+
+	if sha1reg.MatchString(title) || title == "" {
+		title = firstLine(lastPrompt(mods.messages))
+	}
+
+	if err := mods.cache.Write(id, &mods.messages); err != nil {
+		return title, err //nolint:wrapcheck
+	}
+	if err := mods.db.Save(id, title, cfg.API, cfg.Model); err != nil {
+		_ = mods.cache.Delete(id) // 删除残留数据
+		return title, err
+	}
+	reqMeta := newRequestMeta(cfg)
+	reqMeta.Truncated = mods.interrupted
+	meta, err := encodeRequestMeta(reqMeta)
+	if err != nil {
+		return title, err
+	}
+	if err := mods.db.SaveMeta(id, meta); err != nil {
+		return title, err
+	}
+	if err := mods.db.AddUsage(id, mods.unsavedUsage); err != nil {
+		return title, err
+	}
+	mods.unsavedUsage = proto.Usage{}
+	return title, nil
+}
+
 // isNoArgs 检查是否没有参数
 func isNoArgs() bool {
 	return config.Prefix == "" &&
@@ -793,12 +1214,20 @@ func isNoArgs() bool {
 		config.DeleteOlderThan == 0 &&
 		!config.ShowHelp &&
 		!config.List &&
+		!config.ListJSON &&
 		!config.ListRoles &&
 		!config.MCPList &&
 		!config.MCPListTools &&
+		!config.MCPListResources &&
+		!config.MCPListPrompts &&
+		config.MCPPrompt == "" &&
+		config.MCPLogin == "" &&
 		!config.Dirs &&
+		!config.DU &&
 		!config.Settings &&
-		!config.ResetSettings
+		!config.ResetSettings &&
+		!config.Chat &&
+		!config.Regenerate
 }
 
 // askInfo 询问信息
@@ -821,6 +1250,27 @@ func askInfo() error {
 				foundModel = true
 			}
 		}
+		// Ollama 列出实际安装的模型，而不是设置中的模型
+		if config.AskModel && api.Name == "ollama" {
+			if names, err := ollamaModels(context.Background(), api); err == nil && len(names) > 0 {
+				opts[api.Name] = opts[api.Name][:0]
+				for _, name := range names {
+					opts[api.Name] = append(opts[api.Name], huh.NewOption(name, name))
+				}
+			}
+		}
+		// OpenRouter 的模型列表从 /models 获取，设置中只需写常用的几个
+		if config.AskModel && isOpenRouter(api) {
+			models, err := openRouterModels(context.Background(), api)
+			if err != nil {
+				continue
+			}
+			for _, name := range slices.Sorted(maps.Keys(models)) {
+				if _, ok := api.Models[name]; !ok {
+					opts[api.Name] = append(opts[api.Name], huh.NewOption(name, name))
+				}
+			}
+		}
 	}
 
 	if config.ContinueLast {
@@ -974,3 +1424,23 @@ func prefixFromEditor() (string, error) {
 	}
 	return string(prompt), nil
 }
+
+// prepareRegenerate 检查 --regenerate 的参数，没有指定对话时重新生成上一次对话
+func prepareRegenerate() error {
+	if config.Prefix != "" {
+		return modsError{
+			err:    newUserErrorf("%s 会沿用原来的提示，请不要再指定提示", stderrStyles().InlineCode.Render("--regenerate")),
+			reason: "无法重新生成。",
+		}
+	}
+	if config.NoCache {
+		return modsError{
+			err:    newUserErrorf("%s 需要读取保存的对话", stderrStyles().InlineCode.Render("--regenerate")),
+			reason: "无法重新生成。",
+		}
+	}
+	if config.Continue == "" {
+		config.ContinueLast = true
+	}
+	return nil
+}
@@ -3,6 +3,11 @@ package main
 import (
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/cache"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
 )
 
 // TestIsCompletionCmd 测试是否为补全命令
@@ -62,3 +67,33 @@ func TestIsManCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteConversationOlderThan(t *testing.T) {
+	oldDB, oldConfig := db, config
+	t.Cleanup(func() { db, config = oldDB, oldConfig })
+	db = testDB(t)
+	config.CachePath = t.TempDir()
+	config.DeleteOlderThan = -time.Hour
+	config.Quiet, config.NoInput = true, true
+	c, err := cache.NewConversations(config.CachePath)
+	require.NoError(t, err)
+	id := newConversationID()
+	require.NoError(t, c.Write(id, &[]proto.Message{{Role: proto.RoleUser, Content: "旧对话"}}))
+	require.NoError(t, db.Save(id, "旧对话", "openai", "gpt-4o"))
+
+	t.Run("安静模式仍然需要确认", func(t *testing.T) {
+		config.Yes = false
+		require.ErrorContains(t, deleteConversationOlderThan(), "--yes")
+		convos, err := db.List()
+		require.NoError(t, err)
+		require.Len(t, convos, 1)
+	})
+
+	t.Run("--yes 跳过确认", func(t *testing.T) {
+		config.Yes = true
+		require.NoError(t, deleteConversationOlderThan())
+		convos, err := db.List()
+		require.NoError(t, err)
+		require.Empty(t, convos)
+	})
+}
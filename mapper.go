@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultMapWorkers = 4          // --map 模式下默认同时进行的请求数
+	mapPlaceholder    = "{{line}}" // prompt 模板中代表当前记录的占位符
+)
+
+// --map 的输出格式
+const (
+	mapFormatPlain  = "plain"  // 每条记录输出一条结果
+	mapFormatNDJSON = "ndjson" // 每条记录输出一行 JSON
+)
+
+// mapRecord 是 --map-format ndjson 输出的一行
+type mapRecord struct {
+	Index  int    `json:"index"`           // 记录的序号，从 1 开始
+	Input  string `json:"input"`           // 输入的记录
+	Output string `json:"output"`          // 模型的回答
+	Error  string `json:"error,omitempty"` // 错误信息
+}
+
+// runMap 把 stdin 按行（或 --map-delimiter）拆分为记录，对每条记录独立执行一次请求，
+// 并按输入顺序输出结果
+// ctx: 上下文
+// 返回：错误信息
+func runMap(ctx context.Context) error {
+	if isInputTTY() {
+		return modsError{
+			err:    newUserErrorf("例如：%s", stderrStyles().InlineCode.Render("cat app.log | mods --map '为这行日志打标签'")),
+			reason: "--map 需要从标准输入读取内容。",
+		}
+	}
+	if config.MapFormat != mapFormatPlain && config.MapFormat != mapFormatNDJSON {
+		return modsError{
+			err: newUserErrorf(
+				"可选的格式有：%s、%s",
+				stderrStyles().InlineCode.Render(mapFormatPlain),
+				stderrStyles().InlineCode.Render(mapFormatNDJSON),
+			),
+			reason: fmt.Sprintf("不支持的 --map-format %q。", config.MapFormat),
+		}
+	}
+	delim, err := parseMapDelimiter(config.MapDelimiter)
+	if err != nil {
+		return modsError{err, "无效的 --map-delimiter。"}
+	}
+
+	bts, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return modsError{err, "无法读取标准输入。"}
+	}
+	records := splitRecords(string(bts), delim)
+
+	// 按输入顺序输出，某条记录失败时输出空结果并在最后汇总错误
+	var errs []error
+	enc := json.NewEncoder(os.Stdout)
+	for i, ch := range mapAll(ctx, config.Prefix, mapPlaceholder, records) {
+		res := <-ch
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("第 %d 条记录: %w", i+1, res.err))
+		}
+		switch {
+		case config.MapFormat == mapFormatNDJSON:
+			rec := mapRecord{Index: i + 1, Input: records[i], Output: strings.TrimSpace(res.output)}
+			if res.err != nil {
+				rec.Error = res.err.Error()
+			}
+			_ = enc.Encode(rec)
+		case delim == "\n":
+			fmt.Println(oneLine(res.output))
+		default:
+			// 自定义分隔符时保留回答的换行，用同样的分隔符分开各条结果
+			fmt.Print(strings.TrimSpace(res.output) + delim)
+		}
+	}
+
+	if len(errs) > 0 {
+		return modsError{errors.Join(errs...), fmt.Sprintf("%d 条记录处理失败。", len(errs))}
+	}
+	return nil
+}
+
+// parseMapDelimiter 解析 --map-delimiter，支持 \n、\t、\0 等转义
+// s: 分隔符设置，为空时按行拆分
+// 返回：分隔符和错误信息
+func parseMapDelimiter(s string) (string, error) {
+	if s == "" {
+		return "\n", nil
+	}
+	s = strings.ReplaceAll(s, `\0`, `\x00`)
+	delim, err := strconv.Unquote(`"` + strings.ReplaceAll(s, `"`, `\"`) + `"`)
+	if err != nil {
+		return "", fmt.Errorf("无法解析分隔符 %q: %w", s, err)
+	}
+	if delim == "" {
+		return "", errors.New("分隔符不能为空")
+	}
+	return delim, nil
+}
+
+// splitRecords 按分隔符把输入拆分为记录。按行拆分时去掉行尾的 \r；
+// 其它分隔符时去掉每条记录首尾的换行。末尾的分隔符不会产生空记录
+// s: 输入内容
+// delim: 分隔符
+// 返回：记录列表
+func splitRecords(s, delim string) []string {
+	if s == "" {
+		return nil
+	}
+	records := strings.Split(s, delim)
+	for i, r := range records {
+		if delim == "\n" {
+			records[i] = strings.TrimSuffix(r, "\r")
+		} else {
+			records[i] = strings.Trim(r, "\r\n")
+		}
+	}
+	if last := records[len(records)-1]; strings.TrimSpace(last) == "" {
+		records = records[:len(records)-1]
+	}
+	return records
+}
+
+// oneLine 把回答压缩为单行
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// mapResult 是单行处理的结果
+type mapResult struct {
+	output string
+	err    error
+}
+
+// mapAll 以 map-workers 的并发度对每个输入执行一次请求
+// ctx: 上下文
+// prompt: 提示模板
+// placeholder: 模板中代表输入的占位符
+// inputs: 输入列表
+// 返回：与输入一一对应的结果通道，每个通道恰好收到一个结果
+func mapAll(ctx context.Context, prompt, placeholder string, inputs []string) []chan mapResult {
+	results := make([]chan mapResult, len(inputs))
+	for i := range results {
+		results[i] = make(chan mapResult, 1)
+	}
+
+	sem := make(chan struct{}, max(config.MapWorkers, 1))
+	for i, input := range inputs {
+		go func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			out, err := mapOne(ctx, prompt, placeholder, input)
+			results[i] <- mapResult{out, err}
+		}()
+	}
+	return results
+}
+
+// mapOne 对单个输入执行一次完整的请求
+// ctx: 上下文
+// prompt: 提示模板，包含占位符时替换为输入，否则输入跟在提示之后
+// placeholder: 模板中代表输入的占位符
+// input: 输入内容
+// 返回：回答与错误信息
+func mapOne(ctx context.Context, prompt, placeholder, input string) (string, error) {
+	cfg := config
+	cfg.NoCache = true
+	cfg.Chat = false
+	cfg.Images = nil
+	cfg.Prefix = prompt
+	content := input
+	if strings.Contains(prompt, placeholder) {
+		content = strings.ReplaceAll(prompt, placeholder, input)
+		cfg.Prefix = ""
+	}
+
+	m := newMods(ctx, stderrRenderer(), &cfg, nil, nil)
+	out, err := m.complete(content)
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// complete 不经过 Bubble Tea 程序，同步执行一次请求并返回完整的回答
+// content: 用户输入
+// 返回：回答内容与错误信息
+func (m *Mods) complete(content string) (string, error) {
+	var sb strings.Builder
+	msg := m.startCompletionCmd(content)()
+	for {
+		switch out := msg.(type) {
+		case completionInput:
+			// 请求出错后的重试
+			sb.Reset()
+			msg = m.startCompletionCmd(out.content)()
+		case completionOutput:
+			sb.WriteString(out.content)
+			if out.stream == nil {
+				return sb.String(), nil
+			}
+			msg = m.receiveCompletionStreamCmd(out)()
+		case error:
+			return "", out
+		default:
+			return "", fmt.Errorf("未知消息 %T", msg)
+		}
+	}
+}
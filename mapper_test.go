@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMapDelimiter(t *testing.T) {
+	for in, expected := range map[string]string{
+		"":           "\n",
+		`\n---\n`:    "\n---\n",
+		`\t`:         "\t",
+		`\0`:         "\x00",
+		";":          ";",
+		`say "hi"`:   `say "hi"`,
+		" ":          " ",
+		`\x1e`:       "\x1e",
+		`--- end --`: "--- end --",
+	} {
+		t.Run(in, func(t *testing.T) {
+			delim, err := parseMapDelimiter(in)
+			require.NoError(t, err)
+			require.Equal(t, expected, delim)
+		})
+	}
+
+	_, err := parseMapDelimiter(`\q`)
+	require.Error(t, err)
+}
+
+func TestSplitRecords(t *testing.T) {
+	t.Run("按行拆分", func(t *testing.T) {
+		require.Equal(t, []string{"a", "", "b"}, splitRecords("a\r\n\nb\n", "\n"))
+		require.Equal(t, []string{"a", "b"}, splitRecords("a\nb", "\n"))
+		require.Empty(t, splitRecords("", "\n"))
+	})
+
+	t.Run("自定义分隔符", func(t *testing.T) {
+		require.Equal(t, []string{"第一段\n两行", "第二段"}, splitRecords("第一段\n两行\n---\n第二段\n", "\n---\n"))
+		require.Equal(t, []string{"a", "b"}, splitRecords("a\x00b\x00", "\x00"))
+	})
+}
+
+func TestOneLine(t *testing.T) {
+	require.Equal(t, "a b c", oneLine("  a\n\nb\tc\n"))
+}
@@ -7,12 +7,10 @@ import (
 	"fmt"
 	"iter"
 	"maps"
-	"os"
 	"slices"
 	"strings"
 	"sync"
 
-	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
 	"golang.org/x/sync/errgroup"
 )
@@ -38,7 +36,8 @@ func enabledMCPs() iter.Seq2[string, MCPServerConfig] {
 // 返回：是否已启用
 func isMCPEnabled(name string) bool {
 	return !slices.Contains(config.MCPDisable, "*") &&
-		!slices.Contains(config.MCPDisable, name)
+		!slices.Contains(config.MCPDisable, name) &&
+		!config.MCPServers[name].Disabled
 }
 
 // mcpList 列出所有 MCP 服务器
@@ -78,10 +77,12 @@ func mcpTools(ctx context.Context) (map[string][]mcp.Tool, error) {
 	result := map[string][]mcp.Tool{}
 	for sname, server := range enabledMCPs() {
 		wg.Go(func() error {
+			ctx, cancel := context.WithTimeout(ctx, server.timeout())
+			defer cancel()
 			serverTools, err := mcpToolsFor(ctx, sname, server)
 			if errors.Is(err, context.DeadlineExceeded) {
 				return modsError{
-					err:    fmt.Errorf("列出 %q 的工具时超时 - 请确保配置正确。如果您的服务器需要 docker 容器，请确保它正在运行", sname),
+					err:    fmt.Errorf("列出 %q 的工具时超时（%s）- 请确保配置正确。如果您的服务器需要 docker 容器，请确保它正在运行", sname, server.timeout()),
 					reason: "无法列出工具",
 				}
 			}
@@ -91,6 +92,13 @@ func mcpTools(ctx context.Context) (map[string][]mcp.Tool, error) {
 					reason: "无法列出工具",
 				}
 			}
+			serverTools, err = filterTools(sname, server, serverTools)
+			if err != nil {
+				return modsError{
+					err:    err,
+					reason: "无法列出工具",
+				}
+			}
 			mu.Lock()
 			result[sname] = append(result[sname], serverTools...)
 			mu.Unlock()
@@ -100,44 +108,68 @@ func mcpTools(ctx context.Context) (map[string][]mcp.Tool, error) {
 	if err := wg.Wait(); err != nil {
 		return nil, err //nolint:wrapcheck
 	}
+	if len(config.Tools) > 0 && isMCPEnabled(localToolsServer) {
+		tools, err := localTools()
+		if err != nil {
+			return nil, modsError{err, "无法列出工具"}
+		}
+		result[localToolsServer] = tools
+	}
+	return result, nil
+}
+
+// filterTools 按 allowed-tools 和 blocked-tools 筛选服务器的工具
+// name: 服务器名称
+// server: MCP 服务器配置
+// tools: 服务器提供的全部工具
+// 返回：提供给模型的工具和错误信息
+func filterTools(name string, server MCPServerConfig, tools []mcp.Tool) ([]mcp.Tool, error) {
+	var result []mcp.Tool
+	for _, tool := range tools {
+		ok, err := server.toolAllowed(tool.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if ok {
+			result = append(result, tool)
+		}
+	}
 	return result, nil
 }
 
 // initMcpClient 创建并初始化 MCP 客户端
 // ctx: 上下文
+// name: 服务器名称
 // server: MCP 服务器配置
 // 返回：MCP 客户端和错误信息
-func initMcpClient(ctx context.Context, server MCPServerConfig) (*client.Client, error) {
-	var cli *client.Client
+func initMcpClient(ctx context.Context, name string, server MCPServerConfig) (*mcpClient, error) {
+	cli := &mcpClient{}
 	var err error
 
 	switch server.Type {
 	case "", "stdio":
-		cli, err = client.NewStdioMCPClient(
-			server.Command,
-			append(os.Environ(), server.Env...),
-			server.Args...,
-		)
-	case "sse":
-		cli, err = client.NewSSEMCPClient(server.URL)
-	case "http":
-		cli, err = client.NewStreamableHttpClient(server.URL)
+		cli, err = newStdioMCPClient(server)
+	case "sse", "http":
+		cli.Client, err = newRemoteMCPClient(name, server)
+	case "docker":
+		cli, err = newDockerMCPClient(ctx, server)
 	default:
-		return nil, fmt.Errorf("不支持的 MCP 服务器类型: %q，支持的类型有: stdio、sse、http", server.Type)
+		return nil, fmt.Errorf("不支持的 MCP 服务器类型: %q，支持的类型有: stdio、sse、http、docker", server.Type)
 	}
 
 	if err != nil {
 		return nil, fmt.Errorf("创建 MCP 客户端失败: %w", err)
 	}
 
-	if err := cli.Start(ctx); err != nil {
+	// 连接在整个运行期间复用，SSE 等连接的生命周期不能跟随启动时的超时
+	if err := cli.Start(context.WithoutCancel(ctx)); err != nil {
 		cli.Close() //nolint:errcheck,gosec
-		return nil, fmt.Errorf("启动 MCP 客户端失败: %w", err)
+		return nil, fmt.Errorf("启动 MCP 客户端失败: %w", mcpAuthError(name, err))
 	}
 
 	if _, err := cli.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
 		cli.Close() //nolint:errcheck,gosec
-		return nil, fmt.Errorf("初始化 MCP 客户端失败: %w", err)
+		return nil, fmt.Errorf("初始化 MCP 客户端失败: %w", mcpAuthError(name, err))
 	}
 
 	return cli, nil
@@ -149,13 +181,13 @@ func initMcpClient(ctx context.Context, server MCPServerConfig) (*client.Client,
 // server: MCP 服务器配置
 // 返回：工具列表和错误信息
 func mcpToolsFor(ctx context.Context, name string, server MCPServerConfig) ([]mcp.Tool, error) {
-	cli, err := initMcpClient(ctx, server)
+	cli, err := mcpConns.acquire(ctx, name, server)
 	if err != nil {
 		return nil, fmt.Errorf("无法设置 %s: %w", name, err)
 	}
-	defer cli.Close() //nolint:errcheck
 
 	tools, err := cli.ListTools(ctx, mcp.ListToolsRequest{})
+	mcpConns.release(name, cli, err)
 	if err != nil {
 		return nil, fmt.Errorf("无法设置 %s: %w", name, err)
 	}
@@ -172,6 +204,11 @@ func toolCall(ctx context.Context, name string, data []byte) (string, error) {
 	if !ok {
 		return "", fmt.Errorf("mcp: 无效的工具名称: %q", name)
 	}
+	if sname == localToolsServer && isMCPEnabled(localToolsServer) {
+		if _, ok := config.Tools[tool]; ok {
+			return localToolCall(ctx, tool, data)
+		}
+	}
 	server, ok := config.MCPServers[sname]
 	if !ok {
 		return "", fmt.Errorf("mcp: 无效的服务器名称: %q", sname)
@@ -179,11 +216,19 @@ func toolCall(ctx context.Context, name string, data []byte) (string, error) {
 	if !isMCPEnabled(sname) {
 		return "", fmt.Errorf("mcp: 服务器已禁用: %q", sname)
 	}
-	client, err := initMcpClient(ctx, server)
+	allowed, err := server.toolAllowed(tool)
+	if err != nil {
+		return "", fmt.Errorf("mcp: %s: %w", sname, err)
+	}
+	if !allowed {
+		return "", fmt.Errorf("mcp: 工具 %q 不在 %q 提供的工具之中（allowed-tools、blocked-tools）", tool, sname)
+	}
+	ctx, cancel := context.WithTimeout(ctx, server.timeout())
+	defer cancel()
+	client, err := mcpConns.acquire(ctx, sname, server)
 	if err != nil {
 		return "", fmt.Errorf("mcp: %w", err)
 	}
-	defer client.Close() //nolint:errcheck
 
 	var args map[string]any
 	if len(data) > 0 {
@@ -195,7 +240,12 @@ func toolCall(ctx context.Context, name string, data []byte) (string, error) {
 	request := mcp.CallToolRequest{}
 	request.Params.Name = tool
 	request.Params.Arguments = args
-	result, err := client.CallTool(context.Background(), request)
+	result, err := client.CallTool(ctx, request)
+	// 服务器卡住或已经退出时，下次调用重新启动服务器
+	mcpConns.release(sname, client, err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "", fmt.Errorf("mcp: 调用 %q 超时（%s），可以在 mcp-servers 中为 %q 设置更长的 timeout", name, server.timeout(), sname)
+	}
 	if err != nil {
 		return "", fmt.Errorf("mcp: %w", err)
 	}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/cache"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+const (
+	// mcpOAuthFlowCode 是授权码流程：在浏览器中登录后回调本地端口
+	mcpOAuthFlowCode = "authorization-code"
+	// mcpOAuthFlowDevice 是设备码流程：在任意设备的浏览器中输入显示的代码
+	mcpOAuthFlowDevice = "device"
+	// mcpOAuthRefreshTTL 是带刷新令牌的登录状态的保存时间
+	mcpOAuthRefreshTTL = 30 * 24 * time.Hour
+	// mcpLoginTimeout 是等待用户在浏览器中完成登录的时间
+	mcpLoginTimeout = 5 * time.Minute
+	// mcpOAuthClientName 是动态注册 OAuth 客户端时使用的名称
+	mcpOAuthClientName = "mods"
+)
+
+// MCPOAuthConfig 是 sse 和 http 类型的 MCP 服务器的 OAuth 登录配置，先用 --mcp-login 登录
+type MCPOAuthConfig struct {
+	Flow                   string   `yaml:"flow"`                     // 登录流程：authorization-code（默认）或 device
+	ClientID               string   `yaml:"client-id"`                // 客户端 ID，授权码流程未设置时向服务器动态注册
+	ClientSecret           string   `yaml:"client-secret"`            // 客户端密钥，支持 ${VAR}
+	Scopes                 []string `yaml:"scopes"`                   // 申请的权限范围
+	RedirectURI            string   `yaml:"redirect-uri"`             // 授权码流程的回调地址，必须是本机地址，未设置时使用随机端口
+	MetadataURL            string   `yaml:"metadata-url"`             // 授权服务器元数据的地址，未设置时自动发现
+	DeviceAuthorizationURL string   `yaml:"device-authorization-url"` // 设备码流程的设备授权地址，未设置时从元数据中读取
+}
+
+// mcpHeaders 返回连接 sse、http 服务器时附加的请求头
+// server: MCP 服务器配置
+// 返回：请求头和错误信息
+func mcpHeaders(server MCPServerConfig) (map[string]string, error) {
+	headers := make(map[string]string, len(server.Headers)+1)
+	for k, v := range server.Headers {
+		headers[k] = v
+	}
+	if server.BearerToken != "" {
+		if server.OAuth != nil {
+			return nil, errors.New("bearer-token 和 oauth 不能同时设置")
+		}
+		if strings.Contains(server.BearerToken, "${") {
+			return nil, fmt.Errorf("bearer-token %q 中的环境变量没有设置", server.BearerToken)
+		}
+		headers["Authorization"] = "Bearer " + server.BearerToken
+	}
+	return headers, nil
+}
+
+// newRemoteMCPClient 创建 sse 或 http 类型的 MCP 客户端，带上配置的请求头和 OAuth 令牌
+// name: 服务器名称
+// server: MCP 服务器配置
+// 返回：MCP 客户端和错误信息
+func newRemoteMCPClient(name string, server MCPServerConfig) (*client.Client, error) {
+	headers, err := mcpHeaders(server)
+	if err != nil {
+		return nil, err
+	}
+	if server.OAuth == nil {
+		if server.Type == "sse" {
+			return client.NewSSEMCPClient(server.URL, transport.WithHeaders(headers)) //nolint:wrapcheck
+		}
+		return client.NewStreamableHttpClient(server.URL, transport.WithHTTPHeaders(headers)) //nolint:wrapcheck
+	}
+	oauth, _, err := mcpOAuthConfig(name, server)
+	if err != nil {
+		return nil, err
+	}
+	if server.Type == "sse" {
+		return client.NewOAuthSSEClient(server.URL, oauth, transport.WithHeaders(headers)) //nolint:wrapcheck
+	}
+	return client.NewOAuthStreamableHttpClient(server.URL, oauth, transport.WithHTTPHeaders(headers)) //nolint:wrapcheck
+}
+
+// mcpAuthError 在服务器需要登录时给出登录的命令
+// name: 服务器名称
+// err: 连接服务器时的错误
+func mcpAuthError(name string, err error) error {
+	if client.IsOAuthAuthorizationRequiredError(err) || errors.Is(err, transport.ErrOAuthAuthorizationRequired) {
+		return newUserErrorf("MCP 服务器 %q 需要登录，请先运行 %s", name, stderrStyles().InlineCode.Render("mods --mcp-login "+name))
+	}
+	return err
+}
+
+// mcpOAuthRecord 是保存在缓存中的登录状态
+type mcpOAuthRecord struct {
+	ClientID     string           `json:"client_id,omitempty"`     // 动态注册得到的客户端 ID
+	ClientSecret string           `json:"client_secret,omitempty"` // 动态注册得到的客户端密钥
+	Token        *transport.Token `json:"token,omitempty"`         // 访问令牌和刷新令牌
+}
+
+// mcpTokenStore 把 OAuth 令牌保存在过期缓存中，刷新后的令牌也会写回
+type mcpTokenStore struct {
+	tokens *cache.ExpiringCache[string]
+	id     string
+}
+
+// mcpTokenCacheID 返回服务器登录状态的缓存标识，服务器名称或 URL 改变后需要重新登录
+func mcpTokenCacheID(name string, server MCPServerConfig) string {
+	sum := sha256.Sum256([]byte(name + "\n" + server.URL))
+	return "mcp-oauth-" + hex.EncodeToString(sum[:8])
+}
+
+// newMCPTokenStore 返回服务器的令牌存储
+func newMCPTokenStore(name string, server MCPServerConfig) (*mcpTokenStore, error) {
+	tokens, err := cache.NewExpiring[string](config.CachePath)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开令牌缓存: %w", err)
+	}
+	return &mcpTokenStore{tokens: tokens, id: mcpTokenCacheID(name, server)}, nil
+}
+
+// load 读取登录状态，没有时返回空的记录
+func (s *mcpTokenStore) load() mcpOAuthRecord {
+	var record mcpOAuthRecord
+	_ = s.tokens.Read(s.id, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&record) //nolint:wrapcheck
+	})
+	return record
+}
+
+// save 写入登录状态。有刷新令牌时保存 mcpOAuthRefreshTTL，否则在访问令牌过期时一起过期
+func (s *mcpTokenStore) save(record mcpOAuthRecord) error {
+	expiresAt := time.Now().Add(mcpOAuthRefreshTTL)
+	if t := record.Token; t != nil && t.RefreshToken == "" && !t.ExpiresAt.IsZero() {
+		expiresAt = t.ExpiresAt
+	}
+	return s.tokens.Write(s.id, expiresAt.Unix(), func(w io.Writer) error { //nolint:wrapcheck
+		return json.NewEncoder(w).Encode(record) //nolint:wrapcheck
+	})
+}
+
+// GetToken 实现 transport.TokenStore
+func (s *mcpTokenStore) GetToken(ctx context.Context) (*transport.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if record := s.load(); record.Token != nil {
+		return record.Token, nil
+	}
+	return nil, transport.ErrNoToken
+}
+
+// SaveToken 实现 transport.TokenStore，保留动态注册的客户端
+func (s *mcpTokenStore) SaveToken(ctx context.Context, token *transport.Token) error {
+	if err := ctx.Err(); err != nil {
+		return err //nolint:wrapcheck
+	}
+	record := s.load()
+	record.Token = token
+	return s.save(record)
+}
+
+// mcpOAuthConfig 返回服务器的 OAuth 配置，未配置 client-id 时使用登录时动态注册的客户端
+// name: 服务器名称
+// server: MCP 服务器配置
+// 返回：OAuth 配置、令牌存储和错误信息
+func mcpOAuthConfig(name string, server MCPServerConfig) (transport.OAuthConfig, *mcpTokenStore, error) {
+	o := server.OAuth
+	switch o.Flow {
+	case "", mcpOAuthFlowCode, mcpOAuthFlowDevice:
+	default:
+		return transport.OAuthConfig{}, nil, fmt.Errorf("不支持的 oauth flow: %q，支持的有: %s、%s", o.Flow, mcpOAuthFlowCode, mcpOAuthFlowDevice)
+	}
+	store, err := newMCPTokenStore(name, server)
+	if err != nil {
+		return transport.OAuthConfig{}, nil, err
+	}
+	cfg := transport.OAuthConfig{
+		ClientID:              o.ClientID,
+		ClientSecret:          o.ClientSecret,
+		RedirectURI:           o.RedirectURI,
+		Scopes:                o.Scopes,
+		TokenStore:            store,
+		AuthServerMetadataURL: o.MetadataURL,
+		PKCEEnabled:           true,
+	}
+	if cfg.ClientID == "" {
+		record := store.load()
+		cfg.ClientID, cfg.ClientSecret = record.ClientID, record.ClientSecret
+	}
+	return cfg, store, nil
+}
+
+// mcpLogin 登录 MCP 服务器并保存令牌，之后的调用自动使用和刷新令牌
+// ctx: 上下文
+// name: 服务器名称
+// 返回：错误信息
+func mcpLogin(ctx context.Context, name string) error {
+	server, ok := config.MCPServers[name]
+	if !ok {
+		return modsError{newUserErrorf("未配置 MCP 服务器 %q", name), "无法登录 MCP 服务器。"}
+	}
+	if server.OAuth == nil || (server.Type != "sse" && server.Type != "http") {
+		return modsError{newUserErrorf("只有设置了 oauth 的 sse、http 服务器需要登录"), "无法登录 MCP 服务器。"}
+	}
+	cfg, store, err := mcpOAuthConfig(name, server)
+	if err != nil {
+		return modsError{err, "无法登录 MCP 服务器。"}
+	}
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		return modsError{err, "无法登录 MCP 服务器。"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mcpLoginTimeout)
+	defer cancel()
+	if server.OAuth.Flow == mcpOAuthFlowDevice {
+		err = mcpDeviceLogin(ctx, name, base, cfg, store)
+	} else {
+		err = mcpCodeLogin(ctx, name, base, cfg, store)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%s 内没有完成登录", mcpLoginTimeout)
+	}
+	if err != nil {
+		return modsError{err, fmt.Sprintf("无法登录 MCP 服务器 %s。", name)}
+	}
+	if !config.Quiet {
+		fmt.Fprintf(os.Stderr, "已登录 MCP 服务器 %s。\n", name)
+	}
+	return nil
+}
+
+// mcpCodeLogin 使用授权码流程（PKCE）登录：在浏览器中打开授权页面，授权后回调本地端口
+func mcpCodeLogin(ctx context.Context, name string, base *url.URL, cfg transport.OAuthConfig, store *mcpTokenStore) error {
+	ln, callback, err := listenOAuthCallback(cfg.RedirectURI)
+	if err != nil {
+		return err
+	}
+	defer ln.Close() //nolint:errcheck
+	if cfg.RedirectURI == "" {
+		cfg.RedirectURI = fmt.Sprintf("http://%s%s", ln.Addr(), callback)
+	}
+
+	handler := transport.NewOAuthHandler(cfg)
+	handler.SetBaseURL(base.Scheme + "://" + base.Host)
+	if cfg.ClientID == "" {
+		if err := handler.RegisterClient(ctx, mcpOAuthClientName); err != nil {
+			return fmt.Errorf("无法注册 OAuth 客户端，请在 oauth 中设置 client-id: %w", err)
+		}
+		if err := store.save(mcpOAuthRecord{ClientID: handler.GetClientID(), ClientSecret: handler.GetClientSecret()}); err != nil {
+			return err
+		}
+	}
+
+	verifier, err := transport.GenerateCodeVerifier()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	state, err := transport.GenerateState()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	authURL, err := handler.GetAuthorizationURL(ctx, state, transport.GenerateCodeChallenge(verifier))
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	fmt.Fprintf(os.Stderr, "请在浏览器中打开以下地址登录 %s：\n\n  %s\n\n", name, authURL)
+
+	type result struct{ code, state, err string }
+	results := make(chan result, 1)
+	srv := &http.Server{ //nolint:gosec
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != callback {
+				http.NotFound(w, r)
+				return
+			}
+			q := r.URL.Query()
+			select {
+			case results <- result{q.Get("code"), q.Get("state"), cmp.Or(q.Get("error_description"), q.Get("error"))}:
+			default:
+			}
+			fmt.Fprintln(w, "登录完成，可以关闭此页面并回到终端。")
+		}),
+	}
+	go srv.Serve(ln)  //nolint:errcheck
+	defer srv.Close() //nolint:errcheck
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	case res := <-results:
+		if res.err != "" {
+			return fmt.Errorf("授权失败: %s", res.err)
+		}
+		return handler.ProcessAuthorizationResponse(ctx, res.code, res.state, verifier) //nolint:wrapcheck
+	}
+}
+
+// listenOAuthCallback 监听授权码流程的回调地址，未配置时监听本机的随机端口
+// redirectURI: 配置的回调地址
+// 返回：监听器、回调路径和错误信息
+func listenOAuthCallback(redirectURI string) (net.Listener, string, error) {
+	if redirectURI == "" {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		return ln, "/callback", err //nolint:wrapcheck
+	}
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return nil, "", fmt.Errorf("无效的 redirect-uri: %w", err)
+	}
+	if u.Scheme != "http" || (u.Hostname() != "localhost" && u.Hostname() != "127.0.0.1" && u.Hostname() != "::1") || u.Port() == "" {
+		return nil, "", fmt.Errorf("redirect-uri 必须是带端口的本机地址，例如 http://127.0.0.1:8976/callback，而不是 %q", redirectURI)
+	}
+	ln, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return nil, "", fmt.Errorf("无法监听 redirect-uri: %w", err)
+	}
+	return ln, cmp.Or(u.Path, "/"), nil
+}
+
+// deviceAuthorization 是设备授权端点的响应
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// mcpDeviceLogin 使用设备码流程（RFC 8628）登录：显示代码，在任意设备的浏览器中输入后轮询令牌
+func mcpDeviceLogin(ctx context.Context, name string, base *url.URL, cfg transport.OAuthConfig, store *mcpTokenStore) error {
+	if cfg.ClientID == "" {
+		return errors.New("设备码流程需要在 oauth 中设置 client-id")
+	}
+	handler := transport.NewOAuthHandler(cfg)
+	handler.SetBaseURL(base.Scheme + "://" + base.Host)
+	metadata, err := handler.GetServerMetadata(ctx)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	deviceURL := config.MCPServers[name].OAuth.DeviceAuthorizationURL
+	if deviceURL == "" {
+		deviceURL, err = discoverDeviceAuthorizationURL(ctx, cmp.Or(cfg.AuthServerMetadataURL, strings.TrimSuffix(metadata.Issuer, "/")+"/.well-known/oauth-authorization-server"))
+		if err != nil {
+			return err
+		}
+	}
+
+	form := url.Values{"client_id": {cfg.ClientID}}
+	if len(cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	var device deviceAuthorization
+	if status, err := postOAuthForm(ctx, deviceURL, form, &device); err != nil {
+		return err
+	} else if status != http.StatusOK || device.DeviceCode == "" {
+		return fmt.Errorf("设备授权请求失败: %d", status)
+	}
+	fmt.Fprintf(os.Stderr, "请在浏览器中打开 %s 并输入代码 %s 登录 %s。\n", device.VerificationURI, stderrStyles().InlineCode.Render(device.UserCode), name)
+	if device.VerificationURIComplete != "" {
+		fmt.Fprintf(os.Stderr, "也可以直接打开：%s\n", device.VerificationURIComplete)
+	}
+
+	interval := time.Duration(cmp.Or(device.Interval, 5)) * time.Second //nolint:mnd
+	form = url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {device.DeviceCode},
+		"client_id":   {cfg.ClientID},
+	}
+	if cfg.ClientSecret != "" {
+		form.Set("client_secret", cfg.ClientSecret)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err() //nolint:wrapcheck
+		case <-time.After(interval):
+		}
+		var resp struct {
+			transport.Token
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		if _, err := postOAuthForm(ctx, metadata.TokenEndpoint, form, &resp); err != nil {
+			return err
+		}
+		switch resp.Error {
+		case "":
+			token := resp.Token
+			if token.ExpiresIn > 0 {
+				token.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+			}
+			return store.SaveToken(ctx, &token)
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second //nolint:mnd
+		default:
+			return fmt.Errorf("授权失败: %s", cmp.Or(resp.ErrorDescription, resp.Error))
+		}
+	}
+}
+
+// discoverDeviceAuthorizationURL 从授权服务器元数据中读取设备授权地址
+func discoverDeviceAuthorizationURL(ctx context.Context, metadataURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	var metadata struct {
+		DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		_ = json.NewDecoder(resp.Body).Decode(&metadata)
+	}
+	if metadata.DeviceAuthorizationEndpoint == "" {
+		return "", fmt.Errorf("授权服务器不支持设备码流程，可以在 oauth 中设置 device-authorization-url")
+	}
+	return metadata.DeviceAuthorizationEndpoint, nil
+}
+
+// postOAuthForm 向 OAuth 端点提交表单并解析 JSON 响应，错误响应也会被解析
+// 返回：HTTP 状态码和错误信息
+func postOAuthForm(ctx context.Context, endpoint string, form url.Values, v any) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return resp.StatusCode, fmt.Errorf("无法解析 %s 的响应（%s）: %w", endpoint, resp.Status, err)
+	}
+	return resp.StatusCode, nil
+}
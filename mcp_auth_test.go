@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+// headerRecorder 是记录收到的请求头的 MCP HTTP 服务器
+type headerRecorder struct {
+	mu      sync.Mutex
+	headers http.Header
+}
+
+func (h *headerRecorder) server(t *testing.T) *httptest.Server {
+	t.Helper()
+	mcpServer := server.NewStreamableHTTPServer(server.NewMCPServer("test", "1.0.0"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		h.headers = r.Header.Clone()
+		h.mu.Unlock()
+		mcpServer.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (h *headerRecorder) get(key string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.headers.Get(key)
+}
+
+func TestMCPHeaders(t *testing.T) {
+	var rec headerRecorder
+	srv := rec.server(t)
+	cli, err := initMcpClient(context.Background(), "remote", MCPServerConfig{
+		Type:        "http",
+		URL:         srv.URL + "/mcp",
+		Headers:     map[string]string{"X-Team": "mods"},
+		BearerToken: "secret",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cli.Close() })
+	require.Equal(t, "Bearer secret", rec.get("Authorization"))
+	require.Equal(t, "mods", rec.get("X-Team"))
+
+	t.Run("环境变量没有设置", func(t *testing.T) {
+		_, err := mcpHeaders(MCPServerConfig{BearerToken: "${MCP_TEST_MISSING}"})
+		require.ErrorContains(t, err, "环境变量没有设置")
+	})
+
+	t.Run("不能同时设置 oauth", func(t *testing.T) {
+		_, err := mcpHeaders(MCPServerConfig{BearerToken: "x", OAuth: &MCPOAuthConfig{}})
+		require.ErrorContains(t, err, "不能同时设置")
+	})
+}
+
+func TestMCPOAuthToken(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config.CachePath = t.TempDir()
+
+	var rec headerRecorder
+	srv := rec.server(t)
+	remote := MCPServerConfig{
+		Type:  "http",
+		URL:   srv.URL + "/mcp",
+		OAuth: &MCPOAuthConfig{ClientID: "mods"},
+	}
+
+	t.Run("没有登录", func(t *testing.T) {
+		_, err := initMcpClient(context.Background(), "remote", remote)
+		require.ErrorContains(t, err, "mods --mcp-login remote")
+	})
+
+	t.Run("使用保存的令牌", func(t *testing.T) {
+		store, err := newMCPTokenStore("remote", remote)
+		require.NoError(t, err)
+		require.NoError(t, store.SaveToken(context.Background(), &transport.Token{
+			AccessToken: "cached",
+			TokenType:   "Bearer",
+			ExpiresAt:   time.Now().Add(time.Hour),
+		}))
+
+		cli, err := initMcpClient(context.Background(), "remote", remote)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = cli.Close() })
+		require.Equal(t, "Bearer cached", rec.get("Authorization"))
+	})
+
+	t.Run("URL 改变后需要重新登录", func(t *testing.T) {
+		other := remote
+		other.URL += "/v2"
+		store, err := newMCPTokenStore("remote", other)
+		require.NoError(t, err)
+		_, err = store.GetToken(context.Background())
+		require.ErrorIs(t, err, transport.ErrNoToken)
+	})
+}
+
+func TestMCPDeviceLogin(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config.CachePath = t.TempDir()
+	config.Quiet = true
+
+	var polls atomic.Int32
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	writeJSON := func(w http.ResponseWriter, status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                        srv.URL,
+			"authorization_endpoint":        srv.URL + "/authorize",
+			"token_endpoint":                srv.URL + "/token",
+			"device_authorization_endpoint": srv.URL + "/device",
+		})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "mods", r.PostForm.Get("client_id"))
+		require.Equal(t, "read write", r.PostForm.Get("scope"))
+		writeJSON(w, http.StatusOK, map[string]any{
+			"device_code":      "device",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": srv.URL + "/activate",
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "device", r.PostForm.Get("device_code"))
+		if polls.Add(1) == 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "authorization_pending"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token":  "device-token",
+			"token_type":    "Bearer",
+			"refresh_token": "refresh",
+			"expires_in":    3600,
+		})
+	})
+
+	remote := MCPServerConfig{
+		Type:  "http",
+		URL:   srv.URL + "/mcp",
+		OAuth: &MCPOAuthConfig{Flow: mcpOAuthFlowDevice, ClientID: "mods", Scopes: []string{"read", "write"}},
+	}
+	config.MCPServers = map[string]MCPServerConfig{
+		"remote":    remote,
+		"no-client": {Type: "http", URL: srv.URL, OAuth: &MCPOAuthConfig{Flow: mcpOAuthFlowDevice}},
+		"plain":     {Type: "http", URL: srv.URL},
+	}
+
+	require.NoError(t, mcpLogin(context.Background(), "remote"))
+	require.EqualValues(t, 2, polls.Load())
+	store, err := newMCPTokenStore("remote", remote)
+	require.NoError(t, err)
+	token, err := store.GetToken(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "device-token", token.AccessToken)
+	require.Equal(t, "refresh", token.RefreshToken)
+	require.False(t, token.IsExpired())
+
+	t.Run("设备码流程需要 client-id", func(t *testing.T) {
+		require.ErrorContains(t, mcpLogin(context.Background(), "no-client"), "client-id")
+	})
+
+	t.Run("没有 oauth 的服务器", func(t *testing.T) {
+		require.ErrorContains(t, mcpLogin(context.Background(), "plain"), "设置了 oauth")
+	})
+}
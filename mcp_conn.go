@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+// mcpConns 保存本次运行中已经连接的 MCP 服务器
+var mcpConns mcpConnections
+
+// mcpConnections 是 MCP 服务器的连接集合。每个服务器在第一次使用时启动并初始化，
+// 之后列出工具和每次工具调用都复用同一个连接，程序退出前统一关闭。
+// 对于启动容器的 stdio 服务器，这省去了每次调用都重新启动的时间
+type mcpConnections struct {
+	mu    sync.Mutex
+	conns map[string]*mcpConn
+}
+
+// mcpConn 是一个服务器的连接，mu 保证并发使用时服务器只启动一次。
+// 连接出错后 cli 被清空，下次使用时重新启动服务器，
+// 旧的客户端在并发的调用都结束后才关闭
+type mcpConn struct {
+	mu   sync.Mutex
+	cli  *mcpClient         // 当前的客户端
+	refs map[*mcpClient]int // 正在使用的客户端及其调用数，包括已经出错的客户端
+}
+
+// acquire 返回服务器的连接，还没有连接时启动并初始化服务器。启动失败不会被记住，下次使用时重试。
+// 用完后必须调用 release
+// ctx: 上下文，用于启动和初始化的超时
+// name: 服务器名称
+// server: MCP 服务器配置
+// 返回：MCP 客户端和错误信息
+func (c *mcpConnections) acquire(ctx context.Context, name string, server MCPServerConfig) (*mcpClient, error) {
+	c.mu.Lock()
+	if c.conns == nil {
+		c.conns = map[string]*mcpConn{}
+	}
+	conn, ok := c.conns[name]
+	if !ok {
+		conn = &mcpConn{refs: map[*mcpClient]int{}}
+		c.conns[name] = conn
+	}
+	c.mu.Unlock()
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.cli == nil {
+		cli, err := initMcpClient(ctx, name, server)
+		if err != nil {
+			return nil, err
+		}
+		conn.cli = cli
+	}
+	conn.refs[conn.cli]++
+	return conn.cli, nil
+}
+
+// release 结束一次对连接的使用。err 是传输层的错误时，例如调用超时或服务器已经退出，
+// 连接被移除，下次使用时重新启动服务器；工具返回的错误不影响连接。
+// 被移除的客户端在最后一个使用者结束后关闭，不会打断同一服务器上并发的调用
+// name: 服务器名称
+// cli: acquire 返回的客户端
+// err: 本次使用的错误
+func (c *mcpConnections) release(name string, cli *mcpClient, err error) {
+	c.mu.Lock()
+	conn := c.conns[name]
+	c.mu.Unlock()
+	if conn == nil {
+		// 已经被 closeAll 关闭
+		return
+	}
+
+	conn.mu.Lock()
+	if _, ok := conn.refs[cli]; !ok {
+		conn.mu.Unlock()
+		return
+	}
+	if mcpConnBroken(err) && conn.cli == cli {
+		conn.cli = nil
+	}
+	conn.refs[cli]--
+	retired := conn.refs[cli] == 0 && conn.cli != cli
+	if conn.refs[cli] == 0 {
+		delete(conn.refs, cli)
+	}
+	conn.mu.Unlock()
+
+	if retired {
+		_ = cli.Close()
+	}
+}
+
+// mcpConnBroken 判断错误是否来自传输层，这时连接已经不可用。
+// 服务器返回的 JSON-RPC 错误，例如参数无效，说明连接仍然正常
+func mcpConnBroken(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr)
+}
+
+// closeAll 并发关闭所有连接并等待服务器退出，包括仍在使用中的客户端
+func (c *mcpConnections) closeAll() {
+	c.mu.Lock()
+	conns := c.conns
+	c.conns = nil
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		conn.mu.Lock()
+		clients := map[*mcpClient]struct{}{}
+		if conn.cli != nil {
+			clients[conn.cli] = struct{}{}
+		}
+		for cli := range conn.refs {
+			clients[cli] = struct{}{}
+		}
+		conn.cli = nil
+		conn.refs = map[*mcpClient]int{}
+		conn.mu.Unlock()
+
+		for cli := range clients {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = cli.Close()
+			}()
+		}
+	}
+	wg.Wait()
+}
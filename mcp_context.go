@@ -0,0 +1,340 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/mark3labs/mcp-go/mcp"
+	"golang.org/x/sync/errgroup"
+)
+
+// mcpResourcePrompt 在提示后面附上 --mcp-resource 读取的资源。提示放在最前面，对话标题仍然取自提示
+const mcpResourcePrompt = "%s\n\n---\n\n下面是 MCP 服务器提供的资源：\n\n%s"
+
+// mcpContext 是通过 --mcp-prompt 和 --mcp-resource 取得的上下文，每次运行只读取一次，重试时复用
+type mcpContext struct {
+	messages  []proto.Message // 提示模板展开后的消息
+	resources string          // 资源的文本内容
+	images    []proto.Image   // 资源中的图片
+}
+
+// parseMCPRef 解析 server:name 形式的引用，例如 github:repo://owner/name
+// flag: 引用所在的参数，用于错误信息
+// ref: 引用
+// 返回：服务器名称、服务器配置、服务器内的名称和错误信息
+func parseMCPRef(flag, ref string) (string, MCPServerConfig, string, error) {
+	sname, name, ok := strings.Cut(ref, ":")
+	if !ok || sname == "" || name == "" {
+		return "", MCPServerConfig{}, "", newUserErrorf("%s 的格式应为 server:name，而不是 %q", flag, ref)
+	}
+	server, ok := config.MCPServers[sname]
+	if !ok {
+		return "", MCPServerConfig{}, "", newUserErrorf("%s: 未配置 MCP 服务器 %q", flag, sname)
+	}
+	if !isMCPEnabled(sname) {
+		return "", MCPServerConfig{}, "", newUserErrorf("%s: MCP 服务器 %q 已禁用", flag, sname)
+	}
+	return sname, server, name, nil
+}
+
+// mcpListResources 列出已启用 MCP 服务器提供的资源
+// ctx: 上下文
+// 返回：错误信息
+func mcpListResources(ctx context.Context) error {
+	servers, err := mcpListEach(ctx, func(ctx context.Context, cli *mcpClient) ([]string, error) {
+		if cli.GetServerCapabilities().Resources == nil {
+			return nil, nil
+		}
+		result, err := cli.ListResources(ctx, mcp.ListResourcesRequest{})
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		lines := make([]string, 0, len(result.Resources))
+		for _, r := range result.Resources {
+			line := r.URI
+			if r.Name != "" && r.Name != r.URI {
+				line += stdoutStyles().Timeago.Render(" (" + r.Name + ")")
+			}
+			lines = append(lines, line)
+		}
+		return lines, nil
+	})
+	if err != nil {
+		return err
+	}
+	printMCPList(servers)
+	return nil
+}
+
+// mcpListPrompts 列出已启用 MCP 服务器提供的提示模板及其参数，可选参数带问号
+// ctx: 上下文
+// 返回：错误信息
+func mcpListPrompts(ctx context.Context) error {
+	servers, err := mcpListEach(ctx, func(ctx context.Context, cli *mcpClient) ([]string, error) {
+		if cli.GetServerCapabilities().Prompts == nil {
+			return nil, nil
+		}
+		result, err := cli.ListPrompts(ctx, mcp.ListPromptsRequest{})
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		lines := make([]string, 0, len(result.Prompts))
+		for _, p := range result.Prompts {
+			args := make([]string, 0, len(p.Arguments))
+			for _, arg := range p.Arguments {
+				if arg.Required {
+					args = append(args, arg.Name)
+				} else {
+					args = append(args, arg.Name+"?")
+				}
+			}
+			line := p.Name
+			if len(args) > 0 {
+				line += stdoutStyles().Timeago.Render(" (" + strings.Join(args, ", ") + ")")
+			}
+			lines = append(lines, line)
+		}
+		return lines, nil
+	})
+	if err != nil {
+		return err
+	}
+	printMCPList(servers)
+	return nil
+}
+
+// mcpListEach 并发地对每个已启用的 MCP 服务器执行 list
+// ctx: 上下文
+// list: 返回服务器的列表项
+// 返回：服务器名称到列表项的映射和错误信息
+func mcpListEach(ctx context.Context, list func(context.Context, *mcpClient) ([]string, error)) (map[string][]string, error) {
+	var mu sync.Mutex
+	var wg errgroup.Group
+	result := map[string][]string{}
+	for sname, server := range enabledMCPs() {
+		wg.Go(func() error {
+			ctx, cancel := context.WithTimeout(ctx, server.timeout())
+			defer cancel()
+			cli, err := mcpConns.acquire(ctx, sname, server)
+			if err != nil {
+				return modsError{err: fmt.Errorf("无法设置 %s: %w", sname, err), reason: "无法连接 MCP 服务器"}
+			}
+			lines, err := list(ctx, cli)
+			mcpConns.release(sname, cli, err)
+			if err != nil {
+				return modsError{err: fmt.Errorf("%s: %w", sname, err), reason: "无法列出 MCP 服务器的内容"}
+			}
+			mu.Lock()
+			result[sname] = lines
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := wg.Wait(); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	return result, nil
+}
+
+// printMCPList 按服务器名称的顺序输出列表项
+func printMCPList(servers map[string][]string) {
+	for sname := range enabledMCPs() {
+		for _, line := range servers[sname] {
+			fmt.Print(stdoutStyles().Timeago.Render(sname + " > "))
+			fmt.Println(line)
+		}
+	}
+}
+
+// loadMCPContext 读取 --mcp-prompt 和 --mcp-resource 指定的内容，只在第一次调用时读取
+// ctx: 上下文
+// 返回：错误信息
+func (m *Mods) loadMCPContext(ctx context.Context) error {
+	cfg := m.Config
+	if m.mcpContext != nil || (cfg.MCPPrompt == "" && len(cfg.MCPResources) == 0) {
+		return nil
+	}
+	var mc mcpContext
+	if cfg.MCPPrompt != "" {
+		messages, err := getMCPPrompt(ctx, cfg.MCPPrompt, cfg.MCPPromptArgs)
+		if err != nil {
+			return modsError{err: err, reason: "无法获取 MCP 提示模板。"}
+		}
+		mc.messages = messages
+	}
+	var sb strings.Builder
+	for _, ref := range cfg.MCPResources {
+		text, images, err := readMCPResource(ctx, ref)
+		if err != nil {
+			return modsError{err: err, reason: fmt.Sprintf("无法读取 MCP 资源 %s。", ref)}
+		}
+		if text != "" {
+			if sb.Len() > 0 {
+				sb.WriteString("\n\n")
+			}
+			fmt.Fprintf(&sb, "[%s]\n\n%s", ref, text)
+		}
+		mc.images = append(mc.images, images...)
+	}
+	mc.resources = sb.String()
+	m.mcpContext = &mc
+	return nil
+}
+
+// getMCPPrompt 获取 MCP 提示模板并转换为消息
+// ctx: 上下文
+// ref: server:name 形式的提示模板
+// args: key=value 形式的参数
+// 返回：消息和错误信息
+func getMCPPrompt(ctx context.Context, ref string, args []string) ([]proto.Message, error) {
+	sname, server, name, err := parseMCPRef("--mcp-prompt", ref)
+	if err != nil {
+		return nil, err
+	}
+	arguments := make(map[string]string, len(args))
+	for _, arg := range args {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok || k == "" {
+			return nil, newUserErrorf("--mcp-prompt-arg 的格式应为 key=value，而不是 %q", arg)
+		}
+		arguments[k] = v
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, server.timeout())
+	defer cancel()
+	cli, err := mcpConns.acquire(ctx, sname, server)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: %w", err)
+	}
+	request := mcp.GetPromptRequest{}
+	request.Params.Name = name
+	request.Params.Arguments = arguments
+	result, err := cli.GetPrompt(ctx, request)
+	mcpConns.release(sname, cli, err)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: %s: %w", ref, err)
+	}
+
+	var messages []proto.Message
+	for _, pm := range result.Messages {
+		msg := proto.Message{Role: proto.RoleUser}
+		if pm.Role == mcp.RoleAssistant {
+			msg.Role = proto.RoleAssistant
+		}
+		switch content := pm.Content.(type) {
+		case mcp.TextContent:
+			msg.Content = content.Text
+		case mcp.ImageContent:
+			img, err := mcpImage(content.MIMEType, content.Data)
+			if err != nil {
+				return nil, fmt.Errorf("mcp: %s: %w", ref, err)
+			}
+			msg.Images = []proto.Image{img}
+		case mcp.EmbeddedResource:
+			text, images, err := mcpResourceContents(content.Resource)
+			if err != nil {
+				return nil, fmt.Errorf("mcp: %s: %w", ref, err)
+			}
+			msg.Content, msg.Images = text, images
+		default:
+			return nil, fmt.Errorf("mcp: %s: 不支持的内容类型 %T", ref, content)
+		}
+		if msg.Role == proto.RoleAssistant && len(msg.Images) > 0 {
+			return nil, fmt.Errorf("mcp: %s: 助手消息不能包含图片", ref)
+		}
+		messages = appendMessage(messages, msg)
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("mcp: %s: 提示模板没有消息", ref)
+	}
+	return messages, nil
+}
+
+// readMCPResource 读取 MCP 资源
+// ctx: 上下文
+// ref: server:uri 形式的资源
+// 返回：文本内容、图片和错误信息
+func readMCPResource(ctx context.Context, ref string) (string, []proto.Image, error) {
+	sname, server, uri, err := parseMCPRef("--mcp-resource", ref)
+	if err != nil {
+		return "", nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, server.timeout())
+	defer cancel()
+	cli, err := mcpConns.acquire(ctx, sname, server)
+	if err != nil {
+		return "", nil, fmt.Errorf("mcp: %w", err)
+	}
+	request := mcp.ReadResourceRequest{}
+	request.Params.URI = uri
+	result, err := cli.ReadResource(ctx, request)
+	mcpConns.release(sname, cli, err)
+	if err != nil {
+		return "", nil, fmt.Errorf("mcp: %w", err)
+	}
+
+	var texts []string
+	var images []proto.Image
+	for _, contents := range result.Contents {
+		text, imgs, err := mcpResourceContents(contents)
+		if err != nil {
+			return "", nil, err
+		}
+		if text != "" {
+			texts = append(texts, text)
+		}
+		images = append(images, imgs...)
+	}
+	return strings.Join(texts, "\n\n"), images, nil
+}
+
+// mcpResourceContents 转换资源的内容：文本原样返回，图片解码为 proto.Image，其它二进制内容不支持
+func mcpResourceContents(contents mcp.ResourceContents) (string, []proto.Image, error) {
+	switch contents := contents.(type) {
+	case mcp.TextResourceContents:
+		return contents.Text, nil, nil
+	case mcp.BlobResourceContents:
+		img, err := mcpImage(contents.MIMEType, contents.Blob)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", contents.URI, err)
+		}
+		return "", []proto.Image{img}, nil
+	}
+	return "", nil, fmt.Errorf("不支持的资源内容 %T", contents)
+}
+
+// mcpImage 解码 base64 编码的图片，只支持图片类型
+func mcpImage(mimeType, data string) (proto.Image, error) {
+	if !strings.HasPrefix(mimeType, "image/") {
+		return proto.Image{}, fmt.Errorf("不支持的二进制内容（%s），只支持图片", cmp.Or(mimeType, "未知类型"))
+	}
+	bts, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return proto.Image{}, fmt.Errorf("无法解码图片: %w", err)
+	}
+	return proto.Image{MediaType: mimeType, Data: bts}, nil
+}
+
+// appendMessage 追加消息，与上一条消息的角色相同时合并，因为有的 API 要求用户和助手的消息交替出现
+func appendMessage(messages []proto.Message, msg proto.Message) []proto.Message {
+	i := len(messages) - 1
+	if i < 0 || messages[i].Role != msg.Role || len(messages[i].ToolCalls) > 0 {
+		return append(messages, msg)
+	}
+	last := messages[i]
+	switch {
+	case last.Content == "":
+		last.Content = msg.Content
+	case msg.Content != "":
+		last.Content += "\n\n" + msg.Content
+	}
+	last.Images = append(slices.Clip(last.Images), msg.Images...)
+	messages[i] = last
+	return messages
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+)
+
+// defaultMCPPath 是容器中 HTTP MCP 服务器的默认路径
+const defaultMCPPath = "/mcp"
+
+// newDockerMCPClient 在容器中运行 MCP 服务器并连接它。未设置 port 时通过 docker run -i 的
+// stdio 连接，否则在后台运行容器，把端口发布到本机并通过 HTTP 连接（路径以 /sse 结尾时使用 SSE）
+// ctx: 上下文
+// server: MCP 服务器配置
+// 返回：MCP 客户端和错误信息
+func newDockerMCPClient(ctx context.Context, server MCPServerConfig) (*mcpClient, error) {
+	if server.Image == "" {
+		return nil, errors.New("docker 类型的 MCP 服务器需要设置 image")
+	}
+	docker := cmp.Or(server.Command, "docker")
+	name, err := containerName()
+	if err != nil {
+		return nil, err
+	}
+	args := dockerRunArgs(server, name)
+
+	if server.Port == 0 {
+		cli, err := newStdioMCPClient(MCPServerConfig{
+			Command: docker,
+			Env:     server.Env,
+			Args:    args,
+		})
+		if err != nil {
+			return nil, err
+		}
+		cli.container, cli.docker = name, docker
+		mcpProcesses.addContainer(docker, name)
+		return cli, nil
+	}
+
+	cmd := exec.CommandContext(ctx, docker, args...)
+	cmd.Env = append(os.Environ(), server.Env...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("启动容器失败: %w: %s", err, bytes.TrimSpace(out))
+	}
+	mcpProcesses.addContainer(docker, name)
+	cli := &mcpClient{container: name, docker: docker}
+
+	path := cmp.Or(server.URL, defaultMCPPath)
+	addr, err := publishedAddr(ctx, docker, name, server.Port)
+	if err == nil {
+		err = waitForServer(ctx, "http://"+addr+path)
+	}
+	if err != nil {
+		mcpProcesses.stopContainer(docker, name)
+		return nil, err
+	}
+	url := "http://" + addr + path
+	if strings.HasSuffix(path, "/sse") {
+		cli.Client, err = client.NewSSEMCPClient(url)
+	} else {
+		cli.Client, err = client.NewStreamableHttpClient(url)
+	}
+	if err != nil {
+		mcpProcesses.stopContainer(docker, name)
+		return nil, err //nolint:wrapcheck
+	}
+	return cli, nil
+}
+
+// dockerRunArgs 返回运行 MCP 服务器容器的 docker run 参数。
+// 环境变量只传递名称，值由 docker 从自身的环境中读取，不出现在命令行上
+// server: MCP 服务器配置
+// name: 容器名称
+// 返回：docker 的参数
+func dockerRunArgs(server MCPServerConfig, name string) []string {
+	args := []string{"run", "--rm", "--name", name}
+	if server.Port > 0 {
+		args = append(args, "--detach", "--publish", fmt.Sprintf("127.0.0.1::%d", server.Port))
+	} else {
+		args = append(args, "--interactive")
+	}
+	for _, volume := range server.Volumes {
+		args = append(args, "--volume", volume)
+	}
+	if server.Network != "" {
+		args = append(args, "--network", server.Network)
+	}
+	for _, env := range server.Env {
+		key, _, _ := strings.Cut(env, "=")
+		args = append(args, "--env", key)
+	}
+	args = append(args, server.Image)
+	return append(args, server.Args...)
+}
+
+// containerName 生成唯一的容器名称，关闭或中断时按名称停止容器
+func containerName() (string, error) {
+	b := make([]byte, 6) //nolint:mnd
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成容器名称失败: %w", err)
+	}
+	return "mods-mcp-" + hex.EncodeToString(b), nil
+}
+
+// publishedAddr 返回容器端口发布到本机的地址
+func publishedAddr(ctx context.Context, docker, name string, port int) (string, error) {
+	out, err := exec.CommandContext(ctx, docker, "port", name, strconv.Itoa(port)).Output()
+	if err != nil {
+		return "", fmt.Errorf("获取容器端口失败: %w", err)
+	}
+	// 每行一个地址，例如 127.0.0.1:49153
+	addr, _, _ := strings.Cut(string(out), "\n")
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return "", fmt.Errorf("容器没有发布端口 %d", port)
+	}
+	return addr, nil
+}
+
+// waitForServer 等待容器中的服务器开始响应。docker 在容器启动时就会接受发布端口上的连接，
+// 所以要等到收到任意 HTTP 响应为止
+func waitForServer(ctx context.Context, url string) error {
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return fmt.Errorf("等待容器中的 MCP 服务器: %w", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			return resp.Body.Close() //nolint:wrapcheck
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("等待容器中的 MCP 服务器响应 %s: %w", url, ctx.Err())
+		case <-time.After(mcpPollInterval):
+		}
+	}
+}
+
+// stopContainer 停止容器，--rm 会在容器停止后将其移除。容器已经退出时忽略错误
+func stopContainer(docker, name string) {
+	timeout := strconv.Itoa(int(mcpTerminateTimeout.Seconds()))
+	_ = exec.Command(docker, "stop", "--time", timeout, name).Run() //nolint:gosec
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerRunArgs(t *testing.T) {
+	server := MCPServerConfig{
+		Image:   "ghcr.io/github/github-mcp-server",
+		Env:     []string{"GITHUB_PERSONAL_ACCESS_TOKEN=secret"},
+		Args:    []string{"stdio"},
+		Volumes: []string{"/src:/src:ro"},
+		Network: "none",
+	}
+
+	t.Run("stdio", func(t *testing.T) {
+		require.Equal(t, []string{
+			"run", "--rm", "--name", "mods-mcp-x", "--interactive",
+			"--volume", "/src:/src:ro",
+			"--network", "none",
+			"--env", "GITHUB_PERSONAL_ACCESS_TOKEN",
+			"ghcr.io/github/github-mcp-server", "stdio",
+		}, dockerRunArgs(server, "mods-mcp-x"))
+	})
+
+	t.Run("端口", func(t *testing.T) {
+		server.Port = 8080
+		args := dockerRunArgs(server, "mods-mcp-x")
+		require.Equal(t, []string{"run", "--rm", "--name", "mods-mcp-x", "--detach", "--publish", "127.0.0.1::8080"}, args[:7])
+	})
+
+	t.Run("需要镜像", func(t *testing.T) {
+		_, err := newDockerMCPClient(t.Context(), MCPServerConfig{Type: "docker"})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+const (
+	mcpTerminateTimeout = 3 * time.Second       // 发送 SIGTERM 后等待 MCP 服务器退出的时间
+	mcpPollInterval     = 50 * time.Millisecond // 检查进程组是否已退出的间隔
+)
+
+// mcpProcesses 记录所有仍在运行的 stdio MCP 服务器进程
+var mcpProcesses mcpProcessSet
+
+// mcpProcessSet 是正在运行的 MCP 服务器进程组集合，
+// 在收到中断信号或程序退出时终止其中的所有进程，避免残留 docker、node 等子进程
+type mcpProcessSet struct {
+	mu         sync.Mutex
+	pids       map[int]struct{}
+	containers map[string]string // 容器名称到管理命令（docker、podman）
+	watch      sync.Once
+}
+
+// add 记录一个进程组，并在第一次调用时开始监听中断信号
+func (s *mcpProcessSet) add(pid int) {
+	s.mu.Lock()
+	if s.pids == nil {
+		s.pids = map[int]struct{}{}
+	}
+	s.pids[pid] = struct{}{}
+	s.mu.Unlock()
+	s.watch.Do(s.watchSignals)
+}
+
+// remove 移除一个进程组，返回它是否仍在集合中
+func (s *mcpProcessSet) remove(pid int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.pids[pid]
+	delete(s.pids, pid)
+	return ok
+}
+
+// addContainer 记录一个 docker 服务器的容器，并在第一次调用时开始监听中断信号
+func (s *mcpProcessSet) addContainer(docker, name string) {
+	s.mu.Lock()
+	if s.containers == nil {
+		s.containers = map[string]string{}
+	}
+	s.containers[name] = docker
+	s.mu.Unlock()
+	s.watch.Do(s.watchSignals)
+}
+
+// stopContainer 停止并移除一个容器，容器已不在集合中时不做任何事
+func (s *mcpProcessSet) stopContainer(docker, name string) {
+	s.mu.Lock()
+	_, ok := s.containers[name]
+	delete(s.containers, name)
+	s.mu.Unlock()
+	if ok {
+		stopContainer(docker, name)
+	}
+}
+
+// terminateAll 终止所有记录的进程组和容器并等待它们退出
+func (s *mcpProcessSet) terminateAll() {
+	s.mu.Lock()
+	pids := make([]int, 0, len(s.pids))
+	for pid := range s.pids {
+		pids = append(pids, pid)
+	}
+	containers := s.containers
+	s.pids = nil
+	s.containers = nil
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, pid := range pids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopProcessGroup(pid)
+		}()
+	}
+	for name, docker := range containers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopContainer(docker, name)
+		}()
+	}
+	wg.Wait()
+}
+
+// watchSignals 收到中断信号时先终止 MCP 服务器，再重新发送信号，
+// 让程序按原来的方式退出
+func (s *mcpProcessSet) watchSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-ch
+		signal.Stop(ch)
+		s.terminateAll()
+		raiseSignal(sig)
+	}()
+}
+
+// stopProcessGroup 先请求进程组退出，超时后强制结束
+func stopProcessGroup(pid int) {
+	if terminateProcessGroup(pid) != nil {
+		return
+	}
+	deadline := time.Now().Add(mcpTerminateTimeout)
+	for processGroupAlive(pid) {
+		if time.Now().After(deadline) {
+			_ = killProcessGroup(pid)
+			return
+		}
+		time.Sleep(mcpPollInterval)
+	}
+}
+
+// mcpClient 是 MCP 客户端，stdio 服务器的进程组和 docker 服务器的容器在关闭时一并终止
+type mcpClient struct {
+	*client.Client
+	pid       int    // stdio 服务器的进程 ID，其它类型为 0
+	container string // docker 服务器的容器名称
+	docker    string // 管理容器使用的命令
+}
+
+// newStdioMCPClient 在独立的进程组中启动 stdio MCP 服务器
+// server: MCP 服务器配置
+// 返回：MCP 客户端和错误信息
+func newStdioMCPClient(server MCPServerConfig) (*mcpClient, error) {
+	var cmd *exec.Cmd
+	cli, err := client.NewStdioMCPClientWithOptions(
+		server.Command,
+		append(os.Environ(), server.Env...),
+		server.Args,
+		transport.WithCommandFunc(func(_ context.Context, command string, env, args []string) (*exec.Cmd, error) {
+			cmd = exec.Command(command, args...)
+			cmd.Env = env
+			cmd.SysProcAttr = mcpProcAttr()
+			return cmd, nil
+		}),
+	)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	mcpProcesses.add(cmd.Process.Pid)
+	return &mcpClient{Client: cli, pid: cmd.Process.Pid}, nil
+}
+
+// Close 关闭客户端，服务器没有在关闭输入后及时退出时终止其进程组
+func (c *mcpClient) Close() error {
+	if c.container != "" {
+		defer mcpProcesses.stopContainer(c.docker, c.container)
+	}
+	if c.pid == 0 {
+		return c.Client.Close() //nolint:wrapcheck
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Client.Close() }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(mcpTerminateTimeout):
+	}
+	// 服务器退出后其子进程可能仍在运行，一并终止
+	if mcpProcesses.remove(c.pid) && processGroupAlive(c.pid) {
+		stopProcessGroup(c.pid)
+	}
+	return err //nolint:wrapcheck
+}
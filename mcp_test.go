@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterTools(t *testing.T) {
+	tools := []mcp.Tool{{Name: "get_issue"}, {Name: "get_secret_key"}, {Name: "list_issues"}, {Name: "delete_repo"}}
+	names := func(tools []mcp.Tool) []string {
+		var result []string
+		for _, tool := range tools {
+			result = append(result, tool.Name)
+		}
+		return result
+	}
+
+	t.Run("没有设置时提供全部工具", func(t *testing.T) {
+		result, err := filterTools("gh", MCPServerConfig{}, tools)
+		require.NoError(t, err)
+		require.Equal(t, names(tools), names(result))
+	})
+
+	t.Run("allowed-tools 和 blocked-tools", func(t *testing.T) {
+		server := MCPServerConfig{
+			AllowedTools: []string{"get_*", "list_*"},
+			BlockedTools: []string{"get_secret_*"},
+		}
+		result, err := filterTools("gh", server, tools)
+		require.NoError(t, err)
+		require.Equal(t, []string{"get_issue", "list_issues"}, names(result))
+	})
+
+	t.Run("只设置 blocked-tools", func(t *testing.T) {
+		result, err := filterTools("gh", MCPServerConfig{BlockedTools: []string{"delete_*"}}, tools)
+		require.NoError(t, err)
+		require.Equal(t, []string{"get_issue", "get_secret_key", "list_issues"}, names(result))
+	})
+
+	t.Run("无效的模式", func(t *testing.T) {
+		_, err := filterTools("gh", MCPServerConfig{AllowedTools: []string{"get_["}}, tools)
+		require.ErrorContains(t, err, "get_[")
+	})
+
+	t.Run("拒绝调用没有提供的工具", func(t *testing.T) {
+		oldConfig := config
+		t.Cleanup(func() { config = oldConfig })
+		config.MCPServers = map[string]MCPServerConfig{
+			"gh": {Command: "does-not-exist", BlockedTools: []string{"delete_*"}},
+		}
+		_, err := toolCall(context.Background(), "gh_delete_repo", nil)
+		require.ErrorContains(t, err, "blocked-tools")
+	})
+}
+
+func TestParseMCPRef(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config.MCPServers = map[string]MCPServerConfig{"gh": {}, "off": {}}
+	config.MCPDisable = []string{"off"}
+
+	sname, _, name, err := parseMCPRef("--mcp-resource", "gh:repo://charmbracelet/mods")
+	require.NoError(t, err)
+	require.Equal(t, "gh", sname)
+	require.Equal(t, "repo://charmbracelet/mods", name)
+
+	for ref, msg := range map[string]string{
+		"gh":        "server:name",
+		":x":        "server:name",
+		"nope:x":    "未配置",
+		"off:x":     "已禁用",
+		"gh:review": "",
+	} {
+		_, _, _, err := parseMCPRef("--mcp-prompt", ref)
+		if msg == "" {
+			require.NoError(t, err, ref)
+			continue
+		}
+		require.ErrorContains(t, err, msg, ref)
+	}
+}
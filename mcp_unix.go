@@ -0,0 +1,36 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// mcpProcAttr 让 stdio MCP 服务器在独立的进程组中运行，
+// 终端的 ctrl+c 不会直接发送给它，由 mods 负责按顺序终止整个进程组
+func mcpProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcessGroup 向进程组发送 SIGTERM，docker 等命令会将其转发给容器
+func terminateProcessGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGTERM) //nolint:wrapcheck
+}
+
+// killProcessGroup 向进程组发送 SIGKILL
+func killProcessGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL) //nolint:wrapcheck
+}
+
+// processGroupAlive 检查进程组中是否还有进程
+func processGroupAlive(pid int) bool {
+	return syscall.Kill(-pid, 0) == nil
+}
+
+// raiseSignal 清理完成后重新发送信号，交给默认处理或 Bubble Tea 处理
+func raiseSignal(sig os.Signal) {
+	if s, ok := sig.(syscall.Signal); ok {
+		_ = syscall.Kill(os.Getpid(), s)
+	}
+}
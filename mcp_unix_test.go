@@ -0,0 +1,280 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopProcessGroup(t *testing.T) {
+	t.Run("终止子进程", func(t *testing.T) {
+		// sh 会启动一个忽略 SIGTERM 的子进程，模拟残留的服务器进程
+		cmd := exec.Command("sh", "-c", "trap '' TERM; sleep 30 & echo $!; wait")
+		cmd.SysProcAttr = mcpProcAttr()
+		stdout, err := cmd.StdoutPipe()
+		require.NoError(t, err)
+		require.NoError(t, cmd.Start())
+		line, err := bufio.NewReader(stdout).ReadString('\n')
+		require.NoError(t, err)
+		child, err := strconv.Atoi(strings.TrimSpace(line))
+		require.NoError(t, err)
+		go cmd.Wait() //nolint:errcheck
+
+		start := time.Now()
+		stopProcessGroup(cmd.Process.Pid)
+		require.GreaterOrEqual(t, time.Since(start), mcpTerminateTimeout)
+		requireExited(t, child)
+	})
+
+	t.Run("集合", func(t *testing.T) {
+		cmd := exec.Command("sleep", "30")
+		cmd.SysProcAttr = mcpProcAttr()
+		require.NoError(t, cmd.Start())
+		go cmd.Wait() //nolint:errcheck
+
+		var set mcpProcessSet
+		set.pids = map[int]struct{}{cmd.Process.Pid: {}}
+		set.terminateAll()
+		require.Empty(t, set.pids)
+		require.False(t, set.remove(cmd.Process.Pid))
+		requireExited(t, cmd.Process.Pid)
+	})
+}
+
+// requireExited 检查进程已经退出，尚未被回收的僵尸进程也视为已退出
+func requireExited(t *testing.T, pid int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		out, _ := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+		stat := strings.TrimSpace(string(out))
+		return stat == "" || strings.HasPrefix(stat, "Z")
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDockerMCPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	t.Cleanup(srv.Close)
+
+	// 假的 docker 命令记录调用，并把容器端口映射到测试服务器
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	docker := filepath.Join(dir, "docker")
+	script := "#!/bin/sh\necho \"$@\" >> " + calls + "\n" +
+		"if [ \"$1\" = port ]; then echo " + strings.TrimPrefix(srv.URL, "http://") + "; fi\n"
+	require.NoError(t, os.WriteFile(docker, []byte(script), 0o700))
+
+	cli, err := newDockerMCPClient(t.Context(), MCPServerConfig{
+		Type:    "docker",
+		Command: docker,
+		Image:   "example/mcp",
+		Port:    8080,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, cli.Client)
+	require.NoError(t, cli.Close())
+
+	bts, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(bts)), "\n")
+	require.Len(t, lines, 3)
+	require.True(t, strings.HasPrefix(lines[0], "run --rm --name "+cli.container+" --detach"))
+	require.Equal(t, "port "+cli.container+" 8080", lines[1])
+	require.Equal(t, "stop --time 3 "+cli.container, lines[2])
+	require.Empty(t, mcpProcesses.containers)
+}
+
+// fakeMCPServer 写入一个假的 stdio MCP 服务器，每次启动时在 starts 中记录一行
+func fakeMCPServer(t *testing.T, starts string) string {
+	t.Helper()
+	server := filepath.Join(t.TempDir(), "server")
+	script := "#!/bin/sh\necho start >> " + starts + "\n" + `while read -r line; do
+  id=$(echo "$line" | sed -n 's/.*"id":\([0-9]*\).*/\1/p')
+  [ -z "$id" ] && continue
+  case "$line" in
+  *'"initialize"'*) echo '{"jsonrpc":"2.0","id":'$id',"result":{"protocolVersion":"2024-11-05","capabilities":{"tools":{},"resources":{},"prompts":{}},"serverInfo":{"name":"fake","version":"1"}}}' ;;
+  *'"tools/list"'*) echo '{"jsonrpc":"2.0","id":'$id',"result":{"tools":[{"name":"echo","inputSchema":{"type":"object"}}]}}' ;;
+  *'"name":"slow"'*) (sleep 0.3; echo '{"jsonrpc":"2.0","id":'$id',"result":{"content":[{"type":"text","text":"slow"}]}}') & ;;
+  *'"name":"bad"'*) echo '{"jsonrpc":"2.0","id":'$id',"error":{"code":-32602,"message":"invalid params"}}' ;;
+  *'"name":"hang"'*) ;;
+  *'"tools/call"'*) echo '{"jsonrpc":"2.0","id":'$id',"result":{"content":[{"type":"text","text":"ok"}]}}' ;;
+  *'"resources/list"'*) echo '{"jsonrpc":"2.0","id":'$id',"result":{"resources":[{"uri":"memo://notes","name":"notes"}]}}' ;;
+  *'"resources/read"'*) echo '{"jsonrpc":"2.0","id":'$id',"result":{"contents":[{"uri":"memo://notes","mimeType":"text/plain","text":"remember the milk"}]}}' ;;
+  *'"prompts/list"'*) echo '{"jsonrpc":"2.0","id":'$id',"result":{"prompts":[{"name":"review","arguments":[{"name":"lang","required":true},{"name":"style"}]}]}}' ;;
+  *'"prompts/get"'*) echo '{"jsonrpc":"2.0","id":'$id',"result":{"messages":[{"role":"user","content":{"type":"text","text":"review this"}},{"role":"user","content":{"type":"resource","resource":{"uri":"memo://code","text":"x := 1"}}}]}}' ;;
+  esac
+done
+`
+	require.NoError(t, os.WriteFile(server, []byte(script), 0o700))
+	return server
+}
+
+func TestMCPConnections(t *testing.T) {
+	starts := filepath.Join(t.TempDir(), "starts")
+	server := fakeMCPServer(t, starts)
+
+	oldConfig := config
+	t.Cleanup(func() {
+		config = oldConfig
+		mcpConns.closeAll()
+	})
+	config.MCPServers = map[string]MCPServerConfig{"fake": {Command: server}}
+
+	for range 2 {
+		tools, err := mcpTools(t.Context())
+		require.NoError(t, err)
+		require.Len(t, tools["fake"], 1)
+	}
+	for range 2 {
+		result, err := toolCall(t.Context(), "fake_echo", []byte("{}"))
+		require.NoError(t, err)
+		require.Equal(t, "ok", result)
+	}
+
+	bts, err := os.ReadFile(starts)
+	require.NoError(t, err)
+	require.Equal(t, "start\n", string(bts), "服务器只启动一次")
+
+	cli, err := mcpConns.acquire(t.Context(), "fake", config.MCPServers["fake"])
+	require.NoError(t, err)
+	mcpConns.closeAll()
+	mcpConns.release("fake", cli, nil)
+	requireExited(t, cli.pid)
+	require.False(t, mcpProcesses.remove(cli.pid))
+}
+
+func TestMCPConnectionsParallel(t *testing.T) {
+	starts := filepath.Join(t.TempDir(), "starts")
+	oldConfig := config
+	t.Cleanup(func() {
+		config = oldConfig
+		mcpConns.closeAll()
+	})
+	config.MCPServers = map[string]MCPServerConfig{"fake": {Command: fakeMCPServer(t, starts)}}
+
+	// callWithSlow 在 slow 工具运行期间调用 fail，返回 slow 的结果和 fail 的错误
+	callWithSlow := func(fail func() error) (string, error) {
+		type result struct {
+			content string
+			err     error
+		}
+		slow := make(chan result, 1)
+		go func() {
+			content, err := toolCall(t.Context(), "fake_slow", []byte("{}"))
+			slow <- result{content, err}
+		}()
+		time.Sleep(100 * time.Millisecond)
+		err := fail()
+		r := <-slow
+		require.NoError(t, r.err)
+		return r.content, err
+	}
+
+	t.Run("工具返回错误", func(t *testing.T) {
+		result, err := callWithSlow(func() error {
+			_, err := toolCall(t.Context(), "fake_bad", []byte("{}"))
+			return err
+		})
+		require.ErrorIs(t, err, mcp.ErrInvalidParams)
+		require.Equal(t, "slow", result)
+
+		result, err = toolCall(t.Context(), "fake_echo", []byte("{}"))
+		require.NoError(t, err)
+		require.Equal(t, "ok", result)
+		bts, err := os.ReadFile(starts)
+		require.NoError(t, err)
+		require.Equal(t, "start\n", string(bts), "工具的错误不会重启服务器")
+	})
+
+	t.Run("调用超时", func(t *testing.T) {
+		result, err := callWithSlow(func() error {
+			ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+			defer cancel()
+			_, err := toolCall(ctx, "fake_hang", []byte("{}"))
+			return err
+		})
+		require.ErrorContains(t, err, "超时")
+		require.Equal(t, "slow", result, "同一服务器上并发的调用不受影响")
+
+		result, err = toolCall(t.Context(), "fake_echo", []byte("{}"))
+		require.NoError(t, err)
+		require.Equal(t, "ok", result)
+		bts, err := os.ReadFile(starts)
+		require.NoError(t, err)
+		require.Equal(t, "start\nstart\n", string(bts), "超时后重新启动服务器")
+	})
+}
+
+func TestMCPContext(t *testing.T) {
+	starts := filepath.Join(t.TempDir(), "starts")
+	oldConfig := config
+	t.Cleanup(func() {
+		config = oldConfig
+		mcpConns.closeAll()
+	})
+	config.MCPServers = map[string]MCPServerConfig{"fake": {Command: fakeMCPServer(t, starts)}}
+
+	t.Run("资源", func(t *testing.T) {
+		text, images, err := readMCPResource(t.Context(), "fake:memo://notes")
+		require.NoError(t, err)
+		require.Equal(t, "remember the milk", text)
+		require.Empty(t, images)
+	})
+
+	t.Run("提示模板", func(t *testing.T) {
+		messages, err := getMCPPrompt(t.Context(), "fake:review", []string{"lang=go"})
+		require.NoError(t, err)
+		require.Equal(t, []proto.Message{{Role: proto.RoleUser, Content: "review this\n\nx := 1"}}, messages)
+
+		_, err = getMCPPrompt(t.Context(), "fake:review", []string{"lang"})
+		require.ErrorContains(t, err, "key=value")
+	})
+
+	t.Run("加到对话中", func(t *testing.T) {
+		cfg := &Config{MCPPrompt: "fake:review", MCPResources: []string{"fake:memo://notes"}}
+		m := &Mods{Config: cfg}
+		require.NoError(t, m.loadMCPContext(t.Context()))
+		require.NoError(t, m.setupStreamContext("in go please", Model{}))
+		require.Len(t, m.messages, 1)
+		require.Equal(t, proto.RoleUser, m.messages[0].Role)
+		require.Equal(t,
+			"review this\n\nx := 1\n\nin go please\n\n---\n\n下面是 MCP 服务器提供的资源：\n\n[fake:memo://notes]\n\nremember the milk",
+			m.messages[0].Content)
+
+		// 重试时不再读取
+		m.mcpContext.resources = "cached"
+		require.NoError(t, m.loadMCPContext(t.Context()))
+		require.Equal(t, "cached", m.mcpContext.resources)
+	})
+
+	t.Run("列出", func(t *testing.T) {
+		servers, err := mcpListEach(t.Context(), func(ctx context.Context, cli *mcpClient) ([]string, error) {
+			result, err := cli.ListPrompts(ctx, mcp.ListPromptsRequest{})
+			if err != nil {
+				return nil, err
+			}
+			return []string{result.Prompts[0].Name}, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string][]string{"fake": {"review"}}, servers)
+	})
+
+	bts, err := os.ReadFile(starts)
+	require.NoError(t, err)
+	require.Equal(t, "start\n", string(bts))
+}
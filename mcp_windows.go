@@ -0,0 +1,35 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// mcpProcAttr 让 stdio MCP 服务器在独立的进程组中运行
+func mcpProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// terminateProcessGroup 结束进程及其所有子进程
+func terminateProcessGroup(pid int) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run() //nolint:wrapcheck
+}
+
+// killProcessGroup 结束进程及其所有子进程
+func killProcessGroup(pid int) error {
+	return terminateProcessGroup(pid)
+}
+
+// processGroupAlive 在 Windows 上 taskkill 会同步结束进程树，无需等待
+func processGroupAlive(int) bool {
+	return false
+}
+
+// raiseSignal 清理完成后以中断状态退出
+func raiseSignal(os.Signal) {
+	os.Exit(1)
+}
@@ -23,6 +23,18 @@ func lastPrompt(messages []proto.Message) string {
 	return result
 }
 
+// lastToolOutput 获取最后一个工具调用的结果
+// messages: 消息列表
+// 返回：最后一个工具消息的内容
+func lastToolOutput(messages []proto.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == proto.RoleTool {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
 // firstLine 获取字符串的第一行
 // s: 输入字符串
 // 返回：第一行内容
@@ -51,6 +51,41 @@ func TestLastPrompt(t *testing.T) {
 	})
 }
 
+// TestLastToolOutput 测试 lastToolOutput 函数
+func TestLastToolOutput(t *testing.T) {
+	// 测试用例：没有工具消息
+	t.Run("no tool output", func(t *testing.T) {
+		require.Equal(t, "", lastToolOutput([]proto.Message{
+			{
+				Role:    proto.RoleUser,
+				Content: "single",
+			},
+		}))
+	})
+
+	// 测试用例：多个工具消息
+	t.Run("multiple tool outputs", func(t *testing.T) {
+		require.Equal(t, "second", lastToolOutput([]proto.Message{
+			{
+				Role:    proto.RoleUser,
+				Content: "query",
+			},
+			{
+				Role:    proto.RoleTool,
+				Content: "first",
+			},
+			{
+				Role:    proto.RoleTool,
+				Content: "second",
+			},
+			{
+				Role:    proto.RoleAssistant,
+				Content: "",
+			},
+		}))
+	})
+}
+
 // TestFirstLine 测试 firstLine 函数
 func TestFirstLine(t *testing.T) {
 	// 测试用例：单行文本
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// requestMeta 记录生成某次回答时使用的请求参数，便于复现当时的输出条件。
+type requestMeta struct {
+	Temperature *float64 `json:"temperature,omitempty"` // 温度
+	TopP        *float64 `json:"topp,omitempty"`        // TopP
+	TopK        *int64   `json:"topk,omitempty"`        // TopK
+	MaxTokens   int64    `json:"max-tokens,omitempty"`  // 最大令牌数
+	Stop        []string `json:"stop,omitempty"`        // 停止序列
+	Role        string   `json:"role,omitempty"`        // 角色
+	Format      bool     `json:"format,omitempty"`      // 是否格式化
+	FormatAs    string   `json:"format-as,omitempty"`   // 格式化为
+	Truncated   bool     `json:"truncated,omitempty"`   // 回答在生成中途被中断
+}
+
+// newRequestMeta 从配置中提取请求参数
+// cfg: 配置
+// 返回：请求参数元数据
+func newRequestMeta(cfg *Config) requestMeta {
+	meta := requestMeta{
+		Temperature: ptrOrNil(cfg.Temperature),
+		TopP:        ptrOrNil(cfg.TopP),
+		TopK:        ptrOrNil(cfg.TopK),
+		MaxTokens:   cfg.MaxTokens,
+		Stop:        cfg.Stop,
+		Role:        cfg.Role,
+		Format:      cfg.Format,
+	}
+	if cfg.Format {
+		meta.FormatAs = cfg.FormatAs
+	}
+	return meta
+}
+
+// encodeRequestMeta 将请求参数编码为 JSON 字符串
+func encodeRequestMeta(meta requestMeta) (string, error) {
+	bts, err := json.Marshal(meta)
+	if err != nil {
+		return "", fmt.Errorf("无法编码请求参数: %w", err)
+	}
+	return string(bts), nil
+}
+
+// decodeRequestMeta 从 JSON 字符串解码请求参数
+func decodeRequestMeta(s string) (requestMeta, error) {
+	var meta requestMeta
+	if err := json.Unmarshal([]byte(s), &meta); err != nil {
+		return meta, fmt.Errorf("无法解码请求参数: %w", err)
+	}
+	return meta, nil
+}
+
+// String 将请求参数格式化为 markdown 列表
+func (m requestMeta) String() string {
+	var sb strings.Builder
+	sb.WriteString("**参数**:\n\n")
+	if m.Temperature != nil {
+		fmt.Fprintf(&sb, "- temp: `%v`\n", *m.Temperature)
+	}
+	if m.TopP != nil {
+		fmt.Fprintf(&sb, "- topp: `%v`\n", *m.TopP)
+	}
+	if m.TopK != nil {
+		fmt.Fprintf(&sb, "- topk: `%v`\n", *m.TopK)
+	}
+	if m.MaxTokens > 0 {
+		fmt.Fprintf(&sb, "- max-tokens: `%d`\n", m.MaxTokens)
+	}
+	if len(m.Stop) > 0 {
+		fmt.Fprintf(&sb, "- stop: `%s`\n", strings.Join(m.Stop, "`, `"))
+	}
+	if m.Role != "" {
+		fmt.Fprintf(&sb, "- role: `%s`\n", m.Role)
+	}
+	if m.Format {
+		fmt.Fprintf(&sb, "- format-as: `%s`\n", m.FormatAs)
+	}
+	if m.Truncated {
+		sb.WriteString("- truncated: 回答在生成中途被中断\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
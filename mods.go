@@ -1,17 +1,15 @@
 package main
 
 import (
-	"bufio"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"maps"
 	"math"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"regexp"
 	"slices"
 	"strconv"
@@ -20,18 +18,20 @@ import (
 	"time"
 	"unicode"
 
-	"github.com/caarlos0/go-shellwords"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/mods/internal/anthropic"
+	"github.com/charmbracelet/mods/internal/bedrock"
 	"github.com/charmbracelet/mods/internal/cache"
 	"github.com/charmbracelet/mods/internal/cohere"
 	"github.com/charmbracelet/mods/internal/google"
 	"github.com/charmbracelet/mods/internal/ollama"
 	"github.com/charmbracelet/mods/internal/openai"
 	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/rag"
 	"github.com/charmbracelet/mods/internal/stream"
 	"github.com/charmbracelet/x/exp/ordered"
 )
@@ -47,8 +47,12 @@ const (
 	responseState           // 响应状态
 	doneState               // 完成状态
 	errorState              // 错误状态
+	chatInputState          // 聊天模式等待输入状态
 )
 
+// chatInputHeight 聊天模式下为输入框与状态行预留的高度
+const chatInputHeight = 5
+
 // Mods 是 Bubble Tea 模型，负责管理标准输入读取和 OpenAI API 查询
 type Mods struct {
 	Output        string              // 输出内容
@@ -57,13 +61,36 @@ type Mods struct {
 	Error         *modsError          // 错误信息
 	state         state               // 当前状态
 	retries       int                 // 重试次数
+	retryStart    time.Time           // 第一次重试的时间，用于计算重试预算
+	fallbacks     int                 // 已经用过的 fallback-apis 项数
+	argsRetried   bool                // 是否已经让模型重新生成过无效的工具参数
+	toolGuard     toolGuard           // 本次回答的工具调用轮数和重复调用
+	followingUp   bool                // 是否在已有对话上发送后续提示（--exec、--critic）
+	interrupted   bool                // 回答中途被 ctrl+c 中断
+	reasoning     bool                // 是否正在输出思考内容
+	reasoningLine string              // --show-reasoning 尚未换行的思考内容
+	progress      string              // 最近一次以纯文本输出的进度
+	ttyProgress   *ttyProgress        // 写到 /dev/tty 的进度，未启用时为 nil
+	samples       chan sampleResult   // --samples 额外采样的结果，未启用时为 nil
+	nativeSamples bool                // 是否在等待用 n 参数一次生成的样本
+	otherSamples  []string            // --keep-all 保留的没有选中的回答
+	ragSources    []rag.Result        // --rag 检索到并加到提示中的片段
+	mcpContext    *mcpContext         // --mcp-prompt 和 --mcp-resource 取得的上下文，未读取时为 nil
+	pending       []string            // --throttle 等待输出的令牌
+	throttling    bool                // 是否正在按速率输出
+	throttledEnd  *completionOutput   // 等待节流输出完成后处理的结束消息
+	tokens        tokenizer           // 切分节流输出使用的词表
 	renderer      *lipgloss.Renderer  // 渲染器
 	glam          *glamour.TermRenderer // Glamour 终端渲染器
 	glamViewport  viewport.Model      // 视口模型
 	glamOutput    string              // Glamour 输出内容
 	glamHeight    int                 // Glamour 输出高度
 	messages      []proto.Message     // 消息列表
+	trimmed       []proto.Message     // 超出输入上限而没有发送的历史消息
+	trimmedAt     int                 // trimmed 在对话中的位置
 	cancelRequest []context.CancelFunc // 取消请求函数列表
+	cancelMu      *sync.Mutex          // 保护 cancelRequest，并发的工具调用会同时添加
+	program       *tea.Program        // 运行中的程序，确认工具调用时暂停界面
 	anim          tea.Model           // 动画模型
 	width         int                 // 宽度
 	height        int                 // 高度
@@ -75,6 +102,13 @@ type Mods struct {
 	content      []string     // 内容列表
 	contentMutex *sync.Mutex  // 内容互斥锁
 
+	chatInput  textarea.Model // 聊天模式输入框
+	chatStatus string         // 聊天模式状态行
+
+	model        Model       // 最近一次请求使用的模型
+	usage        proto.Usage // 本次运行累计的令牌用量
+	unsavedUsage proto.Usage // 尚未写入数据库的令牌用量
+
 	ctx context.Context // 上下文
 }
 
@@ -86,7 +120,7 @@ func newMods(
 	cache *cache.Conversations,
 ) *Mods {
 	gr, _ := glamour.NewTermRenderer(
-		glamour.WithEnvironmentConfig(),
+		glamourStyle(),
 		glamour.WithWordWrap(cfg.WordWrap),
 	)
 	vp := viewport.New(0, 0)
@@ -98,9 +132,11 @@ func newMods(
 		renderer:     r,
 		glamViewport: vp,
 		contentMutex: &sync.Mutex{},
+		cancelMu:     &sync.Mutex{},
 		db:           db,
 		cache:        cache,
 		Config:       cfg,
+		chatInput:    newChatInput(),
 		ctx:          ctx,
 	}
 }
@@ -112,9 +148,10 @@ type completionInput struct {
 
 // completionOutput 是一个 tea.Msg，封装了从 OpenAI 返回的内容
 type completionOutput struct {
-	content string
-	stream  stream.Stream
-	errh    func(error) tea.Msg
+	content   string
+	reasoning string
+	stream    stream.Stream
+	errh      func(error) tea.Msg
 }
 
 // Init 实现 tea.Model 接口，初始化模型
@@ -133,8 +170,8 @@ func (m *Mods) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.Config.API = msg.API
 		m.Config.Model = msg.Model
 
-		if !m.Config.Quiet {
-			m.anim = newAnim(m.Config.Fanciness, m.Config.StatusText, m.renderer, m.Styles)
+		if m.showAnim() {
+			m.anim = m.newStatusAnim()
 			cmds = append(cmds, m.anim.Init())
 		}
 		m.state = configLoadedState
@@ -146,15 +183,21 @@ func (m *Mods) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.Input = removeWhitespace(msg.content)
 		}
 		// 检查是否有有效的输入或配置
-		if m.Input == "" && m.Config.Prefix == "" && m.Config.Show == "" && !m.Config.ShowLast {
+		if m.Input == "" && m.Config.Prefix == "" && m.Config.Show == "" && !m.Config.ShowLast && !m.Config.Regenerate &&
+			m.Config.MCPPrompt == "" {
+			if m.Config.Chat {
+				return m, m.startChatInput()
+			}
 			return m, m.quit
 		}
 		// 检查是否需要显示帮助或配置信息
 		if m.Config.Dirs ||
+			m.Config.DU ||
 			len(m.Config.Delete) > 0 ||
 			m.Config.DeleteOlderThan != 0 ||
 			m.Config.ShowHelp ||
 			m.Config.List ||
+			m.Config.ListJSON ||
 			m.Config.ListRoles ||
 			m.Config.Settings ||
 			m.Config.ResetSettings {
@@ -175,21 +218,52 @@ func (m *Mods) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.appendToOutput(strings.Join(parts, "\n") + "\n")
 		}
 		m.state = requestState
-		cmds = append(cmds, m.startCompletionCmd(msg.content))
+		cmds = append(cmds, m.startCompletionCmd(msg.content), m.requestProgress())
 	case completionOutput:
 		// 处理补全输出消息
 		if msg.stream == nil {
+			// 等待节流的令牌全部输出后再结束
+			if m.throttling {
+				m.throttledEnd = &msg
+				return m, nil
+			}
+			if msg.content != "" {
+				m.appendToOutput(msg.content)
+			}
+			if m.Config.Chat && m.Config.Show == "" && !m.Config.ShowLast {
+				return m, m.startChatInput()
+			}
 			m.state = doneState
 			return m, m.quit
 		}
+		if msg.reasoning != "" {
+			cmds = append(cmds, m.printProgress("模型正在思考…"))
+		}
+		switch {
+		case msg.reasoning != "" && m.Config.ShowReasoning:
+			cmds = append(cmds, m.streamReasoning(msg.reasoning))
+		case msg.reasoning != "" && m.showReasoning():
+			m.appendReasoning(msg.reasoning)
+			m.state = responseState
+		}
 		if msg.content != "" {
-			m.appendToOutput(msg.content)
+			cmds = append(cmds, m.printProgress("正在接收回答…"), m.endReasoning())
+			if m.throttled() {
+				cmds = append(cmds, m.throttle(msg.content))
+			} else {
+				m.appendToOutput(msg.content)
+			}
 			m.state = responseState
 		}
 		cmds = append(cmds, m.receiveCompletionStreamCmd(completionOutput{
 			stream: msg.stream,
 			errh:   msg.errh,
 		}))
+	case throttleTickMsg:
+		return m.releaseThrottled()
+	case chatSubmitMsg:
+		// 处理聊天模式下提交的输入
+		return m, m.submitChat(msg.prompt)
 	case modsError:
 		// 处理错误消息
 		m.Error = &msg
@@ -200,17 +274,25 @@ func (m *Mods) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.width, m.height = msg.Width, msg.Height
 		m.glamViewport.Width = m.width
 		m.glamViewport.Height = m.height
+		if m.Config.Chat {
+			m.glamViewport.Height = max(m.height-chatInputHeight, 1)
+			m.chatInput.SetWidth(m.width)
+		}
 		return m, nil
 	case tea.KeyMsg:
 		// 处理按键消息
+		if m.state == chatInputState {
+			return m.updateChatInput(msg)
+		}
 		switch msg.String() {
 		case "q", "ctrl+c":
+			m.interrupted = m.answering()
 			m.state = doneState
 			return m, m.quit
 		}
 	}
-	// 如果不是静默模式且处于配置加载或请求状态，更新动画
-	if !m.Config.Quiet && (m.state == configLoadedState || m.state == requestState) {
+	// 如果显示动画且处于配置加载或请求状态，更新动画
+	if m.showAnim() && (m.state == configLoadedState || m.state == requestState) {
 		var cmd tea.Cmd
 		m.anim, cmd = m.anim.Update(msg)
 		cmds = append(cmds, cmd)
@@ -226,7 +308,7 @@ func (m *Mods) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 // viewportNeeded 检查是否需要视口（当内容高度超过窗口高度时）
 func (m Mods) viewportNeeded() bool {
-	return m.glamHeight > m.height
+	return m.glamHeight > m.glamViewport.Height
 }
 
 // View 实现 tea.Model 接口，渲染视图
@@ -237,11 +319,23 @@ func (m *Mods) View() string {
 		return ""
 	case requestState:
 		// 请求状态下显示动画
-		if !m.Config.Quiet {
+		if m.Config.Chat && m.Output != "" {
+			if !m.showAnim() {
+				return m.chatView("")
+			}
+			return m.chatView(m.anim.View())
+		}
+		if m.showAnim() {
 			return m.anim.View()
 		}
+	case chatInputState:
+		// 聊天模式下显示对话记录与输入框
+		return m.chatView(m.chatInput.View())
 	case responseState:
 		// 响应状态下渲染输出
+		if m.Config.Chat && !m.Config.Raw && isOutputTTY() {
+			return m.chatView("")
+		}
 		if !m.Config.Raw && isOutputTTY() {
 			if m.viewportNeeded() {
 				return m.glamViewport.View()
@@ -263,7 +357,7 @@ func (m *Mods) View() string {
 		m.contentMutex.Unlock()
 	case doneState:
 		// 完成状态
-		if !isOutputTTY() {
+		if !isOutputTTY() && !m.bufferOutput() {
 			fmt.Printf("\n")
 		}
 		return ""
@@ -273,26 +367,82 @@ func (m *Mods) View() string {
 
 // quit 退出应用程序
 func (m *Mods) quit() tea.Msg {
-	// 取消所有正在进行的请求
+	m.cancelRequests()
+	return tea.Quit()
+}
+
+// answering 判断是否正在等待或接收回答
+func (m *Mods) answering() bool {
+	return m.state == requestState || m.state == responseState
+}
+
+// cancelRequests 取消所有正在进行的请求
+func (m *Mods) cancelRequests() {
+	m.cancelMu.Lock()
 	for _, cancel := range m.cancelRequest {
 		cancel()
 	}
-	return tea.Quit()
+	m.cancelMu.Unlock()
+}
+
+// addCancel 记录取消函数，退出时取消所有正在进行的请求和工具调用
+func (m *Mods) addCancel(cancel context.CancelFunc) {
+	m.cancelMu.Lock()
+	m.cancelRequest = append(m.cancelRequest, cancel)
+	m.cancelMu.Unlock()
 }
 
 // retry 重试补全请求
 func (m *Mods) retry(content string, err modsError) tea.Msg {
+	return m.retryAfter(content, err, 0)
+}
+
+// retryAfter 重试补全请求，serverWait 大于 0 时按服务器通过响应头要求的时间等待，而不是指数退避
+// content: 请求内容
+// err: 放弃重试时返回的错误
+// serverWait: 服务器要求的等待时间，0 表示没有要求
+// 返回：重新开始请求的消息或错误
+func (m *Mods) retryAfter(content string, err modsError, serverWait time.Duration) tea.Msg {
+	if m.retries == 0 {
+		m.retryStart = time.Now()
+	}
 	m.retries++
 	// 检查是否达到最大重试次数
 	if m.retries >= m.Config.MaxRetries {
 		return err
 	}
-	// 指数退避等待
-	wait := time.Millisecond * 100 * time.Duration(math.Pow(2, float64(m.retries))) //nolint:mnd
+	// 指数退避等待，等待后会超出总预算时直接放弃
+	wait := retryWait(m.retries, m.Config.RetryMaxWait)
+	if serverWait > 0 {
+		// 等待时间超过上限时，提前重试也只会再次被限流
+		if maxWait := m.Config.RetryMaxWait; maxWait > 0 && serverWait > maxWait {
+			err.reason += fmt.Sprintf("服务器要求 %s 后重试，超过了 retry-max-wait。", serverWait.Round(time.Second))
+			return err
+		}
+		wait = serverWait
+	}
+	if budget := m.Config.RetryBudget; budget > 0 && time.Since(m.retryStart)+wait > budget {
+		return err
+	}
 	time.Sleep(wait)
 	return completionInput{content}
 }
 
+// retryWait 返回第 n 次重试前的等待时间
+// n: 重试次数，从 1 开始
+// maxWait: 单次等待的上限，为 0 时不设上限
+// 返回：从 200 毫秒起按 2 的幂增长、不超过上限的等待时间
+func retryWait(n int, maxWait time.Duration) time.Duration {
+	wait := float64(100*time.Millisecond) * math.Pow(2, float64(n)) //nolint:mnd
+	if maxWait > 0 && wait > float64(maxWait) {
+		return maxWait
+	}
+	if wait > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(wait)
+}
+
 // startCompletionCmd 启动补全请求命令
 func (m *Mods) startCompletionCmd(content string) tea.Cmd {
 	// 如果配置了显示或显示最后，从缓存读取
@@ -303,11 +453,6 @@ func (m *Mods) startCompletionCmd(content string) tea.Cmd {
 	return func() tea.Msg {
 		var mod Model
 		var api API
-		var ccfg openai.Config
-		var accfg anthropic.Config
-		var cccfg cohere.Config
-		var occfg ollama.Config
-		var gccfg google.Config
 
 		cfg := m.Config
 		// 解析模型配置
@@ -334,81 +479,16 @@ func (m *Mods) startCompletionCmd(content string) tea.Cmd {
 			}
 		}
 
-		// 根据不同的 API 类型配置客户端
-		switch mod.API {
-		case "ollama":
-			occfg = ollama.DefaultConfig()
-			if api.BaseURL != "" {
-				occfg.BaseURL = api.BaseURL
-			}
-		case "anthropic":
-			key, err := m.ensureKey(api, "ANTHROPIC_API_KEY", "https://console.anthropic.com/settings/keys")
-			if err != nil {
-				return modsError{err, "Anthropic 认证失败"}
-			}
-			accfg = anthropic.DefaultConfig(key)
-			if api.BaseURL != "" {
-				accfg.BaseURL = api.BaseURL
-			}
-		case "google":
-			key, err := m.ensureKey(api, "GOOGLE_API_KEY", "https://aistudio.google.com/app/apikey")
-			if err != nil {
-				return modsError{err, "Google 认证失败"}
-			}
-			gccfg = google.DefaultConfig(mod.Name, key)
-			gccfg.ThinkingBudget = mod.ThinkingBudget
-		case "cohere":
-			key, err := m.ensureKey(api, "COHERE_API_KEY", "https://dashboard.cohere.com/api-keys")
-			if err != nil {
-				return modsError{err, "Cohere 认证失败"}
-			}
-			cccfg = cohere.DefaultConfig(key)
-			if api.BaseURL != "" {
-				ccfg.BaseURL = api.BaseURL
-			}
-		case "azure", "azure-ad": //nolint:goconst
-			key, err := m.ensureKey(api, "AZURE_OPENAI_KEY", "https://aka.ms/oai/access")
-			if err != nil {
-				return modsError{err, "Azure 认证失败"}
-			}
-			ccfg = openai.Config{
-				AuthToken: key,
-				BaseURL:   api.BaseURL,
-			}
-			if mod.API == "azure-ad" {
-				ccfg.APIType = "azure-ad"
-			}
-			if api.User != "" {
-				cfg.User = api.User
-			}
-		default:
-			key, err := m.ensureKey(api, "OPENAI_API_KEY", "https://platform.openai.com/account/api-keys")
-			if err != nil {
-				return modsError{err, "OpenAI 认证失败"}
-			}
-			ccfg = openai.Config{
-				AuthToken: key,
-				BaseURL:   api.BaseURL,
-			}
-		}
-
-		// 配置 HTTP 代理
-		if cfg.HTTPProxy != "" {
-			proxyURL, err := url.Parse(cfg.HTTPProxy)
-			if err != nil {
-				return modsError{err, "解析代理 URL 时出错。"}
-			}
-			httpClient := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
-			ccfg.HTTPClient = httpClient
-			accfg.HTTPClient = httpClient
-			cccfg.HTTPClient = httpClient
-			occfg.HTTPClient = httpClient
+		client, err := m.newClient(cfg, api, mod)
+		if err != nil {
+			return err
 		}
 
 		// 设置最大字符数
 		if mod.MaxChars == 0 {
 			mod.MaxChars = cfg.MaxInputChars
 		}
+		m.model = mod
 
 		// 检查模型是否为 o1 模型，并相应地取消设置 max_tokens 参数，
 		// 因为 o1 不支持该参数。
@@ -418,9 +498,9 @@ func (m *Mods) startCompletionCmd(content string) tea.Cmd {
 			cfg.MaxTokens = 0
 		}
 
-		// 创建带超时的上下文
-		ctx, cancel := context.WithTimeout(m.ctx, config.MCPTimeout)
-		m.cancelRequest = append(m.cancelRequest, cancel)
+		// 创建可取消的上下文，每个 MCP 服务器使用各自的超时
+		ctx, cancel := context.WithCancel(m.ctx)
+		m.addCancel(cancel)
 
 		// 获取 MCP 工具
 		tools, err := mcpTools(ctx)
@@ -428,54 +508,98 @@ func (m *Mods) startCompletionCmd(content string) tea.Cmd {
 			return err
 		}
 
+		// 读取 --mcp-prompt 和 --mcp-resource 指定的内容
+		if err := m.loadMCPContext(ctx); err != nil {
+			return err
+		}
+
 		// 设置流上下文
 		if err := m.setupStreamContext(content, mod); err != nil {
 			return err
 		}
 
+		// 配置了 --rag 时检索资料放在问题前面
+		if err := m.addRAGContext(ctx); err != nil {
+			return err
+		}
+
+		// 配置了压缩模型时，先把超出上限的最早轮次替换为摘要
+		if err := m.compactMessages(ctx, mod); err != nil {
+			return err
+		}
+
+		// 按令牌数让消息适应模型的输入上限，没有发送的历史在回答后放回对话
+		messages := m.messages
+		m.trimmed = nil
+		if !cfg.NoLimit {
+			var dropped int
+			messages, dropped, err = fitMessages(m.messages, mod)
+			if err != nil {
+				return modsError{err, "无法统计令牌数。"}
+			}
+			at := systemPrefix(m.messages)
+			m.trimmed, m.trimmedAt = slices.Clone(m.messages[at:at+dropped]), at
+		}
+		messages = promptCacheHints(
+			messages,
+			cfg.PromptCache || slices.Contains(cfg.CacheRoles, cfg.Role),
+			cfg.PromptCache,
+		)
+
+		keepAlive, err := parseKeepAlive(cmp.Or(cfg.KeepAlive, mod.KeepAlive))
+		if err != nil {
+			return modsError{err, "keep-alive 的格式不正确。"}
+		}
+
 		// 构建请求
 		request := proto.Request{
-			Messages:    m.messages,
-			API:         mod.API,
-			Model:       mod.Name,
-			User:        cfg.User,
-			Temperature: ptrOrNil(cfg.Temperature),
-			TopP:        ptrOrNil(cfg.TopP),
-			TopK:        ptrOrNil(cfg.TopK),
-			Stop:        cfg.Stop,
-			Tools:       tools,
+			Messages:        messages,
+			API:             mod.API,
+			Model:           mod.Name,
+			User:            cfg.User,
+			Temperature:     ptrOrNil(cfg.Temperature),
+			TopP:            ptrOrNil(cfg.TopP),
+			TopK:            ptrOrNil(cfg.TopK),
+			Stop:            cfg.Stop,
+			Tools:           tools,
+			SearchDomains:   cfg.SearchDomains,
+			SearchRecency:   cfg.SearchRecency,
+			SafePrompt:      cfg.SafePrompt,
+			KeepAlive:       keepAlive,
+			Options:         ollamaOptions(cfg, mod),
+			ThinkingBudget:  mod.ThinkingBudget,
+			ReasoningEffort: mod.ReasoningEffort,
 			ToolCaller: func(name string, data []byte) (string, error) {
-				ctx, cancel := context.WithTimeout(m.ctx, config.MCPTimeout)
-				m.cancelRequest = append(m.cancelRequest, cancel)
-				return toolCall(ctx, name, data)
+				ctx, cancel := context.WithCancel(m.ctx)
+				m.addCancel(cancel)
+				return m.callTool(ctx, name, data)
 			},
 		}
 		if cfg.MaxTokens > 0 {
 			request.MaxTokens = &cfg.MaxTokens
 		}
 
-		var client stream.Client
-		switch mod.API {
-		case "anthropic":
-			client = anthropic.New(accfg)
-		case "google":
-			client = google.New(gccfg)
-		case "cohere":
-			client = cohere.New(cccfg)
-		case "ollama":
-			client, err = ollama.New(occfg)
-		default:
-			client = openai.New(ccfg)
-			if cfg.Format && config.FormatAs == "json" {
-				request.ResponseFormat = &config.FormatAs
-			}
+		if _, ok := client.(*openai.Client); ok && cfg.Format && config.FormatAs == "json" {
+			request.ResponseFormat = &config.FormatAs
 		}
-		if err != nil {
-			return modsError{err, "无法设置客户端"}
+
+		// 只在第一次请求时采样，后续提示不再采样。没有工具时，OpenAI、Azure 和开启了
+		// supports-n 的 OpenAI 兼容 API 用 n 参数一次生成所有样本，其他 API 并发发送相同的请求
+		switch {
+		case m.nativeSamples:
+			// 重试时仍然一次生成所有样本
+			request.N = int64(cfg.Samples)
+		case cfg.Samples > 1 && m.samples == nil && len(tools) == 0 && supportsN(api, client):
+			m.nativeSamples = true
+			m.samples = make(chan sampleResult, cfg.Samples-1)
+			request.N = int64(cfg.Samples)
+		case cfg.Samples > 1 && m.samples == nil:
+			m.startSamples(client, request)
 		}
 
 		// 发起请求并返回流
-		stream := client.Request(m.ctx, request)
+		requestCtx := m.requestContext(&request)
+		stream := client.Request(requestCtx, request)
 		return m.receiveCompletionStreamCmd(completionOutput{
 			stream: stream,
 			errh: func(err error) tea.Msg {
@@ -485,24 +609,241 @@ func (m *Mods) startCompletionCmd(content string) tea.Cmd {
 	}
 }
 
+// compatibleAPIs 是内置的 OpenAI 兼容 API 默认读取的密钥环境变量和获取密钥的地址
+var compatibleAPIs = map[string]struct{ env, docs string }{
+	"deepseek": {"DEEPSEEK_API_KEY", "https://platform.deepseek.com/api_keys"},
+	"xai":      {"XAI_API_KEY", "https://console.x.ai"},
+	"groq":     {"GROQ_API_KEY", "https://console.groq.com/keys"},
+	"cerebras": {"CEREBRAS_API_KEY", "https://cloud.cerebras.ai"},
+}
+
+// streamUsage 判断是否请求 API 在流末尾返回令牌用量。OpenAI 和 Azure 默认开启，
+// 其他 OpenAI 兼容的 API 可能拒绝 stream_options，需要在设置中用 stream-usage 开启
+// api: API 配置
+func streamUsage(api API) bool {
+	if api.StreamUsage != nil {
+		return *api.StreamUsage
+	}
+	switch api.Name {
+	case "openai", "azure", "azure-ad":
+		return true
+	}
+	return false
+}
+
+// newClient 按 API 类型创建流式客户端，并配置代理、请求记录和请求体大小限制
+// cfg: 配置信息
+// api: API 配置
+// mod: 模型配置
+// 返回：客户端和错误信息
+func (m *Mods) newClient(cfg *Config, api API, mod Model) (stream.Client, error) {
+	var ccfg openai.Config
+	var accfg anthropic.Config
+	var cccfg cohere.Config
+	var occfg ollama.Config
+	var gccfg google.Config
+	var bccfg bedrock.Config
+
+	// 根据不同的 API 类型配置客户端
+	switch mod.API {
+	case "ollama":
+		occfg = ollama.DefaultConfig()
+		if api.BaseURL != "" {
+			occfg.BaseURL = api.BaseURL
+		}
+	case "anthropic":
+		key, err := m.ensureKey(api, "ANTHROPIC_API_KEY", "https://console.anthropic.com/settings/keys")
+		if err != nil {
+			return nil, modsError{err, "Anthropic 认证失败"}
+		}
+		accfg = anthropic.DefaultConfig(key)
+		if api.BaseURL != "" {
+			accfg.BaseURL = api.BaseURL
+		}
+	case "google":
+		key, err := m.ensureKey(api, "GOOGLE_API_KEY", "https://aistudio.google.com/app/apikey")
+		if err != nil {
+			return nil, modsError{err, "Google 认证失败"}
+		}
+		gccfg = google.DefaultConfig(mod.Name, key)
+	case "vertex":
+		// 凭证由 Google 应用默认凭据提供，无需 API 密钥
+		var err error
+		gccfg, err = google.VertexConfig(m.ctx, mod.Name, api.Project, api.Region)
+		if err != nil {
+			return nil, modsError{err, "Vertex AI 认证失败"}
+		}
+	case "bedrock":
+		// 凭证由 AWS 默认配置链提供，无需 API 密钥
+		bccfg = bedrock.DefaultConfig(api.Region)
+		bccfg.BaseURL = api.BaseURL
+	case "cohere":
+		key, err := m.ensureKey(api, "COHERE_API_KEY", "https://dashboard.cohere.com/api-keys")
+		if err != nil {
+			return nil, modsError{err, "Cohere 认证失败"}
+		}
+		cccfg = cohere.DefaultConfig(key)
+		if api.BaseURL != "" {
+			ccfg.BaseURL = api.BaseURL
+		}
+	case "mistral":
+		key, err := m.ensureKey(api, "MISTRAL_API_KEY", "https://console.mistral.ai/api-keys")
+		if err != nil {
+			return nil, modsError{err, "Mistral 认证失败"}
+		}
+		ccfg = openai.Config{
+			AuthToken:   key,
+			BaseURL:     cmp.Or(api.BaseURL, "https://api.mistral.ai/v1"),
+			QueryParams: api.QueryParams,
+		}
+	case "deepseek", "xai", "groq", "cerebras":
+		preset := compatibleAPIs[mod.API]
+		key, err := m.ensureKey(api, preset.env, preset.docs)
+		if err != nil {
+			return nil, modsError{err, fmt.Sprintf("%s 认证失败", mod.API)}
+		}
+		ccfg = openai.Config{
+			AuthToken:   key,
+			BaseURL:     api.BaseURL,
+			QueryParams: api.QueryParams,
+		}
+	case "azure", "azure-ad": //nolint:goconst
+		key, err := m.ensureKey(api, "AZURE_OPENAI_KEY", "https://aka.ms/oai/access")
+		if err != nil {
+			return nil, modsError{err, "Azure 认证失败"}
+		}
+		ccfg = openai.Config{
+			AuthToken:   key,
+			BaseURL:     api.BaseURL,
+			QueryParams: api.QueryParams,
+		}
+		if mod.API == "azure-ad" {
+			ccfg.APIType = "azure-ad"
+		}
+		if api.User != "" {
+			cfg.User = api.User
+		}
+	default:
+		key, err := m.ensureKey(api, "OPENAI_API_KEY", "https://platform.openai.com/account/api-keys")
+		if err != nil {
+			return nil, modsError{err, "OpenAI 认证失败"}
+		}
+		ccfg = openai.Config{
+			AuthToken:   key,
+			BaseURL:     api.BaseURL,
+			QueryParams: api.QueryParams,
+		}
+		if api.Provider != nil {
+			ccfg.ExtraBody = map[string]any{"provider": api.Provider}
+		}
+	}
+
+	ccfg.StreamUsage = streamUsage(api)
+
+	// 配置 HTTP 代理
+	if cfg.HTTPProxy != "" {
+		proxyURL, err := url.Parse(cfg.HTTPProxy)
+		if err != nil {
+			return nil, modsError{err, "解析代理 URL 时出错。"}
+		}
+		httpClient := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		ccfg.HTTPClient = httpClient
+		accfg.HTTPClient = httpClient
+		cccfg.HTTPClient = httpClient
+		occfg.HTTPClient = httpClient
+		bccfg.HTTPClient = httpClient
+		gccfg.HTTPClient = httpClient
+	}
+
+	// 为请求体签名（企业网关），在记录和大小检查之后执行
+	if api.SignCmd != "" || api.HMAC != nil {
+		hc, _ := ccfg.HTTPClient.(*http.Client)
+		signed, err := signRequests(hc, api)
+		if err != nil {
+			return nil, err
+		}
+		ccfg.HTTPClient = signed
+		accfg.HTTPClient = signed
+		cccfg.HTTPClient = signed
+		occfg.HTTPClient = signed
+		gccfg.HTTPClient = signed
+		// Bedrock 在 SigV4 签名之后执行钩子，附加的请求头不影响 AWS 签名
+		sign, err := requestSigner(api)
+		if err != nil {
+			return nil, err
+		}
+		bccfg.RequestHooks = append(bccfg.RequestHooks, sign)
+	}
+
+	// 记录发送给 API 的请求
+	if cfg.SaveRequest != "" {
+		rec := &requestRecorder{path: cfg.SaveRequest, api: mod.API, model: mod.Name}
+		hc, _ := ccfg.HTTPClient.(*http.Client)
+		ccfg.HTTPClient = rec.client(hc)
+		accfg.HTTPClient = rec.client(accfg.HTTPClient)
+		cccfg.HTTPClient = rec.client(cccfg.HTTPClient)
+		occfg.HTTPClient = rec.client(occfg.HTTPClient)
+		gccfg.HTTPClient = rec.client(gccfg.HTTPClient)
+		// 与其他客户端一样，先记录再签名
+		bccfg.RequestHooks = append([]func(*http.Request) error{rec.record}, bccfg.RequestHooks...)
+	}
+
+	// 在上传前拒绝过大的请求体
+	if cfg.MaxRequestSize > 0 {
+		hc, _ := ccfg.HTTPClient.(*http.Client)
+		ccfg.HTTPClient = limitRequestSize(hc, cfg.MaxRequestSize)
+		accfg.HTTPClient = limitRequestSize(accfg.HTTPClient, cfg.MaxRequestSize)
+		cccfg.HTTPClient = limitRequestSize(cccfg.HTTPClient, cfg.MaxRequestSize)
+		occfg.HTTPClient = limitRequestSize(occfg.HTTPClient, cfg.MaxRequestSize)
+		gccfg.HTTPClient = limitRequestSize(gccfg.HTTPClient, cfg.MaxRequestSize)
+		// 与其他客户端一样，先检查大小再记录
+		bccfg.RequestHooks = append([]func(*http.Request) error{checkRequestSize(cfg.MaxRequestSize)}, bccfg.RequestHooks...)
+	}
+
+	var client stream.Client
+	var err error
+	switch mod.API {
+	case "anthropic":
+		client = anthropic.New(accfg)
+	case "google", "vertex":
+		client = google.New(gccfg)
+	case "cohere":
+		client = cohere.New(cccfg)
+	case "ollama":
+		client, err = ollama.New(occfg)
+	case "bedrock":
+		client, err = bedrock.New(bccfg)
+	default:
+		client = openai.New(ccfg)
+	}
+	if err != nil {
+		return nil, modsError{err, "无法设置客户端"}
+	}
+	return client, nil
+}
+
 // ensureKey 确保 API 密钥可用
 func (m Mods) ensureKey(api API, defaultEnv, docsURL string) (string, error) {
 	key := api.APIKey
+	// 如果密钥为空且配置了密钥文件，从文件读取
+	if key == "" && api.APIKeyFile != "" {
+		fileKey, err := readAPIKeyFile(api.APIKeyFile)
+		if err != nil {
+			return "", err
+		}
+		key = fileKey
+	}
 	// 如果密钥为空且配置了环境变量，从环境变量获取
 	if key == "" && api.APIKeyEnv != "" && api.APIKeyCmd == "" {
 		key = os.Getenv(api.APIKeyEnv)
 	}
 	// 如果密钥为空且配置了命令，执行命令获取
 	if key == "" && api.APIKeyCmd != "" {
-		args, err := shellwords.Parse(api.APIKeyCmd)
-		if err != nil {
-			return "", modsError{err, "解析 api-key-cmd 失败"}
-		}
-		out, err := exec.Command(args[0], args[1:]...).CombinedOutput() //nolint:gosec
+		cmdKey, err := runAPIKeyCmd(api.APIKeyCmd)
 		if err != nil {
-			return "", modsError{err, "无法执行 api-key-cmd"}
+			return "", err
 		}
-		key = strings.TrimSpace(string(out))
+		key = cmdKey
 	}
 	// 如果密钥为空，从默认环境变量获取
 	if key == "" {
@@ -537,9 +878,10 @@ func (m *Mods) receiveCompletionStreamCmd(msg completionOutput) tea.Cmd {
 				return msg.errh(err)
 			}
 			return completionOutput{
-				content: chunk.Content,
-				stream:  msg.stream,
-				errh:    msg.errh,
+				content:   chunk.Content,
+				reasoning: chunk.Reasoning,
+				stream:    msg.stream,
+				errh:      msg.errh,
 			}
 		}
 
@@ -550,6 +892,27 @@ func (m *Mods) receiveCompletionStreamCmd(msg completionOutput) tea.Cmd {
 
 		// 调用工具并处理结果
 		results := msg.stream.CallTools()
+		if err := invalidArguments(results); err != nil {
+			// 参数无法修复时错误已回传给模型，只允许它重新生成一次
+			if m.argsRetried {
+				_ = msg.stream.Close()
+				return modsError{err, "模型生成的工具参数无效。"}
+			}
+			m.argsRetried = true
+		}
+		if err := m.toolGuard.check(m.Config.MaxToolRounds, msg.stream.Messages(), len(results)); err != nil {
+			_ = msg.stream.Close()
+			return err
+		}
+		if m.Config.ToolOutputOnly && len(results) > 0 {
+			// 直接输出最后一个工具结果，省去让模型复述的一次往返
+			m.addUsage(msg.stream.Usage())
+			m.messages = m.restoreTrimmed(msg.stream.Messages())
+			return completionOutput{
+				content: lastToolOutput(m.messages),
+				errh:    msg.errh,
+			}
+		}
 		toolMsg := completionOutput{
 			stream: msg.stream,
 			errh:   msg.errh,
@@ -558,7 +921,9 @@ func (m *Mods) receiveCompletionStreamCmd(msg completionOutput) tea.Cmd {
 			toolMsg.content += call.String()
 		}
 		if len(results) == 0 {
-			m.messages = msg.stream.Messages()
+			m.collectAlternatives(msg.stream)
+			m.addUsage(msg.stream.Usage())
+			m.messages = m.restoreTrimmed(msg.stream.Messages())
 			return completionOutput{
 				errh: msg.errh,
 			}
@@ -567,6 +932,16 @@ func (m *Mods) receiveCompletionStreamCmd(msg completionOutput) tea.Cmd {
 	}
 }
 
+// invalidArguments 返回第一个因参数不是有效的 JSON 而失败的工具调用错误
+func invalidArguments(results []proto.ToolCallStatus) error {
+	for _, r := range results {
+		if errors.Is(r.Err, stream.ErrInvalidArguments) {
+			return r.Err
+		}
+	}
+	return nil
+}
+
 // cacheDetailsMsg 缓存详情消息
 type cacheDetailsMsg struct {
 	WriteID, Title, ReadID, API, Model string
@@ -610,7 +985,7 @@ func (m *Mods) findCacheOpsDetails() tea.Cmd {
 			writeID = newConversationID()
 		}
 
-		// 检查写入 ID 是否为 SHA1 格式
+		// 检查写入 ID 是否为对话 ID 格式
 		if !sha1reg.MatchString(writeID) {
 			convo, err := m.db.Find(writeID)
 			if err != nil {
@@ -651,13 +1026,12 @@ func (m *Mods) findReadID(in string) (*Conversation, error) {
 // readStdinCmd 读取标准输入命令
 func (m *Mods) readStdinCmd() tea.Msg {
 	if !isInputTTY() {
-		reader := bufio.NewReader(os.Stdin)
-		stdinBytes, err := io.ReadAll(reader)
+		stdin, err := readStdin(os.Stdin, m.Config.StdinHead, m.Config.StdinTail)
 		if err != nil {
 			return modsError{err, "无法读取标准输入。"}
 		}
 
-		return completionInput{increaseIndent(string(stdinBytes))}
+		return completionInput{increaseIndent(stdin)}
 	}
 	return completionInput{""}
 }
@@ -670,6 +1044,17 @@ func (m *Mods) readFromCache() tea.Cmd {
 			return modsError{err, "加载对话时出错。"}
 		}
 
+		if m.Config.ShowMeta {
+			if convo, err := m.db.Find(m.Config.cacheReadFromID); err == nil && convo.Meta != nil {
+				meta, err := decodeRequestMeta(*convo.Meta)
+				if err != nil {
+					return modsError{err, "加载对话参数时出错。"}
+				}
+				m.appendToOutput(meta.String())
+			}
+		}
+
+		m.messages = messages
 		m.appendToOutput(proto.Conversation(messages).String())
 		return completionOutput{
 			errh: func(err error) tea.Msg {
@@ -681,9 +1066,74 @@ func (m *Mods) readFromCache() tea.Cmd {
 
 const tabWidth = 4
 
+// showReasoning 判断是否显示模型的思考内容。
+// 思考内容只在终端中显示，避免混入管道输出。
+func (m *Mods) showReasoning() bool {
+	return !m.Config.HideReasoning && !m.Config.Raw && isOutputTTY()
+}
+
+// appendReasoning 将思考内容以引用块的形式追加到输出
+func (m *Mods) appendReasoning(s string) {
+	s = strings.ReplaceAll(s, "\n", "\n> ")
+	if !m.reasoning {
+		m.reasoning = true
+		s = "> " + s
+	}
+	m.appendToOutput(s)
+}
+
+// streamReasoning 以暗淡的样式在标准错误上输出思考内容，不混入回答。
+// 终端中由 Bubble Tea 逐行输出到界面上方，否则直接写入标准错误
+func (m *Mods) streamReasoning(s string) tea.Cmd {
+	m.reasoning = true
+	if !isOutputTTY() || m.Config.Raw {
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			if line != "" {
+				lines[i] = m.Styles.Comment.Render(line)
+			}
+		}
+		fmt.Fprint(os.Stderr, strings.Join(lines, "\n"))
+		return nil
+	}
+	lines := strings.Split(m.reasoningLine+s, "\n")
+	m.reasoningLine = lines[len(lines)-1]
+	cmds := make([]tea.Cmd, 0, len(lines)-1)
+	for _, line := range lines[:len(lines)-1] {
+		cmds = append(cmds, tea.Println(m.Styles.Comment.Render(line)))
+	}
+	return tea.Sequence(cmds...)
+}
+
+// endReasoning 结束思考内容：关闭引用块，或输出 --show-reasoning 尚未换行的部分
+func (m *Mods) endReasoning() tea.Cmd {
+	if !m.reasoning {
+		return nil
+	}
+	if m.Config.ShowReasoning {
+		cmd := m.streamReasoning("\n")
+		m.reasoning = false
+		return cmd
+	}
+	m.reasoning = false
+	m.appendToOutput("\n\n")
+	return nil
+}
+
+// bufferOutput 返回是否在结束后统一输出，而不是边接收边输出，
+// 导出模式输出整个对话，提取代码模式只输出代码块，修改文件模式在结束后预览差异，
+// 执行命令模式在结束后展示命令，自评和多次采样模式在选出最终的回答后输出
+func (m *Mods) bufferOutput() bool {
+	return m.Config.ExportFormat != "" || m.Config.ExtractCode != "" || m.Config.Apply != "" || m.Config.Exec ||
+		m.Config.Critic || m.Config.Samples > 1
+}
+
 // appendToOutput 将内容追加到输出
 func (m *Mods) appendToOutput(s string) {
 	m.Output += s
+	if m.bufferOutput() {
+		return
+	}
 	// 如果输出不是 TTY 或为原始模式，直接输出
 	if !isOutputTTY() || m.Config.Raw {
 		m.contentMutex.Lock()
@@ -695,9 +1145,16 @@ func (m *Mods) appendToOutput(s string) {
 	// 渲染 Glamour 输出
 	wasAtBottom := m.glamViewport.ScrollPercent() == 1.0
 	oldHeight := m.glamHeight
-	m.glamOutput, _ = m.glam.Render(m.Output)
+	output := m.Output
+	if !m.Config.NoGuessLang {
+		output = labelCodeFences(output)
+	}
+	m.glamOutput, _ = m.glam.Render(output)
 	m.glamOutput = strings.TrimRightFunc(m.glamOutput, unicode.IsSpace)
 	m.glamOutput = strings.ReplaceAll(m.glamOutput, "\t", strings.Repeat(" ", tabWidth))
+	if (m.Config.Show != "" || m.Config.ShowLast) && hyperlinksEnabled() {
+		m.glamOutput = linkURLs(m.glamOutput, findURLs(output))
+	}
 	m.glamHeight = lipgloss.Height(m.glamOutput)
 	m.glamOutput += "\n"
 	truncatedGlamOutput := m.renderer.NewStyle().
@@ -711,6 +1168,14 @@ func (m *Mods) appendToOutput(s string) {
 	}
 }
 
+// restoreTrimmed 将没有发送的历史消息放回对话，保存的对话仍然完整
+func (m *Mods) restoreTrimmed(messages []proto.Message) []proto.Message {
+	if len(m.trimmed) == 0 || m.trimmedAt > len(messages) {
+		return messages
+	}
+	return slices.Concat(messages[:m.trimmedAt], m.trimmed, messages[m.trimmedAt:])
+}
+
 // removeWhitespace 如果输入仅包含空白字符，则将其置空
 func removeWhitespace(s string) string {
 	if strings.TrimSpace(s) == "" {
@@ -721,16 +1186,28 @@ func removeWhitespace(s string) string {
 
 var tokenErrRe = regexp.MustCompile(`This model's maximum context length is (\d+) tokens. However, your messages resulted in (\d+) tokens`)
 
+// anthropicTokenErrRe 匹配 anthropic 超出上下文长度的错误消息，先是实际的令牌数，然后是上限
+var anthropicTokenErrRe = regexp.MustCompile(`prompt is too long: (\d+) tokens > (\d+) maximum`)
+
+// googleTokenErrRe 匹配 google 超出上下文长度的错误消息，先是实际的令牌数，然后是上限
+var googleTokenErrRe = regexp.MustCompile(`input token count \(?(\d+)\)? exceeds the maximum number of tokens allowed \(?(\d+)\)?`)
+
 // cutPrompt 裁剪提示词以适应模型的最大上下文长度
 func cutPrompt(msg, prompt string) string {
-	found := tokenErrRe.FindStringSubmatch(msg)
-	if len(found) != 3 { //nolint:mnd
+	var maxt, current int
+	if found := tokenErrRe.FindStringSubmatch(msg); len(found) == 3 { //nolint:mnd
+		maxt, _ = strconv.Atoi(found[1])
+		current, _ = strconv.Atoi(found[2])
+	} else if found := anthropicTokenErrRe.FindStringSubmatch(msg); len(found) == 3 { //nolint:mnd
+		current, _ = strconv.Atoi(found[1])
+		maxt, _ = strconv.Atoi(found[2])
+	} else if found := googleTokenErrRe.FindStringSubmatch(msg); len(found) == 3 { //nolint:mnd
+		current, _ = strconv.Atoi(found[1])
+		maxt, _ = strconv.Atoi(found[2])
+	} else {
 		return prompt
 	}
 
-	maxt, _ := strconv.Atoi(found[1])
-	current, _ := strconv.Atoi(found[2])
-
 	if maxt > current {
 		return prompt
 	}
@@ -771,8 +1248,23 @@ func (m *Mods) resolveModel(cfg *Config) (API, Model, error) {
 		if ok {
 			mod.Name = cfg.Model
 			mod.API = api.Name
+			if isOpenRouter(api) {
+				mod = withOpenRouterMetadata(m.ctx, api, mod)
+			}
 			return api, mod, nil
 		}
+		// Ollama 可以使用任何已经安装的模型，ensureOllamaModel 会在请求前检查
+		if cfg.API != "" && api.Name == "ollama" {
+			return api, Model{Name: cfg.Model, API: api.Name}, nil
+		}
+		// OpenRouter 上的模型无需逐个写进设置
+		if cfg.API != "" && isOpenRouter(api) {
+			if models, err := openRouterModels(m.ctx, api); err == nil {
+				if mod, ok := models[cfg.Model]; ok {
+					return api, mod, nil
+				}
+			}
+		}
 		// 如果指定了 API 但未找到模型，返回错误
 		if cfg.API != "" {
 			return API{}, Model{}, modsError{
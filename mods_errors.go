@@ -1,74 +1,196 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/openai/openai-go"
 )
 
 // handleRequestError 处理请求错误
 func (m *Mods) handleRequestError(err error, mod Model, content string) tea.Msg {
-	ae := &openai.Error{}
-	if errors.As(err, &ae) {
+	var tooLarge requestTooLargeError
+	if errors.As(err, &tooLarge) {
+		return modsError{tooLarge, "请求体过大。请只附带相关的内容，或者先用检索（RAG）筛选文档，而不是发送全部内容。"}
+	}
+	if ae, ok := normalizeAPIError(err); ok {
 		return m.handleAPIError(ae, mod, content)
 	}
+	// 超过 request-timeout 时不重试，配置了 fallback-apis 时改用下一个 API
+	if errors.Is(err, context.DeadlineExceeded) && m.ctx.Err() == nil {
+		reason := fmt.Sprintf("%s API 在 %s 内没有完成请求。", mod.API, m.Config.RequestTimeout)
+		if msg, ok := m.fallback(mod, content, reason); ok {
+			return msg
+		}
+		return modsError{
+			err: newUserErrorf(
+				"可以用 %s 或设置中的 %s 延长超时时间，-1 表示不限制",
+				m.Styles.InlineCode.Render("--timeout"),
+				m.Styles.InlineCode.Render("request-timeout"),
+			),
+			reason: reason,
+		}
+	}
+	// 连接失败等不是 API 返回的错误，多半是服务不可用
+	if !errors.Is(err, context.Canceled) {
+		if msg, ok := m.fallback(mod, content, fmt.Sprintf("无法连接 %s API。", mod.API)); ok {
+			return msg
+		}
+	}
 	return modsError{err, fmt.Sprintf(
 		"%s API 请求出现问题。",
 		mod.API,
 	)}
 }
 
-// handleAPIError 处理 API 错误
-func (m *Mods) handleAPIError(err *openai.Error, mod Model, content string) tea.Msg {
+// fallback 按 fallback-apis 改用下一个可以使用的 API 重新请求，并在标准错误上说明原因。
+// 与当前相同的 API 和找不到模型的项会被跳过
+// mod: 出错的模型
+// content: 请求内容
+// reason: 改用其他 API 的原因
+// 返回：重新开始请求的消息，没有可以改用的 API 时返回 false
+func (m *Mods) fallback(mod Model, content, reason string) (tea.Msg, bool) {
+	for m.fallbacks < len(m.Config.FallbackAPIs) {
+		next := m.Config.FallbackAPIs[m.fallbacks]
+		m.fallbacks++
+		if next.API == mod.API {
+			continue
+		}
+		cfg := *m.Config
+		cfg.API, cfg.Model = next.API, cmp.Or(next.Model, mod.Name)
+		if _, _, err := m.resolveModel(&cfg); err != nil {
+			m.notice(fmt.Sprintf("fallback-apis：%s 中没有模型 %s，已跳过。", next.API, cfg.Model))
+			continue
+		}
+		m.notice(fmt.Sprintf("%s改用 %s 的 %s。", reason, cfg.API, cfg.Model))
+		m.Config.API, m.Config.Model = cfg.API, cfg.Model
+		m.retries = 0
+		return completionInput{content}, true
+	}
+	return nil, false
+}
+
+// notice 在标准错误上输出一行提示，终端中由 Bubble Tea 输出到界面上方
+func (m *Mods) notice(text string) {
+	if m.Config.Quiet {
+		return
+	}
+	text = m.Styles.Comment.Render(text)
+	if m.program != nil && isOutputTTY() && !m.Config.Raw {
+		m.program.Println(text)
+		return
+	}
+	fmt.Fprintln(os.Stderr, text)
+}
+
+// handleAPIError 按归一化的错误类别处理 API 错误，决定是否重试
+func (m *Mods) handleAPIError(err apiError, mod Model, content string) tea.Msg {
 	cfg := m.Config
-	switch err.StatusCode {
-	case http.StatusNotFound:
+	switch err.kind {
+	case apiErrorNotFound:
 		// 如果配置了回退模型，尝试使用回退模型
 		if mod.Fallback != "" {
 			m.Config.Model = mod.Fallback
 			return m.retry(content, modsError{
-				err:    err,
+				err:    err.err,
 				reason: fmt.Sprintf("%s API 服务器错误。", mod.API),
 			})
 		}
-		return modsError{err: err, reason: fmt.Sprintf(
+		return modsError{err: err.err, reason: fmt.Sprintf(
 			"API '%s' 缺少模型 '%s'。",
 			cfg.API,
 			cfg.Model,
 		)}
-	case http.StatusBadRequest:
+	case apiErrorContextLength:
 		// 处理上下文长度超出错误
-		if err.Code == "context_length_exceeded" {
-			pe := modsError{err: err, reason: "超出最大提示词大小。"}
-			if cfg.NoLimit {
-				return pe
-			}
-
-			return m.retry(cutPrompt(err.Message, content), pe)
+		pe := modsError{err: err.err, reason: "超出最大提示词大小。"}
+		if cfg.NoLimit {
+			return pe
+		}
+		// 错误消息中没有令牌数时（例如 ollama、bedrock），按本地估算的令牌数缩短提示词
+		cut := cutPrompt(err.message, content)
+		if cut == content {
+			cut = shrinkPrompt(content, mod)
 		}
+		return m.retry(cut, pe)
+	case apiErrorBadRequest:
 		// 错误请求（不重试）
-		return modsError{err: err, reason: fmt.Sprintf("%s API 请求错误。", mod.API)}
-	case http.StatusUnauthorized:
+		return modsError{err: err.err, reason: fmt.Sprintf("%s API 请求错误。", mod.API)}
+	case apiErrorAuth:
 		// 无效的认证或密钥（不重试）
-		return modsError{err: err, reason: fmt.Sprintf("无效的 %s API 密钥。", mod.API)}
-	case http.StatusTooManyRequests:
-		// 速率限制或引擎过载（等待并重试）
-		return m.retry(content, modsError{
-			err: err, reason: fmt.Sprintf("您已达到 %s API 速率限制。", mod.API),
-		})
-	case http.StatusInternalServerError:
-		if mod.API == "openai" {
-			return m.retry(content, modsError{err: err, reason: "OpenAI API 服务器错误。"})
+		return modsError{err: err.err, reason: fmt.Sprintf("无效的 %s API 密钥。", mod.API)}
+	case apiErrorRateLimit:
+		// 速率限制或引擎过载（配置了 fallback-apis 时改用下一个 API，否则按服务器要求的时间等待并重试）
+		reason := fmt.Sprintf("您已达到 %s API 速率限制。", mod.API)
+		if msg, ok := m.fallback(mod, content, reason); ok {
+			return msg
 		}
-		return modsError{err: err, reason: fmt.Sprintf(
-			"API '%s' 加载模型 '%s' 出错。",
-			mod.API,
-			mod.Name,
-		)}
+		return m.retryAfter(content, modsError{err: err.err, reason: reason}, err.wait)
+	case apiErrorServer:
+		reason := fmt.Sprintf("%s API 服务器错误（模型 '%s'）。", mod.API, mod.Name)
+		if msg, ok := m.fallback(mod, content, reason); ok {
+			return msg
+		}
+		return m.retryAfter(content, modsError{err: err.err, reason: reason}, err.wait)
 	default:
-		return m.retry(content, modsError{err: err, reason: "未知的 API 错误。"})
+		return m.retryAfter(content, modsError{err: err.err, reason: "未知的 API 错误。"}, err.wait)
+	}
+}
+
+// rateLimitRemainingPrefix 是剩余额度响应头的前缀，对应的重置时间在 x-ratelimit-reset-* 中。
+// Groq 使用 -requests 和 -tokens，Cerebras 使用 -requests-day 和 -tokens-minute
+const rateLimitRemainingPrefix = "X-Ratelimit-Remaining-"
+
+// rateLimitWait 从错误响应的响应头中读取服务器要求的等待时间：
+// 依次查看 retry-after-ms、retry-after，以及额度已用完的 x-ratelimit-reset-*
+// resp: 错误响应，可以为 nil
+// 返回：等待时间，没有相关响应头时为 0
+func rateLimitWait(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	if ms, err := strconv.ParseFloat(resp.Header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if d := parseWait(v); d > 0 {
+			return d
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(time.Until(t), 0)
+		}
+	}
+	var wait time.Duration
+	for name := range resp.Header {
+		limit, ok := strings.CutPrefix(name, rateLimitRemainingPrefix)
+		if !ok || resp.Header.Get(name) != "0" {
+			continue
+		}
+		wait = max(wait, parseWait(resp.Header.Get("X-Ratelimit-Reset-"+limit)))
+	}
+	return wait
+}
+
+// parseWait 解析以秒数（可以带小数）或 Go 时长（如 Groq 的 2m59.56s）表示的等待时间
+func parseWait(s string) time.Duration {
+	s = strings.TrimSpace(s)
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		if secs <= 0 || secs > math.MaxInt64/float64(time.Second) {
+			return 0
+		}
+		return time.Duration(secs * float64(time.Second))
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0
 	}
+	return d
 }
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/mods/internal/proto"
 	"github.com/stretchr/testify/require"
 )
 
@@ -172,6 +182,21 @@ func TestFindCacheOpsDetails(t *testing.T) {
 	})
 }
 
+func TestCompletionInputQuit(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"--list":      {List: true},
+		"--list-json": {ListJSON: true},
+		"--du":        {DU: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := &Mods{cancelMu: &sync.Mutex{}, Config: &cfg}
+			_, cmd := m.Update(completionInput{content: "你好"})
+			require.NotNil(t, cmd)
+			require.Equal(t, tea.Quit(), cmd())
+		})
+	}
+}
+
 func TestRemoveWhitespace(t *testing.T) {
 	t.Run("only whitespaces", func(t *testing.T) {
 		require.Equal(t, "", removeWhitespace(" \n"))
@@ -202,6 +227,16 @@ var cutPromptTests = map[string]struct {
 		prompt:   "this is a long prompt I have no idea if its really 10 tokens",
 		expected: "this is a long prompt ",
 	},
+	"anthropic": {
+		msg:      "prompt is too long: 10 tokens > 3 maximum",
+		prompt:   "this is a long prompt I have no idea if its really 10 tokens",
+		expected: "this is a long prompt ",
+	},
+	"google": {
+		msg:      "The input token count (10) exceeds the maximum number of tokens allowed (3).",
+		prompt:   "this is a long prompt I have no idea if its really 10 tokens",
+		expected: "this is a long prompt ",
+	},
 	"missmatch of token estimation vs api result": {
 		msg:      tokenErrMsg(30000, 100),
 		prompt:   "tell me a joke",
@@ -220,3 +255,198 @@ func TestCutPrompt(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryWait(t *testing.T) {
+	t.Run("指数增长", func(t *testing.T) {
+		require.Equal(t, 200*time.Millisecond, retryWait(1, 10*time.Second))
+		require.Equal(t, 800*time.Millisecond, retryWait(3, 10*time.Second))
+	})
+
+	t.Run("封顶", func(t *testing.T) {
+		require.Equal(t, 10*time.Second, retryWait(10, 10*time.Second))
+		require.Equal(t, 10*time.Second, retryWait(10000, 10*time.Second))
+	})
+
+	t.Run("不设上限时不溢出", func(t *testing.T) {
+		require.Equal(t, time.Duration(math.MaxInt64), retryWait(10000, 0))
+	})
+}
+
+func TestAppendReasoning(t *testing.T) {
+	m := &Mods{
+		Config:       &Config{},
+		contentMutex: &sync.Mutex{},
+	}
+	m.appendReasoning("先想想\n")
+	m.appendReasoning("再想想")
+	m.endReasoning()
+	m.endReasoning()
+	m.appendToOutput("答案")
+	require.Equal(t, "> 先想想\n> 再想想\n\n答案", m.Output)
+}
+
+func TestStreamReasoning(t *testing.T) {
+	m := &Mods{
+		Config:       &Config{ShowReasoning: true},
+		contentMutex: &sync.Mutex{},
+	}
+	m.streamReasoning("先想想\n再")
+	require.True(t, m.reasoning)
+	m.endReasoning()
+	require.False(t, m.reasoning)
+	m.appendToOutput("答案")
+	require.Equal(t, "答案", m.Output)
+}
+
+func TestMistralRequest(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"}}]}\n\n"+
+			"data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":1}}\n\n"+
+			"data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	m := &Mods{Config: &Config{}, ctx: context.Background()}
+	api := API{Name: "mistral", APIKey: "secret", BaseURL: srv.URL}
+	mod := Model{Name: "codestral-latest", API: "mistral"}
+	client, err := m.newClient(m.Config, api, mod)
+	require.NoError(t, err)
+
+	format := "json"
+	s := client.Request(context.Background(), proto.Request{
+		Messages:       []proto.Message{{Role: proto.RoleUser, Content: "hi"}},
+		API:            mod.API,
+		Model:          mod.Name,
+		SafePrompt:     true,
+		ResponseFormat: &format,
+	})
+	var content string
+	for s.Next() {
+		chunk, err := s.Current()
+		if err == nil {
+			content += chunk.Content
+		}
+	}
+	require.NoError(t, s.Err())
+	require.NoError(t, s.Close())
+
+	require.Equal(t, "ok", content)
+	require.Equal(t, true, body["safe_prompt"])
+	require.Equal(t, map[string]any{"type": "json_object"}, body["response_format"])
+	require.NotContains(t, body, "user")
+	require.NotContains(t, body, "stream_options")
+	require.Equal(t, int64(5), s.Usage().InputTokens)
+}
+
+func TestStreamUsage(t *testing.T) {
+	on, off := true, false
+	for name, tc := range map[string]struct {
+		api      API
+		expected bool
+	}{
+		"openai":     {API{Name: "openai"}, true},
+		"azure":      {API{Name: "azure"}, true},
+		"兼容的 API":    {API{Name: "my-gateway"}, false},
+		"兼容的 API 开启": {API{Name: "my-gateway", StreamUsage: &on}, true},
+		"openai 关闭":  {API{Name: "openai", StreamUsage: &off}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, streamUsage(tc.api))
+		})
+	}
+}
+
+func TestReasoningContent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"\",\"reasoning_content\":\"hmm\"}}]}\n\n"+
+			"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"answer\",\"reasoning_content\":null}}]}\n\n"+
+			"data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	for _, name := range []string{"deepseek", "xai"} {
+		t.Run(name, func(t *testing.T) {
+			m := &Mods{Config: &Config{}, ctx: context.Background()}
+			client, err := m.newClient(m.Config, API{Name: name, APIKey: "x", BaseURL: srv.URL}, Model{API: name})
+			require.NoError(t, err)
+			s := client.Request(context.Background(), proto.Request{
+				Messages: []proto.Message{{Role: proto.RoleUser, Content: "hi"}},
+				API:      name,
+			})
+			var reasoning, content string
+			for s.Next() {
+				chunk, err := s.Current()
+				require.NoError(t, err)
+				reasoning += chunk.Reasoning
+				content += chunk.Content
+			}
+			require.NoError(t, s.Err())
+			require.NoError(t, s.Close())
+			require.Equal(t, "hmm", reasoning)
+			require.Equal(t, "answer", content)
+		})
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	for name, tc := range map[string]struct {
+		header http.Header
+		want   time.Duration
+	}{
+		"没有响应头": {http.Header{}, 0},
+		"retry-after 秒数": {
+			http.Header{"Retry-After": {"7"}},
+			7 * time.Second,
+		},
+		"retry-after-ms 优先": {
+			http.Header{"Retry-After-Ms": {"1500"}, "Retry-After": {"7"}},
+			1500 * time.Millisecond,
+		},
+		"Groq 的令牌额度用完": {
+			http.Header{
+				"X-Ratelimit-Remaining-Requests": {"14"},
+				"X-Ratelimit-Remaining-Tokens":   {"0"},
+				"X-Ratelimit-Reset-Requests":     {"2m59.56s"},
+				"X-Ratelimit-Reset-Tokens":       {"7.66s"},
+			},
+			7660 * time.Millisecond,
+		},
+		"Cerebras 的每分钟额度用完": {
+			http.Header{
+				"X-Ratelimit-Remaining-Requests-Day":  {"0"},
+				"X-Ratelimit-Remaining-Tokens-Minute": {"0"},
+				"X-Ratelimit-Reset-Requests-Day":      {"33011.5"},
+				"X-Ratelimit-Reset-Tokens-Minute":     {"11.5"},
+			},
+			33011500 * time.Millisecond,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.want, rateLimitWait(&http.Response{Header: tc.header}))
+		})
+	}
+	require.Zero(t, rateLimitWait(nil))
+}
+
+func TestRetryAfter(t *testing.T) {
+	m := &Mods{Config: &Config{MaxRetries: 5, RetryMaxWait: time.Second}}
+
+	t.Run("按服务器要求等待", func(t *testing.T) {
+		start := time.Now()
+		msg := m.retryAfter("hi", modsError{reason: "限流。"}, 50*time.Millisecond)
+		require.Equal(t, completionInput{"hi"}, msg)
+		require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("超过上限时放弃", func(t *testing.T) {
+		msg := m.retryAfter("hi", modsError{reason: "限流。"}, time.Minute)
+		err, ok := msg.(modsError)
+		require.True(t, ok)
+		require.Equal(t, "限流。服务器要求 1m0s 后重试，超过了 retry-max-wait。", err.reason)
+	})
+}
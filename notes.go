@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// archiveLast 是不带参数使用 --archive-to-notes 时的值，表示最近的对话
+const archiveLast = "HEAD"
+
+// maxNoteNameLen 是笔记文件名（不含扩展名）的最大字符数
+const maxNoteNameLen = 80
+
+// noteFrontmatter 是笔记开头的 YAML frontmatter，Obsidian 等工具用它显示和检索属性
+type noteFrontmatter struct {
+	Title string    `yaml:"title"`           // 对话标题
+	Date  time.Time `yaml:"date"`            // 对话的更新时间
+	Model string    `yaml:"model,omitempty"` // 模型名称
+	API   string    `yaml:"api,omitempty"`   // API 名称
+	ID    string    `yaml:"mods-id"`         // 对话 ID，再次归档时用来找到同一篇笔记
+	Tags  []string  `yaml:"tags,omitempty"`  // 标签：notes-tags 和对话使用的角色
+}
+
+// archiveToNotes 把对话渲染为带 frontmatter 的 markdown 写入 notes-dir，
+// 同一个对话再次归档时覆盖之前的笔记
+// in: 对话 ID 或标题，为 archiveLast 时使用 args 或最近的对话
+// args: 命令行参数，允许使用 --archive-to-notes <ID> 的形式
+// 返回：错误信息
+func archiveToNotes(in string, args []string) error {
+	dir, err := notesDir(config.NotesDir)
+	if err != nil {
+		return modsError{err, "无法归档对话。"}
+	}
+	if in == archiveLast && len(args) > 0 {
+		in = strings.Join(args, " ")
+	}
+
+	var convo *Conversation
+	if in == archiveLast {
+		convo, err = db.FindHEAD()
+	} else {
+		convo, err = db.Find(in)
+	}
+	if err != nil {
+		return modsError{err, "无法找到对话。"}
+	}
+
+	c, err := openConversations()
+	if err != nil {
+		return modsError{err, "无法打开对话缓存。"}
+	}
+	var messages []proto.Message
+	if err := c.Read(convo.ID, &messages); err != nil {
+		return modsError{err, "无法读取对话。"}
+	}
+
+	note, err := renderNote(*convo, messages, config.NotesTags)
+	if err != nil {
+		return modsError{err, "无法归档对话。"}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:mnd
+		return modsError{err, "无法创建笔记目录。"}
+	}
+	path := notePath(dir, *convo)
+	if err := os.WriteFile(path, note, 0o644); err != nil { //nolint:gosec,mnd
+		return modsError{err, "无法写入笔记。"}
+	}
+
+	if !config.Quiet {
+		fmt.Fprintln(os.Stderr, "对话已归档到:", path)
+	}
+	return nil
+}
+
+// notesDir 返回展开后的笔记目录，支持 ~/ 和 ${VAR}
+// dir: notes-dir 设置
+// 返回：笔记目录和错误信息
+func notesDir(dir string) (string, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return "", newUserErrorf("请先在设置中配置 notes-dir，例如 %s", stderrStyles().InlineCode.Render("notes-dir: ~/Obsidian/mods"))
+	}
+	dir, err := expandPath(dir)
+	if err != nil {
+		return "", fmt.Errorf("无法展开 notes-dir: %w", err)
+	}
+	return dir, nil
+}
+
+// expandPath 展开路径开头的 ~/
+func expandPath(path string) (string, error) {
+	if rest, ok := strings.CutPrefix(path, "~"); ok && (rest == "" || rest[0] == '/' || rest[0] == filepath.Separator) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err //nolint:wrapcheck
+		}
+		path = filepath.Join(home, rest)
+	}
+	return path, nil
+}
+
+// renderNote 把对话渲染为带 frontmatter 的 markdown 笔记
+// convo: 对话
+// messages: 对话消息
+// tags: 附加的标签
+// 返回：笔记内容和错误信息
+func renderNote(convo Conversation, messages []proto.Message, tags []string) ([]byte, error) {
+	fm := noteFrontmatter{
+		Title: convo.Title,
+		Date:  convo.UpdatedAt.Local().Truncate(time.Second),
+		ID:    convo.ID,
+		Tags:  append(slices.Clone(tags), conversationTags(convo)...),
+	}
+	if convo.Model != nil {
+		fm.Model = *convo.Model
+	}
+	if convo.API != nil {
+		fm.API = *convo.API
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2) //nolint:mnd
+	if err := enc.Encode(fm); err != nil {
+		return nil, fmt.Errorf("无法生成 frontmatter: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("无法生成 frontmatter: %w", err)
+	}
+	fmt.Fprintf(&buf, "---\n\n# %s\n\n", convo.Title)
+	buf.WriteString(strings.TrimSpace(proto.Conversation(messages).String()))
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// conversationTags 返回对话自身的标签：使用的角色（默认角色除外）。
+// 归档笔记时加在 notes-tags 后面，--finetune-tag 按它筛选
+func conversationTags(convo Conversation) []string {
+	if convo.Meta == nil {
+		return nil
+	}
+	meta, err := decodeRequestMeta(*convo.Meta)
+	if err != nil || meta.Role == "" || meta.Role == "default" {
+		return nil
+	}
+	return []string{meta.Role}
+}
+
+// notePath 返回对话的笔记路径。文件名取自标题，已有同名但属于其它对话的笔记时加上短 ID
+// dir: 笔记目录
+// convo: 对话
+func notePath(dir string, convo Conversation) string {
+	name := noteName(convo.Title)
+	if name == "" {
+		return filepath.Join(dir, shortID(convo.ID)+".md")
+	}
+	path := filepath.Join(dir, name+".md")
+	if bts, err := os.ReadFile(path); err == nil && !bytes.Contains(bts, []byte("\nmods-id: "+convo.ID+"\n")) {
+		path = filepath.Join(dir, name+" "+shortID(convo.ID)+".md")
+	}
+	return path
+}
+
+// noteName 把标题转换为文件名，去掉文件系统和 Obsidian 链接中不能使用的字符
+func noteName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|#^[]`, r) {
+			return ' '
+		}
+		return r
+	}, title)
+	name = strings.Join(strings.Fields(name), " ")
+	name = strings.TrimLeft(name, ".")
+	if runes := []rune(name); len(runes) > maxNoteNameLen {
+		name = strings.TrimSpace(string(runes[:maxNoteNameLen]))
+	}
+	return name
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/cache"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveToNotes(t *testing.T) {
+	oldDB, oldConfig := db, config
+	t.Cleanup(func() { db, config = oldDB, oldConfig })
+	db = testDB(t)
+	config.CachePath = t.TempDir()
+	config.NotesDir = filepath.Join(t.TempDir(), "vault", "mods")
+	config.NotesTags = []string{"mods", "ai"}
+	config.Quiet = true
+
+	c, err := cache.NewConversations(config.CachePath)
+	require.NoError(t, err)
+	save := func(title string, messages []proto.Message) string {
+		id := newConversationID()
+		require.NoError(t, c.Write(id, &messages))
+		require.NoError(t, db.Save(id, title, "openai", "gpt-4o"))
+		return id
+	}
+	id := save("如何: 写 Go?", []proto.Message{
+		{Role: proto.RoleUser, Content: "如何写 Go?"},
+		{Role: proto.RoleAssistant, Content: "多写。"},
+	})
+	require.NoError(t, db.SaveMeta(id, `{"role":"shell"}`))
+
+	path := filepath.Join(config.NotesDir, "如何 写 Go.md")
+	t.Run("归档最近的对话", func(t *testing.T) {
+		require.NoError(t, archiveToNotes(archiveLast, nil))
+		bts, err := os.ReadFile(path)
+		require.NoError(t, err)
+		note := string(bts)
+		require.True(t, strings.HasPrefix(note, "---\ntitle: '如何: 写 Go?'\ndate: "), note)
+		require.Contains(t, note, "\nmodel: gpt-4o\napi: openai\nmods-id: "+id+"\ntags:\n  - mods\n  - ai\n  - shell\n---\n\n# 如何: 写 Go?\n\n")
+		require.Contains(t, note, "**用户**: 如何写 Go?\n\n**助手**: 多写。\n")
+	})
+
+	t.Run("再次归档覆盖同一篇笔记", func(t *testing.T) {
+		require.NoError(t, archiveToNotes(archiveLast, []string{id[:sha1short]}))
+		entries, err := os.ReadDir(config.NotesDir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	t.Run("同名的其它对话", func(t *testing.T) {
+		other := save("如何: 写 Go?", []proto.Message{{Role: proto.RoleUser, Content: "again"}})
+		require.NoError(t, archiveToNotes(other, nil))
+		require.FileExists(t, filepath.Join(config.NotesDir, "如何 写 Go "+other[:sha1short]+".md"))
+	})
+
+	t.Run("没有配置 notes-dir", func(t *testing.T) {
+		config.NotesDir = ""
+		require.ErrorContains(t, archiveToNotes(archiveLast, nil), "notes-dir")
+	})
+}
+
+func TestNoteName(t *testing.T) {
+	require.Equal(t, "a b c", noteName("a/b\\c"))
+	require.Equal(t, "标题 链接", noteName("标题 [[链接]]"))
+	require.Equal(t, "hidden", noteName("..hidden"))
+	require.Equal(t, "", noteName("???"))
+	require.Len(t, []rune(noteName(strings.Repeat("长", 100))), maxNoteNameLen)
+}
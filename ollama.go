@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/ollama"
+	"github.com/mattn/go-isatty"
+	ollamaapi "github.com/ollama/ollama/api"
+)
+
+// ollamaListTimeout 是列出已安装模型的超时时间
+const ollamaListTimeout = 5 * time.Second
+
+// ollamaClient 创建访问 API 所配置的 Ollama 服务的客户端
+func ollamaClient(api API) (*ollama.Client, error) {
+	cfg := ollama.DefaultConfig()
+	if api.BaseURL != "" {
+		cfg.BaseURL = api.BaseURL
+	}
+	return ollama.New(cfg) //nolint:wrapcheck
+}
+
+// ollamaModels 通过 /api/tags 返回 Ollama 中已经安装的模型
+// ctx: 上下文
+// api: Ollama 的 API 配置
+// 返回：排好序的模型名称和错误信息
+func ollamaModels(ctx context.Context, api API) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ollamaListTimeout)
+	defer cancel()
+	client, err := ollamaClient(api)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("列出 Ollama 模型: %w", err)
+	}
+	names := make([]string, 0, len(resp.Models))
+	for _, m := range resp.Models {
+		names = append(names, m.Name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// ollamaInstalled 判断模型是否已经安装，没有写标签的名称对应 latest 标签
+func ollamaInstalled(installed []string, name string) bool {
+	if !strings.Contains(name, ":") {
+		name += ":latest"
+	}
+	return slices.Contains(installed, name)
+}
+
+// ensureOllamaModel 在使用 --api ollama 时检查请求的模型是否已经安装，
+// 没有安装时在终端中询问是否下载，并显示下载进度。无法连接 Ollama 时交给请求报告错误
+// ctx: 上下文
+// 返回：错误信息
+func ensureOllamaModel(ctx context.Context) error {
+	if config.API != "ollama" {
+		return nil
+	}
+	// 只在会发起请求时检查
+	if config.Show != "" || config.ShowLast || config.Dirs || config.DU || config.Settings || config.ResetSettings ||
+		config.ShowHelp || config.List || config.ListJSON || config.ListRoles || config.MCPList ||
+		config.MCPListTools || config.MCPListResources || config.MCPListPrompts || config.MCPLogin != "" || len(config.Delete) > 0 || config.DeleteOlderThan != 0 {
+		return nil
+	}
+	idx := slices.IndexFunc(config.APIs, func(api API) bool { return api.Name == "ollama" })
+	if idx < 0 {
+		return nil
+	}
+	api := config.APIs[idx]
+	name := config.Model
+	for n, mod := range api.Models {
+		if n == name || slices.Contains(mod.Aliases, name) {
+			name = n
+			break
+		}
+	}
+	installed, err := ollamaModels(ctx, api)
+	if err != nil || ollamaInstalled(installed, name) {
+		return nil
+	}
+
+	if !config.Yes && !canPrompt() {
+		return modsError{
+			err:    newUserErrorf("请先运行 %s，或者使用 %s 自动下载", stderrStyles().InlineCode.Render("ollama pull "+name), stderrStyles().InlineCode.Render("--yes")),
+			reason: fmt.Sprintf("Ollama 中没有安装模型 %s。", stderrStyles().InlineCode.Render(name)),
+		}
+	}
+	if err := confirmAction(fmt.Sprintf("Ollama 中没有安装 %s，现在下载吗？", name), ""); err != nil {
+		return err
+	}
+	return pullOllamaModel(ctx, api, name)
+}
+
+// pullOllamaModel 下载模型，在标准错误上显示进度
+// ctx: 上下文
+// api: Ollama 的 API 配置
+// name: 模型名称
+// 返回：错误信息
+func pullOllamaModel(ctx context.Context, api API, name string) error {
+	client, err := ollamaClient(api)
+	if err != nil {
+		return modsError{err, "无法下载模型。"}
+	}
+	tty := isatty.IsTerminal(os.Stderr.Fd())
+	var last string
+	err = client.Pull(ctx, &ollamaapi.PullRequest{Model: name}, func(p ollamaapi.ProgressResponse) error {
+		line := pullProgress(name, p)
+		switch {
+		case tty:
+			fmt.Fprint(os.Stderr, "\r\x1b[K"+line)
+		case p.Status != last:
+			// 不是终端时每个阶段只输出一行
+			fmt.Fprintln(os.Stderr, line)
+		}
+		last = p.Status
+		return nil
+	})
+	if tty {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+	if err != nil {
+		return modsError{err, fmt.Sprintf("无法下载模型 %s。", name)}
+	}
+	return nil
+}
+
+// pullProgress 返回一行下载进度
+func pullProgress(name string, p ollamaapi.ProgressResponse) string {
+	if p.Total <= 0 {
+		return fmt.Sprintf("正在下载 %s：%s", name, p.Status)
+	}
+	return fmt.Sprintf(
+		"正在下载 %s：%s %d%%（%s / %s）",
+		name, p.Status, p.Completed*100/p.Total, //nolint:mnd
+		formatBytes(p.Completed), formatBytes(p.Total),
+	)
+}
+
+// formatBytes 以 1024 为进制格式化字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// ollamaOptions 合并模型配置中的 options 和命令行设置的 Ollama 推理选项，命令行优先
+// cfg: 配置信息
+// mod: 模型配置
+// 返回：推理选项，没有设置时为 nil
+func ollamaOptions(cfg *Config, mod Model) map[string]any {
+	opts := maps.Clone(mod.Options)
+	set := func(key string, value any, ok bool) {
+		if !ok {
+			return
+		}
+		if opts == nil {
+			opts = map[string]any{}
+		}
+		opts[key] = value
+	}
+	set("num_gpu", cfg.NumGPU, cfg.NumGPU != 0)
+	set("num_thread", cfg.NumThread, cfg.NumThread != 0)
+	set("repeat_penalty", cfg.RepeatPenalty, cfg.RepeatPenalty != 0)
+	set("mirostat", cfg.Mirostat, cfg.Mirostat != 0)
+	return opts
+}
+
+// parseKeepAlive 解析 keep-alive，与 Ollama 一样接受时长（例如 10m）或秒数，负数表示一直保留
+// 返回：时长，没有设置时为 nil；以及错误信息
+func parseKeepAlive(s string) (*time.Duration, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		d := time.Duration(n) * time.Second
+		return &d, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 keep-alive %q: %w", s, err)
+	}
+	return &d, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/ollama"
+	"github.com/charmbracelet/mods/internal/proto"
+	ollamaapi "github.com/ollama/ollama/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOllamaModels(t *testing.T) {
+	var pulled string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			_, _ = io.WriteString(w, `{"models":[{"name":"qwen2.5:7b"},{"name":"llama3.2:latest"}]}`)
+		case "/api/pull":
+			var req ollamaapi.PullRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			pulled = req.Model
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			_, _ = io.WriteString(w, `{"status":"pulling manifest"}`+"\n")
+			_, _ = io.WriteString(w, `{"status":"pulling abc","total":2048,"completed":1024}`+"\n")
+			_, _ = io.WriteString(w, `{"status":"success"}`+"\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	api := API{Name: "ollama", BaseURL: srv.URL}
+
+	t.Run("列出已安装的模型", func(t *testing.T) {
+		models, err := ollamaModels(context.Background(), api)
+		require.NoError(t, err)
+		require.Equal(t, []string{"llama3.2:latest", "qwen2.5:7b"}, models)
+	})
+
+	t.Run("没有标签时对应 latest", func(t *testing.T) {
+		installed := []string{"llama3.2:latest", "qwen2.5:7b"}
+		require.True(t, ollamaInstalled(installed, "llama3.2"))
+		require.True(t, ollamaInstalled(installed, "qwen2.5:7b"))
+		require.False(t, ollamaInstalled(installed, "qwen2.5"))
+	})
+
+	t.Run("下载模型", func(t *testing.T) {
+		require.NoError(t, pullOllamaModel(context.Background(), api, "qwen2.5"))
+		require.Equal(t, "qwen2.5", pulled)
+	})
+
+	t.Run("下载进度", func(t *testing.T) {
+		require.Equal(t, "正在下载 qwen2.5：pulling manifest",
+			pullProgress("qwen2.5", ollamaapi.ProgressResponse{Status: "pulling manifest"}))
+		require.Equal(t, "正在下载 qwen2.5：pulling abc 50%（1.0 KB / 2.0 KB）",
+			pullProgress("qwen2.5", ollamaapi.ProgressResponse{Status: "pulling abc", Total: 2048, Completed: 1024}))
+		require.Equal(t, "512 B", formatBytes(512))
+		require.Equal(t, "4.5 GB", formatBytes(4831838208))
+	})
+}
+
+func TestOllamaOptions(t *testing.T) {
+	t.Run("命令行优先于模型配置", func(t *testing.T) {
+		mod := Model{Options: map[string]any{"num_gpu": 40, "mirostat": 2}}
+		cfg := Config{NumGPU: 20, RepeatPenalty: 1.1}
+		require.Equal(t, map[string]any{
+			"num_gpu":        20,
+			"mirostat":       2,
+			"repeat_penalty": 1.1,
+		}, ollamaOptions(&cfg, mod))
+		require.Equal(t, 40, mod.Options["num_gpu"])
+		require.Nil(t, ollamaOptions(&Config{}, Model{}))
+	})
+
+	t.Run("keep-alive", func(t *testing.T) {
+		d, err := parseKeepAlive("10m")
+		require.NoError(t, err)
+		require.Equal(t, 10*time.Minute, *d)
+		d, err = parseKeepAlive("-1")
+		require.NoError(t, err)
+		require.Negative(t, *d)
+		d, err = parseKeepAlive("")
+		require.NoError(t, err)
+		require.Nil(t, d)
+		_, err = parseKeepAlive("soon")
+		require.Error(t, err)
+	})
+
+	t.Run("发送给 Ollama", func(t *testing.T) {
+		bodies := make(chan map[string]any, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			bodies <- body
+			_, _ = io.WriteString(w, `{"message":{"role":"assistant","content":"ok"},"done":true}`+"\n")
+		}))
+		t.Cleanup(srv.Close)
+
+		client, err := ollama.New(ollama.Config{BaseURL: srv.URL, HTTPClient: srv.Client()})
+		require.NoError(t, err)
+		keepAlive := 30 * time.Minute
+		temp := 0.2
+		s := client.Request(context.Background(), proto.Request{
+			Model:       "llama3.2",
+			Messages:    []proto.Message{{Role: proto.RoleUser, Content: "hi"}},
+			Temperature: &temp,
+			KeepAlive:   &keepAlive,
+			Options:     map[string]any{"num_thread": 8, "temperature": 1.0},
+		})
+		content, err := readStream(s)
+		require.NoError(t, err)
+		require.Equal(t, "ok", content)
+		require.Equal(t, proto.RoleAssistant, s.Messages()[1].Role)
+		body := <-bodies
+		require.Equal(t, "30m0s", body["keep_alive"])
+		require.Equal(t, map[string]any{"num_thread": 8.0, "temperature": 0.2}, body["options"])
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/cache"
+)
+
+const (
+	// openRouterBaseURL 是 OpenRouter 的默认 API 地址
+	openRouterBaseURL = "https://openrouter.ai/api/v1"
+	// openRouterModelsTTL 是 /models 结果的缓存时间
+	openRouterModelsTTL = 24 * time.Hour
+	// openRouterTimeout 是获取 /models 的超时时间
+	openRouterTimeout = 10 * time.Second
+)
+
+// openRouterModel 是 OpenRouter /models 返回的单个模型
+type openRouterModel struct {
+	ID            string `json:"id"`
+	ContextLength int64  `json:"context_length"`
+	Pricing       struct {
+		Prompt     string `json:"prompt"`
+		Completion string `json:"completion"`
+	} `json:"pricing"`
+}
+
+// isOpenRouter 判断 API 是否为 OpenRouter
+func isOpenRouter(api API) bool {
+	return api.Name == "openrouter" || strings.Contains(api.BaseURL, "openrouter.ai")
+}
+
+// openRouterModels 返回 OpenRouter 上所有模型的上下文长度和价格，结果缓存一天
+// ctx: 上下文
+// api: OpenRouter 的 API 配置
+// 返回：以模型 ID 为键的模型配置和错误信息
+func openRouterModels(ctx context.Context, api API) (map[string]Model, error) {
+	baseURL := strings.TrimSuffix(api.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = openRouterBaseURL
+	}
+	sum := sha256.Sum256([]byte(baseURL))
+	id := "openrouter-models-" + hex.EncodeToString(sum[:8])
+
+	// 缓存不可用时每次都重新获取
+	models, _ := cache.NewExpiring[string](config.CachePath)
+	var bts []byte
+	if models != nil {
+		_ = models.Read(id, func(r io.Reader) error {
+			var err error
+			bts, err = io.ReadAll(r)
+			return err //nolint:wrapcheck
+		})
+	}
+	if len(bts) == 0 {
+		var err error
+		bts, err = fetchOpenRouterModels(ctx, baseURL)
+		if err != nil {
+			return nil, err
+		}
+		if models != nil {
+			_ = models.Write(id, time.Now().Add(openRouterModelsTTL).Unix(), func(w io.Writer) error {
+				_, err := w.Write(bts)
+				return err //nolint:wrapcheck
+			})
+		}
+	}
+
+	var resp struct {
+		Data []openRouterModel `json:"data"`
+	}
+	if err := json.Unmarshal(bts, &resp); err != nil {
+		return nil, fmt.Errorf("解析 OpenRouter 模型列表: %w", err)
+	}
+	result := make(map[string]Model, len(resp.Data))
+	for _, m := range resp.Data {
+		result[m.ID] = Model{
+			Name:           m.ID,
+			API:            api.Name,
+			MaxInputTokens: m.ContextLength,
+			InputPrice:     perMillion(m.Pricing.Prompt),
+			OutputPrice:    perMillion(m.Pricing.Completion),
+		}
+	}
+	return result, nil
+}
+
+// fetchOpenRouterModels 请求 OpenRouter 的 /models 端点
+// ctx: 上下文
+// baseURL: API 地址
+// 返回：响应内容和错误信息
+func fetchOpenRouterModels(ctx context.Context, baseURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, openRouterTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取 OpenRouter 模型列表: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("获取 OpenRouter 模型列表: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	bts, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("获取 OpenRouter 模型列表: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取 OpenRouter 模型列表: %s: %s", resp.Status, bytes.TrimSpace(bts))
+	}
+	return bts, nil
+}
+
+// perMillion 把 OpenRouter 以字符串表示的每令牌美元价格换算为每百万令牌的价格，
+// 无法解析或按请求动态计价（负数）时返回 0
+func perMillion(price string) float64 {
+	f, err := strconv.ParseFloat(price, 64)
+	if err != nil || f < 0 {
+		return 0
+	}
+	return f * 1e6 //nolint:mnd
+}
+
+// withOpenRouterMetadata 用 OpenRouter 报告的上下文长度和价格补全模型中未设置的字段，
+// 已设置 max-input-chars 或 max-input-tokens 时不改变输入上限，获取失败时原样返回
+// ctx: 上下文
+// api: OpenRouter 的 API 配置
+// mod: 模型配置
+// 返回：补全后的模型配置
+func withOpenRouterMetadata(ctx context.Context, api API, mod Model) Model {
+	hasLimit := mod.MaxInputTokens > 0 || mod.MaxChars > 0
+	if hasLimit && mod.InputPrice > 0 && mod.OutputPrice > 0 {
+		return mod
+	}
+	models, err := openRouterModels(ctx, api)
+	if err != nil {
+		return mod
+	}
+	remote, ok := models[mod.Name]
+	if !ok {
+		return mod
+	}
+	if !hasLimit {
+		mod.MaxInputTokens = remote.MaxInputTokens
+	}
+	if mod.InputPrice == 0 {
+		mod.InputPrice = remote.InputPrice
+	}
+	if mod.OutputPrice == 0 {
+		mod.OutputPrice = remote.OutputPrice
+	}
+	return mod
+}
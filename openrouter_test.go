@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/openai"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenRouterModels(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config.CachePath = t.TempDir()
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/models", r.URL.Path)
+		requests++
+		_, _ = io.WriteString(w, `{"data":[
+			{"id":"anthropic/claude-sonnet-4","context_length":200000,"pricing":{"prompt":"0.000003","completion":"0.000015"}},
+			{"id":"openrouter/auto","context_length":2000000,"pricing":{"prompt":"-1","completion":"-1"}}
+		]}`)
+	}))
+	t.Cleanup(srv.Close)
+	api := API{Name: "openrouter", BaseURL: srv.URL}
+
+	t.Run("上下文长度和价格", func(t *testing.T) {
+		models, err := openRouterModels(context.Background(), api)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+		mod := models["anthropic/claude-sonnet-4"]
+		require.Equal(t, "openrouter", mod.API)
+		require.Equal(t, int64(200000), mod.MaxInputTokens)
+		require.InDelta(t, 3, mod.InputPrice, 1e-9)
+		require.InDelta(t, 15, mod.OutputPrice, 1e-9)
+		require.Zero(t, models["openrouter/auto"].InputPrice)
+	})
+
+	t.Run("结果被缓存", func(t *testing.T) {
+		_, err := openRouterModels(context.Background(), api)
+		require.NoError(t, err)
+		require.Equal(t, 1, requests)
+	})
+
+	t.Run("不覆盖已设置的字段", func(t *testing.T) {
+		mod := withOpenRouterMetadata(context.Background(), api, Model{
+			Name:       "anthropic/claude-sonnet-4",
+			MaxChars:   1000,
+			InputPrice: 1,
+		})
+		require.Zero(t, mod.MaxInputTokens)
+		require.InDelta(t, 1, mod.InputPrice, 1e-9)
+		require.InDelta(t, 15, mod.OutputPrice, 1e-9)
+	})
+
+	t.Run("使用未配置的模型", func(t *testing.T) {
+		cfg := Config{API: "openrouter", Model: "anthropic/claude-sonnet-4", APIs: APIs{api}}
+		mods := &Mods{ctx: context.Background()}
+		_, mod, err := mods.resolveModel(&cfg)
+		require.NoError(t, err)
+		require.Equal(t, "anthropic/claude-sonnet-4", mod.Name)
+		require.Equal(t, int64(200000), mod.MaxInputTokens)
+	})
+}
+
+func TestOpenRouterProvider(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	allow := false
+	client := openai.New(openai.Config{
+		BaseURL: srv.URL,
+		ExtraBody: map[string]any{"provider": &ProviderRouting{
+			Order:          []string{"anthropic", "amazon-bedrock"},
+			AllowFallbacks: &allow,
+		}},
+	})
+	s := client.Request(context.Background(), proto.Request{
+		Model:    "anthropic/claude-sonnet-4",
+		Messages: []proto.Message{{Role: proto.RoleUser, Content: "hi"}},
+	})
+	for s.Next() {
+	}
+	require.NoError(t, s.Err())
+	require.NoError(t, s.Close())
+	require.Equal(t, map[string]any{
+		"order":           []any{"anthropic", "amazon-bedrock"},
+		"allow_fallbacks": false,
+	}, body["provider"])
+}
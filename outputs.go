@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outputs 的类型
+const (
+	outputFile    = "file"    // 追加到文件
+	outputWebhook = "webhook" // POST 到 URL，默认发送 JSON
+	outputSlack   = "slack"   // POST 到 Slack incoming webhook
+)
+
+// outputTimeout 是发送到一个 webhook 的超时时间
+const outputTimeout = 10 * time.Second
+
+// Output 是 outputs 中的一项：回答完成后额外发送到的地方。
+type Output struct {
+	Name     string            `yaml:"name"`     // 名称，用于错误信息，默认为类型
+	Type     string            `yaml:"type"`     // 类型：file、webhook 或 slack
+	Path     string            `yaml:"path"`     // file 追加写入的文件，支持 ~ 和 ${VAR}
+	URL      string            `yaml:"url"`      // webhook 和 slack 的地址，支持 ${VAR}
+	Headers  map[string]string `yaml:"headers"`  // webhook 附加的请求头，支持 ${VAR}
+	Template string            `yaml:"template"` // 发送内容的模板，默认为回答（webhook 默认为 JSON）
+	Roles    []string          `yaml:"roles"`    // 只在使用这些角色时发送，为空时总是发送
+}
+
+// outputEvent 是发送给 outputs 的内容，也是模板的数据
+type outputEvent struct {
+	Prompt       string    `json:"prompt"`                 // 最后的提示
+	Answer       string    `json:"answer"`                 // 回答
+	Role         string    `json:"role,omitempty"`         // 使用的角色
+	API          string    `json:"api"`                    // API 名称
+	Model        string    `json:"model"`                  // 模型名称
+	Conversation string    `json:"conversation,omitempty"` // 对话 ID，不保存对话时为空
+	Time         time.Time `json:"time"`                   // 完成时间
+}
+
+// dispatchOutputs 把回答同时发送到 outputs 中适用于当前角色的每一项。
+// 发送失败只在标准错误上提示，不影响已经输出和保存的回答
+// ctx: 上下文
+// mods: 已完成的请求
+func dispatchOutputs(ctx context.Context, mods *Mods) {
+	if config.NoOutputs || len(config.Outputs) == 0 || strings.TrimSpace(mods.Output) == "" {
+		return
+	}
+	ev := outputEvent{
+		Prompt:       lastPrompt(mods.messages),
+		Answer:       mods.Output,
+		Role:         config.Role,
+		API:          mods.model.API,
+		Model:        mods.model.Name,
+		Conversation: config.cacheWriteToID,
+		Time:         time.Now(),
+	}
+	for _, err := range sendOutputs(ctx, config.Outputs, ev) {
+		if !config.Quiet {
+			fmt.Fprintln(os.Stderr, stderrStyles().Comment.Render(err.Error()))
+		}
+	}
+}
+
+// sendOutputs 并发发送到所有适用的输出
+// ctx: 上下文
+// outputs: outputs 设置
+// ev: 发送的内容
+// 返回：按 outputs 顺序排列的错误
+func sendOutputs(ctx context.Context, outputs []Output, ev outputEvent) []error {
+	errs := make([]error, len(outputs))
+	var wg sync.WaitGroup
+	for i, out := range outputs {
+		if len(out.Roles) > 0 && !slices.Contains(out.Roles, ev.Role) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sendOutput(ctx, out, ev); err != nil {
+				errs[i] = fmt.Errorf("无法发送到输出 %s: %w", cmp.Or(out.Name, out.Type), err)
+			}
+		}()
+	}
+	wg.Wait()
+	return slices.DeleteFunc(errs, func(err error) bool { return err == nil })
+}
+
+// sendOutput 按类型发送到一个输出
+func sendOutput(ctx context.Context, out Output, ev outputEvent) error {
+	switch out.Type {
+	case outputFile:
+		body, err := outputBody(out, ev, "{{ .Answer }}\n")
+		if err != nil {
+			return err
+		}
+		return appendOutputFile(out.Path, body)
+	case outputWebhook:
+		if out.Template == "" {
+			bts, err := json.Marshal(ev)
+			if err != nil {
+				return fmt.Errorf("无法编码 JSON: %w", err)
+			}
+			return postOutput(ctx, out, bts, "application/json")
+		}
+		body, err := outputBody(out, ev, "")
+		if err != nil {
+			return err
+		}
+		return postOutput(ctx, out, []byte(body), "text/plain; charset=utf-8")
+	case outputSlack:
+		text, err := outputBody(out, ev, "{{ .Answer }}")
+		if err != nil {
+			return err
+		}
+		bts, err := json.Marshal(map[string]string{"text": text})
+		if err != nil {
+			return fmt.Errorf("无法编码 JSON: %w", err)
+		}
+		return postOutput(ctx, out, bts, "application/json")
+	default:
+		return fmt.Errorf("不支持的类型 %q，可选的类型有 %s、%s、%s", out.Type, outputFile, outputWebhook, outputSlack)
+	}
+}
+
+// outputBody 用输出的模板（没有设置时用 def）渲染发送的内容
+func outputBody(out Output, ev outputEvent, def string) (string, error) {
+	return executeTemplate(cmp.Or(out.Name, out.Type), cmp.Or(out.Template, def), ev)
+}
+
+// appendOutputFile 把内容追加到文件，需要时创建文件和目录
+func appendOutputFile(path, body string) error {
+	if strings.TrimSpace(path) == "" {
+		return errors.New("没有设置 path")
+	}
+	path, err := expandPath(strings.TrimSpace(path))
+	if err != nil {
+		return fmt.Errorf("无法展开 path: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:mnd
+		return fmt.Errorf("无法创建目录: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644) //nolint:gosec,mnd
+	if err != nil {
+		return fmt.Errorf("无法打开文件: %w", err)
+	}
+	if _, err := io.WriteString(f, body); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("无法写入文件: %w", err)
+	}
+	return f.Close() //nolint:wrapcheck
+}
+
+// postOutput 把内容 POST 到输出的 URL，使用 http-proxy 设置
+func postOutput(ctx context.Context, out Output, body []byte, contentType string) error {
+	target := strings.TrimSpace(out.URL)
+	if target == "" {
+		return errors.New("没有设置 url")
+	}
+	ctx, cancel := context.WithTimeout(ctx, outputTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("无法创建请求: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range out.Headers {
+		req.Header.Set(name, value)
+	}
+
+	client := &http.Client{}
+	if config.HTTPProxy != "" {
+		proxyURL, err := url.Parse(config.HTTPProxy)
+		if err != nil {
+			return fmt.Errorf("解析代理 URL 时出错: %w", err)
+		}
+		client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:mnd
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
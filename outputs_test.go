@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendOutputs(t *testing.T) {
+	ev := outputEvent{
+		Prompt: "你好",
+		Answer: "世界",
+		Role:   "shell",
+		API:    "openai",
+		Model:  "gpt-4o",
+		Time:   time.Date(2024, 5, 1, 14, 3, 0, 0, time.UTC),
+	}
+
+	t.Run("追加到文件", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "a", "log.md")
+		outputs := []Output{
+			{Type: outputFile, Path: path},
+			{Type: outputFile, Path: path, Template: "{{ .Model }}: {{ .Prompt }}\n"},
+		}
+		require.Empty(t, sendOutputs(context.Background(), outputs[:1], ev))
+		require.Empty(t, sendOutputs(context.Background(), outputs[1:], ev))
+		bts, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "世界\ngpt-4o: 你好\n", string(bts))
+	})
+
+	t.Run("webhook", func(t *testing.T) {
+		var got outputEvent
+		var auth, contentType string
+		srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			auth, contentType = r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+			_ = json.NewDecoder(r.Body).Decode(&got)
+		}))
+		defer srv.Close()
+
+		out := Output{Type: outputWebhook, URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}
+		require.Empty(t, sendOutputs(context.Background(), []Output{out}, ev))
+		require.Equal(t, "Bearer secret", auth)
+		require.Equal(t, "application/json", contentType)
+		require.Equal(t, ev, got)
+	})
+
+	t.Run("slack", func(t *testing.T) {
+		var body string
+		srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			bts, _ := io.ReadAll(r.Body)
+			body = string(bts)
+		}))
+		defer srv.Close()
+
+		out := Output{Type: outputSlack, URL: srv.URL, Template: "*{{ .Role }}*: {{ .Answer }}"}
+		require.Empty(t, sendOutputs(context.Background(), []Output{out}, ev))
+		require.JSONEq(t, `{"text":"*shell*: 世界"}`, body)
+	})
+
+	t.Run("按角色筛选", func(t *testing.T) {
+		dir := t.TempDir()
+		outputs := []Output{
+			{Type: outputFile, Path: filepath.Join(dir, "shell.md"), Roles: []string{"shell"}},
+			{Type: outputFile, Path: filepath.Join(dir, "oncall.md"), Roles: []string{"oncall"}},
+		}
+		require.Empty(t, sendOutputs(context.Background(), outputs, ev))
+		require.FileExists(t, filepath.Join(dir, "shell.md"))
+		require.NoFileExists(t, filepath.Join(dir, "oncall.md"))
+	})
+
+	t.Run("错误", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "no", http.StatusForbidden)
+		}))
+		defer srv.Close()
+
+		errs := sendOutputs(context.Background(), []Output{
+			{Type: "email"},
+			{Name: "hook", Type: outputWebhook, URL: srv.URL},
+			{Type: outputFile},
+		}, ev)
+		require.Len(t, errs, 3)
+		require.ErrorContains(t, errs[0], "不支持的类型")
+		require.ErrorContains(t, errs[1], "hook")
+		require.ErrorContains(t, errs[1], "403")
+		require.ErrorContains(t, errs[2], "没有设置 path")
+	})
+}
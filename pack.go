@@ -0,0 +1,369 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	packManifest = "pack.yml" // 共享包中描述角色的文件
+	packFilesDir = "files"    // 共享包中存放角色引用文件的目录
+	packMaxSize  = 10 << 20   // 共享包中单个文件的最大字节数
+)
+
+// promptPack 是共享包中的 pack.yml，
+// 角色引用的本地文件以 file://files/<名称> 的形式指向包内的文件
+type promptPack struct {
+	Roles map[string][]string `yaml:"roles"` // 角色名称与角色消息
+}
+
+// runPack 执行 --pack 子命令
+// action: export 或 import
+// args: export 时为输出文件和可选的角色名称，import 时为包的路径或 URL
+// 返回：错误信息
+func runPack(action string, args []string) error {
+	switch action {
+	case "export":
+		if len(args) == 0 {
+			return modsError{errors.New("缺少输出文件"), "用法：mods --pack export <bundle.tar> [角色...]"}
+		}
+		return exportPack(args[0], args[1:])
+	case "import":
+		if len(args) != 1 {
+			return modsError{errors.New("缺少共享包的路径或 URL"), "用法：mods --pack import <路径|URL>"}
+		}
+		return importPack(args[0])
+	default:
+		return modsError{
+			fmt.Errorf("未知的操作 %q", action),
+			"--pack 只支持 export 和 import。",
+		}
+	}
+}
+
+// exportPack 将角色及其引用的本地文件打包为 tar 文件，文件名以 .gz 或 .tgz 结尾时使用 gzip 压缩
+// out: 输出文件
+// names: 要导出的角色，为空时导出所有角色
+// 返回：错误信息
+func exportPack(out string, names []string) error {
+	if len(names) == 0 {
+		names = roleNames("")
+	}
+	pack := promptPack{Roles: map[string][]string{}}
+	files := map[string][]byte{}
+	for _, name := range names {
+		msgs, ok := config.Roles[name]
+		if !ok {
+			return modsError{fmt.Errorf("角色 %q 不存在", name), "无法导出共享包。"}
+		}
+		packed := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			if !strings.HasPrefix(msg, "file://") {
+				packed = append(packed, msg)
+				continue
+			}
+			src := strings.TrimPrefix(msg, "file://")
+			bts, err := os.ReadFile(src)
+			if err != nil {
+				return modsError{err, fmt.Sprintf("无法读取角色 %s 引用的文件。", name)}
+			}
+			file := uniquePackName(files, filepath.Base(src))
+			files[file] = bts
+			packed = append(packed, "file://"+path.Join(packFilesDir, file))
+		}
+		pack.Roles[name] = packed
+	}
+
+	manifest, err := yaml.Marshal(pack)
+	if err != nil {
+		return modsError{err, "无法导出共享包。"}
+	}
+
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if strings.HasSuffix(out, ".gz") || strings.HasSuffix(out, ".tgz") {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	entries := []string{packManifest}
+	for _, file := range slices.Sorted(maps.Keys(files)) {
+		entries = append(entries, path.Join(packFilesDir, file))
+	}
+	for _, name := range entries {
+		data := manifest
+		if name != packManifest {
+			data = files[path.Base(name)]
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o600, //nolint:mnd
+			Size:    int64(len(data)),
+			ModTime: now,
+		}); err != nil {
+			return modsError{err, "无法导出共享包。"}
+		}
+		if _, err := tw.Write(data); err != nil {
+			return modsError{err, "无法导出共享包。"}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return modsError{err, "无法导出共享包。"}
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return modsError{err, "无法导出共享包。"}
+		}
+	}
+	if err := os.WriteFile(out, buf.Bytes(), 0o600); err != nil { //nolint:mnd
+		return modsError{err, fmt.Sprintf("无法写入 %s。", out)}
+	}
+
+	if !config.Quiet {
+		fmt.Fprintf(os.Stderr, "已将 %d 个角色和 %d 个文件导出到 %s。\n", len(pack.Roles), len(files), out)
+	}
+	return nil
+}
+
+// uniquePackName 返回包内不重复的文件名
+func uniquePackName(files map[string][]byte, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; ; i++ {
+		if _, ok := files[candidate]; !ok {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// importPack 导入共享包：包内文件解压到设置目录下的 packs/<包名>，
+// 角色写入设置文件，已存在的同名角色保持不变
+// src: 共享包的路径或 HTTP/HTTPS URL
+// 返回：错误信息
+func importPack(src string) error {
+	data, err := readPackSource(src)
+	if err != nil {
+		return modsError{err, fmt.Sprintf("无法读取 %s。", src)}
+	}
+	pack, files, err := parsePack(data)
+	if err != nil {
+		return modsError{err, fmt.Sprintf("无法解析 %s。", src)}
+	}
+
+	dir := filepath.Join(filepath.Dir(config.SettingsPath), "packs", packName(src))
+	roles := map[string][]string{}
+	for name, msgs := range pack.Roles {
+		resolved := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			if rel, ok := strings.CutPrefix(msg, "file://"); ok {
+				file, ok := strings.CutPrefix(rel, packFilesDir+"/")
+				if _, found := files[file]; !ok || !found {
+					return modsError{
+						fmt.Errorf("角色 %s 引用了包中不存在的文件 %s", name, rel),
+						fmt.Sprintf("无法导入 %s。", src),
+					}
+				}
+				msg = "file://" + filepath.Join(dir, packFilesDir, file)
+			}
+			resolved = append(resolved, msg)
+		}
+		roles[name] = resolved
+	}
+
+	for name, bts := range files {
+		dst := filepath.Join(dir, packFilesDir, name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil { //nolint:mnd
+			return modsError{err, "无法写入共享包中的文件。"}
+		}
+		if err := os.WriteFile(dst, bts, 0o600); err != nil { //nolint:mnd
+			return modsError{err, "无法写入共享包中的文件。"}
+		}
+	}
+
+	added, skipped, err := addRolesToSettings(config.SettingsPath, roles)
+	if err != nil {
+		return modsError{err, "无法更新设置文件。"}
+	}
+
+	if !config.Quiet {
+		for _, name := range added {
+			fmt.Fprintf(os.Stderr, "已导入角色 %s\n", stderrStyles().InlineCode.Render(name))
+		}
+		for _, name := range skipped {
+			fmt.Fprintf(os.Stderr, "角色 %s 已存在，跳过\n", stderrStyles().InlineCode.Render(name))
+		}
+		if len(files) > 0 {
+			fmt.Fprintf(os.Stderr, "\n引用的文件已保存到 %s，使用前请检查其内容。\n", stderrStyles().Link.Render(dir))
+		}
+	}
+	return nil
+}
+
+// readPackSource 读取本地或远程的共享包
+func readPackSource(src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "https://") && !strings.HasPrefix(src, "http://") {
+		return os.ReadFile(src) //nolint:wrapcheck
+	}
+	resp, err := http.Get(src) //nolint:gosec,noctx
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载 %s 失败: %s", src, resp.Status)
+	}
+	return io.ReadAll(resp.Body) //nolint:wrapcheck
+}
+
+// parsePack 解析共享包，只接受 pack.yml 与 files 目录下的普通文件
+// data: tar 或 tar.gz 格式的共享包
+// 返回：pack.yml 的内容、包内文件（按文件名）和错误信息
+func parsePack(data []byte) (promptPack, map[string][]byte, error) {
+	var pack promptPack
+	var r io.Reader
+	br := bufio.NewReader(bytes.NewReader(data))
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) { //nolint:mnd
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return pack, nil, fmt.Errorf("无法解压: %w", err)
+		}
+		r = gz
+	} else {
+		r = br
+	}
+
+	files := map[string][]byte{}
+	var manifest []byte
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return pack, nil, fmt.Errorf("无效的共享包: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return pack, nil, fmt.Errorf("共享包中不支持的文件类型: %s", hdr.Name)
+		}
+		if hdr.Size > packMaxSize {
+			return pack, nil, fmt.Errorf("共享包中的文件过大: %s", hdr.Name)
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		file, inFiles := strings.CutPrefix(name, packFilesDir+"/")
+		switch {
+		case name == packManifest:
+		case inFiles && file != "" && !strings.Contains(file, "/") && file != "..":
+		default:
+			return pack, nil, fmt.Errorf("共享包中不支持的文件: %s", hdr.Name)
+		}
+		bts, err := io.ReadAll(io.LimitReader(tr, packMaxSize))
+		if err != nil {
+			return pack, nil, fmt.Errorf("无效的共享包: %w", err)
+		}
+		if name == packManifest {
+			manifest = bts
+			continue
+		}
+		files[file] = bts
+	}
+	if manifest == nil {
+		return pack, nil, fmt.Errorf("共享包中缺少 %s", packManifest)
+	}
+	if err := yaml.Unmarshal(manifest, &pack); err != nil {
+		return pack, nil, fmt.Errorf("无法解析 %s: %w", packManifest, err)
+	}
+	if len(pack.Roles) == 0 {
+		return pack, nil, errors.New("共享包中没有角色")
+	}
+	return pack, files, nil
+}
+
+// packName 返回共享包的名称，即去掉扩展名的文件名
+func packName(src string) string {
+	name := path.Base(strings.TrimRight(src, "/"))
+	for _, ext := range []string{".gz", ".tgz", ".tar"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if name == "" || name == "." || name == ".." {
+		return "pack"
+	}
+	return name
+}
+
+// escapeInterpolation 转义 ${ 和 $(，导入的内容在读取设置时保持原样
+func escapeInterpolation(s string) string {
+	return strings.NewReplacer("${", "$${", "$(", "$$(").Replace(s)
+}
+
+// addRolesToSettings 将角色写入设置文件的 roles 中，保留文件中的注释，已存在的角色不会被覆盖
+// settings: 设置文件路径
+// roles: 要添加的角色
+// 返回：添加和跳过的角色名称，以及错误信息
+func addRolesToSettings(settings string, roles map[string][]string) ([]string, []string, error) {
+	doc, err := readSettingsDoc(settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := doc.Content[0]
+
+	rolesNode := yamlMapValue(root, "roles")
+	if rolesNode == nil || rolesNode.Kind != yaml.MappingNode {
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		if rolesNode == nil {
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "roles"}, node)
+		} else {
+			*rolesNode = *node
+		}
+		rolesNode = node
+	}
+
+	existing := map[string]bool{}
+	for i := 0; i < len(rolesNode.Content); i += 2 {
+		existing[rolesNode.Content[i].Value] = true
+	}
+
+	var added, skipped []string
+	for _, name := range slices.Sorted(maps.Keys(roles)) {
+		if existing[name] {
+			skipped = append(skipped, name)
+			continue
+		}
+		seq := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, msg := range roles[name] {
+			seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: escapeInterpolation(msg)})
+		}
+		rolesNode.Content = append(rolesNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, seq)
+		added = append(added, name)
+	}
+	if len(added) == 0 {
+		return added, skipped, nil
+	}
+
+	if err := writeSettingsDoc(settings, doc); err != nil {
+		return nil, nil, err
+	}
+	return added, skipped, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPack(t *testing.T) {
+	oldRoles, oldPath, oldQuiet := config.Roles, config.SettingsPath, config.Quiet
+	t.Cleanup(func() { config.Roles, config.SettingsPath, config.Quiet = oldRoles, oldPath, oldQuiet })
+	config.Quiet = true
+
+	dir := t.TempDir()
+	prompt := filepath.Join(dir, "review.md")
+	require.NoError(t, os.WriteFile(prompt, []byte("you review code"), 0o600))
+	config.Roles = map[string][]string{
+		"reviewer": {"file://" + prompt, "be terse"},
+		"shell":    {"you are a shell expert"},
+	}
+	bundle := filepath.Join(dir, "team.tar.gz")
+	require.NoError(t, exportPack(bundle, nil))
+
+	settings := filepath.Join(t.TempDir(), "mods.yml")
+	require.NoError(t, os.WriteFile(settings, []byte("# 注释\nroles:\n  shell:\n    - mine\n"), 0o600))
+	config.SettingsPath = settings
+
+	t.Run("导入", func(t *testing.T) {
+		require.NoError(t, importPack(bundle))
+
+		content, err := os.ReadFile(settings)
+		require.NoError(t, err)
+		file := filepath.Join(filepath.Dir(settings), "packs", "team", "files", "review.md")
+		require.Equal(t, "# 注释\nroles:\n  shell:\n    - mine\n  reviewer:\n    - file://"+file+"\n    - be terse\n", string(content))
+
+		bts, err := os.ReadFile(file)
+		require.NoError(t, err)
+		require.Equal(t, "you review code", string(bts))
+	})
+
+	t.Run("导入的角色不执行命令", func(t *testing.T) {
+		marker := filepath.Join(t.TempDir(), "x")
+		config.Roles = map[string][]string{"evil": {"$(touch " + marker + ")", "${HOME} 和 $${HOME}"}}
+		evil := filepath.Join(dir, "evil.tar.gz")
+		require.NoError(t, exportPack(evil, nil))
+		require.NoError(t, importPack(evil))
+
+		// 与 ensureConfig 一样解析并展开设置文件
+		content, err := os.ReadFile(settings)
+		require.NoError(t, err)
+		var doc yaml.Node
+		require.NoError(t, yaml.Unmarshal(content, &doc))
+		require.NoError(t, interpolateNode(&doc))
+		var out struct {
+			Roles map[string][]string `yaml:"roles"`
+		}
+		require.NoError(t, doc.Decode(&out))
+		require.Equal(t, config.Roles["evil"], out.Roles["evil"])
+		require.NoFileExists(t, marker)
+	})
+
+	t.Run("拒绝包外的路径", func(t *testing.T) {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "files/../../evil", Mode: 0o600, Size: 1}))
+		_, err := tw.Write([]byte("x"))
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+
+		_, _, err = parsePack(buf.Bytes())
+		require.Error(t, err)
+	})
+
+	t.Run("未知的操作", func(t *testing.T) {
+		require.Error(t, runPack("share", nil))
+	})
+}
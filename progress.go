@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+)
+
+// showAnim 判断是否显示生成时的动画
+func (m *Mods) showAnim() bool {
+	return !m.Config.Quiet && !m.Config.PlainProgress
+}
+
+// requestProgress 在开始请求（或重试）时输出进度
+func (m *Mods) requestProgress() tea.Cmd {
+	if m.retries > 0 {
+		return m.printProgress(fmt.Sprintf("正在重试 %s（第 %d 次）…", m.Config.Model, m.retries))
+	}
+	return m.printProgress(fmt.Sprintf("正在请求 %s（%s）…", m.Config.Model, m.Config.API))
+}
+
+// printProgress 使用 --plain-progress 时，在状态变化后输出一行进度文本，
+// 使用 --tty-progress 时更新 /dev/tty 上的进度行。与上一次相同的进度不会重复输出
+// text: 进度文本
+// 返回：输出进度的命令
+func (m *Mods) printProgress(text string) tea.Cmd {
+	if m.Config.Quiet || text == m.progress {
+		return nil
+	}
+	m.progress = text
+	m.ttyProgress.set(text)
+	if !m.Config.PlainProgress {
+		return nil
+	}
+	// 终端中由 Bubble Tea 输出到界面上方，否则直接写入标准错误
+	if isOutputTTY() && !m.Config.Raw {
+		return tea.Println(text)
+	}
+	fmt.Fprintln(os.Stderr, text)
+	return nil
+}
+
+// ttyProgressInterval 是 /dev/tty 进度行的刷新间隔
+const ttyProgressInterval = 250 * time.Millisecond
+
+// ttyProgressFrames 是 /dev/tty 进度行的旋转动画
+var ttyProgressFrames = []string{"⣾", "⣽", "⣻", "⢿", "⡿", "⣟", "⣯", "⣷"}
+
+// ttyProgress 在标准输出和标准错误都被重定向时，像 ssh 询问密码那样把进度直接写到控制终端，
+// 并持续刷新已用时间，长请求不会看起来像是卡住了
+type ttyProgress struct {
+	w     io.WriteCloser
+	start time.Time
+	done  chan struct{}
+
+	mu    sync.Mutex
+	text  string
+	frame int
+}
+
+// openTTYProgress 在启用 --tty-progress 且标准输出和标准错误都不是终端时打开 /dev/tty，
+// 不需要或没有控制终端时返回 nil
+// cfg: 配置
+// 返回：进度输出
+func openTTYProgress(cfg *Config) *ttyProgress {
+	if !cfg.TTYProgress || cfg.Quiet || isOutputTTY() || isatty.IsTerminal(os.Stderr.Fd()) {
+		return nil
+	}
+	f, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return nil
+	}
+	return newTTYProgress(f, ttyProgressInterval)
+}
+
+// newTTYProgress 创建写到 w 的进度输出，每隔 interval 刷新一次
+func newTTYProgress(w io.WriteCloser, interval time.Duration) *ttyProgress {
+	p := &ttyProgress{
+		w:     w,
+		start: time.Now(),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.frame = (p.frame + 1) % len(ttyProgressFrames)
+				p.draw()
+				p.mu.Unlock()
+			}
+		}
+	}()
+	return p
+}
+
+// set 更新进度文本
+func (p *ttyProgress) set(text string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.text = text
+	p.draw()
+}
+
+// draw 重绘进度行，调用者需持有锁
+func (p *ttyProgress) draw() {
+	if p.text == "" {
+		return
+	}
+	elapsed := time.Since(p.start).Truncate(time.Second)
+	fmt.Fprintf(p.w, "\r\x1b[K%s %s %s", ttyProgressFrames[p.frame], p.text, elapsed)
+}
+
+// Close 停止刷新，清除进度行并关闭终端
+func (p *ttyProgress) Close() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.text != "" {
+		fmt.Fprint(p.w, "\r\x1b[K")
+	}
+	_ = p.w.Close()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// closeBuffer 是记录是否已关闭的缓冲区
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestTTYProgress(t *testing.T) {
+	t.Run("未启用时什么都不做", func(t *testing.T) {
+		var p *ttyProgress
+		p.set("正在请求…")
+		p.Close()
+		require.Nil(t, openTTYProgress(&Config{}))
+	})
+
+	t.Run("刷新并清除进度行", func(t *testing.T) {
+		var b closeBuffer
+		p := newTTYProgress(&b, time.Millisecond)
+		p.set("正在请求 gpt-4o（openai）…")
+		time.Sleep(20 * time.Millisecond)
+		p.Close()
+
+		out := b.String()
+		require.True(t, b.closed)
+		require.Greater(t, strings.Count(out, "正在请求 gpt-4o（openai）… 0s"), 1)
+		require.True(t, strings.HasSuffix(out, "\r\x1b[K"))
+	})
+
+	t.Run("没有进度时不输出", func(t *testing.T) {
+		var b closeBuffer
+		p := newTTYProgress(&b, time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		p.Close()
+		require.Empty(t, b.String())
+	})
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+// promptCacheHints 为支持提示缓存的 API（目前是 Anthropic）标记缓存断点。
+// 历史对话中残留的断点会被清除，每次请求重新标记
+// messages: 请求的消息，最后一条是本次的提示
+// system: 是否在开头的系统消息（格式与角色）之后设置断点
+// history: 是否在本次提示之前的历史末尾设置断点，继续对话时复用已缓存的前缀
+// 返回：标记后的消息副本
+func promptCacheHints(messages []proto.Message, system, history bool) []proto.Message {
+	messages = slices.Clone(messages)
+	for i := range messages {
+		messages[i].Cache = false
+	}
+	prefix := systemPrefix(messages)
+	if system && prefix > 0 {
+		messages[prefix-1].Cache = true
+	}
+	if last := len(messages) - 2; history && last >= prefix {
+		messages[last].Cache = true
+	}
+	return messages
+}
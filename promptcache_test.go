@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptCacheHints(t *testing.T) {
+	messages := []proto.Message{
+		{Role: proto.RoleSystem, Content: "角色"},
+		{Role: proto.RoleUser, Content: "问题", Cache: true},
+		{Role: proto.RoleAssistant, Content: "回答"},
+		{Role: proto.RoleUser, Content: "新问题"},
+	}
+	cached := func(messages []proto.Message) []int {
+		var idx []int
+		for i, msg := range messages {
+			if msg.Cache {
+				idx = append(idx, i)
+			}
+		}
+		return idx
+	}
+
+	t.Run("系统消息和历史", func(t *testing.T) {
+		require.Equal(t, []int{0, 2}, cached(promptCacheHints(messages, true, true)))
+	})
+
+	t.Run("只有系统消息", func(t *testing.T) {
+		require.Equal(t, []int{0}, cached(promptCacheHints(messages, true, false)))
+	})
+
+	t.Run("没有历史", func(t *testing.T) {
+		require.Equal(t, []int{0}, cached(promptCacheHints(messages[:1:1], true, true)))
+		require.Empty(t, cached(promptCacheHints(messages[3:], false, true)))
+	})
+
+	t.Run("不修改原来的消息", func(t *testing.T) {
+		promptCacheHints(messages, true, true)
+		require.Equal(t, []int{1}, cached(messages))
+	})
+}
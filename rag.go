@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/rag"
+)
+
+const (
+	ragDir         = "rag"   // 缓存目录中存放索引的子目录
+	ragChunkSize   = 1500    // 片段的最大字符数
+	ragMaxFileSize = 1 << 20 // 建立索引的单个文件的最大字节数
+)
+
+// ragPrompt 在问题后面附上检索到的资料。问题放在最前面，对话标题仍然取自问题
+const ragPrompt = "%s\n\n---\n\n下面是从本地文件中检索到的资料，回答上面的问题时优先依据这些资料，" +
+	"并用方括号中的编号注明引用的来源，例如 [1]。资料与问题无关时忽略它们。\n\n%s"
+
+// ragNameReg 匹配合法的索引名称
+var ragNameReg = regexp.MustCompile(`^[\w.-]+$`)
+
+// ragIndexPath 返回索引名称对应的文件路径
+func ragIndexPath(name string) (string, error) {
+	if !ragNameReg.MatchString(name) || strings.Trim(name, ".") == "" {
+		return "", modsError{
+			err:    newUserErrorf("名称只能包含字母、数字、下划线、点和短横线"),
+			reason: fmt.Sprintf("无效的索引名称 %q。", name),
+		}
+	}
+	return filepath.Join(config.CachePath, ragDir, name+".db"), nil
+}
+
+// runIndex 为文件和目录中的文本文件建立向量索引，已经索引过的文件会被替换。
+// 索引记录了使用的 API 和向量模型，检索时使用相同的模型
+// ctx: 上下文
+// name: 索引名称
+// paths: 文件和目录
+// 返回：错误信息
+func runIndex(ctx context.Context, name string, paths []string) error {
+	if len(paths) == 0 {
+		return modsError{
+			err:    newUserErrorf("例如：%s", stderrStyles().InlineCode.Render("mods --index docs ./docs README.md")),
+			reason: "缺少需要索引的文件或目录。",
+		}
+	}
+	path, err := ragIndexPath(name)
+	if err != nil {
+		return err
+	}
+	files, err := ragFiles(paths)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil { //nolint:mnd
+		return modsError{err, "无法创建索引目录。"}
+	}
+	_, statErr := os.Stat(path)
+	created := errors.Is(statErr, fs.ErrNotExist)
+	ix, err := rag.Open(path)
+	if err != nil {
+		return modsError{err, fmt.Sprintf("无法打开索引 %s。", name)}
+	}
+	defer ix.Close() //nolint:errcheck
+
+	indexed, chunks, err := indexFiles(ctx, ix, files)
+	if err != nil {
+		// 不留下没有建成的新索引
+		if created {
+			_ = ix.Close()
+			_ = os.Remove(path)
+		}
+		return err
+	}
+
+	if !config.Quiet {
+		total, _, _ := ix.Stats()
+		fmt.Fprintf(
+			os.Stderr,
+			"已将 %d 个文件（%d 个片段）加入索引 %s，索引中共有 %d 个文件。\n",
+			indexed, chunks, stderrStyles().InlineCode.Render(name), total,
+		)
+	}
+	return nil
+}
+
+// indexFiles 切分文件、获取向量并写入索引
+// ctx: 上下文
+// ix: 索引
+// files: 文件列表
+// 返回：索引的文件数、片段数和错误信息
+func indexFiles(ctx context.Context, ix *rag.Index, files []string) (int, int, error) {
+	api, model, err := ragModel(ix, config.API, config.EmbedModel)
+	if err != nil {
+		return 0, 0, err
+	}
+	client, model, err := embedClient(api, model)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var chunks int
+	for _, file := range files {
+		bts, err := readUserFile(file)
+		if err != nil {
+			return 0, 0, modsError{err, fmt.Sprintf("无法读取 %s。", file)}
+		}
+		parts := rag.Split(file, string(bts), ragChunkSize)
+		texts := make([]string, len(parts))
+		for i, c := range parts {
+			texts[i] = c.Text
+		}
+		var vectors [][]float64
+		if len(texts) > 0 {
+			vectors, err = client.Embed(ctx, model, texts)
+			if err != nil {
+				return 0, 0, modsError{err, fmt.Sprintf("无法通过 %s 获取 %s 的向量。", api, file)}
+			}
+		}
+		if err := ix.Replace(file, parts, vectors); err != nil {
+			return 0, 0, modsError{err, fmt.Sprintf("无法把 %s 写入索引。", file)}
+		}
+		chunks += len(parts)
+	}
+	if err := ix.SetMeta("api", api); err != nil {
+		return 0, 0, modsError{err, "无法写入索引。"}
+	}
+	if err := ix.SetMeta("model", model); err != nil {
+		return 0, 0, modsError{err, "无法写入索引。"}
+	}
+	return len(files), chunks, nil
+}
+
+// ragModel 返回索引使用的 API 和向量模型。新索引使用传入的设置，
+// 已有的索引沿用建立时的设置，明确指定了不同的设置时报错
+// 返回：API 名称、向量模型和错误信息
+func ragModel(ix *rag.Index, api, model string) (string, string, error) {
+	indexAPI, err := ix.Meta("api")
+	if err != nil {
+		return "", "", modsError{err, "无法读取索引。"}
+	}
+	indexModel, err := ix.Meta("model")
+	if err != nil {
+		return "", "", modsError{err, "无法读取索引。"}
+	}
+	if indexAPI == "" {
+		return api, model, nil
+	}
+	if model != "" && model != indexModel {
+		return "", "", modsError{
+			err:    newUserErrorf("不同模型的向量不能混用，请换一个索引名称"),
+			reason: fmt.Sprintf("索引使用的向量模型是 %s。", stderrStyles().InlineCode.Render(indexModel)),
+		}
+	}
+	return indexAPI, indexModel, nil
+}
+
+// ragFiles 展开需要索引的文件：目录中跳过隐藏的文件和目录、过大的文件和二进制文件
+// paths: 文件和目录
+// 返回：文件列表和错误信息
+func ragFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, root := range paths {
+		if _, err := resolveUserPath(root); err != nil {
+			return nil, modsError{err, fmt.Sprintf("无法读取 %s。", root)}
+		}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if path != root {
+				info, err := d.Info()
+				if err != nil {
+					return err //nolint:wrapcheck
+				}
+				if info.Size() > ragMaxFileSize || !isTextFile(path) {
+					return nil
+				}
+			}
+			files = append(files, filepath.Clean(path))
+			return nil
+		})
+		if err != nil {
+			return nil, modsError{err, fmt.Sprintf("无法读取 %s。", root)}
+		}
+	}
+	return files, nil
+}
+
+// isTextFile 根据文件开头判断是否是 UTF-8 文本文件
+func isTextFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close() //nolint:errcheck
+
+	buf := make([]byte, 4096) //nolint:mnd
+	n, _ := f.Read(buf)
+	head := buf[:n]
+	// 开头可能截断了一个多字节字符
+	for range utf8.UTFMax {
+		if utf8.Valid(head) || len(head) == 0 {
+			break
+		}
+		head = head[:len(head)-1]
+	}
+	return utf8.Valid(head) && !strings.ContainsRune(string(head), 0)
+}
+
+// ragSearch 在索引中检索与问题最相关的 --rag-top-k 个片段
+// ctx: 上下文
+// name: 索引名称
+// query: 问题
+// 返回：检索结果和错误信息
+func ragSearch(ctx context.Context, name, query string) ([]rag.Result, error) {
+	path, err := ragIndexPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, modsError{
+			err:    newUserErrorf("先用 %s 建立索引", stderrStyles().InlineCode.Render("mods --index "+name+" <文件或目录>")),
+			reason: fmt.Sprintf("索引 %s 不存在。", name),
+		}
+	}
+	ix, err := rag.Open(path)
+	if err != nil {
+		return nil, modsError{err, fmt.Sprintf("无法打开索引 %s。", name)}
+	}
+	defer ix.Close() //nolint:errcheck
+
+	api, model, err := ragModel(ix, config.API, config.EmbedModel)
+	if err != nil {
+		return nil, err
+	}
+	client, model, err := embedClient(api, model)
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := client.Embed(ctx, model, []string{query})
+	if err != nil {
+		return nil, modsError{err, fmt.Sprintf("无法通过 %s 获取问题的向量。", api)}
+	}
+	results, err := ix.Search(vectors[0], max(config.RAGTopK, 1))
+	if err != nil {
+		return nil, modsError{err, fmt.Sprintf("无法检索索引 %s。", name)}
+	}
+	return results, nil
+}
+
+// addRAGContext 用最后一条用户消息检索 --rag 索引，把检索到的资料附在这条消息后面
+// ctx: 上下文
+// 返回：错误信息
+func (m *Mods) addRAGContext(ctx context.Context) error {
+	i := len(m.messages) - 1
+	if m.Config.RAG == "" || m.followingUp || i < 0 || m.messages[i].Role != proto.RoleUser {
+		return nil
+	}
+	results, err := ragSearch(ctx, m.Config.RAG, m.messages[i].Content)
+	if err != nil {
+		return err
+	}
+	m.ragSources = results
+	if len(results) == 0 {
+		return nil
+	}
+	m.messages[i].Content = ragContext(results, m.messages[i].Content)
+	return nil
+}
+
+// ragContext 把编号的资料附在问题后面
+func ragContext(results []rag.Result, question string) string {
+	var sb strings.Builder
+	for i, r := range results {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "[%d] %s\n\n%s", i+1, ragCitation(r), r.Text)
+	}
+	return fmt.Sprintf(ragPrompt, question, sb.String())
+}
+
+// ragCitation 返回片段的来源，例如 docs/a.md:10-20
+func ragCitation(r rag.Result) string {
+	if r.Start == r.End {
+		return fmt.Sprintf("%s:%d", r.Source, r.Start)
+	}
+	return fmt.Sprintf("%s:%d-%d", r.Source, r.Start, r.End)
+}
+
+// ragSources 返回回答后输出的来源列表
+func ragSources(results []rag.Result) string {
+	var sb strings.Builder
+	sb.WriteString("来源：\n")
+	for i, r := range results {
+		fmt.Fprintf(&sb, "[%d] %s\n", i+1, ragCitation(r))
+	}
+	return sb.String()
+}
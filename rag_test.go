@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/rag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRAG(t *testing.T) {
+	// 向量的两个维度分别是 cat 和 dog 出现的次数
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		var data []map[string]any
+		for i, text := range req.Input {
+			data = append(data, map[string]any{
+				"object":    "embedding",
+				"index":     i,
+				"embedding": []float64{float64(strings.Count(text, "cat")), float64(strings.Count(text, "dog")), 0.1},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data})
+	}))
+	t.Cleanup(srv.Close)
+
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config.CachePath = t.TempDir()
+	config.APIs = APIs{{Name: "emb", BaseURL: srv.URL, APIKey: "key"}}
+	config.API, config.EmbedModel, config.Quiet, config.RAGTopK = "emb", "m", true, 1
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o700))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cats.md"), []byte("the cat sat\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "dogs.txt"), []byte("\ndogs bark\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("cat"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin"), []byte{0, 1, 2}, 0o600))
+
+	t.Run("展开文件", func(t *testing.T) {
+		files, err := ragFiles([]string{dir})
+		require.NoError(t, err)
+		require.Equal(t, []string{filepath.Join(dir, "cats.md"), filepath.Join(dir, "sub", "dogs.txt")}, files)
+	})
+
+	t.Run("建立索引并检索", func(t *testing.T) {
+		require.NoError(t, runIndex(context.Background(), "docs", []string{dir}))
+		results, err := ragSearch(context.Background(), "docs", "a dog")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, "dogs bark", results[0].Text)
+		require.Equal(t, filepath.Join(dir, "sub", "dogs.txt")+":2", ragCitation(results[0]))
+	})
+
+	t.Run("索引的向量模型不能改变", func(t *testing.T) {
+		config.EmbedModel = "other"
+		t.Cleanup(func() { config.EmbedModel = "m" })
+		require.ErrorContains(t, runIndex(context.Background(), "docs", []string{dir}), "不同模型")
+	})
+
+	t.Run("没有建成的新索引不会留下", func(t *testing.T) {
+		config.API = "missing"
+		t.Cleanup(func() { config.API = "emb" })
+		require.Error(t, runIndex(context.Background(), "new", []string{dir}))
+		require.NoFileExists(t, filepath.Join(config.CachePath, ragDir, "new.db"))
+	})
+
+	t.Run("索引不存在", func(t *testing.T) {
+		_, err := ragSearch(context.Background(), "nope", "cat")
+		require.ErrorContains(t, err, "--index nope")
+		_, err = ragIndexPath("../x")
+		require.Error(t, err)
+	})
+
+	t.Run("把资料附在问题后面", func(t *testing.T) {
+		mods := &Mods{
+			Config:   &Config{RAG: "docs"},
+			messages: []proto.Message{{Role: proto.RoleUser, Content: "about cat?"}},
+		}
+		require.NoError(t, mods.addRAGContext(context.Background()))
+		require.Len(t, mods.ragSources, 1)
+		content := mods.messages[0].Content
+		require.True(t, strings.HasPrefix(content, "about cat?\n"))
+		require.Contains(t, content, "[1] "+filepath.Join(dir, "cats.md")+":1\n\nthe cat sat")
+		require.Equal(t, "来源：\n[1] "+filepath.Join(dir, "cats.md")+":1\n", ragSources(mods.ragSources))
+	})
+}
+
+func TestRAGContext(t *testing.T) {
+	results := []rag.Result{
+		{Chunk: rag.Chunk{Source: "a.md", Start: 1, End: 3, Text: "甲"}},
+		{Chunk: rag.Chunk{Source: "b.md", Start: 7, End: 7, Text: "乙"}},
+	}
+	content := ragContext(results, "问题")
+	require.True(t, strings.HasPrefix(content, "问题\n\n---\n\n"))
+	require.True(t, strings.HasSuffix(content, "[1] a.md:1-3\n\n甲\n\n[2] b.md:7\n\n乙"))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/charmbracelet/mods/internal/proto"
+	"golang.org/x/term"
+)
+
+// exportPassphraseEnv 是 --encrypt 读取口令的环境变量
+const exportPassphraseEnv = "MODS_EXPORT_PASSPHRASE"
+
+// redactedText 替换导出内容中的敏感信息
+const redactedText = "[" + redacted + "]"
+
+// redactRule 是一条脱敏规则
+type redactRule struct {
+	re   *regexp.Regexp // 匹配敏感信息
+	repl string         // 替换文本，可以引用分组
+}
+
+// defaultRedactRules 是 --redact 默认使用的规则：常见的密钥和令牌、私钥、
+// 口令赋值、邮箱和 IP 地址
+var defaultRedactRules = []redactRule{
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), redactedText},
+	{regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}`), redactedText},
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), redactedText},
+	{regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{30,}|github_pat_[A-Za-z0-9_]{20,})`), redactedText},
+	{regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`), redactedText},
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`), redactedText},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`), redactedText},
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]{16,}`), "$1 " + redactedText},
+	{regexp.MustCompile(`(?i)\b((?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key)["']?\s*[:=]\s*["']?)[^\s"',;]+`), "${1}" + redactedText},
+	{regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`), redactedText},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), redactedText},
+}
+
+// redactRules 返回默认的规则加上 redact-patterns 中的正则表达式
+// patterns: redact-patterns 设置
+// 返回：脱敏规则和错误信息
+func redactRules(patterns []string) ([]redactRule, error) {
+	rules := slices.Clone(defaultRedactRules)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact-patterns 中的 %q 不是有效的正则表达式: %w", pattern, err)
+		}
+		rules = append(rules, redactRule{re, redactedText})
+	}
+	return rules, nil
+}
+
+// redactText 按规则替换文本中的敏感信息
+func redactText(rules []redactRule, s string) string {
+	for _, rule := range rules {
+		s = rule.re.ReplaceAllString(s, rule.repl)
+	}
+	return s
+}
+
+// redactMessages 返回脱敏后的消息副本，工具调用的参数也会脱敏，附带的图片会被去掉
+// rules: 脱敏规则
+// messages: 对话消息
+func redactMessages(rules []redactRule, messages []proto.Message) []proto.Message {
+	out := make([]proto.Message, len(messages))
+	for i, msg := range messages {
+		msg.Content = redactText(rules, msg.Content)
+		msg.Images = nil
+		calls := make([]proto.ToolCall, len(msg.ToolCalls))
+		for j, call := range msg.ToolCalls {
+			call.Function.Arguments = []byte(redactText(rules, string(call.Function.Arguments)))
+			calls[j] = call
+		}
+		msg.ToolCalls = calls
+		out[i] = msg
+	}
+	return out
+}
+
+// shareConversation 按 --redact 和 --encrypt 设置导出对话，便于把对话发给外部人员
+// w: 输出目标
+// title: 对话标题
+// messages: 对话消息
+// 返回：错误信息
+func shareConversation(w io.Writer, title string, messages []proto.Message) error {
+	if config.Redact {
+		rules, err := redactRules(config.RedactPatterns)
+		if err != nil {
+			return err
+		}
+		title = redactText(rules, title)
+		messages = redactMessages(rules, messages)
+	}
+	if !config.Encrypt {
+		return exportConversation(w, config.ExportFormat, title, messages)
+	}
+
+	passphrase, err := exportPassphrase()
+	if err != nil {
+		return err
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return fmt.Errorf("无法使用口令: %w", err)
+	}
+	aw := armor.NewWriter(w)
+	ew, err := age.Encrypt(aw, recipient)
+	if err != nil {
+		return fmt.Errorf("无法加密: %w", err)
+	}
+	if err := exportConversation(ew, config.ExportFormat, title, messages); err != nil {
+		return err
+	}
+	if err := ew.Close(); err != nil {
+		return fmt.Errorf("无法加密: %w", err)
+	}
+	return aw.Close() //nolint:wrapcheck
+}
+
+// exportPassphrase 返回加密使用的口令：优先读取环境变量，否则在终端中输入两次
+func exportPassphrase() (string, error) {
+	if pass := os.Getenv(exportPassphraseEnv); pass != "" {
+		return pass, nil
+	}
+	if config.NoInput || !isInputTTY() {
+		return "", noInputError("输入口令", fmt.Sprintf("可以用环境变量 %s 提供口令", exportPassphraseEnv))
+	}
+	pass, err := readPassphrase("口令: ")
+	if err != nil {
+		return "", err
+	}
+	if pass == "" {
+		return "", errors.New("口令不能为空")
+	}
+	again, err := readPassphrase("再次输入口令: ")
+	if err != nil {
+		return "", err
+	}
+	if again != pass {
+		return "", errors.New("两次输入的口令不一致")
+	}
+	return pass, nil
+}
+
+// readPassphrase 在标准错误上提示，并从终端读取不回显的口令
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	bts, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("无法读取口令: %w", err)
+	}
+	return string(bts), nil
+}
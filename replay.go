@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// redacted 替换保存的请求中的密钥
+const redacted = "REDACTED"
+
+// savedRequest 是 --save-request 保存的请求，可以用 --replay-request 重新发送
+type savedRequest struct {
+	API     string          `json:"api"`               // API 名称
+	Model   string          `json:"model"`             // 模型名称
+	Version string          `json:"version,omitempty"` // 生成请求的 mods 版本
+	Method  string          `json:"method"`            // HTTP 方法
+	URL     string          `json:"url"`               // 请求地址，查询参数中的密钥已脱敏
+	Header  http.Header     `json:"header"`            // 请求头，认证相关的值已脱敏
+	Body    json.RawMessage `json:"body"`              // 请求体
+}
+
+// requestRecorder 记录发送给 API 的 HTTP 请求并保存到文件
+// 工具调用会产生多轮请求，文件中保留最后一次，即包含完整对话的请求
+type requestRecorder struct {
+	path  string
+	api   string
+	model string
+
+	mu sync.Mutex
+}
+
+// client 返回记录请求的 HTTP 客户端，沿用 c 的设置（如代理）
+// c: 原来的客户端，为空时使用默认客户端
+func (r *requestRecorder) client(c *http.Client) *http.Client {
+	return withRequestHook(c, r.record)
+}
+
+// withRequestHook 返回在发送每个请求前调用 hook 的 HTTP 客户端，沿用 c 的设置（如代理）。
+// hook 返回错误时不发送请求
+// c: 原来的客户端，为空时使用默认客户端
+func withRequestHook(c *http.Client, hook func(*http.Request) error) *http.Client {
+	if c == nil {
+		c = &http.Client{}
+	}
+	rc := *c
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	rc.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if err := hook(req); err != nil {
+			return nil, err
+		}
+		return base.RoundTrip(req) //nolint:wrapcheck
+	})
+	return &rc
+}
+
+// roundTripperFunc 将函数适配为 http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip 实现 http.RoundTripper 接口
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// record 读取请求体并将脱敏后的请求写入文件，请求体会被还原以便继续发送
+func (r *requestRecorder) record(req *http.Request) error {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+
+	saved := savedRequest{
+		API:     r.api,
+		Model:   r.model,
+		Version: Version,
+		Method:  req.Method,
+		URL:     redactURL(req.URL),
+		Header:  redactHeader(req.Header),
+		Body:    body,
+	}
+	if !json.Valid(body) {
+		// 请求体不是 JSON 时以字符串保存
+		saved.Body, _ = json.Marshal(string(body))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return writeJSONFile(r.path, saved)
+}
+
+// readRequestBody 读取请求体，并将其还原以便继续发送
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("无法读取请求体: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// isSecretHeader 判断请求头是否可能包含密钥
+func isSecretHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"auth", "key", "token", "secret", "cookie", "signature"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeader 返回认证相关的值被替换后的请求头
+func redactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for name := range out {
+		if isSecretHeader(name) {
+			out[name] = []string{redacted}
+		}
+	}
+	return out
+}
+
+// redactURL 返回查询参数中的密钥被替换后的地址
+func redactURL(u *url.URL) string {
+	ru := *u
+	ru.User = nil
+	q := ru.Query()
+	for name := range q {
+		if isSecretHeader(name) {
+			q.Set(name, redacted)
+		}
+	}
+	ru.RawQuery = q.Encode()
+	return ru.String()
+}
+
+// apiKeySource 是 API 默认读取密钥的环境变量和获取密钥的地址
+type apiKeySource struct {
+	env  string
+	docs string
+}
+
+// apiKeySources 是各 API 的密钥来源，与 startCompletionCmd 中的一致
+var apiKeySources = map[string]apiKeySource{
+	"openai":    {"OPENAI_API_KEY", "https://platform.openai.com/account/api-keys"},
+	"anthropic": {"ANTHROPIC_API_KEY", "https://console.anthropic.com/settings/keys"},
+	"google":    {"GOOGLE_API_KEY", "https://aistudio.google.com/app/apikey"},
+	"cohere":    {"COHERE_API_KEY", "https://dashboard.cohere.com/api-keys"},
+	"azure":     {"AZURE_OPENAI_KEY", "https://aka.ms/oai/access"},
+	"azure-ad":  {"AZURE_OPENAI_KEY", "https://aka.ms/oai/access"},
+}
+
+// replayRequest 重新发送 --save-request 保存的请求，将 API 的原始响应写到标准输出
+// ctx: 上下文
+// path: 保存的请求文件
+// 返回：错误信息
+func replayRequest(ctx context.Context, path string) error {
+	var saved savedRequest
+	if err := readJSONFile(path, &saved); err != nil {
+		return modsError{err, fmt.Sprintf("无法读取 %s。", path)}
+	}
+	body := []byte(saved.Body)
+	var s string
+	if json.Unmarshal(body, &s) == nil {
+		body = []byte(s)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, saved.Method, saved.URL, bytes.NewReader(body))
+	if err != nil {
+		return modsError{err, "无效的请求文件。"}
+	}
+	req.Header = saved.Header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Del("Content-Length")
+	if err := fillSecrets(req, saved.API); err != nil {
+		return err
+	}
+
+	client := &http.Client{}
+	if config.HTTPProxy != "" {
+		proxyURL, err := url.Parse(config.HTTPProxy)
+		if err != nil {
+			return modsError{err, "解析代理 URL 时出错。"}
+		}
+		client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+	}
+	// 签名的请求头已经脱敏，重新签名
+	if api, ok := findAPI(saved.API); ok {
+		client, err = signRequests(client, api)
+		if err != nil {
+			return err
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return modsError{err, "重放请求失败。"}
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(resp.Body)
+		return modsError{
+			fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg))),
+			fmt.Sprintf("%s API 返回了错误。", saved.API),
+		}
+	}
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		return modsError{err, "读取响应失败。"}
+	}
+	return nil
+}
+
+// fillSecrets 使用当前配置中的密钥替换请求中脱敏的值
+func fillSecrets(req *http.Request, apiName string) error {
+	var names []string
+	for name, values := range req.Header {
+		if len(values) == 1 && values[0] == redacted {
+			names = append(names, name)
+		}
+	}
+	q := req.URL.Query()
+	var params []string
+	for name := range q {
+		if q.Get(name) == redacted {
+			params = append(params, name)
+		}
+	}
+	if len(names) == 0 && len(params) == 0 {
+		return nil
+	}
+
+	api, ok := findAPI(apiName)
+	if !ok {
+		return modsError{
+			fmt.Errorf("配置中没有 API %q", apiName),
+			"无法重放请求。",
+		}
+	}
+	src, ok := apiKeySources[apiName]
+	if !ok && api.APIKey == "" && api.APIKeyEnv == "" && api.APIKeyCmd == "" {
+		// bedrock 与 vertex 的请求使用签名或临时令牌，无法直接重放
+		return modsError{
+			fmt.Errorf("%s 的请求不使用 API 密钥认证", apiName),
+			"无法重放请求。",
+		}
+	}
+	if !ok {
+		src = apiKeySources["openai"]
+	}
+	key, err := Mods{Styles: stderrStyles()}.ensureKey(api, src.env, src.docs)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if strings.EqualFold(name, "Authorization") {
+			req.Header.Set(name, "Bearer "+key)
+			continue
+		}
+		req.Header.Set(name, key)
+	}
+	for _, name := range params {
+		q.Set(name, key)
+	}
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+// findAPI 按名称查找配置的 API
+func findAPI(name string) (API, bool) {
+	for _, api := range config.APIs {
+		if api.Name == name {
+			return api, true
+		}
+	}
+	return API{}, false
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestRecorder(t *testing.T) {
+	var gotAuth, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		bts, _ := io.ReadAll(r.Body)
+		gotBody = string(bts)
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "req.json")
+	rec := &requestRecorder{path: path, api: "test", model: "m"}
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/chat?key=secret&alt=sse", strings.NewReader(`{"model":"m"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Api-Key", "secret")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := rec.client(nil).Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	t.Run("请求照常发送", func(t *testing.T) {
+		require.Equal(t, "Bearer secret", gotAuth)
+		require.Equal(t, `{"model":"m"}`, gotBody)
+	})
+
+	t.Run("保存的请求已脱敏", func(t *testing.T) {
+		var saved savedRequest
+		require.NoError(t, readJSONFile(path, &saved))
+		require.Equal(t, "test", saved.API)
+		require.Equal(t, "m", saved.Model)
+		require.Equal(t, http.MethodPost, saved.Method)
+		require.JSONEq(t, `{"model":"m"}`, string(saved.Body))
+		require.Equal(t, redacted, saved.Header.Get("Authorization"))
+		require.Equal(t, redacted, saved.Header.Get("X-Api-Key"))
+		require.Equal(t, "application/json", saved.Header.Get("Content-Type"))
+
+		u, err := url.Parse(saved.URL)
+		require.NoError(t, err)
+		require.Equal(t, redacted, u.Query().Get("key"))
+		require.Equal(t, "sse", u.Query().Get("alt"))
+	})
+
+	t.Run("SigV4 签名已脱敏", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("Authorization", "AWS4-HMAC-SHA256 Credential=AKID/20260101/us-east-1/bedrock/aws4_request, Signature=abc")
+		h.Set("X-Amz-Security-Token", "session")
+		h.Set("X-Amz-Date", "20260101T000000Z")
+		out := redactHeader(h)
+		require.Equal(t, redacted, out.Get("Authorization"))
+		require.Equal(t, redacted, out.Get("X-Amz-Security-Token"))
+		require.Equal(t, "20260101T000000Z", out.Get("X-Amz-Date"))
+	})
+}
+
+func TestReplayRequest(t *testing.T) {
+	var gotAuth, gotKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotKey = r.URL.Query().Get("key")
+		if r.URL.Path == "/fail" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	oldAPIs := config.APIs
+	t.Cleanup(func() { config.APIs = oldAPIs })
+	config.APIs = APIs{{Name: "test", APIKey: "secret"}}
+
+	save := func(t *testing.T, saved savedRequest) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "req.json")
+		require.NoError(t, writeJSONFile(path, saved))
+		return path
+	}
+
+	t.Run("填入当前配置的密钥", func(t *testing.T) {
+		path := save(t, savedRequest{
+			API:    "test",
+			Method: http.MethodPost,
+			URL:    srv.URL + "/ok?key=" + redacted,
+			Header: http.Header{"Authorization": {redacted}},
+			Body:   []byte(`{}`),
+		})
+		require.NoError(t, replayRequest(t.Context(), path))
+		require.Equal(t, "Bearer secret", gotAuth)
+		require.Equal(t, "secret", gotKey)
+	})
+
+	t.Run("API 返回错误", func(t *testing.T) {
+		path := save(t, savedRequest{
+			API:    "test",
+			Method: http.MethodPost,
+			URL:    srv.URL + "/fail",
+			Body:   []byte(`{}`),
+		})
+		require.Error(t, replayRequest(t.Context(), path))
+	})
+
+	t.Run("配置中没有该 API", func(t *testing.T) {
+		path := save(t, savedRequest{
+			API:    "missing",
+			Method: http.MethodPost,
+			URL:    srv.URL + "/ok",
+			Header: http.Header{"Authorization": {redacted}},
+			Body:   []byte(`{}`),
+		})
+		require.Error(t, replayRequest(t.Context(), path))
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// defaultMaxRequestSize 是请求体大小的默认上限
+const defaultMaxRequestSize = 10 * megabyte
+
+// requestTooLargeError 表示请求体超过了 max-request-size
+type requestTooLargeError struct {
+	size  byteSize // 请求体大小
+	limit byteSize // 上限
+}
+
+// Error 返回错误消息
+func (e requestTooLargeError) Error() string {
+	return fmt.Sprintf(
+		"请求体大小为 %s，超过了上限 %s；可以用 --max-request-size 调整上限，-1 表示不限制",
+		e.size, e.limit,
+	)
+}
+
+// limitRequestSize 返回拒绝过大请求体的 HTTP 客户端，沿用 c 的设置（如代理）。
+// 过大的请求会在上传前被拒绝，而不是上传完之后才收到 413
+// c: 原来的客户端，为空时使用默认客户端
+// limit: 请求体大小的上限
+func limitRequestSize(c *http.Client, limit byteSize) *http.Client {
+	return withRequestHook(c, checkRequestSize(limit))
+}
+
+// checkRequestSize 返回检查请求体大小的函数，请求体超过 limit 时返回 requestTooLargeError
+// limit: 请求体大小的上限
+func checkRequestSize(limit byteSize) func(*http.Request) error {
+	return func(req *http.Request) error {
+		size := byteSize(req.ContentLength)
+		if size <= 0 {
+			body, err := readRequestBody(req)
+			if err != nil {
+				return err
+			}
+			size = byteSize(len(body))
+		}
+		if size > limit {
+			return requestTooLargeError{size, limit}
+		}
+		return nil
+	}
+}
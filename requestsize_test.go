@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitRequestSize(t *testing.T) {
+	var called bool
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}))
+	t.Cleanup(srv.Close)
+	client := limitRequestSize(nil, 8)
+
+	t.Run("没有超出上限", func(t *testing.T) {
+		resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("12345678"))
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.True(t, called)
+	})
+
+	t.Run("超出上限时不发送", func(t *testing.T) {
+		called = false
+		_, err := client.Post(srv.URL, "text/plain", strings.NewReader("123456789"))
+		var tooLarge requestTooLargeError
+		require.ErrorAs(t, err, &tooLarge)
+		require.Equal(t, byteSize(9), tooLarge.size)
+		require.False(t, called)
+	})
+}
+
+func TestBedrockRequestSize(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	var called bool
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}))
+	t.Cleanup(srv.Close)
+
+	m := &Mods{Config: &Config{MaxRequestSize: 8}, ctx: context.Background()}
+	api := API{Name: "bedrock", Region: "us-east-1", BaseURL: srv.URL}
+	client, err := m.newClient(m.Config, api, Model{API: "bedrock", Name: "m"})
+	require.NoError(t, err)
+	s := client.Request(context.Background(), proto.Request{
+		Messages: []proto.Message{{Role: proto.RoleUser, Content: "hi"}},
+		Model:    "m",
+	})
+	require.False(t, s.Next())
+	var tooLarge requestTooLargeError
+	require.ErrorAs(t, s.Err(), &tooLarge)
+	require.False(t, called)
+	require.NoError(t, s.Close())
+}
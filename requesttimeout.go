@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+// roundContext 是模型请求的上下文，request-timeout 对每一轮请求单独计时。
+// 执行工具（包括等待用户确认）期间暂停计时，工具结束后下一轮请求重新计时，
+// 超时后 Err 返回 context.DeadlineExceeded
+type roundContext struct {
+	context.Context // 父上下文
+
+	timeout time.Duration
+	done    chan struct{}
+	stop    func() bool // 停止监听父上下文
+
+	mu    sync.Mutex
+	err   error
+	timer *time.Timer
+	tools int // 正在执行的工具调用数
+}
+
+// newRoundContext 创建按轮次计时的上下文，父上下文取消时一并取消
+// parent: 父上下文
+// timeout: 每一轮请求的超时时间
+func newRoundContext(parent context.Context, timeout time.Duration) *roundContext {
+	c := &roundContext{
+		Context: parent,
+		timeout: timeout,
+		done:    make(chan struct{}),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timer = time.AfterFunc(timeout, func() { c.cancel(context.DeadlineExceeded) })
+	c.stop = context.AfterFunc(parent, func() { c.cancel(context.Cause(parent)) })
+	return c
+}
+
+// Done 实现 context.Context 接口
+func (c *roundContext) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err 实现 context.Context 接口
+func (c *roundContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// cancel 以 err 为原因取消上下文，重复调用时保留第一次的原因
+func (c *roundContext) cancel(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.timer.Stop()
+	close(c.done)
+	c.stop()
+}
+
+// toolCaller 包装工具调用器，工具执行期间暂停计时，所有并发的工具结束后重新开始计时
+// caller: 原来的工具调用器
+func (c *roundContext) toolCaller(
+	caller func(name string, data []byte) (string, error),
+) func(name string, data []byte) (string, error) {
+	return func(name string, data []byte) (string, error) {
+		c.mu.Lock()
+		c.tools++
+		c.timer.Stop()
+		c.mu.Unlock()
+
+		defer func() {
+			c.mu.Lock()
+			c.tools--
+			if c.tools == 0 && c.err == nil {
+				c.timer.Reset(c.timeout)
+			}
+			c.mu.Unlock()
+		}()
+		return caller(name, data)
+	}
+}
+
+// requestContext 返回一次模型请求使用的上下文。设置了 request-timeout 时每一轮请求在超时后取消，
+// 并包装 request 的工具调用器，让工具执行的时间不计入超时
+// request: 要发送的请求
+func (m *Mods) requestContext(request *proto.Request) context.Context {
+	if m.Config.RequestTimeout <= 0 {
+		return m.ctx
+	}
+	ctx := newRoundContext(m.ctx, time.Duration(m.Config.RequestTimeout))
+	m.addCancel(func() { ctx.cancel(context.Canceled) })
+	if request.ToolCaller != nil {
+		request.ToolCaller = ctx.toolCaller(request.ToolCaller)
+	}
+	return ctx
+}
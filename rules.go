@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RoleRule 是 rules 中的一项：输入符合所有设置的条件时自动使用的角色
+type RoleRule struct {
+	Role        string   `yaml:"role"`         // 使用的角色
+	Ext         []string `yaml:"ext"`          // --apply 或 --attach 文件的扩展名之一，如 .go
+	StdinPrefix string   `yaml:"stdin-prefix"` // 标准输入去掉开头的空白后以此开头
+	Match       string   `yaml:"match"`        // 匹配标准输入或提示的正则表达式
+}
+
+// ruleInput 是用于匹配 rules 的输入特征
+type ruleInput struct {
+	files  []string // --apply 和 --attach 的文件
+	stdin  string   // 标准输入
+	prompt string   // 命令行中的提示
+}
+
+// validateRules 检查 rules 设置：每一项都要有角色和至少一个条件，正则表达式要能编译
+func validateRules(rules []RoleRule) error {
+	for i, rule := range rules {
+		if strings.TrimSpace(rule.Role) == "" {
+			return fmt.Errorf("第 %d 条规则没有设置 role", i+1)
+		}
+		if len(rule.Ext) == 0 && rule.StdinPrefix == "" && rule.Match == "" {
+			return fmt.Errorf("第 %d 条规则（%s）没有设置 ext、stdin-prefix 或 match", i+1, rule.Role)
+		}
+		if _, err := regexp.Compile(rule.Match); err != nil {
+			return fmt.Errorf("第 %d 条规则（%s）的 match 不是有效的正则表达式: %w", i+1, rule.Role, err)
+		}
+	}
+	return nil
+}
+
+// matchRoleRule 按顺序返回第一条符合输入的规则的角色
+// rules: rules 设置
+// in: 输入特征
+// 返回：角色，没有符合的规则时返回 false
+func matchRoleRule(rules []RoleRule, in ruleInput) (string, bool) {
+	for _, rule := range rules {
+		if ruleMatches(rule, in) {
+			return rule.Role, true
+		}
+	}
+	return "", false
+}
+
+// ruleMatches 判断输入是否符合一条规则的所有条件
+func ruleMatches(rule RoleRule, in ruleInput) bool {
+	if len(rule.Ext) > 0 && !slices.ContainsFunc(in.files, func(file string) bool {
+		return slices.ContainsFunc(rule.Ext, func(ext string) bool {
+			return strings.EqualFold(filepath.Ext(file), "."+strings.TrimPrefix(ext, "."))
+		})
+	}) {
+		return false
+	}
+	if rule.StdinPrefix != "" && !strings.HasPrefix(strings.TrimLeft(in.stdin, " \t\r\n"), rule.StdinPrefix) {
+		return false
+	}
+	if rule.Match != "" {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil || !re.MatchString(in.stdin) && !re.MatchString(in.prompt) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyRoleRules 在没有指定角色时按 rules 选择角色
+// content: 标准输入的内容（每行带有缩进）
+func (m *Mods) applyRoleRules(content string) error {
+	cfg := m.Config
+	if cfg.Role != "" || cfg.NoRules || len(cfg.Rules) == 0 || cfg.cacheReadFromID != "" {
+		return nil
+	}
+	files := slices.Clone(cfg.Images)
+	if cfg.Apply != "" {
+		files = append(files, cfg.Apply)
+	}
+	role, ok := matchRoleRule(cfg.Rules, ruleInput{
+		files:  files,
+		stdin:  decreaseIndent(content),
+		prompt: cfg.Prefix,
+	})
+	if !ok {
+		return nil
+	}
+	if _, exists := cfg.Roles[role]; !exists {
+		return modsError{fmt.Errorf("rules 中的角色 %q 不存在", role), "无法使用角色"}
+	}
+	cfg.Role = role
+	m.notice(fmt.Sprintf("按 rules 使用角色 %s。", role))
+	return nil
+}
+
+// decreaseIndent 去掉 increaseIndent 给每行加上的缩进
+func decreaseIndent(s string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(s, "\t"), "\n\t", "\n")
+}
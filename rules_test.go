@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchRoleRule(t *testing.T) {
+	rules := []RoleRule{
+		{Role: "reviewer", StdinPrefix: "diff --git"},
+		{Role: "coder", Ext: []string{".go", "rs"}},
+		{Role: "oncall", Match: `(?i)traceback|panic:`},
+		{Role: "both", Ext: []string{".py"}, Match: "^fix"},
+	}
+
+	for name, tc := range map[string]struct {
+		in   ruleInput
+		role string
+	}{
+		"标准输入的开头": {ruleInput{stdin: "\n  diff --git a/x b/x\n"}, "reviewer"},
+		"扩展名":     {ruleInput{files: []string{"main.GO"}}, "coder"},
+		"不带点的扩展名": {ruleInput{files: []string{"x/lib.rs"}}, "coder"},
+		"匹配提示":    {ruleInput{prompt: "what is this Traceback"}, "oncall"},
+		"匹配标准输入":  {ruleInput{stdin: "goroutine 1\npanic: boom"}, "oncall"},
+		"所有条件":    {ruleInput{files: []string{"a.py"}, prompt: "fix it"}, "both"},
+		"按顺序":     {ruleInput{files: []string{"a.go"}, stdin: "diff --git"}, "reviewer"},
+		"没有符合的规则": {ruleInput{files: []string{"a.py"}, prompt: "explain"}, ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			role, ok := matchRoleRule(rules, tc.in)
+			require.Equal(t, tc.role != "", ok)
+			require.Equal(t, tc.role, role)
+		})
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	require.NoError(t, validateRules(nil))
+	require.NoError(t, validateRules([]RoleRule{{Role: "a", Match: "x+"}}))
+	require.ErrorContains(t, validateRules([]RoleRule{{Match: "x"}}), "role")
+	require.ErrorContains(t, validateRules([]RoleRule{{Role: "a"}}), "没有设置")
+	require.ErrorContains(t, validateRules([]RoleRule{{Role: "a", Match: "("}}), "正则表达式")
+}
+
+func TestDecreaseIndent(t *testing.T) {
+	for _, s := range []string{"", "a", "a\n\tb\n", "diff --git\n+x"} {
+		require.Equal(t, s, decreaseIndent(increaseIndent(s)))
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/mods/internal/openai"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/stream"
+)
+
+// pickPrompt 要求模型从多个回答中选出最好的一个
+const pickPrompt = "你是严格的评审。下面是同一个问题和对它的多个编号的回答，" +
+	"选出最准确、最完整并且遵循了问题要求的一个，只回复它的编号。"
+
+// pickMaxTokens 是评审回复的最大令牌数
+const pickMaxTokens int64 = 16
+
+// sampleResult 是一次额外采样的结果
+type sampleResult struct {
+	content string
+	usage   proto.Usage
+	err     error
+}
+
+// startSamples 与第一次请求同时并发发送 samples-1 个相同的请求
+// client: 流式客户端
+// request: 第一次请求
+func (m *Mods) startSamples(client stream.Client, request proto.Request) {
+	n := m.Config.Samples - 1
+	m.samples = make(chan sampleResult, n)
+	// 额外的采样不在界面中显示，工具调用随请求一起取消
+	request.ToolCaller = func(name string, data []byte) (string, error) {
+		return m.callTool(m.ctx, name, data)
+	}
+	for range n {
+		go func() {
+			request := request
+			s := client.Request(m.requestContext(&request), request)
+			defer s.Close() //nolint:errcheck
+			content, err := readStream(s)
+			m.samples <- sampleResult{content, s.Usage(), err}
+		}()
+	}
+}
+
+// supportsN 判断 API 是否支持用 n 参数一次生成多个回答。OpenAI 和 Azure 总是支持，
+// 其他 OpenAI 兼容的 API 需要在设置中用 supports-n 开启
+// api: API 配置
+// client: API 的客户端
+func supportsN(api API, client stream.Client) bool {
+	if _, ok := client.(*openai.Client); !ok {
+		return false
+	}
+	switch api.Name {
+	case "openai", "azure", "azure-ad":
+		return true
+	}
+	return api.SupportsN
+}
+
+// collectAlternatives 把用 n 参数一次生成的其余回答交给 pickSample，
+// API 返回的回答不够时，缺少的样本记为失败
+// s: 已结束的流
+func (m *Mods) collectAlternatives(s stream.Stream) {
+	if !m.nativeSamples {
+		return
+	}
+	m.nativeSamples = false
+	var alts []string
+	if a, ok := s.(stream.Alternatives); ok {
+		alts = a.Alternatives()
+	}
+	for i := range m.Config.Samples - 1 {
+		if i < len(alts) {
+			m.samples <- sampleResult{content: alts[i]}
+			continue
+		}
+		m.samples <- sampleResult{err: errors.New("API 没有返回这个样本")}
+	}
+}
+
+// readStream 读取流中的全部内容
+func readStream(s stream.Stream) (string, error) {
+	var sb strings.Builder
+	for s.Next() {
+		chunk, err := s.Current()
+		if err != nil && !errors.Is(err, stream.ErrNoContent) {
+			return "", err //nolint:wrapcheck
+		}
+		sb.WriteString(chunk.Content)
+	}
+	return sb.String(), s.Err() //nolint:wrapcheck
+}
+
+// pickSample 等待所有采样完成，按 --pick 选出最终的回答。
+// 设置了 --keep-all 时保留其余的回答，保存对话时一起保存
+// ctx: 上下文
+// mods: 已完成第一次请求的模型
+// 返回：错误信息
+func pickSample(ctx context.Context, mods *Mods) error {
+	if mods.samples == nil {
+		return nil
+	}
+	answers := []string{mods.Output}
+	var failed int
+	for range mods.Config.Samples - 1 {
+		res := <-mods.samples
+		mods.addUsage(res.usage)
+		if res.err != nil || strings.TrimSpace(res.content) == "" {
+			failed++
+			continue
+		}
+		answers = append(answers, res.content)
+	}
+	if failed > 0 && !mods.Config.Quiet {
+		fmt.Fprintln(os.Stderr, stderrStyles().Comment.Render(fmt.Sprintf("%d 个样本请求失败，已忽略。", failed)))
+	}
+
+	best := 0
+	switch {
+	case len(answers) == 1:
+	case mods.Config.Pick == "all":
+		mods.Output = joinAnswers(answers)
+		mods.messages = withLastAnswer(mods.messages, mods.Output)
+		return nil
+	case mods.Config.Pick == "ask":
+		var err error
+		var ok bool
+		best, ok, err = mods.askPick(answers)
+		if err != nil || !ok {
+			return err
+		}
+	case mods.Config.Pick == "best":
+		var err error
+		best, err = mods.pickBest(ctx, answers)
+		if err != nil {
+			return err
+		}
+	default:
+		best = pickVote(answers)
+	}
+
+	mods.Output = answers[best]
+	mods.messages = withLastAnswer(mods.messages, answers[best])
+	if mods.Config.KeepAll {
+		for i, answer := range answers {
+			if i != best {
+				mods.otherSamples = append(mods.otherSamples, answer)
+			}
+		}
+	}
+	return nil
+}
+
+// pickVote 按最后一行的答案投票，返回得票最多的回答中最早的一个
+func pickVote(answers []string) int {
+	keys := make([]string, len(answers))
+	counts := make(map[string]int, len(answers))
+	for i, answer := range answers {
+		keys[i] = voteKey(answer)
+		counts[keys[i]]++
+	}
+	best := 0
+	for i, key := range keys {
+		if counts[key] > counts[keys[best]] {
+			best = i
+		}
+	}
+	return best
+}
+
+// voteKey 返回回答最后一个非空行的规范形式，推理过程不同但结论相同的回答得到相同的键
+func voteKey(answer string) string {
+	lines := strings.Split(strings.TrimSpace(answer), "\n")
+	line := strings.Join(strings.Fields(lines[len(lines)-1]), " ")
+	line = strings.Trim(line, "*`_ ")
+	line = strings.TrimRight(line, "。.!！")
+	return strings.ToLower(line)
+}
+
+// joinAnswers 把所有回答依次放在编号的标题下面，用于 --pick all
+func joinAnswers(answers []string) string {
+	var sb strings.Builder
+	for i, answer := range answers {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "## 回答 %d\n\n%s", i+1, strings.TrimSpace(answer))
+	}
+	return sb.String()
+}
+
+// askPick 处理 --pick ask：在终端中用编号分节展示所有回答，由用户选择写入对话的一个。
+// 输出不是终端时把所有回答作为 JSON 数组输出；无法交互时保留所有回答
+// answers: 所有回答
+// 返回：选出的下标，没有选择时返回 false，以及错误信息
+func (m *Mods) askPick(answers []string) (int, bool, error) {
+	if !isOutputTTY() || m.Config.Raw {
+		bts, err := json.MarshalIndent(answers, "", "  ")
+		if err != nil {
+			return 0, false, modsError{err, "无法编码回答。"}
+		}
+		m.Output = string(bts)
+		m.messages = withLastAnswer(m.messages, joinAnswers(answers))
+		return 0, false, nil
+	}
+	if !canPrompt() {
+		m.Output = joinAnswers(answers)
+		m.messages = withLastAnswer(m.messages, m.Output)
+		return 0, false, nil
+	}
+
+	sections := joinAnswers(answers)
+	if gr, err := glamour.NewTermRenderer(glamourStyle(), glamour.WithWordWrap(m.Config.WordWrap)); err == nil {
+		if out, err := gr.Render(sections); err == nil {
+			sections = out
+		}
+	}
+	fmt.Fprintln(os.Stderr, sections)
+
+	options := make([]huh.Option[int], len(answers))
+	for i, answer := range answers {
+		options[i] = huh.NewOption(fmt.Sprintf("回答 %d：%s", i+1, firstLine(strings.TrimSpace(answer))), i)
+	}
+	var picked int
+	if err := huh.Run(huh.NewSelect[int]().Title("选择写入对话的回答").Options(options...).Value(&picked)); err != nil {
+		if errors.Is(err, huh.ErrUserAborted) {
+			return 0, false, newUserErrorf("用户中止")
+		}
+		return 0, false, modsError{err, "无法选择回答。"}
+	}
+	return picked, true, nil
+}
+
+// pickBest 让评审模型评审所有回答，返回它选出的回答的下标。
+// 没有设置 --judge 时由回答问题的模型评审
+// ctx: 上下文
+// answers: 所有回答
+// 返回：选出的下标和错误信息
+func (m *Mods) pickBest(ctx context.Context, answers []string) (int, error) {
+	var sb strings.Builder
+	if rest, prompt, ok := splitLastExchange(m.messages); ok {
+		question := append(slices.Clip(rest[:systemPrefix(rest)]), prompt)
+		sb.WriteString(proto.Conversation(question).String())
+	}
+	for i, answer := range answers {
+		fmt.Fprintf(&sb, "\n\n## 回答 %d\n\n%s", i+1, answer)
+	}
+	cfg := *m.Config
+	if cfg.Judge != "" {
+		cfg.API, cfg.Model = "", cfg.Judge
+	}
+	reply, err := m.askWith(ctx, &cfg, pickPrompt, sb.String(), pickMaxTokens)
+	if err != nil {
+		return 0, modsError{err, "无法评审回答。"}
+	}
+	return parsePick(reply, len(answers)), nil
+}
+
+// pickNumber 匹配评审回复中的编号
+var pickNumber = regexp.MustCompile(`\d+`)
+
+// parsePick 解析评审回复中的编号，无法识别时选择第一个回答
+func parsePick(reply string, n int) int {
+	i, err := strconv.Atoi(pickNumber.FindString(reply))
+	if err != nil || i < 1 || i > n {
+		return 0
+	}
+	return i - 1
+}
+
+// withLastAnswer 把对话中最后一条助手消息的内容替换为选出的回答
+func withLastAnswer(messages []proto.Message, answer string) []proto.Message {
+	messages = slices.Clone(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == proto.RoleAssistant && messages[i].Content != "" {
+			messages[i].Content = answer
+			break
+		}
+	}
+	return messages
+}
+
+// saveSamples 把没有选中的回答分别保存为新的对话
+// mods: 已保存对话的模型
+// 返回：错误信息
+func saveSamples(mods *Mods) error {
+	if config.NoCache || len(mods.otherSamples) == 0 {
+		return nil
+	}
+	title := strings.TrimSpace(config.cacheWriteToTitle)
+	if sha1reg.MatchString(title) || title == "" {
+		title = firstLine(lastPrompt(mods.messages))
+	}
+	for i, answer := range mods.otherSamples {
+		id := newConversationID()
+		sampleTitle := fmt.Sprintf("%s（样本 %d）", title, i+2)
+		messages := withLastAnswer(mods.messages, answer)
+		if err := mods.cache.Write(id, &messages); err != nil {
+			return modsError{err, "无法保存其余的样本。"}
+		}
+		if err := mods.db.Save(id, sampleTitle, config.API, config.Model); err != nil {
+			_ = mods.cache.Delete(id)
+			return modsError{err, "无法保存其余的样本。"}
+		}
+		if !config.Quiet {
+			fmt.Fprintln(
+				os.Stderr,
+				"样本已保存:",
+				stderrStyles().InlineCode.Render(shortID(id)),
+				stderrStyles().Comment.Render(sampleTitle),
+			)
+		}
+	}
+	return nil
+}
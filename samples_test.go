@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/openai"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/charmbracelet/mods/internal/stream"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickVote(t *testing.T) {
+	t.Run("按最后一行投票", func(t *testing.T) {
+		require.Equal(t, 1, pickVote([]string{
+			"先算乘法。\n答案：41",
+			"3 * 14 = 42\n答案：42",
+			"**答案：42。**",
+		}))
+	})
+
+	t.Run("平票时选择最早的回答", func(t *testing.T) {
+		require.Equal(t, 0, pickVote([]string{"a", "b", "B", "A"}))
+	})
+
+	t.Run("忽略空白和大小写", func(t *testing.T) {
+		require.Equal(t, voteKey("The  answer is Paris.\n"), voteKey("the answer is paris"))
+	})
+}
+
+func TestParsePick(t *testing.T) {
+	require.Equal(t, 1, parsePick("2", 3))
+	require.Equal(t, 2, parsePick("回答 3 最好。", 3))
+	require.Equal(t, 0, parsePick("4", 3))
+	require.Equal(t, 0, parsePick("都不好", 3))
+}
+
+func TestPickSample(t *testing.T) {
+	cfg := Config{Samples: 4, Pick: "vote", KeepAll: true, Quiet: true}
+	mods := &Mods{
+		Config: &cfg,
+		Output: "x = 1",
+		messages: []proto.Message{
+			{Role: proto.RoleUser, Content: "x 等于几？"},
+			{Role: proto.RoleAssistant, Content: "x = 1"},
+		},
+		samples: make(chan sampleResult, 3),
+	}
+	mods.samples <- sampleResult{content: "x = 2", usage: proto.Usage{OutputTokens: 3}}
+	mods.samples <- sampleResult{err: errors.New("timeout")}
+	mods.samples <- sampleResult{content: "推导过程\nx = 2", usage: proto.Usage{OutputTokens: 5}}
+
+	require.NoError(t, pickSample(context.Background(), mods))
+	require.Equal(t, "x = 2", mods.Output)
+	require.Equal(t, "x = 2", mods.messages[1].Content)
+	require.Equal(t, []string{"x = 1", "推导过程\nx = 2"}, mods.otherSamples)
+	require.Equal(t, int64(8), mods.usage.OutputTokens)
+}
+
+func TestPickSampleAll(t *testing.T) {
+	cfg := Config{Samples: 2, Pick: "all", KeepAll: true, Quiet: true}
+	mods := &Mods{
+		Config: &cfg,
+		Output: "甲",
+		messages: []proto.Message{
+			{Role: proto.RoleUser, Content: "问题"},
+			{Role: proto.RoleAssistant, Content: "甲"},
+		},
+		samples: make(chan sampleResult, 1),
+	}
+	mods.samples <- sampleResult{content: "乙\n"}
+
+	require.NoError(t, pickSample(context.Background(), mods))
+	require.Equal(t, "## 回答 1\n\n甲\n\n## 回答 2\n\n乙", mods.Output)
+	require.Equal(t, mods.Output, mods.messages[1].Content)
+	require.Empty(t, mods.otherSamples)
+}
+
+func TestPickSampleAsk(t *testing.T) {
+	t.Setenv("MODS_NO_TTY", "stdout")
+	cfg := Config{Samples: 3, Pick: "ask", Quiet: true}
+	mods := &Mods{
+		Config: &cfg,
+		Output: "甲",
+		messages: []proto.Message{
+			{Role: proto.RoleUser, Content: "问题"},
+			{Role: proto.RoleAssistant, Content: "甲"},
+		},
+		samples: make(chan sampleResult, 2),
+	}
+	mods.samples <- sampleResult{content: "乙"}
+	mods.samples <- sampleResult{content: "丙\n"}
+
+	// 输出不是终端时输出 JSON 数组，对话中保留所有回答
+	require.NoError(t, pickSample(context.Background(), mods))
+	require.JSONEq(t, `["甲", "乙", "丙\n"]`, mods.Output)
+	require.Equal(t, "## 回答 1\n\n甲\n\n## 回答 2\n\n乙\n\n## 回答 3\n\n丙", mods.messages[1].Content)
+}
+
+// altStream 是一次请求返回多个回答的流
+type altStream struct {
+	stream.Stream
+	alts []string
+}
+
+func (s altStream) Alternatives() []string { return s.alts }
+
+func TestCollectAlternatives(t *testing.T) {
+	client := openai.New(openai.Config{})
+	require.True(t, supportsN(API{Name: "openai"}, client))
+	require.False(t, supportsN(API{Name: "groq"}, client))
+	require.True(t, supportsN(API{Name: "vllm", SupportsN: true}, client))
+	require.False(t, supportsN(API{Name: "anthropic", SupportsN: true}, nil))
+
+	cfg := Config{Samples: 3}
+	mods := &Mods{Config: &cfg, samples: make(chan sampleResult, 2), nativeSamples: true}
+	mods.collectAlternatives(altStream{alts: []string{"乙"}})
+	require.False(t, mods.nativeSamples)
+	require.Equal(t, "乙", (<-mods.samples).content)
+	require.Error(t, (<-mods.samples).err)
+
+	// 不是用 n 参数生成的样本时不做任何事
+	mods.collectAlternatives(altStream{alts: []string{"丙"}})
+	require.Empty(t, mods.samples)
+}
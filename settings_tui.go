@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"gopkg.in/yaml.v3"
+)
+
+// settingsValues 是 --settings --tui 表单中编辑的设置
+type settingsValues struct {
+	API        string   // default-api
+	Model      string   // default-model
+	Temp       string   // temp，为空时不设置
+	Cache      bool     // 是否缓存对话，对应 no-cache 取反
+	MCPEnabled []string // 没有被 disabled 的 MCP 服务器
+}
+
+// editSettingsTUI 在分页的表单中编辑常用设置，保存时只改动修改过的项，文件中的注释和其它设置保持不变
+// path: 设置文件路径
+// 返回：错误信息
+func editSettingsTUI(path string) error {
+	if !canPrompt() {
+		return modsError{
+			err:    newUserErrorf("--tui 需要在终端中运行，也可以只用 %s 在 $EDITOR 中编辑", stderrStyles().InlineCode.Render("--settings")),
+			reason: "无法编辑您的设置文件。",
+		}
+	}
+	doc, err := readSettingsDoc(path)
+	if err != nil {
+		return modsError{err, "无法读取设置文件。"}
+	}
+	var current Config
+	if err := doc.Decode(&current); err != nil {
+		return modsError{err, "无法解析设置文件。"}
+	}
+	before := settingsFromDoc(doc, current)
+	after := before
+	after.MCPEnabled = slices.Clone(before.MCPEnabled)
+
+	if err := settingsForm(current, &after).WithTheme(themeFrom(config.Theme)).Run(); err != nil {
+		return modsError{err, "无法编辑您的设置文件。"}
+	}
+	if !applySettings(doc, before, after) {
+		if !config.Quiet {
+			fmt.Fprintln(os.Stderr, "设置没有改动。")
+		}
+		return nil
+	}
+	if err := doc.Decode(&Config{}); err != nil {
+		return modsError{err, "修改后的设置无法解析。"}
+	}
+	if err := writeSettingsDoc(path, doc); err != nil {
+		return modsError{err, "无法写入设置文件。"}
+	}
+	if !config.Quiet {
+		fmt.Fprintln(os.Stderr, "配置文件已写入:", path)
+	}
+	return nil
+}
+
+// settingsForm 返回编辑设置的表单，每一组是一页
+// current: 设置文件中的配置，用于列出 API、模型和 MCP 服务器
+// v: 表单编辑的值
+func settingsForm(current Config, v *settingsValues) *huh.Form {
+	apis := make([]huh.Option[string], 0, len(current.APIs))
+	models := map[string][]huh.Option[string]{}
+	for _, api := range current.APIs {
+		apis = append(apis, huh.NewOption(api.Name, api.Name))
+		for _, name := range slices.Sorted(maps.Keys(api.Models)) {
+			models[api.Name] = append(models[api.Name], huh.NewOption(name, name))
+		}
+	}
+	servers := make([]huh.Option[string], 0, len(current.MCPServers))
+	for _, name := range slices.Sorted(maps.Keys(current.MCPServers)) {
+		servers = append(servers, huh.NewOption(name, name).Selected(slices.Contains(v.MCPEnabled, name)))
+	}
+
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("默认 API").
+				Description(help["api"]).
+				Options(apis...).
+				Value(&v.API),
+			huh.NewSelect[string]().
+				TitleFunc(func() string {
+					return fmt.Sprintf("'%s' 的默认模型", v.API)
+				}, &v.API).
+				OptionsFunc(func() []huh.Option[string] {
+					return models[v.API]
+				}, &v.API).
+				Value(&v.Model),
+		),
+		huh.NewGroup(
+			huh.NewInput().
+				Title("温度").
+				Description(help["temp"]+"，留空表示使用 API 的默认值").
+				Value(&v.Temp).
+				Validate(validateTemp),
+		),
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title("缓存对话").
+				Description("保存对话，以便用 --continue、--show 等继续或查看").
+				Affirmative("是").
+				Negative("否").
+				Value(&v.Cache),
+		),
+		huh.NewGroup(
+			huh.NewMultiSelect[string]().
+				Title("启用的 MCP 服务器").
+				Description("没有选中的服务器会设置 disabled: true").
+				Options(servers...).
+				Value(&v.MCPEnabled),
+		).WithHideFunc(func() bool {
+			return len(servers) == 0
+		}),
+	)
+}
+
+// validateTemp 校验表单中的温度
+func validateTemp(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	t, err := strconv.ParseFloat(s, 64)
+	if err != nil || t > 2 || (t < 0 && t != -1) {
+		return errors.New("温度应在 0.0 到 2.0 之间，或为 -1.0")
+	}
+	return nil
+}
+
+// settingsFromDoc 从设置文件中取出表单编辑的值
+// doc: 设置文件的文档节点
+// current: 解析后的设置
+func settingsFromDoc(doc *yaml.Node, current Config) settingsValues {
+	v := settingsValues{
+		API:   current.API,
+		Model: current.Model,
+		Cache: !current.NoCache,
+	}
+	if node := yamlMapValue(doc.Content[0], "temp"); node != nil && node.Kind == yaml.ScalarNode {
+		v.Temp = node.Value
+	}
+	for _, name := range slices.Sorted(maps.Keys(current.MCPServers)) {
+		if !current.MCPServers[name].Disabled {
+			v.MCPEnabled = append(v.MCPEnabled, name)
+		}
+	}
+	return v
+}
+
+// applySettings 把表单中修改过的值写入设置文件的文档节点，没有修改的项保持原样
+// doc: 设置文件的文档节点
+// before: 表单编辑前的值
+// after: 表单编辑后的值
+// 返回：是否有改动
+func applySettings(doc *yaml.Node, before, after settingsValues) bool {
+	root := doc.Content[0]
+	changed := false
+	set := func(key, value, tag string) {
+		setYAMLScalar(root, key, value, tag)
+		changed = true
+	}
+	if after.API != before.API {
+		set("default-api", after.API, "!!str")
+	}
+	if after.Model != before.Model {
+		set("default-model", after.Model, "!!str")
+	}
+	if temp := strings.TrimSpace(after.Temp); temp != strings.TrimSpace(before.Temp) {
+		if temp == "" {
+			deleteYAMLKey(root, "temp")
+			changed = true
+		} else {
+			set("temp", temp, "!!float")
+		}
+	}
+	if after.Cache != before.Cache {
+		set("no-cache", strconv.FormatBool(!after.Cache), "!!bool")
+	}
+
+	servers := yamlMapValue(root, "mcp-servers")
+	if servers == nil || servers.Kind != yaml.MappingNode {
+		return changed
+	}
+	for i := 0; i+1 < len(servers.Content); i += 2 {
+		name, server := servers.Content[i].Value, servers.Content[i+1]
+		was, is := slices.Contains(before.MCPEnabled, name), slices.Contains(after.MCPEnabled, name)
+		if was == is || server.Kind != yaml.MappingNode {
+			continue
+		}
+		if is {
+			deleteYAMLKey(server, "disabled")
+		} else {
+			setYAMLScalar(server, "disabled", "true", "!!bool")
+		}
+		changed = true
+	}
+	return changed
+}
+
+// readSettingsDoc 读取设置文件的文档节点，保留其中的注释。空文件返回只有一个空映射的文档
+// path: 设置文件路径
+// 返回：文档节点和错误信息
+func readSettingsDoc(path string) (*yaml.Node, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("设置文件的顶层不是映射")
+	}
+	return &doc, nil
+}
+
+// writeSettingsDoc 把文档节点写回设置文件
+// path: 设置文件路径
+// doc: 文档节点
+// 返回：错误信息
+func writeSettingsDoc(path string, doc *yaml.Node) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2) //nolint:mnd
+	if err := enc.Encode(doc); err != nil {
+		return err //nolint:wrapcheck
+	}
+	if err := enc.Close(); err != nil {
+		return err //nolint:wrapcheck
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o600) //nolint:wrapcheck,mnd
+}
+
+// yamlMapValue 返回映射节点中键对应的值节点，不存在时返回 nil
+func yamlMapValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setYAMLScalar 设置映射节点中键的标量值，保留原值节点上的注释；键不存在时追加到末尾
+func setYAMLScalar(m *yaml.Node, key, value, tag string) {
+	if node := yamlMapValue(m, key); node != nil {
+		node.Kind, node.Value, node.Tag, node.Style, node.Content = yaml.ScalarNode, value, tag, 0, nil
+		return
+	}
+	m.Content = append(m.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: value, Tag: tag},
+	)
+}
+
+// deleteYAMLKey 删除映射节点中的键
+func deleteYAMLKey(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = slices.Delete(m.Content, i, i+2)
+			return
+		}
+	}
+}
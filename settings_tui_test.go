@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const settingsTUIExample = `# 默认 API
+default-api: openai
+# 默认模型
+default-model: gpt-4o
+mcp-servers:
+  # GitHub
+  github:
+    command: github-mcp-server
+  fs:
+    command: fs-mcp
+    disabled: true
+# 温度
+temp: 1.0
+apis:
+  openai:
+    models:
+      gpt-4o: {}
+      gpt-4o-mini: {}
+`
+
+func TestApplySettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mods.yml")
+	require.NoError(t, os.WriteFile(path, []byte(settingsTUIExample), 0o600))
+	doc, err := readSettingsDoc(path)
+	require.NoError(t, err)
+	var current Config
+	require.NoError(t, doc.Decode(&current))
+
+	before := settingsFromDoc(doc, current)
+	require.Equal(t, settingsValues{
+		API:        "openai",
+		Model:      "gpt-4o",
+		Temp:       "1.0",
+		Cache:      true,
+		MCPEnabled: []string{"github"},
+	}, before)
+
+	t.Run("没有改动", func(t *testing.T) {
+		require.False(t, applySettings(doc, before, before))
+	})
+
+	after := before
+	after.Model = "gpt-4o-mini"
+	after.Cache = false
+	after.MCPEnabled = []string{"fs"}
+	require.True(t, applySettings(doc, before, after))
+	require.NoError(t, writeSettingsDoc(path, doc))
+
+	bts, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `# 默认 API
+default-api: openai
+# 默认模型
+default-model: gpt-4o-mini
+mcp-servers:
+  # GitHub
+  github:
+    command: github-mcp-server
+    disabled: true
+  fs:
+    command: fs-mcp
+# 温度
+temp: 1.0
+apis:
+  openai:
+    models:
+      gpt-4o: {}
+      gpt-4o-mini: {}
+no-cache: true
+`, string(bts))
+
+	t.Run("清空温度", func(t *testing.T) {
+		doc, err := readSettingsDoc(path)
+		require.NoError(t, err)
+		require.True(t, applySettings(doc, settingsValues{Temp: "1.0"}, settingsValues{Temp: " "}))
+		require.Nil(t, yamlMapValue(doc.Content[0], "temp"))
+	})
+}
+
+func TestValidateTemp(t *testing.T) {
+	for _, s := range []string{"", "0", "0.7", "2", "-1"} {
+		require.NoError(t, validateTemp(s), s)
+	}
+	for _, s := range []string{"abc", "2.1", "-0.5"} {
+		require.Error(t, validateTemp(s), s)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"crypto/sha1" //nolint: gosec
 	"fmt"
 	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
 )
 
 const (
@@ -13,12 +16,50 @@ const (
 	sha1ReadBlockSize = 4096 // SHA1 读取块大小
 )
 
-var sha1reg = regexp.MustCompile(`\b[0-9a-f]{40}\b`)
+// 对话 ID 的格式
+const (
+	idFormatSHA1   = "sha1"   // 随机数据的 SHA1，40 个十六进制字符
+	idFormatUUIDv7 = "uuidv7" // 以毫秒时间戳开头的 UUIDv7，可以按创建时间排序
+)
+
+// sha1reg 匹配两种格式的对话 ID
+var sha1reg = regexp.MustCompile(`\b([0-9a-f]{40}|[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12})\b`)
+
+// validateIDFormat 检查 id-format 的取值
+func validateIDFormat(s string) error {
+	switch s {
+	case "", idFormatSHA1, idFormatUUIDv7:
+		return nil
+	}
+	return newUserErrorf("id-format 应为 %s 或 %s，而不是 %q", idFormatSHA1, idFormatUUIDv7, s)
+}
 
 // newConversationID 生成新的对话 ID
-// 返回：SHA1 格式的对话 ID
+// 返回：按 id-format 设置生成的对话 ID，默认为 SHA1 格式
 func newConversationID() string {
+	if config.IDFormat == idFormatUUIDv7 {
+		if id, err := uuid.NewV7(); err == nil {
+			return id.String()
+		}
+	}
 	b := make([]byte, sha1ReadBlockSize)
 	_, _ = rand.Read(b)
 	return fmt.Sprintf("%x", sha1.Sum(b)) //nolint: gosec
 }
+
+// isUUIDID 判断对话 ID 是否为 UUID 格式
+func isUUIDID(id string) bool {
+	return strings.Contains(id, "-")
+}
+
+// shortID 返回展示用的短 ID。UUIDv7 的开头是时间戳，相近时间创建的对话前缀相同，
+// 所以取结尾的随机部分；SHA1 取开头
+func shortID(id string) string {
+	if len(id) <= sha1short {
+		return id
+	}
+	if isUUIDID(id) {
+		return id[len(id)-sha1short:]
+	}
+	return id[:sha1short]
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversationID(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+
+	t.Run("sha1", func(t *testing.T) {
+		config.IDFormat = ""
+		id := newConversationID()
+		require.Len(t, id, 40)
+		require.True(t, sha1reg.MatchString(id))
+		require.Equal(t, id[:sha1short], shortID(id))
+	})
+
+	t.Run("uuidv7", func(t *testing.T) {
+		config.IDFormat = idFormatUUIDv7
+		first := newConversationID()
+		second := newConversationID()
+		require.True(t, sha1reg.MatchString(first))
+		require.Less(t, first, second)
+		require.Equal(t, first[len(first)-sha1short:], shortID(first))
+	})
+
+	t.Run("校验", func(t *testing.T) {
+		require.NoError(t, validateIDFormat(idFormatUUIDv7))
+		require.Error(t, validateIDFormat("ulid"))
+	})
+}
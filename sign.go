@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/go-shellwords"
+)
+
+// defaultSignatureHeader 是 hmac 签名默认写入的请求头
+const defaultSignatureHeader = "X-Signature"
+
+// HMACSigning 是内置的 HMAC 请求签名设置
+type HMACSigning struct {
+	Key             string `yaml:"key"`              // 签名密钥
+	KeyEnv          string `yaml:"key-env"`          // 签名密钥的环境变量
+	Header          string `yaml:"header"`           // 签名写入的请求头，默认 X-Signature
+	Algorithm       string `yaml:"algorithm"`        // sha256（默认）或 sha512
+	Encoding        string `yaml:"encoding"`         // hex（默认）或 base64
+	Prefix          string `yaml:"prefix"`           // 签名值的前缀，例如 sha256=
+	TimestampHeader string `yaml:"timestamp-header"` // 设置后把 Unix 时间戳写入该请求头，并对“时间戳.请求体”签名
+}
+
+// signRequests 返回按 API 的 sign-cmd 或 hmac 设置为每个请求的请求体签名的 HTTP 客户端，
+// 沿用 c 的设置（如代理）。API 没有设置签名时原样返回 c
+// c: 原来的客户端，为空时使用默认客户端
+// api: API 设置
+// 返回：客户端和错误信息
+func signRequests(c *http.Client, api API) (*http.Client, error) {
+	sign, err := requestSigner(api)
+	if err != nil || sign == nil {
+		return c, err
+	}
+	return withRequestHook(c, sign), nil
+}
+
+// requestSigner 返回按 API 的 sign-cmd 或 hmac 设置为请求体签名的函数，
+// 可以直接用作 Bedrock 的 RequestHooks。API 没有设置签名时返回 nil
+// api: API 设置
+// 返回：签名函数和错误信息
+func requestSigner(api API) (func(*http.Request) error, error) {
+	switch {
+	case api.SignCmd != "" && api.HMAC != nil:
+		return nil, modsError{
+			err:    newUserErrorf("sign-cmd 和 hmac 只能设置一个"),
+			reason: fmt.Sprintf("API %s 的签名设置有误。", api.Name),
+		}
+	case api.SignCmd != "":
+		args, err := shellwords.Parse(api.SignCmd)
+		if err != nil {
+			return nil, modsError{err, "解析 sign-cmd 失败"}
+		}
+		if len(args) == 0 {
+			return nil, modsError{newUserErrorf("sign-cmd 为空"), "解析 sign-cmd 失败"}
+		}
+		return func(req *http.Request) error {
+			return signWithCmd(req, args)
+		}, nil
+	case api.HMAC != nil:
+		h := *api.HMAC
+		key := h.Key
+		if h.KeyEnv != "" {
+			key = os.Getenv(h.KeyEnv)
+		}
+		if key == "" {
+			return nil, modsError{
+				err:    newUserErrorf("在 hmac 中设置 key 或 key-env"),
+				reason: fmt.Sprintf("API %s 缺少 HMAC 签名密钥。", api.Name),
+			}
+		}
+		newHash, err := hmacHash(h.Algorithm)
+		if err != nil {
+			return nil, modsError{err, fmt.Sprintf("API %s 的签名设置有误。", api.Name)}
+		}
+		encode, err := hmacEncoding(h.Encoding)
+		if err != nil {
+			return nil, modsError{err, fmt.Sprintf("API %s 的签名设置有误。", api.Name)}
+		}
+		return func(req *http.Request) error {
+			body, err := readRequestBody(req)
+			if err != nil {
+				return err
+			}
+			mac := hmac.New(newHash, []byte(key))
+			if h.TimestampHeader != "" {
+				ts := strconv.FormatInt(time.Now().Unix(), 10)
+				req.Header.Set(h.TimestampHeader, ts)
+				mac.Write([]byte(ts + "."))
+			}
+			mac.Write(body)
+			req.Header.Set(cmp.Or(h.Header, defaultSignatureHeader), h.Prefix+encode(mac.Sum(nil)))
+			return nil
+		}, nil
+	}
+	return nil, nil
+}
+
+// signWithCmd 把请求体写到 sign-cmd 的标准输入，将命令输出的每一行“名称: 值”设置为请求头。
+// 请求的方法和 URL 通过环境变量 MODS_SIGN_METHOD 和 MODS_SIGN_URL 传给命令
+// req: 请求
+// args: 命令及参数
+// 返回：错误信息
+func signWithCmd(req *http.Request, args []string) error {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(req.Context(), args[0], args[1:]...) //nolint:gosec
+	cmd.Env = append(
+		os.Environ(),
+		"MODS_SIGN_METHOD="+req.Method,
+		"MODS_SIGN_URL="+req.URL.String(),
+	)
+	cmd.Stdin = bytes.NewReader(body)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("无法执行 sign-cmd: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	headers, err := parseSignHeaders(out)
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		req.Header[name] = value
+	}
+	return nil
+}
+
+// parseSignHeaders 解析 sign-cmd 输出的请求头，忽略空行
+func parseSignHeaders(out []byte) (http.Header, error) {
+	headers := http.Header{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("sign-cmd 的输出应为每行一个“名称: 值”，而不是 %q", line)
+		}
+		headers.Set(name, strings.TrimSpace(value))
+	}
+	if len(headers) == 0 {
+		return nil, errors.New("sign-cmd 没有输出任何请求头")
+	}
+	return headers, nil
+}
+
+// hmacHash 返回 HMAC 使用的哈希算法
+func hmacHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "", "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	default:
+		return nil, newUserErrorf("不支持的 HMAC 算法 %q，支持 sha256 和 sha512", algorithm)
+	}
+}
+
+// hmacEncoding 返回签名的编码方式
+func hmacEncoding(encoding string) (func([]byte) string, error) {
+	switch strings.ToLower(encoding) {
+	case "", "hex":
+		return hex.EncodeToString, nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString, nil
+	default:
+		return nil, newUserErrorf("不支持的签名编码 %q，支持 hex 和 base64", encoding)
+	}
+}
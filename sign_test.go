@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignRequests(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	t.Cleanup(srv.Close)
+
+	post := func(t *testing.T, c *http.Client) error {
+		t.Helper()
+		got = nil
+		resp, err := c.Post(srv.URL, "application/json", strings.NewReader(`{"a":1}`))
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	t.Run("没有设置签名", func(t *testing.T) {
+		c, err := signRequests(nil, API{Name: "x"})
+		require.NoError(t, err)
+		require.Nil(t, c)
+	})
+
+	t.Run("hmac", func(t *testing.T) {
+		t.Setenv("MODS_TEST_SIGN_KEY", "secret")
+		c, err := signRequests(nil, API{Name: "x", HMAC: &HMACSigning{
+			KeyEnv:          "MODS_TEST_SIGN_KEY",
+			Prefix:          "sha256=",
+			TimestampHeader: "X-Timestamp",
+		}})
+		require.NoError(t, err)
+		require.NoError(t, post(t, c))
+
+		ts := got.Get("X-Timestamp")
+		require.NotEmpty(t, ts)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(ts + `.{"a":1}`))
+		require.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), got.Get(defaultSignatureHeader))
+	})
+
+	t.Run("hmac 设置有误", func(t *testing.T) {
+		_, err := signRequests(nil, API{Name: "x", HMAC: &HMACSigning{}})
+		require.Error(t, err)
+		_, err = signRequests(nil, API{Name: "x", HMAC: &HMACSigning{Key: "k", Algorithm: "md5"}})
+		require.Error(t, err)
+		_, err = signRequests(nil, API{Name: "x", HMAC: &HMACSigning{Key: "k"}, SignCmd: "true"})
+		require.Error(t, err)
+	})
+
+	t.Run("sign-cmd", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("需要 sh")
+		}
+		c, err := signRequests(nil, API{
+			Name:    "x",
+			SignCmd: `sh -c 'echo "X-Body: $(cat)"; echo; echo "X-Method: $MODS_SIGN_METHOD"'`,
+		})
+		require.NoError(t, err)
+		require.NoError(t, post(t, c))
+		require.Equal(t, `{"a":1}`, got.Get("X-Body"))
+		require.Equal(t, http.MethodPost, got.Get("X-Method"))
+
+		c, err = signRequests(nil, API{Name: "x", SignCmd: "sh -c 'echo not a header'"})
+		require.NoError(t, err)
+		require.ErrorContains(t, post(t, c), "名称: 值")
+		require.Nil(t, got)
+
+		c, err = signRequests(nil, API{Name: "x", SignCmd: "sh -c 'echo denied >&2; exit 1'"})
+		require.NoError(t, err)
+		require.ErrorContains(t, post(t, c), "denied")
+	})
+}
+
+func TestBedrockSignRequests(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(srv.Close)
+
+	m := &Mods{Config: &Config{}, ctx: context.Background()}
+	api := API{Name: "bedrock", Region: "us-east-1", BaseURL: srv.URL, HMAC: &HMACSigning{Key: "k"}}
+	client, err := m.newClient(m.Config, api, Model{API: "bedrock", Name: "m"})
+	require.NoError(t, err)
+	s := client.Request(context.Background(), proto.Request{
+		Messages: []proto.Message{{Role: proto.RoleUser, Content: "hi"}},
+		Model:    "m",
+	})
+	require.False(t, s.Next())
+	require.NoError(t, s.Close())
+	require.NotEmpty(t, got.Get(defaultSignatureHeader))
+	require.Contains(t, got.Get("Authorization"), "AWS4-HMAC-SHA256")
+}
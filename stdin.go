@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// omittedLines 是省略部分标准输入时插入的说明
+const omittedLines = "…（省略了 %d 行）…\n"
+
+// readStdin 读取标准输入，只保留开头 head 行和末尾 tail 行，其余的行边读边丢弃，
+// 处理超大的输入时内存占用只与保留的行数有关。head 和 tail 都不大于 0 时读取全部内容
+// r: 输入
+// head: 保留开头的行数
+// tail: 保留末尾的行数
+// 返回：保留的内容和错误信息
+func readStdin(r io.Reader, head, tail int) (string, error) {
+	if head <= 0 && tail <= 0 {
+		bts, err := io.ReadAll(r)
+		return string(bts), err //nolint:wrapcheck
+	}
+
+	br := bufio.NewReader(r)
+	var sb strings.Builder
+	last := make([]string, 0, max(tail, 0)) // 末尾的行，写满后作为环形缓冲区
+	var total, omitted, oldest int
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			total++
+			switch {
+			case total <= head:
+				sb.WriteString(line)
+			case len(last) < tail:
+				last = append(last, line)
+			case tail > 0:
+				last[oldest] = line
+				oldest = (oldest + 1) % tail
+				omitted++
+			default:
+				omitted++
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err //nolint:wrapcheck
+		}
+	}
+
+	if omitted > 0 {
+		fmt.Fprintf(&sb, omittedLines, omitted)
+	}
+	sb.WriteString(strings.Join(last[oldest:], ""))
+	sb.WriteString(strings.Join(last[:oldest], ""))
+	return sb.String(), nil
+}
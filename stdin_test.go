@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadStdin(t *testing.T) {
+	const input = "1\n2\n3\n4\n5\n"
+	for name, tc := range map[string]struct {
+		head, tail int
+		input      string
+		expected   string
+	}{
+		"全部":       {input: input, expected: input},
+		"开头":       {head: 2, input: input, expected: "1\n2\n…（省略了 3 行）…\n"},
+		"末尾":       {tail: 2, input: input, expected: "…（省略了 3 行）…\n4\n5\n"},
+		"开头和末尾":    {head: 1, tail: 1, input: input, expected: "1\n…（省略了 3 行）…\n5\n"},
+		"行数不足":     {head: 3, tail: 3, input: input, expected: input},
+		"最后一行没有换行": {tail: 1, input: "1\n2", expected: "…（省略了 1 行）…\n2"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := readStdin(strings.NewReader(tc.input), tc.head, tc.tail)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -10,7 +11,19 @@ import (
 // setupStreamContext 设置流上下文
 func (m *Mods) setupStreamContext(content string, mod Model) error {
 	cfg := m.Config
+	// 聊天模式与 --exec、--critic 的后续轮次：直接在已有对话上追加用户消息
+	if (cfg.Chat || m.followingUp) && len(m.messages) > 0 {
+		m.messages = append(m.messages, proto.Message{
+			Role:    proto.RoleUser,
+			Content: content,
+		})
+		return nil
+	}
 	m.messages = []proto.Message{}
+	// 没有指定角色时按 rules 选择
+	if err := m.applyRoleRules(content); err != nil {
+		return err
+	}
 	// 如果配置了格式化文本，添加系统消息
 	if txt := cfg.FormatText[cfg.FormatAs]; cfg.Format && txt != "" {
 		m.messages = append(m.messages, proto.Message{
@@ -29,7 +42,7 @@ func (m *Mods) setupStreamContext(content string, mod Model) error {
 			}
 		}
 		for _, msg := range roleSetup {
-			content, err := loadMsg(msg)
+			content, err := loadRoleMsg(msg, cfg.Role, mod)
 			if err != nil {
 				return modsError{
 					err:    err,
@@ -48,11 +61,6 @@ func (m *Mods) setupStreamContext(content string, mod Model) error {
 		content = strings.TrimSpace(prefix + "\n\n" + content)
 	}
 
-	// 如果未配置无限制且内容超过最大字符数，截断内容
-	if !cfg.NoLimit && int64(len(content)) > mod.MaxChars {
-		content = content[:mod.MaxChars]
-	}
-
 	// 如果未配置无缓存且配置了读取缓存 ID，从缓存读取
 	if !cfg.NoCache && cfg.cacheReadFromID != "" {
 		if err := m.cache.Read(cfg.cacheReadFromID, &m.messages); err != nil {
@@ -67,11 +75,71 @@ func (m *Mods) setupStreamContext(content string, mod Model) error {
 		}
 	}
 
-	// 添加用户消息
-	m.messages = append(m.messages, proto.Message{
+	// 重新生成时去掉最后一次回答，沿用原来的提示
+	if cfg.Regenerate {
+		messages, prompt, ok := splitLastExchange(m.messages)
+		if !ok {
+			return modsError{
+				err:    errors.New("对话中没有用户消息"),
+				reason: "无法重新生成。",
+			}
+		}
+		m.messages = append(messages, prompt)
+		return nil
+	}
+
+	// 加载附带的图片
+	images, err := loadImages(cfg.Images)
+	if err != nil {
+		return err
+	}
+
+	// --mcp-prompt 展开的消息放在提示之前，--mcp-resource 读取的资源附在提示后面
+	if mc := m.mcpContext; mc != nil {
+		m.messages = append(m.messages, mc.messages...)
+		if mc.resources != "" {
+			content = strings.TrimSpace(fmt.Sprintf(mcpResourcePrompt, content, mc.resources))
+		}
+		images = append(images, mc.images...)
+		if content == "" && len(images) == 0 && len(mc.messages) > 0 {
+			return nil
+		}
+	}
+
+	// 添加用户消息，与提示模板的最后一条用户消息合并
+	m.messages = appendMessage(m.messages, proto.Message{
 		Role:    proto.RoleUser,
 		Content: content,
+		Images:  images,
 	})
 
 	return nil
 }
+
+// loadImages 加载通过 --attach 附带的图片
+func loadImages(srcs []string) ([]proto.Image, error) {
+	images := make([]proto.Image, 0, len(srcs))
+	for _, src := range srcs {
+		img, err := loadImage(src)
+		if err != nil {
+			return nil, modsError{
+				err:    err,
+				reason: fmt.Sprintf("无法读取图片 %s。", src),
+			}
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// splitLastExchange 在最后一条用户消息处拆分对话
+// messages: 对话消息
+// 返回：最后一条用户消息之前的消息、最后一条用户消息，以及是否找到用户消息
+func splitLastExchange(messages []proto.Message) ([]proto.Message, proto.Message, bool) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == proto.RoleUser {
+			return messages[:i:i], messages[i], true
+		}
+	}
+	return messages, proto.Message{}, false
+}
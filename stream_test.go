@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitLastExchange(t *testing.T) {
+	t.Run("去掉最后一次回答", func(t *testing.T) {
+		messages := []proto.Message{
+			{Role: proto.RoleSystem, Content: "system"},
+			{Role: proto.RoleUser, Content: "first"},
+			{Role: proto.RoleAssistant, Content: "answer"},
+			{Role: proto.RoleUser, Content: "second"},
+			{Role: proto.RoleAssistant, ToolCalls: []proto.ToolCall{{ID: "1"}}},
+			{Role: proto.RoleTool, Content: "result", ToolCalls: []proto.ToolCall{{ID: "1"}}},
+			{Role: proto.RoleAssistant, Content: "answer"},
+		}
+		rest, prompt, ok := splitLastExchange(messages)
+		require.True(t, ok)
+		require.Equal(t, messages[:3], rest)
+		require.Equal(t, messages[3], prompt)
+
+		// 追加消息不会修改原来的切片
+		_ = append(rest, proto.Message{Role: proto.RoleUser, Content: "new"})
+		require.Equal(t, "second", messages[3].Content)
+	})
+
+	t.Run("没有用户消息", func(t *testing.T) {
+		_, _, ok := splitLastExchange([]proto.Message{{Role: proto.RoleSystem, Content: "system"}})
+		require.False(t, ok)
+	})
+}
@@ -13,6 +13,8 @@ type styles struct {
 	CliArgs,
 	Comment,
 	CyclingChars,
+	DiffAdded,
+	DiffRemoved,
 	ErrorHeader,
 	ErrorDetails,
 	ErrPadding,
@@ -35,6 +37,8 @@ func makeStyles(r *lipgloss.Renderer) (s styles) {
 	s.CliArgs = r.NewStyle().Foreground(lipgloss.Color("#585858"))
 	s.Comment = r.NewStyle().Foreground(lipgloss.Color("#757575"))
 	s.CyclingChars = r.NewStyle().Foreground(lipgloss.Color("#FF87D7"))
+	s.DiffAdded = r.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#00875F", Dark: "#5FD787"})
+	s.DiffRemoved = r.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#D70000", Dark: "#FF5F5F"})
 	s.ErrorHeader = r.NewStyle().Foreground(lipgloss.Color("#F1F1F1")).Background(lipgloss.Color("#FF5F87")).Bold(true).Padding(0, 1).SetString("ERROR")
 	s.ErrorDetails = s.Comment
 	s.ErrPadding = r.NewStyle().Padding(0, horizontalEdgePadding)
@@ -51,6 +55,15 @@ func makeStyles(r *lipgloss.Renderer) (s styles) {
 	return s
 }
 
+// plainStyles 创建没有颜色时使用的样式：背景和填充只会留下多余的空格，
+// 所以内联代码改用反引号标出，错误标题去掉填充
+func plainStyles(r *lipgloss.Renderer) styles {
+	s := makeStyles(r)
+	s.InlineCode = r.NewStyle().Transform(func(code string) string { return "`" + code + "`" })
+	s.ErrorHeader = r.NewStyle().SetString("ERROR")
+	return s
+}
+
 // action messages 操作消息
 
 const defaultAction = "WROTE"
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs 返回 sprig 风格的模板函数，供配置模板与角色等提示模板使用
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"env":        os.Getenv,
+		"now":        time.Now,
+		"date":       templateDate,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"replace":    func(old, replacement, s string) string { return strings.ReplaceAll(s, old, replacement) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       func(sep string, elems []string) string { return strings.Join(elems, sep) },
+		"indent":     templateIndent,
+		"quote":      func(s string) string { return fmt.Sprintf("%q", s) },
+		"default":    templateDefault,
+		"toJson":     templateToJSON,
+	}
+}
+
+// executeTemplate 使用模板函数渲染模板文本
+// name: 模板名称，用于错误信息
+// text: 模板文本
+// data: 模板数据
+// 返回：渲染结果与错误信息
+func executeTemplate(name, text string, data any) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs()).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("无法解析模板: %w", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("无法渲染模板: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// templateDate 按 Go 时间格式格式化时间，与 sprig 的 date 参数顺序一致
+// 用法：{{ now | date "2006-01-02" }}
+func templateDate(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+// templateIndent 为每一行添加指定数量的空格缩进
+// 用法：{{ .Text | indent 4 }}
+func templateIndent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// templateDefault 在值为空时返回默认值
+// 用法：{{ env "LANG" | default "zh_CN" }}
+func templateDefault(def, v any) any {
+	switch v := v.(type) {
+	case nil:
+		return def
+	case string:
+		if v == "" {
+			return def
+		}
+	}
+	return v
+}
+
+// templateToJSON 将值编码为 JSON，编码失败时返回空字符串
+// 用法：{{ .Config.Stop | toJson }}
+func templateToJSON(v any) string {
+	bts, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(bts)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestExecuteTemplate 测试模板函数
+func TestExecuteTemplate(t *testing.T) {
+	t.Setenv("MODS_TEMPLATE_TEST", "  值  ")
+
+	for name, tc := range map[string]struct {
+		text string
+		data any
+		want string
+	}{
+		"环境变量与去除空白": {`{{ env "MODS_TEMPLATE_TEST" | trim }}`, nil, "值"},
+		"默认值":       {`{{ env "MODS_TEMPLATE_MISSING" | default "无" }}`, nil, "无"},
+		"JSON":      {`{{ .Stop | toJson }}`, struct{ Stop []string }{[]string{"a", "b"}}, `["a","b"]`},
+		"缩进":        {`{{ "a\nb" | indent 2 }}`, nil, "  a\n  b"},
+		"分割与连接":     {`{{ "a,b" | split "," | join "-" | upper }}`, nil, "A-B"},
+		"日期":        {`{{ .T | date "2006-01-02" }}`, struct{ T time.Time }{time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)}, "2025-03-04"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := executeTemplate("test", tc.text, tc.data)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+
+	t.Run("语法错误", func(t *testing.T) {
+		_, err := executeTemplate("test", "{{ env ", nil)
+		require.Error(t, err)
+	})
+}
+
+// TestLoadRoleMsg 测试角色消息的模板渲染
+func TestLoadRoleMsg(t *testing.T) {
+	t.Run("渲染模板", func(t *testing.T) {
+		got, err := loadRoleMsg("你是 {{ .Role }}，使用 {{ .Model }}", "shell", Model{Name: "gpt-4o"})
+		require.NoError(t, err)
+		require.Equal(t, "你是 shell，使用 gpt-4o", got)
+	})
+
+	t.Run("普通文本", func(t *testing.T) {
+		got, err := loadRoleMsg("你是 shell 专家", "shell", Model{})
+		require.NoError(t, err)
+		require.Equal(t, "你是 shell 专家", got)
+	})
+}
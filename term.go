@@ -1,26 +1,79 @@
 package main
 
 import (
+	"io"
 	"os"
+	"strings"
 	"sync"
 
+	"github.com/charmbracelet/glamour"
+	glamourstyles "github.com/charmbracelet/glamour/styles"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/mattn/go-isatty"
 	"github.com/muesli/termenv"
 )
 
-// isInputTTY 检查标准输入是否为终端
+// isInputTTY 检查标准输入是否为终端，可以用 MODS_FORCE_TTY / MODS_NO_TTY 覆盖
 var isInputTTY = sync.OnceValue(func() bool {
+	if tty, ok := ttyOverride("stdin"); ok {
+		return tty
+	}
 	return isatty.IsTerminal(os.Stdin.Fd())
 })
 
-// isOutputTTY 检查标准输出是否为终端
+// isOutputTTY 检查标准输出是否为终端，可以用 MODS_FORCE_TTY / MODS_NO_TTY 覆盖
 var isOutputTTY = sync.OnceValue(func() bool {
+	if tty, ok := ttyOverride("stdout"); ok {
+		return tty
+	}
 	return isatty.IsTerminal(os.Stdout.Fd())
 })
 
+// ttyOverride 返回环境变量对终端检测的覆盖，MODS_NO_TTY 优先。
+// 值为 1、true 或 all 时同时作用于标准输入和标准输出，也可以只写 stdin 或 stdout
+// stream: stdin 或 stdout
+// 返回：是否视为终端，以及是否设置了覆盖
+func ttyOverride(stream string) (tty, ok bool) {
+	if envSelects("MODS_NO_TTY", stream) {
+		return false, true
+	}
+	if envSelects("MODS_FORCE_TTY", stream) {
+		return true, true
+	}
+	return false, false
+}
+
+// envSelects 判断环境变量的值是否选中了给定的流
+func envSelects(name, stream string) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(name))) {
+	case "1", "true", "all", stream:
+		return true
+	}
+	return false
+}
+
+// outputRenderer 创建输出到 w 的渲染器，标准输出的终端检测被覆盖时颜色也随之开启或关闭
+func outputRenderer(w io.Writer) *lipgloss.Renderer {
+	if tty, ok := ttyOverride("stdout"); ok {
+		return lipgloss.NewRenderer(w, termenv.WithTTY(tty), termenv.WithColorCache(true))
+	}
+	return lipgloss.NewRenderer(w, termenv.WithColorCache(true))
+}
+
+// glamourStyle 返回渲染 Markdown 的样式：强制终端时标准输出不是真正的终端，
+// glamour 的自动检测会选择无样式，此时使用深色样式
+func glamourStyle() glamour.TermRendererOption {
+	if tty, ok := ttyOverride("stdout"); ok && tty && os.Getenv("GLAMOUR_STYLE") == "" {
+		return glamour.WithStandardStyle(glamourstyles.DarkStyle)
+	}
+	return glamour.WithEnvironmentConfig()
+}
+
 // stdoutRenderer 标准输出渲染器
 var stdoutRenderer = sync.OnceValue(func() *lipgloss.Renderer {
+	if _, ok := ttyOverride("stdout"); ok {
+		return outputRenderer(os.Stdout)
+	}
 	return lipgloss.DefaultRenderer()
 })
 
@@ -29,12 +82,25 @@ var stdoutStyles = sync.OnceValue(func() styles {
 	return makeStyles(stdoutRenderer())
 })
 
-// stderrRenderer 标准错误渲染器
+// isDumbTerminal 判断 TERM 是否为 dumb，这类终端不支持颜色和其它控制序列
+func isDumbTerminal() bool {
+	return os.Getenv("TERM") == "dumb"
+}
+
+// stderrRenderer 标准错误渲染器。TERM=dumb 时关闭颜色，即使 COLORTERM 等变量声称支持颜色
 var stderrRenderer = sync.OnceValue(func() *lipgloss.Renderer {
-	return lipgloss.NewRenderer(os.Stderr, termenv.WithColorCache(true))
+	r := outputRenderer(os.Stderr)
+	if isDumbTerminal() {
+		r.SetColorProfile(termenv.Ascii)
+	}
+	return r
 })
 
-// stderrStyles 标准错误样式
+// stderrStyles 标准错误样式。没有颜色时（哑终端、重定向到文件或 CI 日志）降级为纯文本
 var stderrStyles = sync.OnceValue(func() styles {
-	return makeStyles(stderrRenderer())
+	r := stderrRenderer()
+	if r.ColorProfile() == termenv.Ascii {
+		return plainStyles(r)
+	}
+	return makeStyles(r)
 })
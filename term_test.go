@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTYOverride(t *testing.T) {
+	for name, tc := range map[string]struct {
+		force, no     string
+		stdin, stdout bool
+		ok            bool
+	}{
+		"未设置":            {},
+		"强制终端":           {force: "1", stdin: true, stdout: true, ok: true},
+		"只强制标准输出":        {force: "stdout", stdout: true, ok: true},
+		"不视为终端":          {no: "true", ok: true},
+		"MODS_NO_TTY 优先": {force: "1", no: "all", ok: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("MODS_FORCE_TTY", tc.force)
+			t.Setenv("MODS_NO_TTY", tc.no)
+			stdout, ok := ttyOverride("stdout")
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.stdout, stdout)
+			stdin, _ := ttyOverride("stdin")
+			require.Equal(t, tc.stdin, stdin)
+		})
+	}
+}
+
+func TestPlainStyles(t *testing.T) {
+	r := lipgloss.NewRenderer(io.Discard)
+	r.SetColorProfile(termenv.Ascii)
+	s := plainStyles(r)
+	require.Equal(t, "`mods -h`", s.InlineCode.Render("mods -h"))
+	require.Equal(t, "ERROR", s.ErrorHeader.String())
+	require.Equal(t, "abc", s.Flag.Render("abc"))
+
+	t.Run("哑终端", func(t *testing.T) {
+		t.Setenv("TERM", "dumb")
+		require.True(t, isDumbTerminal())
+		t.Setenv("TERM", "xterm-256color")
+		require.False(t, isDumbTerminal())
+	})
+}
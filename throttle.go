@@ -0,0 +1,96 @@
+package main
+
+import (
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// throttleMaxFPS 是节流输出时每秒最多刷新的次数，速率更高时每次输出多个令牌
+const throttleMaxFPS = 60
+
+// throttleTickMsg 表示输出下一批节流的令牌
+type throttleTickMsg struct{}
+
+// throttleTick 返回节流输出的间隔和每次输出的令牌数
+func (r tokenRate) throttleTick() (time.Duration, int) {
+	interval := max(time.Duration(float64(time.Second)/float64(r)), time.Second/throttleMaxFPS)
+	return interval, max(int(float64(r)*interval.Seconds()+0.5), 1) //nolint:mnd
+}
+
+// throttled 返回是否按 --throttle 的速率输出回答
+func (m *Mods) throttled() bool {
+	return m.Config.Throttle > 0 && !m.bufferOutput()
+}
+
+// throttle 把收到的内容按令牌放入待输出的队列，并在需要时开始按速率输出
+// content: 收到的内容
+// 返回：开始输出的命令
+func (m *Mods) throttle(content string) tea.Cmd {
+	if m.tokens.enc == nil {
+		t, err := tokenizerFor(m.model)
+		if err != nil {
+			// 无法分词时整段输出
+			m.pending = append(m.pending, content)
+			return m.startThrottle()
+		}
+		m.tokens = t
+	}
+	m.pending = append(m.pending, m.tokens.split(content)...)
+	return m.startThrottle()
+}
+
+// startThrottle 在没有正在进行的节流输出时开始输出
+func (m *Mods) startThrottle() tea.Cmd {
+	if m.throttling || len(m.pending) == 0 {
+		return nil
+	}
+	m.throttling = true
+	return m.throttleCmd()
+}
+
+// throttleCmd 在一个间隔后输出下一批令牌
+func (m *Mods) throttleCmd() tea.Cmd {
+	interval, _ := m.Config.Throttle.throttleTick()
+	return tea.Tick(interval, func(time.Time) tea.Msg { return throttleTickMsg{} })
+}
+
+// releaseThrottled 输出一批令牌。队列清空且回答已经结束时处理结束的消息
+// 返回：更新后的模型和命令
+func (m *Mods) releaseThrottled() (tea.Model, tea.Cmd) {
+	_, n := m.Config.Throttle.throttleTick()
+	n = min(n, len(m.pending))
+	for _, s := range m.pending[:n] {
+		m.appendToOutput(s)
+	}
+	m.pending = m.pending[n:]
+	if len(m.pending) > 0 {
+		return m, m.throttleCmd()
+	}
+	m.throttling = false
+	if m.throttledEnd != nil {
+		// 作为新的消息处理，先渲染最后一批令牌
+		end := *m.throttledEnd
+		m.throttledEnd = nil
+		return m, func() tea.Msg { return end }
+	}
+	return m, nil
+}
+
+// split 把文本按令牌切分，不会从多字节字符的中间切开
+func (t tokenizer) split(s string) []string {
+	var tokens []string
+	var buf []byte
+	for _, token := range t.enc.EncodeOrdinary(s) {
+		buf = append(buf, t.enc.Decode([]int{token})...)
+		if utf8.Valid(buf) {
+			tokens = append(tokens, string(buf))
+			buf = buf[:0]
+		}
+	}
+	if len(buf) > 0 {
+		tokens = append(tokens, string(buf))
+	}
+	return tokens
+}
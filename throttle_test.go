@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottle(t *testing.T) {
+	t.Run("按令牌切分", func(t *testing.T) {
+		tok, err := tokenizerFor(Model{})
+		require.NoError(t, err)
+		s := "Hello, 世界！🙂 mods"
+		tokens := tok.split(s)
+		require.Greater(t, len(tokens), 3)
+		require.Equal(t, s, strings.Join(tokens, ""))
+		for _, token := range tokens {
+			require.True(t, utf8.ValidString(token), token)
+		}
+	})
+
+	t.Run("刷新间隔", func(t *testing.T) {
+		interval, n := tokenRate(4).throttleTick()
+		require.Equal(t, 250*time.Millisecond, interval)
+		require.Equal(t, 1, n)
+		interval, n = tokenRate(600).throttleTick()
+		require.Equal(t, time.Second/throttleMaxFPS, interval)
+		require.Equal(t, 10, n)
+	})
+
+	t.Run("输出完后再结束", func(t *testing.T) {
+		cfg := Config{Throttle: 1000, Raw: true}
+		m := &Mods{Config: &cfg, contentMutex: &sync.Mutex{}}
+		require.NotNil(t, m.throttle("one two three"))
+		require.Nil(t, m.throttle(" four"))
+
+		_, cmd := m.Update(completionOutput{})
+		require.Nil(t, cmd)
+		require.NotNil(t, m.throttledEnd)
+
+		_, cmd = m.releaseThrottled()
+		require.Equal(t, "one two three four", m.Output)
+		require.Empty(t, m.pending)
+		require.False(t, m.throttling)
+		require.Equal(t, completionOutput{}, cmd())
+	})
+}
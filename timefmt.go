@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// --time-format 的取值
+const (
+	timeRelative = "relative" // 相对时间，如“3 天前”
+	timeAbsolute = "absolute" // 本地时间，如“2024-05-01 14:03”
+	timeISO      = "iso"      // RFC 3339 格式，便于其他工具解析
+)
+
+// timeAbsoluteLayout 是 absolute 格式使用的布局
+const timeAbsoluteLayout = "2006-01-02 15:04"
+
+// validateTimeFormat 检查 time-format 的取值
+func validateTimeFormat(s string) error {
+	switch s {
+	case "", timeRelative, timeAbsolute, timeISO:
+		return nil
+	}
+	return modsError{
+		err: newUserErrorf(
+			"可选的格式有：%s、%s、%s",
+			stderrStyles().InlineCode.Render(timeRelative),
+			stderrStyles().InlineCode.Render(timeAbsolute),
+			stderrStyles().InlineCode.Render(timeISO),
+		),
+		reason: fmt.Sprintf("不支持的时间格式 %q。", s),
+	}
+}
+
+// formatTime 按 --time-format 设置格式化列表和提示中显示的时间
+// t: 要显示的时间
+// 返回：格式化后的时间
+func formatTime(t time.Time) string {
+	switch config.TimeFormat {
+	case timeAbsolute:
+		return t.Local().Format(timeAbsoluteLayout)
+	case timeISO:
+		return t.Local().Format(time.RFC3339)
+	default:
+		return relativeTime(t, time.Now())
+	}
+}
+
+// relativeTime 返回 t 相对于 now 的中文描述，如“刚刚”、“5 分钟前”、“昨天”
+// t: 要描述的时间
+// now: 当前时间
+// 返回：相对时间
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	suffix := "前"
+	if d < 0 {
+		d, suffix = -d, "后"
+	}
+
+	const (
+		day   = 24 * time.Hour
+		month = 30 * day
+		year  = 365 * day
+	)
+	switch {
+	case d < 10*time.Second: //nolint:mnd
+		return "刚刚"
+	case d < time.Minute:
+		return fmt.Sprintf("%d 秒%s", int(d/time.Second), suffix)
+	case d < time.Hour:
+		return fmt.Sprintf("%d 分钟%s", int(d/time.Minute), suffix)
+	case d < day:
+		return fmt.Sprintf("%d 小时%s", int(d/time.Hour), suffix)
+	case d < 2*day && suffix == "前":
+		return "昨天"
+	case d < 2*day:
+		return "明天"
+	case d < month:
+		return fmt.Sprintf("%d 天%s", int(d/day), suffix)
+	case d < year:
+		return fmt.Sprintf("%d 个月%s", int(d/month), suffix)
+	default:
+		return fmt.Sprintf("%d 年%s", int(d/year), suffix)
+	}
+}
+
+// olderThanLabel 返回删除确认中的时间界限：相对格式时是持续时间本身，其他格式时是对应的时间点
+// d: --delete-older-than 的持续时间
+func olderThanLabel(d time.Duration) string {
+	if config.TimeFormat == "" || config.TimeFormat == timeRelative {
+		return d.String()
+	}
+	return formatTime(time.Now().Add(-d))
+}
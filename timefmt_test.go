@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for expected, d := range map[string]time.Duration{
+		"刚刚":     3 * time.Second,
+		"45 秒前":  45 * time.Second,
+		"5 分钟前":  5 * time.Minute,
+		"3 小时前":  3 * time.Hour,
+		"昨天":     30 * time.Hour,
+		"3 天前":   3 * 24 * time.Hour,
+		"2 个月前":  65 * 24 * time.Hour,
+		"1 年前":   400 * 24 * time.Hour,
+		"10 分钟后": -10 * time.Minute,
+		"明天":     -30 * time.Hour,
+	} {
+		t.Run(expected, func(t *testing.T) {
+			require.Equal(t, expected, relativeTime(now.Add(-d), now))
+		})
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	ts := time.Date(2024, 5, 1, 14, 3, 0, 0, time.Local)
+
+	t.Run("本地时间", func(t *testing.T) {
+		config.TimeFormat = timeAbsolute
+		require.Equal(t, "2024-05-01 14:03", formatTime(ts))
+	})
+
+	t.Run("ISO", func(t *testing.T) {
+		config.TimeFormat = timeISO
+		parsed, err := time.Parse(time.RFC3339, formatTime(ts))
+		require.NoError(t, err)
+		require.True(t, ts.Equal(parsed))
+	})
+
+	t.Run("删除确认", func(t *testing.T) {
+		config.TimeFormat = timeRelative
+		require.Equal(t, "72h0m0s", olderThanLabel(72*time.Hour))
+		config.TimeFormat = timeAbsolute
+		require.Regexp(t, `^\d{4}-\d{2}-\d{2} \d{2}:\d{2}$`, olderThanLabel(72*time.Hour))
+	})
+
+	t.Run("校验", func(t *testing.T) {
+		for _, s := range []string{"", timeRelative, timeAbsolute, timeISO} {
+			require.NoError(t, validateTimeFormat(s))
+		}
+		require.Error(t, validateTimeFormat("unix"))
+	})
+}
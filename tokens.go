@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+func init() {
+	// 使用内置的词表，统计令牌数不需要访问网络
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+const (
+	// tokensPerMessage 是 OpenAI 聊天格式中每条消息的额外令牌数
+	tokensPerMessage = 3
+	// tokensPerReply 是回答开头的额外令牌数
+	tokensPerReply = 3
+	// tokensPerImage 是一张 1024×1024 图片在 OpenAI 高精度模式下的令牌数，用作估算
+	tokensPerImage = 765
+	// approxEncoding 是非 OpenAI 模型估算令牌数时使用的词表
+	approxEncoding = tiktoken.MODEL_CL100K_BASE
+	// charsPerToken 是没有配置 max-input-tokens 时，由 max-input-chars 换算令牌数的比例
+	charsPerToken = 3
+)
+
+// openAIAPIs 是使用 OpenAI 词表的 API
+var openAIAPIs = []string{"openai", "azure", "azure-ad"}
+
+// tokenizer 按模型所属系列的词表统计和截断文本
+type tokenizer struct {
+	enc      *tiktoken.Tiktoken
+	encoding string // 使用的词表
+	approx   bool   // 是否为估算值：非 OpenAI 模型使用近似的词表
+}
+
+// tokenizerFor 返回模型使用的词表：OpenAI 模型使用对应的 tiktoken 词表，其它模型用 cl100k_base 估算
+func tokenizerFor(mod Model) (tokenizer, error) {
+	t := tokenizer{encoding: approxEncoding, approx: true}
+	if slices.Contains(openAIAPIs, mod.API) {
+		t = tokenizer{encoding: openAIEncoding(mod.Name)}
+	}
+	enc, err := tiktoken.GetEncoding(t.encoding)
+	if err != nil {
+		return t, fmt.Errorf("无法加载词表 %s: %w", t.encoding, err)
+	}
+	t.enc = enc
+	return t, nil
+}
+
+// openAIEncoding 返回 OpenAI 模型使用的词表
+func openAIEncoding(name string) string {
+	if enc, ok := tiktoken.MODEL_TO_ENCODING[name]; ok {
+		return enc
+	}
+	for prefix, enc := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(name, prefix) {
+			return enc
+		}
+	}
+	// 较新的模型（o 系列、gpt-5 等）都使用 o200k_base
+	return tiktoken.MODEL_O200K_BASE
+}
+
+// count 返回文本的令牌数
+func (t tokenizer) count(s string) int64 {
+	return int64(len(t.enc.EncodeOrdinary(s)))
+}
+
+// truncate 只保留文本开头的 n 个令牌，并去掉被截断的不完整字符
+func (t tokenizer) truncate(s string, n int64) string {
+	tokens := t.enc.EncodeOrdinary(s)
+	if int64(len(tokens)) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(t.enc.Decode(tokens[:max(n, 0)]), "")
+}
+
+// messageTokens 返回一条消息的令牌数，包括消息格式的额外令牌、工具调用和图片
+func (t tokenizer) messageTokens(msg proto.Message) int64 {
+	n := tokensPerMessage + t.count(msg.Role) + t.count(msg.Content)
+	for _, call := range msg.ToolCalls {
+		n += t.count(call.Function.Name) + t.count(string(call.Function.Arguments))
+	}
+	return n + int64(len(msg.Images))*tokensPerImage
+}
+
+// shrinkPrompt 在 API 没有给出令牌数时缩短提示词：按本地估算的令牌数去掉末尾的四分之一，
+// 每次重试都会再缩短一次，重试次数由 max-retries 限制
+// prompt: 提示词
+// mod: 模型配置
+// 返回：缩短后的提示词
+func shrinkPrompt(prompt string, mod Model) string {
+	t, err := tokenizerFor(mod)
+	if err != nil {
+		runes := []rune(prompt)
+		return string(runes[:len(runes)*3/4]) //nolint:mnd
+	}
+	return t.truncate(prompt, t.count(prompt)*3/4) //nolint:mnd
+}
+
+// inputTokenLimit 返回模型的输入令牌上限，0 表示不限制
+func inputTokenLimit(mod Model) int64 {
+	if mod.MaxInputTokens > 0 {
+		return mod.MaxInputTokens
+	}
+	return mod.MaxChars / charsPerToken
+}
+
+// maxMessageTokens 返回消息令牌数的上限：每个令牌至少一个字节，不需要分词
+func maxMessageTokens(msg proto.Message) int64 {
+	n := int64(tokensPerMessage + len(msg.Role) + len(msg.Content))
+	for _, call := range msg.ToolCalls {
+		n += int64(len(call.Function.Name) + len(call.Function.Arguments))
+	}
+	return n + int64(len(msg.Images))*tokensPerImage
+}
+
+// systemPrefix 返回开头的系统消息（格式与角色）的数量
+func systemPrefix(messages []proto.Message) int {
+	n := 0
+	for n < len(messages) && messages[n].Role == proto.RoleSystem {
+		n++
+	}
+	return n
+}
+
+// fitMessages 让请求的消息适应模型的输入上限：先按轮次丢弃系统消息之后最早的历史，
+// 只剩最后一条消息时再截断它的末尾
+// messages: 请求的消息，最后一条是本次的提示
+// mod: 模型配置
+// 返回：适应上限后的消息、丢弃的历史消息数量（从 systemPrefix 处开始）和错误信息
+func fitMessages(messages []proto.Message, mod Model) ([]proto.Message, int, error) {
+	limit := inputTokenLimit(mod)
+	if limit <= 0 || len(messages) == 0 {
+		return messages, 0, nil
+	}
+	var upper int64 = tokensPerReply
+	for _, msg := range messages {
+		upper += maxMessageTokens(msg)
+	}
+	if upper <= limit {
+		return messages, 0, nil
+	}
+
+	t, err := tokenizerFor(mod)
+	if err != nil {
+		return nil, 0, err
+	}
+	sizes := make([]int64, len(messages))
+	var total int64 = tokensPerReply
+	for i, msg := range messages {
+		sizes[i] = t.messageTokens(msg)
+		total += sizes[i]
+	}
+
+	// 按轮次丢弃最早的历史：每次丢弃到下一条用户消息之前，工具调用与结果不会被拆开
+	start := systemPrefix(messages)
+	last := len(messages) - 1
+	end := start
+	for total > limit && end < last {
+		next := end + 1
+		for next < last && messages[next].Role != proto.RoleUser {
+			next++
+		}
+		for i := end; i < next; i++ {
+			total -= sizes[i]
+		}
+		end = next
+	}
+	fitted := slices.Concat(messages[:start], messages[end:])
+
+	// 仍然超出时截断本次提示的末尾
+	if total > limit {
+		prompt := fitted[len(fitted)-1]
+		available := t.count(prompt.Content) - (total - limit)
+		prompt.Content = t.truncate(prompt.Content, available)
+		fitted[len(fitted)-1] = prompt
+	}
+	return fitted, end - start, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFitMessages(t *testing.T) {
+	mod := Model{API: "openai", Name: "gpt-4o"}
+	long := strings.Repeat("hello world ", 50)
+	messages := []proto.Message{
+		{Role: proto.RoleSystem, Content: "you are helpful"},
+		{Role: proto.RoleUser, Content: long},
+		{Role: proto.RoleAssistant, Content: "", ToolCalls: []proto.ToolCall{{ID: "1", Function: proto.Function{Name: "ls"}}}},
+		{Role: proto.RoleTool, Content: long, ToolCalls: []proto.ToolCall{{ID: "1", Function: proto.Function{Name: "ls"}}}},
+		{Role: proto.RoleAssistant, Content: long},
+		{Role: proto.RoleUser, Content: "second question"},
+		{Role: proto.RoleAssistant, Content: "second answer"},
+		{Role: proto.RoleUser, Content: "third question"},
+	}
+
+	t.Run("没有超出上限", func(t *testing.T) {
+		mod := mod
+		mod.MaxInputTokens = 100_000
+		fitted, dropped, err := fitMessages(messages, mod)
+		require.NoError(t, err)
+		require.Equal(t, 0, dropped)
+		require.Equal(t, messages, fitted)
+	})
+
+	t.Run("没有配置上限", func(t *testing.T) {
+		fitted, dropped, err := fitMessages(messages, mod)
+		require.NoError(t, err)
+		require.Equal(t, 0, dropped)
+		require.Equal(t, messages, fitted)
+	})
+
+	t.Run("按轮次丢弃最早的历史", func(t *testing.T) {
+		mod := mod
+		mod.MaxInputTokens = 100
+		fitted, dropped, err := fitMessages(messages, mod)
+		require.NoError(t, err)
+		require.Equal(t, 4, dropped)
+		require.Equal(t, []proto.Message{messages[0], messages[5], messages[6], messages[7]}, fitted)
+	})
+
+	t.Run("由最大字符数换算上限", func(t *testing.T) {
+		mod := mod
+		mod.MaxChars = 300
+		_, dropped, err := fitMessages(messages, mod)
+		require.NoError(t, err)
+		require.Equal(t, 4, dropped)
+	})
+
+	t.Run("截断提示时不破坏字符", func(t *testing.T) {
+		mod := mod
+		mod.MaxInputTokens = 30
+		prompt := []proto.Message{{Role: proto.RoleUser, Content: strings.Repeat("你好，世界！", 50)}}
+		fitted, dropped, err := fitMessages(prompt, mod)
+		require.NoError(t, err)
+		require.Equal(t, 0, dropped)
+		require.True(t, utf8.ValidString(fitted[0].Content))
+		require.True(t, strings.HasPrefix(prompt[0].Content, fitted[0].Content))
+		require.NotEmpty(t, fitted[0].Content)
+
+		tk, err := tokenizerFor(mod)
+		require.NoError(t, err)
+		require.LessOrEqual(t, tk.messageTokens(fitted[0])+tokensPerReply, mod.MaxInputTokens)
+		require.Equal(t, strings.Repeat("你好，世界！", 50), prompt[0].Content, "不修改原来的消息")
+	})
+}
+
+func TestShrinkPrompt(t *testing.T) {
+	mod := Model{API: "ollama", Name: "llama3"}
+	require.Equal(t, "one two three four five six", shrinkPrompt("one two three four five six seven eight", mod))
+	require.Empty(t, shrinkPrompt("", mod))
+
+	t.Run("不截断多字节字符", func(t *testing.T) {
+		prompt := strings.Repeat("上下文", 20)
+		shrunk := shrinkPrompt(prompt, mod)
+		require.True(t, utf8.ValidString(shrunk))
+		require.Less(t, len(shrunk), len(prompt))
+		require.True(t, strings.HasPrefix(prompt, shrunk))
+	})
+}
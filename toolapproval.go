@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/huh"
+)
+
+// 工具调用的批准方式
+const (
+	toolApprovalAlways = "always" // 直接执行，不询问
+	toolApprovalNever  = "never"  // 拒绝所有调用
+	toolApprovalAsk    = "ask"    // 每次调用前询问
+)
+
+// toolApprovalMaxArgs 是确认时显示的工具参数的最大字符数
+const toolApprovalMaxArgs = 2000
+
+// toolApprovalMu 保证同时只有一个确认提示，例如 --samples 的多个请求同时调用工具时
+var toolApprovalMu sync.Mutex
+
+// validToolApproval 检查全局和各个服务器、本地工具的 tool-approval 设置
+func validToolApproval() error {
+	check := func(value, where string) error {
+		switch value {
+		case "", toolApprovalAlways, toolApprovalNever, toolApprovalAsk:
+			return nil
+		}
+		return modsError{
+			err: newUserErrorf(
+				"可选的方式有：%s、%s、%s",
+				stderrStyles().InlineCode.Render(toolApprovalAlways),
+				stderrStyles().InlineCode.Render(toolApprovalNever),
+				stderrStyles().InlineCode.Render(toolApprovalAsk),
+			),
+			reason: fmt.Sprintf("%s不支持的工具批准方式 %q。", where, value),
+		}
+	}
+	if err := check(config.ToolApproval, ""); err != nil {
+		return err
+	}
+	for name, server := range config.MCPServers {
+		if err := check(server.ToolApproval, fmt.Sprintf("MCP 服务器 %s：", name)); err != nil {
+			return err
+		}
+	}
+	for name, tool := range config.Tools {
+		if err := check(tool.ToolApproval, fmt.Sprintf("本地工具 %s：", name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toolApproval 返回工具调用的批准方式：本地工具和 MCP 服务器自己的设置优先于全局的 --tool-approval
+// name: 工具名称（格式: server_tool）
+func toolApproval(name string) string {
+	sname, tool, _ := strings.Cut(name, "_")
+	if sname == localToolsServer {
+		if t, ok := config.Tools[tool]; ok && t.ToolApproval != "" {
+			return t.ToolApproval
+		}
+	} else if server, ok := config.MCPServers[sname]; ok && server.ToolApproval != "" {
+		return server.ToolApproval
+	}
+	if config.ToolApproval == "" {
+		return toolApprovalAlways
+	}
+	return config.ToolApproval
+}
+
+// callTool 按 tool-approval 设置批准后调用工具，把调用记录到工具调用日志，并按 max-tool-result 截断过长的结果。
+// 没有批准时把原因作为工具错误交给模型
+// ctx: 上下文
+// name: 工具名称（格式: server_tool）
+// data: 工具参数 JSON 数据
+// 返回：工具执行结果和错误信息
+func (m *Mods) callTool(ctx context.Context, name string, data []byte) (string, error) {
+	switch toolApproval(name) {
+	case toolApprovalNever:
+		return "", fmt.Errorf("tool-approval 设置不允许调用工具 %s", name)
+	case toolApprovalAsk:
+		if config.Yes {
+			break
+		}
+		toolApprovalMu.Lock()
+		ok, err := m.askToolApproval(ctx, name, data)
+		toolApprovalMu.Unlock()
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("用户拒绝了工具调用 %s", name)
+		}
+	}
+	res, err := toolCall(ctx, name, data)
+	logToolCall(config.cacheWriteToID, name, data, res, err)
+	return truncateToolResult(res, config.MaxToolResult), err
+}
+
+// askToolApproval 暂停界面，显示工具名称和参数并请用户确认。
+// 标准输入不是终端时（例如通过管道输入提示）从 /dev/tty 读取回答
+// 返回：是否批准和错误信息
+func (m *Mods) askToolApproval(ctx context.Context, name string, data []byte) (bool, error) {
+	if config.NoInput {
+		return false, fmt.Errorf(
+			"无法确认工具调用 %s：使用了 --no-input，可以使用 --yes 或者 --tool-approval %s",
+			name, toolApprovalAlways,
+		)
+	}
+	var in io.Reader = os.Stdin
+	if !isInputTTY() {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return false, fmt.Errorf(
+				"无法确认工具调用 %s：需要终端，或者使用 --tool-approval %s",
+				name, toolApprovalAlways,
+			)
+		}
+		defer tty.Close() //nolint:errcheck
+		in = tty
+	}
+
+	if m.program != nil {
+		if err := m.program.ReleaseTerminal(); err != nil {
+			return false, fmt.Errorf("无法确认工具调用 %s: %w", name, err)
+		}
+		defer m.program.RestoreTerminal() //nolint:errcheck
+	}
+
+	var approve bool
+	err := huh.NewForm(huh.NewGroup(
+		huh.NewConfirm().
+			Title(fmt.Sprintf("调用工具 %s？", name)).
+			Description(toolApprovalArgs(data)).
+			Affirmative("调用").
+			Negative("拒绝").
+			Value(&approve),
+	)).
+		WithInput(in).
+		WithOutput(os.Stderr).
+		RunWithContext(ctx)
+	if errors.Is(err, huh.ErrUserAborted) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("无法确认工具调用 %s: %w", name, err)
+	}
+	return approve, nil
+}
+
+// toolApprovalArgs 返回确认时显示的工具参数，JSON 格式化后过长的部分被截断
+func toolApprovalArgs(data []byte) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		buf.Reset()
+		buf.Write(data)
+	}
+	args := strings.TrimSpace(buf.String())
+	if args == "" {
+		return "（没有参数）"
+	}
+	if r := []rune(args); len(r) > toolApprovalMaxArgs {
+		args = string(r[:toolApprovalMaxArgs]) + "\n…"
+	}
+	return args
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolApproval(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config = Config{
+		MCPTimeout:   10 * time.Second,
+		ToolApproval: toolApprovalAlways,
+		MCPServers: map[string]MCPServerConfig{
+			"fs":  {ToolApproval: toolApprovalAsk},
+			"web": {},
+		},
+		Tools: map[string]LocalTool{
+			"echo": {Command: []string{"echo", "{{ .text }}"}},
+			"rm":   {Command: []string{"true"}, ToolApproval: toolApprovalNever},
+		},
+	}
+
+	t.Run("优先使用服务器和工具自己的设置", func(t *testing.T) {
+		require.Equal(t, toolApprovalAsk, toolApproval("fs_write_file"))
+		require.Equal(t, toolApprovalAlways, toolApproval("web_fetch"))
+		require.Equal(t, toolApprovalNever, toolApproval("local_rm"))
+		require.Equal(t, toolApprovalAlways, toolApproval("local_echo"))
+
+		config.ToolApproval = toolApprovalNever
+		t.Cleanup(func() { config.ToolApproval = toolApprovalAlways })
+		require.Equal(t, toolApprovalNever, toolApproval("web_fetch"))
+		require.Equal(t, toolApprovalAsk, toolApproval("fs_write_file"))
+	})
+
+	t.Run("检查设置", func(t *testing.T) {
+		require.NoError(t, validToolApproval())
+
+		config.Tools["bad"] = LocalTool{ToolApproval: "sometimes"}
+		t.Cleanup(func() { delete(config.Tools, "bad") })
+		var merr modsError
+		require.ErrorAs(t, validToolApproval(), &merr)
+		require.Contains(t, merr.reason, `本地工具 bad：不支持的工具批准方式 "sometimes"`)
+	})
+
+	t.Run("调用", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("需要 echo")
+		}
+		m := &Mods{}
+		out, err := m.callTool(context.Background(), "local_echo", []byte(`{"text":"hi"}`))
+		require.NoError(t, err)
+		require.Equal(t, "hi\n", out)
+
+		_, err = m.callTool(context.Background(), "local_rm", nil)
+		require.ErrorContains(t, err, "local_rm")
+	})
+
+	t.Run("--yes 和 --no-input", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("需要 echo")
+		}
+		config.Tools["ask"] = LocalTool{Command: []string{"echo", "ok"}, ToolApproval: toolApprovalAsk}
+		t.Cleanup(func() {
+			delete(config.Tools, "ask")
+			config.Yes, config.NoInput = false, false
+		})
+		m := &Mods{}
+
+		config.NoInput = true
+		_, err := m.callTool(context.Background(), "local_ask", nil)
+		require.ErrorContains(t, err, "--no-input")
+
+		config.Yes = true
+		out, err := m.callTool(context.Background(), "local_ask", nil)
+		require.NoError(t, err)
+		require.Equal(t, "ok\n", out)
+	})
+
+	t.Run("显示参数", func(t *testing.T) {
+		require.Equal(t, "{\n  \"a\": 1\n}", toolApprovalArgs([]byte(`{"a":1}`)))
+		require.Equal(t, "（没有参数）", toolApprovalArgs(nil))
+		require.Equal(t, "not json", toolApprovalArgs([]byte("not json")))
+
+		long := toolApprovalArgs([]byte(`"` + strings.Repeat("长", toolApprovalMaxArgs) + `"`))
+		require.True(t, strings.HasSuffix(long, "\n…"))
+	})
+}
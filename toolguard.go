@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+// maxRepeatedToolCalls 是同一个工具以相同参数调用的次数，达到时认为模型陷入了循环
+const maxRepeatedToolCalls = 3
+
+// toolGuard 限制一次回答中工具调用的轮数，并检测重复的工具调用
+type toolGuard struct {
+	rounds int            // 已经执行的工具调用轮数
+	calls  map[string]int // 工具名称和参数到调用次数的映射
+}
+
+// check 记录一轮工具调用，超过 max-tool-rounds 或者同样的调用重复太多次时返回错误
+// maxRounds: 最多的轮数，0 表示不限制
+// messages: 调用工具后的对话消息，末尾是本轮的工具结果
+// n: 本轮调用的工具数
+// 返回：错误信息
+func (g *toolGuard) check(maxRounds int, messages []proto.Message, n int) error {
+	if n == 0 {
+		return nil
+	}
+	g.rounds++
+	if g.calls == nil {
+		g.calls = map[string]int{}
+	}
+	for _, msg := range messages[max(len(messages)-n, 0):] {
+		for _, call := range msg.ToolCalls {
+			args := compactArgs(call.Function.Arguments)
+			key := call.Function.Name + "\x00" + args
+			g.calls[key]++
+			if g.calls[key] >= maxRepeatedToolCalls {
+				return modsError{
+					err: newUserErrorf(
+						"工具 %s 已经以相同的参数调用了 %d 次: %s",
+						stderrStyles().InlineCode.Render(call.Function.Name), g.calls[key], args,
+					),
+					reason: "模型陷入了重复调用工具的循环。",
+				}
+			}
+		}
+	}
+	if maxRounds > 0 && g.rounds >= maxRounds {
+		return modsError{
+			err: newUserErrorf(
+				"模型已经连续调用了 %d 轮工具，可以用 %s 调整上限",
+				g.rounds, stderrStyles().InlineCode.Render("--max-tool-rounds"),
+			),
+			reason: "工具调用的轮数超过了上限。",
+		}
+	}
+	return nil
+}
+
+// compactArgs 去掉 JSON 参数中的空白，使格式不同的相同参数被视为同一次调用
+func compactArgs(args []byte) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, args); err != nil {
+		return string(args)
+	}
+	return buf.String()
+}
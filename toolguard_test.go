@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolGuard(t *testing.T) {
+	result := func(name, args string) proto.Message {
+		return proto.Message{
+			Role:      proto.RoleTool,
+			ToolCalls: []proto.ToolCall{{Function: proto.Function{Name: name, Arguments: []byte(args)}}},
+		}
+	}
+
+	t.Run("没有工具调用", func(t *testing.T) {
+		var g toolGuard
+		require.NoError(t, g.check(1, []proto.Message{{Role: proto.RoleAssistant}}, 0))
+		require.Zero(t, g.rounds)
+	})
+
+	t.Run("超过轮数", func(t *testing.T) {
+		var g toolGuard
+		require.NoError(t, g.check(2, []proto.Message{result("a", "{}")}, 1))
+		require.ErrorContains(t, g.check(2, []proto.Message{result("b", "{}")}, 1), "--max-tool-rounds")
+	})
+
+	t.Run("不限制轮数", func(t *testing.T) {
+		var g toolGuard
+		for i := range 30 {
+			require.NoError(t, g.check(0, []proto.Message{result("a", string(rune('a'+i)))}, 1))
+		}
+	})
+
+	t.Run("重复调用", func(t *testing.T) {
+		var g toolGuard
+		messages := []proto.Message{
+			{Role: proto.RoleUser, Content: "hi"},
+			result("search", `{"q": "mods"}`),
+			result("other", `{}`),
+		}
+		require.NoError(t, g.check(0, messages, 2))
+		require.NoError(t, g.check(0, []proto.Message{result("search", `{"q":"mods"}`)}, 1))
+		err := g.check(0, []proto.Message{result("search", "{\n  \"q\": \"mods\"\n}")}, 1)
+		require.ErrorContains(t, err, `相同的参数调用了 3 次: {"q":"mods"}`)
+	})
+
+	t.Run("参数不同", func(t *testing.T) {
+		var g toolGuard
+		for _, q := range []string{"1", "2", "3", "4"} {
+			require.NoError(t, g.check(0, []proto.Message{result("search", `{"q":`+q+`}`)}, 1))
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// toolLogFile 是缓存目录中记录工具调用的文件名
+const toolLogFile = "tool-log.jsonl"
+
+// toolLogMaxResult 是日志中保留的工具结果的最大字节数
+const toolLogMaxResult = 4 * kilobyte
+
+// toolLogMu 保证并行的工具调用不会交错写入日志
+var toolLogMu sync.Mutex
+
+// toolLogEntry 是工具调用日志中的一行
+type toolLogEntry struct {
+	Time         time.Time       `json:"time"`                   // 调用时间
+	Conversation string          `json:"conversation,omitempty"` // 对话 ID
+	Server       string          `json:"server"`                 // MCP 服务器名称，本地工具为 local
+	Tool         string          `json:"tool"`                   // 工具名称
+	Arguments    json.RawMessage `json:"arguments,omitempty"`    // 调用参数
+	Result       string          `json:"result,omitempty"`       // 截断后的工具结果
+	Error        string          `json:"error,omitempty"`        // 错误信息
+}
+
+// logToolCall 把一次工具调用追加到缓存目录中的日志。没有缓存目录或者写入失败时忽略，不影响工具调用
+// convo: 对话 ID，不保存对话时为空
+// name: 工具名称（格式: server_tool）
+// data: 工具参数 JSON 数据
+// result: 工具结果
+// err: 工具调用的错误
+func logToolCall(convo, name string, data []byte, result string, err error) {
+	if config.CachePath == "" {
+		return
+	}
+	server, tool, _ := strings.Cut(name, "_")
+	entry := toolLogEntry{
+		Time:         time.Now(),
+		Conversation: convo,
+		Server:       server,
+		Tool:         tool,
+		Result:       truncateToolResult(result, toolLogMaxResult),
+	}
+	if json.Valid(data) {
+		entry.Arguments = json.RawMessage(compactArgs(data))
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	bts, merr := json.Marshal(entry)
+	if merr != nil {
+		return
+	}
+
+	toolLogMu.Lock()
+	defer toolLogMu.Unlock()
+	f, ferr := os.OpenFile(filepath.Join(config.CachePath, toolLogFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600) //nolint:mnd
+	if ferr != nil {
+		return
+	}
+	_, _ = f.Write(append(bts, '\n'))
+	_ = f.Close()
+}
+
+// readToolLog 读取某个对话的工具调用日志
+// convo: 对话 ID
+// 返回：按调用顺序排列的日志和错误信息
+func readToolLog(convo string) ([]toolLogEntry, error) {
+	f, err := os.Open(filepath.Join(config.CachePath, toolLogFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法打开工具调用日志: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	var entries []toolLogEntry
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var entry toolLogEntry
+			// 跳过写入中断而损坏的行
+			if json.Unmarshal(line, &entry) == nil && entry.Conversation == convo {
+				entries = append(entries, entry)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("无法读取工具调用日志: %w", err)
+		}
+	}
+}
+
+// showToolLog 输出对话中调用过的工具、参数和结果
+// in: 对话 ID 或标题
+// 返回：错误信息
+func showToolLog(in string) error {
+	convo, err := db.Find(in)
+	if err != nil {
+		return modsError{err, "无法找到对话。"}
+	}
+	entries, err := readToolLog(convo.ID)
+	if err != nil {
+		return modsError{err, "无法读取工具调用日志。"}
+	}
+	if len(entries) == 0 {
+		if !config.Quiet {
+			fmt.Fprintf(os.Stderr, "对话 %s 没有调用过工具。\n", stderrStyles().InlineCode.Render(shortID(convo.ID)))
+		}
+		return nil
+	}
+	writeToolLog(os.Stdout, entries)
+	return nil
+}
+
+// writeToolLog 以便于阅读的格式写出工具调用日志
+func writeToolLog(w io.Writer, entries []toolLogEntry) {
+	styles := stdoutStyles()
+	for i, e := range entries {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(
+			w, "%s %s\n",
+			styles.Timeago.Render(formatTime(e.Time)),
+			styles.Flag.Render(e.Server+"_"+e.Tool),
+		)
+		if len(e.Arguments) > 0 {
+			fmt.Fprintf(w, "%s %s\n", styles.Comment.Render("参数:"), e.Arguments)
+		}
+		if e.Error != "" {
+			fmt.Fprintf(w, "%s %s\n", styles.DiffRemoved.Render("错误:"), e.Error)
+		}
+		if e.Result != "" {
+			fmt.Fprintf(w, "%s\n%s\n", styles.Comment.Render("结果:"), strings.TrimRight(e.Result, "\n"))
+		}
+	}
+}
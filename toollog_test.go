@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolLog(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config.CachePath = t.TempDir()
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logToolCall("a", "local_weather", []byte(`{ "city": "Paris" }`), "晴", nil)
+		}()
+	}
+	wg.Wait()
+	logToolCall("b", "github_search", []byte(`{}`), "", errors.New("超时"))
+	logToolCall("a", "fs_read", []byte(`not json`), strings.Repeat("x", int(toolLogMaxResult)*2), nil)
+
+	t.Run("按对话读取", func(t *testing.T) {
+		entries, err := readToolLog("a")
+		require.NoError(t, err)
+		require.Len(t, entries, 21)
+		require.Equal(t, "local", entries[0].Server)
+		require.Equal(t, "weather", entries[0].Tool)
+		require.JSONEq(t, `{"city":"Paris"}`, string(entries[0].Arguments))
+		require.Equal(t, "晴", entries[0].Result)
+
+		last := entries[20]
+		require.Empty(t, last.Arguments)
+		require.Contains(t, last.Result, "省略了中间的")
+		require.Less(t, len(last.Result), int(toolLogMaxResult)+100)
+	})
+
+	t.Run("记录错误", func(t *testing.T) {
+		entries, err := readToolLog("b")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "超时", entries[0].Error)
+
+		var buf bytes.Buffer
+		writeToolLog(&buf, entries)
+		require.Contains(t, buf.String(), "github_search")
+		require.Contains(t, buf.String(), "错误: 超时")
+	})
+
+	t.Run("跳过损坏的行", func(t *testing.T) {
+		f, err := os.OpenFile(filepath.Join(config.CachePath, toolLogFile), os.O_APPEND|os.O_WRONLY, 0o600)
+		require.NoError(t, err)
+		_, err = f.WriteString(`{"conversation":"b","tool":`)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		entries, err := readToolLog("b")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	t.Run("没有日志", func(t *testing.T) {
+		config.CachePath = t.TempDir()
+		entries, err := readToolLog("a")
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultMaxToolResult 是交给模型的工具结果大小的默认上限
+const defaultMaxToolResult = 100 * kilobyte
+
+// toolResultLineSlack 是截断时为了停在换行处最多多丢弃的比例（相对于保留的部分）
+const toolResultLineSlack = 10
+
+// truncateToolResult 在工具结果超过上限时保留开头和结尾，中间替换为说明省略了多少字节的标记，
+// 避免输出很大的工具撑满上下文窗口或者超过服务商的请求大小限制
+// s: 工具结果
+// limit: 大小上限，小于等于 0 表示不限制
+// 返回：截断后的工具结果
+func truncateToolResult(s string, limit byteSize) string {
+	if limit <= 0 || byteSize(len(s)) <= limit {
+		return s
+	}
+	keep := int(limit)
+	head := s[:runeStart(s, keep/2)] //nolint:mnd
+	start := runeStart(s, len(s)-(keep-len(head)))
+	tail := s[start:]
+
+	// 尽量在整行处截断，使开头和结尾都是完整的行
+	if i := strings.LastIndexByte(head, '\n'); i >= 0 && len(head)-i <= len(head)/toolResultLineSlack {
+		head = head[:i+1]
+	}
+	if i := strings.IndexByte(tail, '\n'); s[start-1] != '\n' && i >= 0 && i < len(tail)-1 && i <= len(tail)/toolResultLineSlack {
+		tail = tail[i+1:]
+	}
+
+	marker := fmt.Sprintf("\n[… 工具结果过长，省略了中间的 %d 字节 …]\n", len(s)-len(head)-len(tail))
+	return head + marker + tail
+}
+
+// runeStart 返回不大于 i 的最近一个 UTF-8 字符的起始位置，避免把多字节字符切成两半
+func runeStart(s string, i int) int {
+	i = min(max(i, 0), len(s))
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncateToolResult(t *testing.T) {
+	t.Run("没有超过上限", func(t *testing.T) {
+		require.Equal(t, "hello", truncateToolResult("hello", 5))
+		require.Equal(t, "hello", truncateToolResult("hello", -1))
+	})
+
+	t.Run("保留开头和结尾", func(t *testing.T) {
+		s := strings.Repeat("a", 100) + strings.Repeat("b", 100) + strings.Repeat("c", 100)
+		res := truncateToolResult(s, 100)
+		require.True(t, strings.HasPrefix(res, strings.Repeat("a", 50)+"\n[…"), res)
+		require.True(t, strings.HasSuffix(res, "…]\n"+strings.Repeat("c", 50)), res)
+		require.Contains(t, res, "省略了中间的 200 字节")
+	})
+
+	t.Run("在整行处截断", func(t *testing.T) {
+		var sb strings.Builder
+		for i := range 100 {
+			sb.WriteString(strings.Repeat(string(rune('a'+i%26)), 19) + "\n")
+		}
+		res := truncateToolResult(sb.String(), 400)
+		head, tail, ok := strings.Cut(res, "\n[…")
+		require.True(t, ok)
+		require.Len(t, head, 200)
+		require.True(t, strings.HasSuffix(tail, "\n"+strings.Repeat("v", 19)+"\n"), tail)
+		require.Contains(t, res, "省略了中间的 1600 字节")
+	})
+
+	t.Run("不切断多字节字符", func(t *testing.T) {
+		res := truncateToolResult(strings.Repeat("长", 100), 101)
+		require.True(t, utf8.ValidString(res))
+		require.True(t, strings.HasPrefix(res, strings.Repeat("长", 16)+"\n"), res)
+	})
+}
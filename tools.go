@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// localToolsServer 是设置中 tools 定义的本地工具在工具名称中使用的服务器名称，
+// 工具名称为 local_<名称>，可以像 MCP 服务器一样用 --mcp-disable local 禁用
+const localToolsServer = "local"
+
+// localToolOutputLimit 是交给模型的工具输出的最大字节数
+const localToolOutputLimit = 64 * 1024
+
+// LocalTool 是设置中定义的本地工具，调用时直接执行命令，不需要 MCP 服务器
+type LocalTool struct {
+	Description string         `yaml:"description"` // 告诉模型工具的用途
+	Parameters  map[string]any `yaml:"parameters"`  // 参数的 JSON Schema，类型为 object
+	Command     []string       `yaml:"command"`     // 命令及参数，每一项都是以工具参数渲染的模板
+	Timeout     time.Duration  `yaml:"timeout"`     // 超时，未设置时使用 mcp-timeout
+
+	ToolApproval string `yaml:"tool-approval"` // 调用的批准方式，覆盖全局的 tool-approval
+}
+
+// timeout 返回工具的超时，未配置时使用全局的 mcp-timeout
+func (t LocalTool) timeout() time.Duration {
+	if t.Timeout > 0 {
+		return t.Timeout
+	}
+	return config.MCPTimeout
+}
+
+// localTools 把设置中的本地工具转换为 MCP 工具定义，按名称排序
+// 返回：工具列表和错误信息
+func localTools() ([]mcp.Tool, error) {
+	names := slices.Sorted(maps.Keys(config.Tools))
+	tools := make([]mcp.Tool, 0, len(names))
+	for _, name := range names {
+		tool := config.Tools[name]
+		if len(tool.Command) == 0 {
+			return nil, fmt.Errorf("本地工具 %q 没有设置 command", name)
+		}
+		schema := mcp.ToolInputSchema{Type: "object"}
+		if props, ok := tool.Parameters["properties"].(map[string]any); ok {
+			schema.Properties = props
+		}
+		if required, ok := tool.Parameters["required"].([]any); ok {
+			for _, r := range required {
+				schema.Required = append(schema.Required, fmt.Sprint(r))
+			}
+		}
+		tools = append(tools, mcp.Tool{
+			Name:        name,
+			Description: tool.Description,
+			InputSchema: schema,
+		})
+	}
+	return tools, nil
+}
+
+// localToolCall 执行本地工具：用参数渲染命令的每一项后直接执行，不经过 shell，
+// 参数中的特殊字符不会被解释。参数的 JSON 同时写到命令的标准输入
+// ctx: 上下文
+// name: 工具名称
+// data: 工具参数 JSON 数据
+// 返回：命令的标准输出和错误信息
+func localToolCall(ctx context.Context, name string, data []byte) (string, error) {
+	tool, ok := config.Tools[name]
+	if !ok {
+		return "", fmt.Errorf("local: 无效的工具名称: %q", name)
+	}
+	args := map[string]any{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &args); err != nil {
+			return "", fmt.Errorf("local: %w: %s", err, string(data))
+		}
+	} else {
+		data = []byte("{}")
+	}
+	argv, err := localToolCommand(name, tool, args)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tool.timeout())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...) //nolint:gosec
+	cmd.Stdin = bytes.NewReader(data)
+	// 只保留输出的末尾，避免过长的输出占满上下文
+	stdout := &tailBuffer{limit: localToolOutputLimit}
+	stderr := &tailBuffer{limit: localToolOutputLimit}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("local: 调用 %q 超时（%s），可以在 tools 中为它设置更长的 timeout", name, tool.timeout())
+	}
+	if err != nil {
+		out := strings.TrimSpace(stderr.String() + "\n" + stdout.String())
+		return "", fmt.Errorf("local: %s: %w\n%s", name, err, out)
+	}
+	return stdout.String(), nil
+}
+
+// localToolCommand 用工具参数渲染命令的每一项。schema 中声明了但模型没有提供的参数渲染为空字符串
+// 返回：命令及参数和错误信息
+func localToolCommand(name string, tool LocalTool, args map[string]any) ([]string, error) {
+	if props, ok := tool.Parameters["properties"].(map[string]any); ok {
+		for key := range props {
+			if _, ok := args[key]; !ok {
+				args[key] = ""
+			}
+		}
+	}
+	argv := make([]string, 0, len(tool.Command))
+	for _, part := range tool.Command {
+		tmpl, err := template.New(name).
+			Option("missingkey=error").
+			Funcs(template.FuncMap{"json": toJSON}).
+			Parse(part)
+		if err != nil {
+			return nil, fmt.Errorf("local: 工具 %q 的命令模板有误: %w", name, err)
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, args); err != nil {
+			return nil, fmt.Errorf("local: %w", err)
+		}
+		argv = append(argv, sb.String())
+	}
+	if len(argv) == 0 || argv[0] == "" {
+		return nil, fmt.Errorf("local: 工具 %q 没有设置 command", name)
+	}
+	return argv, nil
+}
+
+// toJSON 把值编码为 JSON，供命令模板使用
+func toJSON(v any) (string, error) {
+	bts, err := json.Marshal(v)
+	return string(bts), err //nolint:wrapcheck
+}
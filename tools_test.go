@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const localToolsConfig = `
+tools:
+  echo:
+    description: 原样返回文本
+    parameters:
+      type: object
+      properties:
+        text: {type: string}
+        extra: {type: string}
+      required: [text]
+    command: ["sh", "-c", "printf '%s|%s|' \"$1\" \"$2\"; cat", "sh", "{{ .text }}", "{{ .extra }}"]
+  fail:
+    command: ["sh", "-c", "echo oops >&2; exit 3"]
+`
+
+func TestLocalTools(t *testing.T) {
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config = Config{}
+	config.MCPTimeout = 10 * time.Second
+	require.NoError(t, yaml.Unmarshal([]byte(localToolsConfig), &config))
+
+	t.Run("工具定义", func(t *testing.T) {
+		tools, err := localTools()
+		require.NoError(t, err)
+		require.Len(t, tools, 2)
+		require.Equal(t, "echo", tools[0].Name)
+		require.Equal(t, "原样返回文本", tools[0].Description)
+		require.Equal(t, mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"text":  map[string]any{"type": "string"},
+				"extra": map[string]any{"type": "string"},
+			},
+			Required: []string{"text"},
+		}, tools[0].InputSchema)
+	})
+
+	t.Run("渲染命令", func(t *testing.T) {
+		argv, err := localToolCommand("echo", config.Tools["echo"], map[string]any{"text": "a; rm -rf ~"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"a; rm -rf ~", ""}, argv[4:])
+
+		_, err = localToolCommand("x", LocalTool{Command: []string{"{{ .nope }}"}}, map[string]any{})
+		require.Error(t, err)
+	})
+
+	t.Run("没有命令", func(t *testing.T) {
+		config.Tools["empty"] = LocalTool{}
+		t.Cleanup(func() { delete(config.Tools, "empty") })
+		_, err := localTools()
+		require.ErrorContains(t, err, "command")
+	})
+
+	t.Run("执行", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("需要 sh")
+		}
+		out, err := toolCall(context.Background(), "local_echo", []byte(`{"text":"a b"}`))
+		require.NoError(t, err)
+		require.Equal(t, `a b||{"text":"a b"}`, out)
+
+		_, err = toolCall(context.Background(), "local_fail", nil)
+		require.ErrorContains(t, err, "oops")
+	})
+
+	t.Run("禁用", func(t *testing.T) {
+		config.MCPDisable = []string{localToolsServer}
+		t.Cleanup(func() { config.MCPDisable = nil })
+		tools, err := mcpTools(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, tools)
+		_, err = toolCall(context.Background(), "local_echo", nil)
+		require.Error(t, err)
+	})
+}
+
+func TestConfigTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mods.yml")
+	require.NoError(t, createConfigFile(path))
+	bts, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal(bts, &cfg))
+	require.Contains(t, string(bts), `https://wttr.in/{{ .city }}?format=3`)
+}
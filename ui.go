@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/cache"
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+const (
+	uiDefaultAddr     = "127.0.0.1:7750" // --ui 默认监听的地址
+	uiShutdownTimeout = 5 * time.Second  // 关闭服务器时等待请求结束的时间
+)
+
+// uiListItem 是对话列表中的一项
+type uiListItem struct {
+	ID      string // 对话 ID
+	Short   string // 缩短的对话 ID
+	Title   string // 对话标题
+	Model   string // 使用的模型
+	Updated string // 距离上次更新的时间
+}
+
+// uiListTemplate 是对话列表页面
+var uiListTemplate = template.Must(template.Must(pageTemplates.Clone()).New("list").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+{{template "style"}}<title>mods 对话历史</title>
+<style>
+form { display: flex; gap: .5rem; margin-bottom: 1rem; }
+input { flex: 1; padding: .5rem .75rem; border: 1px solid #ddd; border-radius: .375rem; font: inherit; }
+button { padding: .5rem 1rem; border: 0; border-radius: .375rem; background: #7d56f4; color: #fff; font: inherit; cursor: pointer; }
+li { display: flex; gap: .75rem; align-items: baseline; padding: .6rem .25rem; border-bottom: 1px solid #e6e4ef; }
+ul { margin: 0; padding: 0; list-style: none; }
+.id { font-family: "SFMono-Regular", Menlo, Consolas, monospace; color: #8a8799; font-size: .875rem; }
+.title { flex: 1; }
+.meta { color: #8a8799; font-size: .875rem; white-space: nowrap; }
+</style>
+</head>
+<body>
+<main>
+<header>
+<h1>mods 对话历史</h1>
+<p>{{len .Items}} 个对话{{if .Query}}匹配 “{{.Query}}”{{end}}</p>
+</header>
+<form method="get" action="/">
+<input type="search" name="q" value="{{.Query}}" placeholder="搜索标题或内容" autofocus>
+<button type="submit">搜索</button>
+</form>
+<ul>
+{{range .Items}}<li><span class="id">{{.Short}}</span><a class="title" href="/c/{{.ID}}">{{.Title}}</a><span class="meta">{{.Model}} · {{.Updated}}</span></li>
+{{end}}</ul>
+</main>
+</body>
+</html>
+`))
+
+// runUI 启动本地只读 Web 页面，用于浏览和搜索对话历史
+// ctx: 上下文，取消或收到中断信号时关闭服务器
+// addr: 监听地址
+// 返回：错误信息
+func runUI(ctx context.Context, addr string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	convos, err := openConversations()
+	if err != nil {
+		return modsError{err, "无法打开对话缓存。"}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		uiList(w, r, convos)
+	})
+	mux.HandleFunc("GET /c/{id}", func(w http.ResponseWriter, r *http.Request) {
+		uiConversation(w, r, convos)
+	})
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return modsError{err, fmt.Sprintf("无法监听 %s。", addr)}
+	}
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: uiShutdownTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), uiShutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx) //nolint:contextcheck
+	}()
+
+	if !config.Quiet {
+		fmt.Fprintf(
+			os.Stderr,
+			"对话历史页面已启动：%s\n按 %s 退出。\n",
+			stderrStyles().Link.Render("http://"+ln.Addr().String()),
+			stderrStyles().InlineCode.Render("ctrl+c"),
+		)
+	}
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return modsError{err, "Web 页面异常退出。"}
+	}
+	return nil
+}
+
+// uiList 渲染对话列表，支持按标题、ID 或内容搜索
+func uiList(w http.ResponseWriter, r *http.Request, convos *cache.Conversations) {
+	conversations, err := db.List()
+	if err != nil {
+		http.Error(w, "无法列出保存的对话："+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	items := make([]uiListItem, 0, len(conversations))
+	for _, c := range conversations {
+		if query != "" && !uiMatches(c, query, convos) {
+			continue
+		}
+		item := uiListItem{
+			ID:      c.ID,
+			Short:   shortID(c.ID),
+			Title:   c.Title,
+			Updated: formatTime(c.UpdatedAt),
+		}
+		if c.Model != nil {
+			item.Model = *c.Model
+		}
+		items = append(items, item)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = uiListTemplate.Execute(w, struct {
+		Query string
+		Items []uiListItem
+	}{query, items})
+}
+
+// uiMatches 判断对话的标题、ID 或消息内容是否包含搜索词（不区分大小写）
+func uiMatches(c Conversation, query string, convos *cache.Conversations) bool {
+	query = strings.ToLower(query)
+	if strings.Contains(strings.ToLower(c.Title), query) || strings.HasPrefix(c.ID, query) {
+		return true
+	}
+	var messages []proto.Message
+	if err := convos.Read(c.ID, &messages); err != nil {
+		return false
+	}
+	for _, msg := range messages {
+		if strings.Contains(strings.ToLower(msg.Content), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// uiConversation 渲染单个对话
+func uiConversation(w http.ResponseWriter, r *http.Request, convos *cache.Conversations) {
+	convo, err := db.Find(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var messages []proto.Message
+	if err := convos.Read(convo.ID, &messages); err != nil {
+		http.Error(w, "无法读取对话："+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page, err := renderPage(convo.Title, convo.UpdatedAt.Local(), "/", messages)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = fmt.Fprint(w, page)
+}
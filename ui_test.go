@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/cache"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUIMatches 测试对话历史页面的搜索
+func TestUIMatches(t *testing.T) {
+	convos, err := cache.NewConversations(t.TempDir())
+	require.NoError(t, err)
+
+	id := newConversationID()
+	messages := []proto.Message{
+		{Role: proto.RoleUser, Content: "怎么写 Makefile"},
+		{Role: proto.RoleAssistant, Content: "使用 PHONY 目标"},
+	}
+	require.NoError(t, convos.Write(id, &messages))
+	convo := Conversation{ID: id, Title: "构建脚本"}
+
+	t.Run("标题", func(t *testing.T) {
+		require.True(t, uiMatches(convo, "构建", convos))
+	})
+	t.Run("ID 前缀", func(t *testing.T) {
+		require.True(t, uiMatches(convo, id[:sha1short], convos))
+	})
+	t.Run("内容不区分大小写", func(t *testing.T) {
+		require.True(t, uiMatches(convo, "phony", convos))
+	})
+	t.Run("不匹配", func(t *testing.T) {
+		require.False(t, uiMatches(convo, "docker", convos))
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+// undoLast 是不带参数使用 --undo 时的值，表示最近的对话
+const undoLast = "HEAD"
+
+// undoConversation 删除对话中最近的一轮问答（用户消息、回答以及其中的工具调用）
+// in: 对话 ID 或标题，为 undoLast 时使用 args 或最近的对话
+// args: 命令行参数，允许使用 --undo <ID> 的形式
+// 返回：错误信息
+func undoConversation(in string, args []string) error {
+	if in == undoLast && len(args) > 0 {
+		in = strings.Join(args, " ")
+	}
+
+	var convo *Conversation
+	var err error
+	if in == undoLast {
+		convo, err = db.FindHEAD()
+	} else {
+		convo, err = db.Find(in)
+	}
+	if err != nil {
+		return modsError{err, "无法找到对话。"}
+	}
+
+	c, err := openConversations()
+	if err != nil {
+		return modsError{err, "无法打开对话缓存。"}
+	}
+	var messages []proto.Message
+	if err := c.Read(convo.ID, &messages); err != nil {
+		return modsError{err, "无法读取对话。"}
+	}
+
+	rest, _, ok := splitLastExchange(messages)
+	if !ok {
+		return modsError{errors.New("对话中没有用户消息"), "无法撤销。"}
+	}
+	if lastPrompt(rest) == "" {
+		return modsError{
+			newUserErrorf("对话只有一轮问答，请使用 %s 删除整个对话", stderrStyles().InlineCode.Render("--delete")),
+			"无法撤销。",
+		}
+	}
+
+	if err := c.Write(convo.ID, &rest); err != nil {
+		return modsError{err, "无法写入对话缓存。"}
+	}
+	if err := db.SetUpdatedAt(convo.ID, time.Now()); err != nil {
+		return modsError{err, "无法保存对话。"}
+	}
+
+	if !config.Quiet {
+		fmt.Fprintln(
+			os.Stderr,
+			"已撤销最近一轮问答:",
+			stderrStyles().InlineCode.Render(shortID(convo.ID)),
+			stderrStyles().Comment.Render(convo.Title),
+		)
+	}
+	return nil
+}
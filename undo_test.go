@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/cache"
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUndoConversation(t *testing.T) {
+	oldDB, oldPath, oldQuiet := db, config.CachePath, config.Quiet
+	t.Cleanup(func() { db, config.CachePath, config.Quiet = oldDB, oldPath, oldQuiet })
+	db = testDB(t)
+	config.CachePath = t.TempDir()
+	config.Quiet = true
+
+	c, err := cache.NewConversations(config.CachePath)
+	require.NoError(t, err)
+	id := newConversationID()
+	messages := []proto.Message{
+		{Role: proto.RoleUser, Content: "first"},
+		{Role: proto.RoleAssistant, Content: "answer"},
+		{Role: proto.RoleUser, Content: "second"},
+		{Role: proto.RoleAssistant, ToolCalls: []proto.ToolCall{{ID: "1"}}},
+		{Role: proto.RoleTool, Content: "result", ToolCalls: []proto.ToolCall{{ID: "1"}}},
+		{Role: proto.RoleAssistant, Content: "bad answer"},
+	}
+	require.NoError(t, c.Write(id, &messages))
+	require.NoError(t, db.Save(id, "second", "openai", "gpt-4o"))
+
+	t.Run("撤销最近的对话", func(t *testing.T) {
+		require.NoError(t, undoConversation(undoLast, nil))
+		var got []proto.Message
+		require.NoError(t, c.Read(id, &got))
+		require.Equal(t, messages[:2], got)
+	})
+
+	t.Run("只剩一轮", func(t *testing.T) {
+		require.Error(t, undoConversation(undoLast, []string{id[:sha1short]}))
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/mods/internal/proto"
+)
+
+// tokensPerPrice 是价格表的计价单位：每百万令牌
+const tokensPerPrice = 1_000_000
+
+// addUsage 记录一次已完成请求的令牌用量，同时写入本地的用量记录，供使用摘要统计
+func (m *Mods) addUsage(u proto.Usage) {
+	m.usage.Add(u)
+	m.unsavedUsage.Add(u)
+	if db != nil {
+		cost, _ := estimateCost(m.model, u)
+		_ = db.LogUsage(time.Now(), m.model.API, m.model.Name, u, cost)
+	}
+}
+
+// estimateCost 根据模型的价格表估算费用
+// mod: 模型配置
+// u: 令牌用量
+// 返回：费用（美元），以及模型是否配置了价格
+func estimateCost(mod Model, u proto.Usage) (float64, bool) {
+	if mod.InputPrice == 0 && mod.OutputPrice == 0 {
+		return 0, false
+	}
+	return (float64(u.InputTokens)*mod.InputPrice + float64(u.OutputTokens)*mod.OutputPrice) / tokensPerPrice, true
+}
+
+// usageSummary 返回本次运行的令牌用量与预估费用的摘要
+func (m *Mods) usageSummary() string {
+	input := fmt.Sprintf("%d", m.usage.InputTokens)
+	if m.usage.CacheReadTokens > 0 {
+		input += fmt.Sprintf("（缓存命中 %d）", m.usage.CacheReadTokens)
+	}
+	parts := []string{
+		fmt.Sprintf("令牌: 输入 %s · 输出 %d", input, m.usage.OutputTokens),
+	}
+	if cost, ok := estimateCost(m.model, m.usage); ok {
+		parts = append(parts, fmt.Sprintf("预估费用 $%.4f", cost))
+	}
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/mods/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEstimateCost 测试按价格表估算费用
+func TestEstimateCost(t *testing.T) {
+	usage := proto.Usage{InputTokens: 2_000_000, OutputTokens: 500_000}
+
+	t.Run("已配置价格", func(t *testing.T) {
+		cost, ok := estimateCost(Model{InputPrice: 0.15, OutputPrice: 0.6}, usage)
+		require.True(t, ok)
+		require.InDelta(t, 0.6, cost, 1e-9)
+	})
+
+	t.Run("未配置价格", func(t *testing.T) {
+		_, ok := estimateCost(Model{}, usage)
+		require.False(t, ok)
+	})
+}
+
+// TestUsageSummary 测试用量摘要中的缓存命中
+func TestUsageSummary(t *testing.T) {
+	m := &Mods{usage: proto.Usage{InputTokens: 1200, OutputTokens: 30, CacheReadTokens: 1000}}
+	require.Equal(t, "令牌: 输入 1200（缓存命中 1000） · 输出 30", m.usageSummary())
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errOutsideCwd  = errors.New("在当前目录之外")       // 文件解析后的路径不在当前目录中
+	errSpecialFile = errors.New("不是普通文件")        // 设备文件、管道、套接字等
+	errFileChanged = errors.New("文件在检查和读取之间被替换") // 检查之后路径指向了另一个文件
+)
+
+// resolveUserPath 解析命令行中给出的文件或目录的真实路径。
+// 没有设置 --allow-outside-cwd 时，解析符号链接后的路径必须在当前目录之内，
+// 避免自动化流程中的参数或仓库中的符号链接读到工作目录以外的文件
+// path: 文件或目录
+// 返回：真实的绝对路径和错误信息
+func resolveUserPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	if config.AllowOutsideCwd {
+		return real, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	cwd, err = filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	if !withinDir(cwd, real) {
+		if withinDir(cwd, abs) {
+			return "", fmt.Errorf("%s 是指向 %s 的符号链接，%w，使用 --allow-outside-cwd 允许读取", path, real, errOutsideCwd)
+		}
+		return "", fmt.Errorf("%s %w，使用 --allow-outside-cwd 允许读取", path, errOutsideCwd)
+	}
+	return real, nil
+}
+
+// withinDir 判断路径是否是目录本身或在目录之中。不同卷上的路径（Windows）视为不在目录中
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || filepath.IsAbs(rel) {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// readUserFile 读取命令行中给出的文件，例如 --attach 和 --apply 的文件。
+// 除了 resolveUserPath 的检查，还拒绝设备文件、命名管道等特殊文件，读取它们可能永远阻塞
+// path: 文件路径
+// 返回：文件内容和错误信息
+func readUserFile(path string) ([]byte, error) {
+	real, err := resolveUserPath(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s %w", path, errSpecialFile)
+	}
+	f, err := os.Open(real)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	defer f.Close() //nolint:errcheck
+
+	opened, err := f.Stat()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if !os.SameFile(info, opened) {
+		return nil, fmt.Errorf("%s: %w", path, errFileChanged)
+	}
+	return io.ReadAll(f) //nolint:wrapcheck
+}
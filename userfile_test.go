@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadUserFile(t *testing.T) {
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0o600))
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile("a.txt", []byte("a"), 0o600))
+
+	oldConfig := config
+	t.Cleanup(func() { config = oldConfig })
+	config.AllowOutsideCwd = false
+
+	t.Run("当前目录中的文件", func(t *testing.T) {
+		bts, err := readUserFile("a.txt")
+		require.NoError(t, err)
+		require.Equal(t, "a", string(bts))
+		bts, err = readUserFile(filepath.Join(dir, "a.txt"))
+		require.NoError(t, err)
+		require.Equal(t, "a", string(bts))
+	})
+
+	t.Run("当前目录之外的文件", func(t *testing.T) {
+		_, err := readUserFile(secret)
+		require.ErrorIs(t, err, errOutsideCwd)
+		_, err = readUserFile(filepath.Join("..", filepath.Base(outside), "secret.txt"))
+		require.ErrorIs(t, err, errOutsideCwd)
+	})
+
+	t.Run("符号链接逃逸", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("需要创建符号链接的权限")
+		}
+		require.NoError(t, os.Symlink(secret, "link.txt"))
+		_, err := readUserFile("link.txt")
+		require.ErrorIs(t, err, errOutsideCwd)
+		require.ErrorContains(t, err, "符号链接")
+
+		require.NoError(t, os.Symlink("a.txt", "inside.txt"))
+		bts, err := readUserFile("inside.txt")
+		require.NoError(t, err)
+		require.Equal(t, "a", string(bts))
+	})
+
+	t.Run("允许读取目录之外的文件", func(t *testing.T) {
+		config.AllowOutsideCwd = true
+		t.Cleanup(func() { config.AllowOutsideCwd = false })
+		bts, err := readUserFile(secret)
+		require.NoError(t, err)
+		require.Equal(t, "secret", string(bts))
+	})
+
+	t.Run("目录", func(t *testing.T) {
+		_, err := readUserFile(".")
+		require.ErrorIs(t, err, errSpecialFile)
+	})
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadUserFileFIFO(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, syscall.Mkfifo("fifo", 0o600))
+
+	// 打开命名管道会一直阻塞到有写入方，必须在打开之前拒绝
+	_, err := readUserFile("fifo")
+	require.ErrorIs(t, err, errSpecialFile)
+}